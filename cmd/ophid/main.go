@@ -1,32 +1,80 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
+	"os/user"
 	"path/filepath"
+	goruntime "runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleicon/ophid/internal/backup"
+	"github.com/gleicon/ophid/internal/bundle"
+	"github.com/gleicon/ophid/internal/ci"
+	"github.com/gleicon/ophid/internal/clidoc"
+	"github.com/gleicon/ophid/internal/config"
+	"github.com/gleicon/ophid/internal/drift"
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/events"
+	"github.com/gleicon/ophid/internal/githook"
+	"github.com/gleicon/ophid/internal/httpclient"
+	"github.com/gleicon/ophid/internal/lockdown"
+	"github.com/gleicon/ophid/internal/mcp"
+	"github.com/gleicon/ophid/internal/metrics"
+	"github.com/gleicon/ophid/internal/proxy"
+	"github.com/gleicon/ophid/internal/proxy/localca"
+	"github.com/gleicon/ophid/internal/remote"
 	"github.com/gleicon/ophid/internal/runtime"
+	"github.com/gleicon/ophid/internal/sandbox"
+	"github.com/gleicon/ophid/internal/scaffold"
+	"github.com/gleicon/ophid/internal/secrets"
 	"github.com/gleicon/ophid/internal/security"
+	"github.com/gleicon/ophid/internal/security/policy"
+	"github.com/gleicon/ophid/internal/store"
 	"github.com/gleicon/ophid/internal/supervisor"
+	"github.com/gleicon/ophid/internal/support"
 	"github.com/gleicon/ophid/internal/tool"
-	"github.com/gleicon/ophid/internal/proxy"
+	"github.com/gleicon/ophid/internal/ui"
 )
 
 var (
-	version = "0.1.0-dev"
-	homeDir string
+	version     = "0.1.0-dev"
+	homeDir     string             // ~/.ophid, or the home of --profile
+	baseHomeDir string             // ~/.ophid, which holds the profiles
+	profileName string             // --profile or OPHID_PROFILE
+	cfg         = config.Default() // ~/.ophid/config.toml, loaded before each command
 )
 
 func main() {
-	// Initialize structured logging
+	// Initialize structured logging; the config sets the level
+	logLevel := new(slog.LevelVar)
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: logLevel,
 	}))
 	slog.SetDefault(logger)
 
@@ -37,6 +85,7 @@ func main() {
 		os.Exit(1)
 	}
 	homeDir = filepath.Join(home, ".ophid")
+	baseHomeDir = homeDir
 
 	rootCmd := &cobra.Command{
 		Use:   "ophid",
@@ -44,26 +93,151 @@ func main() {
 		Long: `OPHID is a Go-powered runtime manager for Python operations tools.
 It makes Python-based infrastructure tools trivial to install and run,
 with zero Python knowledge required.`,
-		Version: version,
+		Version:       version,
+		SilenceErrors: true, // Printed by exitWithError
+	}
+
+	var errorFormat string
+	var limitRate string
+	var uiOptions ui.Options
+	rootCmd.PersistentFlags().StringVar(&errorFormat, "error-format", "text", "Error output format (text|json)")
+	rootCmd.PersistentFlags().BoolVar(&uiOptions.NoColor, "no-color", false, "Don't color output (also NO_COLOR)")
+	rootCmd.PersistentFlags().BoolVar(&uiOptions.NoEmoji, "no-emoji", false, "Use [OK]/[WARN]/[ERROR] tags instead of symbols")
+	rootCmd.PersistentFlags().StringVar(&limitRate, "limit-rate", "", "Cap download speed in bytes per second, e.g. 500K or 2M (download.limit_rate)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", os.Getenv(config.ProfileEnv), "Use a named profile with its own home, tools and daemon (also "+config.ProfileEnv+")")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		ui.Configure(uiOptions)
+		if errorFormat == "json" {
+			cmd.SilenceUsage = true // Keep stderr parseable
+		}
+		if err := useProfile(cmd); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		loaded, err := config.Load(homeDir)
+		if err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		cfg = loaded
+		logLevel.Set(cfg.LogLevel())
+		if limitRate != "" {
+			cfg.Download.LimitRate = limitRate
+		}
+		rate, err := cfg.LimitRate()
+		if err != nil {
+			return err
+		}
+		if err := cfg.ApplyProxy(homeDir); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		if err := store.Configure(cfg.Cache.Dedupe); err != nil {
+			return err
+		}
+		if err := httpclient.Configure(httpclient.Options{CAFiles: cfg.CAFiles(), LimitRate: rate}); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		var webhooks []events.Webhook
+		for _, w := range cfg.Events.Webhooks {
+			webhooks = append(webhooks, events.Webhook{URL: w.URL, Types: w.Types})
+		}
+		events.Configure(homeDir, webhooks)
+		return nil
 	}
 
 	rootCmd.AddCommand(runtimeCmd())
 	rootCmd.AddCommand(installCmd())
 	rootCmd.AddCommand(runCmd())
+	rootCmd.AddCommand(historyCmd())
+	rootCmd.AddCommand(eventsCmd())
+	rootCmd.AddCommand(sandboxCmd())
+	rootCmd.AddCommand(superviseCmd())
+	rootCmd.AddCommand(daemonCmd())
+	rootCmd.AddCommand(psCmd())
+	rootCmd.AddCommand(stopCmd())
+	rootCmd.AddCommand(logsCmd())
+	rootCmd.AddCommand(jobsCmd())
 	rootCmd.AddCommand(listCmd())
 	rootCmd.AddCommand(upgradeCmd())
 	rootCmd.AddCommand(uninstallCmd())
 	rootCmd.AddCommand(searchCmd())
 	rootCmd.AddCommand(infoCmd())
+	rootCmd.AddCommand(whichCmd())
+	rootCmd.AddCommand(shimsCmd())
+	rootCmd.AddCommand(bundleCmd())
+	rootCmd.AddCommand(exportCmd())
+	rootCmd.AddCommand(importCmd())
+	rootCmd.AddCommand(adoptCmd())
+	rootCmd.AddCommand(sbomCmd())
+	rootCmd.AddCommand(lockCmd())
+	rootCmd.AddCommand(newCmd())
 	rootCmd.AddCommand(cacheCmd())
+	rootCmd.AddCommand(configCmd())
+	rootCmd.AddCommand(profileCmd())
 	rootCmd.AddCommand(doctorCmd())
 	rootCmd.AddCommand(scanCmd())
 	rootCmd.AddCommand(proxyCmd())
+	rootCmd.AddCommand(serveCmd())
+	rootCmd.AddCommand(mcpCmd())
+	rootCmd.AddCommand(metricsCmd())
+	rootCmd.AddCommand(backupCmd())
+	rootCmd.AddCommand(restoreCmd())
+	rootCmd.AddCommand(secretCmd())
+	rootCmd.AddCommand(authCmd())
+	rootCmd.AddCommand(remoteCmd())
+	rootCmd.AddCommand(fleetCmd())
+	rootCmd.AddCommand(statusCmd())
+	rootCmd.AddCommand(lockdownCmd())
+	rootCmd.AddCommand(verifyCmd())
+	rootCmd.AddCommand(ciCmd())
+	rootCmd.AddCommand(docsCmd())
+
+	err = rootCmd.Execute()
+	// Webhooks of the events the command emitted are still being posted
+	events.Flush()
+	if err != nil {
+		exitWithError(err, errorFormat)
+	}
+}
 
-	if err := rootCmd.Execute(); err != nil {
+// exitWithError prints err and exits with the status of its error code, so
+// scripts can tell a network failure from a blocked install without parsing
+// the message. With format "json" the error is printed as
+// {"error":{"code":"...","message":"..."}}.
+func exitWithError(err error, format string) {
+	code := errcode.Of(err)
+	if format == "json" {
+		data, _ := json.Marshal(map[string]any{
+			"error": map[string]string{"code": string(code), "message": err.Error()},
+		})
+		fmt.Fprintln(os.Stderr, string(data))
+	} else {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
 	}
+	os.Exit(errcode.ExitStatus(code))
+}
+
+// useProfile switches the ophid home to the profile selected with
+// --profile or OPHID_PROFILE, which must exist except for the profile
+// commands. The profile is exported so the processes ophid starts, like
+// the daemon, use it too.
+func useProfile(cmd *cobra.Command) error {
+	if profileName == "" || profileName == config.DefaultProfile {
+		return nil
+	}
+	if err := config.ValidateProfile(profileName); err != nil {
+		return err
+	}
+	home := config.ProfileHome(baseHomeDir, profileName)
+	if cmd.HasParent() && cmd.Parent().Name() != "profile" {
+		if _, err := os.Stat(home); errors.Is(err, os.ErrNotExist) {
+			return errcode.Errorf(errcode.NotFound, "profile %s doesn't exist; create it with 'ophid profile create %s'", profileName, profileName)
+		}
+	}
+	homeDir = home
+	return os.Setenv(config.ProfileEnv, profileName)
 }
 
 // runtimeCmd manages Python runtimes
@@ -83,19 +257,28 @@ func runtimeCmd() *cobra.Command {
 
 func runtimeInstallCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "install <runtime@version>",
-		Short: "Install a runtime (python@3.12.1, node@20.0.0, or just version for Python)",
+		Use:   "install [runtime@version]",
+		Short: "Install a runtime (python@3.12.1, node@20.0.0, rust@stable, or just version for Python)",
 		Long: `Install a runtime interpreter.
 
 Formats:
   ophid runtime install python@3.12.1  # Install Python 3.12.1
   ophid runtime install node@20.0.0    # Install Node.js 20.0.0 (future)
+  ophid runtime install rust@stable    # Install a Rust toolchain with rustup
   ophid runtime install 3.12.1         # Install Python 3.12.1 (default)
+  ophid runtime install                # Install the Python of config.toml
 
-Currently only Python runtimes are implemented.`,
-		Args:  cobra.ExactArgs(1),
+Python, Node.js and Rust runtimes are implemented. Rust toolchains build
+Rust tools installed with ophid install cargo:<crate>.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			spec := args[0]
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
+			spec := cfg.Python.Version
+			if len(args) > 0 {
+				spec = args[0]
+			}
 
 			mgr := runtime.NewManager(homeDir)
 			rt, err := mgr.Install(spec)
@@ -103,9 +286,10 @@ Currently only Python runtimes are implemented.`,
 				return err
 			}
 
-			fmt.Printf("\n%s %s installed:\n", rt.Type.DisplayName(), rt.Version)
-			fmt.Printf("  Path: %s\n", rt.Path)
-			fmt.Printf("  Platform: %s/%s\n", rt.OS, rt.Arch)
+			ui.Println()
+			ui.Success("%s %s installed", rt.Type.DisplayName(), rt.Version)
+			ui.Printf("  Path: %s\n", rt.Path)
+			ui.Printf("  Platform: %s/%s\n", rt.OS, rt.Arch)
 			return nil
 		},
 	}
@@ -143,6 +327,9 @@ func runtimeRemoveCmd() *cobra.Command {
 		Short: "Remove a runtime (python@3.12.1 or just version for Python)",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
 			spec := args[0]
 
 			mgr := runtime.NewManager(homeDir)
@@ -154,6 +341,25 @@ func runtimeRemoveCmd() *cobra.Command {
 func installCmd() *cobra.Command {
 	var version string
 	var force bool
+	var prefer bool
+	var profile string
+	var components []string
+	var indexURL string
+	var fromSource bool
+	var buildPolicy string
+	var onlyBinary bool
+	var skipScan bool
+	var requireScan bool
+	var plan bool
+	var smokeTest string
+	var python string
+	var ecosystem string
+	var fromLock string
+
+	var profiles strings.Builder
+	for _, p := range tool.Profiles() {
+		fmt.Fprintf(&profiles, "\n  %-8s %s", p.Name, p.Description)
+	}
 
 	cmd := &cobra.Command{
 		Use:   "install <tool>",
@@ -163,21 +369,149 @@ func installCmd() *cobra.Command {
 Examples:
   ophid install ansible           # Install latest version
   ophid install ansible --version 2.10.0  # Install specific version
-  ophid install ansible --force   # Force reinstall`,
-		Args: cobra.ExactArgs(1),
+  ophid install ansible --force   # Force reinstall
+  ophid install ansible --python 3.11   # Build the venv with Python 3.11
+  ophid install --profile aws     # Curated cloud CLI install
+  ophid install --profile gcloud --component gke-gcloud-auth-plugin
+  ophid install internal-cli --index-url https://pypi.corp.example/simple
+  ophid install ansible --only-binary   # Fail rather than compile anything
+  ophid install ansible --plan    # Show what would be downloaded, and its vulnerabilities
+  ophid install ansible --smoke-test "ansible --version"
+  ophid install --from-lock ansible.lock  # Reinstall exactly what was locked
+  ophid install cargo:ripgrep     # Rust tool from crates.io
+  ophid install cargo:ripgrep --from-source
+  ophid install gem:rubocop       # Ruby tool from RubyGems
+  ophid install conda:gdal        # Conda package from conda-forge
+  ophid install conda:bioconda::samtools
+  ophid install prettier --ecosystem node  # Node.js tool from npm
+  ophid install npm:@mermaid-js/mermaid-cli
+
+Rust tools install from the binaries of their GitHub release when it has
+some for this platform, checked against its published checksums, and are
+otherwise built with cargo: a toolchain from ophid runtime install
+rust@stable, or cargo from PATH.
+
+Ruby tools install into a GEM_HOME of their own with the ruby of
+~/.ophid/runtimes/ruby-<version>, or ruby from PATH. Git and local Ruby
+projects install from their gemspec, or with bundler from their Gemfile.
+
+Conda packages, for tools built on compiled stacks pip struggles with
+(gdal, netcdf), install into an environment of their own with micromamba:
+from PATH, or downloaded into ~/.ophid/runtimes/micromamba on first use.
+OSV has no conda advisories, so they aren't scanned for vulnerabilities.
+
+Node.js tools install from npm (npm:<package>, an npmjs.com URL, or a bare
+name with --ecosystem node) into an npm prefix of their own, with the node
+of ~/.ophid/runtimes/node-<version> (ophid runtime install node@<version>),
+or node from PATH. Their executables run with that node. Scoped packages
+are named after scope and package: @angular/cli installs as angular-cli.
+
+Python packages install from wheels when there are any, even of an older
+version, so servers don't need a compiler (--build-policy prefer-binary).
+--only-binary (--build-policy only-binary) never builds from source and
+fails when a package has no wheel for the runtime's Python and platform;
+--build-policy allow-source leaves the choice to pip. Upgrades keep the
+tool's policy.
+
+When another installed tool already provides an executable of the same
+name, that tool keeps the name and the new one runs as <tool>:<executable>
+(e.g. ophid run httpie:http). --prefer gives the names to the new tool.
+
+Private indexes and git hosts authenticate with credentials from ophid auth
+login or git's credential helpers; they are never kept in the manifest.
+
+--plan resolves the packages a Python tool would install with pip's
+--dry-run, without touching disk, and lists them with their download size,
+the ones pip would build from source, and their known vulnerabilities
+unless the scan is skipped. It fails when a blocking security policy would
+refuse any of them.
+
+Installs are checked against the security policy in ~/.ophid/policy.yaml:
+the highest vulnerability severity allowed, banned licenses and packages,
+a minimum release age and the sources each source type may install from.
+In block mode, or with the block scan policy (--require-scan), violations
+refuse the install; otherwise they are warnings. Without a policy file,
+--require-scan refuses critical vulnerabilities. See ophid scan policy.
+
+Python tools get a venv of the configured Python version, or the newest
+installed if that one isn't, and --python picks another: a version such as
+3.11.7, a prefix such as 3.11 or a PEP 440 range such as ">=3.10,<3.13".
+The newest installed Python satisfying it is used, or else the newest
+python-build-standalone release that does is installed first. The version
+is recorded in the manifest, and ophid run, upgrades and doctor's rebuilds
+use it from then on.
+
+Python tools are frozen after install and upgrade: what pip freeze lists
+in the venv goes to ~/.ophid/tools/<tool>.lock, a requirements.txt naming
+the tool and its Python version in its first line. --from-lock reinstalls
+that environment, from the same Python unless --python says otherwise,
+every package at its locked version. ophid doctor reports venvs that have
+drifted from their lock, and --fix puts them back.
+
+--smoke-test runs a command of the tool after it installs, split on spaces,
+and fails the install when it exits non-zero or runs over a minute. The
+tool stays installed for inspection; the command and its result are
+recorded in the manifest, upgrades run it again and so does ophid doctor.
+Profiles come with one.
+
+Profiles install tools that need more than pip install; ophid doctor checks
+the credentials they would use:` + profiles.String(),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if profile != "" {
+				return cobra.NoArgs(cmd, args)
+			}
+			if fromLock != "" {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			toolName := args[0]
+			if !plan {
+				if err := checkUnlocked(cmd, args); err != nil {
+					return err
+				}
+			}
+			toolName := profile
+			if len(args) > 0 {
+				toolName = args[0]
+			}
+			policy, err := buildPolicyFlag(buildPolicy, onlyBinary)
+			if err != nil {
+				return err
+			}
 
-			// Get Python runtime
+			// A lockfile names the tool, its version and its Python
+			var lock *tool.ToolLock
+			if fromLock != "" {
+				if fromLock, err = filepath.Abs(fromLock); err != nil {
+					return err
+				}
+				if lock, err = tool.ReadToolLock(fromLock); err != nil {
+					return err
+				}
+				if toolName != "" && toolName != lock.Tool {
+					return fmt.Errorf("%s locks %s, not %s", fromLock, lock.Tool, toolName)
+				}
+				toolName = lock.Tool
+				if python == "" {
+					python = lock.Python
+				}
+			}
+
+			// Get the Python runtime: the one asked for, installed if it is
+			// an exact version that isn't yet, or the default
 			runtimeMgr := runtime.NewManager(homeDir)
-			pythonRuntime, err := runtimeMgr.Get("3.12.1")
+			var pythonRuntime *runtime.Runtime
+			switch {
+			case python != "" && plan:
+				pythonRuntime, err = runtimeMgr.FindPython(python)
+			case python != "":
+				pythonRuntime, err = runtimeMgr.EnsureRuntime(python)
+			default:
+				pythonRuntime, err = defaultPython(runtimeMgr)
+			}
 			if err != nil {
-				// Try to find any installed runtime
-				runtimes, listErr := runtimeMgr.List()
-				if listErr != nil || len(runtimes) == 0 {
-					return fmt.Errorf("no Python runtime installed. Run: ophid runtime install 3.12.1")
-				}
-				pythonRuntime = runtimes[0]
+				return err
 			}
 
 			pythonPath := filepath.Join(pythonRuntime.Path, "bin", "python3")
@@ -193,13 +527,38 @@ Examples:
 
 			// Install tool
 			opts := tool.InstallOptions{
-				Version: version,
-				Force:   force,
+				Version:     version,
+				Force:       force,
+				Python:      pythonRuntime.Version,
+				Prefer:      prefer,
+				Profile:     profile,
+				Components:  components,
+				IndexURL:    indexURL,
+				FromSource:  fromSource,
+				BuildPolicy: policy,
+				SmokeTest:   strings.Fields(smokeTest),
+				Ecosystem:   ecosystem,
+			}
+			if lock != nil {
+				opts.Version, opts.Requirements = lock.Version, fromLock
+			}
+			scanPolicy := ""
+			if skipScan {
+				scanPolicy = config.ScanSkip
+			} else if requireScan {
+				scanPolicy = config.ScanBlock
+			}
+			if err := applyConfig(&opts, scanPolicy); err != nil {
+				return err
 			}
 
+			if plan {
+				return printInstallPlan(cmd.Context(), installer, toolName, opts)
+			}
 			if _, err := installer.Install(toolName, opts); err != nil {
 				return fmt.Errorf("installation failed: %w", err)
 			}
+			pruneCache()
 
 			return nil
 		},
@@ -207,245 +566,5313 @@ Examples:
 
 	cmd.Flags().StringVar(&version, "version", "latest", "Tool version to install")
 	cmd.Flags().BoolVar(&force, "force", false, "Force reinstall")
+	cmd.Flags().StringVar(&python, "python", "", "Python version or range to build the tool's venv with, e.g. 3.11 or \">=3.10,<3.13\" (installed if missing)")
+	cmd.Flags().BoolVar(&prefer, "prefer", false, "Take executable names other installed tools also provide")
+	cmd.Flags().StringVar(&profile, "profile", "", "Install a curated profile instead of a tool (aws, azure, gcloud)")
+	cmd.Flags().StringSliceVar(&components, "component", nil, "Extra components for the gcloud profile (repeatable)")
+	cmd.Flags().StringVar(&indexURL, "index-url", "", "Package index to install from, authenticated with stored credentials")
+	cmd.Flags().StringVar(&ecosystem, "ecosystem", "", "Registry of a bare package name: python (PyPI, default) or node (npm)")
+	cmd.Flags().BoolVar(&fromSource, "from-source", false, "Build Rust tools with cargo even when their release has binaries")
+	cmd.Flags().StringVar(&buildPolicy, "build-policy", "", "Whether pip may build from source: prefer-binary (default), only-binary, allow-source")
+	cmd.Flags().BoolVar(&onlyBinary, "only-binary", false, "Install wheels only, never building from source (--build-policy only-binary)")
+	cmd.Flags().BoolVar(&skipScan, "skip-scan", false, "Skip the security scan (scan policy skip)")
+	cmd.Flags().BoolVar(&requireScan, "require-scan", false, "Refuse tools violating the security policy (scan policy block)")
+	cmd.Flags().BoolVar(&plan, "plan", false, "Show the packages that would be installed, without installing them")
+	cmd.Flags().StringVar(&smokeTest, "smoke-test", "", "Command checking the tool works after install, e.g. \"ansible --version\"")
+	cmd.Flags().StringVar(&fromLock, "from-lock", "", "Reinstall a Python tool exactly as a lockfile (~/.ophid/tools/<tool>.lock) records it")
+	cmd.MarkFlagsMutuallyExclusive("skip-scan", "require-scan")
+	cmd.MarkFlagsMutuallyExclusive("from-lock", "version")
+	cmd.MarkFlagsMutuallyExclusive("from-lock", "profile")
+	cmd.MarkFlagsMutuallyExclusive("from-lock", "plan")
 
 	return cmd
 }
 
+// printInstallPlan prints what installing a tool would download
+func printInstallPlan(ctx context.Context, installer *tool.Installer, toolName string, opts tool.InstallOptions) error {
+	ui.Printf("Resolving %s...\n", toolName)
+	plan, err := installer.Plan(ctx, toolName, opts)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tVERSION\tSIZE\tVULNERABILITIES")
+	builds, critical := 0, 0
+	for _, pkg := range plan.Packages {
+		size := "?"
+		if pkg.Size > 0 {
+			size = formatBytes(pkg.Size)
+		}
+		if pkg.Build {
+			size += " (build)"
+			builds++
+		}
+		vulns := "-"
+		switch {
+		case len(pkg.Vulnerabilities) > 0:
+			vulns = strings.Join(pkg.Vulnerabilities, ", ")
+			if pkg.Critical > 0 {
+				vulns = fmt.Sprintf("%d critical: %s", pkg.Critical, vulns)
+			} else if pkg.Severity > security.SeverityNone {
+				vulns = fmt.Sprintf("%s: %s", pkg.Severity, vulns)
+			}
+		case pkg.ScanError != "":
+			vulns = "scan failed"
+		case !plan.Scanned:
+			vulns = "not scanned"
+		}
+		critical += pkg.Critical
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", pkg.Name, pkg.Version, size, vulns)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	total := formatBytes(plan.DownloadSize)
+	if plan.UnknownSizes > 0 {
+		total = fmt.Sprintf("%s, plus %d of unknown size", total, plan.UnknownSizes)
+	}
+	ui.Printf("\n%s %s: %d packages, %s to download\n", plan.Tool, plan.Version, len(plan.Packages), total)
+	if builds > 0 {
+		ui.Warn("%d packages would be built from source", builds)
+	}
+	if vulnerable := plan.Vulnerable(); len(vulnerable) > 0 {
+		ui.Warn("%d packages have known vulnerabilities (%d critical)", len(vulnerable), critical)
+	} else if plan.Scanned {
+		ui.OK("No vulnerabilities found")
+	}
+	if opts.Policy == nil {
+		return nil
+	}
+	violations := plan.Violations(opts.Policy)
+	for _, v := range violations {
+		ui.Warn("Policy: %s", v.Message)
+	}
+	if len(violations) > 0 && opts.Policy.Blocks() {
+		return errcode.Errorf(errcode.PolicyBlocked, "installation would be blocked by policy (%d violations)", len(violations))
+	}
+	return nil
+}
+
+// applyConfig fills in the install options config.toml sets: the package
+// index, and the scan policy unless scanPolicy, from a flag, overrides it.
+// Installs are checked against the security policy, which the block scan
+// policy makes blocking.
+func applyConfig(opts *tool.InstallOptions, scanPolicy string) error {
+	if opts.IndexURL == "" {
+		opts.IndexURL = cfg.Index.URL
+	}
+	if scanPolicy == "" {
+		scanPolicy = cfg.Scan.Policy
+	}
+	opts.SkipScan = scanPolicy == config.ScanSkip
+	p, err := loadPolicy(scanPolicy == config.ScanBlock)
+	if err != nil {
+		return err
+	}
+	opts.Policy = p
+	return nil
+}
+
+// loadPolicy reads the security policy in ~/.ophid/policy.yaml, nil when
+// there is none. block makes it refuse what violates it, with the default
+// rules (no critical vulnerabilities) when there is none.
+func loadPolicy(block bool) (*policy.Policy, error) {
+	p, err := policy.Load(homeDir)
+	if err != nil {
+		return nil, err
+	}
+	if block {
+		if p == nil {
+			p = policy.Default()
+		}
+		p.Mode = policy.ModeBlock
+	}
+	return p, nil
+}
+
+// pruneCache keeps the cache within the limits config.toml sets
+func pruneCache() {
+	maxSize, maxAge, _ := cfg.CacheLimits()
+	if maxSize == 0 && maxAge == 0 {
+		return
+	}
+	if removed, freed, err := tool.PruneCache(homeDir, maxSize, maxAge); err != nil {
+		ui.Warn("Failed to prune the cache: %v", err)
+	} else if removed > 0 {
+		slog.Debug("pruned cache", "entries", removed, "bytes", freed)
+	}
+}
+
+// buildPolicyFlag returns the build policy of the --build-policy and
+// --only-binary flags, "" when neither is given
+func buildPolicyFlag(policy string, onlyBinary bool) (tool.BuildPolicy, error) {
+	if onlyBinary {
+		if policy != "" && policy != string(tool.BuildOnlyBinary) {
+			return "", fmt.Errorf("--only-binary conflicts with --build-policy %s", policy)
+		}
+		return tool.BuildOnlyBinary, nil
+	}
+	if policy == "" {
+		return "", nil
+	}
+	return tool.ParseBuildPolicy(policy)
+}
+
 func runCmd() *cobra.Command {
 	var background bool
 	var autoRestart bool
+	var egressProxy string
+	var egressCA string
+	var egressAllow []string
+	var egressWarnOnly bool
+	var sockets []string
+	var logConfig supervisor.LogConfig
+	var timeout time.Duration
+	var maxMemory string
+	var nice int
+	var noSandbox bool
+	var batchFile string
+	var parallel int
 
 	cmd := &cobra.Command{
 		Use:   "run <tool> [args...]",
 		Short: "Run a tool explicitly",
-		Args:  cobra.MinimumNArgs(1),
+		Long: `Run an installed tool.
+
+Foreground runs can be bounded: --timeout stops the tool (SIGTERM, then
+SIGKILL 5s later) once it runs too long, --max-memory caps its address space
+(Linux only; allocations past the cap fail) and --nice lowers its scheduling
+priority.
+
+With --socket (background runs), ophid listens on the address itself and
+passes the socket to the tool as LISTEN_FDS, systemd socket activation
+style (e.g. gunicorn, uvicorn --fd 3). The socket stays open while the tool
+restarts, so the proxy in front of it never sees a refused connection.
+
+With -f, the tool runs once per line of a targets file (blank lines and #
+comments skipped), --parallel at a time. "{}" in the arguments is replaced
+by the line, otherwise the line is appended. Output lines are prefixed with
+"[line] " and a summary follows; the run fails if any item failed.
+
+Examples:
+  ophid run ansible-playbook site.yml
+  ophid run --timeout 30m --max-memory 2G --nice 10 ansible-playbook site.yml
+  ophid run -b --auto-restart --socket 127.0.0.1:8000 gunicorn app:wsgi
+  ophid run -f hosts.txt --parallel 8 ansible-playbook site.yml --limit {}
+  ophid run -f configs.txt yamllint`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmdObj *cobra.Command, args []string) error {
 			toolName := args[0]
 			toolArgs := args[1:]
 
-			// Get Python runtime
-			runtimeMgr := runtime.NewManager(homeDir)
-			runtimes, err := runtimeMgr.List()
-			if err != nil || len(runtimes) == 0 {
-				return fmt.Errorf("no Python runtime installed")
+			limits := supervisor.Limits{Timeout: timeout, Nice: nice}
+			if maxMemory != "" {
+				size, err := supervisor.ParseMemory(maxMemory)
+				if err != nil {
+					return err
+				}
+				limits.MaxMemory = size
+			}
+			if background && limits != (supervisor.Limits{}) {
+				return fmt.Errorf("--timeout, --max-memory and --nice only apply to foreground runs")
+			}
+			if background && batchFile != "" {
+				return fmt.Errorf("-f runs a batch in the foreground and can't be combined with --background")
+			}
+			if !background && logConfig != (supervisor.LogConfig{}) {
+				return fmt.Errorf("--log-* flags only apply to background runs")
+			}
+			if !background && len(egressAllow) > 0 {
+				return fmt.Errorf("--egress-allow only applies to background runs; use ophid proxy egress --allow with --egress-proxy instead")
+			}
+			if !background && len(sockets) > 0 {
+				return fmt.Errorf("--socket only applies to background runs")
 			}
-
-			pythonPath := filepath.Join(runtimes[0].Path, "bin", "python3")
-			venvMgr := tool.NewVenvManager(homeDir, pythonPath)
 
 			// Create installer to get tool info
+			venvMgr := tool.NewVenvManager(homeDir, "")
 			installer, err := tool.NewInstaller(homeDir, venvMgr)
 			if err != nil {
 				return fmt.Errorf("failed to create installer: %w", err)
 			}
 
-			// Get tool
-			t, err := installer.Get(toolName)
+			// Get tool, by tool or executable name
+			t, name, err := installer.Resolve(toolName)
+			if err != nil {
+				if strings.Contains(toolName, tool.NamespaceSeparator) {
+					return err
+				}
+				return errcode.Errorf(errcode.NotFound, "tool %s not installed. Run: ophid install %s", toolName, toolName)
+			}
+
+			// Get the runtime the tool was installed with
+			toolRT, err := toolRuntime(runtime.NewManager(homeDir), t)
 			if err != nil {
-				return fmt.Errorf("tool %s not installed. Run: ophid install %s", toolName, toolName)
+				return err
 			}
 
 			// Find executable in venv
 			binDir := venvMgr.GetBinDir(t.InstallPath)
-			executable := filepath.Join(binDir, toolName)
+			executable := filepath.Join(binDir, name)
+
+			command, commandArgs := executable, toolArgs
+			if t.Sandbox != nil && !noSandbox {
+				// The sandbox runs the tool under another PID than LISTEN_PID
+				if len(sockets) > 0 {
+					return fmt.Errorf("--socket can't be combined with the sandbox profile of %s (use --no-sandbox)", toolName)
+				}
+				command, commandArgs, err = sandbox.Wrap(*t.Sandbox, executable, toolArgs, t.InstallPath, toolRT.Path)
+				if err != nil {
+					return fmt.Errorf("failed to sandbox %s: %w (use --no-sandbox to run it unrestricted)", toolName, err)
+				}
+			}
 
 			if background {
-				// Run as supervised process
-				mgr := supervisor.NewManager()
+				// Hand the process to the daemon, so it outlives this command
+				client, err := daemonClient(true)
+				if err != nil {
+					return err
+				}
+				cwd, _ := os.Getwd()
 
 				config := supervisor.ProcessConfig{
 					Name:        toolName,
-					Command:     executable,
-					Args:        toolArgs,
+					Command:     command,
+					Args:        commandArgs,
+					WorkingDir:  cwd,
 					AutoRestart: autoRestart,
 					MaxRetries:  3,
+					EgressProxy: egressProxy,
+					EgressCA:    egressCA,
+
+					EgressAllow:    egressAllow,
+					EgressWarnOnly: egressWarnOnly,
+					Sockets:        sockets,
+					Log:            logConfig,
 				}
 
-				ctx := context.Background()
-				if err := mgr.Start(ctx, config); err != nil {
+				started := time.Now()
+				state, err := client.Start(config)
+				if err != nil {
+					recordRun(tool.RunRecord{Tool: toolName, StartedAt: started, ExitCode: -1, Error: err.Error(), Background: true}, toolArgs)
 					return fmt.Errorf("failed to start process: %w", err)
 				}
+				recordRun(tool.RunRecord{Tool: toolName, StartedAt: started, Background: true}, toolArgs)
 
-				fmt.Printf("Started %s in background (PID: %d)\n", toolName, mgr.List()[toolName].Cmd.Process.Pid)
+				ui.Success("Started %s in background (PID: %d)", toolName, state.PID)
+				ui.Printf("  Logs: ophid logs -f %s\n", toolName)
 				return nil
 			}
 
+			if batchFile != "" {
+				return runBatch(toolName, executable, toolArgs, batchFile, parallel, limits, t, toolRT.Path, noSandbox, supervisor.EgressEnv(egressProxy, egressCA))
+			}
+
 			// Run directly
-			runCmd := exec.Command(executable, toolArgs...)
+			runCmd := exec.Command(command, commandArgs...)
 			runCmd.Stdout = os.Stdout
 			runCmd.Stderr = os.Stderr
 			runCmd.Stdin = os.Stdin
+			if egressProxy != "" || egressCA != "" {
+				runCmd.Env = append(os.Environ(), supervisor.EgressEnv(egressProxy, egressCA)...)
+			}
 
-			return runCmd.Run()
+			started := time.Now()
+			err = supervisor.RunWithLimits(runCmd, limits)
+
+			record := tool.RunRecord{Tool: toolName, StartedAt: started, Duration: time.Since(started)}
+			if err != nil {
+				record.ExitCode = -1
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					record.ExitCode = exitErr.ExitCode()
+				}
+				if record.ExitCode == -1 {
+					record.Error = err.Error()
+				}
+			}
+			recordRun(record, toolArgs)
+
+			var limitErr *supervisor.LimitError
+			switch {
+			case errors.As(err, &limitErr):
+				ui.Error("%s %s, stopped after %s", toolName, limitErr, record.Duration.Round(time.Millisecond))
+			case err != nil && limits.MaxMemory > 0:
+				ui.Warn("%s failed with a memory limit of %s; it may have run out of memory", toolName, maxMemory)
+			}
+
+			return err
 		},
 	}
 
-	cmd.Flags().BoolVarP(&background, "background", "b", false, "Run in background")
+	cmd.Flags().BoolVarP(&background, "background", "b", false, "Run in the background under the ophid daemon, starting it if needed")
 	cmd.Flags().BoolVar(&autoRestart, "auto-restart", false, "Auto-restart on failure (requires --background)")
+	cmd.Flags().StringVar(&egressProxy, "egress-proxy", os.Getenv("OPHID_EGRESS_PROXY"), "Route outbound traffic through this proxy (http:// or socks5://)")
+	cmd.Flags().StringVar(&egressCA, "egress-ca", os.Getenv("OPHID_EGRESS_CA"), "CA bundle to trust when the egress proxy intercepts TLS")
+	cmd.Flags().StringSliceVar(&egressAllow, "egress-allow", nil, "Only let the tool reach these destinations (domains, *.domain or CIDRs; requires --background)")
+	cmd.Flags().BoolVar(&egressWarnOnly, "egress-warn-only", false, "Log destinations outside --egress-allow instead of blocking them")
+	cmd.Flags().StringSliceVar(&sockets, "socket", nil, "Listen on this address and pass the socket to the tool as LISTEN_FDS (host:port or unix:/path; requires --background)")
+	cmd.Flags().StringVar(&logConfig.File, "log-file", "", "Write the tool's output to this file instead of ~/.ophid/supervisor/logs (requires --background)")
+	cmd.Flags().StringVar(&logConfig.Syslog, "log-syslog", "", "Also send output to syslog: journald or udp://host:514 (requires --background)")
+	cmd.Flags().BoolVar(&logConfig.Timestamps, "log-timestamps", false, "Prefix output lines with timestamps")
+	cmd.Flags().BoolVar(&logConfig.Streams, "log-streams", false, "Tag output lines with stdout/stderr")
+	cmd.Flags().BoolVar(&logConfig.JSON, "log-json", false, "Write output lines as JSON objects")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Stop the tool after this long (e.g. 30m)")
+	cmd.Flags().StringVar(&maxMemory, "max-memory", "", "Cap the tool's memory (e.g. 512M, 2G; Linux only)")
+	cmd.Flags().IntVar(&nice, "nice", 0, "Adjust the tool's scheduling priority (1-19 lowers it)")
+	cmd.Flags().BoolVar(&noSandbox, "no-sandbox", false, "Run without the tool's sandbox profile")
+	cmd.Flags().StringVarP(&batchFile, "file", "f", "", "Run once per line of this targets file (- for stdin)")
+	cmd.Flags().IntVar(&parallel, "parallel", 4, "Items run at the same time with -f")
 
 	return cmd
 }
 
-func listCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "list",
-		Short: "List installed tools",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// Get Python runtime (just for venv manager setup)
-			runtimeMgr := runtime.NewManager(homeDir)
-			runtimes, err := runtimeMgr.List()
-			if err != nil || len(runtimes) == 0 {
-				fmt.Println("No Python runtime installed")
-				return nil
+// runBatch runs a tool once per item of a targets file and prints a summary
+func runBatch(toolName, executable string, toolArgs []string, file string, parallel int, limits supervisor.Limits, t *tool.Tool, runtimePath string, noSandbox bool, env []string) error {
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("failed to open targets: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	items, err := supervisor.ReadBatchItems(in)
+	if err != nil {
+		return fmt.Errorf("failed to read targets: %w", err)
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("no targets in %s", file)
+	}
+
+	build := func(item string) (*exec.Cmd, error) {
+		command, args := executable, supervisor.BatchArgs(toolArgs, item)
+		if t.Sandbox != nil && !noSandbox {
+			var err error
+			if command, args, err = sandbox.Wrap(*t.Sandbox, command, args, t.InstallPath, runtimePath); err != nil {
+				return nil, fmt.Errorf("failed to sandbox %s: %w", toolName, err)
 			}
+		}
+		cmd := exec.Command(command, args...)
+		if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		return cmd, nil
+	}
 
-			pythonPath := filepath.Join(runtimes[0].Path, "bin", "python3")
-			venvMgr := tool.NewVenvManager(homeDir, pythonPath)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-			// Create installer
-			installer, err := tool.NewInstaller(homeDir, venvMgr)
-			if err != nil {
-				return fmt.Errorf("failed to create installer: %w", err)
-			}
+	started := time.Now()
+	results := supervisor.RunBatch(ctx, items, parallel, limits, build, os.Stdout, os.Stderr)
 
-			// List tools
-			tools := installer.List()
-			if len(tools) == 0 {
-				fmt.Println("No tools installed")
-				return nil
-			}
+	var failed []string
+	for _, r := range results {
+		record := tool.RunRecord{Tool: toolName, StartedAt: started, Duration: r.Duration, ExitCode: r.ExitCode, Error: r.Error}
+		recordRun(record, supervisor.BatchArgs(toolArgs, r.Item))
 
-			fmt.Println("Installed tools:")
-			for _, t := range tools {
-				fmt.Printf("  %s@%s\n", t.Name, t.Version)
-				if len(t.Executables) > 0 {
-					fmt.Printf("    Executables: %s\n", strings.Join(t.Executables, ", "))
-				}
+		if r.Failed() {
+			outcome := fmt.Sprintf("exit %d", r.ExitCode)
+			if r.Error != "" {
+				outcome = r.Error
 			}
-
-			return nil
-		},
+			failed = append(failed, fmt.Sprintf("%s (%s)", r.Item, outcome))
+		}
 	}
-}
 
-func upgradeCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "upgrade <tool>",
-		Short: "Upgrade a tool",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// TODO: Implement
-			fmt.Printf("Upgrading %s...\n", args[0])
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
-			return nil
-		},
+	elapsed := time.Since(started).Round(time.Millisecond)
+	if len(failed) > 0 {
+		ui.Error("%d/%d failed in %s:", len(failed), len(results), elapsed)
+		for _, f := range failed {
+			ui.Printf("  %s\n", f)
+		}
+		return fmt.Errorf("%d of %d targets failed", len(failed), len(results))
 	}
+	ui.Success("%d/%d succeeded in %s", len(results), len(results), elapsed)
+	return nil
 }
 
-func uninstallCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "uninstall <tool>",
-		Short: "Uninstall a tool",
-		Args:  cobra.ExactArgs(1),
+func superviseCmd() *cobra.Command {
+	var vars map[string]string
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "supervise <service.json>...",
+		Short: "Run services from service files until interrupted",
+		Long: `Start the processes described by service files and supervise them
+(restarts, health checks, log routing) until interrupted.
+
+A service file is JSON: {"tool": ..., "vars": {...}, "process": {...}} where
+"process" is a process config, or the same in YAML (.yaml or .yml). Its strings may reference template variables,
+so the same file works on any machine:
+
+  {{venv_bin}}, {{tool_dir}}   paths of the installed tool named by "tool"
+  {{home}}, {{ophid_home}}     the user's home and ~/.ophid
+  {{hostname}}                 this machine's host name
+  {{port}}, {{port.<name>}}    a free local port, the same for every reference
+  {{<var>}}                    "vars" of the file, overridden by --var
+  {{secret:<name>}}            a secret from ophid secret, in "environment" only
+
+A process with "pid_file" adopts the process that file names if it is
+running (e.g. a gunicorn started by another supervisor): ophid health
+checks, stops and restarts it, and starts "command" in its place once it
+exits.
+
+Examples:
+  ophid supervise web.json
+  ophid supervise web.json --var workers=4
+  ophid supervise web.json --dry-run`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			toolName := args[0]
+			var configs []supervisor.ProcessConfig
+			for _, path := range args {
+				config, ports, err := loadService(path, vars)
+				if err != nil {
+					return err
+				}
+				for name, port := range ports {
+					ui.Printf("%s: {{%s}} = %d\n", config.Name, name, port)
+				}
+				configs = append(configs, config)
+			}
 
-			// Get Python runtime
-			runtimeMgr := runtime.NewManager(homeDir)
-			runtimes, err := runtimeMgr.List()
-			if err != nil || len(runtimes) == 0 {
-				return fmt.Errorf("no Python runtime installed")
+			if dryRun {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(configs)
 			}
 
-			pythonPath := filepath.Join(runtimes[0].Path, "bin", "python3")
-			venvMgr := tool.NewVenvManager(homeDir, pythonPath)
+			mgr := supervisor.NewManager()
+			// The proxy reads readiness from here for depends_on routes
+			mgr.SetStateFile(filepath.Join(homeDir, "supervisor", "state.json"))
+			mgr.SetDiagnosticsDir(filepath.Join(homeDir, "diagnostics"))
+			mgr.SetSecrets(secretLookup())
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
 
-			// Create installer
-			installer, err := tool.NewInstaller(homeDir, venvMgr)
-			if err != nil {
-				return fmt.Errorf("failed to create installer: %w", err)
+			for _, config := range configs {
+				if err := mgr.Start(ctx, config); err != nil {
+					mgr.StopAll()
+					return fmt.Errorf("failed to start %s: %w", config.Name, err)
+				}
+				if proc, ok := mgr.Get(config.Name); ok && proc.State().Adopted {
+					ui.OK("adopted %s (PID %d)", config.Name, proc.State().PID)
+					continue
+				}
+				ui.OK("started %s", config.Name)
 			}
 
-			// Uninstall tool
-			if err := installer.Uninstall(toolName); err != nil {
-				return fmt.Errorf("uninstall failed: %w", err)
-			}
+			checker := supervisor.NewHealthChecker(mgr)
+			go checker.StartMonitoring(ctx)
 
-			return nil
+			<-ctx.Done()
+			ui.Println("Stopping services...")
+			return mgr.StopAll()
 		},
 	}
-}
 
-func searchCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "search <query>",
-		Short: "Search for tools",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// TODO: Implement
-			fmt.Printf("Searching for '%s'...\n", args[0])
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
-			return nil
-		},
-	}
+	cmd.Flags().StringToStringVar(&vars, "var", nil, "Set a template variable (repeatable, e.g. --var workers=4)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the expanded process configs instead of starting them")
+
+	return cmd
 }
 
-func infoCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "info <tool>",
-		Short: "Show tool information",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// TODO: Implement
-			fmt.Printf("Tool: %s\n", args[0])
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
-			return nil
-		},
+// daemonClient returns a client of the ophid daemon. With start, it starts
+// the daemon in the background when it isn't running.
+func daemonClient(start bool) (*supervisor.Client, error) {
+	socket := supervisor.SocketPath(homeDir)
+	client := supervisor.NewClient(socket)
+	if !start || client.Ping() == nil {
+		return client, nil
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the ophid executable: %w", err)
+	}
+	if err := supervisor.StartDaemon(executable, socket, filepath.Join(homeDir, "supervisor", "daemon.log")); err != nil {
+		return nil, err
 	}
+	ui.OK("started the ophid daemon")
+	return client, nil
 }
 
-func cacheCmd() *cobra.Command {
+func daemonCmd() *cobra.Command {
+	var detach bool
+
 	cmd := &cobra.Command{
-		Use:   "cache",
-		Short: "Manage package cache",
+		Use:   "daemon",
+		Short: "Run the supervisor daemon that owns background processes",
+		Long: `Run the long-lived supervisor behind 'ophid run --background', 'ophid ps',
+'ophid stop' and 'ophid logs', which talk to it over a Unix socket only
+this user can reach (~/.ophid/supervisor/daemon.sock).
+
+It runs in the foreground, for systemd or launchd, until interrupted or
+'ophid daemon stop'; --detach starts it in the background instead. 'ophid
+run --background' starts it when it isn't running. Stopping the daemon
+stops its processes.
+
+Processes write their output to ~/.ophid/supervisor/logs/<name>.log unless
+started with --log-file, and get the daemon's environment. Their state is
+kept in ~/.ophid/supervisor/state.json for 'ophid status' and the proxy.
+
+Examples:
+  ophid daemon --detach
+  ophid daemon stop`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true, // Daemon errors are not usage errors
+		RunE: func(cmd *cobra.Command, args []string) error {
+			socket := supervisor.SocketPath(homeDir)
+			if detach {
+				if supervisor.NewClient(socket).Ping() == nil {
+					return errcode.Errorf(errcode.Conflict, "the ophid daemon is already running")
+				}
+				if _, err := daemonClient(true); err != nil {
+					return err
+				}
+				return nil
+			}
+
+			mgr := supervisor.NewManager()
+			mgr.SetStateFile(filepath.Join(homeDir, "supervisor", "state.json"))
+			mgr.SetDiagnosticsDir(filepath.Join(homeDir, "diagnostics"))
+			mgr.SetSecrets(secretLookup())
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			slog.Info("ophid daemon listening", "socket", socket, "pid", os.Getpid())
+			if err := supervisor.NewDaemon(mgr, socket, supervisor.LogDir(homeDir)).Serve(ctx); err != nil {
+				return err
+			}
+			slog.Info("ophid daemon stopped")
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&detach, "detach", "d", false, "Start the daemon in the background and return")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "stop",
+		Short: "Stop the daemon and its processes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, _ := daemonClient(false)
+			if err := client.Shutdown(); err != nil {
+				return err
+			}
+			ui.Success("The ophid daemon is shutting down")
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+func psCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:          "ps",
+		Short:        "List the processes of the ophid daemon",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true, // Daemon errors are not usage errors
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, _ := daemonClient(false)
+			states, err := client.List()
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(states)
+			}
+			if len(states) == 0 {
+				ui.Println("No processes. Start one with: ophid run --background <tool>")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSTATUS\tPID\tUPTIME\tRESTARTS\tREADY")
+			for _, s := range states {
+				pid, uptime := "-", "-"
+				if s.Running() && s.PID > 0 {
+					pid = strconv.Itoa(s.PID)
+					uptime = time.Since(s.StartTime).Round(time.Second).String()
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%t\n", s.Name, s.Status, pid, uptime, s.RestartCount, s.Ready)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the processes as JSON")
+
+	return cmd
+}
+
+func stopCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "stop <name>",
+		Short:        "Stop a process of the ophid daemon",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true, // Daemon errors are not usage errors
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, _ := daemonClient(false)
+			if err := client.Stop(args[0]); err != nil {
+				return err
+			}
+			ui.Success("Stopped %s", args[0])
+			return nil
+		},
+	}
+}
+
+func logsCmd() *cobra.Command {
+	var lines int
+	var follow bool
+
+	cmd := &cobra.Command{
+		Use:   "logs <name>",
+		Short: "Show the output of a process of the ophid daemon",
+		Long: `Show the last lines of a background process's output; with -f, keep
+printing new output until interrupted.
+
+Examples:
+  ophid logs gunicorn
+  ophid logs -f -n 20 gunicorn`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true, // Daemon errors are not usage errors
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if lines < 0 {
+				return fmt.Errorf("--lines must be 0 (all) or more")
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			client, _ := daemonClient(false)
+			return client.Logs(ctx, args[0], lines, follow, os.Stdout)
+		},
+	}
+	cmd.Flags().IntVarP(&lines, "lines", "n", 100, "Lines to show (0 for all)")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing new output")
+
+	return cmd
+}
+
+func jobsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "Run one-shot jobs and show their results",
+		Long: `Run one-shot jobs such as playbook runs or backup scripts. A job succeeds
+when it exits 0 (or with one of --success-codes); failed runs are retried
+with backoff. Results and logs are kept under ~/.ophid/jobs.
+
+Examples:
+  ophid jobs run nightly-backup --retries 3 --retry-delay 1m -- /usr/local/bin/backup.sh
+  ophid jobs run site --timeout 2h -- ansible-playbook site.yml
+  ophid jobs list`,
+	}
+
+	var config supervisor.JobConfig
+	var timestamps bool
+
+	runJobCmd := &cobra.Command{
+		Use:          "run <name> -- <command> [args...]",
+		Short:        "Run a job",
+		Args:         cobra.MinimumNArgs(2),
+		SilenceUsage: true, // A failed job is not a usage error
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store := supervisor.NewJobStore(homeDir)
+
+			config.Name = args[0]
+			config.Command, config.Args = args[1], args[2:]
+			config.Log = supervisor.LogConfig{File: store.LogPath(config.Name), Console: true, Timestamps: timestamps}
+
+			// Installed tools run from their virtual environment
+			if !strings.ContainsRune(config.Command, filepath.Separator) {
+				if installer, venvMgr, err := openInstaller(); err == nil {
+					if t, err := installer.Get(config.Command); err == nil {
+						config.Command = filepath.Join(venvMgr.GetBinDir(t.InstallPath), config.Command)
+					}
+				}
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			result := supervisor.RunJob(ctx, config)
+			if err := store.Record(result); err != nil {
+				ui.Warn("failed to record job result: %v", err)
+			}
+
+			if result.Status != supervisor.JobSucceeded {
+				return fmt.Errorf("job %s failed after %d attempt(s): %s (log: %s)", result.Name, result.Attempts, jobOutcome(result), result.LogPath)
+			}
+			ui.Success("job %s succeeded in %s (log: %s)", result.Name, result.Duration.Round(time.Millisecond), result.LogPath)
+			return nil
+		},
+	}
+	runJobCmd.Flags().IntVar(&config.Retries, "retries", 0, "Retries after a failed run")
+	runJobCmd.Flags().DurationVar(&config.RetryDelay, "retry-delay", 10*time.Second, "First retry delay, doubled per retry")
+	runJobCmd.Flags().DurationVar(&config.MaxRetryDelay, "max-retry-delay", 10*time.Minute, "Retry delay cap")
+	runJobCmd.Flags().DurationVar(&config.Timeout, "timeout", 0, "Stop a run after this long")
+	runJobCmd.Flags().IntSliceVar(&config.SuccessCodes, "success-codes", nil, "Exit codes that count as success (default 0)")
+	runJobCmd.Flags().IntSliceVar(&config.RetryCodes, "retry-codes", nil, "Only retry these exit codes (default: any failure)")
+	runJobCmd.Flags().BoolVar(&timestamps, "timestamps", false, "Prefix output lines with timestamps")
+
+	var all bool
+	var jsonOutput bool
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Show the last result of each job",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results, err := supervisor.NewJobStore(homeDir).List(!all)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				if results == nil {
+					results = []supervisor.JobResult{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(results)
+			}
+
+			if len(results) == 0 {
+				fmt.Println("No jobs have run")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "JOB\tSTATUS\tSTARTED\tDURATION\tATTEMPTS\tRESULT\tLOG")
+			for _, r := range results {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", r.Name, r.Status, r.StartedAt.Local().Format("2006-01-02 15:04:05"),
+					r.Duration.Round(time.Millisecond), r.Attempts, jobOutcome(r), r.LogPath)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+	listCmd.Flags().BoolVar(&all, "all", false, "Show every run, not just the last of each job")
+	listCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+
+	cmd.AddCommand(runJobCmd, listCmd)
+	return cmd
+}
+
+// jobOutcome describes how the last attempt of a job ended
+func jobOutcome(r supervisor.JobResult) string {
+	if r.Error != "" {
+		return r.Error
+	}
+	return fmt.Sprintf("exit %d", r.ExitCode)
+}
+
+// loadService reads a service file and expands its templates. Variables
+// come from ophid (paths, host name), then the file, then overrides.
+func loadService(path string, overrides map[string]string) (supervisor.ProcessConfig, map[string]int, error) {
+	service, err := supervisor.LoadServiceFile(path)
+	if err != nil {
+		return supervisor.ProcessConfig{}, nil, err
+	}
+
+	vars := map[string]string{
+		"home":       filepath.Dir(homeDir),
+		"ophid_home": homeDir,
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		vars["hostname"] = hostname
+	}
+
+	if service.Tool != "" {
+		installer, venvMgr, err := openInstaller()
+		if err != nil {
+			return supervisor.ProcessConfig{}, nil, err
+		}
+		t, err := installer.Get(service.Tool)
+		if err != nil {
+			return supervisor.ProcessConfig{}, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		vars["tool_dir"] = t.InstallPath
+		vars["venv_bin"] = venvMgr.GetBinDir(t.InstallPath)
+	}
+
+	for k, v := range service.Vars {
+		vars[k] = v
+	}
+	for k, v := range overrides {
+		vars[k] = v
+	}
+
+	tmpl := supervisor.NewTemplate(vars)
+	config, err := tmpl.ExpandConfig(service.Process)
+	if err != nil {
+		return supervisor.ProcessConfig{}, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, tmpl.Ports(), nil
+}
+
+// recordRun adds a tool run to the local run history. Failing to record
+// does not fail the run.
+func recordRun(record tool.RunRecord, args []string) {
+	record.ArgsHash = tool.HashArgs(args)
+	record.NumArgs = len(args)
+	if u, err := user.Current(); err == nil {
+		record.User = u.Username
+	}
+
+	if err := tool.NewHistory(homeDir).Record(record); err != nil {
+		ui.Warn("failed to record run history: %v", err)
+	}
+}
+
+func historyCmd() *cobra.Command {
+	var limit int
+	var failedOnly bool
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "history [tool]",
+		Short: "Show past tool runs",
+		Long: `Show past 'ophid run' invocations, newest first: when, by whom, how long
+and how they ended. Arguments are not stored, only a hash, so runs with the
+same arguments can be matched without leaking secrets passed on the command
+line.
+
+Examples:
+  ophid history
+  ophid history ansible-playbook --failed
+  ophid history --json --limit 100`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			toolName := ""
+			if len(args) == 1 {
+				toolName = args[0]
+			}
+
+			records, err := tool.NewHistory(homeDir).List(toolName, 0)
+			if err != nil {
+				return err
+			}
+
+			var shown []tool.RunRecord
+			for _, r := range records {
+				if failedOnly && !r.Failed() {
+					continue
+				}
+				shown = append(shown, r)
+				if limit > 0 && len(shown) == limit {
+					break
+				}
+			}
+
+			if jsonOutput {
+				if shown == nil {
+					shown = []tool.RunRecord{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(shown)
+			}
+
+			if len(shown) == 0 {
+				fmt.Println("No runs recorded")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "STARTED\tTOOL\tUSER\tDURATION\tRESULT\tARGS")
+			for _, r := range shown {
+				duration, result := r.Duration.Round(time.Millisecond).String(), fmt.Sprintf("exit %d", r.ExitCode)
+				switch {
+				case r.Error != "":
+					result = r.Error
+				case r.Background:
+					duration, result = "-", "background"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d (%s)\n", r.StartedAt.Local().Format("2006-01-02 15:04:05"),
+					r.Tool, orDefault(r.User, "-"), duration, result, r.NumArgs, r.ArgsHash)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of runs to show (0 for all)")
+	cmd.Flags().BoolVar(&failedOnly, "failed", false, "Only show failed runs")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+
+	return cmd
+}
+
+func eventsCmd() *cobra.Command {
+	var limit int
+	var follow bool
+	var types []string
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show what ophid did, and follow it as it happens",
+		Long: fmt.Sprintf(`Show the newest events of ~/.ophid/events/events.jsonl, oldest first:
+installs, packages found vulnerable, status changes of supervised processes
+and proxy backends, and certificate renewals. The CLI, the daemon and the
+proxy all record theirs, and the log keeps the newest events. --follow keeps
+printing new events until interrupted; with --json each is a line of JSON,
+for scripts reacting to ophid.
+
+[[events.webhooks]] in config.toml also posts events (POST, JSON) to a URL,
+optionally only those of some types:
+  [[events.webhooks]]
+  url = "https://hooks.example.com/ophid"
+  types = ["install.*", "route.health"]
+
+Event types: %s`, joinTypes(events.Types)),
+		Example: `  ophid events
+  ophid events --follow --type 'install.*'
+  ophid events -f --json | jq .`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			enc := json.NewEncoder(os.Stdout)
+			show := func(e events.Event) {
+				if !e.Matches(types) {
+					return
+				}
+				if jsonOutput {
+					enc.Encode(e)
+					return
+				}
+				fmt.Printf("%s  %-16s  %s  %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Type, e.Subject, e.Message)
+			}
+
+			eventLog := events.NewLog(homeDir)
+			recorded, err := eventLog.List(0)
+			if err != nil {
+				return err
+			}
+			var shown []events.Event
+			for _, e := range recorded {
+				if e.Matches(types) {
+					shown = append(shown, e)
+				}
+			}
+			if limit > 0 && len(shown) > limit {
+				shown = shown[len(shown)-limit:]
+			}
+			if len(shown) == 0 && !follow && !jsonOutput {
+				fmt.Println("No events recorded")
+				return nil
+			}
+			for _, e := range shown {
+				show(e)
+			}
+			if !follow {
+				return nil
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			return eventLog.Follow(ctx, show)
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of past events to show (0 for all)")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing new events")
+	cmd.Flags().StringSliceVar(&types, "type", nil, "Only show events of these types (patterns like install.*)")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print each event as a line of JSON")
+
+	return cmd
+}
+
+// joinTypes lists event types for help
+func joinTypes(types []events.Type) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
+
+func sandboxCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sandbox",
+		Short: "Manage tool sandbox profiles",
+		Long: `Restrict what a tool can reach when it runs. The profile is stored in the
+tool manifest and applied by 'ophid run' (foreground and background).
+
+Linux uses bubblewrap (bwrap must be installed); macOS uses sandbox-exec.
+
+Examples:
+  ophid sandbox set ansible --no-network
+  ophid sandbox set mytool --home read-only --writable /srv/reports
+  ophid sandbox show ansible
+  ophid sandbox clear ansible`,
+	}
+
+	var noNetwork bool
+	var home string
+	var writable []string
+
+	setCmd := &cobra.Command{
+		Use:   "set <tool>",
+		Short: "Set a tool's sandbox profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
+			installer, _, err := openInstaller()
+			if err != nil {
+				return err
+			}
+
+			profile := &sandbox.Profile{NoNetwork: noNetwork, Home: home}
+			for _, path := range writable {
+				abs, err := filepath.Abs(path)
+				if err != nil {
+					return fmt.Errorf("failed to resolve %s: %w", path, err)
+				}
+				profile.Writable = append(profile.Writable, abs)
+			}
+
+			if err := installer.SetSandbox(args[0], profile); err != nil {
+				return err
+			}
+			ui.Success("%s sandbox: %s", args[0], profile)
+			return nil
+		},
+	}
+	setCmd.Flags().BoolVar(&noNetwork, "no-network", false, "Block network access")
+	setCmd.Flags().StringVar(&home, "home", "", "Home directory access: read-only or hidden")
+	setCmd.Flags().StringSliceVar(&writable, "writable", nil, "Paths that stay writable (repeatable)")
+
+	showCmd := &cobra.Command{
+		Use:   "show <tool>",
+		Short: "Show a tool's sandbox profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			installer, _, err := openInstaller()
+			if err != nil {
+				return err
+			}
+			t, err := installer.Get(args[0])
+			if err != nil {
+				return err
+			}
+
+			profile := sandbox.Profile{}
+			if t.Sandbox != nil {
+				profile = *t.Sandbox
+			}
+			fmt.Printf("%s sandbox: %s\n", t.Name, profile)
+			return nil
+		},
+	}
+
+	clearCmd := &cobra.Command{
+		Use:   "clear <tool>",
+		Short: "Remove a tool's sandbox profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
+			installer, _, err := openInstaller()
+			if err != nil {
+				return err
+			}
+			if err := installer.SetSandbox(args[0], nil); err != nil {
+				return err
+			}
+			ui.Success("%s runs unrestricted", args[0])
+			return nil
+		},
+	}
+
+	cmd.AddCommand(setCmd, showCmd, clearCmd)
+	return cmd
+}
+
+// checkUnlocked refuses a command that changes installed runtimes or tools
+// on a locked host, unless OPHID_OVERRIDE_TOKEN holds the override token
+func checkUnlocked(cmd *cobra.Command, args []string) error {
+	return checkUnlockedIn(homeDir, cmd, args)
+}
+
+// checkUnlockedIn is checkUnlocked against the system lockdown config and
+// that of another ophid home, like a profile about to be removed
+func checkUnlockedIn(home string, cmd *cobra.Command, args []string) error {
+	operation := []string{cmd.CommandPath()}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		operation = append(operation, "--"+f.Name+"="+tool.RedactURL(f.Value.String()))
+	})
+	return checkLockdownIn(home, strings.Join(append(operation, args...), " "))
+}
+
+// checkLockdown checks an operation against the host's lockdown configs
+func checkLockdown(operation string) error {
+	return checkLockdownIn(homeDir, operation)
+}
+
+// checkLockdownIn checks an operation against the system lockdown config
+// and that of an ophid home. Attempts are logged in the current home.
+func checkLockdownIn(home, operation string) error {
+	policy, err := lockdown.Load(homeDir, lockdown.Paths(home)...)
+	if err != nil {
+		return err
+	}
+	return policy.Check(operation, os.Getenv(lockdown.TokenEnv))
+}
+
+// openInstaller opens the tool manifest
+func openInstaller() (*tool.Installer, *tool.VenvManager, error) {
+	runtimeMgr := runtime.NewManager(homeDir)
+	pythonRuntime, err := defaultPython(runtimeMgr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pythonPath := filepath.Join(pythonRuntime.Path, "bin", "python3")
+	venvMgr := tool.NewVenvManager(homeDir, pythonPath)
+	venvMgr.SetPythonLookup(pythonLookup(runtimeMgr))
+	installer, err := tool.NewInstaller(homeDir, venvMgr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create installer: %w", err)
+	}
+	return installer, venvMgr, nil
+}
+
+// defaultPython returns the Python runtime of the configured version, or
+// else the newest Python installed
+func defaultPython(runtimeMgr *runtime.Manager) (*runtime.Runtime, error) {
+	if rt, err := runtimeMgr.FindPython(cfg.Python.Version); err == nil {
+		return rt, nil
+	}
+	rt, err := runtimeMgr.FindPython("")
+	if err != nil {
+		return nil, errcode.Errorf(errcode.NotFound, "no Python runtime installed. Run: ophid runtime install %s", cfg.Python.Version)
+	}
+	return rt, nil
+}
+
+// pythonLookup finds the interpreters of the Python versions tools were
+// installed with
+func pythonLookup(runtimeMgr *runtime.Manager) tool.PythonLookup {
+	return func(version string) (string, error) {
+		rt, err := runtimeMgr.FindPython(version)
+		if err != nil {
+			return "", errcode.Errorf(errcode.NotFound, "Python %s is not installed. Run: ophid runtime install python@%s", version, version)
+		}
+		return filepath.Join(rt.Path, "bin", "python3"), nil
+	}
+}
+
+// toolRuntime returns the runtime a tool runs on: the Python version it
+// was installed with, or for tools that don't record one, the default
+// Python or else the first runtime installed
+func toolRuntime(runtimeMgr *runtime.Manager, t *tool.Tool) (*runtime.Runtime, error) {
+	if version := t.PythonVersion(); version != "" {
+		rt, err := runtimeMgr.FindPython(version)
+		if err != nil {
+			return nil, errcode.Errorf(errcode.NotFound, "%s was installed with Python %s, which is not installed. Run: ophid runtime install python@%s", t.Name, version, version)
+		}
+		return rt, nil
+	}
+	if rt, err := defaultPython(runtimeMgr); err == nil {
+		return rt, nil
+	}
+	runtimes, err := runtimeMgr.List()
+	if err != nil || len(runtimes) == 0 {
+		return nil, errcode.Errorf(errcode.NotFound, "no Python runtime installed")
+	}
+	return runtimes[0], nil
+}
+
+func listCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List installed tools",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Get Python runtime (just for venv manager setup)
+			runtimeMgr := runtime.NewManager(homeDir)
+			runtimes, err := runtimeMgr.List()
+			if err != nil || len(runtimes) == 0 {
+				fmt.Println("No Python runtime installed")
+				return nil
+			}
+
+			pythonPath := filepath.Join(runtimes[0].Path, "bin", "python3")
+			venvMgr := tool.NewVenvManager(homeDir, pythonPath)
+
+			// Create installer
+			installer, err := tool.NewInstaller(homeDir, venvMgr)
+			if err != nil {
+				return fmt.Errorf("failed to create installer: %w", err)
+			}
+
+			// List tools
+			tools := installer.List()
+			if len(tools) == 0 {
+				fmt.Println("No tools installed")
+				return nil
+			}
+
+			fmt.Println("Installed tools:")
+			for _, t := range tools {
+				fmt.Printf("  %s@%s\n", t.Name, t.Version)
+				if len(t.Executables) > 0 {
+					fmt.Printf("    Executables: %s\n", strings.Join(t.Executables, ", "))
+				}
+				if t.Sandbox != nil {
+					fmt.Printf("    Sandbox: %s\n", t.Sandbox)
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func whichCmd() *cobra.Command {
+	var jsonOutput bool
+	var prefer string
+
+	cmd := &cobra.Command{
+		Use:   "which <executable>",
+		Short: "Show which installed tool provides an executable",
+		Long: `Show which installed tool provides an executable, where it lives, and
+whether something earlier in PATH shadows it.
+
+When several tools provide the executable, one runs by the bare name and
+the others as <tool>:<executable>; --prefer picks the one.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			installer, _, err := openInstaller()
+			if err != nil {
+				return err
+			}
+
+			if prefer != "" {
+				if err := installer.SetExecutableOwner(name, prefer); err != nil {
+					return err
+				}
+			}
+
+			providers := installer.Which(name, os.Getenv("PATH"))
+			if len(providers) == 0 {
+				if matches := tool.LookPathAll(name, os.Getenv("PATH")); len(matches) > 0 {
+					return errcode.Errorf(errcode.NotFound, "no installed tool provides %s (PATH has %s)", name, matches[0])
+				}
+				return errcode.Errorf(errcode.NotFound, "no installed tool provides %s", name)
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(providers)
+			}
+
+			for _, p := range providers {
+				fmt.Printf("%s is provided by %s@%s\n", p.Executable, p.Tool, p.Version)
+				fmt.Printf("  Path: %s\n", p.Path)
+				fmt.Printf("  Run:  ophid run %s\n", p.RunAs)
+				switch {
+				case p.Shadowed():
+					fmt.Printf("  %s Shadowed by %s, earlier in PATH\n", ui.Stdout.Tag(ui.LevelWarn), strings.Join(p.ShadowedBy, ", "))
+				case p.OnPath:
+					fmt.Printf("  %s First in PATH\n", ui.Stdout.Tag(ui.LevelOK))
+				case p.Shim != "":
+					fmt.Printf("  Not in PATH; add %s to run it directly\n", filepath.Dir(p.Shim))
+				default:
+					fmt.Printf("  Not in PATH; add %s to run it directly\n", filepath.Dir(p.Path))
+					if p.Resolved != "" {
+						fmt.Printf("  %s %s runs %s instead\n", ui.Stdout.Tag(ui.LevelWarn), p.Executable, p.Resolved)
+					}
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+	cmd.Flags().StringVar(&prefer, "prefer", "", "Make this tool's copy run by the bare name")
+	return cmd
+}
+
+// bundleCmd manages ophid.toml environment files
+func bundleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Manage ophid.toml environment files",
+	}
+
+	var file string
+	var force bool
+	dumpCmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Write installed runtimes and tools to ophid.toml and ophid.lock",
+		Long: `Write the installed runtimes and tools to ophid.toml, pinned to their
+installed versions and sources, and the exact install (git commits,
+platforms, executables) to the matching .lock file. Over existing files,
+their platforms and the resolutions of ophid lock for tools still at the
+same version are kept.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lockFile := bundle.LockPath(file)
+			if !force {
+				for _, path := range []string{file, lockFile} {
+					if _, err := os.Stat(path); err == nil {
+						return errcode.Errorf(errcode.Conflict, "%s already exists (use --force to overwrite)", path)
+					}
+				}
+			}
+
+			runtimes, err := runtime.NewManager(homeDir).List()
+			if err != nil {
+				return fmt.Errorf("failed to list runtimes: %w", err)
+			}
+			installer, err := tool.NewInstaller(homeDir, tool.NewVenvManager(homeDir, ""))
+			if err != nil {
+				return fmt.Errorf("failed to create installer: %w", err)
+			}
+
+			b, lock := bundle.Dump(runtimes, installer.List())
+			// Keep what ophid lock and hand edits added to the files replaced
+			if old, err := bundle.Load(file); err == nil {
+				b.KeepPlatforms(old)
+			}
+			if old, err := bundle.LoadLock(lockFile); err == nil {
+				lock.KeepResolutions(old)
+			}
+			now := time.Now()
+			if err := b.Write(file, now); err != nil {
+				return err
+			}
+			if err := lock.Write(lockFile, now); err != nil {
+				return err
+			}
+
+			ui.Success("Wrote %s and %s (%d runtime(s), %d tool(s))", file, lockFile, len(runtimes), len(lock.Tools))
+			return nil
+		},
+	}
+	dumpCmd.Flags().StringVarP(&file, "file", "f", bundle.DefaultFile, "Bundle file to write; the lock file goes next to it")
+	dumpCmd.Flags().BoolVar(&force, "force", false, "Overwrite existing files")
+
+	var installFile string
+	installCmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install the runtimes and tools of ophid.toml",
+		Long: `Install the runtimes and tools ophid.toml lists that aren't installed as it
+says, pinning git tools to the commits of the matching .lock file when
+there is one, and Python tools to the exact packages ophid lock resolved
+for this platform. Tools already installed at the listed version and source
+are left alone, and tools whose platforms leave this one out are skipped.
+
+With bundle.trusted_keys in the config, the bundle must be signed by one of
+them (ophid bundle sign), and neither it nor its lock changed since;
+otherwise nothing is installed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
+			b, installed, err := installBundle(installFile)
+			if err != nil {
+				return err
+			}
+			ui.Success("%s applied: %d runtime(s), %d tool(s) installed or changed", installFile, len(b.Runtimes), installed)
+			return nil
+		},
+	}
+	installCmd.Flags().StringVarP(&installFile, "file", "f", bundle.DefaultFile, "Bundle file to install; its lock file is read when present")
+
+	var keygenFile, comment string
+	keygenCmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Create a key for signing bundles",
+		Long: `Create an Ed25519 key for signing bundles, and its public key next to it
+with a .pub suffix. Keep the key with whoever releases tool sets; add the
+public key to bundle.trusted_keys in the config of the machines installing
+them.`,
+		Example: `  ophid bundle keygen -o team.key --comment platform-team`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pubFile := keygenFile + ".pub"
+			if !force {
+				for _, path := range []string{keygenFile, pubFile} {
+					if _, err := os.Stat(path); err == nil {
+						return errcode.Errorf(errcode.Conflict, "%s already exists (use --force to overwrite)", path)
+					}
+				}
+			}
+			private, public, err := bundle.GenerateKey(comment)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(keygenFile, private, 0600); err != nil {
+				return fmt.Errorf("failed to write %s: %w", keygenFile, err)
+			}
+			if err := os.WriteFile(pubFile, []byte(public.String()+"\n"), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", pubFile, err)
+			}
+
+			ui.Success("Wrote %s and %s (key %s)", keygenFile, pubFile, public.ID())
+			ui.Println("Trust it where bundles are installed, in config.toml:")
+			ui.Printf("  [bundle]\n  trusted_keys = [%q]\n", public.String())
+			return nil
+		},
+	}
+	keygenCmd.Flags().StringVarP(&keygenFile, "output", "o", "ophid.key", "Key file to write; the public key goes next to it")
+	keygenCmd.Flags().StringVar(&comment, "comment", "", "Who the key is, shown when bundles are verified")
+	keygenCmd.Flags().BoolVar(&force, "force", false, "Overwrite existing files")
+
+	var signFile, keyFile string
+	signCmd := &cobra.Command{
+		Use:   "sign",
+		Short: "Sign ophid.toml and its lock",
+		Long: `Sign ophid.toml and its lock file with a key of ophid bundle keygen,
+writing the signature next to it with a .sig suffix. Ship the three files
+together; ophid bundle install, status --drift --fix, ci and fleet apply
+check the signature on machines that trust the key. Sign again after any
+change to either file.`,
+		Example: `  ophid bundle sign --key team.key
+  ophid bundle sign -f envs/prod.toml --key team.key`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := bundle.Load(signFile); err != nil {
+				return err
+			}
+			if _, err := os.Stat(bundle.LockPath(signFile)); err == nil {
+				if _, err := bundle.LoadLock(bundle.LockPath(signFile)); err != nil {
+					return err
+				}
+			}
+			key, err := bundle.LoadPrivateKey(keyFile)
+			if err != nil {
+				return err
+			}
+			signature, err := bundle.Sign(signFile, key)
+			if err != nil {
+				return err
+			}
+			sigFile := bundle.SignaturePath(signFile)
+			if err := os.WriteFile(sigFile, signature, 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", sigFile, err)
+			}
+			ui.Success("Wrote %s", sigFile)
+			return nil
+		},
+	}
+	signCmd.Flags().StringVarP(&signFile, "file", "f", bundle.DefaultFile, "Bundle file to sign, with its lock file when present")
+	signCmd.Flags().StringVar(&keyFile, "key", "", "Signing key of ophid bundle keygen")
+	signCmd.MarkFlagRequired("key")
+
+	var verifyFile string
+	var verifyKeys []string
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check the signature of ophid.toml and its lock",
+		Long: `Check that ophid.toml and its lock file are signed by a trusted key and
+unchanged since, as ophid bundle install does before installing anything.
+The keys are those of bundle.trusted_keys, or of --key.`,
+		Example: `  ophid bundle verify
+  ophid bundle verify -f envs/prod.toml --key team.key.pub`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries := verifyKeys
+			if len(entries) == 0 {
+				entries = cfg.Bundle.TrustedKeys
+			}
+			if len(entries) == 0 {
+				return errcode.Errorf(errcode.Verification, "no keys to verify %s with: set bundle.trusted_keys or pass --key", verifyFile)
+			}
+			keys, err := bundle.LoadTrustedKeys(entries)
+			if err != nil {
+				return err
+			}
+			key, err := bundle.Verify(verifyFile, keys)
+			if err != nil {
+				return errcode.Errorf(errcode.Verification, "%v", err)
+			}
+			ui.OK("%s signed by %s", verifyFile, keyLabel(key))
+			return nil
+		},
+	}
+	verifyCmd.Flags().StringVarP(&verifyFile, "file", "f", bundle.DefaultFile, "Bundle file to check, with its lock file")
+	verifyCmd.Flags().StringSliceVar(&verifyKeys, "key", nil, "Public key, or file of them, to trust instead of bundle.trusted_keys (repeatable)")
+
+	cmd.AddCommand(dumpCmd, installCmd, keygenCmd, signCmd, verifyCmd)
+	return cmd
+}
+
+// installBundle installs the runtimes and tools of a bundle file that
+// aren't installed as it says, returning the bundle and how many tools it
+// installed or changed
+func installBundle(file string) (*bundle.Bundle, int, error) {
+	if err := verifyBundle(file); err != nil {
+		return nil, 0, err
+	}
+	b, err := bundle.Load(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	var lock *bundle.Lock
+	if _, err := os.Stat(bundle.LockPath(file)); err == nil {
+		if lock, err = bundle.LoadLock(bundle.LockPath(file)); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	runtimeMgr := runtime.NewManager(homeDir)
+	var python *runtime.Runtime
+	for _, spec := range b.Runtimes {
+		rt, err := runtimeMgr.Get(spec)
+		if err != nil {
+			ui.Printf("Installing runtime %s...\n", spec)
+			if rt, err = runtimeMgr.Install(spec); err != nil {
+				return nil, 0, fmt.Errorf("failed to install runtime %s: %w", spec, err)
+			}
+		}
+		if python == nil && rt.Type == runtime.RuntimePython {
+			python = rt
+		}
+	}
+	if python == nil && len(b.Tools) > 0 {
+		runtimes, err := runtimeMgr.List()
+		if err == nil {
+			for _, rt := range runtimes {
+				if rt.Type == runtime.RuntimePython {
+					python = rt
+					break
+				}
+			}
+		}
+		if python == nil {
+			return nil, 0, errcode.Errorf(errcode.NotFound, "no Python runtime installed or listed in %s. Run: ophid runtime install %s", file, cfg.Python.Version)
+		}
+	}
+
+	pythonPath := ""
+	if python != nil {
+		pythonPath = filepath.Join(python.Path, "bin", "python3")
+	}
+	installer, err := tool.NewInstaller(homeDir, tool.NewVenvManager(homeDir, pythonPath))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create installer: %w", err)
+	}
+
+	platform := tool.HostPlatform()
+	installed := 0
+	for _, name := range b.ToolNames() {
+		spec := b.Tools[name]
+		if !spec.OnPlatform(platform) {
+			slog.Debug("skipping tool for other platforms", "tool", name, "platforms", spec.Platforms)
+			continue
+		}
+		current, err := installer.Get(name)
+		if err == nil && spec.Satisfied(current) {
+			continue
+		}
+		opts := spec.InstallOptions(lock.Tool(name))
+		opts.Force = err == nil
+		opts.Python = python.Version
+		if err := applyConfig(&opts, ""); err != nil {
+			return nil, 0, err
+		}
+
+		locked := lock.Tool(name)
+		if resolution := locked.Resolution(platform, bundle.MinorVersion(python.Version)); resolution != nil && (spec.Version == "" || spec.Version == locked.Version) {
+			requirements, err := writeRequirements(resolution.Requirements)
+			if err != nil {
+				return nil, 0, err
+			}
+			defer os.Remove(requirements)
+			opts.Version, opts.Requirements = locked.Version, requirements
+		} else if locked != nil && len(locked.Resolved) > 0 {
+			ui.Warn("%s locks %s for other platforms than %s (Python %s); resolving it afresh. Lock it for this one with: ophid lock --platform %s",
+				bundle.LockPath(file), name, platform, bundle.MinorVersion(python.Version), platform)
+		}
+
+		if _, err := installer.Install(name, opts); err != nil {
+			return nil, 0, fmt.Errorf("failed to install %s: %w", name, err)
+		}
+		installed++
+	}
+
+	return b, installed, nil
+}
+
+// verifyBundle checks a bundle file and its lock against their signature
+// before they're applied, when bundle.trusted_keys are configured: a
+// bundle that is unsigned, signed by another key or changed since is
+// refused
+func verifyBundle(file string) error {
+	if len(cfg.Bundle.TrustedKeys) == 0 {
+		return nil
+	}
+	keys, err := bundle.LoadTrustedKeys(cfg.Bundle.TrustedKeys)
+	if err != nil {
+		return fmt.Errorf("invalid bundle.trusted_keys: %w", err)
+	}
+	if _, err := os.Stat(bundle.SignaturePath(file)); errors.Is(err, os.ErrNotExist) {
+		return errcode.Errorf(errcode.Verification, "%s isn't signed, and bundle.trusted_keys requires it. Sign it with: ophid bundle sign -f %s --key <key>", file, file)
+	}
+	key, err := bundle.Verify(file, keys)
+	if err != nil {
+		return errcode.Errorf(errcode.Verification, "refusing %s: %v", file, err)
+	}
+	ui.Printf("%s signed by %s\n", file, keyLabel(key))
+	return nil
+}
+
+// keyLabel names a public key by its comment and ID
+func keyLabel(key bundle.PublicKey) string {
+	if key.Comment == "" {
+		return "key " + key.ID()
+	}
+	return fmt.Sprintf("%s (key %s)", key.Comment, key.ID())
+}
+
+// writeRequirements writes locked requirements to a temporary
+// requirements.txt for pip
+func writeRequirements(requirements []string) (string, error) {
+	f, err := os.CreateTemp("", "ophid-requirements-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to write requirements: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(strings.Join(requirements, "\n") + "\n"); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write requirements: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// exportCmd writes the whole environment to a portable file
+func exportCmd() *cobra.Command {
+	var output, format string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write every installed runtime and tool to a portable YAML or JSON file",
+		Long: `Write every installed runtime and tool to one portable file, with its exact
+version and source (PyPI, git commit, npm, crates.io, RubyGems, conda,
+profile), the Python version of its venv, its smoke test and build policy,
+and the packages its lockfile records. ophid import installs the file on
+another machine, for provisioning a fleet of workstations alike.
+
+Unlike ophid backup, nothing installed is copied: the file is small and
+installs on other platforms too. The format is YAML unless --format or an
+-o file ending in .json says JSON.
+
+For leaving ophid, or working alongside other tooling, --format also writes
+the Python tools as other installers take them: pipx, a shell script of
+pipx installs with each venv's Python and lockfile pins as constraints;
+requirements, a requirements.txt of the tools and the packages their
+lockfiles pin, for one environment; poetry, a pyproject.toml of a Poetry
+project depending on the tools. Tools of other ecosystems are listed in
+a comment instead.
+
+Examples:
+  ophid export -o workstation.yaml
+  ophid export --format json > workstation.json
+  ophid export --format pipx -o install-tools.sh
+  ophid export --format requirements -o requirements.txt
+  ophid export --format poetry -o pyproject.toml`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format == "" {
+				format = bundle.ExportFormat(output)
+			}
+
+			runtimes, err := runtime.NewManager(homeDir).List()
+			if err != nil {
+				return fmt.Errorf("failed to list runtimes: %w", err)
+			}
+			installer, err := tool.NewInstaller(homeDir, tool.NewVenvManager(homeDir, ""))
+			if err != nil {
+				return fmt.Errorf("failed to create installer: %w", err)
+			}
+			tools := installer.List()
+			locks := make(map[string]*tool.ToolLock)
+			for _, t := range tools {
+				if lock, err := tool.ReadToolLock(installer.LockPath(t.Name)); err == nil {
+					locks[t.Name] = lock
+				}
+			}
+
+			ex := bundle.NewExport(runtimes, tools, locks, tool.HostPlatform(), time.Now())
+			data, err := ex.Encode(format)
+			if err != nil {
+				return err
+			}
+			if output == "" || output == "-" {
+				_, err := os.Stdout.Write(data)
+				return err
+			}
+			mode := os.FileMode(0644)
+			if format == bundle.FormatPipx {
+				mode = 0755
+			}
+			if err := os.WriteFile(output, data, mode); err != nil {
+				return fmt.Errorf("failed to write %s: %w", output, err)
+			}
+			ui.Success("Wrote %s (%d runtime(s), %d tool(s))", output, len(ex.Runtimes), len(ex.Tools))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write (default: stdout)")
+	cmd.Flags().StringVar(&format, "format", "", "yaml, json, pipx, requirements or poetry (default: by the -o extension, else yaml)")
+	return cmd
+}
+
+// importCmd installs the environment of an ophid export file
+func importCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Install the runtimes and tools of an ophid export file",
+		Long: `Install the runtimes and tools an ophid export file lists, each at its
+exported version and from its exported source. Tools already installed as
+exported are left alone. Python tools exported on this platform install
+exactly the packages their venv had; on another platform they are resolved
+afresh. Local tools whose directory isn't on this machine are skipped.
+
+Examples:
+  ophid export -o workstation.yaml        # On the reference machine
+  ophid import workstation.yaml           # On each new one`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
+			ex, err := bundle.LoadExport(args[0])
+			if err != nil {
+				return err
+			}
+
+			runtimeMgr := runtime.NewManager(homeDir)
+			for _, rt := range ex.Runtimes {
+				if _, err := runtimeMgr.Get(rt.Spec()); err == nil {
+					continue
+				}
+				ui.Printf("Installing runtime %s...\n", rt.Spec())
+				if _, err := runtimeMgr.Install(rt.Spec()); err != nil {
+					return fmt.Errorf("failed to install runtime %s: %w", rt.Spec(), err)
+				}
+			}
+
+			// Python tools are built with the Python they were exported
+			// with; the default one only matters to those exported without
+			pythonPath := ""
+			if python, err := defaultPython(runtimeMgr); err == nil {
+				pythonPath = filepath.Join(python.Path, "bin", "python3")
+			}
+			venvMgr := tool.NewVenvManager(homeDir, pythonPath)
+			venvMgr.SetPythonLookup(pythonLookup(runtimeMgr))
+			installer, err := tool.NewInstaller(homeDir, venvMgr)
+			if err != nil {
+				return fmt.Errorf("failed to create installer: %w", err)
+			}
+			platform := tool.HostPlatform()
+			installed, skipped := 0, 0
+			for _, t := range ex.Tools {
+				current, err := installer.Get(t.Name)
+				if err == nil && t.Satisfied(current) {
+					continue
+				}
+				if t.Source == string(tool.SourceLocal) {
+					if _, statErr := os.Stat(t.Path); statErr != nil {
+						ui.Warn("Skipping %s: its local source %s isn't on this machine", t.Name, t.Path)
+						skipped++
+						continue
+					}
+				}
+
+				opts := t.InstallOptions()
+				opts.Force = err == nil
+				if err := applyConfig(&opts, ""); err != nil {
+					return err
+				}
+				if t.Python != "" {
+					python, err := runtimeMgr.EnsureRuntime(t.Python)
+					if err != nil {
+						return fmt.Errorf("failed to get Python %s for %s: %w", t.Python, t.Name, err)
+					}
+					opts.Python = python.Version
+				}
+				if len(t.Packages) > 0 && opts.Source.Type == tool.SourcePyPI {
+					if ex.Platform == platform {
+						requirements, err := writeRequirements(t.Packages)
+						if err != nil {
+							return err
+						}
+						defer os.Remove(requirements)
+						opts.Requirements = requirements
+					} else {
+						ui.Printf("%s was exported on %s; resolving its packages for %s\n", t.Name, ex.Platform, platform)
+					}
+				}
+
+				if _, err := installer.Install(t.Name, opts); err != nil {
+					return fmt.Errorf("failed to install %s: %w", t.Name, err)
+				}
+				installed++
+			}
+			pruneCache()
+
+			ui.Success("%s imported: %d runtime(s), %d tool(s) installed or changed", args[0], len(ex.Runtimes), installed)
+			if skipped > 0 {
+				ui.Warn("%d tool(s) skipped", skipped)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+// adoptCmd takes over tools pipx, pyenv-virtualenv or plain virtualenvs
+// installed
+func adoptCmd() *cobra.Command {
+	var name string
+	var reinstall, dryRun, force, skipScan bool
+
+	cmd := &cobra.Command{
+		Use:   "adopt [tool|venv...]",
+		Short: "Take over Python tools installed with pipx, pyenv-virtualenv or virtualenv",
+		Long: `Add Python tools installed by other managers to ophid, so migrating
+doesn't mean reinstalling everything by hand. Without arguments, adopt
+every tool pipx installed (PIPX_HOME, ~/.local/share/pipx or ~/.local/pipx)
+and every pyenv-virtualenv named after a package in it (PYENV_ROOT or
+~/.pyenv). Tool names pick some of them; paths of venvs adopt standalone
+virtualenvs, as the package named like the venv directory or --name.
+
+Adopted tools run from the venv they are in, which ophid leaves behind on
+uninstall. With --reinstall they are installed afresh into venvs ophid
+manages instead, at the same version and with the same packages, and the
+old venv can then be removed with the manager that made it.
+
+Adopted tools are scanned and checked against the security policy like
+installs.`,
+		Example: `  ophid adopt --dry-run                  # What would be adopted
+  ophid adopt                            # Every pipx and pyenv tool
+  ophid adopt black httpie --reinstall   # Some of them, into ophid venvs
+  ophid adopt ~/venvs/ansible            # A standalone virtualenv`,
+		SilenceUsage: true, // Adoption failures aren't usage errors
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
+			found, err := adoptables(args, name)
+			if err != nil {
+				return err
+			}
+			if len(found) == 0 {
+				ui.Println("No tools to adopt")
+				return nil
+			}
+			if dryRun {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "TOOL\tVERSION\tFROM\tVENV\tEXECUTABLES")
+				for _, a := range found {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", a.Name, a.Version, a.Manager, a.Venv, strings.Join(a.Executables, ", "))
+				}
+				return w.Flush()
+			}
+
+			runtimeMgr := runtime.NewManager(homeDir)
+			pythonPath := ""
+			if python, err := defaultPython(runtimeMgr); err == nil {
+				pythonPath = filepath.Join(python.Path, "bin", "python3")
+			}
+			venvMgr := tool.NewVenvManager(homeDir, pythonPath)
+			venvMgr.SetPythonLookup(pythonLookup(runtimeMgr))
+			installer, err := tool.NewInstaller(homeDir, venvMgr)
+			if err != nil {
+				return fmt.Errorf("failed to create installer: %w", err)
+			}
+
+			adopted := 0
+			for _, a := range found {
+				opts := tool.InstallOptions{Force: force}
+				scanPolicy := ""
+				if skipScan {
+					scanPolicy = config.ScanSkip
+				}
+				if err := applyConfig(&opts, scanPolicy); err != nil {
+					return err
+				}
+				if reinstall {
+					err = reinstallAdoptable(installer, runtimeMgr, a, opts)
+				} else {
+					_, err = installer.Adopt(a, opts)
+				}
+				if err != nil {
+					ui.Warn("Skipping %s: %v", a.Name, err)
+					continue
+				}
+				adopted++
+			}
+			if reinstall {
+				pruneCache()
+			}
+
+			ui.Success("%d of %d tool(s) adopted", adopted, len(found))
+			if adopted < len(found) {
+				return fmt.Errorf("%d tool(s) couldn't be adopted", len(found)-adopted)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Package of a single venv given by path (default: its directory name)")
+	cmd.Flags().BoolVar(&reinstall, "reinstall", false, "Reinstall into venvs ophid manages instead of running from the old ones")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the tools that would be adopted")
+	cmd.Flags().BoolVar(&force, "force", false, "Adopt tools ophid already has, replacing them")
+	cmd.Flags().BoolVar(&skipScan, "skip-scan", false, "Don't scan the adopted tools for vulnerabilities")
+	return cmd
+}
+
+// adoptables returns the tools ophid adopt takes over: the venvs among
+// args, else what pipx and pyenv installed, narrowed to the tools args name
+func adoptables(args []string, name string) ([]tool.Adoptable, error) {
+	var venvs, names []string
+	for _, arg := range args {
+		if _, err := os.Stat(filepath.Join(arg, "pyvenv.cfg")); err == nil {
+			venvs = append(venvs, arg)
+		} else {
+			names = append(names, arg)
+		}
+	}
+	if name != "" && (len(venvs) != 1 || len(names) > 0) {
+		return nil, fmt.Errorf("--name needs exactly one venv path")
+	}
+
+	var found []tool.Adoptable
+	for _, venv := range venvs {
+		abs, err := filepath.Abs(venv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid venv path: %w", err)
+		}
+		pkg := name
+		if pkg == "" {
+			pkg = filepath.Base(abs)
+		}
+		a, err := tool.InspectVenv(abs, pkg)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, a)
+	}
+	if len(venvs) > 0 && len(names) == 0 {
+		return found, nil
+	}
+
+	pipx, err := tool.DiscoverPipx(tool.PipxHome())
+	if err != nil {
+		return nil, err
+	}
+	pyenv, err := tool.DiscoverPyenv(tool.PyenvRoot())
+	if err != nil {
+		return nil, err
+	}
+	discovered := append(pipx, pyenv...)
+	tool.SortAdoptables(discovered)
+	seen := make(map[string]bool)
+	for _, a := range discovered {
+		if seen[a.Name] {
+			ui.Warn("%s is in %s too; adopt that venv by path to take it instead", a.Name, a.Venv)
+			continue
+		}
+		if len(names) == 0 || slices.Contains(names, a.Name) {
+			seen[a.Name] = true
+			found = append(found, a)
+		}
+	}
+	for _, n := range names {
+		if !seen[n] {
+			return nil, errcode.Errorf(errcode.NotFound, "%s isn't a venv nor a tool pipx or pyenv installed", n)
+		}
+	}
+	return found, nil
+}
+
+// reinstallAdoptable installs an adopted tool into a venv ophid manages,
+// with the Python version and exact packages of its old venv
+func reinstallAdoptable(installer *tool.Installer, runtimeMgr *runtime.Manager, a tool.Adoptable, opts tool.InstallOptions) error {
+	if _, err := installer.Get(a.Name); err == nil && !opts.Force {
+		return errcode.Errorf(errcode.Conflict, "%s is already installed; use --force to replace it", a.Name)
+	}
+	if a.Python != "" {
+		if python, err := runtimeMgr.EnsureRuntime(a.Python); err != nil {
+			ui.Warn("Python %s of %s isn't available (%v); using the default Python", a.Python, a.Name, err)
+		} else {
+			opts.Python = python.Version
+		}
+	}
+	spec := a.Spec
+	if spec == a.Name {
+		opts.Version = a.Version
+		lock, err := installer.Freeze(&tool.Tool{Name: a.Name, InstallPath: a.Venv})
+		if err != nil {
+			ui.Warn("Couldn't read the packages of %s (%v); resolving them afresh", a.Venv, err)
+		} else {
+			requirements, err := writeRequirements(lock.Packages)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(requirements)
+			opts.Requirements = requirements
+		}
+	}
+	if _, err := installer.Install(spec, opts); err != nil {
+		return err
+	}
+	ui.Printf("The old venv of %s is still in %s\n", a.Name, a.Venv)
+	return nil
+}
+
+// sbomCmd writes the SBOM of what an installed tool's venv holds
+func sbomCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "sbom <tool>",
+		Short: "Generate the SBOM of an installed Python tool's venv",
+		Long: `Generate a CycloneDX SBOM of every package installed in a Python tool's
+venv, dependencies of dependencies included, from the metadata pip show
+reads: versions, licenses, and which package requires which. The tool is
+the SBOM's subject; the packages it requires are direct, those they pull
+in transitive.
+
+The SBOM is kept in ~/.ophid/tools/<tool>.sbom.json, recorded in the
+manifest (ophid info shows it), and rewritten whenever the tool is
+upgraded. -o copies it elsewhere too, or to stdout with -o -. Dependency
+files of projects are covered by ophid scan sbom instead.`,
+		Example: `  ophid sbom ansible
+  ophid sbom httpie -o httpie-sbom.json
+  ophid sbom black -o - | jq '.components | length'`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			installer, _, err := openInstaller()
+			if err != nil {
+				return err
+			}
+			sbom, err := installer.GenerateSBOM(args[0])
+			if err != nil {
+				return err
+			}
+
+			switch output {
+			case "":
+			case "-":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(sbom)
+			default:
+				if err := security.WriteSBOM(sbom, output); err != nil {
+					return fmt.Errorf("failed to write SBOM: %w", err)
+				}
+			}
+
+			direct := 0
+			if len(sbom.Dependencies) > 0 {
+				direct = len(sbom.Dependencies[0].DependsOn)
+			}
+			ui.Success("SBOM of %s@%s written to %s", sbom.Metadata.Component.Name, sbom.Metadata.Component.Version, installer.SBOMPath(args[0]))
+			if output != "" {
+				ui.Printf("  Copied to: %s\n", output)
+			}
+			ui.Printf("  Components: %d (%d direct, %d transitive)\n", len(sbom.Components), direct, len(sbom.Components)-direct)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Also write the SBOM to this file, or - for stdout")
+	return cmd
+}
+
+func lockCmd() *cobra.Command {
+	var file string
+	var platforms []string
+
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Resolve the Python tools of ophid.toml for each platform",
+		Long: fmt.Sprintf(`Resolve the exact packages, with their sha256, each PyPI tool of ophid.toml
+installs on this platform and on the ones the bundle's platforms list or
+--platform gives, and record them in the matching .lock file. An
+environment locked on a laptop then installs the same packages on CI
+machines of another os/arch: bundle install uses the resolution for its
+platform and Python version, checking every hash.
+
+Nothing is installed. Other platforms are resolved from wheels only, so a
+package that only publishes source for them can't be locked there. Tools
+keep the version the lock has unless ophid.toml pins another; git, local
+and profile tools are left as they are. The Python version is the one of
+the bundle's python runtime, or of config.toml.
+
+Platforms: %s
+
+Examples:
+  ophid lock
+  ophid lock --platform linux/amd64 --platform linux/arm64`, strings.Join(tool.Platforms(), ", ")),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := bundle.Load(file)
+			if err != nil {
+				return err
+			}
+			lockFile := bundle.LockPath(file)
+			lock := &bundle.Lock{Version: bundle.LockVersion}
+			if _, err := os.Stat(lockFile); err == nil {
+				if lock, err = bundle.LoadLock(lockFile); err != nil {
+					return err
+				}
+			}
+
+			targets := b.LockPlatforms(tool.HostPlatform(), platforms)
+			for _, p := range targets {
+				if err := tool.CheckPlatform(p); err != nil {
+					return err
+				}
+			}
+			pythonVersion := orDefault(b.PythonVersion(), bundle.MinorVersion(cfg.Python.Version))
+
+			python, err := lockPython(pythonVersion)
+			if err != nil {
+				return err
+			}
+			installer, _, err := openInstaller()
+			if err != nil {
+				return err
+			}
+
+			resolved := 0
+			for _, name := range b.ToolNames() {
+				spec := b.Tools[name]
+				if spec.Profile != "" || (spec.Source != "" && spec.Source != string(tool.SourcePyPI)) {
+					continue
+				}
+				locked := lock.Tool(name)
+				version := spec.Version
+				if version == "" && locked != nil {
+					version = locked.Version
+				}
+				requirement := name
+				if version != "" && version != "unknown" {
+					requirement = name + "==" + version
+				}
+				opts := tool.InstallOptions{IndexURL: cfg.Index.URL}
+
+				var entry bundle.LockedTool
+				if locked != nil && (version == "" || locked.Version == version) {
+					entry = *locked
+				} else {
+					entry = bundle.LockedTool{Name: name, Source: string(tool.SourcePyPI)}
+				}
+				for _, platform := range targets {
+					if !spec.OnPlatform(platform) {
+						continue
+					}
+					ui.Printf("Resolving %s for %s (Python %s)...\n", requirement, platform, pythonVersion)
+					r, err := installer.ResolvePlatform(cmd.Context(), python, requirement, platform, pythonVersion, opts)
+					if err != nil {
+						return err
+					}
+					if entry.Version == "" {
+						// The other platforms get the same version
+						entry.Version = r.Version(name)
+						requirement = name + "==" + entry.Version
+					}
+					entry.SetResolution(bundle.LockedResolution{Platform: r.Platform, Python: r.Python, Requirements: r.Requirements})
+					resolved++
+				}
+				lock.Put(entry)
+			}
+
+			if err := lock.Write(lockFile, time.Now()); err != nil {
+				return err
+			}
+			ui.Success("Wrote %s: %d resolution(s) for %s", lockFile, resolved, strings.Join(targets, ", "))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", bundle.DefaultFile, "Bundle file to lock; the lock file goes next to it")
+	cmd.Flags().StringSliceVar(&platforms, "platform", nil, "Also resolve for this os/arch (repeatable)")
+
+	return cmd
+}
+
+// lockPython returns the python ophid lock resolves with: one of the
+// runtime the bundle wants, or any installed Python
+func lockPython(version string) (string, error) {
+	runtimes, err := runtime.NewManager(homeDir).List()
+	if err != nil {
+		return "", fmt.Errorf("failed to list runtimes: %w", err)
+	}
+	var python *runtime.Runtime
+	for _, rt := range runtimes {
+		if rt.Type != runtime.RuntimePython {
+			continue
+		}
+		if python == nil || bundle.MinorVersion(rt.Version) == version {
+			python = rt
+		}
+	}
+	if python == nil {
+		return "", errcode.Errorf(errcode.NotFound, "no Python runtime installed. Run: ophid runtime install %s", cfg.Python.Version)
+	}
+	return filepath.Join(python.Path, "bin", "python3"), nil
+}
+
+func newCmd() *cobra.Command {
+	var port int
+	var noService bool
+
+	cmd := &cobra.Command{
+		Use:   "new <template> <dir>",
+		Short: "Create an ops project from a template",
+		Long: fmt.Sprintf(`Create a ready-to-run ops project: pyproject.toml, requirements.txt,
+an ophid.toml pinned to a Python runtime and, for services, a supervisor
+services.yaml and a proxy.toml route.
+
+Templates:
+  %s
+  user/repo[@ref]                 # A template repository on GitHub
+  https://git.example.com/t.git   # Any git URL (#ref for a branch or tag)
+
+Examples:
+  ophid new script disk-report
+  ophid new web hello-api --port 8100
+  ophid new web hello-api --no-service   # Just the app`, strings.Join(scaffold.Builtin(), ", ")),
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			templateName, dir := args[0], args[1]
+
+			python := cfg.Python.Version
+			runtimes, err := runtime.NewManager(homeDir).List()
+			if err != nil {
+				return fmt.Errorf("failed to list runtimes: %w", err)
+			}
+			for _, rt := range runtimes {
+				if rt.Type == runtime.RuntimePython {
+					python = rt.Version
+					break
+				}
+			}
+
+			name := filepath.Base(filepath.Clean(dir))
+			files, err := scaffold.Create(templateName, dir, scaffold.Options{
+				Vars:      scaffold.Vars{Name: name, Python: python, Port: port},
+				NoService: noService,
+			})
+			if err != nil {
+				return err
+			}
+
+			ui.Success("Created %s from %s (%d files, Python %s)", dir, templateName, len(files), python)
+			ui.Printf("\nNext steps:\n")
+			ui.Printf("  ophid install %s\n", dir)
+			if slices.Contains(files, "services.yaml") {
+				ui.Printf("  ophid supervise %s\n", filepath.Join(dir, "services.yaml"))
+			}
+			if slices.Contains(files, "proxy.toml") {
+				ui.Printf("  ophid proxy start --config %s\n", filepath.Join(dir, "proxy.toml"))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&port, "port", 8000, "Port the service listens on")
+	cmd.Flags().BoolVar(&noService, "no-service", false, "Skip the supervisor service and proxy route")
+
+	return cmd
+}
+
+func serveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run ready-made services behind the proxy",
+	}
+	cmd.AddCommand(serveJupyterCmd())
+	return cmd
+}
+
+func serveJupyterCmd() *cobra.Command {
+	var domain string
+	var token string
+	var notebookDir string
+	var port int
+	var localCA bool
+	var httpListen string
+	var httpsListen string
+
+	cmd := &cobra.Command{
+		Use:   "jupyter",
+		Short: "Serve JupyterLab over HTTPS, supervised",
+		Long: `Install JupyterLab into its own venv (once), run it supervised on a
+local port with an access token, and serve it at --domain through the
+proxy: TLS from Let's Encrypt (or the local CA with --local-ca), WebSockets
+for kernels and terminals, and 503 until JupyterLab passes its health
+check. Prints the access URL and runs until interrupted.
+
+The token is --token, else $JUPYTER_TOKEN, else a new random one.
+
+Examples:
+  ophid serve jupyter --domain lab.example.com
+  ophid serve jupyter --domain lab.localhost --local-ca --notebook-dir ~/notebooks`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			installer, venvMgr, err := openInstaller()
+			if err != nil {
+				return err
+			}
+			t, err := installer.Get("jupyterlab")
+			if err != nil {
+				if err := checkLockdown("serve jupyter install jupyterlab"); err != nil {
+					return err
+				}
+				ui.Println("Installing jupyterlab...")
+				if t, err = installer.Install("jupyterlab", tool.InstallOptions{Version: "latest"}); err != nil {
+					return fmt.Errorf("installation failed: %w", err)
+				}
+			}
+
+			if token == "" {
+				if token, err = newAccessToken(); err != nil {
+					return err
+				}
+			}
+			root, err := filepath.Abs(notebookDir)
+			if err != nil {
+				return fmt.Errorf("failed to resolve notebook dir: %w", err)
+			}
+
+			vars := map[string]string{}
+			if port != 0 {
+				vars["port"] = strconv.Itoa(port)
+			}
+			addr, err := supervisor.NewTemplate(vars).Expand("127.0.0.1:{{port}}")
+			if err != nil {
+				return err
+			}
+
+			origin := "https://" + domain
+			if _, httpsPort, err := net.SplitHostPort(httpsListen); err == nil && httpsPort != "443" {
+				origin += ":" + httpsPort
+			}
+
+			host, jupyterPort, _ := net.SplitHostPort(addr)
+			process := supervisor.ProcessConfig{
+				Name:    "jupyter",
+				Command: filepath.Join(venvMgr.GetBinDir(t.InstallPath), "jupyter-lab"),
+				Args: []string{
+					"--no-browser",
+					"--ip=" + host,
+					"--port=" + jupyterPort,
+					"--ServerApp.root_dir=" + root,
+					"--ServerApp.allow_origin=" + origin, // Kernel WebSockets come from the proxied origin
+					"--ServerApp.trust_xheaders=True",
+				},
+				Environment: map[string]string{"JUPYTER_TOKEN": token},
+				AutoRestart: true,
+				MaxRetries:  5,
+				HealthCheck: supervisor.HealthCheckConfig{
+					Enabled:  true,
+					Type:     "http",
+					Endpoint: "http://" + addr + "/api", // Answers without the token
+					Interval: 10 * time.Second,
+					Timeout:  2 * time.Second,
+					Retries:  3,
+				},
+			}
+
+			acmeProvider := "letsencrypt"
+			if localCA {
+				acmeProvider = "local"
+			}
+			config := &proxy.Config{
+				General: proxy.GeneralConfig{
+					Listen: []string{httpListen, httpsListen},
+				},
+				TLS: proxy.TLSConfig{
+					Enabled:      true,
+					AutoRedirect: true,
+					ACMEProvider: acmeProvider,
+					Domains:      []string{domain},
+					CacheDir:     filepath.Join(homeDir, "certs"),
+					LocalCADir:   filepath.Join(homeDir, "ca"),
+				},
+				Routes: []proxy.Route{
+					{
+						Host:      domain,
+						Target:    "http://" + addr,
+						WebSocket: true,
+						DependsOn: process.Name,
+					},
+				},
+			}
+			server, err := proxy.NewServer(config)
+			if err != nil {
+				return fmt.Errorf("failed to create server: %w", err)
+			}
+
+			mgr := supervisor.NewManager()
+			// The proxy route waits on the health check state written here
+			mgr.SetStateFile(filepath.Join(homeDir, "supervisor", "state.json"))
+			mgr.SetDiagnosticsDir(filepath.Join(homeDir, "diagnostics"))
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			if err := mgr.Start(ctx, process); err != nil {
+				return fmt.Errorf("failed to start jupyter: %w", err)
+			}
+			go supervisor.NewHealthChecker(mgr).StartMonitoring(ctx)
+
+			serverErr := make(chan error, 1)
+			go func() { serverErr <- server.Start() }()
+
+			ui.Success("JupyterLab %s on %s, served at %s", t.Version, addr, origin)
+			fmt.Printf("\n  %s/lab?token=%s\n\n", origin, token)
+
+			select {
+			case <-ctx.Done():
+			case err = <-serverErr:
+				if err != nil {
+					err = fmt.Errorf("proxy error: %w", err)
+				}
+			}
+
+			ui.Println("Stopping...")
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancelShutdown()
+			server.Shutdown(shutdownCtx)
+			if stopErr := mgr.StopAll(); err == nil {
+				err = stopErr
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&domain, "domain", "", "Domain to serve JupyterLab at")
+	cmd.Flags().StringVar(&token, "token", os.Getenv("JUPYTER_TOKEN"), "Access token (default: generated)")
+	cmd.Flags().StringVar(&notebookDir, "notebook-dir", ".", "Directory JupyterLab opens")
+	cmd.Flags().IntVar(&port, "port", 0, "Local port for JupyterLab (default: a free port)")
+	cmd.Flags().BoolVar(&localCA, "local-ca", false, "Use the local development CA instead of Let's Encrypt (e.g., --domain lab.localhost)")
+	cmd.Flags().StringVar(&httpListen, "http-listen", ":80", "HTTP listen address (redirects to HTTPS)")
+	cmd.Flags().StringVar(&httpsListen, "https-listen", ":443", "HTTPS listen address")
+	cmd.MarkFlagRequired("domain")
+
+	return cmd
+}
+
+// newAccessToken returns a random token for services ophid starts
+func newAccessToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func mcpCmd() *cobra.Command {
+	var readOnly bool
+	var allowTools []string
+	var runTimeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Serve ophid to AI assistants over MCP (stdio)",
+		Long: `Run a Model Context Protocol server on stdin and stdout, so AI
+assistants can drive ophid. It exposes these tools:
+
+  scan_vulnerabilities  Check a dependency file or directory against OSV.dev
+  generate_sbom         CycloneDX SBOM of a dependency file
+  list_tools            Installed tools and their executables
+  process_status        Processes of a running ophid supervise
+  install_tool          Install a tool or profile (not with --read-only)
+  run_tool              Run an installed tool and return its output (not with --read-only)
+
+Tools run without a terminal or stdin, under their sandbox profiles, for at
+most --run-timeout; their output is cut to its start and end past 64KB.
+--allow-tool limits install_tool and run_tool to the tools named. Progress
+messages go to stderr, which clients usually log.
+
+Example client configuration:
+  {"mcpServers": {"ophid": {"command": "ophid", "args": ["mcp", "--read-only"]}}}`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Only protocol messages may reach stdout: send what installers,
+			// pip and the logger print there to stderr
+			protocolOut := os.Stdout
+			os.Stdout = os.Stderr
+			ui.Configure(ui.Options{})
+			slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+			server := mcp.NewServer("ophid", version)
+			for _, t := range mcpTools(readOnly, allowTools, runTimeout) {
+				server.AddTool(t)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			return server.Serve(ctx, os.Stdin, protocolOut)
+		},
+	}
+
+	cmd.Flags().BoolVar(&readOnly, "read-only", false, "Only expose tools that don't install or run anything")
+	cmd.Flags().StringSliceVar(&allowTools, "allow-tool", nil, "Only let assistants install and run these tools (repeatable)")
+	cmd.Flags().DurationVar(&runTimeout, "run-timeout", 5*time.Minute, "Stop tools run by assistants after this long")
+
+	return cmd
+}
+
+// mcpTools returns the tools ophid mcp exposes
+func mcpTools(readOnly bool, allowTools []string, runTimeout time.Duration) []mcp.Tool {
+	tools := []mcp.Tool{
+		{
+			Name:        "scan_vulnerabilities",
+			Description: "Check the packages of a dependency file (requirements.txt, go.mod, package.json), or of all such files in a directory, for known vulnerabilities in OSV.dev",
+			InputSchema: mcp.Object(map[string]any{
+				"path": mcp.Property("string", "Dependency file or directory"),
+			}, "path"),
+			ReadOnly: true,
+			Handler:  mcpScanVulnerabilities,
+		},
+		{
+			Name:        "generate_sbom",
+			Description: "Generate a CycloneDX SBOM of the packages of a dependency file (requirements.txt, go.mod, package.json)",
+			InputSchema: mcp.Object(map[string]any{
+				"path": mcp.Property("string", "Dependency file"),
+			}, "path"),
+			ReadOnly: true,
+			Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+				var params struct{ Path string }
+				if err := json.Unmarshal(args, &params); err != nil || params.Path == "" {
+					return nil, fmt.Errorf("path is required")
+				}
+				packages, err := parseDependencyFile(params.Path)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse %s: %w", params.Path, err)
+				}
+				tool.ResolveLicenses(ctx, homeDir, packages)
+				return security.GenerateSBOM(packages, sbomProject(params.Path))
+			},
+		},
+		{
+			Name:        "list_tools",
+			Description: "List the tools ophid installed, with their versions, executables and sandbox profiles",
+			InputSchema: mcp.Object(map[string]any{}),
+			ReadOnly:    true,
+			Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+				installer, _, err := openInstaller()
+				if err != nil {
+					return nil, err
+				}
+				type toolInfo struct {
+					Name        string   `json:"name"`
+					Version     string   `json:"version"`
+					Source      string   `json:"source"`
+					Executables []string `json:"executables"`
+					Sandbox     string   `json:"sandbox,omitempty"`
+				}
+				tools := []toolInfo{}
+				for _, t := range installer.List() {
+					info := toolInfo{Name: t.Name, Version: t.Version, Source: string(t.Source.Type), Executables: t.Executables}
+					if t.Sandbox != nil {
+						info.Sandbox = t.Sandbox.String()
+					}
+					tools = append(tools, info)
+				}
+				return tools, nil
+			},
+		},
+		{
+			Name:        "process_status",
+			Description: "Show the processes a running `ophid supervise` manages: status, PID, readiness, restarts and last exit",
+			InputSchema: mcp.Object(map[string]any{}),
+			ReadOnly:    true,
+			Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+				states, err := supervisor.LoadState(filepath.Join(homeDir, "supervisor", "state.json"))
+				if errors.Is(err, os.ErrNotExist) {
+					return "No supervised processes (ophid supervise hasn't run)", nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				type processInfo struct {
+					Name         string    `json:"name"`
+					Status       string    `json:"status"`
+					PID          int       `json:"pid,omitempty"`
+					Ready        bool      `json:"ready"`
+					StartTime    time.Time `json:"start_time"`
+					RestartCount int       `json:"restart_count"`
+					LastExit     string    `json:"last_exit,omitempty"`
+					Diagnostics  string    `json:"diagnostics,omitempty"`
+				}
+				processes := []processInfo{}
+				for _, s := range states {
+					processes = append(processes, processInfo{
+						Name: s.Name, Status: string(s.Status), PID: s.PID, Ready: s.Ready, StartTime: s.StartTime,
+						RestartCount: s.RestartCount, LastExit: s.LastExit, Diagnostics: s.Diagnostics,
+					})
+				}
+				return processes, nil
+			},
+		},
+	}
+	if readOnly {
+		return tools
+	}
+
+	allowed := func(name string) error {
+		if len(allowTools) > 0 && !slices.Contains(allowTools, name) {
+			return errcode.Errorf(errcode.PolicyBlocked, "%s isn't allowed (ophid mcp --allow-tool %s)", name, strings.Join(allowTools, ","))
+		}
+		return nil
+	}
+	var installMu sync.Mutex // Installs write the same manifest
+
+	return append(tools,
+		mcp.Tool{
+			Name:        "install_tool",
+			Description: "Install a Python tool from PyPI into its own venv (security scanned), or a curated cloud CLI profile (aws, azure, gcloud)",
+			InputSchema: mcp.Object(map[string]any{
+				"name":    mcp.Property("string", "PyPI package, or the profile name when profile is true"),
+				"version": mcp.Property("string", "Version to install (default: latest)"),
+				"profile": mcp.Property("boolean", "Install the curated profile called name"),
+			}, "name"),
+			Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+				var params struct {
+					Name    string
+					Version string
+					Profile bool
+				}
+				if err := json.Unmarshal(args, &params); err != nil || params.Name == "" {
+					return nil, fmt.Errorf("name is required")
+				}
+				if err := allowed(params.Name); err != nil {
+					return nil, err
+				}
+				if err := checkLockdown("mcp install_tool " + params.Name); err != nil {
+					return nil, err
+				}
+
+				installMu.Lock()
+				defer installMu.Unlock()
+				installer, _, err := openInstaller()
+				if err != nil {
+					return nil, err
+				}
+				opts := tool.InstallOptions{Version: orDefault(params.Version, "latest")}
+				if params.Profile {
+					opts.Profile = params.Name
+				}
+				t, err := installer.Install(params.Name, opts)
+				if err != nil {
+					return nil, fmt.Errorf("installation failed: %w", err)
+				}
+				return map[string]any{"name": t.Name, "version": t.Version, "executables": t.Executables}, nil
+			},
+		},
+		mcp.Tool{
+			Name:        "run_tool",
+			Description: "Run an installed tool or executable and return its exit code and output. It runs without stdin, under the tool's sandbox profile, with a time limit",
+			InputSchema: mcp.Object(map[string]any{
+				"tool":            mcp.Property("string", "Tool or executable name, or tool:executable"),
+				"args":            mcp.Property("array", "Arguments"),
+				"timeout_seconds": mcp.Property("integer", fmt.Sprintf("Stop it after this long (at most %d)", int(runTimeout.Seconds()))),
+			}, "tool"),
+			Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+				var params struct {
+					Tool           string
+					Args           []string
+					TimeoutSeconds int `json:"timeout_seconds"`
+				}
+				if err := json.Unmarshal(args, &params); err != nil || params.Tool == "" {
+					return nil, fmt.Errorf("tool is required")
+				}
+				return mcpRunTool(ctx, params.Tool, params.Args, time.Duration(params.TimeoutSeconds)*time.Second, runTimeout, allowed)
+			},
+		},
+	)
+}
+
+// mcpScanVulnerabilities scans the dependency files of a path and returns
+// the vulnerable packages
+func mcpScanVulnerabilities(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct{ Path string }
+	if err := json.Unmarshal(args, &params); err != nil || params.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	files, err := dependencyFiles(params.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	type vulnerability struct {
+		ID       string `json:"id"`
+		Summary  string `json:"summary,omitempty"`
+		Severity string `json:"severity,omitempty"`
+	}
+	type finding struct {
+		File            string          `json:"file"`
+		Package         string          `json:"package"`
+		Version         string          `json:"version"`
+		Ecosystem       string          `json:"ecosystem"`
+		Vulnerabilities []vulnerability `json:"vulnerabilities,omitempty"`
+		Error           string          `json:"error,omitempty"`
+	}
+	report := struct {
+		Files           []string  `json:"files"`
+		PackagesScanned int       `json:"packages_scanned"`
+		Vulnerable      int       `json:"vulnerable"`
+		Findings        []finding `json:"findings"` // Vulnerable packages and scan errors
+	}{Files: files, Findings: []finding{}}
+
+	scanner := security.NewScanner()
+	for _, file := range files {
+		packages, err := parseDependencyFile(file)
+		if err != nil {
+			report.Findings = append(report.Findings, finding{File: file, Error: err.Error()})
+			continue
+		}
+		results, err := scanner.ScanPackages(ctx, packages)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed for %s: %w", file, err)
+		}
+		report.PackagesScanned += len(packages)
+
+		for _, r := range results {
+			if r.Error == "" && !r.HasVulnerabilities() {
+				continue
+			}
+			f := finding{File: file, Package: r.Package.Name, Version: r.Package.Version, Ecosystem: r.Package.Ecosystem, Error: r.Error}
+			for _, v := range r.Vulnerabilities {
+				vuln := vulnerability{ID: v.ID, Summary: v.Summary}
+				if len(v.Severity) > 0 {
+					vuln.Severity = v.Severity[0].Type + " " + v.Severity[0].Score
+				}
+				f.Vulnerabilities = append(f.Vulnerabilities, vuln)
+			}
+			if r.HasVulnerabilities() {
+				report.Vulnerable++
+			}
+			report.Findings = append(report.Findings, f)
+		}
+	}
+	return report, nil
+}
+
+// mcpRunTool runs an installed tool for an assistant and returns what it
+// printed
+func mcpRunTool(ctx context.Context, name string, args []string, timeout, maxTimeout time.Duration, allowed func(string) error) (any, error) {
+	installer, venvMgr, err := openInstaller()
+	if err != nil {
+		return nil, err
+	}
+	t, executable, err := installer.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := allowed(t.Name); err != nil {
+		return nil, err
+	}
+	toolRT, err := toolRuntime(runtime.NewManager(homeDir), t)
+	if err != nil {
+		return nil, err
+	}
+
+	command, commandArgs := filepath.Join(venvMgr.GetBinDir(t.InstallPath), executable), args
+	if t.Sandbox != nil {
+		command, commandArgs, err = sandbox.Wrap(*t.Sandbox, command, args, t.InstallPath, toolRT.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sandbox %s: %w", t.Name, err)
+		}
+	}
+	if timeout <= 0 || timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+
+	stdout, stderr := mcp.NewLimitedBuffer(64<<10), mcp.NewLimitedBuffer(64<<10)
+	runCmd := exec.CommandContext(ctx, command, commandArgs...)
+	runCmd.Stdout = stdout
+	runCmd.Stderr = stderr
+
+	started := time.Now()
+	err = supervisor.RunWithLimits(runCmd, supervisor.Limits{Timeout: timeout})
+	record := tool.RunRecord{Tool: name, StartedAt: started, Duration: time.Since(started)}
+
+	result := map[string]any{"exit_code": 0, "duration": record.Duration.Round(time.Millisecond).String()}
+	var exitErr *exec.ExitError
+	var limitErr *supervisor.LimitError
+	switch {
+	case errors.As(err, &limitErr):
+		record.ExitCode = -1
+		result["exit_code"], result["error"] = -1, fmt.Sprintf("%s %s", name, limitErr)
+	case errors.As(err, &exitErr):
+		record.ExitCode = exitErr.ExitCode()
+		result["exit_code"] = record.ExitCode
+	case err != nil:
+		record.ExitCode, record.Error = -1, err.Error()
+		recordRun(record, args)
+		return nil, fmt.Errorf("failed to run %s: %w", name, err)
+	}
+	recordRun(record, args)
+
+	result["stdout"], result["stderr"] = stdout.String(), stderr.String()
+	if stdout.Truncated() || stderr.Truncated() {
+		result["truncated"] = true
+	}
+	return result, nil
+}
+
+func metricsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "metrics",
+		Short: "Monitoring helpers for ophid's Prometheus metrics",
+	}
+
+	var output string
+	var title string
+	dashboard := &cobra.Command{
+		Use:   "dashboard",
+		Short: "Print a Grafana dashboard of ophid's metrics",
+		Long: `Print a Grafana dashboard (JSON) of the metrics the proxy admin API
+serves at /metrics: route traffic, errors and latency, backend health,
+certificate expiry, supervised processes, and the security findings,
+install times and caches of installed tools.
+
+Import it in Grafana (Dashboards > New > Import) or drop it in a
+provisioned dashboards directory; pick the Prometheus data source that
+scrapes general.admin_listen in its "Data source" variable.
+
+Examples:
+  ophid metrics dashboard > ophid-dashboard.json
+  ophid metrics dashboard --title "ophid (prod)" -o /var/lib/grafana/dashboards/ophid.json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := json.MarshalIndent(metrics.NewDashboard(title), "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal dashboard: %w", err)
+			}
+			if output == "" {
+				fmt.Println(string(data))
+				return nil
+			}
+			if err := os.WriteFile(output, append(data, '\n'), 0644); err != nil {
+				return fmt.Errorf("failed to write dashboard: %w", err)
+			}
+			ui.Success("Dashboard written to %s", output)
+			return nil
+		},
+	}
+	dashboard.Flags().StringVarP(&output, "output", "o", "", "Write the dashboard to this file instead of stdout")
+	dashboard.Flags().StringVar(&title, "title", "ophid", "Dashboard title")
+
+	cmd.AddCommand(dashboard)
+	return cmd
+}
+
+func backupCmd() *cobra.Command {
+	var output string
+	var proxyConfigs, bundleFiles []string
+	var encryption backup.Encryption
+
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Back up tools, supervisor state, certificates and configs",
+		Long: `Snapshot what ophid can't recreate into a .tar.gz: the tool manifest,
+run and job history, supervisor state, the ACME certificate cache and local
+CA, and the proxy configs and bundles given. Runtimes, venvs and caches are
+left out; the backup carries an ophid.toml and ophid.lock of the installed
+runtimes and tools to reinstall them from.
+
+With --recipient, --recipients-file or --passphrase the backup is encrypted
+with age (https://age-encryption.org), which must be on PATH.`,
+		Example: `  ophid backup --proxy-config /etc/ophid/proxy.toml
+  ophid backup -o ops.tar.gz.age --recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			now := time.Now()
+			if output == "" {
+				output = "ophid-backup-" + now.Format("20060102-150405") + ".tar.gz"
+				if encryption.Enabled() {
+					output += ".age"
+				}
+			}
+			if _, err := os.Stat(output); err == nil {
+				return errcode.Errorf(errcode.Conflict, "%s already exists", output)
+			}
+
+			b := backup.New(version, now.UTC())
+			if err := b.AddHome(homeDir, backup.HomePaths...); err != nil {
+				return err
+			}
+			for _, path := range proxyConfigs {
+				if err := b.AddFile(path); err != nil {
+					return err
+				}
+			}
+			for _, path := range bundleFiles {
+				if err := b.AddFile(path); err != nil {
+					return err
+				}
+				lockFile := bundle.LockPath(path)
+				if _, err := os.Stat(lockFile); err != nil {
+					continue
+				}
+				if err := b.AddFile(lockFile); err != nil {
+					return err
+				}
+			}
+
+			// What to reinstall runtimes and tools from
+			runtimes, err := runtime.NewManager(homeDir).List()
+			if err != nil {
+				return fmt.Errorf("failed to list runtimes: %w", err)
+			}
+			installer, err := tool.NewInstaller(homeDir, tool.NewVenvManager(homeDir, ""))
+			if err != nil {
+				return fmt.Errorf("failed to create installer: %w", err)
+			}
+			installed, lock := bundle.Dump(runtimes, installer.List())
+			bundleData, err := installed.Encode(now)
+			if err != nil {
+				return fmt.Errorf("failed to encode bundle: %w", err)
+			}
+			lockData, err := lock.Encode(now)
+			if err != nil {
+				return fmt.Errorf("failed to encode lock file: %w", err)
+			}
+			b.Add("lock/"+bundle.DefaultFile, "backup/"+bundle.DefaultFile, 0644, bundleData)
+			b.Add("lock/"+bundle.LockPath(bundle.DefaultFile), "backup/"+bundle.LockPath(bundle.DefaultFile), 0644, lockData)
+
+			var archive bytes.Buffer
+			if err := b.Write(&archive); err != nil {
+				return err
+			}
+			data := archive.Bytes()
+			if encryption.Enabled() {
+				if data, err = backup.Encrypt(data, encryption); err != nil {
+					return err
+				}
+			}
+			if err := os.WriteFile(output, data, 0600); err != nil {
+				return fmt.Errorf("failed to write backup: %w", err)
+			}
+
+			ui.Success("Backed up %d file(s) to %s", len(b.Index.Entries), output)
+			if _, err := os.Stat(filepath.Join(homeDir, "ca")); err == nil && !encryption.Enabled() {
+				ui.Warn("The backup holds the local CA's private key unencrypted; keep it safe or use --recipient")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Backup file (default ophid-backup-<date>.tar.gz)")
+	cmd.Flags().StringArrayVar(&proxyConfigs, "proxy-config", nil, "Also back up this proxy config file (repeatable)")
+	cmd.Flags().StringArrayVar(&bundleFiles, "bundle", nil, "Also back up this ophid.toml and its lock file (repeatable)")
+	cmd.Flags().StringArrayVarP(&encryption.Recipients, "recipient", "r", nil, "Encrypt to this age or SSH public key (repeatable)")
+	cmd.Flags().StringArrayVarP(&encryption.RecipientFiles, "recipients-file", "R", nil, "Encrypt to the public keys in this file (repeatable)")
+	cmd.Flags().BoolVar(&encryption.Passphrase, "passphrase", false, "Encrypt with a passphrase asked on the terminal")
+	return cmd
+}
+
+func restoreCmd() *cobra.Command {
+	var identities []string
+	var force, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "restore <backup>",
+		Short: "Restore a backup made by ophid backup",
+		Long: `Restore the files of a backup: ophid's own under this machine's ophid
+home, proxy configs and bundles where they were backed up from. Files that
+exist and differ from the backup are only overwritten with --force.
+
+Tools come back in the manifest but without their venvs. The ophid.toml and
+ophid.lock of the backed up tools are restored to ~/.ophid/backup; reinstall
+the tools they pin.
+
+Encrypted backups are decrypted with age, with the --identity files given or
+else a passphrase.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read backup: %w", err)
+			}
+			if backup.Encrypted(data) {
+				if data, err = backup.Decrypt(data, identities); err != nil {
+					return err
+				}
+			}
+			b, err := backup.Read(bytes.NewReader(data))
+			if err != nil {
+				return err
+			}
+
+			if dryRun {
+				for _, e := range b.Index.Entries {
+					fmt.Println(backup.Target(homeDir, e))
+				}
+				return nil
+			}
+
+			if conflicts := b.Conflicts(homeDir); len(conflicts) > 0 && !force {
+				for _, path := range conflicts {
+					ui.Warn("%s differs from the backup", path)
+				}
+				return errcode.Errorf(errcode.Conflict, "restoring would overwrite %d file(s) (use --force to overwrite)", len(conflicts))
+			}
+
+			restored, err := b.Restore(homeDir)
+			if err != nil {
+				return err
+			}
+			ui.Success("Restored %d file(s) from a backup of %s (ophid %s)", len(restored), b.Index.Created.Local().Format("2006-01-02 15:04"), b.Index.Version)
+
+			// Tools are backed up without their venvs
+			manifest, err := tool.LoadManifest(homeDir)
+			if err != nil {
+				return nil
+			}
+			var missing []string
+			for name, t := range manifest.Tools {
+				if _, err := os.Stat(t.InstallPath); err != nil {
+					missing = append(missing, name)
+				}
+			}
+			if len(missing) > 0 {
+				sort.Strings(missing)
+				ui.Warn("%d tool(s) need reinstalling: %s", len(missing), strings.Join(missing, ", "))
+				ui.Println("  Their versions and sources are pinned in", filepath.Join(homeDir, "backup", bundle.LockPath(bundle.DefaultFile)))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVarP(&identities, "identity", "i", nil, "age identity file to decrypt with (repeatable)")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite files that differ from the backup")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List where each file would be restored, without restoring")
+	return cmd
+}
+
+// secretsPassphraseEnv supplies the secrets passphrase where there is no
+// terminal to ask on, e.g. under a service manager
+const secretsPassphraseEnv = "OPHID_SECRETS_PASSPHRASE"
+
+// openSecrets opens the secrets store, with the OS keychain or else a
+// passphrase from OPHID_SECRETS_PASSPHRASE or the terminal
+func openSecrets(usePassphrase bool) (*secrets.Store, error) {
+	return secrets.Open(secrets.DefaultPath(homeDir), secrets.Options{
+		Keychain:      secrets.SystemKeychain(),
+		Passphrase:    readSecretsPassphrase,
+		UsePassphrase: usePassphrase,
+	})
+}
+
+// readSecretsPassphrase asks for the secrets passphrase, twice when
+// creating the store
+func readSecretsPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(secretsPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("the secrets store needs a passphrase: set %s", secretsPassphraseEnv)
+	}
+
+	ask := func(prompt string) (string, error) {
+		fmt.Fprint(os.Stderr, prompt)
+		data, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(data), err
+	}
+	passphrase, err := ask("Secrets passphrase: ")
+	if err != nil || !confirm {
+		return passphrase, err
+	}
+	again, err := ask("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if again != passphrase {
+		return "", errors.New("passphrases don't match")
+	}
+	return passphrase, nil
+}
+
+// secretLookup returns a lookup that opens the secrets store on first use,
+// so configs without {{secret:name}} references never ask for its key
+func secretLookup() secrets.Lookup {
+	var once sync.Once
+	var store *secrets.Store
+	var openErr error
+	return func(name string) (string, error) {
+		once.Do(func() { store, openErr = openSecrets(false) })
+		if openErr != nil {
+			return "", openErr
+		}
+		value, err := store.Get(name)
+		if errors.Is(err, secrets.ErrNotFound) {
+			return "", errcode.Wrap(errcode.NotFound, err)
+		}
+		return value, err
+	}
+}
+
+func secretCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Manage encrypted secrets for process and proxy configs",
+		Long: `Keep credentials in ~/.ophid/secrets.enc, encrypted with AES-256-GCM,
+and reference them as {{secret:<name>}} in the environment of service
+files and in the credential settings of proxy configs (acme_eab_kid,
+acme_eab_hmac_key, dynamic token, log sink and route headers). They are
+resolved when a process or the proxy starts and never written out.
+
+The store's key is kept in the OS keychain (macOS Keychain, Windows
+Credential Manager, or the Secret Service through secret-tool on Linux
+desktops) or derived from a
+passphrase, asked on the terminal or read from OPHID_SECRETS_PASSPHRASE.`,
+	}
+
+	var usePassphrase bool
+	setCmd := &cobra.Command{
+		Use:   "set <name> [value]",
+		Short: "Set a secret, read from stdin or the terminal unless given",
+		Example: `  ophid secret set zerossl-hmac
+  vault read -field=token secret/consul | ophid secret set consul-token`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openSecrets(usePassphrase)
+			if err != nil {
+				return err
+			}
+
+			var value string
+			switch {
+			case len(args) == 2:
+				value = args[1]
+			case term.IsTerminal(int(os.Stdin.Fd())):
+				fmt.Fprintf(os.Stderr, "Value of %s: ", args[0])
+				data, err := term.ReadPassword(int(os.Stdin.Fd()))
+				fmt.Fprintln(os.Stderr)
+				if err != nil {
+					return fmt.Errorf("failed to read secret: %w", err)
+				}
+				value = string(data)
+			default:
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("failed to read secret: %w", err)
+				}
+				value = strings.TrimRight(string(data), "\r\n")
+			}
+
+			if err := store.Set(args[0], value); err != nil {
+				return err
+			}
+			if err := store.Save(); err != nil {
+				return err
+			}
+			ui.Success("Secret %s set (key in %s)", args[0], store.KeySource())
+			return nil
+		},
+	}
+	setCmd.Flags().BoolVar(&usePassphrase, "passphrase", false, "Create the store with a passphrase even if a keychain is available")
+
+	getCmd := &cobra.Command{
+		Use:   "get <name>",
+		Short: "Print a secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			value, err := secretLookup()(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(value)
+			return nil
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List secret names",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := os.Stat(secrets.DefaultPath(homeDir)); err != nil {
+				ui.Println("No secrets stored")
+				return nil
+			}
+			store, err := openSecrets(false)
+			if err != nil {
+				return err
+			}
+			for _, name := range store.Names() {
+				fmt.Println(name)
+			}
+			return nil
+		},
+	}
+
+	rmCmd := &cobra.Command{
+		Use:   "rm <name>",
+		Short: "Remove a secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openSecrets(false)
+			if err != nil {
+				return err
+			}
+			if !store.Delete(args[0]) {
+				return errcode.Errorf(errcode.NotFound, "secret %s not found", args[0])
+			}
+			if err := store.Save(); err != nil {
+				return err
+			}
+			ui.Success("Secret %s removed", args[0])
+			return nil
+		},
+	}
+
+	cmd.AddCommand(setCmd, getCmd, listCmd, rmCmd)
+	return cmd
+}
+
+func authCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Manage credentials for private package indexes and git hosts",
+		Long: `Store tokens for private package indexes and git hosts in the OS keychain
+(macOS Keychain, Windows Credential Manager, or the Secret Service through
+secret-tool on Linux desktops), so they never live in config files.
+
+Installers look up a host's credentials in the keychain first, then ask
+git's credential helpers (osxkeychain, libsecret, Git Credential Manager).
+They reach pip and git through the environment only; URLs in the manifest
+and logs are stripped of them.`,
+	}
+
+	var username string
+	loginCmd := &cobra.Command{
+		Use:   "login <host>",
+		Short: "Store a token for a host, read from stdin or the terminal",
+		Example: `  ophid auth login github.com
+  ophid auth login pypi.corp.example --username deploy
+  gh auth token | ophid auth login github.com`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			host := args[0]
+			if username == "" {
+				username = tool.DefaultUsername(host)
+			}
+
+			var token string
+			if term.IsTerminal(int(os.Stdin.Fd())) {
+				fmt.Fprintf(os.Stderr, "Token for %s: ", host)
+				data, err := term.ReadPassword(int(os.Stdin.Fd()))
+				fmt.Fprintln(os.Stderr)
+				if err != nil {
+					return fmt.Errorf("failed to read token: %w", err)
+				}
+				token = string(data)
+			} else {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("failed to read token: %w", err)
+				}
+				token = strings.TrimRight(string(data), "\r\n")
+			}
+			if token == "" {
+				return errors.New("empty token")
+			}
+
+			if err := tool.NewAuth(secrets.SystemKeychain()).Login(host, username, token); err != nil {
+				return err
+			}
+			ui.Success("Credentials for %s stored in the OS keychain (user %s)", host, username)
+			return nil
+		},
+	}
+	loginCmd.Flags().StringVar(&username, "username", "", "Username sent with the token (default x-access-token for GitHub, __token__ otherwise)")
+
+	logoutCmd := &cobra.Command{
+		Use:   "logout <host>",
+		Short: "Remove a host's credentials from the OS keychain",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := tool.NewAuth(secrets.SystemKeychain()).Logout(args[0]); err != nil {
+				return err
+			}
+			ui.Success("Credentials for %s removed", args[0])
+			return nil
+		},
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   "status <host>",
+		Short: "Show where a host's credentials come from, without the token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			creds, err := tool.NewAuth(secrets.SystemKeychain()).Lookup(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			if creds == nil {
+				return errcode.Errorf(errcode.NotFound, "no credentials for %s", args[0])
+			}
+			ui.Stdout.Printf("%s: user %s, from the %s\n", args[0], creds.Username, creds.Source)
+			return nil
+		},
+	}
+
+	cmd.AddCommand(loginCmd, logoutCmd, statusCmd)
+	return cmd
+}
+
+// sshFlags adds the ssh options remote commands share and returns a
+// function applying them to a client
+func sshFlags(cmd *cobra.Command) func(*remote.Client) {
+	var identity, binary string
+	var options []string
+	cmd.Flags().StringVarP(&identity, "identity", "i", "", "SSH private key")
+	cmd.Flags().StringArrayVarP(&options, "ssh-option", "o", nil, "SSH option, as for ssh -o (repeatable)")
+	cmd.Flags().StringVar(&binary, "binary", "", "ophid build to bootstrap hosts without ophid (default this binary, for hosts of the same OS and architecture)")
+
+	return func(c *remote.Client) {
+		if identity != "" {
+			c.Options = append(c.Options, "-i", identity)
+		}
+		for _, option := range options {
+			c.Options = append(c.Options, "-o", option)
+		}
+		c.Binary = binary
+	}
+}
+
+func remoteCmd() *cobra.Command {
+	var applySSH func(*remote.Client)
+	cmd := &cobra.Command{
+		Use:   "remote <host> <command> [args...]",
+		Short: "Run an ophid command on another host over SSH",
+		Long: `Run an ophid command on another host through the system ssh client, so
+~/.ssh/config, agents and known_hosts apply. A host without ophid gets a
+copy of this binary in ~/.ophid/bin first (or of --binary, for hosts of
+another OS or architecture).
+
+Flags after <host> belong to the remote command.`,
+		Example: `  ophid remote web1 list
+  ophid remote deploy@web2 install ansible --version 9.1.0
+  ophid remote -i ~/.ssh/fleet ssh://ops@db1:2222 doctor`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := remote.NewClient(args[0])
+			applySSH(client)
+			client.TTY = term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+
+			var stdin io.Reader
+			if client.TTY {
+				stdin = os.Stdin
+			}
+			return client.Ophid(cmd.Context(), args[1:], stdin, os.Stdout, os.Stderr)
+		},
+	}
+	cmd.Flags().SetInterspersed(false)
+	applySSH = sshFlags(cmd)
+	return cmd
+}
+
+func fleetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fleet",
+		Short: "Roll out ophid.toml to a fleet of hosts over SSH",
+	}
+
+	var hostsFile string
+	var parallel int
+	var keepGoing bool
+	var applySSH func(*remote.Client)
+	applyCmd := &cobra.Command{
+		Use:   "apply [ophid.toml]",
+		Short: "Install a bundle on every host of an inventory",
+		Long: `Copy ophid.toml, and its ophid.lock and signature when there are, to every
+host of an inventory and run ophid bundle install there, bootstrapping
+ophid on hosts without it. Hosts with bundle.trusted_keys refuse a bundle
+not signed by one of them. The inventory lists one ssh destination per
+line (host, user@host or ssh://user@host:port); # starts a comment.
+
+Hosts are done one at a time, in inventory order, and the rollout stops at
+the first failure, leaving the remaining hosts as they were. --parallel
+works on several hosts at once; --keep-going carries on past failures.
+SSH runs in batch mode: keys or an agent must log in without prompts.`,
+		Example: `  ophid fleet apply ophid.toml --hosts inventory
+  ophid fleet apply --hosts inventory --parallel 5 --keep-going`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file := bundle.DefaultFile
+			if len(args) > 0 {
+				file = args[0]
+			}
+			// Parse it here, so a broken file fails before any host is touched
+			if _, err := bundle.Load(file); err != nil {
+				return err
+			}
+			bundleData, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", file, err)
+			}
+			var lockData []byte
+			lockFile := bundle.LockPath(file)
+			if _, err := os.Stat(lockFile); err == nil {
+				if _, err := bundle.LoadLock(lockFile); err != nil {
+					return err
+				}
+				if lockData, err = os.ReadFile(lockFile); err != nil {
+					return fmt.Errorf("failed to read %s: %w", lockFile, err)
+				}
+			}
+			// Hosts trusting a team key check the signature themselves
+			var sigData []byte
+			if data, err := os.ReadFile(bundle.SignaturePath(file)); err == nil {
+				sigData = data
+			}
+
+			hosts, err := remote.LoadInventory(hostsFile)
+			if err != nil {
+				return err
+			}
+
+			ui.Printf("Applying %s to %d host(s)...\n", file, len(hosts))
+			results := remote.Fleet(cmd.Context(), hosts, remote.FleetOptions{
+				Parallel:  parallel,
+				KeepGoing: keepGoing,
+				Output:    os.Stderr,
+			}, func(ctx context.Context, host string, out io.Writer) error {
+				client := remote.NewClient(host)
+				client.Options = []string{"-o", "BatchMode=yes"}
+				applySSH(client)
+				return client.ApplyBundle(ctx, bundleData, lockData, sigData, out, out)
+			})
+
+			failed, skipped := 0, 0
+			ui.Println()
+			for _, r := range results {
+				switch {
+				case r.Skipped:
+					skipped++
+					ui.Warn("%s: skipped", r.Host)
+				case r.Err != nil:
+					failed++
+					ui.Error("%v", r.Err)
+				default:
+					ui.Success("%s: applied in %s", r.Host, r.Duration.Round(time.Second))
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d host(s) failed, %d skipped", failed, len(hosts), skipped)
+			}
+			return nil
+		},
+	}
+	applyCmd.Flags().StringVar(&hostsFile, "hosts", "", "Inventory file, one ssh destination per line")
+	applyCmd.Flags().IntVar(&parallel, "parallel", 1, "Hosts to work on at once")
+	applyCmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Carry on with the remaining hosts after a failure")
+	applyCmd.MarkFlagRequired("hosts")
+	applySSH = sshFlags(applyCmd)
+
+	cmd.AddCommand(applyCmd)
+	return cmd
+}
+
+func statusCmd() *cobra.Command {
+	var checkDrift, fix, prune, jsonOutput bool
+	var file string
+	var services []string
+	var vars map[string]string
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show installed runtimes, tools and supervised processes",
+		Long: `Show what is installed and running. With --drift, compare it with what is
+declared: the runtimes and tools of ophid.toml and the processes of service
+files. Each difference is reported as missing (declared, but not installed
+or not running), extra (installed or running, but not declared) or mismatch
+(a different version, source or command than declared). It exits 1 when
+anything drifted, so it works as a check in cron or CI.
+
+--fix installs missing and mismatched runtimes and tools as 'ophid bundle
+install' would; --prune also uninstalls tools ophid.toml doesn't list.
+Processes are left to 'ophid supervise'.
+
+Examples:
+  ophid status
+  ophid status --drift
+  ophid status --drift --service web.yaml --service worker.yaml
+  ophid status --drift --fix --prune
+  ophid status --drift --json`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true, // Drift is not a usage error
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (fix || prune || len(services) > 0) && !checkDrift {
+				return fmt.Errorf("--fix, --prune and --service need --drift")
+			}
+			if prune && !fix {
+				return fmt.Errorf("--prune needs --fix")
+			}
+			if fix {
+				if err := checkUnlocked(cmd, args); err != nil {
+					return err
+				}
+			}
+			statePath := filepath.Join(homeDir, "supervisor", "state.json")
+			states, err := supervisor.LoadState(statePath)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+
+			if !checkDrift {
+				return printStatus(states, jsonOutput)
+			}
+
+			// The default ophid.toml is optional when service files are given
+			var b *bundle.Bundle
+			if _, err := os.Stat(file); err == nil || cmd.Flags().Changed("file") || len(services) == 0 {
+				if b, err = bundle.Load(file); err != nil {
+					return err
+				}
+			} else if fix {
+				return errcode.Errorf(errcode.NotFound, "--fix needs %s", file)
+			}
+
+			var declared []drift.Service
+			for _, path := range services {
+				config, ports, err := loadService(path, vars)
+				if err != nil {
+					return err
+				}
+				declared = append(declared, drift.Service{Config: config, CompareArgs: len(ports) == 0})
+			}
+
+			compare := func() ([]drift.Item, error) {
+				var items []drift.Item
+				if b != nil {
+					runtimes, err := runtime.NewManager(homeDir).List()
+					if err != nil {
+						return nil, fmt.Errorf("failed to list runtimes: %w", err)
+					}
+					installer, err := tool.NewInstaller(homeDir, tool.NewVenvManager(homeDir, ""))
+					if err != nil {
+						return nil, fmt.Errorf("failed to create installer: %w", err)
+					}
+					items = drift.CompareBundle(b, runtimes, installer.List())
+				}
+				if len(declared) > 0 {
+					items = append(items, drift.CompareProcesses(declared, states)...)
+				}
+				return items, nil
+			}
+
+			items, err := compare()
+			if err != nil {
+				return err
+			}
+
+			if fix && len(items) > 0 {
+				if err := fixDrift(file, items, prune); err != nil {
+					return err
+				}
+				if items, err = compare(); err != nil {
+					return err
+				}
+			}
+
+			if jsonOutput {
+				if items == nil {
+					items = []drift.Item{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(items); err != nil {
+					return err
+				}
+			} else {
+				for _, item := range items {
+					if item.Drift == drift.Extra {
+						ui.Stdout.Warn("%s", item)
+					} else {
+						ui.Stdout.Error("%s", item)
+					}
+				}
+			}
+
+			if len(items) > 0 {
+				for _, item := range items {
+					if item.Kind == drift.KindProcess && item.Drift != drift.Extra && !jsonOutput {
+						ui.Printf("Start or restart declared processes with: ophid supervise %s\n", strings.Join(services, " "))
+						break
+					}
+				}
+				return fmt.Errorf("%d drift item(s)", len(items))
+			}
+			if !jsonOutput {
+				ui.Stdout.Success("No drift")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&checkDrift, "drift", false, "Compare with ophid.toml and service files and report drift")
+	cmd.Flags().StringVarP(&file, "file", "f", bundle.DefaultFile, "Bundle file declaring runtimes and tools")
+	cmd.Flags().StringArrayVar(&services, "service", nil, "Service file declaring a process (repeatable)")
+	cmd.Flags().StringToStringVar(&vars, "var", nil, "Set a service template variable (repeatable)")
+	cmd.Flags().BoolVar(&fix, "fix", false, "Install missing and mismatched runtimes and tools")
+	cmd.Flags().BoolVar(&prune, "prune", false, "With --fix, also uninstall tools the bundle doesn't list")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+
+	return cmd
+}
+
+// printStatus prints installed runtimes and tools and supervised processes
+func printStatus(states []supervisor.ProcessState, jsonOutput bool) error {
+	runtimes, err := runtime.NewManager(homeDir).List()
+	if err != nil {
+		return fmt.Errorf("failed to list runtimes: %w", err)
+	}
+	installer, err := tool.NewInstaller(homeDir, tool.NewVenvManager(homeDir, ""))
+	if err != nil {
+		return fmt.Errorf("failed to create installer: %w", err)
+	}
+	tools := installer.List()
+
+	if jsonOutput {
+		type processInfo struct {
+			Name    string `json:"name"`
+			Status  string `json:"status"`
+			PID     int    `json:"pid,omitempty"`
+			Running bool   `json:"running"`
+		}
+		status := struct {
+			Runtimes  []string          `json:"runtimes"`
+			Tools     map[string]string `json:"tools"`
+			Processes []processInfo     `json:"processes"`
+		}{Runtimes: []string{}, Tools: map[string]string{}, Processes: []processInfo{}}
+		for _, rt := range runtimes {
+			status.Runtimes = append(status.Runtimes, fmt.Sprintf("%s@%s", rt.Type, rt.Version))
+		}
+		for _, t := range tools {
+			status.Tools[t.Name] = t.Version
+		}
+		for _, s := range states {
+			status.Processes = append(status.Processes, processInfo{Name: s.Name, Status: string(s.Status), PID: s.PID, Running: s.Running()})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+
+	fmt.Printf("Runtimes (%d):\n", len(runtimes))
+	for _, rt := range runtimes {
+		fmt.Printf("  %s@%s\n", rt.Type, rt.Version)
+	}
+	fmt.Printf("Tools (%d):\n", len(tools))
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	for _, t := range tools {
+		fmt.Printf("  %s %s\n", t.Name, t.Version)
+	}
+	fmt.Printf("Processes (%d):\n", len(states))
+	for _, s := range states {
+		status := string(s.Status)
+		if s.Running() {
+			status = fmt.Sprintf("running, pid %d", s.PID)
+		} else if s.Status == supervisor.StatusRunning || s.Status == supervisor.StatusBackoff {
+			status = "gone (supervisor not running)"
+		}
+		fmt.Printf("  %s %s\n", s.Name, status)
+	}
+	return nil
+}
+
+// fixDrift installs what a bundle declares and, with prune, uninstalls the
+// tools it doesn't
+func fixDrift(file string, items []drift.Item, prune bool) error {
+	needInstall := false
+	var extraTools []string
+	for _, item := range items {
+		switch {
+		case item.Kind == drift.KindProcess:
+		case item.Drift != drift.Extra:
+			needInstall = true
+		case item.Kind == drift.KindTool && prune:
+			extraTools = append(extraTools, item.Name)
+		}
+	}
+
+	if needInstall {
+		_, installed, err := installBundle(file)
+		if err != nil {
+			return err
+		}
+		ui.OK("%s applied: %d tool(s) installed or changed", file, installed)
+	}
+	if len(extraTools) > 0 {
+		installer, _, err := openInstaller()
+		if err != nil {
+			return err
+		}
+		for _, name := range extraTools {
+			if err := installer.Uninstall(name); err != nil {
+				return fmt.Errorf("failed to uninstall %s: %w", name, err)
+			}
+			ui.OK("uninstalled %s", name)
+		}
+	}
+	return nil
+}
+
+func lockdownCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lockdown",
+		Short: "Lock a host to what was provisioned",
+		Long: `Lock a production host to what was provisioned. While locked, commands
+that change runtimes or tools (install, uninstall, upgrade, runtime install
+and remove, bundle install, status --fix, restore, sandbox set and clear,
+verify --update and the MCP install_tool) refuse to run unless OPHID_OVERRIDE_TOKEN holds
+the override token. Every attempt is logged to ~/.ophid/lockdown.log, or
+the "log" of the config, as a JSON line: time, user, command and whether it
+was denied or overridden.
+
+The lock lives in ~/.ophid/lockdown.toml, or with --system in
+/etc/ophid/lockdown.toml (%ProgramData%\ophid on Windows) where users
+can't remove it. Either one locks the host.
+
+Examples:
+  ophid lockdown enable             # Prints the override token once
+  sudo ophid lockdown enable --system
+  OPHID_OVERRIDE_TOKEN=... ophid install ansible --version 9.2.0
+  ophid lockdown status
+  OPHID_OVERRIDE_TOKEN=... ophid lockdown disable`,
+	}
+
+	var system bool
+	var logPath string
+	configPath := func() string {
+		if system {
+			return lockdown.SystemPath()
+		}
+		return filepath.Join(homeDir, lockdown.File)
+	}
+
+	enableCmd := &cobra.Command{
+		Use:   "enable",
+		Short: "Lock the host and print a new override token",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := configPath()
+			config, err := lockdown.LoadConfig(path)
+			if err != nil {
+				return err
+			}
+			if config.Enabled {
+				return errcode.Errorf(errcode.Conflict, "%s already locks this host", path)
+			}
+
+			token, hash, err := lockdown.NewToken()
+			if err != nil {
+				return err
+			}
+			config = &lockdown.Config{Enabled: true, TokenHash: hash, Log: logPath}
+			if err := config.Write(path); err != nil {
+				return err
+			}
+
+			ui.Success("Locked by %s", path)
+			ui.Println("Override token (shown once, store it safely):")
+			fmt.Println(token)
+			return nil
+		},
+	}
+	enableCmd.Flags().StringVar(&logPath, "log", "", "File to log attempts to (default ~/.ophid/lockdown.log)")
+
+	disableCmd := &cobra.Command{
+		Use:   "disable",
+		Short: "Unlock the host (needs OPHID_OVERRIDE_TOKEN)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := configPath()
+			config, err := lockdown.LoadConfig(path)
+			if err != nil {
+				return err
+			}
+			if !config.Enabled {
+				return errcode.Errorf(errcode.NotFound, "%s doesn't lock this host", path)
+			}
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
+
+			config.Enabled = false
+			config.TokenHash = ""
+			if err := config.Write(path); err != nil {
+				return err
+			}
+			ui.Success("Unlocked %s", path)
+			return nil
+		},
+	}
+
+	var limit int
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the host is locked and recent attempts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			policy, err := lockdown.Load(homeDir, lockdown.Paths(homeDir)...)
+			if err != nil {
+				return err
+			}
+			if !policy.Locked {
+				ui.Stdout.OK("Not locked")
+				return nil
+			}
+			ui.Stdout.Warn("Locked by %s", policy.Source)
+			ui.Stdout.Printf("  Attempts are logged to %s\n", policy.Log)
+
+			attempts, err := lockdown.ReadLog(policy.Log, limit)
+			if err != nil {
+				return err
+			}
+			if len(attempts) == 0 {
+				return nil
+			}
+			fmt.Println()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tUSER\tRESULT\tCOMMAND")
+			for _, a := range attempts {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Time.Local().Format("2006-01-02 15:04:05"), orDefault(a.User, "-"), a.Result, a.Operation)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+	statusCmd.Flags().IntVarP(&limit, "limit", "n", 10, "Number of recent attempts to show (0 for all)")
+
+	cmd.PersistentFlags().BoolVar(&system, "system", false, "Use the system config instead of the one in ~/.ophid")
+	cmd.AddCommand(enableCmd, disableCmd, statusCmd)
+	return cmd
+}
+
+func verifyCmd() *cobra.Command {
+	var update, jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "verify [tool...]",
+		Short: "Check installed tools for tampering or corruption",
+		Long: `Check installed tools, or all of them, against what was installed. At
+install, ophid records the hashes of the pip RECORD files of the tool's
+venv; each RECORD lists the hashes of its package's files. verify reports
+files that were modified or removed since, packages added afterwards, and
+.pth or sitecustomize.py startup files no package installed.
+
+Tools installed by an older ophid have no record: --update records their
+current files as trusted, as it does after a deliberate change.
+
+Examples:
+  ophid verify
+  ophid verify ansible --json
+  ophid verify --update ansible`,
+		SilenceUsage: true, // Tampering is not a usage error
+		RunE: func(cmd *cobra.Command, args []string) error {
+			installer, _, err := openInstaller()
+			if err != nil {
+				return err
+			}
+			names := args
+			if len(names) == 0 {
+				for _, t := range installer.List() {
+					names = append(names, t.Name)
+				}
+				sort.Strings(names)
+			}
+
+			if update {
+				// Trusting the current files would hide tampering on a locked host
+				if err := checkUnlocked(cmd, args); err != nil {
+					return err
+				}
+				for _, name := range names {
+					if err := installer.UpdateIntegrity(name); err != nil {
+						return err
+					}
+					ui.OK("recorded %s", name)
+				}
+				return nil
+			}
+
+			type result struct {
+				Tool     string                  `json:"tool"`
+				Problems []tool.IntegrityProblem `json:"problems"`
+				Error    string                  `json:"error,omitempty"`
+			}
+			results := []result{}
+			failed, unrecorded := 0, 0
+			for _, name := range names {
+				problems, err := installer.Verify(name)
+				r := result{Tool: name, Problems: problems}
+				if r.Problems == nil {
+					r.Problems = []tool.IntegrityProblem{}
+				}
+				if err != nil {
+					if len(args) > 0 && errcode.Of(err) != errcode.NotFound {
+						return err
+					}
+					r.Error = err.Error()
+				}
+				switch {
+				case err != nil:
+					unrecorded++
+				case len(problems) > 0:
+					failed++
+				}
+				results = append(results, r)
+
+				if jsonOutput {
+					continue
+				}
+				switch {
+				case err != nil:
+					ui.Stdout.Warn("%v", err)
+				case len(problems) == 0:
+					ui.Stdout.OK("%s", name)
+				default:
+					ui.Stdout.Error("%s: %d file(s) not as installed", name, len(problems))
+					for _, p := range problems {
+						ui.Stdout.Printf("    %s\n", p)
+					}
+				}
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					return err
+				}
+			}
+			if failed > 0 {
+				return errcode.Errorf(errcode.Verification, "%d of %d tool(s) failed verification; reinstall them with: ophid install --force <tool>", failed, len(names))
+			}
+			if unrecorded > 0 {
+				return errcode.Errorf(errcode.NotFound, "%d of %d tool(s) have no integrity record", unrecorded, len(names))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&update, "update", false, "Record the current files as trusted")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+
+	return cmd
+}
+
+func ciCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ci",
+		Short: "Set up ophid in CI jobs",
+	}
+
+	var file, format, cacheDir string
+	setupCmd := &cobra.Command{
+		Use:   "setup",
+		Short: "Install ophid and the tools of ophid.toml for later CI steps",
+		Long: `Prepare a CI job non-interactively: copy this binary to ~/.ophid/bin,
+install the runtimes and tools of ophid.toml (if there is one) and hand
+later steps their paths and versions.
+
+On GitHub Actions, outputs go to $GITHUB_OUTPUT and tool directories to
+$GITHUB_PATH. Elsewhere, setup prints shell exports to eval: OPHID_<NAME>
+variables and PATH. Outputs: ophid-version, ophid-path, cache-key,
+cache-path, and <tool>-version and <tool>-path for each tool.
+
+--cache-dir keeps installed runtimes and tools in a directory the CI caches
+between jobs (e.g. GitLab's cache:paths), restoring them before installing;
+the archive is named after the cache key, which changes with ophid.toml and
+ophid.lock. On GitHub, the ophid action caches ~/.ophid with actions/cache
+instead.
+
+Examples:
+  ./ophid ci setup                                    # GitHub Actions
+  eval "$(./ophid ci setup --cache-dir .ophid-cache)"  # Any other CI`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format == "auto" {
+				format = ci.DetectFormat(os.Getenv)
+			}
+			if format != ci.FormatGitHub && format != ci.FormatGeneric {
+				return fmt.Errorf("unknown format %q (auto, github or generic)", format)
+			}
+			emit := ci.NewEmitter(format)
+
+			self, err := installSelf()
+			if err != nil {
+				return err
+			}
+			if err := emit.Path(filepath.Dir(self)); err != nil {
+				return err
+			}
+
+			var bundleData, lockData []byte
+			if data, err := os.ReadFile(file); err == nil {
+				bundleData = data
+				lockData, _ = os.ReadFile(bundle.LockPath(file))
+			} else if cmd.Flags().Changed("file") {
+				return fmt.Errorf("failed to read %s: %w", file, err)
+			}
+			key := ci.CacheKey(bundleData, lockData)
+
+			archive := ""
+			if cacheDir != "" && bundleData != nil {
+				archive = filepath.Join(cacheDir, key+".tar.gz")
+				_, manifestErr := os.Stat(filepath.Join(homeDir, "tools", "manifest.json"))
+				if _, err := os.Stat(archive); err == nil && os.IsNotExist(manifestErr) {
+					if err := ci.RestoreCache(archive, homeDir); err != nil {
+						ui.Warn("failed to restore cache, installing instead: %v", err)
+					} else {
+						ui.OK("restored %s", archive)
+						archive = "" // Already cached
+					}
+				}
+			}
+
+			if bundleData != nil {
+				if err := checkUnlocked(cmd, args); err != nil {
+					return err
+				}
+				b, installed, err := installBundle(file)
+				if err != nil {
+					return err
+				}
+				ui.OK("%s applied: %d runtime(s), %d tool(s) installed or changed", file, len(b.Runtimes), installed)
+			}
+
+			if archive != "" {
+				if _, err := os.Stat(archive); os.IsNotExist(err) {
+					if err := ci.SaveCache(archive, homeDir, "runtimes", "tools"); err != nil {
+						return err
+					}
+					// Caches of other keys would only grow the CI cache
+					if stale, err := filepath.Glob(filepath.Join(cacheDir, "ophid-*.tar.gz")); err == nil {
+						for _, path := range stale {
+							if path != archive {
+								os.Remove(path)
+							}
+						}
+					}
+					ui.OK("cached runtimes and tools in %s", archive)
+				}
+			}
+
+			outputs := [][2]string{
+				{"ophid-version", version},
+				{"ophid-path", self},
+				{"cache-key", key},
+				{"cache-path", homeDir},
+			}
+			installer, err := tool.NewInstaller(homeDir, tool.NewVenvManager(homeDir, ""))
+			if err != nil {
+				return fmt.Errorf("failed to create installer: %w", err)
+			}
+			tools := installer.List()
+			sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+			venvMgr := tool.NewVenvManager(homeDir, "")
+			for _, t := range tools {
+				bin := venvMgr.GetBinDir(t.InstallPath)
+				outputs = append(outputs, [2]string{t.Name + "-version", t.Version}, [2]string{t.Name + "-path", bin})
+				if err := emit.Path(bin); err != nil {
+					return err
+				}
+			}
+			for _, o := range outputs {
+				if err := emit.Output(o[0], o[1]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	setupCmd.Flags().StringVarP(&file, "file", "f", bundle.DefaultFile, "Bundle file to install; skipped when the default is missing")
+	setupCmd.Flags().StringVar(&format, "format", "auto", "Output format: auto, github or generic")
+	setupCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Directory the CI caches, to keep installed runtimes and tools in")
+
+	cmd.AddCommand(setupCmd)
+	return cmd
+}
+
+// installSelf copies the running binary to ~/.ophid/bin, where later CI
+// steps find it, and returns its path there
+func installSelf() (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the ophid binary: %w", err)
+	}
+	target := filepath.Join(homeDir, "bin", "ophid")
+	if goruntime.GOOS == "windows" {
+		target += ".exe"
+	}
+	if resolved, err := filepath.EvalSymlinks(self); err == nil {
+		self = resolved
+	}
+	if existing, err := filepath.EvalSymlinks(target); err == nil && existing == self {
+		return target, nil
+	}
+
+	data, err := os.ReadFile(self)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", self, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(target), err)
+	}
+	if err := os.WriteFile(target+".tmp", data, 0755); err != nil {
+		return "", fmt.Errorf("failed to install ophid: %w", err)
+	}
+	if err := os.Rename(target+".tmp", target); err != nil {
+		return "", fmt.Errorf("failed to install ophid: %w", err)
+	}
+	return target, nil
+}
+
+func shimsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "shims",
+		Short: "Rewrite the shims of installed executables",
+		Long: `Rewrite the shims in ~/.ophid/bin, one per installed executable, and
+remove those of executables no longer installed. With the directory in
+PATH, tools run by name from any shell, e.g. ansible-playbook instead of
+ophid run ansible-playbook.
+
+Installs, upgrades and uninstalls keep the shims up to date; this is for
+tools installed before shims existed, or after moving the ophid binary.
+When several tools provide an executable, its shim runs the one that owns
+the name (see ophid which --prefer). Shims of sandboxed tools go through
+ophid run so the sandbox applies.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			installer, _, err := openInstaller()
+			if err != nil {
+				return err
+			}
+			if err := installer.SyncShims(); err != nil {
+				return err
+			}
+			shimDir := installer.ShimDir()
+			ui.Success("Shims up to date in %s", shimDir)
+			if !inPath(shimDir, os.Getenv("PATH")) {
+				ui.Printf("Add it to PATH to use them, e.g. in your shell profile:\n  export PATH=\"%s:$PATH\"\n", shimDir)
+			}
+			return nil
+		},
+	}
+}
+
+// inPath reports whether dir is one of the directories of pathEnv
+func inPath(dir, pathEnv string) bool {
+	for _, entry := range filepath.SplitList(pathEnv) {
+		if entry != "" && filepath.Clean(entry) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func upgradeCmd() *cobra.Command {
+	var opts tool.UpgradeOptions
+	var buildPolicy string
+	var onlyBinary bool
+	var requireScan bool
+
+	cmd := &cobra.Command{
+		Use:   "upgrade <tool>",
+		Short: "Upgrade a tool",
+		Long: `Upgrade a tool installed from PyPI to its latest version, or to --version.
+
+The new version is scanned for vulnerabilities and checked against the
+security policy before pip runs (see ophid install --help), and the
+manifest keeps the versions each upgrade went from and to. By default pip
+upgrades the tool in its venv; --fresh builds a new venv instead, keeping
+the old one aside until the new one works.
+
+A tool installed with a smoke test runs it after the upgrade; when it
+fails, so does the upgrade.
+
+pip follows the build policy the tool was installed with unless
+--build-policy or --only-binary says otherwise; see ophid install --help.`,
+		Example: `  ophid upgrade ansible
+  ophid upgrade ansible --version 9.1.0
+  ophid upgrade ansible --fresh --require-scan`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
+			policy, err := buildPolicyFlag(buildPolicy, onlyBinary)
+			if err != nil {
+				return err
+			}
+			opts.BuildPolicy = policy
+			if opts.Policy, err = loadPolicy(requireScan); err != nil {
+				return err
+			}
+			installer, _, err := openInstaller()
+			if err != nil {
+				return err
+			}
+			current, err := installer.Get(args[0])
+			if err != nil {
+				return err
+			}
+
+			ui.Printf("Upgrading %s (%s)...\n", args[0], current.Version)
+			record, err := installer.Upgrade(args[0], opts)
+			if errors.Is(err, tool.ErrUpToDate) {
+				ui.OK("%s@%s is up to date", args[0], current.Version)
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("upgrade failed: %w", err)
+			}
+			ui.Success("%s upgraded: %s -> %s", args[0], record.From, record.To)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Version, "version", "latest", "Version to upgrade to")
+	cmd.Flags().BoolVar(&opts.Fresh, "fresh", false, "Build a fresh venv instead of upgrading in place")
+	cmd.Flags().BoolVar(&opts.Force, "force", false, "Reinstall even if the tool is at the version already")
+	cmd.Flags().BoolVar(&opts.SkipScan, "skip-scan", false, "Skip the security scan of the new version")
+	cmd.Flags().BoolVar(&requireScan, "require-scan", false, "Refuse versions violating the security policy")
+	cmd.Flags().StringVar(&buildPolicy, "build-policy", "", "Whether pip may build from source: prefer-binary, only-binary, allow-source")
+	cmd.Flags().BoolVar(&onlyBinary, "only-binary", false, "Install wheels only, never building from source")
+	return cmd
+}
+
+func uninstallCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "uninstall <tool>",
+		Short: "Uninstall a tool",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked(cmd, args); err != nil {
+				return err
+			}
+			toolName := args[0]
+
+			// Get Python runtime
+			runtimeMgr := runtime.NewManager(homeDir)
+			runtimes, err := runtimeMgr.List()
+			if err != nil || len(runtimes) == 0 {
+				return errcode.Errorf(errcode.NotFound, "no Python runtime installed")
+			}
+
+			pythonPath := filepath.Join(runtimes[0].Path, "bin", "python3")
+			venvMgr := tool.NewVenvManager(homeDir, pythonPath)
+
+			// Create installer
+			installer, err := tool.NewInstaller(homeDir, venvMgr)
+			if err != nil {
+				return fmt.Errorf("failed to create installer: %w", err)
+			}
+
+			// Uninstall tool
+			if err := installer.Uninstall(toolName); err != nil {
+				return fmt.Errorf("uninstall failed: %w", err)
+			}
+
+			return nil
+		},
+	}
+}
+
+func searchCmd() *cobra.Command {
+	var ecosystems []string
+	var limit int
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "search <query>...",
+		Short: "Search for tools",
+		Long: `Search PyPI and ophid's curated index of ops tools.
+
+Every word of the query must match a tool's name, or the description of a
+curated tool. Exact names come first, then names starting with the query,
+then the rest; curated tools rank above PyPI projects matching as well.
+
+The list of PyPI projects is downloaded once a day into ~/.ophid/cache/pypi.
+Rust, Ruby and conda tools come from the curated index only.
+
+Examples:
+  ophid search ansible
+  ophid search aws cli
+  ophid search lint --ecosystem pypi,gem
+  ophid search yaml --json`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results, err := tool.NewSearcher(homeDir).Search(cmd.Context(), strings.Join(args, " "), tool.SearchOptions{
+				Ecosystems: ecosystems,
+				Limit:      limit,
+			})
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				if results == nil {
+					results = []tool.SearchResult{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(results)
+			}
+
+			if len(results) == 0 {
+				fmt.Printf("No tools match '%s'\n", strings.Join(args, " "))
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVERSION\tECOSYSTEM\tINSTALL\tDESCRIPTION")
+			for _, r := range results {
+				name := r.Name
+				if r.Curated {
+					name += " *"
+				}
+				if r.Installed {
+					name += " (installed)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\tophid install %s\t%s\n", name, orDefault(r.Version, "-"), r.Ecosystem, r.Install, truncate(r.Summary, 60))
+			}
+			w.Flush()
+			fmt.Println("\n* in ophid's curated index of ops tools")
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&ecosystems, "ecosystem", nil, "Ecosystems to search: pypi, cargo, gem, conda (default: all)")
+	cmd.Flags().IntVar(&limit, "limit", 20, "Most results to show")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+	return cmd
+}
+
+// truncate shortens s to at most n runes, marking the cut with "..."
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+func infoCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "info <tool>",
+		Short: "Show tool information",
+		Long: `Show what ophid knows about a tool: for installed tools, the version,
+source, install path, executables and last security scan from the
+manifest; and what its registry says: the latest version and when it was
+released, summary, homepage and license. Tools that aren't installed are
+looked up on PyPI.
+
+Examples:
+  ophid info ansible
+  ophid info httpie --json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			installer, err := tool.NewInstaller(homeDir, tool.NewVenvManager(homeDir, ""))
+			if err != nil {
+				return fmt.Errorf("failed to create installer: %w", err)
+			}
+			info, err := installer.Info(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
+			}
+
+			t, remote := info.Installed, info.Remote
+			if t != nil {
+				fmt.Printf("%s@%s (installed)\n", t.Name, t.Version)
+			} else {
+				fmt.Printf("%s (not installed)\n", info.Name)
+			}
+			if remote != nil {
+				if remote.Summary != "" {
+					fmt.Printf("  Summary:     %s\n", remote.Summary)
+				}
+				if remote.Homepage != "" {
+					fmt.Printf("  Homepage:    %s\n", remote.Homepage)
+				}
+				if remote.License != "" {
+					fmt.Printf("  License:     %s\n", remote.License)
+				}
+				latest := fmt.Sprintf("%s on %s", orDefault(remote.LatestVersion, "unknown"), remote.Registry)
+				if !remote.Released.IsZero() {
+					latest += ", released " + remote.Released.Local().Format("2006-01-02")
+				}
+				fmt.Printf("  Latest:      %s\n", latest)
+			} else if info.RemoteError != "" {
+				fmt.Printf("  Latest:      unknown (%s)\n", info.RemoteError)
+			}
+			if t == nil {
+				fmt.Printf("\nInstall it with: ophid install %s\n", info.Name)
+				return nil
+			}
+
+			fmt.Printf("  Source:      %s\n", describeSource(t.Source))
+			fmt.Printf("  Installed:   %s in %s\n", t.InstalledAt.Local().Format("2006-01-02 15:04"), t.InstallPath)
+			if t.Runtime != "" {
+				fmt.Printf("  Runtime:     %s\n", t.Runtime)
+			}
+			if len(t.Executables) > 0 {
+				fmt.Printf("  Executables: %s\n", strings.Join(t.Executables, ", "))
+			}
+			if t.Security.VulnScanDate.IsZero() {
+				fmt.Printf("  Security:    not scanned\n")
+			} else {
+				fmt.Printf("  Security:    %d vulnerabilities (%d critical), scanned %s\n",
+					t.Security.VulnCount, t.Security.CriticalVulnCount, t.Security.VulnScanDate.Local().Format("2006-01-02"))
+			}
+			if t.Security.SBOMPath != "" {
+				fmt.Printf("  SBOM:        %s\n", t.Security.SBOMPath)
+			}
+			if t.Sandbox != nil {
+				fmt.Printf("  Sandbox:     %s\n", t.Sandbox)
+			}
+			if info.UpgradeAvailable {
+				fmt.Printf("\n%s is available: ophid upgrade %s\n", remote.LatestVersion, t.Name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+	return cmd
+}
+
+// describeSource describes where a tool was installed from
+func describeSource(source tool.InstallSource) string {
+	kind := orDefault(string(source.Type), string(tool.SourcePyPI))
+	switch {
+	case source.Metadata[tool.ProfileMetadataKey] != "":
+		return kind + " (profile " + source.Metadata[tool.ProfileMetadataKey] + ")"
+	case source.Path != "":
+		return kind + " " + source.Path
+	case source.URL != "" && source.Type != tool.SourceCargo && source.Type != tool.SourceGem && source.Type != tool.SourceConda && source.Type != tool.SourceNPM:
+		ref := ""
+		for _, r := range []string{source.Tag, source.Branch, source.Commit} {
+			if r != "" {
+				ref = "@" + r
+				break
+			}
+		}
+		return kind + " " + source.URL + ref
+	case source.Metadata["channel"] != "":
+		return kind + " (" + source.Metadata["channel"] + ")"
 	}
+	return kind
+}
 
-	cmd.AddCommand(&cobra.Command{
+func cacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage package cache",
+		Long: `Manage ~/.ophid/cache: downloads, git clones, the conda package cache and
+vendor archives. The [cache] limits of config.toml (max_size, max_age) are
+applied after each install and by ophid cache clean, which keep the clones
+installed tools use; ophid cache gc removes the others.
+
+Files of runtimes, tool venvs and downloads are also kept in ~/.ophid/store
+under their sha256, and identical copies share the stored one: as reflinks
+where the filesystem clones files (btrfs, XFS, APFS), or else as hard links
+(Python sources excepted, whose mtimes must stay their own). [cache]
+dedupe = "reflink" only shares with reflinks and "off" not at all.`,
+	}
+
+	var all bool
+	clean := &cobra.Command{
 		Use:   "clean",
 		Short: "Clean package cache",
+		Long: `Remove cache entries older than the configured max_age, then the oldest
+ones until the cache fits max_size. --all empties the cache. Files of
+~/.ophid/store nothing links to any more are removed too.`,
+		Example: `  ophid cache clean
+  ophid cache clean --all`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			maxSize, maxAge, err := cfg.CacheLimits()
+			if err != nil {
+				return err
+			}
+			if all {
+				// Any entry is larger than a size limit of one byte
+				maxSize, maxAge = 1, 0
+			}
+			if maxSize == 0 && maxAge == 0 {
+				ui.Printf("No cache limits in %s; use --all to empty the cache\n", config.Path(homeDir))
+			} else {
+				removed, freed, err := tool.PruneCache(homeDir, maxSize, maxAge)
+				if err != nil {
+					return err
+				}
+				ui.Success("Removed %d cache item(s) (%s)", removed, formatBytes(freed))
+			}
+
+			// Downloads just removed may have been all that linked to a
+			// stored file
+			removed, freed, err := store.NewStore(homeDir).Prune()
+			if err != nil {
+				return err
+			}
+			if removed > 0 {
+				ui.Success("Removed %d unused stored file(s) (%s)", removed, formatBytes(freed))
+			}
+			return nil
+		},
+	}
+	clean.Flags().BoolVar(&all, "all", false, "Remove everything in the cache")
+	cmd.AddCommand(clean)
+
+	var dryRun bool
+	gc := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove unused git clones and leftover temp dirs",
+		Long: `Remove the git clones in ~/.ophid/cache/git no installed tool uses any
+more, such as those of uninstalled tools or of refs a tool was reinstalled
+from, and the temp dirs and partial downloads interrupted installs and
+runtime extractions left behind. Anything written in the last day is kept,
+in case an install running now is using it. Reinstalling a tool from git
+fetches into its clone instead of cloning again.`,
+		Example: `  ophid cache gc --dry-run
+  ophid cache gc`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			installer, err := tool.NewInstaller(homeDir, tool.NewVenvManager(homeDir, ""))
+			if err != nil {
+				return fmt.Errorf("failed to create installer: %w", err)
+			}
+			result, err := installer.GC(dryRun)
+			if err != nil {
+				return err
+			}
+			verb := "Removed"
+			if dryRun {
+				verb = "Would remove"
+			}
+			for _, path := range append(result.Clones, result.TempDirs...) {
+				ui.Printf("  %s\n", path)
+			}
+			ui.Success("%s %d clone(s) and %d temp dir(s) (%s)", verb, len(result.Clones), len(result.TempDirs), formatBytes(result.Bytes))
+			return nil
+		},
+	}
+	gc.Flags().BoolVar(&dryRun, "dry-run", false, "List what would be removed, without removing it")
+	cmd.AddCommand(gc)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "stats",
+		Short: "Show cache statistics",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stats, err := tool.CacheStats(homeDir)
+			if err != nil {
+				return err
+			}
+			st := store.NewStore(homeDir)
+			usage, err := st.Usage()
+			if err != nil {
+				return err
+			}
+			if len(stats) == 0 {
+				fmt.Println("Cache is empty")
+				if usage.Objects > 0 {
+					fmt.Printf("Store: %d file(s), %s in %s\n", usage.Objects, formatBytes(usage.Bytes), st.Dir())
+				}
+				return nil
+			}
+
+			var total int64
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "CACHE\tENTRIES\tSIZE")
+			for _, stat := range stats {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", stat.Name, stat.Entries, formatBytes(stat.Bytes))
+				total += stat.Bytes
+			}
+			w.Flush()
+			fmt.Printf("\nTotal: %s in %s\n", formatBytes(total), tool.CacheDir(homeDir))
+			if usage.Objects > 0 {
+				fmt.Printf("Store: %d file(s), %s in %s, shared by runtimes, venvs and downloads\n", usage.Objects, formatBytes(usage.Bytes), st.Dir())
+			}
+			if cfg.Cache.MaxSize != "" || cfg.Cache.MaxAge != "" {
+				fmt.Printf("Limits: max_size %s, max_age %s\n", orDefault(cfg.Cache.MaxSize, "none"), orDefault(cfg.Cache.MaxAge, "none"))
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show ophid's configuration",
+		Long: fmt.Sprintf(`Show the configuration ophid runs with: ~/.ophid/config.toml, with the
+defaults for what it leaves out. These environment variables override it:
+  %s
+
+Example config.toml:
+  [python]
+  version = "3.12.1"        # Runtime tools install with
+
+  [index]
+  url = "https://pypi.corp.example/simple"
+
+  [proxy]
+  https = "http://proxy.corp.example:3128"
+  no_proxy = "localhost,.corp.example"
+
+  [tls]
+  ca_files = ["/etc/ssl/corp-ca.pem"]    # Extra root CAs, for ophid and pip, git, cargo
+
+  [download]
+  limit_rate = "2M"         # Bytes per second (--limit-rate)
+
+  [scan]
+  policy = "warn"           # skip, warn or block
+
+  [cache]
+  max_size = "5G"
+  max_age = "30d"
+  dedupe = "auto"           # Share identical files: auto, reflink or off
+
+  [log]
+  level = "info"            # debug, info, warn or error`, strings.Join(config.EnvVars(), "\n  ")),
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Print the configuration in effect",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := cfg.Encode()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("# %s\n%s", config.Path(homeDir), data)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "path",
+		Short: "Print the config file path",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println(config.Path(homeDir))
+		},
+	})
+
+	return cmd
+}
+
+func profileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage isolated ophid profiles",
+		Long: `Profiles are isolated ophid homes under ~/.ophid/profiles, each with its
+own config, manifest, runtimes, tools, shims, cache and daemon, for keeping
+client environments or production and staging toolsets apart on one
+machine. Select one with --profile or OPHID_PROFILE; without either,
+ophid uses the default profile, ~/.ophid itself.
+
+Put a profile's shims in PATH to run its tools directly:
+  export PATH="$HOME/.ophid/profiles/staging/bin:$PATH"`,
+		Example: `  ophid profile create staging
+  ophid --profile staging install ansible
+  OPHID_PROFILE=staging ophid run --background ansible-pull
+  ophid profile remove staging`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the profiles",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names, err := config.Profiles(baseHomeDir)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PROFILE\tHOME")
+			for _, name := range append([]string{config.DefaultProfile}, names...) {
+				home := config.ProfileHome(baseHomeDir, name)
+				if home == homeDir {
+					name += " *"
+				}
+				fmt.Fprintf(w, "%s\t%s\n", name, home)
+			}
+			return w.Flush()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if err := config.ValidateProfile(name); err != nil {
+				return err
+			}
+			if name == config.DefaultProfile {
+				return errcode.Errorf(errcode.Conflict, "the default profile always exists")
+			}
+			home := config.ProfileHome(baseHomeDir, name)
+			if _, err := os.Stat(home); err == nil {
+				return errcode.Errorf(errcode.Conflict, "profile %s already exists", name)
+			}
+			if err := os.MkdirAll(home, 0700); err != nil {
+				return fmt.Errorf("failed to create profile: %w", err)
+			}
+			ui.Success("Created profile %s in %s", name, home)
+			ui.Printf("Use it with: ophid --profile %s <command>\n", name)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "remove <name>",
+		Short: "Delete a profile and everything installed in it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if err := config.ValidateProfile(name); err != nil {
+				return err
+			}
+			if name == config.DefaultProfile {
+				return errcode.Errorf(errcode.Conflict, "the default profile can't be removed")
+			}
+			home := config.ProfileHome(baseHomeDir, name)
+			if _, err := os.Stat(home); err != nil {
+				return errcode.Errorf(errcode.NotFound, "profile %s doesn't exist", name)
+			}
+			// Removing a profile deletes its tools, runtimes and lockdown.toml
+			if err := checkUnlockedIn(home, cmd, args); err != nil {
+				return err
+			}
+			if supervisor.NewClient(supervisor.SocketPath(home)).Ping() == nil {
+				return errcode.Errorf(errcode.Conflict, "the daemon of profile %s is running; stop it with 'ophid --profile %s daemon stop'", name, name)
+			}
+			if err := os.RemoveAll(home); err != nil {
+				return fmt.Errorf("failed to remove profile: %w", err)
+			}
+			ui.Success("Removed profile %s", name)
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// doctorMinFreeDisk is the free space under which doctor warns
+const doctorMinFreeDisk = 1 << 30
+
+func doctorCmd() *cobra.Command {
+	var proxyConfig string
+	var report bool
+	var reportPath string
+	var fix bool
+	var offline bool
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose OPHID issues",
+		Long: `Diagnose OPHID issues. Checks:
+
+  - proxy certificates (from --proxy-config, or the certificate cache and
+    local CA used by quick setup), warning about those that expire within
+    14 days
+  - runtimes: each interpreter starts and reports its installed version
+  - tools: the install directory and executables are there and, for Python
+    tools, the venv's python starts and pip is present, and its packages
+    match the tool's lockfile (~/.ophid/tools/<tool>.lock)
+  - the manifest: executable owners and ~/.ophid/tools agree with it
+  - PATH and shims, tool integrity (see ophid verify) and smoke tests
+    (install --smoke-test, or a profile's), whose results are recorded
+  - cloud CLIs (installed with --profile): the identity each would use, and
+    whether its sandbox hides its credentials or blocks the network;
+    nothing is sent to the cloud
+  - free disk space where ~/.ophid lives
+  - that the package index and OSV can be reached (skipped with --offline)
+
+--fix repairs what it can: it reinstalls broken runtimes, rebuilds the
+venvs of broken PyPI tools at their installed version, puts drifted venvs
+back to their lockfile, resolves stale executable owners, removes tool
+directories no installed tool uses, rewrites out-of-date shims, and
+empties the download cache when disk space is low. Other problems print what to run.
+Under lockdown, --fix needs the override token like other changes.
+
+With --report, also writes a support bundle to attach to bug reports: ophid
+and system versions, installed runtimes and tools, the proxy config (with
+--proxy-config), supervisor state, recent runs and jobs, diagnostics bundle
+names and the checks above. Secret-looking values and URL credentials are
+redacted and the home directory is shown as ~; review the bundle before
+sharing it.`,
+		Example: `  ophid doctor
+  ophid doctor --fix
+  ophid doctor --offline --proxy-config /etc/ophid/proxy.toml
+  ophid doctor --report -o report.tar.gz`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// TODO: Implement
-			fmt.Println("Cleaning cache...")
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
+			if fix {
+				if err := checkUnlocked(cmd, args); err != nil {
+					return err
+				}
+			}
+			ui.Println("Running diagnostics...")
+
+			// Checks are the command's output; the report keeps them undecorated
+			var checks []string
+			check := func(level ui.Level, format string, args ...interface{}) {
+				line := fmt.Sprintf(format, args...)
+				checks = append(checks, level.Plain()+" "+line)
+				ui.Stdout.Status(level, "%s", line)
+			}
+
+			// Repairs run with --fix; otherwise they are counted for the summary
+			fixable, fixed := 0, 0
+			repair := func(what string, n int, apply func() error) {
+				if !fix {
+					fixable += n
+					return
+				}
+				if err := apply(); err != nil {
+					check(ui.LevelError, "Failed to %s: %v", what, err)
+					return
+				}
+				check(ui.LevelOK, "Fixed: %s", what)
+				fixed += n
+			}
+
+			var config *proxy.Config
+			tlsConfigs := []proxy.TLSConfig{
+				{Enabled: true, CacheDir: filepath.Join(homeDir, "certs")},
+				{Enabled: true, ACMEProvider: "local", LocalCADir: filepath.Join(homeDir, "ca")},
+			}
+			if proxyConfig != "" {
+				var err error
+				config, err = proxy.LoadConfig(proxyConfig)
+				if err != nil {
+					return err
+				}
+				tlsConfigs = []proxy.TLSConfig{config.TLS}
+			}
+
+			problems, found := 0, 0
+			fmt.Println("\nCertificates:")
+			for _, tlsConfig := range tlsConfigs {
+				certs, err := proxy.ListCertificates(tlsConfig)
+				if err != nil {
+					check(ui.LevelError, "%v", err)
+					problems++
+					continue
+				}
+				found += len(certs)
+				for _, c := range certs {
+					switch c.Status() {
+					case "expired":
+						check(ui.LevelError, "%s expired on %s", c.Name, c.NotAfter.Format("2006-01-02"))
+						problems++
+					case "expiring":
+						check(ui.LevelWarn, "%s expires in %d days (%s)", c.Name, c.DaysLeft, c.NotAfter.Format("2006-01-02"))
+						problems++
+					default:
+						check(ui.LevelOK, "%s valid for %d days", c.Name, c.DaysLeft)
+					}
+				}
+			}
+
+			if found == 0 && problems == 0 {
+				checks = append(checks, "No certificates found")
+				fmt.Println("No certificates found")
+			}
+
+			// Runtimes start and are the version they are installed as
+			fmt.Println("\nRuntimes:")
+			runtimeMgr := runtime.NewManager(homeDir)
+			if runtimes, err := runtimeMgr.List(); err != nil {
+				check(ui.LevelError, "%v", err)
+				problems++
+			} else if len(runtimes) == 0 {
+				check(ui.LevelWarn, "No runtime installed; install one with: ophid runtime install %s", cfg.Python.Version)
+				problems++
+			} else {
+				working := 0
+				for _, rt := range runtimes {
+					if err := runtimeMgr.Check(rt); err != nil {
+						check(ui.LevelError, "%s %s: %v", rt.Type.DisplayName(), rt.Version, err)
+						problems++
+						repair(fmt.Sprintf("reinstall %s %s", rt.Type.DisplayName(), rt.Version), 1, func() error {
+							_, err := runtimeMgr.Reinstall(rt)
+							return err
+						})
+						continue
+					}
+					working++
+				}
+				if working > 0 {
+					check(ui.LevelOK, "%d runtime(s) working", working)
+				}
+			}
+
+			// Tool files, and the manifest against ~/.ophid/tools. They can be
+			// checked without a runtime, though not rebuilt.
+			installer, _, err := openInstaller()
+			if err != nil {
+				installer, err = tool.NewInstaller(homeDir, tool.NewVenvManager(homeDir, ""))
+			}
+			if err == nil {
+				tools := installer.List()
+				sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+				fmt.Println("\nTools:")
+				working := 0
+				for _, t := range tools {
+					broken := installer.CheckInstall(t)
+					if len(broken) == 0 {
+						working++
+						// Packages added, removed or changed since the tool was locked
+						drift, err := installer.LockDrift(t)
+						if err != nil {
+							check(ui.LevelWarn, "%s: failed to compare with its lockfile: %v", t.Name, err)
+						} else if len(drift) > 0 {
+							problems++
+							check(ui.LevelWarn, "%s has drifted from %s: %s", t.Name, installer.LockPath(t.Name), strings.Join(drift, "; "))
+							name := t.Name
+							repair("restore the locked packages of "+name, 1, func() error { return installer.SyncLock(name) })
+						}
+						continue
+					}
+					problems++
+					if !installer.Rebuildable(t) {
+						check(ui.LevelError, "%s: %s; reinstall it with: ophid install --force", t.Name, strings.Join(broken, "; "))
+						continue
+					}
+					check(ui.LevelError, "%s: %s", t.Name, strings.Join(broken, "; "))
+					name := t.Name
+					repair("rebuild the venv of "+name, 1, func() error { return installer.RebuildVenv(name) })
+				}
+				if working > 0 {
+					check(ui.LevelOK, "%d tool(s) installed correctly", working)
+				} else if len(tools) == 0 {
+					check(ui.LevelOK, "No tools installed")
+				}
+
+				if inconsistent := installer.ManifestProblems(); len(inconsistent) > 0 {
+					for _, problem := range inconsistent {
+						check(ui.LevelWarn, "Manifest: %s", problem)
+					}
+					problems += len(inconsistent)
+					repair("reconcile the manifest", len(inconsistent), installer.RepairManifest)
+				} else {
+					check(ui.LevelOK, "Manifest matches %s", filepath.Join(homeDir, "tools"))
+				}
+			}
+
+			// Installed executables that something earlier in PATH shadows
+			if installer, _, err := openInstaller(); err == nil {
+				if providers := installer.Providers(os.Getenv("PATH")); len(providers) > 0 {
+					fmt.Println("\nPATH:")
+					if shimDir := installer.ShimDir(); !inPath(shimDir, os.Getenv("PATH")) {
+						check(ui.LevelWarn, "%s is not in PATH; add it to run tools without ophid run: export PATH=\"%s:$PATH\"", shimDir, shimDir)
+						problems++
+					} else {
+						check(ui.LevelOK, "%s is in PATH", shimDir)
+					}
+					if stale := installer.StaleShims(); len(stale) > 0 {
+						check(ui.LevelWarn, "%d shim(s) missing or out of date (%s); rewrite them with: ophid shims", len(stale), strings.Join(stale, ", "))
+						problems++
+						repair("rewrite the shims", 1, installer.SyncShims)
+					}
+					conflicts := 0
+					for _, p := range providers {
+						if p.Shadowed() {
+							check(ui.LevelWarn, "%s (from %s) is shadowed by %s", p.Executable, p.Tool, p.ShadowedBy[0])
+							conflicts++
+						}
+					}
+					if conflicts == 0 {
+						check(ui.LevelOK, "No PATH conflicts for %d executable(s)", len(providers))
+					}
+					problems += conflicts
+				}
+			}
+
+			// Installed files that changed since their install
+			if installer, _, err := openInstaller(); err == nil && len(installer.List()) > 0 {
+				fmt.Println("\nIntegrity:")
+				tools := installer.List()
+				sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+				verified, unrecorded := 0, 0
+				for _, t := range tools {
+					if t.Integrity == nil {
+						unrecorded++
+						continue
+					}
+					changed, err := installer.Verify(t.Name)
+					switch {
+					case err != nil:
+						check(ui.LevelError, "%s: %v", t.Name, err)
+						problems++
+					case len(changed) > 0:
+						check(ui.LevelError, "%s: %d file(s) not as installed; see ophid verify %s", t.Name, len(changed), t.Name)
+						problems++
+					default:
+						verified++
+					}
+				}
+				if verified > 0 {
+					check(ui.LevelOK, "%d tool(s) as installed", verified)
+				}
+				if unrecorded > 0 {
+					check(ui.LevelWarn, "%d tool(s) have no integrity record; record them with: ophid verify --update", unrecorded)
+					problems++
+				}
+			}
+
+			// Smoke tests recorded at install, run again
+			if installer, _, err := openInstaller(); err == nil {
+				tools := installer.List()
+				sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+				printed := false
+				for _, t := range tools {
+					if t.SmokeTest == nil {
+						continue
+					}
+					if !printed {
+						fmt.Println("\nSmoke tests:")
+						printed = true
+					}
+					result, err := installer.SmokeTest(cmd.Context(), t.Name)
+					switch {
+					case result != nil && !result.Passed:
+						check(ui.LevelError, "%s: %s failed: %s", t.Name, result, truncate(result.Output[strings.LastIndex(result.Output, "\n")+1:], 100))
+						problems++
+					case err != nil:
+						check(ui.LevelError, "%s: %v", t.Name, err)
+						problems++
+					default:
+						check(ui.LevelOK, "%s: %s passed", t.Name, result)
+					}
+				}
+			}
+
+			// Credentials of cloud CLIs, and whether their sandbox lets them through
+			if installer, _, err := openInstaller(); err == nil {
+				userHome, _ := os.UserHomeDir()
+				printed := false
+				for _, t := range installer.List() {
+					p, ok := tool.ProfileOf(t)
+					if !ok {
+						continue
+					}
+					if !printed {
+						fmt.Println("\nCloud credentials:")
+						printed = true
+					}
+
+					creds, err := tool.DetectCredentials(p.Provider, os.Getenv, userHome)
+					switch {
+					case err != nil:
+						check(ui.LevelError, "%s: %v", t.Name, err)
+						problems++
+					case creds == nil:
+						check(ui.LevelWarn, "%s: no credentials found; run: ophid run %s", t.Name, p.Login)
+						problems++
+					default:
+						check(ui.LevelOK, "%s would use %s, from %s", t.Name, creds.Identity, creds.Source)
+					}
+					for _, problem := range tool.SandboxProblems(t.Sandbox, creds, userHome) {
+						check(ui.LevelWarn, "%s: %s; see ophid sandbox show %s", t.Name, problem, t.Name)
+						problems++
+					}
+				}
+			}
+
+			// Room for installs, downloads and logs
+			if free, total, err := support.DiskSpace(homeDir); !errors.Is(err, errors.ErrUnsupported) && !errors.Is(err, os.ErrNotExist) {
+				fmt.Println("\nDisk:")
+				switch {
+				case err != nil:
+					check(ui.LevelWarn, "Failed to check free space: %v", err)
+				case free < doctorMinFreeDisk:
+					var cached int64
+					if stats, err := tool.CacheStats(homeDir); err == nil {
+						for _, stat := range stats {
+							cached += stat.Bytes
+						}
+					}
+					check(ui.LevelWarn, "Only %s free of %s for %s; the cache holds %s (empty it with: ophid cache clean --all)",
+						formatBytes(int64(free)), formatBytes(int64(total)), homeDir, formatBytes(cached))
+					problems++
+					if cached > 0 {
+						repair("empty the cache", 1, func() error {
+							_, _, err := tool.PruneCache(homeDir, 1, 0)
+							return err
+						})
+					}
+				default:
+					check(ui.LevelOK, "%s free of %s", formatBytes(int64(free)), formatBytes(int64(total)))
+				}
+			}
+
+			// Services installs and scans need
+			if !offline {
+				fmt.Println("\nNetwork:")
+				if files := cfg.CAFiles(); len(files) > 0 {
+					check(ui.LevelOK, "Trusting the CAs in %s besides the system's", strings.Join(files, ", "))
+					check(ui.LevelOK, "Tools ophid runs trust them through %s", cfg.CABundlePath(homeDir))
+				}
+				index := "https://pypi.org/simple/"
+				if cfg.Index.URL != "" {
+					index = cfg.Index.URL
+				}
+				for _, service := range []struct{ name, url string }{
+					{"Package index", index},
+					{"OSV vulnerability database", "https://api.osv.dev/v1/query"},
+				} {
+					shown := service.url
+					if u, err := url.Parse(service.url); err == nil {
+						shown = u.Redacted()
+						if proxyURL, _ := http.ProxyFromEnvironment(&http.Request{URL: u}); proxyURL != nil {
+							shown += " through " + proxyURL.Redacted()
+						}
+					}
+					elapsed, err := support.Reachable(cmd.Context(), service.url)
+					if err != nil {
+						check(ui.LevelError, "%s (%s) unreachable: %v", service.name, shown, err)
+						problems++
+						continue
+					}
+					check(ui.LevelOK, "%s (%s) answered in %s", service.name, shown, elapsed.Round(time.Millisecond))
+				}
+			}
+
+			fmt.Println()
+			problems -= fixed
+			switch {
+			case problems > 0 && fixable > 0:
+				ui.Stdout.Warn("%d problem(s) found; %d can be fixed with: ophid doctor --fix", problems, fixable)
+			case problems > 0:
+				ui.Stdout.Warn("%d problem(s) found", problems)
+			case fixed > 0:
+				ui.Stdout.OK("Fixed %d problem(s)", fixed)
+			default:
+				ui.Stdout.OK("No problems found")
+			}
+
+			if !report {
+				return nil
+			}
+			if reportPath == "" {
+				reportPath = fmt.Sprintf("ophid-report-%s.tar.gz", time.Now().Format("20060102-150405"))
+			}
+			names, err := writeDoctorReport(reportPath, checks, config)
+			if err != nil {
+				return err
+			}
+			ui.Println()
+			ui.Success("Report written to %s (%s)", reportPath, strings.Join(names, ", "))
+			ui.Println("Review it before attaching it to an issue: only recognised secrets are redacted.")
 			return nil
 		},
-	})
+	}
 
-	cmd.AddCommand(&cobra.Command{
-		Use:   "stats",
-		Short: "Show cache statistics",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// TODO: Implement
-			fmt.Println("Cache statistics:")
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
-			return nil
-		},
-	})
+	cmd.Flags().StringVar(&proxyConfig, "proxy-config", "", "Proxy config whose certificates to check")
+	cmd.Flags().BoolVar(&report, "report", false, "Write a sanitized support bundle for bug reports")
+	cmd.Flags().StringVarP(&reportPath, "output", "o", "", "Report path (default ophid-report-<time>.tar.gz)")
+	cmd.Flags().BoolVar(&fix, "fix", false, "Repair the problems found that can be repaired")
+	cmd.Flags().BoolVar(&offline, "offline", false, "Skip the network checks")
 
 	return cmd
 }
 
-func doctorCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "doctor",
-		Short: "Diagnose OPHID issues",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// TODO: Implement
-			fmt.Println("Running diagnostics...")
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
-			return nil
-		},
+// writeDoctorReport writes a sanitized support bundle and returns the names
+// of the files in it. Missing sources are skipped.
+func writeDoctorReport(path string, checks []string, proxyConfig *proxy.Config) ([]string, error) {
+	userHome, _ := os.UserHomeDir()
+	sanitizer := support.NewSanitizer(userHome)
+	bundle := support.NewBundle()
+
+	addJSON := func(name string, v any) {
+		data, err := sanitizer.JSON(v)
+		if err != nil {
+			ui.Warn("skipping %s: %v", name, err)
+			return
+		}
+		bundle.Add(name, data)
+	}
+	readFile := func(parts ...string) ([]byte, bool) {
+		data, err := os.ReadFile(filepath.Join(append([]string{homeDir}, parts...)...))
+		return data, err == nil
+	}
+
+	addJSON("versions.json", map[string]string{"ophid": version, "go": goruntime.Version(), "os": goruntime.GOOS, "arch": goruntime.GOARCH})
+	addJSON("system.json", support.SystemInfo(time.Now()))
+
+	if runtimes, err := runtime.NewManager(homeDir).List(); err == nil {
+		addJSON("runtimes.json", runtimes)
+	}
+	if data, ok := readFile("tools", "manifest.json"); ok {
+		var manifest any
+		if json.Unmarshal(data, &manifest) == nil {
+			addJSON("manifest.json", manifest)
+		}
+	}
+	if proxyConfig != nil {
+		addJSON("proxy-config.json", proxyConfig)
+	}
+	if states, err := supervisor.LoadState(filepath.Join(homeDir, "supervisor", "state.json")); err == nil {
+		addJSON("supervisor-state.json", states)
+	}
+
+	// Recent runs and jobs, newest last
+	if data, ok := readFile("history", "runs.jsonl"); ok {
+		bundle.Add("history.jsonl", sanitizer.JSONLines(data, 100))
+	}
+	if data, ok := readFile("jobs", "results.jsonl"); ok {
+		bundle.Add("jobs.jsonl", sanitizer.JSONLines(data, 100))
+	}
+	if entries, err := os.ReadDir(filepath.Join(homeDir, "diagnostics")); err == nil {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		bundle.Add("diagnostics.txt", []byte(strings.Join(names, "\n")+"\n"))
+	}
+
+	bundle.Add("checks.txt", []byte(sanitizer.String(strings.Join(checks, "\n"))+"\n"))
+
+	if err := bundle.Write(path, time.Now()); err != nil {
+		return nil, err
 	}
+	return bundle.Names(), nil
 }
 
 func scanCmd() *cobra.Command {
@@ -458,18 +5885,91 @@ func scanCmd() *cobra.Command {
 	cmd.AddCommand(scanLicenseCmd())
 	cmd.AddCommand(scanSBOMCmd())
 	cmd.AddCommand(scanSecretsCmd())
+	cmd.AddCommand(scanChangedCmd())
+	cmd.AddCommand(scanInstallHookCmd())
+	cmd.AddCommand(scanPolicyCmd())
 
 	return cmd
 }
 
+func scanPolicyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "policy",
+		Short: "Show the security policy installs and scans are checked against",
+		Long: `Show the security policy in ~/.ophid/policy.yaml, which installs, upgrades
+and ophid scan vuln are checked against. In block mode violations refuse
+the install or fail the scan; in warn mode (the default) they are
+warnings. The block scan policy (--require-scan) makes any policy block.
+
+  mode: block                  # warn or block
+  max_severity: high           # none, low, medium, high or critical
+  banned_licenses: ["AGPL-*", "SSPL-1.0"]
+  banned_packages: ["*-nightly", "colourama"]
+  min_package_age: 7d          # Refuse releases younger than this
+  sources:                     # Per source type: pypi, git, github, local, npm, ...
+    github:
+      allow: ["github.com/myorg/*"]
+    local:
+      deny: ["*"]
+
+Patterns are globs; a source type with an allow list denies what isn't in
+it. Git sources are matched without scheme, like github.com/org/tool.
+
+Rules are CEL expressions for what the thresholds can't express. A deny
+rule that holds is a violation; an allow rule that holds exempts the
+release from the severity, license, age and scan thresholds (not from
+banned packages or the source lists, checked before download):
+
+  rules:
+    - name: internal-tools
+      allow: source.type == "github" && source.location.startsWith("github.com/myorg/")
+    - name: no-fresh-releases-after-hours
+      deny: has(pkg.age) && pkg.age < duration("336h") && now.getHours("Local") >= 18
+      message: releases younger than two weeks are installed in office hours
+
+Rules see pkg (name, version, licenses, and when known released and age),
+scan (failed, vulnerabilities, severity, level from 0 to 4), source (type,
+location) and now. A deny rule that fails to evaluate is a violation.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := policy.Load(homeDir)
+			if err != nil {
+				return err
+			}
+			if p == nil {
+				ui.Printf("No security policy (%s)\n", policy.Path(homeDir))
+				ui.Printf("Installs warn about vulnerabilities; --require-scan refuses critical ones.\n")
+				return nil
+			}
+			data, err := yaml.Marshal(p)
+			if err != nil {
+				return fmt.Errorf("failed to encode policy: %w", err)
+			}
+			ui.Printf("# %s\n", policy.Path(homeDir))
+			fmt.Print(string(data))
+			return nil
+		},
+	}
+}
+
 func scanVulnCmd() *cobra.Command {
-	var outputFormat string
+	var outputFormat, diffRef string
 
 	cmd := &cobra.Command{
 		Use:   "vuln [file|directory]",
 		Short: "Scan for vulnerabilities",
-		Long:  "Scan dependency files or directories for known vulnerabilities using OSV.dev",
-		Args:  cobra.ExactArgs(1),
+		Long: `Scan dependency files or directories for known vulnerabilities using OSV.dev
+
+With --diff, only dependency files changed since a git ref are scanned, and
+only for the packages they add or change, e.g. --diff origin/main in pull
+request jobs. Without it, every package is scanned.
+
+Packages are also checked against the security policy (see ophid scan
+policy); a blocking one fails the scan on its violations.`,
+		Example: `  ophid scan vuln requirements.txt
+  ophid scan vuln . --format json
+  ophid scan vuln . --diff origin/main --format github`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true, // Findings aren't usage errors
 		RunE: func(cmd *cobra.Command, args []string) error {
 			path := args[0]
 
@@ -480,59 +5980,60 @@ func scanVulnCmd() *cobra.Command {
 			}
 
 			var filesToScan []string
-
-			if fileInfo.IsDir() {
-				// DIRECTORY SCANNING
-				fmt.Printf("Scanning directory: %s\n", path)
-
-				// Find all dependency files
-				err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-					if err != nil || info.IsDir() {
-						return nil
-					}
-
-					base := filepath.Base(filePath)
-					if base == "requirements.txt" || base == "go.mod" || base == "package.json" {
-						filesToScan = append(filesToScan, filePath)
-					}
-					return nil
-				})
-				if err != nil {
-					return fmt.Errorf("failed to walk directory: %w", err)
+			var since *diffScope
+			if diffRef != "" {
+				if since, err = changesSince(cmd.Context(), path, diffRef); err != nil {
+					return err
 				}
-
-				if len(filesToScan) == 0 {
-					return fmt.Errorf("no dependency files found in directory")
+				for _, change := range since.changes {
+					if !change.Deleted && isDependencyFile(change.Path) {
+						filesToScan = append(filesToScan, change.Path)
+					}
 				}
-
-				fmt.Printf("Found %d dependency file(s)\n", len(filesToScan))
+				ui.Printf("%d dependency file(s) changed since %s\n", len(filesToScan), diffRef)
 			} else {
-				// SINGLE FILE SCANNING
-				filesToScan = []string{path}
+				if fileInfo.IsDir() {
+					ui.Printf("Scanning directory: %s\n", path)
+				}
+				if filesToScan, err = dependencyFiles(path); err != nil {
+					return err
+				}
+				if fileInfo.IsDir() {
+					ui.Printf("Found %d dependency file(s)\n", len(filesToScan))
+				}
 			}
 
 			// Scan each file
 			scanner := security.NewScanner()
 			ctx := context.Background()
 			allResults := []security.ScanResult{}
+			var annotations []ci.Annotation
 
 			for _, file := range filesToScan {
 				if len(filesToScan) > 1 {
-					fmt.Printf("\n=== Scanning %s ===\n", file)
+					ui.Printf("\n=== Scanning %s ===\n", file)
 				}
 
 				packages, err := parseDependencyFile(file)
 				if err != nil {
-					fmt.Printf("[WARN] failed to parse %s: %v\n", file, err)
+					ui.Warn("failed to parse %s: %v", file, err)
 					continue
 				}
+				if since != nil {
+					// Only what the change brings in
+					var before []security.Package
+					if old, err := githook.Show(ctx, since.top, since.base, since.files[file]); err == nil {
+						before, _ = parseDependencyData(file, old)
+					}
+					packages = security.NewPackages(before, packages)
+				}
 
 				if len(packages) == 0 {
-					fmt.Printf("No packages found in %s\n", file)
+					ui.Printf("No packages found in %s\n", file)
 					continue
 				}
 
-				fmt.Printf("Scanning %d packages for vulnerabilities...\n", len(packages))
+				ui.Printf("Scanning %d packages for vulnerabilities...\n", len(packages))
 
 				results, err := scanner.ScanPackages(ctx, packages)
 				if err != nil {
@@ -540,14 +6041,25 @@ func scanVulnCmd() *cobra.Command {
 				}
 
 				allResults = append(allResults, results...)
+				data, _ := os.ReadFile(file)
+				annotations = append(annotations, vulnAnnotations(file, data, results)...)
+			}
+
+			if annotationFormat(outputFormat) {
+				return printAnnotations(outputFormat, annotations, "vulnerabilities")
 			}
 
 			// Display aggregated results
-			return displayVulnResults(allResults, outputFormat)
+			err = displayVulnResults(allResults, outputFormat)
+			if policyErr := checkScanPolicy(allResults, outputFormat); policyErr != nil {
+				return policyErr
+			}
+			return err
 		},
 	}
 
-	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format (text|json)")
+	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format (text|json, or github|compact annotations for CI)")
+	cmd.Flags().StringVar(&diffRef, "diff", "", "Only scan dependency changes since this git ref")
 	return cmd
 }
 
@@ -572,7 +6084,7 @@ func scanLicenseCmd() *cobra.Command {
 				return nil
 			}
 
-			fmt.Printf("Checking licenses for %d packages...\n\n", len(packages))
+			ui.Printf("Checking licenses for %d packages...\n\n", len(packages))
 
 			// Create license checker
 			allowedTypes := []security.LicenseType{security.LicensePermissive}
@@ -611,10 +6123,11 @@ func scanSBOMCmd() *cobra.Command {
 				return nil
 			}
 
-			fmt.Printf("Generating SBOM for %d packages...\n", len(packages))
+			ui.Printf("Generating SBOM for %d packages...\n", len(packages))
 
 			// Generate SBOM
-			sbom, err := security.GenerateSBOM(packages, "ophid")
+			tool.ResolveLicenses(cmd.Context(), homeDir, packages)
+			sbom, err := security.GenerateSBOM(packages, sbomProject(filePath))
 			if err != nil {
 				return fmt.Errorf("failed to generate SBOM: %w", err)
 			}
@@ -629,9 +6142,9 @@ func scanSBOMCmd() *cobra.Command {
 				return fmt.Errorf("failed to write SBOM: %w", err)
 			}
 
-			fmt.Printf("SBOM written to %s\n", outputPath)
-			fmt.Printf("  Format: CycloneDX 1.4\n")
-			fmt.Printf("  Components: %d\n", len(sbom.Components))
+			ui.Success("SBOM written to %s", outputPath)
+			ui.Printf("  Format: CycloneDX 1.4\n")
+			ui.Printf("  Components: %d\n", len(sbom.Components))
 
 			return nil
 		},
@@ -641,18 +6154,32 @@ func scanSBOMCmd() *cobra.Command {
 	return cmd
 }
 
+// sbomProject describes the project a dependency file belongs to, named
+// after its directory, as the subject of its SBOM
+func sbomProject(filePath string) security.Package {
+	dir, err := filepath.Abs(filepath.Dir(filePath))
+	if err != nil {
+		dir = filepath.Dir(filePath)
+	}
+	return security.Package{Name: filepath.Base(dir)}
+}
+
 func scanSecretsCmd() *cobra.Command {
-	var outputFormat string
+	var outputFormat, diffRef string
 
 	cmd := &cobra.Command{
 		Use:   "secrets [file|directory]",
 		Short: "Scan for secrets and credentials",
-		Long:  "Scan files or directories for hardcoded secrets, API keys, and credentials using Gitleaks",
-		Args:  cobra.ExactArgs(1),
+		Long: `Scan files or directories for hardcoded secrets, API keys, and credentials using Gitleaks
+
+With --diff, only the lines added since a git ref are scanned, e.g.
+--diff origin/main in pull request jobs. Without it, every file is scanned.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true, // Findings aren't usage errors
 		RunE: func(cmd *cobra.Command, args []string) error {
 			path := args[0]
 
-			fmt.Printf("Scanning for secrets: %s\n", path)
+			ui.Printf("Scanning for secrets: %s\n", path)
 
 			// Initialize scanner
 			secretScanner, err := security.NewGitLeaksScanner()
@@ -661,58 +6188,453 @@ func scanSecretsCmd() *cobra.Command {
 			}
 
 			// Scan path
-			report, err := secretScanner.Scan(context.Background(), path)
+			var report *security.SecretsReport
+			if diffRef != "" {
+				report, err = secretsSince(cmd.Context(), secretScanner, path, diffRef)
+			} else {
+				report, err = secretScanner.Scan(context.Background(), path)
+			}
 			if err != nil {
 				return fmt.Errorf("scan failed: %w", err)
 			}
 
+			if annotationFormat(outputFormat) {
+				var annotations []ci.Annotation
+				for _, f := range report.Findings {
+					level := ci.LevelWarning
+					if f.Severity == "critical" {
+						level = ci.LevelError
+					}
+					annotations = append(annotations, ci.Annotation{Level: level, File: f.File, Line: f.Line, Title: f.Type,
+						Message: fmt.Sprintf("%s (%s severity): %s", f.Description, f.Severity, security.RedactSecret(f.Secret))})
+				}
+				return printAnnotations(outputFormat, annotations, "secrets")
+			}
+
+			if outputFormat == "json" {
+				// JSON output, with nothing else on stdout
+				data, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+
 			// Display results
 			fmt.Printf("\n=== Secret Scan Results ===\n")
 			fmt.Printf("Files scanned: %d\n", report.FilesScanned)
 			fmt.Printf("Secrets found: %d\n", report.TotalSecrets)
 			fmt.Printf("Critical secrets: %d\n", report.CriticalSecrets)
+			fmt.Println()
 
 			if !report.HasSecrets() {
-				fmt.Println("\n[OK] No secrets detected")
+				ui.Stdout.OK("No secrets detected")
 				return nil
 			}
 
-			fmt.Println("\n[WARN] ALERT: Secrets detected!")
+			ui.Stdout.Warn("ALERT: Secrets detected!")
+			for i, finding := range report.Findings {
+				fmt.Printf("\nSecret %d:\n", i+1)
+				fmt.Printf("  Severity: %s\n", finding.Severity)
+				fmt.Printf("  Type: %s\n", finding.Type)
+				fmt.Printf("  Description: %s\n", finding.Description)
+				fmt.Printf("  File: %s (line %d)\n", finding.File, finding.Line)
+				fmt.Printf("  Secret: %s\n", security.RedactSecret(finding.Secret))
+				if finding.Entropy != 0 {
+					fmt.Printf("  Entropy: %.2f\n", finding.Entropy)
+				}
+			}
 
-			if outputFormat == "json" {
-				// JSON output
-				data, err := json.MarshalIndent(report, "", "  ")
+			fmt.Println()
+			ui.Stdout.Warn("CRITICAL: Review and rotate any exposed secrets immediately")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format (text|json, or github|compact annotations for CI)")
+	cmd.Flags().StringVar(&diffRef, "diff", "", "Only scan lines added since this git ref")
+	return cmd
+}
+
+// secretsSince scans the lines added under path since a git ref
+func secretsSince(ctx context.Context, scanner *security.GitLeaksScanner, path, ref string) (*security.SecretsReport, error) {
+	since, err := changesSince(ctx, path, ref)
+	if err != nil {
+		return nil, err
+	}
+	report := &security.SecretsReport{Path: path, ScanDate: time.Now(), Findings: []security.SecretFinding{}}
+	for _, change := range since.changes {
+		if !change.Deleted {
+			report.FilesScanned++
+		}
+	}
+	report.Findings = append(report.Findings, scanner.ScanChanges(ctx, since.changes)...)
+	report.TotalSecrets = len(report.Findings)
+	for _, finding := range report.Findings {
+		if finding.Severity == "critical" {
+			report.CriticalSecrets++
+		}
+	}
+	return report, nil
+}
+
+func scanChangedCmd() *cobra.Command {
+	var staged, prePush, strict bool
+	var rangeSpec, outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "changed",
+		Short: "Scan only what a commit or push changes",
+		Long: `Scan the lines a git diff adds for secrets, and the packages it adds to
+requirements.txt, go.mod and package.json for vulnerabilities. Unchanged code
+and dependencies aren't scanned again, which keeps commits fast.
+
+By default the staged changes are scanned, as the pre-commit hook does.
+--pre-push reads the refs git passes a pre-push hook on stdin, and --range
+scans commits, e.g. --range origin/main..HEAD in a pull request job.
+Vulnerability lookups that fail, e.g. offline, only warn unless --strict.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true, // Findings aren't usage errors
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if outputFormat != ci.AnnotateCompact && outputFormat != ci.AnnotateGitHub {
+				return fmt.Errorf("unknown format %q (compact|github)", outputFormat)
+			}
+			ctx := cmd.Context()
+			top, err := githook.TopLevel(ctx, ".")
+			if err != nil {
+				return err
+			}
+
+			// Each diff, with the revisions of its old and new files
+			type diff struct {
+				changes       []security.Change
+				before, after string
+			}
+			var diffs []diff
+			switch {
+			case prePush:
+				ranges, err := githook.PushRanges(ctx, top, os.Stdin)
 				if err != nil {
-					return fmt.Errorf("failed to marshal JSON: %w", err)
+					return err
 				}
-				fmt.Println(string(data))
-			} else {
-				// Text output
-				for i, finding := range report.Findings {
-					fmt.Printf("\nSecret %d:\n", i+1)
-					fmt.Printf("  Severity: %s\n", finding.Severity)
-					fmt.Printf("  Type: %s\n", finding.Type)
-					fmt.Printf("  Description: %s\n", finding.Description)
-					fmt.Printf("  File: %s (line %d)\n", finding.File, finding.Line)
-					fmt.Printf("  Secret: %s\n", security.RedactSecret(finding.Secret))
-					if finding.Entropy != 0 {
-						fmt.Printf("  Entropy: %.2f\n", finding.Entropy)
+				for _, r := range ranges {
+					changes, err := githook.RangeChanges(ctx, top, r)
+					if err != nil {
+						return err
+					}
+					diffs = append(diffs, diff{changes, r.Base, r.Head})
+				}
+			case rangeSpec != "":
+				base, head, ok := strings.Cut(rangeSpec, "..")
+				if !ok || base == "" {
+					return fmt.Errorf("--range takes BASE..HEAD, got %q", rangeSpec)
+				}
+				if head == "" {
+					head = "HEAD"
+				}
+				r := githook.Range{Base: base, Head: head}
+				changes, err := githook.RangeChanges(ctx, top, r)
+				if err != nil {
+					return err
+				}
+				diffs = append(diffs, diff{changes, r.Base, r.Head})
+			default:
+				changes, err := githook.StagedChanges(ctx, top)
+				if err != nil {
+					return err
+				}
+				// The index is the "" revision
+				diffs = append(diffs, diff{changes, "HEAD", ""})
+			}
+
+			secretScanner, err := security.NewGitLeaksScanner()
+			if err != nil {
+				return fmt.Errorf("failed to initialize scanner: %w", err)
+			}
+			vulnScanner := security.NewScanner()
+
+			files := 0
+			failedLookups := 0
+			var annotations []ci.Annotation
+			for _, d := range diffs {
+				files += len(d.changes)
+				for _, f := range secretScanner.ScanChanges(ctx, d.changes) {
+					annotations = append(annotations, ci.Annotation{Level: ci.LevelError, File: f.File, Line: f.Line, Title: f.Type,
+						Message: fmt.Sprintf("%s (%s severity): %s", f.Description, f.Severity, security.RedactSecret(f.Secret))})
+				}
+
+				for _, change := range d.changes {
+					if change.Deleted || !isDependencyFile(change.Path) {
+						continue
 					}
+					data, err := githook.Show(ctx, top, d.after, change.Path)
+					if err != nil {
+						return err
+					}
+					after, err := parseDependencyData(change.Path, data)
+					if err != nil {
+						ui.Warn("failed to parse %s: %v", change.Path, err)
+						continue
+					}
+					var before []security.Package
+					if old, err := githook.Show(ctx, top, d.before, change.Path); err == nil {
+						before, _ = parseDependencyData(change.Path, old)
+					}
+					added := security.NewPackages(before, after)
+					if len(added) == 0 {
+						continue
+					}
+
+					ui.Printf("Checking %d new package(s) of %s for vulnerabilities...\n", len(added), change.Path)
+					results, err := vulnScanner.ScanPackages(ctx, added)
+					if err != nil {
+						return fmt.Errorf("scan failed for %s: %w", change.Path, err)
+					}
+					for _, r := range results {
+						if r.Error != "" {
+							ui.Warn("couldn't check %s@%s: %s", r.Package.Name, r.Package.Version, r.Error)
+							failedLookups++
+						}
+					}
+					annotations = append(annotations, vulnAnnotations(change.Path, data, results)...)
 				}
+			}
 
-				fmt.Println("\n[WARN] CRITICAL: Review and rotate any exposed secrets immediately")
+			for _, a := range annotations {
+				fmt.Println(a.Format(outputFormat))
+			}
+			if len(annotations) > 0 {
+				ui.Error("secrets or vulnerable dependencies in the changes; fix them, or skip the check with --no-verify")
+				return fmt.Errorf("%d problem(s) found", len(annotations))
+			}
+			if failedLookups > 0 && strict {
+				return errcode.Errorf(errcode.Network, "%d package(s) couldn't be checked for vulnerabilities", failedLookups)
+			}
+			ui.OK("No secrets or vulnerable dependencies in %d changed file(s)", files)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&staged, "staged", false, "Scan the changes staged for commit (default)")
+	cmd.Flags().BoolVar(&prePush, "pre-push", false, "Scan the commits of a push, reading the pre-push hook's stdin")
+	cmd.Flags().StringVar(&rangeSpec, "range", "", "Scan the commits of BASE..HEAD")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail when vulnerability lookups fail")
+	cmd.Flags().StringVar(&outputFormat, "format", ci.AnnotateCompact, "Output format (compact|github)")
+	cmd.MarkFlagsMutuallyExclusive("staged", "pre-push", "range")
+	return cmd
+}
+
+func scanInstallHookCmd() *cobra.Command {
+	var prePush, framework, force bool
+
+	cmd := &cobra.Command{
+		Use:   "install-hook",
+		Short: "Install a git hook that scans each commit",
+		Long: `Install a git hook running 'ophid scan changed', so secrets and vulnerable
+dependencies are caught before they are committed, or pushed with --pre-push.
+
+--framework adds the scan to the repository's .pre-commit-config.yaml
+instead, for projects managing hooks with pre-commit (pre-commit.com).`,
+		Example: `  ophid scan install-hook
+  ophid scan install-hook --pre-push
+  ophid scan install-hook --framework && pre-commit install`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true, // An existing hook isn't a usage error
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if framework {
+				top, err := githook.TopLevel(ctx, ".")
+				if err != nil {
+					return err
+				}
+				path := filepath.Join(top, githook.FrameworkConfig)
+				added, err := githook.AddFrameworkHook(path)
+				if err != nil {
+					return err
+				}
+				if !added {
+					ui.OK("%s already runs the %s hook", path, githook.FrameworkHookID)
+					return nil
+				}
+				ui.Success("Added the %s hook to %s", githook.FrameworkHookID, path)
+				ui.Printf("Run 'pre-commit install' to enable it\n")
+				return nil
 			}
 
+			hook := githook.PreCommit
+			if prePush {
+				hook = githook.PrePush
+			}
+			hooksDir, err := githook.HooksDir(ctx, ".")
+			if err != nil {
+				return err
+			}
+			path, err := githook.Install(hooksDir, hook, force)
+			if err != nil {
+				return err
+			}
+			ui.Success("Installed the %s hook: %s", hook, path)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format (text|json)")
+	cmd.Flags().BoolVar(&prePush, "pre-push", false, "Scan on push instead of on commit")
+	cmd.Flags().BoolVar(&framework, "framework", false, "Add the scan to .pre-commit-config.yaml instead of writing a hook")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace an existing hook ophid didn't write")
+	cmd.MarkFlagsMutuallyExclusive("framework", "pre-push")
+	cmd.MarkFlagsMutuallyExclusive("framework", "force")
 	return cmd
 }
 
 // Helper functions
 
+// annotationFormat reports whether a scan --format prints CI annotations
+func annotationFormat(format string) bool {
+	return format == ci.AnnotateGitHub || format == ci.AnnotateCompact
+}
+
+// printAnnotations prints scan findings as CI annotations, one per line,
+// and fails when there are any
+func printAnnotations(format string, annotations []ci.Annotation, what string) error {
+	for _, a := range annotations {
+		fmt.Println(a.Format(format))
+	}
+	if len(annotations) > 0 {
+		return fmt.Errorf("%d %s found", len(annotations), what)
+	}
+	return nil
+}
+
+// vulnAnnotations turns the vulnerabilities of a dependency file's
+// packages into annotations on the lines that declare them
+func vulnAnnotations(file string, data []byte, results []security.ScanResult) []ci.Annotation {
+	lines := strings.Split(string(data), "\n")
+	var annotations []ci.Annotation
+	for _, r := range results {
+		line := 0
+		for n, text := range lines {
+			if strings.Contains(strings.ToLower(text), strings.ToLower(r.Package.Name)) {
+				line = n + 1
+				break
+			}
+		}
+		for _, vuln := range r.Vulnerabilities {
+			level := ci.LevelWarning
+			if _, severity, ok := vuln.Rating(); !ok || severity >= security.SeverityHigh {
+				level = ci.LevelError
+			}
+			annotations = append(annotations, ci.Annotation{Level: level, File: file, Line: line,
+				Title: vuln.ID, Message: fmt.Sprintf("%s@%s: %s", r.Package.Name, r.Package.Version, vuln.Summary)})
+		}
+	}
+	return annotations
+}
+
+// dependencyFiles returns path if it is a file, or the dependency files
+// under it if it is a directory
+func dependencyFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access path: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+
+		if isDependencyFile(filePath) {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no dependency files found in directory")
+	}
+	return files, nil
+}
+
+// diffScope is what a scan with --diff covers: the changes under the
+// scanned path since where the work tree left a ref
+type diffScope struct {
+	top     string            // Root of the work tree
+	base    string            // Commit the changes are relative to
+	changes []security.Change // With paths as the scan reports them
+	files   map[string]string // Reported path of each change -> path in the repo
+}
+
+// changesSince returns the changes under path since ref. Their paths are
+// relative to the working directory when it holds them.
+func changesSince(ctx context.Context, path, ref string) (*diffScope, error) {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access path: %w", err)
+	}
+	// git reports the real path of the work tree
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, fmt.Errorf("failed to access path: %w", err)
+	}
+	dir := root
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		dir = filepath.Dir(root)
+	}
+	top, err := githook.TopLevel(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("--diff needs a git work tree: %w", err)
+	}
+	changes, base, err := githook.ChangesSince(ctx, top, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	cwd, _ := os.Getwd()
+	cwd, _ = filepath.EvalSymlinks(cwd)
+	scope := &diffScope{top: top, base: base, files: make(map[string]string)}
+	for _, change := range changes {
+		full := filepath.Join(top, filepath.FromSlash(change.Path))
+		if rel, err := filepath.Rel(root, full); err != nil || !(rel == "." || filepath.IsLocal(rel)) {
+			continue
+		}
+		local := full
+		if rel, err := filepath.Rel(cwd, full); err == nil && filepath.IsLocal(rel) {
+			local = rel
+		}
+		scope.files[local] = change.Path
+		change.Path = local
+		scope.changes = append(scope.changes, change)
+	}
+	return scope, nil
+}
+
+// isDependencyFile reports whether scans read packages from a file
+func isDependencyFile(path string) bool {
+	base := filepath.Base(path)
+	return base == "requirements.txt" || base == "go.mod" || base == "package.json"
+}
+
+// parseDependencyData parses the contents of a dependency file, such as
+// a version of it from git, by the file's name
+func parseDependencyData(path string, data []byte) ([]security.Package, error) {
+	dir, err := os.MkdirTemp("", "ophid-deps-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return parseDependencyFile(tmp)
+}
+
 func parseDependencyFile(filePath string) ([]security.Package, error) {
 	if strings.HasSuffix(filePath, "requirements.txt") {
 		return security.ParseRequirementsTxt(filePath)
@@ -724,55 +6646,150 @@ func parseDependencyFile(filePath string) ([]security.Package, error) {
 	return nil, fmt.Errorf("unsupported file type: %s (supported: requirements.txt, go.mod, package.json)", filePath)
 }
 
+// vulnReport is a scanned package in ophid scan vuln --format json
+type vulnReport struct {
+	Name            string                  `json:"name"`
+	Version         string                  `json:"version"`
+	Ecosystem       string                  `json:"ecosystem"`
+	Error           string                  `json:"error,omitempty"`
+	Severity        security.Severity       `json:"severity"` // Worst vulnerability
+	Counts          security.SeverityCounts `json:"counts"`
+	Vulnerabilities []vulnRating            `json:"vulnerabilities"`
+}
+
+// vulnRating is a vulnerability with its CVSS base score
+type vulnRating struct {
+	ID       string            `json:"id"`
+	Summary  string            `json:"summary"`
+	Aliases  []string          `json:"aliases,omitempty"`
+	Score    float64           `json:"score,omitempty"`    // Highest CVSS base score; 0 when unscored
+	Severity security.Severity `json:"severity,omitempty"` // Missing when neither scored nor rated
+	Vectors  []string          `json:"vectors,omitempty"`
+}
+
 func displayVulnResults(results []security.ScanResult, format string) error {
-	if format == "json" {
-		// TODO: Implement JSON output
-		return fmt.Errorf("JSON output not yet implemented")
+	var total security.SeverityCounts
+	vulnerable := 0
+	for _, result := range results {
+		total.Add(result.Severities())
+		vulnerable += len(result.Vulnerabilities)
 	}
 
-	totalVulns := 0
-	criticalCount := 0
+	if format == "json" {
+		reports := make([]vulnReport, 0, len(results))
+		for _, result := range results {
+			report := vulnReport{
+				Name:            result.Package.Name,
+				Version:         result.Package.Version,
+				Ecosystem:       result.Package.Ecosystem,
+				Error:           result.Error,
+				Severity:        result.MaxSeverity(),
+				Counts:          result.Severities(),
+				Vulnerabilities: []vulnRating{},
+			}
+			for _, vuln := range result.Vulnerabilities {
+				rating := vulnRating{ID: vuln.ID, Summary: vuln.Summary, Aliases: vuln.Aliases}
+				rating.Score, rating.Severity, _ = vuln.Rating()
+				for _, sev := range vuln.Severity {
+					rating.Vectors = append(rating.Vectors, sev.Score)
+				}
+				report.Vulnerabilities = append(report.Vulnerabilities, rating)
+			}
+			reports = append(reports, report)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Results []vulnReport            `json:"results"`
+			Summary security.SeverityCounts `json:"summary"`
+		}{reports, total}); err != nil {
+			return err
+		}
+		if vulnerable > 0 {
+			return fmt.Errorf("vulnerabilities detected")
+		}
+		return nil
+	}
 
 	for _, result := range results {
 		if result.Error != "" {
-			fmt.Printf("[ERROR] %s@%s: %s\n", result.Package.Name, result.Package.Version, result.Error)
+			ui.Stdout.Error("%s@%s: %s", result.Package.Name, result.Package.Version, result.Error)
 			continue
 		}
 
 		if len(result.Vulnerabilities) == 0 {
-			fmt.Printf("[OK] %s@%s: No vulnerabilities found\n", result.Package.Name, result.Package.Version)
+			ui.Stdout.OK("%s@%s: No vulnerabilities found", result.Package.Name, result.Package.Version)
 			continue
 		}
 
-		totalVulns += len(result.Vulnerabilities)
-		critical := result.CriticalCount()
-		criticalCount += critical
-
-		fmt.Printf("[WARN] %s@%s: %d vulnerabilities found", result.Package.Name, result.Package.Version, len(result.Vulnerabilities))
-		if critical > 0 {
-			fmt.Printf(" (%d critical)", critical)
+		found := fmt.Sprintf("%s@%s: %d vulnerabilities found", result.Package.Name, result.Package.Version, len(result.Vulnerabilities))
+		if counts := result.Severities().String(); counts != "" {
+			found += fmt.Sprintf(" (%s)", counts)
 		}
-		fmt.Println()
+		ui.Stdout.Warn("%s", found)
 
 		for _, vuln := range result.Vulnerabilities {
 			fmt.Printf("  - %s: %s\n", vuln.ID, vuln.Summary)
-			if len(vuln.Severity) > 0 {
-				fmt.Printf("    Severity: %s %s\n", vuln.Severity[0].Type, vuln.Severity[0].Score)
+			switch score, severity, ok := vuln.Rating(); {
+			case ok && score > 0:
+				fmt.Printf("    Severity: %s (%.1f)\n", severity, score)
+			case ok:
+				fmt.Printf("    Severity: %s\n", severity)
+			}
+			for _, sev := range vuln.Severity {
+				fmt.Printf("    %s: %s\n", sev.Type, sev.Score)
 			}
 		}
 	}
 
 	fmt.Println()
-	fmt.Printf("Summary: %d vulnerabilities found", totalVulns)
-	if criticalCount > 0 {
-		fmt.Printf(" (%d critical)", criticalCount)
+	fmt.Printf("Summary: %d vulnerabilities found", vulnerable)
+	if counts := total.String(); counts != "" {
+		fmt.Printf(" (%s)", counts)
+	}
+	fmt.Println()
+
+	if vulnerable > 0 {
+		return fmt.Errorf("vulnerabilities detected")
+	}
+
+	return nil
+}
+
+// checkScanPolicy checks scan results against the security policy, if
+// there is one, and prints its violations; a blocking policy fails on them.
+// With JSON output they go to stderr.
+func checkScanPolicy(results []security.ScanResult, format string) error {
+	p, err := loadPolicy(false)
+	if err != nil || p == nil {
+		return err
+	}
+	var violations []policy.Violation
+	for _, result := range results {
+		violations = append(violations, p.Evaluate(policy.Input{
+			Name:       result.Package.Name,
+			Version:    result.Package.Version,
+			ScanFailed: result.Error != "",
+			Severity:   result.MaxSeverity(),
+			Vulns:      len(result.Vulnerabilities),
+		})...)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	if format == "json" {
+		for _, v := range violations {
+			ui.Warn("Policy: %s", v.Message)
+		}
+	} else {
+		fmt.Println()
+		for _, v := range violations {
+			ui.Stdout.Warn("Policy: %s", v.Message)
+		}
 	}
-	fmt.Println()
-
-	if totalVulns > 0 {
-		return fmt.Errorf("vulnerabilities detected")
+	if p.Blocks() {
+		return errcode.Errorf(errcode.PolicyBlocked, "%d security policy violations", len(violations))
 	}
-
 	return nil
 }
 
@@ -791,10 +6808,10 @@ func displayLicenseResults(packages []security.Package, checker *security.Licens
 			fmt.Printf("? %s@%s: Unknown license\n", pkg.Name, pkg.Version)
 			unknownCount++
 		} else if !allowed {
-			fmt.Printf("[ERROR] %s@%s: %s (not allowed)\n", pkg.Name, pkg.Version, info.Name)
+			ui.Stdout.Error("%s@%s: %s (not allowed)", pkg.Name, pkg.Version, info.Name)
 			incompatibleCount++
 		} else {
-			fmt.Printf("[OK] %s@%s: %s\n", pkg.Name, pkg.Version, info.Name)
+			ui.Stdout.OK("%s@%s: %s", pkg.Name, pkg.Version, info.Name)
 		}
 	}
 
@@ -818,52 +6835,276 @@ func proxyCmd() *cobra.Command {
 	}
 
 	cmd.AddCommand(proxyStartCmd())
+	cmd.AddCommand(proxyCheckCmd())
 	cmd.AddCommand(proxyStatusCmd())
 	cmd.AddCommand(proxyStopCmd())
+	cmd.AddCommand(proxyReloadCmd())
 	cmd.AddCommand(proxyRouteCmd())
+	cmd.AddCommand(proxyEgressCmd())
+	cmd.AddCommand(proxyCACmd())
+	cmd.AddCommand(proxyCertCmd())
+
+	return cmd
+}
+
+func proxyCertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cert",
+		Short: "Inspect proxy certificates",
+	}
+
+	var configPath string
+	var env string
+	var adminAddr string
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List certificates with SANs, issuer and days to expiry",
+		Long: `List the certificates the proxy serves: ACME certificates in the cache,
+the static cert_file, or the local development CA. Reads them from disk with
+--config, otherwise asks the running proxy's admin API.
+
+Examples:
+  ophid proxy cert list --config proxy.toml
+  ophid proxy cert list --admin 127.0.0.1:9901`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var certs []proxy.CertificateInfo
+			if configPath != "" {
+				config, err := proxy.LoadConfigEnv(configPath, env)
+				if err != nil {
+					return err
+				}
+				if certs, err = proxy.ListCertificates(config.TLS); err != nil {
+					return err
+				}
+			} else if err := proxy.AdminGet(adminAddr, "/certificates", &certs); err != nil {
+				return err
+			}
+
+			if len(certs) == 0 {
+				fmt.Println("No certificates")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSOURCE\tSANS\tISSUER\tEXPIRES\tDAYS\tSTATUS")
+			for _, c := range certs {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", c.Name, c.Source, orDefault(strings.Join(c.SANs, ","), "-"),
+					c.Issuer, c.NotAfter.Format("2006-01-02"), c.DaysLeft, c.Status())
+			}
+			w.Flush()
+			return nil
+		},
+	}
+	list.Flags().StringVar(&configPath, "config", "", "Read certificates of this proxy config from disk")
+	list.Flags().StringVar(&env, "env", os.Getenv("OPHID_PROXY_ENV"), "Merge the environment overlay <config>.<env>.toml (e.g., prod)")
+	list.Flags().StringVar(&adminAddr, "admin", proxy.DefaultAdminAddr, "Admin API address of the running proxy")
+
+	cmd.AddCommand(list)
+	return cmd
+}
+
+func proxyCACmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ca",
+		Short: "Manage the local development CA",
+		Long: `Manage the local certificate authority used for development HTTPS
+(acme_provider = "local") and for egress TLS interception.`,
+	}
+
+	caDir := filepath.Join(homeDir, "ca")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "init",
+		Short: "Create the local CA (if missing) and show its location",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ca, err := localca.LoadOrCreate(caDir)
+			if err != nil {
+				return err
+			}
+
+			ui.Stdout.OK("Local CA: %s", ca.Cert.Subject.CommonName)
+			fmt.Printf("Certificate: %s\n", ca.CertPath)
+			fmt.Printf("Key:         %s\n", filepath.Join(caDir, localca.KeyFile))
+			fmt.Println("\nTrust it with: ophid proxy ca install")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "install",
+		Short: "Add the local CA to the system trust store",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ca, err := localca.LoadOrCreate(caDir)
+			if err != nil {
+				return err
+			}
+
+			ui.Printf("Installing %s into the system trust store...\n", ca.CertPath)
+			if err := localca.InstallTrust(ca.CertPath); err != nil {
+				return err
+			}
+
+			ui.Success("Local CA installed")
+			ui.Println("Note: Firefox and Java use their own trust stores; import the certificate there if needed.")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Print the local CA certificate path and details",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ca, err := localca.Load(filepath.Join(caDir, localca.CertFile), filepath.Join(caDir, localca.KeyFile))
+			if err != nil {
+				return fmt.Errorf("no local CA found. Run: ophid proxy ca init")
+			}
+
+			fmt.Printf("Subject:     %s\n", ca.Cert.Subject.CommonName)
+			fmt.Printf("Certificate: %s\n", ca.CertPath)
+			fmt.Printf("Expires:     %s\n", ca.Cert.NotAfter.Format("2006-01-02"))
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+func proxyEgressCmd() *cobra.Command {
+	var configPath string
+	var egressConfig proxy.EgressConfig
+
+	cmd := &cobra.Command{
+		Use:   "egress",
+		Short: "Run the outbound proxy for managed tools",
+		Long: `Run a forward proxy (HTTP/CONNECT and SOCKS5) for outbound traffic of
+managed tools, with egress logging and domain allowlisting.
+
+Point tools at it with: ophid run --egress-proxy http://127.0.0.1:3128 <tool>
+(or set OPHID_EGRESS_PROXY).
+
+Examples:
+  # Log all egress
+  ophid proxy egress --listen 127.0.0.1:3128
+
+  # Only allow package indexes
+  ophid proxy egress --listen 127.0.0.1:3128 --allow pypi.org --allow '*.pythonhosted.org'
+
+  # Decrypt HTTPS to log individual requests (tools must trust the CA)
+  ophid proxy egress --listen 127.0.0.1:3128 --intercept-tls --ca-cert ca.pem --ca-key ca-key.pem`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configPath != "" {
+				loaded, err := proxy.LoadConfig(configPath)
+				if err != nil {
+					return err
+				}
+				egressConfig = loaded.Egress
+			}
+
+			egressProxy, err := proxy.NewEgressProxy(egressConfig)
+			if err != nil {
+				return err
+			}
+
+			if err := proxy.StartEgress(egressProxy, egressConfig); err != nil {
+				return err
+			}
+
+			if len(egressConfig.Allow) > 0 {
+				ui.Printf("Allowed destinations: %s\n", strings.Join(egressConfig.Allow, ", "))
+			}
+			if egressConfig.InterceptTLS {
+				ui.Warn("TLS interception enabled: tools must trust the CA certificate")
+			}
+
+			select {}
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config", "", "Read the [egress] section of a proxy config file")
+	cmd.Flags().StringVar(&egressConfig.Listen, "listen", "127.0.0.1:3128", "HTTP/CONNECT proxy listen address")
+	cmd.Flags().StringVar(&egressConfig.SOCKSListen, "socks", "", "SOCKS5 listen address (e.g., 127.0.0.1:1080)")
+	cmd.Flags().StringSliceVar(&egressConfig.Allow, "allow", nil, "Allowed destination host pattern (repeatable, e.g., *.pythonhosted.org)")
+	cmd.Flags().StringVar(&egressConfig.Log, "log", "", "Egress log file (default: stderr)")
+	cmd.Flags().BoolVar(&egressConfig.InterceptTLS, "intercept-tls", false, "Decrypt HTTPS tunnels to log each request")
+	cmd.Flags().StringVar(&egressConfig.CACert, "ca-cert", "", "CA certificate for TLS interception")
+	cmd.Flags().StringVar(&egressConfig.CAKey, "ca-key", "", "CA private key for TLS interception")
 
 	return cmd
 }
 
 func proxyStartCmd() *cobra.Command {
 	var configPath string
+	var env string
 	var domain string
 	var target string
 	var listen string
 	var tlsAuto bool
+	var localCA bool
+	var watch bool
 
 	cmd := &cobra.Command{
 		Use:   "start",
 		Short: "Start the reverse proxy server",
 		Long: `Start the reverse proxy server with the given configuration.
 
+A proxy started with --config reads it again on SIGHUP, on 'ophid proxy
+reload', and with --watch whenever a TOML file changes next to it or in a
+directory it includes. Routes change without restarting listeners; a
+config that doesn't load or validate is logged and rejected, and the
+current routes kept.
+
 Examples:
   # Start with config file
   ophid proxy start --config proxy.toml
 
+  # Start with the production overlay (proxy.prod.toml)
+  ophid proxy start --config proxy.toml --env prod
+
+  # Apply config changes as they are saved
+  ophid proxy start --config proxy.toml --watch
+
   # Quick start with automatic TLS
   ophid proxy start --domain example.com --target localhost:3000 --tls auto
 
+  # Development HTTPS with the local CA
+  ophid proxy start --domain app.localhost --target localhost:3000 --local-ca
+
   # Simple HTTP proxy
   ophid proxy start --listen :8080 --target localhost:3000`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if watch && configPath == "" {
+				return fmt.Errorf("--watch needs --config")
+			}
 			var config *proxy.Config
 
 			if configPath != "" {
-				// TODO: Load config from file
-				return fmt.Errorf("config file loading not yet implemented")
+				loaded, err := proxy.LoadConfigEnv(configPath, env)
+				if err != nil {
+					return err
+				}
+				if err := loaded.ExpandSecrets(secretLookup()); err != nil {
+					return err
+				}
+				config = loaded
 			} else if domain != "" && target != "" {
 				// Quick setup mode
+				acmeProvider := "letsencrypt"
+				if localCA {
+					acmeProvider = "local"
+				}
+
 				config = &proxy.Config{
 					General: proxy.GeneralConfig{
 						Listen: []string{":80", ":443"},
 					},
 					TLS: proxy.TLSConfig{
-						Enabled:      tlsAuto,
-						AutoRedirect: tlsAuto,
-						ACMEProvider: "letsencrypt",
+						Enabled:      tlsAuto || localCA,
+						AutoRedirect: tlsAuto || localCA,
+						ACMEProvider: acmeProvider,
 						Domains:      []string{domain},
 						CacheDir:     filepath.Join(homeDir, "certs"),
+						LocalCADir:   filepath.Join(homeDir, "ca"),
 					},
 					Routes: []proxy.Route{
 						{
@@ -894,6 +7135,24 @@ Examples:
 			if err != nil {
 				return fmt.Errorf("failed to create server: %w", err)
 			}
+			// Supervised processes and installed tools join the admin API's /metrics
+			server.AddMetrics(metrics.NewCollector(homeDir, server.SupervisorState()).Write)
+			if configPath != "" {
+				// POST /reload (ophid proxy reload) reads the config again
+				server.SetReloader(func() (*proxy.Config, error) {
+					reloaded, err := proxy.LoadConfigEnv(configPath, env)
+					if err != nil {
+						return nil, err
+					}
+					if err := reloaded.ExpandSecrets(secretLookup()); err != nil {
+						return nil, err
+					}
+					return reloaded, nil
+				})
+				if watch {
+					server.SetConfigWatch(func() []string { return proxy.ConfigDirs(configPath, env) })
+				}
+			}
 
 			if err := server.Start(); err != nil {
 				return fmt.Errorf("server error: %w", err)
@@ -904,38 +7163,315 @@ Examples:
 	}
 
 	cmd.Flags().StringVar(&configPath, "config", "", "Path to config file")
+	cmd.Flags().StringVar(&env, "env", os.Getenv("OPHID_PROXY_ENV"), "Merge the environment overlay <config>.<env>.toml (e.g., prod)")
 	cmd.Flags().StringVar(&domain, "domain", "", "Domain name for quick setup")
 	cmd.Flags().StringVar(&target, "target", "", "Target backend URL")
 	cmd.Flags().StringVar(&listen, "listen", "", "Listen address (e.g., :8080)")
 	cmd.Flags().BoolVar(&tlsAuto, "tls", false, "Enable automatic TLS with Let's Encrypt")
+	cmd.Flags().BoolVar(&localCA, "local-ca", false, "Enable TLS with the local development CA (e.g., --domain app.localhost)")
+	cmd.Flags().BoolVar(&watch, "watch", false, "Reload when the config file or its includes change")
+
+	return cmd
+}
+
+func proxyCheckCmd() *cobra.Command {
+	var configPath string
+	var env string
+	var skipDNS bool
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Validate a proxy config without starting it",
+		Long: `Parse and validate a proxy configuration without opening listeners:
+backend URLs and DNS, certificate and ACME prerequisites, TLS policies,
+hooks, log sinks, and routes shadowed by earlier routes. Prints the
+route table in match order (priority, then most specific first).
+
+Examples:
+  ophid proxy check --config proxy.toml
+
+  # With the staging overlay (proxy.stage.toml)
+  ophid proxy check --config proxy.toml --env stage
+
+  # Offline (skip DNS resolution)
+  ophid proxy check --config proxy.toml --skip-dns`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := proxy.LoadConfigEnv(configPath, env)
+			if err != nil {
+				return err
+			}
+
+			if env != "" {
+				fmt.Printf("Checking %s with %s...\n\n", configPath, proxy.OverlayPath(configPath, env))
+			} else {
+				fmt.Printf("Checking %s...\n\n", configPath)
+			}
+
+			if len(config.Routes) > 0 {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "#\tPRIORITY\tHOST\tPATH\tMETHOD\tCONDITIONS\tTYPE\tTARGET")
+				for _, i := range proxy.RouteOrder(config.Routes) {
+					route := config.Routes[i]
+					fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1, route.Priority,
+						orDefault(route.Host, "*"), orDefault(route.Path, "/*"), orDefault(route.Method, "*"),
+						orDefault(routeConditions(route), "-"), routeType(route), routeTarget(route))
+				}
+				w.Flush()
+				fmt.Println()
+			}
+			if config.Dynamic.Backend != "" {
+				fmt.Printf("Dynamic routes: %s at %s (prefix %s)\n\n", config.Dynamic.Backend, config.Dynamic.Address, config.Dynamic.Prefix)
+			}
+
+			report := proxy.CheckConfig(config, proxy.CheckOptions{ResolveDNS: !skipDNS})
+
+			errors := 0
+			for _, issue := range report.Issues {
+				if issue.Severity == proxy.SeverityError {
+					errors++
+					ui.Stdout.Error("%s", issue.Message)
+				} else {
+					ui.Stdout.Warn("%s", issue.Message)
+				}
+			}
+
+			if report.HasErrors() {
+				return fmt.Errorf("configuration has %d error(s)", errors)
+			}
+
+			ui.Stdout.OK("Configuration is valid (%d routes, %d warnings)", len(config.Routes), len(report.Issues))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to config file")
+	cmd.Flags().StringVar(&env, "env", os.Getenv("OPHID_PROXY_ENV"), "Merge the environment overlay <config>.<env>.toml (e.g., prod)")
+	cmd.Flags().BoolVar(&skipDNS, "skip-dns", false, "Do not resolve backend and domain names")
+	cmd.MarkFlagRequired("config")
 
 	return cmd
 }
 
+// routeType describes how a route is served
+func routeType(route proxy.Route) string {
+	switch {
+	case route.Static:
+		return "static"
+	case route.WebSocket:
+		return "websocket"
+	case len(route.Backends) > 1:
+		strategy := route.LoadBalance.Strategy
+		if strategy == "" {
+			strategy = proxy.StrategyRoundRobin
+		}
+		return "proxy (" + string(strategy) + ")"
+	}
+	return "proxy"
+}
+
+// routeConditions formats a route's header, query, cookie and country conditions
+func routeConditions(route proxy.Route) string {
+	var conditions []string
+	for _, c := range []struct {
+		kind   string
+		values map[string]string
+	}{
+		{"header", route.MatchHeaders},
+		{"query", route.MatchQuery},
+		{"cookie", route.MatchCookies},
+	} {
+		for name, value := range c.values {
+			conditions = append(conditions, fmt.Sprintf("%s:%s=%s", c.kind, name, value))
+		}
+	}
+	sort.Strings(conditions)
+
+	if countries := route.GeoIP.Countries; len(countries) > 0 {
+		conditions = append(conditions, "country:"+strings.Join(countries, ","))
+	}
+	return strings.Join(conditions, " ")
+}
+
+// routeTarget lists where a route sends requests
+func routeTarget(route proxy.Route) string {
+	if route.Static {
+		return route.StaticRoot
+	}
+
+	targets := []string{}
+	if route.Target != "" {
+		targets = append(targets, route.Target)
+	}
+	for _, backend := range route.Backends {
+		targets = append(targets, backend.URLStr)
+	}
+	return strings.Join(targets, ", ")
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// formatSeconds prints a latency in seconds as milliseconds
+func formatSeconds(seconds float64) string {
+	if seconds == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1fms", seconds*1000)
+}
+
+// formatBytes prints a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func proxyStatusCmd() *cobra.Command {
-	return &cobra.Command{
+	var adminAddr string
+
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show proxy server status",
+		Long: `Show per-route traffic (1m and 5m windows), backend health, outlier
+ejections and drains in progress of a running proxy, read from its admin API
+(general.admin_listen).`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// TODO: Implement status check
+			var routes []proxy.RouteStatus
+			if err := proxy.AdminGet(adminAddr, "/routes", &routes); err != nil {
+				return err
+			}
+
+			var backends []proxy.BackendStatus
+			if err := proxy.AdminGet(adminAddr, "/backends", &backends); err != nil {
+				return err
+			}
+
+			var drains []proxy.DrainStatus
+			if err := proxy.AdminGet(adminAddr, "/drains", &drains); err != nil {
+				return err
+			}
+
 			fmt.Println("Proxy status:")
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
+
+			if len(routes) > 0 {
+				fmt.Println("\nRoutes:")
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "  ROUTE\tWINDOW\tACTIVE\tRPS\tERRORS\tP50\tP95\tIN\tOUT")
+				for _, r := range routes {
+					for _, win := range []struct {
+						name  string
+						stats proxy.RouteWindowStats
+					}{{"1m", r.OneMinute}, {"5m", r.FiveMinutes}} {
+						route := r.Route
+						if win.name != "1m" {
+							route = ""
+						}
+						fmt.Fprintf(w, "  %s\t%s\t%d\t%.1f\t%.1f%%\t%s\t%s\t%s\t%s\n",
+							route, win.name, r.Active, win.stats.RPS, win.stats.ErrorRate*100,
+							formatSeconds(win.stats.LatencyP50), formatSeconds(win.stats.LatencyP95),
+							formatBytes(win.stats.BytesIn), formatBytes(win.stats.BytesOut))
+					}
+				}
+				w.Flush()
+			}
+
+			if len(backends) == 0 {
+				fmt.Println("\nNo load-balanced backends")
+			} else {
+				fmt.Println("\nBackends:")
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "  ROUTE\tBACKEND\tHEALTH\tCONNS\tOUTLIER")
+				for _, b := range backends {
+					outlier := "-"
+					if b.Outlier != nil {
+						outlier = fmt.Sprintf("p95 %.0fms, 5xx %.0f%%", b.Outlier.LatencyP95*1000, b.Outlier.ErrorRate*100)
+						if b.Outlier.Ejected {
+							outlier += fmt.Sprintf(", ejected until %s", b.Outlier.EjectedUntil.Format("15:04:05"))
+						}
+					}
+					fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%s\n", b.Route, b.URL, b.Health, b.Connections, outlier)
+				}
+				w.Flush()
+			}
+
+			if len(drains) > 0 {
+				fmt.Println("\nDraining:")
+				for _, d := range drains {
+					left := time.Until(d.Deadline).Round(time.Second)
+					if left < 0 {
+						left = 0
+					}
+					fmt.Printf("  %s %s: %d in-flight, %s left\n", d.Kind, d.Name, d.Inflight, left)
+				}
+			}
+
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&adminAddr, "admin", proxy.DefaultAdminAddr, "Admin API address of the running proxy")
+
+	return cmd
 }
 
 func proxyStopCmd() *cobra.Command {
-	return &cobra.Command{
+	var adminAddr string
+
+	cmd := &cobra.Command{
 		Use:   "stop",
 		Short: "Stop the proxy server",
+		Long: `Gracefully stop a running proxy through its admin API
+(general.admin_listen). Needs a token with the admin role in
+OPHID_ADMIN_TOKEN when general.admin_tokens is set; without tokens, only
+clients on the proxy's host may stop it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ui.Println("Stopping proxy server...")
+			if err := proxy.AdminPost(adminAddr, "/stop"); err != nil {
+				return err
+			}
+			ui.Success("Proxy at %s is shutting down", adminAddr)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&adminAddr, "admin", proxy.DefaultAdminAddr, "Admin API address of the running proxy")
+
+	return cmd
+}
+
+func proxyReloadCmd() *cobra.Command {
+	var adminAddr string
+
+	cmd := &cobra.Command{
+		Use:   "reload",
+		Short: "Reload the running proxy's config file",
+		Long: `Make a proxy started with --config read its config file (and --env
+overlay) again and apply it without dropping connections, through its admin
+API (general.admin_listen). Sending the proxy SIGHUP does the same. Needs a token with the operator or admin role in
+OPHID_ADMIN_TOKEN when general.admin_tokens is set.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// TODO: Implement graceful shutdown
-			fmt.Println("Stopping proxy server...")
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
+			if err := proxy.AdminPost(adminAddr, "/reload"); err != nil {
+				return err
+			}
+			ui.Success("Proxy configuration reloaded")
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&adminAddr, "admin", proxy.DefaultAdminAddr, "Admin API address of the running proxy")
+
+	return cmd
 }
 
 func proxyRouteCmd() *cobra.Command {
@@ -950,7 +7486,7 @@ func proxyRouteCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// TODO: Implement route listing
 			fmt.Println("Routes:")
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
+			ui.Warn("Not yet implemented - coming soon!")
 			return nil
 		},
 	})
@@ -960,8 +7496,8 @@ func proxyRouteCmd() *cobra.Command {
 		Short: "Add a new route",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// TODO: Implement route addition
-			fmt.Println("Adding route...")
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
+			ui.Println("Adding route...")
+			ui.Warn("Not yet implemented - coming soon!")
 			return nil
 		},
 	})
@@ -972,11 +7508,84 @@ func proxyRouteCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// TODO: Implement route removal
-			fmt.Printf("Removing route for %s...\n", args[0])
-			fmt.Println("[WARN] Not yet implemented - coming soon!")
+			ui.Printf("Removing route for %s...\n", args[0])
+			ui.Warn("Not yet implemented - coming soon!")
 			return nil
 		},
 	})
 
 	return cmd
 }
+
+// docsCmd generates the command reference from the command definitions
+func docsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docs",
+		Short: "Generate man pages and markdown docs for every command",
+		Long: `Generate the reference documentation of every ophid command, its
+flags and examples, from the same definitions --help uses. Release archives
+ship the man pages, so servers without internet can read them with man.
+
+SOURCE_DATE_EPOCH, when set, dates the man pages for reproducible builds.`,
+	}
+
+	var manDir string
+	manCmd := &cobra.Command{
+		Use:   "man",
+		Short: "Generate man pages",
+		Example: `  ophid docs man -o /usr/local/share/man/man1 && mandb
+  man ophid-install`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			date, err := docsDate()
+			if err != nil {
+				return err
+			}
+			n, err := clidoc.ManTree(cmd.Root(), manDir, clidoc.Header{
+				Date:   date,
+				Source: "ophid " + version,
+				Manual: "OPHID Manual",
+			})
+			if err != nil {
+				return err
+			}
+			ui.Success("Wrote %d man pages to %s", n, manDir)
+			return nil
+		},
+	}
+	manCmd.Flags().StringVarP(&manDir, "output", "o", "man", "Directory to write the pages to")
+
+	var markdownDir string
+	markdownCmd := &cobra.Command{
+		Use:     "markdown",
+		Short:   "Generate markdown pages",
+		Example: `  ophid docs markdown -o docs/cli`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := clidoc.MarkdownTree(cmd.Root(), markdownDir)
+			if err != nil {
+				return err
+			}
+			ui.Success("Wrote %d markdown pages to %s", n, markdownDir)
+			return nil
+		},
+	}
+	markdownCmd.Flags().StringVarP(&markdownDir, "output", "o", "docs/cli", "Directory to write the pages to")
+
+	cmd.AddCommand(manCmd, markdownCmd)
+	return cmd
+}
+
+// docsDate returns the date of generated man pages: SOURCE_DATE_EPOCH if
+// set, so release builds are reproducible, otherwise now
+func docsDate() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now(), nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", epoch, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
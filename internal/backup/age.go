@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Headers of age encrypted files, binary and armored
+const (
+	ageHeader   = "age-encryption.org/v1\n"
+	armorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+)
+
+// Encryption selects who can decrypt a backup. Backups are encrypted with
+// the age command (https://age-encryption.org) when any field is set.
+type Encryption struct {
+	Recipients     []string // Public keys, e.g. "age1..." or "ssh-ed25519 ..."
+	RecipientFiles []string // Files of public keys
+	Passphrase     bool     // Ask for a passphrase on the terminal
+}
+
+// Enabled reports whether e encrypts anything
+func (e Encryption) Enabled() bool {
+	return len(e.Recipients) > 0 || len(e.RecipientFiles) > 0 || e.Passphrase
+}
+
+// Encrypted reports whether data is age encrypted
+func Encrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageHeader)) || bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(armorHeader))
+}
+
+// Encrypt encrypts data for e's recipients
+func Encrypt(data []byte, e Encryption) ([]byte, error) {
+	args := []string{"--encrypt"}
+	if e.Passphrase {
+		args = append(args, "--passphrase")
+	}
+	for _, r := range e.Recipients {
+		args = append(args, "--recipient", r)
+	}
+	for _, f := range e.RecipientFiles {
+		args = append(args, "--recipients-file", f)
+	}
+
+	out, err := runAge(data, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	return out, nil
+}
+
+// Decrypt decrypts data with the given identity files, or a passphrase
+// asked on the terminal when there are none
+func Decrypt(data []byte, identities []string) ([]byte, error) {
+	args := []string{"--decrypt"}
+	for _, i := range identities {
+		args = append(args, "--identity", i)
+	}
+
+	out, err := runAge(data, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+	return out, nil
+}
+
+// runAge pipes data through age. age asks for passphrases on the terminal
+// itself; its errors are returned.
+func runAge(data []byte, args []string) ([]byte, error) {
+	age, err := exec.LookPath("age")
+	if err != nil {
+		return nil, fmt.Errorf("encrypted backups require age (https://age-encryption.org): %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(age, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
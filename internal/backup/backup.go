@@ -0,0 +1,305 @@
+// Package backup snapshots ophid's state into an archive and restores it.
+// Backups hold what can't be recreated: the tool manifest, run history,
+// supervisor state, certificates, secrets and config files. Runtimes,
+// venvs and caches are left out; tools are reinstalled from the lock file
+// a backup carries.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is the version of the backup layout
+const Format = 1
+
+// indexName is the archive's first file, listing the others
+const indexName = "index.json"
+
+// HomePaths are the files and directories under the ophid home a backup
+// holds. Everything else there is rebuilt: runtimes, venvs, caches and
+// diagnostics.
+var HomePaths = []string{
+	"tools/manifest.json",
+	"supervisor/state.json",
+	"history/runs.jsonl",
+	"jobs/results.jsonl",
+	"certs",
+	"ca",
+	"secrets.enc",
+}
+
+// Index describes a backup
+type Index struct {
+	Format  int       `json:"format"`
+	Version string    `json:"ophid_version"`
+	Created time.Time `json:"created"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Entry is a file in a backup
+type Entry struct {
+	Name string      `json:"name"` // Name in the archive
+	Path string      `json:"path"` // Where it's restored: relative to the ophid home, or absolute
+	Mode fs.FileMode `json:"mode"`
+}
+
+// Backup is a set of files to archive or restore
+type Backup struct {
+	Index Index
+	data  map[string][]byte
+}
+
+// New creates an empty backup
+func New(version string, created time.Time) *Backup {
+	return &Backup{
+		Index: Index{Format: Format, Version: version, Created: created},
+		data:  make(map[string][]byte),
+	}
+}
+
+// AddHome adds files and directories under homeDir, by slash separated
+// paths relative to it. Missing ones are skipped.
+func (b *Backup) AddHome(homeDir string, paths ...string) error {
+	for _, rel := range paths {
+		root := filepath.Join(homeDir, filepath.FromSlash(rel))
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(homeDir, p)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+			b.Add("home/"+relPath, relPath, info.Mode().Perm(), data)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to back up %s: %w", root, err)
+		}
+	}
+	return nil
+}
+
+// AddFile adds a file from outside the ophid home, restored where it was
+func (b *Backup) AddFile(file string) error {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return fmt.Errorf("failed to back up %s: %w", file, err)
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return fmt.Errorf("failed to back up %s: %w", file, err)
+	}
+
+	// /etc/ophid/proxy.toml -> files/etc/ophid/proxy.toml, C:\x -> files/C/x
+	name := filepath.ToSlash(abs)
+	if volume := filepath.VolumeName(abs); volume != "" {
+		name = strings.TrimSuffix(volume, ":") + filepath.ToSlash(abs[len(volume):])
+	}
+	b.Add("files/"+strings.TrimPrefix(name, "/"), abs, info.Mode().Perm(), data)
+	return nil
+}
+
+// Add adds a file with the given contents, restored to path. A file of
+// the same name is replaced.
+func (b *Backup) Add(name, path string, mode fs.FileMode, data []byte) {
+	if _, ok := b.data[name]; !ok {
+		b.Index.Entries = append(b.Index.Entries, Entry{Name: name, Path: path, Mode: mode})
+	}
+	b.data[name] = data
+}
+
+// Data returns the contents of a file in the backup
+func (b *Backup) Data(name string) ([]byte, bool) {
+	data, ok := b.data[name]
+	return data, ok
+}
+
+// Write writes the backup as a .tar.gz, the index first
+func (b *Backup) Write(w io.Writer) error {
+	index, err := json.MarshalIndent(b.Index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode backup index: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	write := func(name string, mode fs.FileMode, data []byte) error {
+		header := &tar.Header{Name: name, Mode: int64(mode), Size: int64(len(data)), ModTime: b.Index.Created}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	err = write(indexName, 0600, index)
+	for _, e := range b.Index.Entries {
+		if err != nil {
+			break
+		}
+		err = write(e.Name, e.Mode, b.data[e.Name])
+	}
+	if closeErr := tw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// Read reads a backup written by Write, checking every entry restores to a
+// safe place
+func Read(r io.Reader) (*Backup, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		files[header.Name] = data
+	}
+
+	indexData, ok := files[indexName]
+	if !ok {
+		return nil, fmt.Errorf("not an ophid backup: no %s", indexName)
+	}
+	b := &Backup{data: make(map[string][]byte)}
+	if err := json.Unmarshal(indexData, &b.Index); err != nil {
+		return nil, fmt.Errorf("failed to parse backup index: %w", err)
+	}
+	if b.Index.Format > Format {
+		return nil, fmt.Errorf("backup format %d is newer than this ophid supports (%d)", b.Index.Format, Format)
+	}
+
+	for _, e := range b.Index.Entries {
+		if err := checkEntry(e); err != nil {
+			return nil, err
+		}
+		data, ok := files[e.Name]
+		if !ok {
+			return nil, fmt.Errorf("backup is missing %s", e.Name)
+		}
+		b.data[e.Name] = data
+	}
+	return b, nil
+}
+
+// checkEntry refuses entries that would restore outside the ophid home,
+// unless they were backed up from outside it
+func checkEntry(e Entry) error {
+	if strings.HasPrefix(e.Name, "files/") && filepath.IsAbs(e.Path) {
+		return nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(e.Path)) || path.IsAbs(e.Path) {
+		return fmt.Errorf("backup entry %s restores outside the ophid home: %s", e.Name, e.Path)
+	}
+	return nil
+}
+
+// Target returns where an entry is restored
+func Target(homeDir string, e Entry) string {
+	if filepath.IsAbs(e.Path) {
+		return e.Path
+	}
+	return filepath.Join(homeDir, filepath.FromSlash(e.Path))
+}
+
+// Conflicts returns the files restoring would overwrite, sorted
+func (b *Backup) Conflicts(homeDir string) []string {
+	var existing []string
+	for _, e := range b.Index.Entries {
+		target := Target(homeDir, e)
+		current, err := os.ReadFile(target)
+		if err == nil && !bytes.Equal(current, b.data[e.Name]) {
+			existing = append(existing, target)
+		}
+	}
+	sort.Strings(existing)
+	return existing
+}
+
+// Restore writes every file of the backup to its place, replacing what is
+// there. Each file appears complete or not at all.
+func (b *Backup) Restore(homeDir string) ([]string, error) {
+	var restored []string
+	for _, e := range b.Index.Entries {
+		target := Target(homeDir, e)
+		if err := writeFile(target, b.data[e.Name], e.Mode); err != nil {
+			return restored, fmt.Errorf("failed to restore %s: %w", target, err)
+		}
+		restored = append(restored, target)
+	}
+	return restored, nil
+}
+
+func writeFile(path string, data []byte, mode fs.FileMode) error {
+	if mode == 0 {
+		mode = 0600
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRoundTrip(t *testing.T) {
+	home := t.TempDir()
+	write := func(path, data string, mode os.FileMode) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(home, "tools", "manifest.json"), `{"tools":{}}`, 0644)
+	write(filepath.Join(home, "ca", "ca.key"), "key", 0600)
+	write(filepath.Join(home, "venvs", "black", "bin", "black"), "#!", 0755)
+	config := filepath.Join(t.TempDir(), "proxy.toml")
+	write(config, "[general]\n", 0644)
+
+	b := New("1.2.3", time.Unix(1700000000, 0).UTC())
+	if err := b.AddHome(home, HomePaths...); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddFile(config); err != nil {
+		t.Fatal(err)
+	}
+	b.Add("lock/ophid.lock", "backup/ophid.lock", 0644, []byte("version = 1\n"))
+
+	var archive bytes.Buffer
+	if err := b.Write(&archive); err != nil {
+		t.Fatal(err)
+	}
+	if Encrypted(archive.Bytes()) {
+		t.Error("plain backup detected as encrypted")
+	}
+
+	restored, err := Read(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored.Index, b.Index) {
+		t.Errorf("index = %+v, want %+v", restored.Index, b.Index)
+	}
+	for _, e := range restored.Index.Entries {
+		if strings.Contains(e.Path, "venvs") {
+			t.Errorf("backed up %s", e.Path)
+		}
+	}
+
+	// Restore somewhere else: home files follow the home, others go back
+	newHome := t.TempDir()
+	if conflicts := restored.Conflicts(newHome); len(conflicts) != 0 {
+		t.Errorf("conflicts = %v", conflicts)
+	}
+	write(config, "[general]\nchanged = true\n", 0644)
+	if conflicts := restored.Conflicts(newHome); !reflect.DeepEqual(conflicts, []string{config}) {
+		t.Errorf("conflicts = %v, want the changed config", conflicts)
+	}
+
+	files, err := restored.Restore(newHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Errorf("restored %v", files)
+	}
+	data, err := os.ReadFile(config)
+	if err != nil || string(data) != "[general]\n" {
+		t.Errorf("config = %q, %v", data, err)
+	}
+	info, err := os.Stat(filepath.Join(newHome, "ca", "ca.key"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("ca.key = %v, %v", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(newHome, "backup", "ophid.lock")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadRejectsEscapes(t *testing.T) {
+	for _, path := range []string{"../../.bashrc", "/etc/passwd"} {
+		b := New("1.2.3", time.Now())
+		b.Add("home/x", path, 0644, []byte("x"))
+		var archive bytes.Buffer
+		if err := b.Write(&archive); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Read(&archive); err == nil {
+			t.Errorf("read a backup restoring to %s", path)
+		}
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	for data, want := range map[string]bool{
+		"age-encryption.org/v1\n-> X25519 abc\n":  true,
+		"\n-----BEGIN AGE ENCRYPTED FILE-----\nY": true,
+		"\x1f\x8b\x08": false,
+	} {
+		if got := Encrypted([]byte(data)); got != want {
+			t.Errorf("Encrypted(%q) = %v, want %v", data, got, want)
+		}
+	}
+}
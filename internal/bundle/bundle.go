@@ -0,0 +1,231 @@
+// Package bundle reads and writes ophid.toml, the runtimes and tools an
+// environment needs, and its ophid.lock, exactly what was installed.
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/gleicon/ophid/internal/runtime"
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+// DefaultFile is the bundle file looked for in the current directory
+const DefaultFile = "ophid.toml"
+
+// LockVersion is the format version written to lock files
+const LockVersion = 1
+
+// Bundle is an ophid.toml
+type Bundle struct {
+	Runtimes  []string            `toml:"runtimes,omitempty"`  // Runtime specs, e.g. "python@3.12.1"
+	Platforms []string            `toml:"platforms,omitempty"` // os/arch the lock is resolved for besides the locking one
+	Tools     map[string]ToolSpec `toml:"tools,omitempty"`     // Tool name -> where to get it
+}
+
+// ToolSpec says which version of a tool to install, and from where
+type ToolSpec struct {
+	Version      string   `toml:"version,omitempty"`
+	Source       string   `toml:"source,omitempty"` // pypi (default), github, git or local
+	URL          string   `toml:"url,omitempty"`    // Git repository
+	Ref          string   `toml:"ref,omitempty"`    // Git tag, commit or branch
+	Path         string   `toml:"path,omitempty"`   // Local directory
+	Subdirectory string   `toml:"subdirectory,omitempty"`
+	Profile      string   `toml:"profile,omitempty"`   // Install profile, e.g. "aws"
+	Platforms    []string `toml:"platforms,omitempty"` // Only install on these os/arch (default: all)
+}
+
+// Lock is an ophid.lock
+type Lock struct {
+	Version  int             `toml:"version"`
+	Runtimes []LockedRuntime `toml:"runtime,omitempty"`
+	Tools    []LockedTool    `toml:"tool,omitempty"`
+}
+
+// LockedRuntime is an installed runtime
+type LockedRuntime struct {
+	Type     string `toml:"type"`
+	Version  string `toml:"version"`
+	Platform string `toml:"platform"` // os/arch it was installed for
+}
+
+// LockedTool is an installed tool and its exact source
+type LockedTool struct {
+	Name         string             `toml:"name"`
+	Version      string             `toml:"version"`
+	Source       string             `toml:"source"`
+	URL          string             `toml:"url,omitempty"`
+	Branch       string             `toml:"branch,omitempty"`
+	Tag          string             `toml:"tag,omitempty"`
+	Commit       string             `toml:"commit,omitempty"`
+	Path         string             `toml:"path,omitempty"`
+	Subdirectory string             `toml:"subdirectory,omitempty"`
+	Profile      string             `toml:"profile,omitempty"`
+	Executables  []string           `toml:"executables,omitempty"`
+	Resolved     []LockedResolution `toml:"resolved,omitempty"` // Exact packages per platform, from ophid lock
+}
+
+// LockedResolution is every package a Python tool installs on one platform
+// and Python version, pinned and hashed
+type LockedResolution struct {
+	Platform     string   `toml:"platform"` // os/arch
+	Python       string   `toml:"python"`   // Like 3.12
+	Requirements []string `toml:"requirements"`
+}
+
+// LockPath returns the lock file that goes with a bundle file:
+// ophid.toml -> ophid.lock
+func LockPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".lock"
+}
+
+// Dump snapshots installed runtimes and tools, pinned to their installed
+// versions
+func Dump(runtimes []*runtime.Runtime, tools []*tool.Tool) (*Bundle, *Lock) {
+	b := &Bundle{Tools: make(map[string]ToolSpec)}
+	lock := &Lock{Version: LockVersion}
+
+	for _, rt := range runtimes {
+		b.Runtimes = append(b.Runtimes, fmt.Sprintf("%s@%s", rt.Type, rt.Version))
+		lock.Runtimes = append(lock.Runtimes, LockedRuntime{
+			Type:     string(rt.Type),
+			Version:  rt.Version,
+			Platform: rt.OS + "/" + rt.Arch,
+		})
+	}
+	sort.Strings(b.Runtimes)
+	sort.Slice(lock.Runtimes, func(i, j int) bool {
+		return lock.Runtimes[i].Type+"@"+lock.Runtimes[i].Version < lock.Runtimes[j].Type+"@"+lock.Runtimes[j].Version
+	})
+
+	for _, t := range tools {
+		b.Tools[t.Name] = toolSpec(t)
+
+		source := t.Source.Type
+		if source == "" {
+			source = tool.SourcePyPI
+		}
+		lock.Tools = append(lock.Tools, LockedTool{
+			Name:         t.Name,
+			Version:      t.Version,
+			Source:       string(source),
+			URL:          t.Source.URL,
+			Branch:       t.Source.Branch,
+			Tag:          t.Source.Tag,
+			Commit:       t.Source.Commit,
+			Path:         t.Source.Path,
+			Subdirectory: t.Source.Subdirectory,
+			Profile:      t.Source.Metadata[tool.ProfileMetadataKey],
+			Executables:  t.Executables,
+		})
+	}
+	sort.Slice(lock.Tools, func(i, j int) bool { return lock.Tools[i].Name < lock.Tools[j].Name })
+
+	return b, lock
+}
+
+// toolSpec describes how to reinstall a tool
+func toolSpec(t *tool.Tool) ToolSpec {
+	if profile := t.Source.Metadata[tool.ProfileMetadataKey]; profile != "" {
+		return ToolSpec{Profile: profile, Version: t.Version}
+	}
+
+	switch t.Source.Type {
+	case tool.SourceGitHub, tool.SourceGit:
+		ref := t.Source.Tag
+		if ref == "" {
+			ref = t.Source.Commit
+		}
+		if ref == "" {
+			ref = t.Source.Branch
+		}
+		return ToolSpec{Source: string(t.Source.Type), URL: t.Source.URL, Ref: ref, Subdirectory: t.Source.Subdirectory}
+	case tool.SourceLocal:
+		return ToolSpec{Source: string(t.Source.Type), Path: t.Source.Path, Subdirectory: t.Source.Subdirectory}
+	}
+
+	spec := ToolSpec{Version: t.Version}
+	if t.Version == "unknown" {
+		spec.Version = ""
+	}
+	return spec
+}
+
+// Load reads a bundle file
+func Load(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	var b Bundle
+	if err := toml.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &b, nil
+}
+
+// LoadLock reads a lock file
+func LoadLock(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	var lock Lock
+	if err := toml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if lock.Version > LockVersion {
+		return nil, fmt.Errorf("%s has lock format %d; this ophid reads up to %d", path, lock.Version, LockVersion)
+	}
+	return &lock, nil
+}
+
+// Write writes a bundle file
+func (b *Bundle) Write(path string, now time.Time) error {
+	data, err := b.Encode(now)
+	return writeTOML(path, data, err)
+}
+
+// Encode returns the bundle file's contents
+func (b *Bundle) Encode(now time.Time) ([]byte, error) {
+	return encodeTOML(b, fmt.Sprintf("# Written by `ophid bundle dump` on %s\n", now.Format("2006-01-02")))
+}
+
+// Write writes a lock file
+func (l *Lock) Write(path string, now time.Time) error {
+	data, err := l.Encode(now)
+	return writeTOML(path, data, err)
+}
+
+// Encode returns the lock file's contents
+func (l *Lock) Encode(now time.Time) ([]byte, error) {
+	return encodeTOML(l, fmt.Sprintf("# Written by `ophid bundle dump` on %s. Don't edit: exact installed versions.\n", now.Format("2006-01-02")))
+}
+
+// encodeTOML encodes v under a comment header
+func encodeTOML(v any, header string) ([]byte, error) {
+	data, err := toml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(header+"\n"), data...), nil
+}
+
+// writeTOML writes a file encoded by encodeTOML
+func writeTOML(path string, data []byte, err error) error {
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gleicon/ophid/internal/runtime"
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+func TestDumpRoundTrip(t *testing.T) {
+	runtimes := []*runtime.Runtime{{Type: runtime.RuntimePython, Version: "3.12.1", OS: "linux", Arch: "amd64"}}
+	tools := []*tool.Tool{
+		{Name: "ansible", Version: "9.1.0", Executables: []string{"ansible", "ansible-playbook"}, Source: tool.InstallSource{Type: tool.SourcePyPI}},
+		{Name: "mytool", Version: "dev", Source: tool.InstallSource{Type: tool.SourceGitHub, URL: "https://github.com/acme/mytool", Tag: "v1.2.0", Commit: "abc123"}},
+		{Name: "local", Version: "local", Source: tool.InstallSource{Type: tool.SourceLocal, Path: "/src/local"}},
+		{Name: "gcloud", Version: "494.0.0", Source: tool.InstallSource{Type: tool.SourceArchive, Metadata: map[string]string{tool.ProfileMetadataKey: "gcloud"}}},
+	}
+
+	b, lock := Dump(runtimes, tools)
+
+	want := map[string]ToolSpec{
+		"ansible": {Version: "9.1.0"},
+		"mytool":  {Source: "github", URL: "https://github.com/acme/mytool", Ref: "v1.2.0"},
+		"local":   {Source: "local", Path: "/src/local"},
+		"gcloud":  {Profile: "gcloud", Version: "494.0.0"},
+	}
+	if !reflect.DeepEqual(b.Tools, want) {
+		t.Errorf("Tools = %+v, want %+v", b.Tools, want)
+	}
+	if len(lock.Tools) != 4 || lock.Tools[3].Name != "mytool" || lock.Tools[3].Commit != "abc123" || lock.Tools[1].Profile != "gcloud" {
+		t.Errorf("lock tools = %+v", lock.Tools)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, DefaultFile)
+	now := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	if err := b.Write(path, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Write(LockPath(path), now); err != nil {
+		t.Fatal(err)
+	}
+
+	if LockPath(path) != filepath.Join(dir, "ophid.lock") {
+		t.Errorf("LockPath = %s", LockPath(path))
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "# Written by `ophid bundle dump` on 2026-01-02") {
+		t.Errorf("missing header:\n%s", data)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, b) {
+		t.Errorf("Load = %+v, want %+v", loaded, b)
+	}
+
+	loadedLock, err := LoadLock(LockPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loadedLock, lock) {
+		t.Errorf("LoadLock = %+v, want %+v", loadedLock, lock)
+	}
+}
+
+func TestLoadLockNewerFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ophid.lock")
+	os.WriteFile(path, []byte("version = 99\n"), 0644)
+	if _, err := LoadLock(path); err == nil {
+		t.Error("LoadLock should refuse a newer lock format")
+	}
+}
+
+func TestToolSpecInstall(t *testing.T) {
+	runtimes := []*runtime.Runtime{}
+	tools := []*tool.Tool{
+		{Name: "ansible", Version: "9.1.0", Source: tool.InstallSource{Type: tool.SourcePyPI}},
+		{Name: "mytool", Version: "dev", Source: tool.InstallSource{Type: tool.SourceGitHub, URL: "https://github.com/acme/mytool", Tag: "v1.2.0", Commit: "abc1234"}},
+		{Name: "gcloud", Version: "494.0.0", Source: tool.InstallSource{Type: tool.SourceArchive, Metadata: map[string]string{tool.ProfileMetadataKey: "gcloud"}}},
+	}
+	b, lock := Dump(runtimes, tools)
+
+	// What was dumped is satisfied by what was installed
+	for _, installed := range tools {
+		if !b.Tools[installed.Name].Satisfied(installed) {
+			t.Errorf("%s not satisfied by itself", installed.Name)
+		}
+	}
+	if (ToolSpec{Version: "9.2.0"}).Satisfied(tools[0]) {
+		t.Error("ansible 9.1.0 satisfies 9.2.0")
+	}
+	if (ToolSpec{Source: "github", URL: "https://github.com/acme/mytool", Ref: "v2.0.0"}).Satisfied(tools[1]) {
+		t.Error("mytool v1.2.0 satisfies v2.0.0")
+	}
+
+	opts := b.Tools["mytool"].InstallOptions(lock.Tool("mytool"))
+	if opts.Source.Type != tool.SourceGitHub || opts.Source.Tag != "v1.2.0" || opts.Source.Commit != "abc1234" {
+		t.Errorf("mytool options = %+v", opts.Source)
+	}
+	if opts := b.Tools["ansible"].InstallOptions(nil); opts.Version != "9.1.0" || opts.Source.Type != "" {
+		t.Errorf("ansible options = %+v", opts)
+	}
+	if opts := (ToolSpec{Source: "git", URL: "https://git.example.com/t.git", Ref: "0123abcd"}).InstallOptions(nil); opts.Source.Commit != "0123abcd" || opts.Source.Tag != "" {
+		t.Errorf("commit ref options = %+v", opts.Source)
+	}
+	if opts := b.Tools["gcloud"].InstallOptions(nil); opts.Profile != "gcloud" {
+		t.Errorf("gcloud options = %+v", opts)
+	}
+	if names := b.ToolNames(); !reflect.DeepEqual(names, []string{"ansible", "gcloud", "mytool"}) {
+		t.Errorf("ToolNames = %v", names)
+	}
+}
+
+func TestLockResolutions(t *testing.T) {
+	b := &Bundle{
+		Runtimes:  []string{"node@20.0.0", "python@3.11.7"},
+		Platforms: []string{"linux/amd64", "darwin/arm64"},
+		Tools: map[string]ToolSpec{
+			"ansible": {Version: "9.1.0"},
+			"pywinrm": {Platforms: []string{"windows/amd64"}},
+		},
+	}
+	if v := b.PythonVersion(); v != "3.11" {
+		t.Errorf("PythonVersion = %s, want 3.11", v)
+	}
+	if got := b.LockPlatforms("darwin/arm64", []string{"linux/arm64", "linux/amd64"}); !reflect.DeepEqual(got, []string{"darwin/arm64", "linux/amd64", "linux/arm64"}) {
+		t.Errorf("LockPlatforms = %v", got)
+	}
+	if !b.Tools["ansible"].OnPlatform("linux/amd64") || b.Tools["pywinrm"].OnPlatform("linux/amd64") {
+		t.Error("OnPlatform ignored the tool's platforms")
+	}
+
+	lock := &Lock{Version: LockVersion}
+	ansible := lock.Put(LockedTool{Name: "ansible", Version: "9.1.0", Source: "pypi"})
+	ansible.SetResolution(LockedResolution{Platform: "linux/amd64", Python: "3.11", Requirements: []string{"ansible==9.1.0 --hash=sha256:aa"}})
+	ansible.SetResolution(LockedResolution{Platform: "darwin/arm64", Python: "3.11", Requirements: []string{"ansible==9.1.0 --hash=sha256:bb"}})
+	ansible.SetResolution(LockedResolution{Platform: "linux/amd64", Python: "3.11", Requirements: []string{"ansible==9.1.0 --hash=sha256:cc"}})
+	lock.Put(LockedTool{Name: "aws", Version: "2.15.0", Source: "archive"})
+
+	if len(lock.Tools) != 2 || lock.Tools[0].Name != "ansible" {
+		t.Fatalf("tools = %+v, want sorted", lock.Tools)
+	}
+	if r := lock.Tool("ansible").Resolution("linux/amd64", "3.11"); r == nil || r.Requirements[0] != "ansible==9.1.0 --hash=sha256:cc" {
+		t.Errorf("linux resolution = %+v, want the latest one", r)
+	}
+	if r := lock.Tool("ansible").Resolution("linux/amd64", "3.12"); r != nil {
+		t.Errorf("got a resolution for another Python: %+v", r)
+	}
+	if r := lock.Tool("missing").Resolution("linux/amd64", "3.11"); r != nil {
+		t.Error("a tool that isn't locked has a resolution")
+	}
+
+	// The resolutions survive the lock file and a dump at the same version
+	path := filepath.Join(t.TempDir(), "ophid.lock")
+	if err := lock.Write(path, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, lock) {
+		t.Errorf("LoadLock = %+v, want %+v", loaded, lock)
+	}
+
+	_, dumped := Dump(nil, []*tool.Tool{{Name: "ansible", Version: "9.1.0"}, {Name: "aws", Version: "2.16.0"}})
+	dumped.KeepResolutions(loaded)
+	if len(dumped.Tool("ansible").Resolved) != 2 {
+		t.Errorf("ansible lost its resolutions: %+v", dumped.Tool("ansible"))
+	}
+	_, upgraded := Dump(nil, []*tool.Tool{{Name: "ansible", Version: "9.2.0"}})
+	upgraded.KeepResolutions(loaded)
+	if len(upgraded.Tool("ansible").Resolved) != 0 {
+		t.Error("kept the resolutions of another version")
+	}
+}
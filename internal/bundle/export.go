@@ -0,0 +1,234 @@
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleicon/ophid/internal/runtime"
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+// ExportVersion is the format version written to export files
+const ExportVersion = 1
+
+// Export is a whole environment in one portable file: every runtime and
+// tool installed, with its exact version and source, and the packages of
+// each Python tool's venv. ophid export writes it as YAML or JSON and ophid
+// import installs it on another machine.
+type Export struct {
+	Version    int               `json:"version" yaml:"version"`
+	ExportedAt time.Time         `json:"exported_at" yaml:"exported_at"`
+	Platform   string            `json:"platform" yaml:"platform"` // os/arch it was exported on
+	Runtimes   []ExportedRuntime `json:"runtimes,omitempty" yaml:"runtimes,omitempty"`
+	Tools      []ExportedTool    `json:"tools,omitempty" yaml:"tools,omitempty"`
+}
+
+// ExportedRuntime is an installed runtime
+type ExportedRuntime struct {
+	Type    string `json:"type" yaml:"type"`
+	Version string `json:"version" yaml:"version"`
+}
+
+// ExportedTool is an installed tool and what reinstalls it
+type ExportedTool struct {
+	Name         string   `json:"name" yaml:"name"`
+	Version      string   `json:"version" yaml:"version"`
+	Ecosystem    string   `json:"ecosystem,omitempty" yaml:"ecosystem,omitempty"`
+	Source       string   `json:"source" yaml:"source"`
+	URL          string   `json:"url,omitempty" yaml:"url,omitempty"` // Git repository or registry package
+	Branch       string   `json:"branch,omitempty" yaml:"branch,omitempty"`
+	Tag          string   `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Commit       string   `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Path         string   `json:"path,omitempty" yaml:"path,omitempty"`
+	Subdirectory string   `json:"subdirectory,omitempty" yaml:"subdirectory,omitempty"`
+	Channel      string   `json:"channel,omitempty" yaml:"channel,omitempty"` // conda channel
+	Profile      string   `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Python       string   `json:"python,omitempty" yaml:"python,omitempty"` // Python version of the venv
+	BuildPolicy  string   `json:"build_policy,omitempty" yaml:"build_policy,omitempty"`
+	SmokeTest    []string `json:"smoke_test,omitempty" yaml:"smoke_test,omitempty"`
+	Packages     []string `json:"packages,omitempty" yaml:"packages,omitempty"` // pip freeze of the venv, from its lockfile
+}
+
+// NewExport snapshots installed runtimes and tools, with the packages the
+// lockfiles of Python tools record (tool name -> lock)
+func NewExport(runtimes []*runtime.Runtime, tools []*tool.Tool, locks map[string]*tool.ToolLock, platform string, now time.Time) *Export {
+	ex := &Export{Version: ExportVersion, ExportedAt: now.UTC().Truncate(time.Second), Platform: platform}
+
+	for _, rt := range runtimes {
+		ex.Runtimes = append(ex.Runtimes, ExportedRuntime{Type: string(rt.Type), Version: rt.Version})
+	}
+	sort.Slice(ex.Runtimes, func(i, j int) bool {
+		return ex.Runtimes[i].Spec() < ex.Runtimes[j].Spec()
+	})
+
+	for _, t := range tools {
+		source := t.Source.Type
+		if source == "" {
+			source = tool.SourcePyPI
+		}
+		exported := ExportedTool{
+			Name:         t.Name,
+			Version:      t.Version,
+			Ecosystem:    t.Ecosystem,
+			Source:       string(source),
+			URL:          t.Source.URL,
+			Branch:       t.Source.Branch,
+			Tag:          t.Source.Tag,
+			Commit:       t.Source.Commit,
+			Path:         t.Source.Path,
+			Subdirectory: t.Source.Subdirectory,
+			Channel:      t.Source.Metadata["channel"],
+			Profile:      t.Source.Metadata[tool.ProfileMetadataKey],
+			Python:       t.PythonVersion(),
+			BuildPolicy:  t.Metadata[tool.BuildPolicyKey],
+		}
+		if t.SmokeTest != nil {
+			exported.SmokeTest = t.SmokeTest.Command
+		}
+		if lock := locks[t.Name]; lock != nil && lock.Version == t.Version {
+			exported.Packages = lock.Packages
+			if exported.Python == "" {
+				exported.Python = lock.Python
+			}
+		}
+		ex.Tools = append(ex.Tools, exported)
+	}
+	sort.Slice(ex.Tools, func(i, j int) bool { return ex.Tools[i].Name < ex.Tools[j].Name })
+
+	return ex
+}
+
+// Spec returns the runtime as ophid runtime install takes it: python@3.12.1
+func (r ExportedRuntime) Spec() string {
+	return r.Type + "@" + r.Version
+}
+
+// InstallOptions returns the options that reinstall the tool from the
+// same source, at the same version
+func (t ExportedTool) InstallOptions() tool.InstallOptions {
+	opts := tool.InstallOptions{
+		Version:     t.Version,
+		Profile:     t.Profile,
+		SmokeTest:   t.SmokeTest,
+		BuildPolicy: tool.BuildPolicy(t.BuildPolicy),
+	}
+	if t.Profile != "" {
+		return opts
+	}
+
+	source := tool.InstallSource{
+		Type:         tool.SourceType(t.Source),
+		URL:          t.URL,
+		Branch:       t.Branch,
+		Tag:          t.Tag,
+		Commit:       t.Commit,
+		Path:         t.Path,
+		Subdirectory: t.Subdirectory,
+	}
+	switch source.Type {
+	case "", tool.SourcePyPI:
+		// A PyPI tool's package is its name
+		source.Type, source.URL = tool.SourcePyPI, t.Name
+	case tool.SourceConda:
+		source.Metadata = map[string]string{"channel": orDefault(t.Channel, tool.CondaDefaultChannel)}
+	case tool.SourceGitHub, tool.SourceGit, tool.SourceLocal:
+		// They install what their ref or directory holds
+		opts.Version = "latest"
+	}
+	if opts.Version == "unknown" {
+		opts.Version = "latest"
+	}
+	opts.Source = source
+	return opts
+}
+
+// Satisfied reports whether an installed tool is the exported one
+func (t ExportedTool) Satisfied(installed *tool.Tool) bool {
+	if t.Profile != "" {
+		return installed.Source.Metadata[tool.ProfileMetadataKey] == t.Profile && installed.Version == t.Version
+	}
+	source := installed.Source.Type
+	if source == "" {
+		source = tool.SourcePyPI
+	}
+	return string(source) == t.Source && installed.Version == t.Version &&
+		installed.Source.Commit == t.Commit && installed.Source.Path == t.Path &&
+		installed.Source.Subdirectory == t.Subdirectory
+}
+
+// LoadExport reads an export file, JSON or YAML
+func LoadExport(path string) (*Export, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+
+	var ex Export
+	if ExportFormat(path) == "json" {
+		err = json.Unmarshal(data, &ex)
+	} else {
+		// YAML is a superset of JSON, so exports of any name parse
+		err = yaml.Unmarshal(data, &ex)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if ex.Version == 0 {
+		return nil, fmt.Errorf("%s isn't an ophid export: it has no version", path)
+	}
+	if ex.Version > ExportVersion {
+		return nil, fmt.Errorf("%s has export format %d; this ophid reads up to %d", path, ex.Version, ExportVersion)
+	}
+	return &ex, nil
+}
+
+// ExportFormat returns the format of an export file by its extension:
+// json for .json, yaml otherwise
+func ExportFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return "json"
+	}
+	return "yaml"
+}
+
+// Encode returns the export as json or yaml, which ophid import reads, or
+// as a pipx script, requirements.txt or Poetry pyproject.toml
+func (ex *Export) Encode(format string) ([]byte, error) {
+	switch format {
+	case FormatPipx:
+		return ex.encodePipx(), nil
+	case FormatRequirements:
+		return ex.encodeRequirements(), nil
+	case FormatPoetry:
+		return ex.encodePoetry()
+	case "json":
+		data, err := json.MarshalIndent(ex, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case "yaml":
+		data, err := yaml.Marshal(ex)
+		if err != nil {
+			return nil, err
+		}
+		header := fmt.Sprintf("# Written by `ophid export` on %s. Install with: ophid import <file>\n", ex.ExportedAt.Format("2006-01-02"))
+		return append([]byte(header), data...), nil
+	}
+	return nil, fmt.Errorf("unsupported format %q: must be yaml, json, pipx, requirements or poetry", format)
+}
+
+// orDefault returns s, or def if s is empty
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
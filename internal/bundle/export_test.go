@@ -0,0 +1,112 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gleicon/ophid/internal/runtime"
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	runtimes := []*runtime.Runtime{
+		{Type: runtime.RuntimePython, Version: "3.12.1"},
+		{Type: runtime.RuntimeNode, Version: "20.11.0"},
+	}
+	tools := []*tool.Tool{
+		{Name: "ansible", Version: "9.1.0", Ecosystem: "python", Runtime: "python@3.12.1",
+			Source:    tool.InstallSource{Type: tool.SourcePyPI, URL: "ansible"},
+			SmokeTest: &tool.SmokeTest{Command: []string{"ansible", "--version"}},
+			Metadata:  map[string]string{tool.BuildPolicyKey: "only-binary"}},
+		{Name: "mytool", Version: "dev", Source: tool.InstallSource{Type: tool.SourceGitHub, URL: "https://github.com/acme/mytool", Tag: "v1.2.0", Commit: "abc123"}},
+		{Name: "gdal", Version: "3.8.4", Source: tool.InstallSource{Type: tool.SourceConda, URL: "gdal", Metadata: map[string]string{"channel": "conda-forge"}}},
+		{Name: "gcloud", Version: "494.0.0", Source: tool.InstallSource{Type: tool.SourceArchive, Metadata: map[string]string{tool.ProfileMetadataKey: "gcloud"}}},
+	}
+	locks := map[string]*tool.ToolLock{
+		"ansible": {Tool: "ansible", Version: "9.1.0", Python: "3.12.1", Packages: []string{"ansible==9.1.0", "PyYAML==6.0.1"}},
+	}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ex := NewExport(runtimes, tools, locks, "linux/amd64", now)
+
+	if got := []string{ex.Runtimes[0].Spec(), ex.Runtimes[1].Spec()}; !reflect.DeepEqual(got, []string{"node@20.11.0", "python@3.12.1"}) {
+		t.Errorf("runtimes = %v", got)
+	}
+	ansible := ex.Tools[0]
+	if ansible.Name != "ansible" || ansible.Python != "3.12.1" || len(ansible.Packages) != 2 || ansible.BuildPolicy != "only-binary" {
+		t.Errorf("ansible = %+v", ansible)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"env.yaml", "env.json"} {
+		data, err := ex.Encode(ExportFormat(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadExport(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, ex) {
+			t.Errorf("%s: LoadExport = %+v, want %+v", name, loaded, ex)
+		}
+	}
+
+	// Each tool reinstalls from where it came from, and is satisfied by
+	// what it was exported from
+	for i, exported := range ex.Tools {
+		opts := exported.InstallOptions()
+		switch exported.Name {
+		case "ansible":
+			if opts.Source.Type != tool.SourcePyPI || opts.Source.URL != "ansible" || opts.Version != "9.1.0" || len(opts.SmokeTest) != 2 {
+				t.Errorf("ansible options = %+v", opts)
+			}
+		case "mytool":
+			if opts.Source.Commit != "abc123" || opts.Version != "latest" {
+				t.Errorf("mytool options = %+v", opts)
+			}
+		case "gdal":
+			if opts.Source.Type != tool.SourceConda || opts.Source.Metadata["channel"] != "conda-forge" {
+				t.Errorf("gdal options = %+v", opts)
+			}
+		case "gcloud":
+			if opts.Profile != "gcloud" || opts.Version != "494.0.0" {
+				t.Errorf("gcloud options = %+v", opts)
+			}
+		}
+		for _, installed := range tools {
+			if installed.Name == exported.Name && !exported.Satisfied(installed) {
+				t.Errorf("tool %d (%s) isn't satisfied by what it was exported from", i, exported.Name)
+			}
+		}
+	}
+	upgraded := *tools[0]
+	upgraded.Version = "9.2.0"
+	if ansible.Satisfied(&upgraded) {
+		t.Error("another version satisfied the export")
+	}
+}
+
+func TestLoadExportErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"newer.yaml": "version: 99\n",
+		"plain.yaml": "tools: []\n",
+		"bad.json":   "{",
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		if _, err := LoadExport(path); err == nil {
+			t.Errorf("LoadExport(%s) succeeded", name)
+		}
+	}
+	if _, err := (&Export{}).Encode("toml"); err == nil {
+		t.Error("encoded an unsupported format")
+	}
+}
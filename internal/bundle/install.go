@@ -0,0 +1,185 @@
+package bundle
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gleicon/ophid/internal/runtime"
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+// commitRef matches refs that name a git commit rather than a tag or branch
+var commitRef = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// ToolNames returns the bundle's tool names, sorted
+func (b *Bundle) ToolNames() []string {
+	names := make([]string, 0, len(b.Tools))
+	for name := range b.Tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PythonVersion returns the major.minor version of the bundle's first
+// Python runtime, or "" when it lists none
+func (b *Bundle) PythonVersion() string {
+	for _, spec := range b.Runtimes {
+		if parsed, err := runtime.ParseRuntimeSpec(spec); err == nil && parsed.Type == runtime.RuntimePython {
+			return MinorVersion(parsed.Version)
+		}
+	}
+	return ""
+}
+
+// LockPlatforms returns the platforms a lock of the bundle is resolved
+// for: host, the bundle's platforms, then extra ones, without repeats
+func (b *Bundle) LockPlatforms(host string, extra []string) []string {
+	platforms := []string{host}
+	for _, p := range append(slices.Clone(b.Platforms), extra...) {
+		if !slices.Contains(platforms, p) {
+			platforms = append(platforms, p)
+		}
+	}
+	return platforms
+}
+
+// KeepPlatforms carries the platforms of an older bundle over, for a bundle
+// dumped over it
+func (b *Bundle) KeepPlatforms(old *Bundle) {
+	b.Platforms = old.Platforms
+	for name, spec := range b.Tools {
+		spec.Platforms = old.Tools[name].Platforms
+		b.Tools[name] = spec
+	}
+}
+
+// MinorVersion cuts a version to its major.minor: 3.12.1 -> 3.12
+func MinorVersion(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// Tool returns a tool of the lock, or nil
+func (l *Lock) Tool(name string) *LockedTool {
+	if l == nil {
+		return nil
+	}
+	for i := range l.Tools {
+		if l.Tools[i].Name == name {
+			return &l.Tools[i]
+		}
+	}
+	return nil
+}
+
+// Put adds a tool to the lock, or replaces the one of the same name, and
+// returns it
+func (l *Lock) Put(t LockedTool) *LockedTool {
+	if existing := l.Tool(t.Name); existing != nil {
+		*existing = t
+		return existing
+	}
+	l.Tools = append(l.Tools, t)
+	sort.Slice(l.Tools, func(i, j int) bool { return l.Tools[i].Name < l.Tools[j].Name })
+	return l.Tool(t.Name)
+}
+
+// KeepResolutions carries the resolutions of an older lock over to the
+// tools still locked at the same version and source
+func (l *Lock) KeepResolutions(old *Lock) {
+	for i := range l.Tools {
+		t := &l.Tools[i]
+		if prev := old.Tool(t.Name); prev != nil && prev.Version == t.Version && prev.Source == t.Source {
+			t.Resolved = prev.Resolved
+		}
+	}
+}
+
+// Resolution returns the packages locked for a platform and Python
+// version, or nil
+func (t *LockedTool) Resolution(platform, python string) *LockedResolution {
+	if t == nil {
+		return nil
+	}
+	for i := range t.Resolved {
+		if t.Resolved[i].Platform == platform && t.Resolved[i].Python == python {
+			return &t.Resolved[i]
+		}
+	}
+	return nil
+}
+
+// SetResolution records the packages resolved for a platform and Python
+// version, replacing the ones resolved before
+func (t *LockedTool) SetResolution(r LockedResolution) {
+	if existing := t.Resolution(r.Platform, r.Python); existing != nil {
+		*existing = r
+		return
+	}
+	t.Resolved = append(t.Resolved, r)
+	sort.Slice(t.Resolved, func(i, j int) bool {
+		return t.Resolved[i].Platform+" "+t.Resolved[i].Python < t.Resolved[j].Platform+" "+t.Resolved[j].Python
+	})
+}
+
+// InstallOptions returns the options that install a tool as the spec says,
+// pinned to the commit locked records when it's given
+func (s ToolSpec) InstallOptions(locked *LockedTool) tool.InstallOptions {
+	if s.Profile != "" {
+		return tool.InstallOptions{Profile: s.Profile, Version: s.Version}
+	}
+
+	opts := tool.InstallOptions{Version: s.Version}
+	if opts.Version == "" {
+		opts.Version = "latest"
+	}
+
+	switch tool.SourceType(s.Source) {
+	case tool.SourceGitHub, tool.SourceGit:
+		source := tool.InstallSource{Type: tool.SourceType(s.Source), URL: s.URL, Subdirectory: s.Subdirectory}
+		if commitRef.MatchString(s.Ref) {
+			source.Commit = s.Ref
+		} else {
+			// git clone --branch takes tags and branches alike
+			source.Tag = s.Ref
+		}
+		if locked != nil && locked.URL == s.URL && locked.Commit != "" {
+			source.Commit = locked.Commit
+		}
+		opts.Source = source
+	case tool.SourceLocal:
+		opts.Source = tool.InstallSource{Type: tool.SourceLocal, Path: s.Path, Subdirectory: s.Subdirectory}
+	}
+	return opts
+}
+
+// OnPlatform reports whether the spec installs on an os/arch
+func (s ToolSpec) OnPlatform(platform string) bool {
+	return len(s.Platforms) == 0 || slices.Contains(s.Platforms, platform)
+}
+
+// Satisfied reports whether an installed tool is what the spec asks for
+func (s ToolSpec) Satisfied(t *tool.Tool) bool {
+	versionOK := s.Version == "" || s.Version == t.Version
+	if s.Profile != "" {
+		return t.Source.Metadata[tool.ProfileMetadataKey] == s.Profile && versionOK
+	}
+
+	switch tool.SourceType(s.Source) {
+	case tool.SourceGitHub, tool.SourceGit:
+		if t.Source.Type != tool.SourceType(s.Source) || t.Source.URL != s.URL || t.Source.Subdirectory != s.Subdirectory {
+			return false
+		}
+		return s.Ref == "" || s.Ref == t.Source.Tag || s.Ref == t.Source.Branch ||
+			(t.Source.Commit != "" && strings.HasPrefix(t.Source.Commit, s.Ref))
+	case tool.SourceLocal:
+		return t.Source.Type == tool.SourceLocal && t.Source.Path == s.Path && t.Source.Subdirectory == s.Subdirectory
+	}
+	return (t.Source.Type == "" || t.Source.Type == tool.SourcePyPI) && versionOK
+}
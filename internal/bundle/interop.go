@@ -0,0 +1,293 @@
+package bundle
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+// Formats other Python tooling reads, for leaving ophid or working
+// alongside it. Only Python tools carry over; the others are listed as
+// not exported.
+const (
+	FormatPipx         = "pipx"         // Shell script of pipx installs
+	FormatRequirements = "requirements" // requirements.txt of one environment
+	FormatPoetry       = "poetry"       // pyproject.toml of a Poetry project
+)
+
+// pythonTools returns the tools pip can install, and the names, with
+// their source, of those it can't
+func (ex *Export) pythonTools() ([]ExportedTool, []string) {
+	var python []ExportedTool
+	var skipped []string
+	for _, t := range ex.Tools {
+		switch tool.SourceType(t.Source) {
+		case tool.SourcePyPI, tool.SourceGitHub, tool.SourceGit, tool.SourceLocal:
+			if t.Ecosystem == "" || t.Ecosystem == "python" {
+				python = append(python, t)
+				continue
+			}
+		}
+		skipped = append(skipped, fmt.Sprintf("%s (%s)", t.Name, orDefault(t.Ecosystem, t.Source)))
+	}
+	return python, skipped
+}
+
+// gitRef returns the ref a git tool was installed at: its commit, else
+// its tag or branch
+func (t ExportedTool) gitRef() string {
+	for _, ref := range []string{t.Commit, t.Tag, t.Branch} {
+		if ref != "" {
+			return ref
+		}
+	}
+	return ""
+}
+
+// pinned reports whether the tool's version is one pip can pin
+func (t ExportedTool) pinned() bool {
+	return t.Version != "" && t.Version != "latest" && t.Version != "unknown" && t.Version != "dev"
+}
+
+// pipURL returns what pip installs the tool from without its name: the
+// PyPI requirement, a git+ URL at its ref, or its directory
+func (t ExportedTool) pipURL() string {
+	switch tool.SourceType(t.Source) {
+	case tool.SourceGitHub, tool.SourceGit:
+		url := "git+" + t.URL
+		if ref := t.gitRef(); ref != "" {
+			url += "@" + ref
+		}
+		if t.Subdirectory != "" {
+			url += "#subdirectory=" + t.Subdirectory
+		}
+		return url
+	case tool.SourceLocal:
+		return t.Path
+	}
+	if t.pinned() {
+		return t.Name + "==" + t.Version
+	}
+	return t.Name
+}
+
+// requirement returns the tool as a requirements.txt line, named
+func (t ExportedTool) requirement() string {
+	switch tool.SourceType(t.Source) {
+	case tool.SourceGitHub, tool.SourceGit:
+		return t.Name + " @ " + t.pipURL()
+	case tool.SourceLocal:
+		return t.Name + " @ file://" + t.Path
+	}
+	return t.pipURL()
+}
+
+// header returns the comment opening a file written in format
+func (ex *Export) header(format string, skipped []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Written by `ophid export --format %s` on %s from %s.\n", format, ex.ExportedAt.Format("2006-01-02"), ex.Platform)
+	if len(skipped) > 0 {
+		fmt.Fprintf(&b, "# Not exported, as pip doesn't install them: %s\n", strings.Join(skipped, ", "))
+	}
+	return b.String()
+}
+
+// encodePipx returns a script installing each Python tool with pipx, with
+// the Python of its venv and the packages its lockfile pins as constraints
+func (ex *Export) encodePipx() []byte {
+	tools, skipped := ex.pythonTools()
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString(ex.header(FormatPipx, skipped))
+	b.WriteString("set -e\n")
+	if len(tools) == 0 {
+		return []byte(b.String())
+	}
+	b.WriteString("constraints=$(mktemp)\ntrap 'rm -f \"$constraints\"' EXIT\n")
+
+	for _, t := range tools {
+		b.WriteString("\n")
+		args := []string{"pipx", "install"}
+		if minor := pythonMinor(t.Python); minor != "" {
+			args = append(args, "--python", "python"+minor)
+		}
+		var pipArgs []string
+		if tool.BuildPolicy(t.BuildPolicy) == tool.BuildOnlyBinary {
+			pipArgs = append(pipArgs, "--only-binary=:all:")
+		}
+		if pins := lockPins(t); len(pins) > 0 {
+			fmt.Fprintf(&b, "cat > \"$constraints\" <<'EOF'\n%s\nEOF\n", strings.Join(pins, "\n"))
+			pipArgs = append(pipArgs, "--constraint $constraints")
+		}
+		line := strings.Join(args, " ")
+		if len(pipArgs) > 0 {
+			line += " --pip-args \"" + strings.Join(pipArgs, " ") + "\""
+		}
+		fmt.Fprintf(&b, "%s %s\n", line, shellQuote(t.pipURL()))
+	}
+	return []byte(b.String())
+}
+
+// encodeRequirements returns a requirements.txt installing the Python
+// tools into one environment, with the packages their lockfiles pin. A
+// package two tools pin to different versions is left to pip, with a
+// comment saying which pins it had.
+func (ex *Export) encodeRequirements() []byte {
+	tools, skipped := ex.pythonTools()
+	var b strings.Builder
+	b.WriteString(ex.header(FormatRequirements, skipped))
+	if len(tools) == 0 {
+		return []byte(b.String())
+	}
+
+	own := make(map[string]bool, len(tools))
+	b.WriteString("\n# Tools\n")
+	for _, t := range tools {
+		own[normalizeName(t.Name)] = true
+		b.WriteString(t.requirement() + "\n")
+	}
+
+	pins := make(map[string]map[string][]string) // Package -> version -> tools
+	names := make(map[string]string)             // Package -> name as pinned
+	for _, t := range tools {
+		for _, pin := range lockPins(t) {
+			name, version, _ := strings.Cut(pin, "==")
+			key := normalizeName(name)
+			if own[key] {
+				continue
+			}
+			if pins[key] == nil {
+				pins[key] = make(map[string][]string)
+				names[key] = name
+			}
+			pins[key][version] = append(pins[key][version], t.Name)
+		}
+	}
+	if len(pins) == 0 {
+		return []byte(b.String())
+	}
+	keys := make([]string, 0, len(pins))
+	for key := range pins {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	b.WriteString("\n# Their dependencies, as their lockfiles pin them\n")
+	for _, key := range keys {
+		versions := pins[key]
+		if len(versions) == 1 {
+			for version := range versions {
+				b.WriteString(names[key] + "==" + version + "\n")
+			}
+			continue
+		}
+		var conflict []string
+		for version, by := range versions {
+			conflict = append(conflict, fmt.Sprintf("%s (%s)", version, strings.Join(by, ", ")))
+		}
+		sort.Strings(conflict)
+		fmt.Fprintf(&b, "%s  # pinned to %s\n", names[key], strings.Join(conflict, ", "))
+	}
+	return []byte(b.String())
+}
+
+// poetryDependency is a Poetry dependency that isn't a PyPI version
+type poetryDependency struct {
+	Git          string `toml:"git,omitempty"`
+	Rev          string `toml:"rev,omitempty"`
+	Subdirectory string `toml:"subdirectory,omitempty"`
+	Path         string `toml:"path,omitempty"`
+}
+
+// encodePoetry returns a pyproject.toml of a Poetry project, in non-package
+// mode, depending on the Python tools. Poetry resolves and locks their
+// dependencies itself.
+func (ex *Export) encodePoetry() ([]byte, error) {
+	tools, skipped := ex.pythonTools()
+	dependencies := map[string]any{}
+	python := ""
+	for _, t := range tools {
+		if minor := pythonMinor(t.Python); minor != "" && (python == "" || versionLess(minor, python)) {
+			python = minor
+		}
+		switch tool.SourceType(t.Source) {
+		case tool.SourceGitHub, tool.SourceGit:
+			dependencies[t.Name] = poetryDependency{Git: t.URL, Rev: t.gitRef(), Subdirectory: t.Subdirectory}
+		case tool.SourceLocal:
+			dependencies[t.Name] = poetryDependency{Path: t.Path}
+		default:
+			if t.pinned() {
+				dependencies[t.Name] = t.Version
+			} else {
+				dependencies[t.Name] = "*"
+			}
+		}
+	}
+	if python != "" {
+		dependencies["python"] = ">=" + python
+	}
+
+	var project struct {
+		Tool struct {
+			Poetry struct {
+				PackageMode  bool           `toml:"package-mode"`
+				Dependencies map[string]any `toml:"dependencies"`
+			} `toml:"poetry"`
+		} `toml:"tool"`
+	}
+	project.Tool.Poetry.Dependencies = dependencies
+	data, err := toml.Marshal(project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode pyproject.toml: %w", err)
+	}
+	return append([]byte(ex.header(FormatPoetry, skipped)), data...), nil
+}
+
+// lockPins returns the name==version lines of a tool's lockfile; packages
+// installed from URLs or directories can't be pinned by version
+func lockPins(t ExportedTool) []string {
+	var pins []string
+	for _, line := range t.Packages {
+		if name, version, ok := strings.Cut(line, "=="); ok && name != "" && version != "" && !strings.ContainsAny(line, " @") {
+			pins = append(pins, line)
+		}
+	}
+	return pins
+}
+
+// pythonMinor returns the major.minor of a Python version: 3.12 of 3.12.1
+func pythonMinor(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// versionLess compares two dotted numeric versions
+func versionLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for n := 0; n < len(as) && n < len(bs); n++ {
+		var x, y int
+		fmt.Sscan(as[n], &x)
+		fmt.Sscan(bs[n], &y)
+		if x != y {
+			return x < y
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// normalizeName normalizes a Python project name as PEP 503 does
+func normalizeName(name string) string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(name))
+}
+
+// shellQuote quotes s for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,107 @@
+package bundle
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+// interopExport is an export of PyPI, git and local Python tools, and a
+// conda one pip can't install
+func interopExport() *Export {
+	tools := []*tool.Tool{
+		{Name: "ansible", Version: "9.1.0", Ecosystem: "python", Runtime: "python@3.12.1",
+			Source:   tool.InstallSource{Type: tool.SourcePyPI, URL: "ansible"},
+			Metadata: map[string]string{tool.BuildPolicyKey: "only-binary"}},
+		{Name: "httpie", Version: "3.2.2", Ecosystem: "python", Runtime: "python@3.11.7",
+			Source: tool.InstallSource{Type: tool.SourcePyPI, URL: "httpie"}},
+		{Name: "mytool", Version: "dev", Ecosystem: "python",
+			Source: tool.InstallSource{Type: tool.SourceGitHub, URL: "https://github.com/acme/mytool", Commit: "abc123", Subdirectory: "cli"}},
+		{Name: "scripts", Version: "0.1.0", Ecosystem: "python", Source: tool.InstallSource{Type: tool.SourceLocal, Path: "/src/scripts"}},
+		{Name: "gdal", Version: "3.8.4", Ecosystem: "conda", Source: tool.InstallSource{Type: tool.SourceConda, URL: "gdal"}},
+	}
+	locks := map[string]*tool.ToolLock{
+		"ansible": {Tool: "ansible", Version: "9.1.0", Packages: []string{"ansible==9.1.0", "PyYAML==6.0.1", "certifi==2024.2.2"}},
+		"httpie":  {Tool: "httpie", Version: "3.2.2", Packages: []string{"httpie==3.2.2", "pyyaml==6.0.1", "certifi==2023.7.22", "-e git+https://example.com/x@1#egg=x"}},
+	}
+	return NewExport(nil, tools, locks, "linux/amd64", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+}
+
+func TestEncodePipx(t *testing.T) {
+	data, err := interopExport().Encode(FormatPipx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := string(data)
+	for _, want := range []string{
+		"#!/bin/sh\n",
+		"# Not exported, as pip doesn't install them: gdal (conda)\n",
+		"pipx install --python python3.12 --pip-args \"--only-binary=:all: --constraint $constraints\" 'ansible==9.1.0'\n",
+		"pipx install --python python3.11 --pip-args \"--constraint $constraints\" 'httpie==3.2.2'\n",
+		"pipx install 'git+https://github.com/acme/mytool@abc123#subdirectory=cli'\n",
+		"pipx install '/src/scripts'\n",
+		"<<'EOF'\nhttpie==3.2.2\npyyaml==6.0.1\ncertifi==2023.7.22\nEOF\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("pipx script lacks %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestEncodeRequirements(t *testing.T) {
+	data, err := interopExport().Encode(FormatRequirements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requirements := string(data)
+	for _, want := range []string{
+		"\nansible==9.1.0\nhttpie==3.2.2\nmytool @ git+https://github.com/acme/mytool@abc123#subdirectory=cli\nscripts @ file:///src/scripts\n",
+		// Pins the tools agree on stay; the others are left to pip
+		"\nPyYAML==6.0.1\n",
+		"\ncertifi  # pinned to 2023.7.22 (httpie), 2024.2.2 (ansible)\n",
+	} {
+		if !strings.Contains(requirements, want) {
+			t.Errorf("requirements lack %q:\n%s", want, requirements)
+		}
+	}
+	if strings.Contains(requirements, "egg=x") || strings.Count(requirements, "ansible==") != 1 {
+		t.Errorf("requirements repeat a tool or pin an editable package:\n%s", requirements)
+	}
+}
+
+func TestEncodePoetry(t *testing.T) {
+	data, err := interopExport().Encode(FormatPoetry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var project struct {
+		Tool struct {
+			Poetry struct {
+				PackageMode  bool           `toml:"package-mode"`
+				Dependencies map[string]any `toml:"dependencies"`
+			} `toml:"poetry"`
+		} `toml:"tool"`
+	}
+	if err := toml.Unmarshal(data, &project); err != nil {
+		t.Fatalf("invalid pyproject.toml: %v\n%s", err, data)
+	}
+	poetry := project.Tool.Poetry
+	if poetry.PackageMode {
+		t.Error("the project should be in non-package mode")
+	}
+	deps := poetry.Dependencies
+	if deps["python"] != ">=3.11" || deps["ansible"] != "9.1.0" || deps["gdal"] != nil {
+		t.Errorf("dependencies = %v", deps)
+	}
+	mytool, _ := deps["mytool"].(map[string]any)
+	if mytool["git"] != "https://github.com/acme/mytool" || mytool["rev"] != "abc123" || mytool["subdirectory"] != "cli" {
+		t.Errorf("mytool = %v", deps["mytool"])
+	}
+	if scripts, _ := deps["scripts"].(map[string]any); scripts["path"] != "/src/scripts" {
+		t.Errorf("scripts = %v", deps["scripts"])
+	}
+}
@@ -0,0 +1,217 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Bundles are signed with Ed25519 team keys: ophid bundle sign writes the
+// SHA-256 of ophid.toml and of its lock, signed, to ophid.toml.sig, and
+// machines trusting the team's public key refuse a bundle whose files
+// don't match it.
+const (
+	signatureHeader = "ophid-signature v1"
+	publicKeyType   = "ophid-ed25519"
+	privateKeyPEM   = "OPHID PRIVATE KEY"
+)
+
+// PublicKey is a public key bundles are verified with, written on one
+// line as "ophid-ed25519 <base64> [comment]"
+type PublicKey struct {
+	Key     ed25519.PublicKey
+	Comment string // Who the key is, like "platform-team"
+}
+
+// ID returns the key's fingerprint, which signatures name their key by
+func (k PublicKey) ID() string {
+	sum := sha256.Sum256(k.Key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// String returns the key as a trusted_keys line
+func (k PublicKey) String() string {
+	line := publicKeyType + " " + base64.StdEncoding.EncodeToString(k.Key)
+	if k.Comment != "" {
+		line += " " + k.Comment
+	}
+	return line
+}
+
+// ParsePublicKey parses a public key line
+func ParsePublicKey(line string) (PublicKey, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != publicKeyType {
+		return PublicKey{}, fmt.Errorf("not an %s public key: %q", publicKeyType, line)
+	}
+	key, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return PublicKey{}, fmt.Errorf("invalid %s public key: %q", publicKeyType, line)
+	}
+	return PublicKey{Key: key, Comment: strings.Join(fields[2:], " ")}, nil
+}
+
+// LoadTrustedKeys returns the public keys of trusted_keys entries: key
+// lines, or files of them, one per line, with # comments
+func LoadTrustedKeys(entries []string) ([]PublicKey, error) {
+	var keys []PublicKey
+	for _, entry := range entries {
+		if strings.HasPrefix(strings.TrimSpace(entry), publicKeyType+" ") {
+			key, err := ParsePublicKey(entry)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			continue
+		}
+		data, err := os.ReadFile(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted key: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, err := ParsePublicKey(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", entry, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// GenerateKey returns a new signing key, PEM-encoded, and its public key
+func GenerateKey(comment string) ([]byte, PublicKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, PublicKey{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: privateKeyPEM, Bytes: private.Seed()})
+	return data, PublicKey{Key: public, Comment: comment}, nil
+}
+
+// LoadPrivateKey reads a signing key written by GenerateKey
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != privateKeyPEM || len(block.Bytes) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s isn't an ophid signing key (create one with: ophid bundle keygen)", path)
+	}
+	return ed25519.NewKeyFromSeed(block.Bytes), nil
+}
+
+// SignaturePath returns the signature file that goes with a bundle file:
+// ophid.toml -> ophid.toml.sig
+func SignaturePath(path string) string {
+	return path + ".sig"
+}
+
+// Sign returns the signature file of a bundle file and its lock, if it has
+// one. Without a lock the signature says so, so a lock added later, pinning
+// other commits, doesn't pass as signed.
+func Sign(path string, key ed25519.PrivateKey) ([]byte, error) {
+	signed, err := signedContent(path, PublicKey{Key: key.Public().(ed25519.PublicKey)}.ID())
+	if err != nil {
+		return nil, err
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, signed))
+	return append(signed, "signature: "+signature+"\n"...), nil
+}
+
+// Verify checks the signature file of a bundle file against the trusted
+// keys, and that neither the bundle nor its lock changed since it was
+// signed. It returns the key that signed them.
+func Verify(path string, keys []PublicKey) (PublicKey, error) {
+	data, err := os.ReadFile(SignaturePath(path))
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("failed to read signature: %w", err)
+	}
+	signed, signature, ok := bytes.Cut(data, []byte("signature: "))
+	if !ok || !bytes.HasPrefix(signed, []byte(signatureHeader+"\n")) {
+		return PublicKey{}, fmt.Errorf("%s isn't an ophid bundle signature", SignaturePath(path))
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("%s has an invalid signature", SignaturePath(path))
+	}
+
+	id := signatureField(signed, "key")
+	var key *PublicKey
+	for n := range keys {
+		if keys[n].ID() == id {
+			key = &keys[n]
+			break
+		}
+	}
+	if key == nil {
+		return PublicKey{}, fmt.Errorf("%s is signed by key %s, which isn't trusted", path, id)
+	}
+	if !ed25519.Verify(key.Key, signed, sig) {
+		return PublicKey{}, fmt.Errorf("the signature of %s doesn't verify with key %s", path, id)
+	}
+
+	// The signature is genuine; the files must be those it was made over
+	current, err := signedContent(path, id)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	for _, field := range []string{"bundle", "lock"} {
+		if signatureField(current, field) != signatureField(signed, field) {
+			file := path
+			if field == "lock" {
+				file = LockPath(path)
+			}
+			return PublicKey{}, fmt.Errorf("%s changed since it was signed", file)
+		}
+	}
+	return *key, nil
+}
+
+// signedContent returns what a signature of a bundle file signs: the
+// digests of the bundle and its lock, and the signing key
+func signedContent(path, keyID string) ([]byte, error) {
+	bundleDigest, err := fileDigest(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	lockDigest, err := fileDigest(LockPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		lockDigest = "none"
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	return []byte(fmt.Sprintf("%s\nkey: %s\nbundle: %s\nlock: %s\n", signatureHeader, keyID, bundleDigest, lockDigest)), nil
+}
+
+// fileDigest returns the SHA-256 of a file as sha256:<hex>
+func fileDigest(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// signatureField returns a field of signed content
+func signatureField(signed []byte, name string) string {
+	for _, line := range strings.Split(string(signed), "\n") {
+		if value, ok := strings.CutPrefix(line, name+": "); ok {
+			return value
+		}
+	}
+	return ""
+}
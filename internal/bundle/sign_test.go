@@ -0,0 +1,104 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// signedBundle writes a bundle and its lock signed with a new key, and
+// returns the bundle file and the key's public key
+func signedBundle(t *testing.T) (string, PublicKey) {
+	t.Helper()
+	dir := t.TempDir()
+	file := filepath.Join(dir, DefaultFile)
+	os.WriteFile(file, []byte("[tools.httpie]\nversion = \"3.2.2\"\n"), 0644)
+	os.WriteFile(LockPath(file), []byte("version = 1\n"), 0644)
+
+	private, public, err := GenerateKey("platform-team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "team.key")
+	os.WriteFile(keyFile, private, 0600)
+	key, err := LoadPrivateKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := Sign(file, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(SignaturePath(file), signature, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file, public
+}
+
+func TestVerify(t *testing.T) {
+	file, public := signedBundle(t)
+	trusted, err := LoadTrustedKeys([]string{public.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := Verify(file, trusted)
+	if err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	if key.Comment != "platform-team" || key.ID() != public.ID() {
+		t.Errorf("Verify() key = %s", key)
+	}
+
+	_, other, _ := GenerateKey("")
+	if _, err := Verify(file, []PublicKey{other}); err == nil || !strings.Contains(err.Error(), "isn't trusted") {
+		t.Errorf("Verify() with another key = %v", err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	tests := map[string]func(file string){
+		"bundle edited": func(file string) {
+			os.WriteFile(file, []byte("[tools.httpie]\nversion = \"3.2.3\"\n"), 0644)
+		},
+		"lock removed": func(file string) {
+			os.Remove(LockPath(file))
+		},
+		"signature forged": func(file string) {
+			data, _ := os.ReadFile(SignaturePath(file))
+			forged := strings.Replace(string(data), "lock: sha256:", "lock: sha256:0", 1)
+			os.WriteFile(SignaturePath(file), []byte(forged), 0644)
+		},
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			file, public := signedBundle(t)
+			tamper(file)
+			if _, err := Verify(file, []PublicKey{public}); err == nil {
+				t.Error("Verify() accepted a tampered bundle")
+			}
+		})
+	}
+}
+
+func TestLoadTrustedKeys(t *testing.T) {
+	_, a, _ := GenerateKey("alice")
+	_, b, _ := GenerateKey("")
+	keyFile := filepath.Join(t.TempDir(), "team.pub")
+	os.WriteFile(keyFile, []byte("# Platform team\n"+a.String()+"\n\n"+b.String()+"\n"), 0644)
+
+	keys, err := LoadTrustedKeys([]string{keyFile, a.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || keys[0].Comment != "alice" || keys[1].ID() != b.ID() {
+		t.Errorf("LoadTrustedKeys() = %v", keys)
+	}
+
+	if _, err := LoadTrustedKeys([]string{"ophid-ed25519 bm90IGEga2V5"}); err == nil {
+		t.Error("accepted a key of the wrong size")
+	}
+	if _, err := LoadTrustedKeys([]string{filepath.Join(t.TempDir(), "missing.pub")}); err == nil {
+		t.Error("accepted a missing key file")
+	}
+}
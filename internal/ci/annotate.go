@@ -0,0 +1,84 @@
+package ci
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Annotation levels
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelNotice  = "notice"
+)
+
+// Annotation formats
+const (
+	AnnotateGitHub  = "github"  // Workflow commands GitHub shows on the file and line
+	AnnotateCompact = "compact" // file:line: level: message, as compilers print
+)
+
+// Annotation is a finding tied to a file, and a line when known
+type Annotation struct {
+	Level   string
+	File    string
+	Line    int
+	Title   string
+	Message string
+}
+
+// Format prints an annotation in AnnotateGitHub or AnnotateCompact format
+func (a Annotation) Format(format string) string {
+	if format == AnnotateGitHub {
+		return a.GitHub()
+	}
+	return a.Compact()
+}
+
+// GitHub returns the workflow command of the annotation
+func (a Annotation) GitHub() string {
+	var props []string
+	if a.File != "" {
+		props = append(props, "file="+escapeProperty(a.File))
+	}
+	if a.Line > 0 {
+		props = append(props, fmt.Sprintf("line=%d", a.Line))
+	}
+	if a.Title != "" {
+		props = append(props, "title="+escapeProperty(a.Title))
+	}
+	command := "::" + a.Level
+	if len(props) > 0 {
+		command += " " + strings.Join(props, ",")
+	}
+	return command + "::" + escapeData(a.Message)
+}
+
+// Compact returns the annotation as "file:line: level: title: message", a
+// line problem matchers and compiler warning parsers read
+func (a Annotation) Compact() string {
+	var b strings.Builder
+	if a.File != "" {
+		b.WriteString(a.File)
+		if a.Line > 0 {
+			fmt.Fprintf(&b, ":%d", a.Line)
+		}
+		b.WriteString(": ")
+	}
+	b.WriteString(a.Level + ": ")
+	if a.Title != "" {
+		b.WriteString(a.Title + ": ")
+	}
+	b.WriteString(strings.Join(strings.Fields(a.Message), " "))
+	return b.String()
+}
+
+// escapeData escapes a workflow command message
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a workflow command property value
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
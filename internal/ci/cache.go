@@ -0,0 +1,188 @@
+package ci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SaveCache archives directories of the ophid home, e.g. "runtimes" and
+// "tools", to a .tar.gz. Venvs hold absolute paths, so the cache only works
+// for jobs with the same home directory, as CI runners of one image have.
+func SaveCache(archive, homeDir string, dirs ...string) error {
+	if err := os.MkdirAll(filepath.Dir(archive), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp := archive + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create cache: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, dir := range dirs {
+		root := filepath.Join(homeDir, dir)
+		if _, err := os.Lstat(root); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return addToTar(tw, homeDir, path)
+		})
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to cache %s: %w", dir, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	return os.Rename(tmp, archive)
+}
+
+// addToTar adds a file, directory or symlink under homeDir to an archive
+func addToTar(tw *tar.Writer, homeDir, path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(homeDir, path)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(rel)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(tw, src)
+	return err
+}
+
+// RestoreCache extracts a cache archive into the ophid home, replacing the
+// directories it holds
+func RestoreCache(archive, homeDir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("failed to open cache: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read cache: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	replaced := make(map[string]bool)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read cache: %w", err)
+		}
+
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("cache entry %q is outside the ophid home", header.Name)
+		}
+		top := strings.SplitN(filepath.ToSlash(name), "/", 2)[0]
+		if !replaced[top] {
+			if err := os.RemoveAll(filepath.Join(homeDir, top)); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", top, err)
+			}
+			replaced[top] = true
+		}
+		target := filepath.Join(homeDir, name)
+		if err := checkParents(homeDir, name); err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, header.FileInfo().Mode().Perm()|0700)
+		case tar.TypeSymlink:
+			err = os.Symlink(header.Linkname, target)
+		case tar.TypeReg:
+			err = extractFile(tr, target, header.FileInfo().Mode().Perm())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", header.Name, err)
+		}
+	}
+}
+
+// checkParents refuses to extract through a symlink the archive created,
+// which could point anywhere
+func checkParents(homeDir, name string) error {
+	dir := homeDir
+	parts := strings.Split(filepath.ToSlash(filepath.Dir(name)), "/")
+	for _, part := range parts {
+		if part == "." {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("cache entry %q is under a symlink", name)
+		}
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,113 @@
+// Package ci adapts ophid to CI systems: it writes step outputs and PATH
+// entries the way the CI expects them, formats findings as annotations
+// and caches installed runtimes and tools between jobs.
+package ci
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	goruntime "runtime"
+	"strings"
+
+	"github.com/gleicon/ophid/internal/remote"
+)
+
+// Output formats
+const (
+	FormatGitHub  = "github"  // GitHub Actions: $GITHUB_OUTPUT, $GITHUB_PATH and workflow commands
+	FormatGeneric = "generic" // Shell export lines to eval, for any other CI
+)
+
+// DetectFormat returns the format of the CI ophid runs in
+func DetectFormat(getenv func(string) string) string {
+	if getenv("GITHUB_ACTIONS") == "true" {
+		return FormatGitHub
+	}
+	return FormatGeneric
+}
+
+// Emitter hands step outputs and PATH entries to the CI
+type Emitter struct {
+	Format string
+	Stdout io.Writer // Where generic exports go
+	Getenv func(string) string
+}
+
+// NewEmitter creates an emitter for a format, writing exports to stdout
+func NewEmitter(format string) *Emitter {
+	return &Emitter{Format: format, Stdout: os.Stdout, Getenv: os.Getenv}
+}
+
+// Output sets a step output. Generic CI gets an OPHID_<NAME> variable.
+func (e *Emitter) Output(name, value string) error {
+	if e.Format == FormatGitHub {
+		return e.appendGitHub("GITHUB_OUTPUT", githubValue(name, value))
+	}
+	_, err := fmt.Fprintf(e.Stdout, "export %s=%s\n", EnvName(name), remote.ShellQuote(value))
+	return err
+}
+
+// Path puts dir in front of PATH for later steps
+func (e *Emitter) Path(dir string) error {
+	if e.Format == FormatGitHub {
+		return e.appendGitHub("GITHUB_PATH", dir+"\n")
+	}
+	_, err := fmt.Fprintf(e.Stdout, "export PATH=%s:\"$PATH\"\n", remote.ShellQuote(dir))
+	return err
+}
+
+// appendGitHub appends to one of the files GitHub Actions reads after a step
+func (e *Emitter) appendGitHub(variable, data string) error {
+	path := e.Getenv(variable)
+	if path == "" {
+		return fmt.Errorf("%s isn't set; is this a GitHub Actions step?", variable)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", variable, err)
+	}
+	if _, err := io.WriteString(f, data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", variable, err)
+	}
+	return f.Close()
+}
+
+// githubValue formats an output line, with a heredoc for multi-line values
+func githubValue(name, value string) string {
+	if !strings.ContainsAny(value, "\r\n") {
+		return name + "=" + value + "\n"
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	delimiter := "ghadelimiter_" + hex.EncodeToString(b)
+	return fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
+}
+
+// EnvName turns an output name into the variable generic CI gets:
+// ansible-version -> OPHID_ANSIBLE_VERSION, ophid-path -> OPHID_PATH
+func EnvName(name string) string {
+	return "OPHID_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, strings.TrimPrefix(name, "ophid-"))
+}
+
+// CacheKey identifies the installs of a bundle and its lock on this
+// platform, changing whenever either file does
+func CacheKey(bundleData, lockData []byte) string {
+	h := sha256.New()
+	h.Write(bundleData)
+	h.Write([]byte{0})
+	h.Write(lockData)
+	return fmt.Sprintf("ophid-%s-%s-%s", goruntime.GOOS, goruntime.GOARCH, hex.EncodeToString(h.Sum(nil))[:16])
+}
@@ -0,0 +1,112 @@
+package ci
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestEmitter(t *testing.T) {
+	dir := t.TempDir()
+	env := map[string]string{
+		"GITHUB_OUTPUT": filepath.Join(dir, "output"),
+		"GITHUB_PATH":   filepath.Join(dir, "path"),
+	}
+	e := &Emitter{Format: FormatGitHub, Getenv: func(k string) string { return env[k] }}
+	e.Output("ansible-version", "9.1.0")
+	e.Output("notes", "line one\nline two")
+	e.Path("/home/runner/.ophid/bin")
+
+	output, _ := os.ReadFile(env["GITHUB_OUTPUT"])
+	lines := strings.Split(string(output), "\n")
+	if lines[0] != "ansible-version=9.1.0" || !strings.HasPrefix(lines[1], "notes<<ghadelimiter_") ||
+		lines[2] != "line one" || lines[3] != "line two" || lines[4] != strings.TrimPrefix(lines[1], "notes<<") {
+		t.Errorf("GITHUB_OUTPUT = %q", output)
+	}
+	if path, _ := os.ReadFile(env["GITHUB_PATH"]); string(path) != "/home/runner/.ophid/bin\n" {
+		t.Errorf("GITHUB_PATH = %q", path)
+	}
+	if err := (&Emitter{Format: FormatGitHub, Getenv: func(string) string { return "" }}).Output("a", "b"); err == nil {
+		t.Error("wrote GitHub outputs without GITHUB_OUTPUT")
+	}
+
+	var out bytes.Buffer
+	e = &Emitter{Format: FormatGeneric, Stdout: &out}
+	e.Output("ansible-path", "/opt/it's here")
+	e.Path("/root/.ophid/bin")
+	want := "export OPHID_ANSIBLE_PATH='/opt/it'\\''s here'\nexport PATH=/root/.ophid/bin:\"$PATH\"\n"
+	if out.String() != want {
+		t.Errorf("generic output = %q, want %q", out.String(), want)
+	}
+
+	if EnvName("ophid-version") != "OPHID_VERSION" || EnvName("my.tool-path") != "OPHID_MY_TOOL_PATH" {
+		t.Error("EnvName")
+	}
+
+	if DetectFormat(func(k string) string { return map[string]string{"GITHUB_ACTIONS": "true"}[k] }) != FormatGitHub ||
+		DetectFormat(func(string) string { return "" }) != FormatGeneric {
+		t.Error("DetectFormat")
+	}
+}
+
+func TestAnnotation(t *testing.T) {
+	a := Annotation{Level: LevelError, File: "app/settings.py", Line: 12, Title: "aws-access-key", Message: "100% a key,\nrotate it"}
+	if got, want := a.GitHub(), "::error file=app/settings.py,line=12,title=aws-access-key::100%25 a key,%0Arotate it"; got != want {
+		t.Errorf("GitHub() = %q, want %q", got, want)
+	}
+	if got, want := a.Compact(), "app/settings.py:12: error: aws-access-key: 100% a key, rotate it"; got != want {
+		t.Errorf("Compact() = %q, want %q", got, want)
+	}
+	a = Annotation{Level: LevelWarning, File: "a:b,c.txt", Message: "m"}
+	if got := a.Format(AnnotateGitHub); got != "::warning file=a%3Ab%2Cc.txt::m" {
+		t.Errorf("GitHub() = %q", got)
+	}
+	if got := (Annotation{Level: LevelNotice, Message: "m"}).Compact(); got != "notice: m" {
+		t.Errorf("Compact() = %q", got)
+	}
+}
+
+func TestCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	home := t.TempDir()
+	os.MkdirAll(filepath.Join(home, "tools", "demo", "venv", "bin"), 0755)
+	os.WriteFile(filepath.Join(home, "tools", "manifest.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(home, "tools", "demo", "venv", "bin", "demo"), []byte("#!/bin/sh\n"), 0755)
+	os.Symlink("/usr/bin/python3", filepath.Join(home, "tools", "demo", "venv", "bin", "python"))
+	os.WriteFile(filepath.Join(home, "secrets.enc"), []byte("secret"), 0600)
+
+	archive := filepath.Join(t.TempDir(), "cache", "ophid.tar.gz")
+	if err := SaveCache(archive, home, "runtimes", "tools"); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := t.TempDir()
+	os.MkdirAll(filepath.Join(restored, "tools", "stale"), 0755)
+	if err := RestoreCache(archive, restored); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(restored, "tools", "demo", "venv", "bin", "demo")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("restored executable: %v, %v", info, err)
+	}
+	if link, err := os.Readlink(filepath.Join(restored, "tools", "demo", "venv", "bin", "python")); err != nil || link != "/usr/bin/python3" {
+		t.Errorf("restored symlink = %q, %v", link, err)
+	}
+	if _, err := os.Stat(filepath.Join(restored, "tools", "stale")); !os.IsNotExist(err) {
+		t.Error("restore kept a directory the cache doesn't have")
+	}
+	if _, err := os.Stat(filepath.Join(restored, "secrets.enc")); !os.IsNotExist(err) {
+		t.Error("cache holds files outside the cached directories")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	a, b := CacheKey([]byte("x"), nil), CacheKey([]byte("x"), []byte("lock"))
+	if a == b || a != CacheKey([]byte("x"), nil) || !strings.HasPrefix(a, "ophid-"+runtime.GOOS+"-"+runtime.GOARCH+"-") {
+		t.Errorf("CacheKey = %s, %s", a, b)
+	}
+}
@@ -0,0 +1,293 @@
+// Package clidoc generates man pages and markdown reference docs from a
+// cobra command tree, so the documentation can ship with the binary and be
+// read on machines without internet access.
+//
+// It is a small, dependency-free stand-in for cobra/doc: the roff is
+// written directly instead of going through a markdown converter.
+package clidoc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Header is the title line of the generated man pages
+type Header struct {
+	Section string    // Manual section, "1" if empty
+	Date    time.Time // Shown in the footer; today if zero
+	Source  string    // e.g. "ophid 0.3.0"
+	Manual  string    // e.g. "OPHID Manual"
+}
+
+// ManTree writes a man page for cmd and each of its subcommands to dir and
+// returns how many it wrote
+func ManTree(cmd *cobra.Command, dir string, header Header) (int, error) {
+	if header.Section == "" {
+		header.Section = "1"
+	}
+	if header.Date.IsZero() {
+		header.Date = time.Now()
+	}
+	return writeTree(cmd, dir, "."+header.Section, func(c *cobra.Command, w io.Writer) error {
+		return Man(c, w, header)
+	})
+}
+
+// MarkdownTree writes a markdown page for cmd and each of its subcommands
+// to dir and returns how many it wrote
+func MarkdownTree(cmd *cobra.Command, dir string) (int, error) {
+	return writeTree(cmd, dir, ".md", Markdown)
+}
+
+// writeTree writes a page for cmd and its available subcommands with gen
+func writeTree(cmd *cobra.Command, dir, ext string, gen func(*cobra.Command, io.Writer) error) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	count := 0
+	for _, c := range commands(cmd) {
+		var buf bytes.Buffer
+		if err := gen(c, &buf); err != nil {
+			return count, err
+		}
+		path := filepath.Join(dir, pageName(c)+ext)
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return count, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Man writes the man page of a single command
+func Man(cmd *cobra.Command, w io.Writer, header Header) error {
+	if header.Section == "" {
+		header.Section = "1"
+	}
+	if header.Date.IsZero() {
+		header.Date = time.Now()
+	}
+	description, examples := splitExamples(cmd)
+	if description == "" {
+		description = cmd.Short
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH %q %q %q %q %q\n", strings.ToUpper(pageName(cmd)), header.Section,
+		header.Date.Format("2006-01-02"), header.Source, header.Manual)
+	b.WriteString(".SH NAME\n")
+	fmt.Fprintf(&b, "%s \\- %s\n", roff(pageName(cmd)), roff(cmd.Short))
+	b.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(&b, ".B %s\n", roff(cmd.UseLine()))
+	if description != "" {
+		b.WriteString(".SH DESCRIPTION\n")
+		writeParagraphs(&b, description)
+	}
+	if flags := cmd.NonInheritedFlags(); flags.HasAvailableFlags() {
+		b.WriteString(".SH OPTIONS\n")
+		writeFlags(&b, flags)
+	}
+	if flags := cmd.InheritedFlags(); flags.HasAvailableFlags() {
+		b.WriteString(".SH OPTIONS INHERITED FROM PARENT COMMANDS\n")
+		writeFlags(&b, flags)
+	}
+	if examples != "" {
+		b.WriteString(".SH EXAMPLES\n.PP\n.nf\n")
+		b.WriteString(roffLines(examples))
+		b.WriteString(".fi\n")
+	}
+	if related := seeAlso(cmd); len(related) > 0 {
+		b.WriteString(".SH SEE ALSO\n")
+		refs := make([]string, len(related))
+		for i, c := range related {
+			refs[i] = fmt.Sprintf("\\fB%s\\fP(%s)", roff(pageName(c)), header.Section)
+		}
+		b.WriteString(strings.Join(refs, ", ") + "\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Markdown writes the markdown page of a single command
+func Markdown(cmd *cobra.Command, w io.Writer) error {
+	description, examples := splitExamples(cmd)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n%s\n\n", cmd.CommandPath(), cmd.Short)
+	fmt.Fprintf(&b, "```\n%s\n```\n\n", cmd.UseLine())
+	if description != "" {
+		fmt.Fprintf(&b, "%s\n\n", description)
+	}
+	if examples != "" {
+		fmt.Fprintf(&b, "## Examples\n\n```\n%s\n```\n\n", examples)
+	}
+	if flags := cmd.NonInheritedFlags(); flags.HasAvailableFlags() {
+		fmt.Fprintf(&b, "## Options\n\n```\n%s```\n\n", flags.FlagUsages())
+	}
+	if flags := cmd.InheritedFlags(); flags.HasAvailableFlags() {
+		fmt.Fprintf(&b, "## Options inherited from parent commands\n\n```\n%s```\n\n", flags.FlagUsages())
+	}
+	if related := seeAlso(cmd); len(related) > 0 {
+		b.WriteString("## See also\n\n")
+		for _, c := range related {
+			fmt.Fprintf(&b, "- [%s](%s.md) - %s\n", c.CommandPath(), pageName(c), c.Short)
+		}
+	}
+
+	_, err := io.WriteString(w, strings.TrimRight(b.String(), "\n")+"\n")
+	return err
+}
+
+// commands returns cmd and its documented subcommands, depth first
+func commands(cmd *cobra.Command) []*cobra.Command {
+	all := []*cobra.Command{cmd}
+	for _, c := range cmd.Commands() {
+		if documented(c) {
+			all = append(all, commands(c)...)
+		}
+	}
+	return all
+}
+
+// documented reports whether a subcommand gets a page of its own: help and
+// hidden or deprecated commands don't
+func documented(cmd *cobra.Command) bool {
+	return cmd.IsAvailableCommand() && !cmd.IsAdditionalHelpTopicCommand()
+}
+
+// seeAlso returns the parent and documented subcommands of cmd
+func seeAlso(cmd *cobra.Command) []*cobra.Command {
+	var related []*cobra.Command
+	if cmd.HasParent() {
+		related = append(related, cmd.Parent())
+	}
+	for _, c := range cmd.Commands() {
+		if documented(c) {
+			related = append(related, c)
+		}
+	}
+	return related
+}
+
+// pageName names a command's page after its path, e.g. ophid-runtime-install
+func pageName(cmd *cobra.Command) string {
+	return strings.ReplaceAll(cmd.CommandPath(), " ", "-")
+}
+
+// splitExamples returns a command's long description and examples. Commands
+// that keep their examples in a trailing "Examples:" paragraph of Long
+// have it moved to the examples.
+func splitExamples(cmd *cobra.Command) (description, examples string) {
+	description = strings.TrimSpace(cmd.Long)
+	examples = cmd.Example
+	if i := strings.LastIndex(description, "\n\nExamples:\n"); i >= 0 {
+		trailing := description[i+len("\n\nExamples:\n"):]
+		if !strings.Contains(trailing, "\n\n") {
+			description = strings.TrimSpace(description[:i])
+			examples = strings.TrimRight(trailing+"\n"+examples, "\n")
+		}
+	}
+	return description, dedent(examples)
+}
+
+// dedent removes the indentation all non-blank lines of s share
+func dedent(s string) string {
+	lines := strings.Split(s, "\n")
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if n := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			lines[i] = line[indent:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeParagraphs writes text as roff paragraphs. Paragraphs with indented
+// lines, such as lists and example commands, keep their layout.
+func writeParagraphs(b *strings.Builder, text string) {
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.Trim(paragraph, "\n")
+		if paragraph == "" {
+			continue
+		}
+		b.WriteString(".PP\n")
+		if strings.Contains(paragraph, "\n ") || strings.Contains(paragraph, "\n\t") || strings.HasPrefix(paragraph, " ") {
+			b.WriteString(".nf\n" + roffLines(paragraph) + ".fi\n")
+		} else {
+			b.WriteString(roffLines(paragraph))
+		}
+	}
+}
+
+// writeFlags writes flags as a roff tagged list
+func writeFlags(b *strings.Builder, flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+		name, usage := pflag.UnquoteUsage(f)
+		tag := "\\fB\\-\\-" + roff(f.Name) + "\\fP"
+		if f.Shorthand != "" && f.ShorthandDeprecated == "" {
+			tag = "\\fB\\-" + roff(f.Shorthand) + "\\fP, " + tag
+		}
+		if name != "" {
+			tag += " \\fI" + roff(name) + "\\fP"
+		}
+		if f.Deprecated != "" {
+			usage += " (deprecated: " + f.Deprecated + ")"
+		} else if !zeroDefault(f) {
+			if f.Value.Type() == "string" {
+				usage += fmt.Sprintf(" (default %q)", f.DefValue)
+			} else {
+				usage += fmt.Sprintf(" (default %s)", f.DefValue)
+			}
+		}
+		b.WriteString(".TP\n" + tag + "\n" + roffLines(usage))
+	})
+}
+
+// zeroDefault reports whether a flag's default is not worth showing
+func zeroDefault(f *pflag.Flag) bool {
+	switch f.DefValue {
+	case "", "false", "0", "0s", "[]", "map[]", "<nil>":
+		return true
+	}
+	return false
+}
+
+// roffLines escapes text for roff and ends it with a newline. Lines that
+// would read as requests get a zero-width escape in front.
+func roffLines(text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		line = roff(line)
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			line = "\\&" + line
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// roff escapes the characters roff would interpret in running text
+func roff(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\e")
+	return strings.ReplaceAll(s, "-", "\\-")
+}
@@ -0,0 +1,120 @@
+package clidoc
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func testTree() *cobra.Command {
+	root := &cobra.Command{Use: "ophid", Short: "Operations Python Hybrid Distribution"}
+	root.PersistentFlags().Bool("no-color", false, "Don't color output")
+
+	runtime := &cobra.Command{Use: "runtime", Short: "Manage runtimes"}
+	install := &cobra.Command{
+		Use:   "install [runtime@version]",
+		Short: "Install a runtime",
+		Long: `Install a runtime interpreter.
+
+Formats:
+  python@3.12.1
+  rust@stable
+
+.tool-versions files are read too.
+
+Examples:
+  ophid runtime install python@3.12.1
+  ophid runtime install rust@stable`,
+		Run: func(*cobra.Command, []string) {},
+	}
+	install.Flags().StringP("mirror", "m", "https://example.com", "Download `url`")
+	install.Flags().Bool("force", false, "Reinstall")
+	runtime.AddCommand(install)
+
+	doctor := &cobra.Command{
+		Use:     "doctor",
+		Short:   "Diagnose issues",
+		Example: "  ophid doctor --fix",
+		Run:     func(*cobra.Command, []string) {},
+	}
+	hidden := &cobra.Command{Use: "debug", Hidden: true, Run: func(*cobra.Command, []string) {}}
+	root.AddCommand(runtime, doctor, hidden)
+	root.InitDefaultHelpCmd()
+	return root
+}
+
+func TestManTree(t *testing.T) {
+	dir := t.TempDir()
+	n, err := ManTree(testTree(), dir, Header{Date: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), Source: "ophid 1.0.0"})
+	if err != nil {
+		t.Fatalf("ManTree() error = %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"ophid-doctor.1", "ophid-runtime-install.1", "ophid-runtime.1", "ophid.1"}
+	if n != len(want) || !slices.Equal(names, want) {
+		t.Fatalf("ManTree() wrote %d: %v, want %v", n, names, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "ophid-runtime-install.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		`.TH "OPHID-RUNTIME-INSTALL" "1" "2026-01-02" "ophid 1.0.0" ""`,
+		`ophid\-runtime\-install \- Install a runtime`,
+		".SH DESCRIPTION\n.PP\nInstall a runtime interpreter.\n.PP\n.nf\nFormats:\n  python@3.12.1\n",
+		"\\&.tool\\-versions files are read too.",
+		".TP\n\\fB\\-m\\fP, \\fB\\-\\-mirror\\fP \\fIurl\\fP\nDownload url (default \"https://example.com\")\n",
+		".TP\n\\fB\\-\\-force\\fP\nReinstall\n",
+		".SH OPTIONS INHERITED FROM PARENT COMMANDS\n.TP\n\\fB\\-\\-no\\-color\\fP\n",
+		".SH EXAMPLES\n.PP\n.nf\nophid runtime install python@3.12.1\nophid runtime install rust@stable\n.fi\n",
+		".SH SEE ALSO\n\\fBophid\\-runtime\\fP(1)\n",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("man page lacks %q:\n%s", want, page)
+		}
+	}
+	if !strings.Contains(page, ".fi\n.PP\n\\&.tool\\-versions files are read too.\n.SH OPTIONS\n") {
+		t.Errorf("the examples weren't moved out of the description:\n%s", page)
+	}
+
+	root, err := os.ReadFile(filepath.Join(dir, "ophid.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(root), `\fBophid\-doctor\fP(1), \fBophid\-runtime\fP(1)`) || strings.Contains(string(root), "debug") {
+		t.Errorf("root SEE ALSO should list the visible subcommands:\n%s", root)
+	}
+}
+
+func TestMarkdownTree(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := MarkdownTree(testTree(), dir); err != nil {
+		t.Fatalf("MarkdownTree() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "ophid-doctor.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		"# ophid doctor\n\nDiagnose issues\n\n```\nophid doctor\n```\n\n## Examples",
+		"## Examples\n\n```\nophid doctor --fix\n```\n",
+		"## Options inherited from parent commands\n\n```\n      --no-color   Don't color output\n```\n",
+		"## See also\n\n- [ophid](ophid.md) - Operations Python Hybrid Distribution\n",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("markdown page lacks %q:\n%s", want, page)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+// Package config loads ophid's own settings from config.toml in the ophid
+// home: the default Python version, package index, outbound proxy, trusted
+// CAs, download rate, scan policy, cache limits, log level, event webhooks
+// and the keys bundles must be signed with. OPHID_* environment variables override the file, and command
+// flags override both.
+package config
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// File is the ophid config in the ophid home
+const File = "config.toml"
+
+// DefaultPythonVersion is the Python runtime used when none is configured
+const DefaultPythonVersion = "3.12.1"
+
+// Scan policies: what installs do about the security scan
+const (
+	ScanSkip  = "skip"  // Don't scan (--skip-scan)
+	ScanWarn  = "warn"  // Scan and warn about vulnerabilities (default)
+	ScanBlock = "block" // Refuse tools violating the security policy (--require-scan)
+)
+
+// Config is a config.toml
+type Config struct {
+	Python   PythonConfig   `toml:"python"`
+	Index    IndexConfig    `toml:"index"`
+	Proxy    ProxyConfig    `toml:"proxy"`
+	TLS      TLSConfig      `toml:"tls"`
+	Download DownloadConfig `toml:"download"`
+	Scan     ScanConfig     `toml:"scan"`
+	Cache    CacheConfig    `toml:"cache"`
+	Log      LogConfig      `toml:"log"`
+	Events   EventsConfig   `toml:"events,omitempty"`
+	Bundle   BundleConfig   `toml:"bundle,omitempty"`
+}
+
+// PythonConfig picks the Python runtime tools install with
+type PythonConfig struct {
+	Version string `toml:"version"`
+}
+
+// IndexConfig is the package index Python tools install from
+type IndexConfig struct {
+	URL string `toml:"url,omitempty"` // Instead of PyPI, like install --index-url
+}
+
+// ProxyConfig is the proxy ophid and the tools it runs (pip, git, cargo)
+// reach the network through
+type ProxyConfig struct {
+	HTTP     string `toml:"http,omitempty"`
+	HTTPS    string `toml:"https,omitempty"`
+	NoProxy  string `toml:"no_proxy,omitempty"`
+	CABundle string `toml:"ca_bundle,omitempty"` // Older spelling of one tls.ca_files entry; Load moves it there
+}
+
+// TLSConfig is the trust store of ophid's outbound TLS and of the tools it
+// runs
+type TLSConfig struct {
+	CAFiles []string `toml:"ca_files,omitempty"` // PEM root CAs trusted besides the system's, e.g. of a TLS-intercepting proxy
+}
+
+// DownloadConfig throttles the runtimes and artifacts ophid downloads
+type DownloadConfig struct {
+	LimitRate string `toml:"limit_rate,omitempty"` // Bytes per second, like 500K or 2M (--limit-rate)
+}
+
+// ScanConfig is the scan policy of installs
+type ScanConfig struct {
+	Policy string `toml:"policy"` // skip, warn or block
+}
+
+// CacheConfig limits ~/.ophid/cache; ophid cache clean and installs prune
+// it to these
+type CacheConfig struct {
+	MaxSize string `toml:"max_size,omitempty"` // Like 500M or 5G; the oldest files go first
+	MaxAge  string `toml:"max_age,omitempty"`  // Like 720h or 30d
+	Dedupe  string `toml:"dedupe,omitempty"`   // Sharing of identical files through ~/.ophid/store: auto (default), reflink or off
+}
+
+// LogConfig sets how much ophid logs
+type LogConfig struct {
+	Level string `toml:"level"` // debug, info, warn or error
+}
+
+// EventsConfig is where ophid's events are posted besides the event log
+type EventsConfig struct {
+	Webhooks []WebhookConfig `toml:"webhooks,omitempty"`
+}
+
+// WebhookConfig is a URL events are posted to (POST, JSON)
+type WebhookConfig struct {
+	URL   string   `toml:"url"`
+	Types []string `toml:"types,omitempty"` // Like "install.*" or "route.health"; all events without
+}
+
+// BundleConfig is who bundles installed here must be signed by
+type BundleConfig struct {
+	TrustedKeys []string `toml:"trusted_keys,omitempty"` // Public keys of ophid bundle keygen, or files of them; set, unsigned bundles are refused
+}
+
+// envOverrides are the environment variables overriding each setting
+var envOverrides = []struct {
+	name  string
+	field func(*Config) *string
+}{
+	{"OPHID_PYTHON_VERSION", func(c *Config) *string { return &c.Python.Version }},
+	{"OPHID_INDEX_URL", func(c *Config) *string { return &c.Index.URL }},
+	{"OPHID_HTTP_PROXY", func(c *Config) *string { return &c.Proxy.HTTP }},
+	{"OPHID_HTTPS_PROXY", func(c *Config) *string { return &c.Proxy.HTTPS }},
+	{"OPHID_NO_PROXY", func(c *Config) *string { return &c.Proxy.NoProxy }},
+	{"OPHID_CA_BUNDLE", func(c *Config) *string { return &c.Proxy.CABundle }},
+	{"OPHID_LIMIT_RATE", func(c *Config) *string { return &c.Download.LimitRate }},
+	{"OPHID_SCAN_POLICY", func(c *Config) *string { return &c.Scan.Policy }},
+	{"OPHID_CACHE_MAX_SIZE", func(c *Config) *string { return &c.Cache.MaxSize }},
+	{"OPHID_CACHE_MAX_AGE", func(c *Config) *string { return &c.Cache.MaxAge }},
+	{"OPHID_CACHE_DEDUPE", func(c *Config) *string { return &c.Cache.Dedupe }},
+	{"OPHID_LOG_LEVEL", func(c *Config) *string { return &c.Log.Level }},
+}
+
+// listEnvOverrides are the environment variables overriding list
+// settings, with entries separated like PATH
+var listEnvOverrides = []struct {
+	name  string
+	field func(*Config) *[]string
+}{
+	{"OPHID_CA_FILES", func(c *Config) *[]string { return &c.TLS.CAFiles }},
+	{"OPHID_TRUSTED_KEYS", func(c *Config) *[]string { return &c.Bundle.TrustedKeys }},
+}
+
+// EnvVars returns the names of the environment variables that override
+// the config
+func EnvVars() []string {
+	var names []string
+	for _, o := range envOverrides {
+		names = append(names, o.name)
+	}
+	for _, o := range listEnvOverrides {
+		names = append(names, o.name)
+	}
+	return names
+}
+
+// Default returns the config used without a config.toml
+func Default() *Config {
+	return &Config{
+		Python: PythonConfig{Version: DefaultPythonVersion},
+		Scan:   ScanConfig{Policy: ScanWarn},
+		Log:    LogConfig{Level: "info"},
+	}
+}
+
+// Path returns the config file of an ophid home
+func Path(homeDir string) string {
+	return filepath.Join(homeDir, File)
+}
+
+// Load reads the config of an ophid home and applies the environment
+// overrides. A missing file is the default config.
+func Load(homeDir string) (*Config, error) {
+	config := Default()
+	path := Path(homeDir)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err == nil {
+		if err := toml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	for _, o := range envOverrides {
+		if value, ok := os.LookupEnv(o.name); ok {
+			*o.field(config) = value
+		}
+	}
+	for _, o := range listEnvOverrides {
+		if value, ok := os.LookupEnv(o.name); ok {
+			*o.field(config) = filepath.SplitList(value)
+		}
+	}
+
+	// proxy.ca_bundle came before tls.ca_files and is one more CA file
+	if config.Proxy.CABundle != "" {
+		if !slices.Contains(config.TLS.CAFiles, config.Proxy.CABundle) {
+			config.TLS.CAFiles = append(config.TLS.CAFiles, config.Proxy.CABundle)
+		}
+		config.Proxy.CABundle = ""
+	}
+
+	// Empty settings in the file or environment mean the default
+	defaults := Default()
+	if config.Python.Version == "" {
+		config.Python.Version = defaults.Python.Version
+	}
+	if config.Scan.Policy == "" {
+		config.Scan.Policy = defaults.Scan.Policy
+	}
+	if config.Log.Level == "" {
+		config.Log.Level = defaults.Log.Level
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks the settings that have a fixed set of values or a format
+func (c *Config) Validate() error {
+	switch c.Scan.Policy {
+	case ScanSkip, ScanWarn, ScanBlock:
+	default:
+		return fmt.Errorf("unknown scan policy %q (available: %s, %s, %s)", c.Scan.Policy, ScanSkip, ScanWarn, ScanBlock)
+	}
+	if _, err := parseLevel(c.Log.Level); err != nil {
+		return err
+	}
+	if _, _, err := c.CacheLimits(); err != nil {
+		return err
+	}
+	switch c.Cache.Dedupe {
+	case "", "auto", "reflink", "off":
+	default:
+		return fmt.Errorf("unknown dedupe mode %q (available: auto, reflink, off)", c.Cache.Dedupe)
+	}
+	if _, err := c.LimitRate(); err != nil {
+		return err
+	}
+	for _, w := range c.Events.Webhooks {
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("events webhook %q must be an http(s) URL", w.URL)
+		}
+		for _, t := range w.Types {
+			if _, err := path.Match(t, ""); err != nil {
+				return fmt.Errorf("invalid event type pattern %q", t)
+			}
+		}
+	}
+	return nil
+}
+
+// LogLevel returns the configured log level
+func (c *Config) LogLevel() slog.Level {
+	level, _ := parseLevel(c.Log.Level)
+	return level
+}
+
+// CacheLimits returns the cache's maximum size in bytes and maximum file
+// age; zero means no limit
+func (c *Config) CacheLimits() (int64, time.Duration, error) {
+	var maxSize int64
+	var maxAge time.Duration
+	var err error
+	if c.Cache.MaxSize != "" {
+		if maxSize, err = parseSize(c.Cache.MaxSize); err != nil {
+			return 0, 0, err
+		}
+	}
+	if c.Cache.MaxAge != "" {
+		// No age is no limit, which an empty max_age already says
+		if maxAge, err = ParseAge(c.Cache.MaxAge); err != nil || maxAge == 0 {
+			return 0, 0, fmt.Errorf("invalid cache age %q (e.g. 720h, 30d)", c.Cache.MaxAge)
+		}
+	}
+	return maxSize, maxAge, nil
+}
+
+// LimitRate returns the download rate limit in bytes per second; zero
+// means no limit
+func (c *Config) LimitRate() (int64, error) {
+	if c.Download.LimitRate == "" {
+		return 0, nil
+	}
+	rate, err := parseSize(c.Download.LimitRate)
+	if err != nil {
+		return 0, fmt.Errorf("invalid download rate %q (e.g. 500K, 2M)", c.Download.LimitRate)
+	}
+	return rate, nil
+}
+
+// CAFiles returns the CA files trusted besides the system's
+func (c *Config) CAFiles() []string {
+	return slices.Clone(c.TLS.CAFiles)
+}
+
+// CABundlePath returns the CA bundle in the ophid home handed to the
+// tools ophid runs: the system's CAs and the configured ones
+func (c *Config) CABundlePath(homeDir string) string {
+	return filepath.Join(homeDir, "ca-bundle.pem")
+}
+
+// systemCABundles are where systems keep their CAs as one PEM file, as
+// Go's crypto/x509 looks for them; tests point it elsewhere
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Alpine
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora, RHEL
+	"/etc/ssl/ca-bundle.pem",                            // openSUSE
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS, RHEL 7
+	"/etc/ssl/cert.pem",                                 // macOS, BSDs
+}
+
+// caBundleVars are the variables pointing the tools ophid runs at a CA
+// bundle: pip, requests, curl, git, cargo and Node.js. All but Node.js's
+// replace the tool's default CAs with the bundle, which is why it holds
+// the system's CAs too.
+var caBundleVars = []string{"PIP_CERT", "REQUESTS_CA_BUNDLE", "CURL_CA_BUNDLE", "GIT_SSL_CAINFO", "CARGO_HTTP_CAINFO", "NODE_EXTRA_CA_CERTS"}
+
+// ApplyProxy exports the configured proxy as HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY, which Go's HTTP client and the tools ophid runs read. With CA
+// files configured, it writes them and the system's CAs to CABundlePath
+// and exports it to the variables of caBundleVars. ophid's own clients
+// trust the CA files through httpclient.Configure.
+func (c *Config) ApplyProxy(homeDir string) error {
+	for _, v := range []struct{ name, value string }{
+		{"HTTP_PROXY", c.Proxy.HTTP},
+		{"HTTPS_PROXY", c.Proxy.HTTPS},
+		{"NO_PROXY", c.Proxy.NoProxy},
+	} {
+		if v.value == "" {
+			continue
+		}
+		os.Setenv(v.name, v.value)
+		os.Setenv(strings.ToLower(v.name), v.value)
+	}
+	if len(c.TLS.CAFiles) == 0 {
+		return nil
+	}
+	path, err := c.WriteCABundle(homeDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range caBundleVars {
+		os.Setenv(name, path)
+	}
+	return nil
+}
+
+// WriteCABundle writes the system's CAs and the configured CA files to
+// CABundlePath, when that changes it, and returns its path
+func (c *Config) WriteCABundle(homeDir string) (string, error) {
+	var bundle []byte
+	system := systemCABundles
+	if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+		system = []string{file}
+	}
+	for _, file := range system {
+		if data, err := os.ReadFile(file); err == nil {
+			bundle = append(bundle, data...)
+			break
+		}
+	}
+	if len(bundle) == 0 {
+		slog.Warn("no system CA bundle found; tools ophid runs only trust the configured CAs")
+	}
+	for _, file := range c.TLS.CAFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read CA file: %w", err)
+		}
+		if block, _ := pem.Decode(data); block == nil || block.Type != "CERTIFICATE" {
+			return "", fmt.Errorf("no PEM certificates in CA file %s", file)
+		}
+		if len(bundle) > 0 && bundle[len(bundle)-1] != '\n' {
+			bundle = append(bundle, '\n')
+		}
+		bundle = append(bundle, data...)
+	}
+
+	path := c.CABundlePath(homeDir)
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, bundle) {
+		return path, nil
+	}
+	if err := os.MkdirAll(homeDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", homeDir, err)
+	}
+	// Through a temporary file, as commands run concurrently
+	tmp, err := os.CreateTemp(homeDir, ".ca-bundle-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write CA bundle: %w", err)
+	}
+	_, err = tmp.Write(bundle)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write CA bundle: %w", err)
+	}
+	return path, nil
+}
+
+// parseLevel parses a log level name
+func parseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (available: debug, info, warn, error)", s)
+	}
+	return level, nil
+}
+
+// parseSize parses a size like 500M or 5G
+func parseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i >= 0 {
+			multiplier = 1 << (10 * (i + 1))
+			s = s[:n-1]
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid cache size %q (e.g. 500M, 5G)", size)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// ParseAge parses a duration, which may also be in days like 30d
+func ParseAge(age string) (time.Duration, error) {
+	s := strings.TrimSpace(age)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid age %q (e.g. 72h, 30d)", age)
+}
+
+// Encode returns the config as TOML
+func (c *Config) Encode() ([]byte, error) {
+	data, err := toml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/pem"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	for _, name := range EnvVars() {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	home := t.TempDir()
+	config, err := Load(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, Default()) {
+		t.Errorf("without a config.toml got %+v, want the defaults", config)
+	}
+
+	os.WriteFile(filepath.Join(home, File), []byte(`
+[python]
+version = "3.11.7"
+
+[index]
+url = "https://pypi.corp.example/simple"
+
+[scan]
+policy = "block"
+
+[proxy]
+ca_bundle = "/etc/ssl/corp-ca.pem"
+
+[tls]
+ca_files = ["/etc/ssl/corp-root.pem"]
+
+[download]
+limit_rate = "2M"
+
+[cache]
+max_size = "2G"
+max_age = "30d"
+
+[log]
+level = "debug"
+`), 0644)
+	config, err = Load(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Python.Version != "3.11.7" || config.Index.URL != "https://pypi.corp.example/simple" || config.Scan.Policy != ScanBlock {
+		t.Errorf("config = %+v", config)
+	}
+	if config.LogLevel() != slog.LevelDebug {
+		t.Errorf("log level = %v, want debug", config.LogLevel())
+	}
+	maxSize, maxAge, _ := config.CacheLimits()
+	if maxSize != 2<<30 || maxAge != 30*24*time.Hour {
+		t.Errorf("cache limits = %d bytes, %v", maxSize, maxAge)
+	}
+	if rate, _ := config.LimitRate(); rate != 2<<20 {
+		t.Errorf("download rate = %d", rate)
+	}
+	if files := config.CAFiles(); !slices.Equal(files, []string{"/etc/ssl/corp-root.pem", "/etc/ssl/corp-ca.pem"}) || config.Proxy.CABundle != "" {
+		t.Errorf("CA files = %v, want tls.ca_files with proxy.ca_bundle moved into them", files)
+	}
+
+	// The environment overrides the file; empty means the default
+	t.Setenv("OPHID_PYTHON_VERSION", "3.13.0")
+	t.Setenv("OPHID_SCAN_POLICY", "")
+	config, err = Load(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Python.Version != "3.13.0" || config.Scan.Policy != ScanWarn {
+		t.Errorf("with overrides got python %s, scan %s", config.Python.Version, config.Scan.Policy)
+	}
+
+	t.Setenv("OPHID_CA_FILES", "/a.pem"+string(os.PathListSeparator)+"/b.pem")
+	t.Setenv("OPHID_TRUSTED_KEYS", "/etc/ophid/team.key.pub")
+	config, err = Load(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// proxy.ca_bundle of the file is still trusted next to them
+	if !slices.Equal(config.TLS.CAFiles, []string{"/a.pem", "/b.pem", "/etc/ssl/corp-ca.pem"}) {
+		t.Errorf("OPHID_CA_FILES gave %v", config.TLS.CAFiles)
+	}
+	if !slices.Equal(config.Bundle.TrustedKeys, []string{"/etc/ophid/team.key.pub"}) {
+		t.Errorf("OPHID_TRUSTED_KEYS gave %v", config.Bundle.TrustedKeys)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := map[string]string{
+		"OPHID_SCAN_POLICY":    "ignore",
+		"OPHID_LOG_LEVEL":      "verbose",
+		"OPHID_CACHE_MAX_SIZE": "lots",
+		"OPHID_CACHE_MAX_AGE":  "-1h",
+		"OPHID_CACHE_DEDUPE":   "copy",
+		"OPHID_LIMIT_RATE":     "fast",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := Load(t.TempDir()); err == nil {
+				t.Errorf("accepted %s=%s", name, value)
+			}
+		})
+	}
+
+	home := t.TempDir()
+	os.WriteFile(filepath.Join(home, File), []byte("[python\n"), 0644)
+	if _, err := Load(home); err == nil {
+		t.Error("accepted a config that isn't TOML")
+	}
+
+	os.WriteFile(filepath.Join(home, File), []byte("[[events.webhooks]]\nurl = \"ftp://hooks.example.com\"\n"), 0644)
+	if _, err := Load(home); err == nil {
+		t.Error("accepted a webhook that isn't http(s)")
+	}
+}
+
+func TestApplyProxy(t *testing.T) {
+	for _, name := range append([]string{"HTTPS_PROXY", "https_proxy", "SSL_CERT_FILE"}, caBundleVars...) {
+		t.Setenv(name, "")
+	}
+	os.Unsetenv("SSL_CERT_FILE")
+
+	dir := t.TempDir()
+	cert := func(name string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte(name)}), 0644)
+		return path
+	}
+	oldSystem := systemCABundles
+	systemCABundles = []string{filepath.Join(dir, "missing.pem"), cert("system.pem")}
+	t.Cleanup(func() { systemCABundles = oldSystem })
+
+	home := t.TempDir()
+	config := Default()
+	config.Proxy.HTTPS = "http://proxy.corp.example:3128"
+	config.TLS.CAFiles = []string{cert("corp-ca.pem")}
+	if err := config.ApplyProxy(home); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("https_proxy"); got != config.Proxy.HTTPS {
+		t.Errorf("https_proxy = %q", got)
+	}
+	bundle := config.CABundlePath(home)
+	for _, name := range caBundleVars {
+		if got := os.Getenv(name); got != bundle {
+			t.Errorf("%s = %q, want the CA bundle", name, got)
+		}
+	}
+
+	// The bundle replaces the tools' CAs, so it holds the system's too
+	data, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		names = append(names, string(block.Bytes))
+	}
+	if !slices.Equal(names, []string{"system.pem", "corp-ca.pem"}) {
+		t.Errorf("CA bundle holds %v, want the system's CAs and tls.ca_files", names)
+	}
+
+	config.TLS.CAFiles = []string{filepath.Join(dir, "README")}
+	os.WriteFile(config.TLS.CAFiles[0], []byte("not a certificate"), 0644)
+	if err := config.ApplyProxy(home); err == nil {
+		t.Error("accepted a CA file without certificates")
+	}
+}
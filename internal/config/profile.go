@@ -0,0 +1,59 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// ProfileEnv selects a profile like --profile does; ophid sets it for the
+// processes it starts, so the daemon and shims stay in the profile
+const ProfileEnv = "OPHID_PROFILE"
+
+// ProfilesDir holds the homes of named profiles, under the default home
+const ProfilesDir = "profiles"
+
+// DefaultProfile is the profile of the ophid home itself
+const DefaultProfile = "default"
+
+var profileName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// ValidateProfile checks a profile name, which becomes a directory name
+func ValidateProfile(name string) error {
+	if !profileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use letters, digits, '.', '-' and '_'", name)
+	}
+	return nil
+}
+
+// ProfileHome returns the ophid home of a profile: the default home for
+// "" and "default", else its own directory under profiles. Each profile
+// has its own config, manifest, runtimes, shims, store and daemon.
+func ProfileHome(homeDir, name string) string {
+	if name == "" || name == DefaultProfile {
+		return homeDir
+	}
+	return filepath.Join(homeDir, ProfilesDir, name)
+}
+
+// Profiles returns the named profiles of an ophid home, sorted
+func Profiles(homeDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(homeDir, ProfilesDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && ValidateProfile(e.Name()) == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
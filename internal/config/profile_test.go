@@ -0,0 +1,47 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	home := t.TempDir()
+	if names, err := Profiles(home); err != nil || names != nil {
+		t.Fatalf("Profiles() without profiles = %v, %v", names, err)
+	}
+
+	for _, name := range []string{"staging", "client-a"} {
+		os.MkdirAll(ProfileHome(home, name), 0700)
+	}
+	os.WriteFile(filepath.Join(home, ProfilesDir, "notes.txt"), nil, 0600)
+	names, err := Profiles(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"client-a", "staging"}) {
+		t.Errorf("Profiles() = %v", names)
+	}
+
+	if got := ProfileHome(home, ""); got != home {
+		t.Errorf("ProfileHome(\"\") = %s, want the home", got)
+	}
+	if got := ProfileHome(home, DefaultProfile); got != home {
+		t.Errorf("ProfileHome(default) = %s, want the home", got)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	for _, name := range []string{"staging", "client_a.prod", "v2"} {
+		if err := ValidateProfile(name); err != nil {
+			t.Errorf("ValidateProfile(%q): %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "..", ".hidden", "a/b", "with space"} {
+		if err := ValidateProfile(name); err == nil {
+			t.Errorf("ValidateProfile(%q) succeeded", name)
+		}
+	}
+}
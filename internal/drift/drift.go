@@ -0,0 +1,213 @@
+// Package drift compares what a host runs against what it declares: the
+// runtimes and tools of an ophid.toml and the processes of service files.
+package drift
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gleicon/ophid/internal/bundle"
+	"github.com/gleicon/ophid/internal/runtime"
+	"github.com/gleicon/ophid/internal/supervisor"
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+// Kinds of drift
+const (
+	Missing  = "missing"  // Declared, but not installed or not running
+	Extra    = "extra"    // Installed or running, but not declared
+	Mismatch = "mismatch" // Installed or running differently than declared
+)
+
+// Kinds of items
+const (
+	KindRuntime = "runtime"
+	KindTool    = "tool"
+	KindProcess = "process"
+)
+
+// Item is one difference between the declared and the actual environment
+type Item struct {
+	Kind  string `json:"kind"` // KindRuntime, KindTool or KindProcess
+	Name  string `json:"name"`
+	Drift string `json:"drift"`          // Missing, Extra or Mismatch
+	Want  string `json:"want,omitempty"` // What is declared
+	Have  string `json:"have,omitempty"` // What there is
+}
+
+func (i Item) String() string {
+	switch {
+	case i.Want != "" && i.Have != "":
+		return fmt.Sprintf("%s %s: %s (want %s, have %s)", i.Kind, i.Name, i.Drift, i.Want, i.Have)
+	case i.Want != "":
+		return fmt.Sprintf("%s %s: %s (want %s)", i.Kind, i.Name, i.Drift, i.Want)
+	case i.Have != "":
+		return fmt.Sprintf("%s %s: %s (have %s)", i.Kind, i.Name, i.Drift, i.Have)
+	}
+	return fmt.Sprintf("%s %s: %s", i.Kind, i.Name, i.Drift)
+}
+
+// CompareBundle compares installed runtimes and tools with a bundle.
+// Runtimes of several versions live side by side, so a runtime of another
+// version is missing one and an extra one, not a mismatch.
+func CompareBundle(b *bundle.Bundle, runtimes []*runtime.Runtime, tools []*tool.Tool) []Item {
+	var items []Item
+
+	declared := make(map[string]bool)
+	for _, spec := range b.Runtimes {
+		name := spec
+		if parsed, err := runtime.ParseRuntimeSpec(spec); err == nil {
+			name = fmt.Sprintf("%s@%s", parsed.Type, parsed.Version)
+		}
+		declared[name] = true
+	}
+	installed := make(map[string]bool)
+	for _, rt := range runtimes {
+		installed[fmt.Sprintf("%s@%s", rt.Type, rt.Version)] = true
+	}
+	for name := range declared {
+		if !installed[name] {
+			items = append(items, Item{Kind: KindRuntime, Name: name, Drift: Missing})
+		}
+	}
+	for name := range installed {
+		if !declared[name] {
+			items = append(items, Item{Kind: KindRuntime, Name: name, Drift: Extra})
+		}
+	}
+
+	byName := make(map[string]*tool.Tool)
+	for _, t := range tools {
+		byName[t.Name] = t
+	}
+	for name, spec := range b.Tools {
+		t, ok := byName[name]
+		switch {
+		case !ok && !spec.OnPlatform(tool.HostPlatform()):
+		case !ok:
+			items = append(items, Item{Kind: KindTool, Name: name, Drift: Missing, Want: describeSpec(spec)})
+		case !spec.Satisfied(t):
+			items = append(items, Item{Kind: KindTool, Name: name, Drift: Mismatch, Want: describeSpec(spec), Have: describeTool(t)})
+		}
+	}
+	for name, t := range byName {
+		if _, ok := b.Tools[name]; !ok {
+			items = append(items, Item{Kind: KindTool, Name: name, Drift: Extra, Have: describeTool(t)})
+		}
+	}
+
+	sortItems(items)
+	return items
+}
+
+// Service is a declared process
+type Service struct {
+	Config      supervisor.ProcessConfig
+	CompareArgs bool // Its arguments are fixed, not allocated ports that change on every start
+}
+
+// CompareProcesses compares declared services with the processes of a
+// supervisor state file. Running processes no service declares are extra.
+func CompareProcesses(services []Service, states []supervisor.ProcessState) []Item {
+	var items []Item
+
+	byName := make(map[string]supervisor.ProcessState)
+	for _, state := range states {
+		byName[state.Name] = state
+	}
+
+	declared := make(map[string]bool)
+	for _, service := range services {
+		config := service.Config
+		declared[config.Name] = true
+		want := strings.TrimSpace(config.Command + " " + strings.Join(config.Args, " "))
+
+		state, ok := byName[config.Name]
+		switch {
+		case !ok:
+			items = append(items, Item{Kind: KindProcess, Name: config.Name, Drift: Missing, Want: want, Have: "never started"})
+		case !state.Running():
+			items = append(items, Item{Kind: KindProcess, Name: config.Name, Drift: Missing, Want: want, Have: describeState(state)})
+		case state.Config.Command != config.Command || (service.CompareArgs && !slices.Equal(state.Config.Args, config.Args)):
+			have := strings.TrimSpace(state.Config.Command + " " + strings.Join(state.Config.Args, " "))
+			items = append(items, Item{Kind: KindProcess, Name: config.Name, Drift: Mismatch, Want: want, Have: have})
+		}
+	}
+	for _, state := range states {
+		if !declared[state.Name] && state.Running() {
+			items = append(items, Item{Kind: KindProcess, Name: state.Name, Drift: Extra, Have: describeState(state)})
+		}
+	}
+
+	sortItems(items)
+	return items
+}
+
+// describeSpec says what a bundle asks for
+func describeSpec(s bundle.ToolSpec) string {
+	switch {
+	case s.Profile != "":
+		return strings.TrimSpace("profile " + s.Profile + " " + s.Version)
+	case s.URL != "":
+		if s.Ref != "" {
+			return s.URL + "@" + s.Ref
+		}
+		return s.URL
+	case s.Path != "":
+		return s.Path
+	case s.Version != "":
+		return s.Version
+	}
+	return "any version"
+}
+
+// describeTool says what is installed
+func describeTool(t *tool.Tool) string {
+	if profile := t.Source.Metadata[tool.ProfileMetadataKey]; profile != "" {
+		return strings.TrimSpace("profile " + profile + " " + t.Version)
+	}
+	switch t.Source.Type {
+	case tool.SourceGitHub, tool.SourceGit:
+		ref := t.Source.Tag
+		if ref == "" {
+			ref = t.Source.Branch
+		}
+		if ref == "" && len(t.Source.Commit) >= 7 {
+			ref = t.Source.Commit[:7]
+		}
+		if ref != "" {
+			return t.Source.URL + "@" + ref
+		}
+		return t.Source.URL
+	case tool.SourceLocal:
+		return t.Source.Path
+	}
+	return t.Version
+}
+
+// describeState says how a process is
+func describeState(s supervisor.ProcessState) string {
+	if s.Running() {
+		return fmt.Sprintf("running, pid %d", s.PID)
+	}
+	if s.Status == supervisor.StatusRunning || s.Status == supervisor.StatusBackoff {
+		// The supervisor that wrote the state is gone
+		return fmt.Sprintf("pid %d is gone", s.PID)
+	}
+	if s.LastExit != "" {
+		return fmt.Sprintf("%s, %s", s.Status, s.LastExit)
+	}
+	return string(s.Status)
+}
+
+func sortItems(items []Item) {
+	order := map[string]int{KindRuntime: 0, KindTool: 1, KindProcess: 2}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return order[items[i].Kind] < order[items[j].Kind]
+		}
+		return items[i].Name < items[j].Name
+	})
+}
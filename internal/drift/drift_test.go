@@ -0,0 +1,94 @@
+package drift
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/bundle"
+	"github.com/gleicon/ophid/internal/runtime"
+	"github.com/gleicon/ophid/internal/supervisor"
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+func describe(items []Item) []string {
+	var got []string
+	for _, item := range items {
+		got = append(got, item.String())
+	}
+	return got
+}
+
+func TestCompareBundle(t *testing.T) {
+	b := &bundle.Bundle{
+		Runtimes: []string{"python@3.12.1", "node@20.0.0"},
+		Tools: map[string]bundle.ToolSpec{
+			"ansible": {Version: "9.1.0"},
+			"black":   {Version: "24.1.0"},
+			"runbook": {Source: "github", URL: "https://github.com/acme/runbook", Ref: "v2"},
+			"httpie":  {},
+			// Not for this platform, so not missing
+			"winrm": {Platforms: []string{"plan9/amd64"}},
+		},
+	}
+	runtimes := []*runtime.Runtime{
+		{Type: runtime.RuntimePython, Version: "3.12.1"},
+		{Type: runtime.RuntimePython, Version: "3.11.0"},
+	}
+	tools := []*tool.Tool{
+		{Name: "ansible", Version: "9.1.0"},
+		{Name: "black", Version: "23.0.0"},
+		{Name: "runbook", Source: tool.InstallSource{Type: tool.SourceGitHub, URL: "https://github.com/acme/runbook", Commit: "0123456789abcdef"}},
+		{Name: "yq", Version: "3.2.0"},
+	}
+
+	want := []string{
+		"runtime node@20.0.0: missing",
+		"runtime python@3.11.0: extra",
+		"tool black: mismatch (want 24.1.0, have 23.0.0)",
+		"tool httpie: missing (want any version)",
+		"tool runbook: mismatch (want https://github.com/acme/runbook@v2, have https://github.com/acme/runbook@0123456)",
+		"tool yq: extra (have 3.2.0)",
+	}
+	if got := describe(CompareBundle(b, runtimes, tools)); !reflect.DeepEqual(got, want) {
+		t.Errorf("CompareBundle =\n%q\nwant\n%q", got, want)
+	}
+
+	if items := CompareBundle(&bundle.Bundle{}, nil, nil); len(items) != 0 {
+		t.Errorf("empty environment drifted: %v", items)
+	}
+}
+
+func TestCompareProcesses(t *testing.T) {
+	self := os.Getpid()
+	services := []Service{
+		{Config: supervisor.ProcessConfig{Name: "web", Command: "gunicorn", Args: []string{"--bind", ":8100"}}, CompareArgs: true},
+		{Config: supervisor.ProcessConfig{Name: "api", Command: "uvicorn", Args: []string{"--port", "40123"}}},
+		{Config: supervisor.ProcessConfig{Name: "worker", Command: "celery"}},
+		{Config: supervisor.ProcessConfig{Name: "beat", Command: "celery"}},
+		{Config: supervisor.ProcessConfig{Name: "cron", Command: "cron"}},
+	}
+	states := []supervisor.ProcessState{
+		// Started by an older service file
+		{Name: "web", Status: supervisor.StatusRunning, PID: self, Config: supervisor.ProcessConfig{Command: "gunicorn", Args: []string{"--bind", ":8000"}}},
+		// Allocated ports differ on every start
+		{Name: "api", Status: supervisor.StatusRunning, PID: self, Config: supervisor.ProcessConfig{Command: "uvicorn", Args: []string{"--port", "40999"}}},
+		{Name: "worker", Status: supervisor.StatusFailed, LastExit: "exit 1"},
+		// A state file left by a supervisor that is gone
+		{Name: "beat", Status: supervisor.StatusRunning, PID: 1 << 30, Config: supervisor.ProcessConfig{Command: "celery"}},
+		{Name: "legacy", Status: supervisor.StatusRunning, PID: self, Config: supervisor.ProcessConfig{Command: "old"}},
+		{Name: "stopped", Status: supervisor.StatusStopped},
+	}
+
+	want := []string{
+		"process beat: missing (want celery, have pid 1073741824 is gone)",
+		"process cron: missing (want cron, have never started)",
+		"process legacy: extra (have running, pid " + strconv.Itoa(self) + ")",
+		"process web: mismatch (want gunicorn --bind :8100, have gunicorn --bind :8000)",
+		"process worker: missing (want celery, have failed, exit 1)",
+	}
+	if got := describe(CompareProcesses(services, states)); !reflect.DeepEqual(got, want) {
+		t.Errorf("CompareProcesses =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+// Package errcode classifies errors into a small set of codes, so scripts
+// and CI can branch on the kind of failure instead of parsing messages.
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"syscall"
+)
+
+// Code names a kind of failure
+type Code string
+
+// Error codes. Each has its own exit status, see ExitStatus.
+const (
+	Unknown       Code = "error"          // Anything not classified below
+	Network       Code = "network"        // A download or remote query failed
+	Verification  Code = "verification"   // A checksum or integrity check failed
+	PolicyBlocked Code = "policy_blocked" // A security policy refused the operation
+	NotFound      Code = "not_found"      // A tool, runtime, process or file doesn't exist
+	Conflict      Code = "conflict"       // Something is already installed, running or in use
+)
+
+// exitStatuses maps codes to exit statuses. 1 stays the generic failure;
+// the others are above the range tools commonly use for usage errors.
+var exitStatuses = map[Code]int{
+	Unknown:       1,
+	Network:       10,
+	Verification:  11,
+	PolicyBlocked: 12,
+	NotFound:      13,
+	Conflict:      14,
+}
+
+// Codes returns all codes in exit status order
+func Codes() []Code {
+	return []Code{Unknown, Network, Verification, PolicyBlocked, NotFound, Conflict}
+}
+
+// Error is an error with a code
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap attaches a code to err. It returns nil for a nil err.
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Errorf formats an error with a code, like fmt.Errorf
+func Errorf(code Code, format string, args ...any) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// Of returns the code of err: the outermost code attached with Wrap or
+// Errorf, or else one guessed from well-known errors in its chain
+func Of(err error) Code {
+	if err == nil {
+		return ""
+	}
+
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+
+	// Not net.Error: syscall.Errno implements it too
+	var urlErr *url.Error
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE), errors.Is(err, fs.ErrExist):
+		return Conflict
+	case errors.As(err, &urlErr), errors.As(err, &opErr), errors.As(err, &dnsErr):
+		return Network
+	case errors.Is(err, fs.ErrNotExist):
+		return NotFound
+	}
+	return Unknown
+}
+
+// ExitStatus returns the exit status for a code
+func ExitStatus(code Code) int {
+	if status, ok := exitStatuses[code]; ok {
+		return status
+	}
+	return exitStatuses[Unknown]
+}
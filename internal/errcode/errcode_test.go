@@ -0,0 +1,64 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestOf(t *testing.T) {
+	_, statErr := os.Stat("/nonexistent/ophid")
+
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{"nil", nil, ""},
+		{"plain", errors.New("boom"), Unknown},
+		{"coded", Errorf(PolicyBlocked, "blocked"), PolicyBlocked},
+		{"wrapped", fmt.Errorf("failed to install: %w", Wrap(Verification, errors.New("checksum mismatch"))), Verification},
+		{"outermost wins", Wrap(Conflict, fmt.Errorf("x: %w", Wrap(NotFound, errors.New("y")))), Conflict},
+		{"url error", fmt.Errorf("failed to download: %w", &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("refused")}), Network},
+		{"missing file", statErr, NotFound},
+		{"address in use", fmt.Errorf("failed to listen: %w", syscall.EADDRINUSE), Conflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Of(tt.err); got != tt.want {
+				t.Errorf("Of(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if Wrap(Network, nil) != nil {
+		t.Error("Wrap(nil) should be nil")
+	}
+
+	inner := errors.New("refused")
+	err := Wrap(Network, inner)
+	if err.Error() != "refused" || !errors.Is(err, inner) {
+		t.Errorf("Wrap changed the error: %v", err)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	seen := map[int]Code{}
+	for _, code := range Codes() {
+		status := ExitStatus(code)
+		if other, ok := seen[status]; ok {
+			t.Errorf("%s and %s share exit status %d", code, other, status)
+		}
+		seen[status] = code
+	}
+
+	if ExitStatus(Unknown) != 1 || ExitStatus("bogus") != 1 {
+		t.Error("unknown codes should exit 1")
+	}
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// webhookTimeout bounds each webhook request, and how long Flush waits
+// for the pending ones
+const webhookTimeout = 10 * time.Second
+
+// Webhook is a URL events are posted to (POST, JSON), optionally only
+// those of some types
+type Webhook struct {
+	URL   string
+	Types []string // Patterns like "install.*"; none posts every event
+}
+
+// Bus publishes events to the log and fans them out to webhooks
+type Bus struct {
+	log      *Log
+	webhooks []Webhook
+	client   *http.Client
+	pending  sync.WaitGroup
+}
+
+// NewBus creates a bus publishing to log and webhooks
+func NewBus(log *Log, webhooks []Webhook) *Bus {
+	return &Bus{
+		log:      log,
+		webhooks: webhooks,
+		client:   &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Publish records an event and posts it to the webhooks that want it, in
+// the background. Failures are logged: an event never fails what it is
+// about.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if err := b.log.Append(e); err != nil {
+		slog.Warn("failed to record event", "type", e.Type, "error", err)
+	}
+	for _, w := range b.webhooks {
+		if !e.Matches(w.Types) {
+			continue
+		}
+		b.pending.Add(1)
+		go func(w Webhook) {
+			defer b.pending.Done()
+			if err := b.post(w.URL, e); err != nil {
+				slog.Warn("failed to post event to webhook", "type", e.Type, "error", err)
+			}
+		}(w)
+	}
+}
+
+// post sends an event to a webhook
+func (b *Bus) post(url string, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	resp, err := b.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Flush waits for the webhook requests in flight, at most webhookTimeout
+func (b *Bus) Flush() {
+	done := make(chan struct{})
+	go func() {
+		b.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(webhookTimeout):
+	}
+}
+
+// bus is the bus Emit publishes to; nil until Configure, so that packages
+// used without an ophid home (tests) emit nothing
+var (
+	busMu sync.RWMutex
+	bus   *Bus
+)
+
+// Configure makes Emit publish to the event log of an ophid home and to
+// webhooks. It runs before any event is emitted.
+func Configure(homeDir string, webhooks []Webhook) {
+	busMu.Lock()
+	defer busMu.Unlock()
+	bus = NewBus(NewLog(homeDir), webhooks)
+}
+
+// Emit publishes an event to the configured bus, if any
+func Emit(typ Type, subject, message string, data map[string]string) {
+	busMu.RLock()
+	b := bus
+	busMu.RUnlock()
+	if b == nil {
+		return
+	}
+	b.Publish(Event{Type: typ, Subject: subject, Message: message, Data: data})
+}
+
+// Flush waits for the configured bus's webhook requests, before exiting
+func Flush() {
+	busMu.RLock()
+	b := bus
+	busMu.RUnlock()
+	if b != nil {
+		b.Flush()
+	}
+}
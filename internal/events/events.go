@@ -0,0 +1,263 @@
+// Package events records what ophid does: installs, scan findings, state
+// changes of supervised processes and proxy backends, and certificate
+// renewals. Events are appended to ~/.ophid/events/events.jsonl, which
+// keeps the newest ones and which every ophid process (the CLI, the daemon
+// and the proxy) writes to, and are posted to the configured webhooks, so
+// that external automation can react with ophid events --follow or a
+// webhook.
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Log size limits: once the file grows past maxLogBytes, only the newest
+// maxEvents events are kept, in at most half of maxLogBytes so that the
+// next trim is a while away
+const (
+	maxLogBytes = 2 << 20
+	maxEvents   = 2000
+)
+
+// followInterval is how often Follow looks for new events
+const followInterval = 500 * time.Millisecond
+
+// Type is what an event is about
+type Type string
+
+// Event types
+const (
+	InstallStarted  Type = "install.started"
+	InstallFinished Type = "install.finished"
+	InstallFailed   Type = "install.failed"
+	ScanFinding     Type = "scan.finding"  // A package with known vulnerabilities
+	ProcessState    Type = "process.state" // A supervised process changed status
+	RouteHealth     Type = "route.health"  // A proxy backend turned healthy or unhealthy
+	CertRenewed     Type = "cert.renewed"  // The proxy renewed an ACME certificate
+)
+
+// Types lists the event types, for help and validation
+var Types = []Type{InstallStarted, InstallFinished, InstallFailed, ScanFinding, ProcessState, RouteHealth, CertRenewed}
+
+// Event is something ophid did or noticed
+type Event struct {
+	Time    time.Time         `json:"time"`
+	Type    Type              `json:"type"`
+	Subject string            `json:"subject"` // Tool, package, process, backend or domain
+	Message string            `json:"message,omitempty"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// Matches reports whether the event's type matches one of patterns, like
+// "install.*"; no patterns match every event
+func (e Event) Matches(patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, string(e.Type)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Log is the append-only file events are kept in, bounded like a ring
+// buffer
+type Log struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewLog creates the event log of an ophid home
+func NewLog(homeDir string) *Log {
+	return &Log{path: filepath.Join(homeDir, "events", "events.jsonl")}
+}
+
+// Path returns the log's file
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append adds an event to the log, dropping the oldest ones once it is
+// full
+func (l *Log) Append(e Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create events directory: %w", err)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	var size int64
+	if info, statErr := f.Stat(); statErr == nil {
+		size = info.Size()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+
+	if size > maxLogBytes {
+		return l.trim()
+	}
+	return nil
+}
+
+// List returns the newest events, oldest first. limit <= 0 returns all.
+func (l *Log) List(limit int) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	evts := parse(data)
+	if limit > 0 && len(evts) > limit {
+		evts = evts[len(evts)-limit:]
+	}
+	return evts, nil
+}
+
+// Follow calls fn with each event appended to the log from now on, until
+// ctx is done. Events written by other processes are seen too.
+func (l *Log) Follow(ctx context.Context, fn func(Event)) error {
+	var offset int64
+	if info, err := os.Stat(l.path); err == nil {
+		offset = info.Size()
+	}
+	var last time.Time
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(l.path)
+		if os.IsNotExist(err) {
+			offset = 0
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read event log: %w", err)
+		}
+		// Trimmed: the newest events were rewritten from the start, some
+		// of them already seen
+		trimmed := info.Size() < offset
+		if trimmed {
+			offset = 0
+		}
+		if info.Size() == offset {
+			continue
+		}
+
+		data, err := readFrom(l.path, offset)
+		if err != nil {
+			return err
+		}
+		// A line still being written is read on the next tick
+		complete := bytes.LastIndexByte(data, '\n') + 1
+		offset += int64(complete)
+		for _, e := range parse(data[:complete]) {
+			if trimmed && !e.Time.After(last) {
+				continue
+			}
+			last = e.Time
+			fn(e)
+		}
+	}
+}
+
+// readFrom reads a file from offset to its end
+func readFrom(name string, offset int64) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	return data, nil
+}
+
+// parse decodes events, skipping lines that don't parse (e.g., a line cut
+// short by a crash)
+func parse(data []byte) []Event {
+	var evts []Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		evts = append(evts, e)
+	}
+	return evts
+}
+
+// trim drops all but the newest events, as the size limits say
+func (l *Log) trim() error {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to read event log: %w", err)
+	}
+	evts := parse(data)
+
+	var lines [][]byte
+	size := 0
+	for i := len(evts) - 1; i >= 0 && len(lines) < maxEvents; i-- {
+		line, err := json.Marshal(evts[i])
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		if size += len(line) + 1; size > maxLogBytes/2 {
+			break
+		}
+		lines = append(lines, line)
+	}
+	var buf bytes.Buffer
+	for i := len(lines) - 1; i >= 0; i-- {
+		buf.Write(lines[i])
+		buf.WriteByte('\n')
+	}
+
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+	return os.Rename(tmp, l.path)
+}
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogAppendAndList(t *testing.T) {
+	log := NewLog(t.TempDir())
+	if evts, err := log.List(0); err != nil || evts != nil {
+		t.Fatalf("List() of a missing log = %v, %v", evts, err)
+	}
+	for i := range 3 {
+		if err := log.Append(Event{Time: time.Now(), Type: InstallStarted, Subject: fmt.Sprintf("tool%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A line cut short by a crash is skipped
+	f, _ := os.OpenFile(log.Path(), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"type":"install.fin` + "\n")
+	f.Close()
+
+	evts, err := log.List(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evts) != 2 || evts[0].Subject != "tool1" || evts[1].Subject != "tool2" {
+		t.Errorf("List(2) = %+v, want the two newest, oldest first", evts)
+	}
+}
+
+func TestLogTrim(t *testing.T) {
+	log := NewLog(t.TempDir())
+	subject := strings.Repeat("x", 2000)
+	for i := range maxEvents + 100 {
+		if err := log.Append(Event{Type: ProcessState, Subject: subject, Message: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	evts, err := log.List(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evts) > maxEvents || evts[len(evts)-1].Message != fmt.Sprint(maxEvents+99) {
+		t.Errorf("kept %d events ending with %q, want at most %d ending with the newest", len(evts), evts[len(evts)-1].Message, maxEvents)
+	}
+	if info, _ := os.Stat(log.Path()); info.Size() > maxLogBytes {
+		t.Errorf("log is %d bytes, want it trimmed", info.Size())
+	}
+}
+
+func TestLogFollow(t *testing.T) {
+	log := NewLog(t.TempDir())
+	log.Append(Event{Time: time.Now(), Type: InstallStarted, Subject: "before"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	seen := make(chan Event, 10)
+	go log.Follow(ctx, func(e Event) { seen <- e })
+
+	time.Sleep(2 * followInterval)
+	log.Append(Event{Time: time.Now(), Type: InstallFinished, Subject: "after"})
+	select {
+	case e := <-seen:
+		if e.Subject != "after" {
+			t.Errorf("followed %+v, want only the event appended after following", e)
+		}
+	case <-ctx.Done():
+		t.Fatal("appended event wasn't followed")
+	}
+}
+
+func TestBusWebhooks(t *testing.T) {
+	var mu sync.Mutex
+	var posted []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		json.NewDecoder(r.Body).Decode(&e)
+		mu.Lock()
+		posted = append(posted, e)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	home := t.TempDir()
+	bus := NewBus(NewLog(home), []Webhook{{URL: server.URL, Types: []string{"install.*"}}})
+	bus.Publish(Event{Type: InstallFinished, Subject: "httpie"})
+	bus.Publish(Event{Type: RouteHealth, Subject: "http://127.0.0.1:8000"})
+	bus.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posted) != 1 || posted[0].Subject != "httpie" || posted[0].Time.IsZero() {
+		t.Errorf("posted %+v, want only the install event, with its time", posted)
+	}
+	if evts, _ := NewLog(home).List(0); len(evts) != 2 {
+		t.Errorf("logged %d events, want both", len(evts))
+	}
+}
+
+func TestEmitUnconfigured(t *testing.T) {
+	busMu.Lock()
+	bus = nil
+	busMu.Unlock()
+	// Nothing to publish to: a no-op, not a panic
+	Emit(InstallStarted, "httpie", "", nil)
+	Flush()
+}
@@ -0,0 +1,321 @@
+// Package githook runs ophid's scans from git: it installs pre-commit and
+// pre-push hooks, or a pre-commit framework entry, and reads the diffs and
+// file versions the hooks check.
+package githook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/security"
+)
+
+// Hooks ophid installs
+const (
+	PreCommit = "pre-commit"
+	PrePush   = "pre-push"
+)
+
+// Marker identifies hooks ophid wrote, which it may overwrite
+const Marker = "# Installed by ophid scan install-hook"
+
+// FrameworkConfig is the pre-commit framework's config file
+const FrameworkConfig = ".pre-commit-config.yaml"
+
+// FrameworkHookID is the id of ophid's entry in FrameworkConfig
+const FrameworkHookID = "ophid-scan"
+
+// emptyTree is git's well-known empty tree, the base of root commits
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// zeroSHA is what pre-push passes for a ref that doesn't exist on one side
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// Script returns the shell script of a hook running ophid scan changed
+func Script(hook string) string {
+	args, what, skip := "--staged", "committed", "git commit --no-verify"
+	if hook == PrePush {
+		args, what, skip = "--pre-push", "pushed", "git push --no-verify"
+	}
+	return fmt.Sprintf(`#!/bin/sh
+%s
+# Scans what is about to be %s for secrets and vulnerable dependencies.
+# Skip it once with %s.
+if ! command -v ophid >/dev/null 2>&1; then
+	echo "ophid not found in PATH, skipping the %s scan" >&2
+	exit 0
+fi
+exec ophid scan changed %s
+`, Marker, what, skip, hook, args)
+}
+
+// Install writes a hook into the hooks directory. It won't replace a hook
+// ophid didn't write unless force is set.
+func Install(hooksDir, hook string, force bool) (string, error) {
+	if hook != PreCommit && hook != PrePush {
+		return "", fmt.Errorf("unknown hook %q", hook)
+	}
+	path := filepath.Join(hooksDir, hook)
+	existing, err := os.ReadFile(path)
+	if err == nil && !force && !bytes.Contains(existing, []byte(Marker)) {
+		return "", errcode.Errorf(errcode.Conflict, "%s already has a %s hook; use --force to replace it", hooksDir, hook)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(Script(hook)), 0755); err != nil {
+		return "", fmt.Errorf("failed to write hook: %w", err)
+	}
+	// WriteFile keeps the mode of a file it replaces
+	if err := os.Chmod(path, 0755); err != nil {
+		return "", fmt.Errorf("failed to make hook executable: %w", err)
+	}
+	return path, nil
+}
+
+// AddFrameworkHook adds ophid as a local hook to a pre-commit framework
+// config, creating the file if needed. Comments and the order of the
+// existing config are kept. It reports false if the hook was already there.
+func AddFrameworkHook(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return false, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return false, fmt.Errorf("%s isn't a pre-commit config", path)
+	}
+
+	repos := mappingValue(root, "repos")
+	if repos == nil {
+		repos = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "repos"}, repos)
+	}
+	if repos.Kind != yaml.SequenceNode {
+		return false, fmt.Errorf("repos in %s isn't a list", path)
+	}
+	for _, repo := range repos.Content {
+		if hooks := mappingValue(repo, "hooks"); hooks != nil {
+			for _, hook := range hooks.Content {
+				if id := mappingValue(hook, "id"); id != nil && id.Value == FrameworkHookID {
+					return false, nil
+				}
+			}
+		}
+	}
+
+	var entry yaml.Node
+	if err := yaml.Unmarshal([]byte(frameworkEntry), &entry); err != nil {
+		return false, err
+	}
+	repos.Content = append(repos.Content, entry.Content[0])
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// frameworkEntry is ophid's repo in a pre-commit framework config. It
+// scans the staged diff itself, so the framework passes no file names.
+const frameworkEntry = `repo: local
+hooks:
+  - id: ophid-scan
+    name: ophid secret and vulnerability scan
+    entry: ophid scan changed --staged
+    language: system
+    pass_filenames: false
+    stages: [pre-commit]
+`
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Range is the commits between Base and Head a push sends
+type Range struct {
+	Base string
+	Head string
+}
+
+// PushRanges reads the refs git passes a pre-push hook on stdin,
+// "<local ref> <local sha> <remote ref> <remote sha>" per line, and returns
+// the commits each push adds. Deletions push nothing. A new branch, or one
+// whose remote commit isn't known here, is checked from where it leaves
+// what the remotes already have.
+func PushRanges(ctx context.Context, dir string, r io.Reader) ([]Range, error) {
+	var ranges []Range
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 || fields[1] == zeroSHA {
+			continue
+		}
+		local, remote := fields[1], fields[3]
+		// After a force push by someone else, the remote commit may not be here
+		if remote != zeroSHA && exists(ctx, dir, remote+"^{commit}") {
+			ranges = append(ranges, Range{Base: remote, Head: local})
+			continue
+		}
+		base, err := newBranchBase(ctx, dir, local)
+		if err != nil {
+			return nil, err
+		}
+		if base != "" {
+			ranges = append(ranges, Range{Base: base, Head: local})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pushed refs: %w", err)
+	}
+	return ranges, nil
+}
+
+// newBranchBase returns the parent of the oldest commit of head no remote
+// has, the empty tree when that commit is a root, or "" when the remotes
+// have every commit
+func newBranchBase(ctx context.Context, dir, head string) (string, error) {
+	out, err := git(ctx, dir, "rev-list", "--reverse", "--topo-order", head, "--not", "--remotes")
+	if err != nil {
+		return "", err
+	}
+	oldest, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if oldest == "" {
+		return "", nil
+	}
+	parent, err := git(ctx, dir, "rev-parse", "--verify", "--quiet", oldest+"^")
+	if err != nil {
+		return emptyTree, nil
+	}
+	return strings.TrimSpace(string(parent)), nil
+}
+
+// StagedChanges returns the changes staged for the next commit
+func StagedChanges(ctx context.Context, dir string) ([]security.Change, error) {
+	return diff(ctx, dir, "--cached")
+}
+
+// RangeChanges returns the changes between two commits
+func RangeChanges(ctx context.Context, dir string, r Range) ([]security.Change, error) {
+	return diff(ctx, dir, r.Base, r.Head)
+}
+
+// ChangesSince returns the changes of the work tree, committed or not,
+// since the point where it left ref, and the commit of that point. Only
+// tracked files are diffed.
+func ChangesSince(ctx context.Context, dir, ref string) ([]security.Change, string, error) {
+	base := ref
+	if out, err := git(ctx, dir, "merge-base", ref, "HEAD"); err == nil {
+		base = strings.TrimSpace(string(out))
+	}
+	changes, err := diff(ctx, dir, base)
+	if err != nil {
+		return nil, "", err
+	}
+	return changes, base, nil
+}
+
+// diff parses git diff with no context lines, which is all the scans need
+func diff(ctx context.Context, dir string, args ...string) ([]security.Change, error) {
+	args = append([]string{"diff", "--no-color", "--no-ext-diff", "--no-renames", "-U0"}, args...)
+	out, err := git(ctx, dir, append(args, "--")...)
+	if err != nil {
+		return nil, err
+	}
+	return security.ParseDiff(bytes.NewReader(out))
+}
+
+// Show returns a file at a revision, with "" for the index. It returns an
+// error wrapping os.ErrNotExist if the file isn't there.
+func Show(ctx context.Context, dir, rev, path string) ([]byte, error) {
+	object := rev + ":" + filepath.ToSlash(path)
+	if !exists(ctx, dir, object) {
+		return nil, fmt.Errorf("%s: %w", object, os.ErrNotExist)
+	}
+	return git(ctx, dir, "cat-file", "blob", object)
+}
+
+// exists reports whether git has an object
+func exists(ctx context.Context, dir, object string) bool {
+	_, err := git(ctx, dir, "cat-file", "-e", object)
+	return err == nil
+}
+
+// HooksDir returns the directory git runs hooks from, following
+// core.hooksPath
+func HooksDir(ctx context.Context, dir string) (string, error) {
+	out, err := git(ctx, dir, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	hooks := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(hooks) {
+		hooks = filepath.Join(dir, hooks)
+	}
+	return hooks, nil
+}
+
+// TopLevel returns the root of the work tree dir is in
+func TopLevel(ctx context.Context, dir string) (string, error) {
+	out, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// git runs a git command in dir and returns its output
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s failed: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return out, nil
+}
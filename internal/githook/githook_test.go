@@ -0,0 +1,129 @@
+package githook
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func TestInstall(t *testing.T) {
+	hooks := filepath.Join(t.TempDir(), "hooks")
+	path, err := Install(hooks, PreCommit, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "exec ophid scan changed --staged") {
+		t.Errorf("pre-commit hook = %s", data)
+	}
+	// Reinstalling replaces ophid's own hook
+	if _, err := Install(hooks, PreCommit, false); err != nil {
+		t.Errorf("reinstall: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(hooks, PrePush), []byte("#!/bin/sh\nmake lint\n"), 0755)
+	if _, err := Install(hooks, PrePush, false); errcode.Of(err) != errcode.Conflict {
+		t.Errorf("replacing someone else's hook: %v, want a conflict", err)
+	}
+	if _, err := Install(hooks, PrePush, true); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(hooks, PrePush)); !strings.Contains(string(data), "--pre-push") {
+		t.Errorf("pre-push hook = %s", data)
+	}
+}
+
+func TestAddFrameworkHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FrameworkConfig)
+	os.WriteFile(path, []byte(`# Hooks for this repo
+repos:
+  - repo: https://github.com/psf/black
+    rev: 24.1.0
+    hooks:
+      - id: black # formatter
+`), 0644)
+
+	added, err := AddFrameworkHook(path)
+	if err != nil || !added {
+		t.Fatalf("AddFrameworkHook = %v, %v", added, err)
+	}
+	data, _ := os.ReadFile(path)
+	for _, want := range []string{"# Hooks for this repo", "id: black # formatter", "repo: local", "id: ophid-scan", "pass_filenames: false"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("config lacks %q:\n%s", want, data)
+		}
+	}
+	if added, err := AddFrameworkHook(path); err != nil || added {
+		t.Errorf("second AddFrameworkHook = %v, %v, want no change", added, err)
+	}
+
+	created := filepath.Join(t.TempDir(), FrameworkConfig)
+	if added, err := AddFrameworkHook(created); err != nil || !added {
+		t.Fatalf("creating a config: %v, %v", added, err)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		if _, err := git(ctx, dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	run("config", "user.email", "dev@example.com")
+	run("config", "user.name", "dev")
+	os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("requests==2.31.0\n"), 0644)
+	run("add", ".")
+	run("commit", "-qm", "first")
+	os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("requests==2.31.0\nrich==13.7.0\n"), 0644)
+	run("add", ".")
+
+	changes, err := StagedChanges(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Path != "requirements.txt" || len(changes[0].Added) != 1 || changes[0].Added[0].Number != 2 {
+		t.Fatalf("staged changes = %+v", changes)
+	}
+	if data, err := Show(ctx, dir, "", "requirements.txt"); err != nil || !strings.Contains(string(data), "rich") {
+		t.Errorf("staged file = %q, %v", data, err)
+	}
+	if _, err := Show(ctx, dir, "HEAD", "missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: %v", err)
+	}
+
+	run("commit", "-qm", "second")
+	head, _ := git(ctx, dir, "rev-parse", "HEAD")
+	ranges, err := PushRanges(ctx, dir, strings.NewReader("refs/heads/main "+strings.TrimSpace(string(head))+" refs/heads/main "+zeroSHA+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without remotes, a new branch is checked from its first commit
+	if len(ranges) != 1 || ranges[0].Base != emptyTree {
+		t.Errorf("PushRanges = %+v", ranges)
+	}
+
+	// Changes since a ref include uncommitted ones
+	os.WriteFile(filepath.Join(dir, "app.py"), []byte("print('hi')\n"), 0644)
+	run("add", "app.py")
+	since, base, err := ChangesSince(ctx, dir, "HEAD~1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := git(ctx, dir, "rev-parse", "HEAD~1")
+	if base != strings.TrimSpace(string(first)) || len(since) != 2 || since[0].Path != "app.py" || since[1].Path != "requirements.txt" {
+		t.Errorf("ChangesSince = %+v, %s", since, base)
+	}
+}
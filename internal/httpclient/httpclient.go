@@ -0,0 +1,128 @@
+// Package httpclient holds the network settings every ophid HTTP client
+// shares: requests go through the proxy of HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY, TLS trusts configured CAs besides the system's, and downloads
+// are held to a configured rate.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"golang.org/x/time/rate"
+)
+
+// maxBurst bounds how much a throttled download reads at once, so the
+// rate stays smooth at high limits
+const maxBurst = 64 * 1024
+
+// Options are the network settings of ophid's HTTP clients
+type Options struct {
+	CAFiles   []string // PEM files of CAs to trust besides the system's
+	LimitRate int64    // Download bytes per second; zero is unlimited
+}
+
+// rootCAs are the system CAs plus the configured ones; nil without any
+// configured, which means the system's
+var rootCAs *x509.CertPool
+
+// limiter throttles downloads; nil means no limit. It is shared, so
+// parallel downloads split the rate.
+var limiter *rate.Limiter
+
+// Configure applies opts to http.DefaultTransport, which the clients of
+// ophid use or clone through Transport, and to Throttle. It runs before
+// any request is made.
+func Configure(opts Options) error {
+	rootCAs = nil
+	if len(opts.CAFiles) > 0 {
+		pool, err := certPool(opts.CAFiles)
+		if err != nil {
+			return err
+		}
+		rootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport)
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = TLSClientConfig()
+
+	limiter = nil
+	if opts.LimitRate > 0 {
+		burst := int(min(opts.LimitRate, maxBurst))
+		limiter = rate.NewLimiter(rate.Limit(opts.LimitRate), burst)
+	}
+	return nil
+}
+
+// certPool returns the system CAs with those of PEM files added
+func certPool(files []string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates in CA file %s", file)
+		}
+	}
+	return pool, nil
+}
+
+// RootCAs returns the CAs outbound TLS trusts: the system's plus the
+// configured ones, or nil for just the system's
+func RootCAs() *x509.CertPool {
+	return rootCAs
+}
+
+// TLSClientConfig returns a TLS client config trusting RootCAs, or nil
+// when no CAs are configured, so transports keep their defaults
+func TLSClientConfig() *tls.Config {
+	if rootCAs == nil {
+		return nil
+	}
+	return &tls.Config{RootCAs: rootCAs}
+}
+
+// Transport returns a copy of the configured transport, for clients that
+// tune connection settings
+func Transport() *http.Transport {
+	return http.DefaultTransport.(*http.Transport).Clone()
+}
+
+// Throttle returns r read no faster than the configured rate, or r itself
+// without a limit. Wrap download bodies in it, not API responses.
+func Throttle(ctx context.Context, r io.Reader) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiter: limiter}
+}
+
+// throttledReader waits on a rate limiter for the bytes it reads
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// Read reads at most a burst and waits until the limiter allows it
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if burst := t.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
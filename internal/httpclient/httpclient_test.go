@@ -0,0 +1,89 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigureCAFiles(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	transport := http.DefaultTransport.(*http.Transport)
+	defer Configure(Options{})
+
+	if _, err := http.Get(server.URL); err == nil {
+		t.Fatal("a test server's certificate verified without its CA")
+	}
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Configure(Options{CAFiles: []string{bundle}}); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	if RootCAs() == nil || TLSClientConfig() == nil {
+		t.Fatal("no CAs configured")
+	}
+	transport.CloseIdleConnections()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("with the CA file: %v", err)
+	}
+	resp.Body.Close()
+
+	client := &http.Client{Transport: Transport()}
+	if resp, err = client.Get(server.URL); err != nil {
+		t.Fatalf("with a copy of the transport: %v", err)
+	}
+	resp.Body.Close()
+
+	os.WriteFile(bundle, []byte("not a certificate"), 0644)
+	if err := Configure(Options{CAFiles: []string{bundle}}); err == nil {
+		t.Error("accepted a CA file without certificates")
+	}
+	if err := Configure(Options{}); err != nil || RootCAs() != nil || transport.TLSClientConfig != nil {
+		t.Errorf("without CA files: %v, %v", err, transport.TLSClientConfig)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	defer Configure(Options{})
+
+	data := bytes.Repeat([]byte("x"), 3000)
+	if err := Configure(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if r := bytes.NewReader(data); Throttle(context.Background(), r) != r {
+		t.Error("Throttle() wrapped a reader without a limit")
+	}
+
+	// The first second's worth is the burst; the rest takes a second
+	if err := Configure(Options{LimitRate: 1500}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	got, err := io.ReadAll(Throttle(context.Background(), bytes.NewReader(data)))
+	if err != nil || len(got) != len(data) {
+		t.Fatalf("read %d bytes, %v", len(got), err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("read 3000 bytes at 1500/s in %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := io.ReadAll(Throttle(ctx, bytes.NewReader(data))); err == nil {
+		t.Error("a canceled download kept reading")
+	}
+}
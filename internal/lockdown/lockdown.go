@@ -0,0 +1,240 @@
+// Package lockdown keeps production hosts to what was provisioned. On a
+// locked host, commands that change runtimes or tools refuse to run unless
+// given the override token, and every attempt is logged.
+package lockdown
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	goruntime "runtime"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// File is the lockdown config in the ophid home
+const File = "lockdown.toml"
+
+// TokenEnv holds the override token for one command
+const TokenEnv = "OPHID_OVERRIDE_TOKEN"
+
+// Config is a lockdown.toml
+type Config struct {
+	Enabled   bool   `toml:"enabled"`
+	TokenHash string `toml:"override_token_sha256,omitempty"` // Hex SHA-256 of the override token
+	Log       string `toml:"log,omitempty"`                   // Attempt log (default ~/.ophid/lockdown.log)
+}
+
+// SystemPath is the machine-wide lockdown config. Owned by root, it locks
+// the host for users who can't edit it.
+func SystemPath() string {
+	if goruntime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "ophid", File)
+	}
+	return filepath.Join("/etc", "ophid", File)
+}
+
+// Paths returns the configs that can lock a host: the system one, then the
+// one in the ophid home
+func Paths(homeDir string) []string {
+	return []string{SystemPath(), filepath.Join(homeDir, File)}
+}
+
+// LoadConfig reads a lockdown config. A missing file is an unlocked config.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockdown config: %w", err)
+	}
+	var config Config
+	if err := toml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// Write saves the config
+func (c *Config) Write(path string) error {
+	data, err := toml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode lockdown config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create lockdown config directory: %w", err)
+	}
+	header := "# Written by ophid lockdown. While enabled, installs, upgrades and\n# runtime changes need " + TokenEnv + ".\n"
+	if err := os.WriteFile(path, append([]byte(header), data...), 0644); err != nil {
+		return fmt.Errorf("failed to write lockdown config: %w", err)
+	}
+	return nil
+}
+
+// NewToken returns a random override token and its hash
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token = hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash a config stores for a token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Policy is the lockdown state of a host, from all its configs
+type Policy struct {
+	Locked bool
+	Source string // Config that locked the host
+	Log    string // Where attempts are logged
+
+	hashes []string
+}
+
+// Load reads the configs at paths. The host is locked when any of them is
+// enabled; the token of any of them overrides it, and the first log
+// configured is used.
+func Load(homeDir string, paths ...string) (*Policy, error) {
+	p := &Policy{}
+	for _, path := range paths {
+		config, err := LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		if !config.Enabled {
+			continue
+		}
+		if !p.Locked {
+			p.Locked, p.Source = true, path
+		}
+		if config.TokenHash != "" {
+			p.hashes = append(p.hashes, config.TokenHash)
+		}
+		if p.Log == "" {
+			p.Log = config.Log
+		}
+	}
+	if p.Log == "" {
+		p.Log = filepath.Join(homeDir, "lockdown.log")
+	}
+	return p, nil
+}
+
+// Valid reports whether token is an override token of the policy
+func (p *Policy) Valid(token string) bool {
+	if token == "" {
+		return false
+	}
+	hash := []byte(HashToken(token))
+	for _, h := range p.hashes {
+		if subtle.ConstantTimeCompare(hash, []byte(h)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Attempt is a logged attempt to change a locked host
+type Attempt struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Operation string    `json:"operation"`
+	Result    string    `json:"result"` // "denied", "bad token" or "overridden"
+}
+
+// Check allows an operation on an unlocked host, or on a locked one with a
+// valid override token, and logs attempts on locked hosts
+func (p *Policy) Check(operation, token string) error {
+	if !p.Locked {
+		return nil
+	}
+
+	result := "denied"
+	switch {
+	case p.Valid(token):
+		result = "overridden"
+	case token != "":
+		result = "bad token"
+	}
+	logErr := p.record(Attempt{Time: time.Now().UTC(), User: currentUser(), Operation: operation, Result: result})
+
+	switch result {
+	case "overridden":
+		// An override nobody can trace defeats the lock
+		if logErr != nil {
+			return errcode.Wrap(errcode.PolicyBlocked, fmt.Errorf("this host is locked and the override can't be logged: %w", logErr))
+		}
+		return nil
+	case "bad token":
+		return errcode.Errorf(errcode.PolicyBlocked, "this host is locked (%s): %s isn't the override token", p.Source, TokenEnv)
+	}
+	return errcode.Errorf(errcode.PolicyBlocked, "this host is locked (%s): %s isn't allowed without %s", p.Source, operation, TokenEnv)
+}
+
+// record appends an attempt to the log
+func (p *Policy) record(a Attempt) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.Log), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p.Log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// ReadLog returns the last limit attempts of a log, or all with limit 0
+func ReadLog(path string, limit int) ([]Attempt, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockdown log: %w", err)
+	}
+
+	var attempts []Attempt
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var a Attempt
+		if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, &a) != nil {
+			continue
+		}
+		attempts = append(attempts, a)
+	}
+	if limit > 0 && len(attempts) > limit {
+		attempts = attempts[len(attempts)-limit:]
+	}
+	return attempts, nil
+}
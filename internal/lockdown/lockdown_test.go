@@ -0,0 +1,82 @@
+package lockdown
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func TestPolicy(t *testing.T) {
+	dir := t.TempDir()
+	system, user := filepath.Join(dir, "etc", File), filepath.Join(dir, "home", File)
+
+	policy, err := Load(dir, system, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Locked || policy.Check("ophid install ansible", "") != nil {
+		t.Fatal("a host without configs is locked")
+	}
+
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Config{Enabled: true, TokenHash: hash}).Write(user); err != nil {
+		t.Fatal(err)
+	}
+	// A disabled system config doesn't unlock the host
+	if err := (&Config{Enabled: false}).Write(system); err != nil {
+		t.Fatal(err)
+	}
+
+	if policy, err = Load(dir, system, user); err != nil {
+		t.Fatal(err)
+	}
+	if !policy.Locked || policy.Source != user || policy.Log != filepath.Join(dir, "lockdown.log") {
+		t.Fatalf("policy = %+v", policy)
+	}
+
+	if err := policy.Check("ophid install ansible", ""); errcode.Of(err) != errcode.PolicyBlocked {
+		t.Errorf("Check without token = %v", err)
+	}
+	if err := policy.Check("ophid uninstall ansible", "guess"); errcode.Of(err) != errcode.PolicyBlocked {
+		t.Errorf("Check with a wrong token = %v", err)
+	}
+	if err := policy.Check("ophid runtime install 3.12.1", token); err != nil {
+		t.Errorf("Check with the token = %v", err)
+	}
+
+	attempts, err := ReadLog(policy.Log, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []string
+	for _, a := range attempts {
+		results = append(results, a.Operation+": "+a.Result)
+	}
+	want := []string{"ophid install ansible: denied", "ophid uninstall ansible: bad token", "ophid runtime install 3.12.1: overridden"}
+	if len(results) != len(want) {
+		t.Fatalf("log = %q, want %q", results, want)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("log[%d] = %q, want %q", i, results[i], want[i])
+		}
+	}
+	if last, _ := ReadLog(policy.Log, 1); len(last) != 1 || last[0].Result != "overridden" {
+		t.Errorf("ReadLog limit 1 = %+v", last)
+	}
+
+	// An override that can't be logged is refused
+	policy.Log = filepath.Join(dir, "home", File, "log")
+	if err := policy.Check("ophid install ansible", token); errcode.Of(err) != errcode.PolicyBlocked {
+		t.Errorf("unlogged override = %v", err)
+	}
+
+	if data, _ := os.ReadFile(user); len(data) == 0 || string(data[0]) != "#" {
+		t.Errorf("config = %q", data)
+	}
+}
@@ -0,0 +1,58 @@
+package mcp
+
+import (
+	"fmt"
+	"sync"
+)
+
+// LimitedBuffer collects a tool's output for a call result, keeping the
+// start and the end of it when there is more than fits in an assistant's
+// context
+type LimitedBuffer struct {
+	mu      sync.Mutex
+	limit   int
+	head    []byte
+	tail    []byte
+	dropped int
+}
+
+// NewLimitedBuffer creates a buffer that keeps up to limit bytes
+func NewLimitedBuffer(limit int) *LimitedBuffer {
+	return &LimitedBuffer{limit: limit}
+}
+
+// Write keeps the first half of the limit and a rolling last half
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	if room := b.limit/2 - len(b.head); room > 0 {
+		take := min(room, len(p))
+		b.head = append(b.head, p[:take]...)
+		p = p[take:]
+	}
+	b.tail = append(b.tail, p...)
+	if over := len(b.tail) - (b.limit - b.limit/2); over > 0 {
+		b.tail = b.tail[over:]
+		b.dropped += over
+	}
+	return n, nil
+}
+
+// Truncated reports whether output was dropped
+func (b *LimitedBuffer) Truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped > 0
+}
+
+// String returns the output kept, marking where some was dropped
+func (b *LimitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dropped == 0 {
+		return string(b.head) + string(b.tail)
+	}
+	return fmt.Sprintf("%s\n[... %d bytes omitted ...]\n%s", b.head, b.dropped, b.tail)
+}
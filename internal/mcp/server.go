@@ -0,0 +1,314 @@
+// Package mcp serves tools to AI assistants over the Model Context
+// Protocol: JSON-RPC 2.0 messages, one per line, on the server's stdin and
+// stdout.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// ProtocolVersion is the newest protocol revision the server speaks
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions are the revisions the server accepts from clients
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Tool is a capability the server exposes
+type Tool struct {
+	Name        string
+	Description string
+	InputSchema map[string]any // JSON Schema of the arguments, see Object
+	ReadOnly    bool           // Only reads; clients may call it without asking
+
+	// Handler runs the tool with the call's arguments. Its result is sent
+	// as text: strings as they are, anything else as indented JSON. An
+	// error is reported to the assistant as a failed call, not a protocol
+	// error, so it can react to it.
+	Handler func(ctx context.Context, args json.RawMessage) (any, error)
+}
+
+// Object returns the JSON Schema of an object with properties, of which
+// the required ones must be set
+func Object(properties map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// Property returns the JSON Schema of a property of a JSON type
+func Property(typ, description string) map[string]any {
+	schema := map[string]any{"type": typ, "description": description}
+	if typ == "array" {
+		schema["items"] = map[string]any{"type": "string"}
+	}
+	return schema
+}
+
+// Server answers MCP requests with its tools
+type Server struct {
+	name    string
+	version string
+	tools   []Tool
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	callsMu sync.Mutex
+	calls   map[string]context.CancelFunc // Cancels in-flight tool calls by request ID
+	wg      sync.WaitGroup
+}
+
+// NewServer creates a server that introduces itself with name and version
+func NewServer(name, version string) *Server {
+	return &Server{name: name, version: version, calls: make(map[string]context.CancelFunc)}
+}
+
+// AddTool exposes a tool
+func (s *Server) AddTool(t Tool) {
+	s.tools = append(s.tools, t)
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // Absent for notifications
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Serve reads requests from r and writes responses to w until r ends or
+// ctx is canceled. Tool calls run concurrently: when r ends Serve waits for
+// the ones in flight, when ctx is canceled it cancels them.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.enc = json.NewEncoder(w)
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		s.wg.Wait()
+	}()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			s.wg.Wait()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read request: %w", err)
+		case line := <-lines:
+			s.handle(ctx, line)
+		}
+	}
+}
+
+// handle answers one message
+func (s *Server) handle(ctx context.Context, line []byte) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		s.reply(nil, nil, &rpcError{Code: codeParseError, Message: err.Error()})
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		s.reply(req.ID, nil, &rpcError{Code: codeInvalidRequest, Message: "not a JSON-RPC 2.0 request"})
+		return
+	}
+
+	switch req.Method {
+	case "initialize":
+		s.initialize(req)
+	case "ping":
+		s.reply(req.ID, struct{}{}, nil)
+	case "tools/list":
+		s.listTools(req)
+	case "tools/call":
+		s.callTool(ctx, req)
+	case "notifications/cancelled":
+		s.cancelCall(req)
+	default:
+		if req.ID != nil { // Unknown notifications are ignored
+			s.reply(req.ID, nil, &rpcError{Code: codeMethodNotFound, Message: "unknown method " + req.Method})
+		}
+	}
+}
+
+// initialize agrees on a protocol version: the client's if the server
+// speaks it, else the newest one
+func (s *Server) initialize(req request) {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	json.Unmarshal(req.Params, &params)
+
+	version := ProtocolVersion
+	if slices.Contains(supportedVersions, params.ProtocolVersion) {
+		version = params.ProtocolVersion
+	}
+	s.reply(req.ID, map[string]any{
+		"protocolVersion": version,
+		"capabilities":    map[string]any{"tools": map[string]any{}},
+		"serverInfo":      map[string]string{"name": s.name, "version": s.version},
+	}, nil)
+}
+
+// listTools describes the tools
+func (s *Server) listTools(req request) {
+	tools := make([]map[string]any, 0, len(s.tools))
+	for _, t := range s.tools {
+		schema := t.InputSchema
+		if schema == nil {
+			schema = Object(map[string]any{})
+		}
+		tools = append(tools, map[string]any{
+			"name":        t.Name,
+			"description": t.Description,
+			"inputSchema": schema,
+			"annotations": map[string]any{"readOnlyHint": t.ReadOnly},
+		})
+	}
+	s.reply(req.ID, map[string]any{"tools": tools}, nil)
+}
+
+// callTool runs a tool in the background, so long calls don't hold up
+// pings and cancellations
+func (s *Server) callTool(ctx context.Context, req request) {
+	var params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		s.reply(req.ID, nil, &rpcError{Code: codeInvalidParams, Message: err.Error()})
+		return
+	}
+	i := slices.IndexFunc(s.tools, func(t Tool) bool { return t.Name == params.Name })
+	if i < 0 {
+		s.reply(req.ID, nil, &rpcError{Code: codeInvalidParams, Message: "unknown tool " + params.Name})
+		return
+	}
+	if len(params.Arguments) == 0 || string(params.Arguments) == "null" {
+		params.Arguments = json.RawMessage("{}")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	key := string(bytes.TrimSpace(req.ID))
+	s.callsMu.Lock()
+	s.calls[key] = cancel
+	s.callsMu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.callsMu.Lock()
+			delete(s.calls, key)
+			s.callsMu.Unlock()
+			cancel()
+		}()
+
+		result, err := s.tools[i].Handler(ctx, params.Arguments)
+		if ctx.Err() != nil {
+			return // Canceled calls get no response
+		}
+		s.reply(req.ID, toolResult(result, err), nil)
+	}()
+}
+
+// cancelCall cancels the tool call a client gave up on
+func (s *Server) cancelCall(req request) {
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if json.Unmarshal(req.Params, &params) != nil {
+		return
+	}
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if cancel, ok := s.calls[string(bytes.TrimSpace(params.RequestID))]; ok {
+		cancel()
+	}
+}
+
+// toolResult turns what a handler returned into a tools/call result
+func toolResult(result any, err error) map[string]any {
+	if err != nil {
+		// The code tells the assistant what kind of failure it was, e.g. not_found
+		text := fmt.Sprintf("%s: %v", errcode.Of(err), err)
+		return map[string]any{"content": []map[string]string{{"type": "text", "text": text}}, "isError": true}
+	}
+
+	text, ok := result.(string)
+	if !ok {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return toolResult(nil, fmt.Errorf("failed to marshal result: %w", err))
+		}
+		text = string(data)
+	}
+	return map[string]any{"content": []map[string]string{{"type": "text", "text": text}}, "isError": false}
+}
+
+// reply writes one response
+func (s *Server) reply(id json.RawMessage, result any, rpcErr *rpcError) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.enc.Encode(response{JSONRPC: "2.0", ID: id, Result: result, Error: rpcErr})
+}
@@ -0,0 +1,157 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func testServer() *Server {
+	s := NewServer("ophid", "1.0")
+	s.AddTool(Tool{
+		Name:        "echo",
+		InputSchema: Object(map[string]any{"text": Property("string", "Text")}, "text"),
+		ReadOnly:    true,
+		Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+			var params struct{ Text string }
+			json.Unmarshal(args, &params)
+			if params.Text == "" {
+				return nil, errcode.Errorf(errcode.NotFound, "nothing to echo")
+			}
+			return map[string]string{"echo": params.Text}, nil
+		},
+	})
+	s.AddTool(Tool{
+		Name: "wait",
+		Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	return s
+}
+
+// serve runs a server over the requests and returns its responses by ID
+func serve(t *testing.T, s *Server, requests ...string) map[string]map[string]any {
+	t.Helper()
+	var out strings.Builder
+	if err := s.Serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")+"\n"), &out); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	responses := make(map[string]map[string]any)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var resp map[string]any
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("bad response %q: %v", line, err)
+		}
+		responses[fmt.Sprint(resp["id"])] = resp
+	}
+	return responses
+}
+
+func TestServe(t *testing.T) {
+	responses := serve(t, testServer(),
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"echo","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"nope"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"resources/list"}`,
+		`{"jsonrpc":"2.0","id":7,"method":"ping"}`,
+		`not json`,
+	)
+
+	init := responses["1"]["result"].(map[string]any)
+	if init["protocolVersion"] != "2024-11-05" || init["serverInfo"].(map[string]any)["name"] != "ophid" {
+		t.Errorf("initialize = %v", init)
+	}
+
+	tools := responses["2"]["result"].(map[string]any)["tools"].([]any)
+	if len(tools) != 2 || tools[0].(map[string]any)["name"] != "echo" {
+		t.Errorf("tools/list = %v", tools)
+	}
+	if tools[1].(map[string]any)["inputSchema"].(map[string]any)["type"] != "object" {
+		t.Errorf("tool without a schema = %v", tools[1])
+	}
+
+	call := responses["3"]["result"].(map[string]any)
+	text := call["content"].([]any)[0].(map[string]any)["text"].(string)
+	if call["isError"] != false || !strings.Contains(text, `"echo": "hi"`) {
+		t.Errorf("tools/call = %v", call)
+	}
+
+	failed := responses["4"]["result"].(map[string]any)
+	text = failed["content"].([]any)[0].(map[string]any)["text"].(string)
+	if failed["isError"] != true || text != "not_found: nothing to echo" {
+		t.Errorf("failed tools/call = %v", failed)
+	}
+
+	for id, code := range map[string]float64{"5": codeInvalidParams, "6": codeMethodNotFound, "<nil>": codeParseError} {
+		if rpcErr, _ := responses[id]["error"].(map[string]any); rpcErr == nil || rpcErr["code"] != code {
+			t.Errorf("response %s = %v, want error %v", id, responses[id], code)
+		}
+	}
+	if _, ok := responses["7"]["result"]; !ok {
+		t.Errorf("ping = %v", responses["7"])
+	}
+	if len(responses) != 8 {
+		t.Errorf("got %d responses, want 8 (none for notifications)", len(responses))
+	}
+}
+
+func TestServeCancel(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- testServer().Serve(context.Background(), inR, outW) }()
+
+	responses := bufio.NewScanner(outR)
+	send := func(msg string) { io.WriteString(inW, msg+"\n") }
+
+	send(`{"jsonrpc":"2.0","id":"w","method":"tools/call","params":{"name":"wait"}}`)
+	send(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	// A running call doesn't hold up other requests
+	if !responses.Scan() || !strings.Contains(responses.Text(), `"id":1`) {
+		t.Fatalf("ping response = %q", responses.Text())
+	}
+
+	send(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"w"}}`)
+	send(`{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	if !responses.Scan() || !strings.Contains(responses.Text(), `"id":2`) {
+		t.Fatalf("got %q, want only the ping response", responses.Text())
+	}
+
+	inW.Close()
+	go io.Copy(io.Discard, outR)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve() didn't return once the input ended")
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := NewLimitedBuffer(8)
+	io.WriteString(b, "abc")
+	if b.String() != "abc" || b.Truncated() {
+		t.Errorf("short output = %q", b.String())
+	}
+
+	io.WriteString(b, "defghij")
+	io.WriteString(b, "klmnop")
+	if !b.Truncated() || b.String() != "abcd\n[... 8 bytes omitted ...]\nmnop" {
+		t.Errorf("long output = %q", b.String())
+	}
+}
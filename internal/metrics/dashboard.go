@@ -0,0 +1,226 @@
+package metrics
+
+// Dashboard is a Grafana dashboard, in the JSON model Grafana imports
+type Dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	Editable      bool       `json:"editable"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          TimeRange  `json:"time"`
+	Templating    Templating `json:"templating"`
+	Panels        []Panel    `json:"panels"`
+}
+
+// TimeRange is the dashboard's default time range
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Templating holds the dashboard's variables
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+// Variable is a dashboard variable
+type Variable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+// Panel is a dashboard panel, or a row of them
+type Panel struct {
+	ID          int          `json:"id"`
+	Type        string       `json:"type"` // "row", "timeseries", "stat" or "bargauge"
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	GridPos     GridPos      `json:"gridPos"`
+	Datasource  *Datasource  `json:"datasource,omitempty"`
+	Targets     []Target     `json:"targets,omitempty"`
+	FieldConfig *FieldConfig `json:"fieldConfig,omitempty"`
+}
+
+// GridPos places a panel on Grafana's 24 column grid
+type GridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Datasource selects the data source a panel queries
+type Datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+// Target is a panel's PromQL query
+type Target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+// FieldConfig sets how a panel shows values
+type FieldConfig struct {
+	Defaults FieldDefaults `json:"defaults"`
+}
+
+// FieldDefaults are the unit and thresholds of a panel's values
+type FieldDefaults struct {
+	Unit       string      `json:"unit,omitempty"`
+	Thresholds *Thresholds `json:"thresholds,omitempty"`
+}
+
+// Thresholds color values by the step they reach
+type Thresholds struct {
+	Mode  string          `json:"mode"`
+	Steps []ThresholdStep `json:"steps"`
+}
+
+// ThresholdStep is a color from a value on; the first has no value
+type ThresholdStep struct {
+	Color string   `json:"color"`
+	Value *float64 `json:"value"`
+}
+
+// panelSpec describes a panel before it is laid out
+type panelSpec struct {
+	kind, title, description, unit string
+	width                          int
+	queries                        []Target
+	thresholds                     *Thresholds
+}
+
+// dashboardRow is a titled group of panels
+type dashboardRow struct {
+	title  string
+	panels []panelSpec
+}
+
+// panelHeight is the height of every panel but rows
+const panelHeight = 8
+
+// NewDashboard returns a dashboard of ophid's metrics: proxy routes,
+// backends and certificates, supervised processes, and the security scans,
+// install times and caches of installed tools. Its queries go to the
+// Prometheus data source picked in its datasource variable.
+func NewDashboard(title string) *Dashboard {
+	rows := []dashboardRow{
+		{"Proxy", []panelSpec{
+			timeseries("Requests", "reqps", query(`sum by (route) (rate(ophid_proxy_route_requests_total[$__rate_interval]))`, "{{route}}")),
+			timeseries("5xx ratio", "percentunit", query(`sum by (route) (rate(ophid_proxy_route_errors_total[$__rate_interval])) / sum by (route) (rate(ophid_proxy_route_requests_total[$__rate_interval]))`, "{{route}}")),
+			timeseries("Latency p95", "s", query(`histogram_quantile(0.95, sum by (route, le) (rate(ophid_proxy_route_request_duration_seconds_bucket[$__rate_interval])))`, "{{route}}")),
+			timeseries("Active requests", "short", query(`sum by (route) (ophid_proxy_route_active_requests)`, "{{route}}")),
+			timeseries("Backend latency p95", "s", query(`ophid_proxy_backend_latency_p95_seconds`, "{{backend}}")),
+			timeseries("Backend connections", "short", query(`ophid_proxy_backend_connections`, "{{backend}}")),
+			stat("Unhealthy backends", "Load-balanced backends failing their health checks", "short",
+				redFrom(1), query(`count(ophid_proxy_backend_healthy == 0) or vector(0)`, "")),
+			stat("Ejected backends", "Backends outlier detection took out of rotation", "short",
+				redFrom(1), query(`sum(ophid_proxy_backend_ejected) or vector(0)`, "")),
+			{kind: "bargauge", title: "Certificate expiry", unit: "s", width: 8,
+				queries:    []Target{query(`min by (name) (ophid_proxy_certificate_expiry_seconds)`, "{{name}}")},
+				thresholds: thresholds("red", step("orange", 7*86400), step("green", 21*86400))},
+		}},
+		{"Supervisor", []panelSpec{
+			stat("Processes running", "", "short", nil, query(`sum(ophid_process_up) or vector(0)`, "")),
+			stat("Processes not ready", "Running processes that haven't passed their health check, and stopped ones", "short",
+				redFrom(1), query(`count(ophid_process_ready == 0) or vector(0)`, "")),
+			timeseries("Ready", "short", query(`ophid_process_ready`, "{{process}}")),
+			timeseries("Restarts", "short", query(`increase(ophid_process_restarts_total[$__rate_interval])`, "{{process}}")),
+			timeseries("Health check failures", "short", query(`increase(ophid_process_health_check_failures_total[$__rate_interval])`, "{{process}}")),
+			timeseries("Uptime", "s", query(`(time() - ophid_process_start_time_seconds) * ophid_process_up`, "{{process}}")),
+		}},
+		{"Security and tools", []panelSpec{
+			stat("Critical vulnerabilities", "Found in installed tools when they were installed", "short",
+				redFrom(1), query(`sum(ophid_tool_vulnerabilities{severity="critical"}) or vector(0)`, "")),
+			stat("Other vulnerabilities", "Found in installed tools when they were installed", "short",
+				thresholds("green", step("orange", 1)), query(`sum(ophid_tool_vulnerabilities{severity="other"}) or vector(0)`, "")),
+			stat("Secrets found", "In the sources of tools installed from git or local directories", "short",
+				redFrom(1), query(`sum(ophid_tool_secrets) or vector(0)`, "")),
+			stat("Tools installed", "", "short", nil, query(`count(ophid_tool_info) or vector(0)`, "")),
+			bargauge("Vulnerabilities by tool", "short", query(`sum by (tool, severity) (ophid_tool_vulnerabilities) > 0`, "{{tool}} ({{severity}})")),
+			bargauge("Install duration", "s", query(`ophid_tool_install_duration_seconds`, "{{tool}}")),
+			bargauge("Cache size", "bytes", query(`ophid_cache_size_bytes`, "{{cache}}")),
+		}},
+	}
+
+	dashboard := &Dashboard{
+		UID:           "ophid",
+		Title:         title,
+		Tags:          []string{"ophid"},
+		Editable:      true,
+		SchemaVersion: 39,
+		Refresh:       "30s",
+		Time:          TimeRange{From: "now-6h", To: "now"},
+		Templating: Templating{List: []Variable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+		}},
+	}
+
+	datasource := &Datasource{Type: "prometheus", UID: "${datasource}"}
+	id, y := 1, 0
+	for _, row := range rows {
+		dashboard.Panels = append(dashboard.Panels, Panel{ID: id, Type: "row", Title: row.title, GridPos: GridPos{Y: y, W: 24, H: 1}})
+		id, y = id+1, y+1
+
+		x := 0
+		for _, spec := range row.panels {
+			if x+spec.width > 24 {
+				x, y = 0, y+panelHeight
+			}
+			panel := Panel{
+				ID:          id,
+				Type:        spec.kind,
+				Title:       spec.title,
+				Description: spec.description,
+				GridPos:     GridPos{X: x, Y: y, W: spec.width, H: panelHeight},
+				Datasource:  datasource,
+				Targets:     spec.queries,
+				FieldConfig: &FieldConfig{Defaults: FieldDefaults{Unit: spec.unit, Thresholds: spec.thresholds}},
+			}
+			for i := range panel.Targets {
+				panel.Targets[i].RefID = string(rune('A' + i))
+			}
+			dashboard.Panels = append(dashboard.Panels, panel)
+			id, x = id+1, x+spec.width
+		}
+		y += panelHeight
+	}
+	return dashboard
+}
+
+func query(expr, legend string) Target {
+	return Target{Expr: expr, LegendFormat: legend}
+}
+
+func timeseries(title, unit string, q Target) panelSpec {
+	return panelSpec{kind: "timeseries", title: title, unit: unit, width: 8, queries: []Target{q}}
+}
+
+func bargauge(title, unit string, q Target) panelSpec {
+	return panelSpec{kind: "bargauge", title: title, unit: unit, width: 8, queries: []Target{q}}
+}
+
+func stat(title, description, unit string, thresholds *Thresholds, q Target) panelSpec {
+	return panelSpec{kind: "stat", title: title, description: description, unit: unit, width: 4, queries: []Target{q}, thresholds: thresholds}
+}
+
+// redFrom colors values from n on red, and lower ones green
+func redFrom(n float64) *Thresholds {
+	return thresholds("green", step("red", n))
+}
+
+// thresholds colors values base up to the first step
+func thresholds(base string, steps ...ThresholdStep) *Thresholds {
+	return &Thresholds{Mode: "absolute", Steps: append([]ThresholdStep{{Color: base}}, steps...)}
+}
+
+// step colors values from value on
+func step(color string, value float64) ThresholdStep {
+	return ThresholdStep{Color: color, Value: &value}
+}
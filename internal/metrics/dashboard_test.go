@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDashboardMetricNames(t *testing.T) {
+	// Names the exporters write: the proxy's and this package's
+	sources, _ := filepath.Glob("../proxy/*.go")
+	sources = append(sources, "metrics.go")
+	metricName := regexp.MustCompile(`ophid_[a-z0-9_]+`)
+	exported := make(map[string]bool)
+	for _, path := range sources {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range metricName.FindAllString(string(data), -1) {
+			exported[name] = true
+		}
+	}
+
+	d := NewDashboard("ophid")
+	queries := 0
+	for _, p := range d.Panels {
+		for _, target := range p.Targets {
+			queries++
+			for _, name := range metricName.FindAllString(target.Expr, -1) {
+				if !exported[strings.TrimSuffix(name, "_bucket")] {
+					t.Errorf("panel %q queries %s, which ophid doesn't export", p.Title, name)
+				}
+			}
+		}
+	}
+	if queries == 0 {
+		t.Fatal("dashboard without queries")
+	}
+}
+
+func TestDashboardLayout(t *testing.T) {
+	d := NewDashboard("Fleet")
+	if d.Title != "Fleet" || d.Templating.List[0].Name != "datasource" {
+		t.Errorf("dashboard = %+v", d)
+	}
+
+	ids := make(map[int]bool)
+	var placed []GridPos
+	for _, p := range d.Panels {
+		if ids[p.ID] {
+			t.Errorf("duplicate panel ID %d", p.ID)
+		}
+		ids[p.ID] = true
+		if p.Type != "row" && (p.Datasource == nil || p.Datasource.UID != "${datasource}") {
+			t.Errorf("panel %q doesn't use the datasource variable", p.Title)
+		}
+
+		g := p.GridPos
+		if g.X < 0 || g.X+g.W > 24 {
+			t.Errorf("panel %q is off the grid: %+v", p.Title, g)
+		}
+		for _, other := range placed {
+			if g.X < other.X+other.W && other.X < g.X+g.W && g.Y < other.Y+other.H && other.Y < g.Y+g.H {
+				t.Errorf("panel %q at %+v overlaps %+v", p.Title, g, other)
+			}
+		}
+		placed = append(placed, g)
+	}
+}
@@ -0,0 +1,207 @@
+// Package metrics exports the state of supervised processes and installed
+// tools in the Prometheus text format, for the proxy's admin /metrics.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gleicon/ophid/internal/supervisor"
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+// cacheSizeRefresh is how often cache sizes are recomputed; walking a
+// large git cache on every scrape would be slow
+const cacheSizeRefresh = time.Minute
+
+// Family is a metric and its samples
+type Family struct {
+	Name    string
+	Help    string
+	Type    string // "gauge" or "counter"
+	Samples []Sample
+}
+
+// Sample is one value of a metric
+type Sample struct {
+	Labels []string // Label name and value pairs
+	Value  float64
+}
+
+// Write writes families in the Prometheus text format, skipping those
+// without samples
+func Write(w io.Writer, families []Family) {
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.Name, f.Help, f.Name, f.Type)
+		for _, s := range f.Samples {
+			var labels []string
+			for i := 0; i+1 < len(s.Labels); i += 2 {
+				labels = append(labels, fmt.Sprintf("%s=\"%s\"", s.Labels[i], labelEscaper.Replace(s.Labels[i+1])))
+			}
+			fmt.Fprintf(w, "%s{%s} %g\n", f.Name, strings.Join(labels, ","), s.Value)
+		}
+	}
+}
+
+// Processes returns the metrics of supervised processes
+func Processes(states []supervisor.ProcessState) []Family {
+	up := Family{Name: "ophid_process_up", Help: "Whether the process is running.", Type: "gauge"}
+	ready := Family{Name: "ophid_process_ready", Help: "Whether the process is running and passed its health check.", Type: "gauge"}
+	status := Family{Name: "ophid_process_status", Help: "The process's status (1 for the current one).", Type: "gauge"}
+	restarts := Family{Name: "ophid_process_restarts_total", Help: "Times the supervisor restarted the process.", Type: "counter"}
+	healthFailed := Family{Name: "ophid_process_health_check_failures_total", Help: "Failed health checks of the process.", Type: "counter"}
+	started := Family{Name: "ophid_process_start_time_seconds", Help: "When the process last started, in seconds since the epoch.", Type: "gauge"}
+
+	statuses := []supervisor.ProcessStatus{supervisor.StatusStopped, supervisor.StatusStarting,
+		supervisor.StatusRunning, supervisor.StatusFailed, supervisor.StatusBackoff}
+	for _, s := range states {
+		name := []string{"process", s.Name}
+		up.Samples = append(up.Samples, Sample{name, boolFloat(s.Status == supervisor.StatusRunning)})
+		ready.Samples = append(ready.Samples, Sample{name, boolFloat(s.Ready)})
+		for _, st := range statuses {
+			status.Samples = append(status.Samples, Sample{[]string{"process", s.Name, "status", string(st)}, boolFloat(s.Status == st)})
+		}
+		restarts.Samples = append(restarts.Samples, Sample{name, float64(s.RestartCount)})
+		healthFailed.Samples = append(healthFailed.Samples, Sample{name, float64(s.HealthFailed)})
+		if !s.StartTime.IsZero() {
+			started.Samples = append(started.Samples, Sample{name, float64(s.StartTime.Unix())})
+		}
+	}
+	return []Family{up, ready, status, restarts, healthFailed, started}
+}
+
+// Tools returns the metrics of installed tools: install durations and the
+// findings of their install-time scans by severity
+func Tools(tools []*tool.Tool) []Family {
+	info := Family{Name: "ophid_tool_info", Help: "Installed tools (always 1).", Type: "gauge"}
+	duration := Family{Name: "ophid_tool_install_duration_seconds", Help: "How long the last install of the tool took.", Type: "gauge"}
+	vulns := Family{Name: "ophid_tool_vulnerabilities", Help: "Known vulnerabilities found when the tool was installed, by severity.", Type: "gauge"}
+	secrets := Family{Name: "ophid_tool_secrets", Help: "Secrets found in the tool's source when it was installed, by severity.", Type: "gauge"}
+
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	for _, t := range tools {
+		info.Samples = append(info.Samples, Sample{[]string{"tool", t.Name, "version", t.Version, "source", string(t.Source.Type)}, 1})
+		if t.InstallDuration > 0 {
+			duration.Samples = append(duration.Samples, Sample{[]string{"tool", t.Name}, t.InstallDuration.Seconds()})
+		}
+
+		sec := t.Security
+		vulns.Samples = append(vulns.Samples,
+			Sample{[]string{"tool", t.Name, "severity", "critical"}, float64(sec.CriticalVulnCount)},
+			Sample{[]string{"tool", t.Name, "severity", "other"}, float64(sec.VulnCount - sec.CriticalVulnCount)})
+
+		if sec.SecretsReport != nil {
+			counts := make(map[string]int)
+			for _, f := range sec.SecretsReport.Findings {
+				counts[f.Severity]++
+			}
+			for _, severity := range sortedKeys(counts) {
+				secrets.Samples = append(secrets.Samples, Sample{[]string{"tool", t.Name, "severity", severity}, float64(counts[severity])})
+			}
+		}
+	}
+	return []Family{info, duration, vulns, secrets}
+}
+
+// CacheSizes returns the size of each cache under dir: its subdirectories
+// (downloads, git) and the files directly in it (archives)
+func CacheSizes(dir string) []Family {
+	sizes := Family{Name: "ophid_cache_size_bytes", Help: "Disk space used by the cache.", Type: "gauge"}
+
+	entries, _ := os.ReadDir(dir)
+	totals := make(map[string]int64)
+	for _, e := range entries {
+		name := "archives"
+		if e.IsDir() {
+			name = e.Name()
+		}
+		totals[name] += diskUsage(filepath.Join(dir, e.Name()))
+	}
+	for _, name := range sortedKeys(totals) {
+		sizes.Samples = append(sizes.Samples, Sample{[]string{"cache", name}, float64(totals[name])})
+	}
+	return []Family{sizes}
+}
+
+// Collector writes the metrics of an ophid home directory
+type Collector struct {
+	homeDir   string
+	statePath string
+
+	mu         sync.Mutex
+	caches     []Family
+	cachesTime time.Time
+}
+
+// NewCollector creates a collector for the tools and caches of homeDir and
+// the supervisor state in statePath
+func NewCollector(homeDir, statePath string) *Collector {
+	return &Collector{homeDir: homeDir, statePath: statePath}
+}
+
+// Write writes the current metrics. Missing state (nothing supervised or
+// installed yet) leaves its metrics out.
+func (c *Collector) Write(w io.Writer) {
+	if states, err := supervisor.LoadState(c.statePath); err == nil {
+		Write(w, Processes(states))
+	}
+	if manifest, err := tool.LoadManifest(c.homeDir); err == nil {
+		tools := make([]*tool.Tool, 0, len(manifest.Tools))
+		for _, t := range manifest.Tools {
+			tools = append(tools, t)
+		}
+		Write(w, Tools(tools))
+	}
+
+	c.mu.Lock()
+	if time.Since(c.cachesTime) >= cacheSizeRefresh {
+		c.caches, c.cachesTime = CacheSizes(filepath.Join(c.homeDir, "cache")), time.Now()
+	}
+	caches := c.caches
+	c.mu.Unlock()
+	Write(w, caches)
+}
+
+// diskUsage returns the total size of the files under path
+func diskUsage(path string) int64 {
+	var total int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// labelEscaper escapes Prometheus label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
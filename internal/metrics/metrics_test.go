@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gleicon/ophid/internal/security"
+	"github.com/gleicon/ophid/internal/supervisor"
+	"github.com/gleicon/ophid/internal/tool"
+)
+
+func TestCollector(t *testing.T) {
+	home := t.TempDir()
+
+	states := []supervisor.ProcessState{
+		{Name: "web", Status: supervisor.StatusRunning, Ready: true, RestartCount: 2, HealthFailed: 5, StartTime: time.Unix(1700000000, 0)},
+		{Name: `we"ird`, Status: supervisor.StatusBackoff},
+	}
+	statePath := filepath.Join(home, "supervisor", "state.json")
+	writeJSON(t, statePath, states)
+
+	writeJSON(t, filepath.Join(home, "tools", "manifest.json"), tool.ToolManifest{Tools: map[string]*tool.Tool{
+		"ansible": {
+			Name: "ansible", Version: "9.0.0", Source: tool.InstallSource{Type: tool.SourcePyPI},
+			InstallDuration: 1500 * time.Millisecond,
+			Security: tool.SecurityInfo{VulnCount: 3, CriticalVulnCount: 1, SecretsReport: &security.SecretsReport{
+				Findings: []security.SecretFinding{{Severity: "high"}, {Severity: "critical"}, {Severity: "high"}},
+			}},
+		},
+	}})
+
+	os.MkdirAll(filepath.Join(home, "cache", "git", "repo"), 0755)
+	os.WriteFile(filepath.Join(home, "cache", "git", "repo", "pack"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(home, "cache", "sdk.tar.gz"), make([]byte, 10), 0644)
+
+	var out strings.Builder
+	NewCollector(home, statePath).Write(&out)
+	got := out.String()
+
+	for _, want := range []string{
+		"# TYPE ophid_process_restarts_total counter\n",
+		`ophid_process_up{process="web"} 1`,
+		`ophid_process_ready{process="web"} 1`,
+		`ophid_process_status{process="we\"ird",status="backoff"} 1`,
+		`ophid_process_status{process="we\"ird",status="running"} 0`,
+		`ophid_process_restarts_total{process="web"} 2`,
+		`ophid_process_health_check_failures_total{process="web"} 5`,
+		`ophid_process_start_time_seconds{process="web"} 1.7e+09`,
+		`ophid_tool_info{tool="ansible",version="9.0.0",source="pypi"} 1`,
+		`ophid_tool_install_duration_seconds{tool="ansible"} 1.5`,
+		`ophid_tool_vulnerabilities{tool="ansible",severity="critical"} 1`,
+		`ophid_tool_vulnerabilities{tool="ansible",severity="other"} 2`,
+		`ophid_tool_secrets{tool="ansible",severity="high"} 2`,
+		`ophid_cache_size_bytes{cache="git"} 100`,
+		`ophid_cache_size_bytes{cache="archives"} 10`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `ophid_process_start_time_seconds{process="we\"ird"}`) {
+		t.Error("start time of a process that never started")
+	}
+}
+
+func TestCollectorEmptyHome(t *testing.T) {
+	home := t.TempDir()
+	var out strings.Builder
+	NewCollector(home, filepath.Join(home, "state.json")).Write(&out)
+	if out.Len() != 0 {
+		t.Errorf("metrics of an empty home:\n%s", out.String())
+	}
+}
+
+func writeJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,347 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gleicon/ophid/internal/events"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACME renewal defaults
+const (
+	defaultRenewBefore   = 30 * 24 * time.Hour // Renew certificates this long before expiry
+	acmeCheckInterval    = 12 * time.Hour      // Time between expiry checks
+	acmeCheckJitter      = time.Hour           // Random delay added to each check
+	acmeStartupDelay     = time.Minute         // First check after startup (plus jitter)
+	acmeRetryMin         = 15 * time.Minute    // First retry after a failed renewal
+	acmeRetryMax         = 12 * time.Hour      // Longest retry backoff
+	acmeRateLimitBackoff = 3 * time.Hour       // Wait after a rate limit without Retry-After
+	acmeAlertTimeout     = 10 * time.Second    // Renewal webhook request timeout
+
+	// renewalManagerRenewBefore keeps the renewal manager's own autocert
+	// timer until just before expiry; by then the certificate was renewed
+	// and the timer finds it in the cache
+	renewalManagerRenewBefore = time.Hour + time.Minute
+)
+
+// RenewalAlert describes a failed certificate renewal
+type RenewalAlert struct {
+	Domain      string    `json:"domain"`
+	Error       string    `json:"error"`
+	Failures    int       `json:"failures"`
+	Expires     time.Time `json:"expires,omitempty"` // Zero when no certificate was issued yet
+	RateLimited bool      `json:"rate_limited"`
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+// certRenewer renews ACME certificates ahead of expiry in the background,
+// instead of relying on autocert issuing them on a handshake
+type certRenewer struct {
+	renewBefore time.Duration
+	domains     func() []string
+	expiry      func(ctx context.Context, domain string) (time.Time, error) // Zero time when there is no certificate
+	issue       func(ctx context.Context, domain string) error
+	alert       func(RenewalAlert)
+	now         func() time.Time
+
+	state map[string]*renewalState
+	mu    sync.Mutex
+}
+
+// renewalState tracks failed renewals of a domain
+type renewalState struct {
+	failures    int
+	nextAttempt time.Time
+}
+
+// run checks certificates until ctx is cancelled
+func (r *certRenewer) run(ctx context.Context) {
+	wait := acmeStartupDelay + randDuration(acmeCheckJitter)
+	for sleepContext(ctx, wait) {
+		wait = r.check(ctx)
+	}
+}
+
+// check renews the certificates that expire within renewBefore, or were
+// never issued, and returns the time until the next check
+func (r *certRenewer) check(ctx context.Context) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == nil {
+		r.state = make(map[string]*renewalState)
+	}
+
+	now := r.now()
+	wait := acmeCheckInterval + randDuration(acmeCheckJitter)
+
+	for _, domain := range r.domains() {
+		if ctx.Err() != nil {
+			break
+		}
+
+		st := r.state[domain]
+		if st != nil && now.Before(st.nextAttempt) {
+			wait = min(wait, st.nextAttempt.Sub(now))
+			continue
+		}
+
+		expires, err := r.expiry(ctx, domain)
+		if err != nil {
+			log.Printf("Warning: failed to read cached certificate for %s: %v", domain, err)
+			continue
+		}
+		if !expires.IsZero() && expires.Sub(now) > r.renewBefore {
+			delete(r.state, domain)
+			continue
+		}
+
+		if expires.IsZero() {
+			log.Printf("Requesting certificate for %s", domain)
+		} else {
+			log.Printf("Renewing certificate for %s (expires %s)", domain, expires.Format(time.RFC3339))
+		}
+
+		if err := r.issue(ctx, domain); err != nil {
+			if st == nil {
+				st = &renewalState{}
+				r.state[domain] = st
+			}
+			st.failures++
+
+			backoff, rateLimited := rateLimitBackoff(err)
+			if !rateLimited {
+				backoff = min(acmeRetryMin<<min(st.failures-1, 10), acmeRetryMax)
+			}
+			st.nextAttempt = now.Add(backoff)
+			wait = min(wait, backoff)
+
+			log.Printf("Warning: certificate renewal for %s failed (attempt %d, retry in %s): %v", domain, st.failures, backoff, err)
+			r.alert(RenewalAlert{
+				Domain:      domain,
+				Error:       err.Error(),
+				Failures:    st.failures,
+				Expires:     expires,
+				RateLimited: rateLimited,
+				NextAttempt: st.nextAttempt,
+			})
+			continue
+		}
+
+		delete(r.state, domain)
+		log.Printf("Certificate for %s renewed", domain)
+		if expires.IsZero() {
+			events.Emit(events.CertRenewed, domain, "certificate issued", nil)
+		} else {
+			events.Emit(events.CertRenewed, domain, "certificate renewed", map[string]string{"previous_expiry": expires.Format(time.RFC3339)})
+		}
+	}
+
+	return wait
+}
+
+// rateLimitBackoff reports whether err is an ACME rate limit and how long
+// to wait before retrying
+func rateLimitBackoff(err error) (time.Duration, bool) {
+	var acmeErr *acme.Error
+	if !errors.As(err, &acmeErr) {
+		return 0, false
+	}
+	retry, ok := acme.RateLimit(acmeErr)
+	if !ok {
+		return 0, false
+	}
+	if retry <= 0 {
+		retry = acmeRateLimitBackoff
+	}
+	return retry, true
+}
+
+// randDuration returns a random duration in [0, d)
+func randDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// setupRenewal creates the renewal daemon for ACME certificates
+func (s *Server) setupRenewal(cfg TLSConfig) error {
+	renewBefore, err := parseRenewBefore(cfg.RenewBefore)
+	if err != nil {
+		return err
+	}
+
+	// autocert renews loaded certificates by itself later on, in case the
+	// renewal daemon keeps failing
+	s.tlsManager.RenewBefore = max(renewBefore*3/4, renewalManagerRenewBefore)
+
+	s.renewer = &certRenewer{
+		renewBefore: renewBefore,
+		domains:     func() []string { return s.config.Load().TLS.Domains },
+		expiry:      s.cachedCertExpiry,
+		issue:       s.issueCertificate,
+		alert:       s.renewalAlert,
+		now:         time.Now,
+	}
+	return nil
+}
+
+// parseRenewBefore parses tls.renew_before, defaulting to 30 days
+func parseRenewBefore(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultRenewBefore, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= renewalManagerRenewBefore {
+		return 0, fmt.Errorf("invalid renew_before %q (must be a duration above 1h)", value)
+	}
+	return d, nil
+}
+
+// cachedCertExpiry returns when the cached certificate of a domain expires,
+// or the zero time when none is cached
+func (s *Server) cachedCertExpiry(ctx context.Context, domain string) (time.Time, error) {
+	data, err := s.tlsManager.Cache.Get(ctx, domain)
+	if err == autocert.ErrCacheMiss {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	leaf, err := parseCachedLeaf(data)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return leaf.NotAfter, nil
+}
+
+// parseCachedLeaf returns the leaf certificate of an autocert cache entry
+// (private key followed by the certificate chain, PEM encoded)
+func parseCachedLeaf(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no certificate in cache entry")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+// issueCertificate obtains a new certificate for a domain and stores it in
+// the autocert cache. The serving manager picks it up from the cache when
+// its own renewal timer fires or when it first loads the domain.
+func (s *Server) issueCertificate(ctx context.Context, domain string) error {
+	cfg := s.config.Load().TLS
+	cache := &renewalCache{Cache: s.tlsManager.Cache, domain: domain}
+
+	// A fresh manager per attempt: managers keep issued certificates in
+	// memory and would return the old one
+	m := &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Email:       cfg.ACMEEmail,
+		HostPolicy:  autocert.HostWhitelist(domain),
+		Cache:       cache,
+		RenewBefore: renewalManagerRenewBefore,
+	}
+	if err := configureACME(m, cfg); err != nil {
+		return err
+	}
+	if cfg.AutoRedirect {
+		// The HTTP listener serves challenges from the shared cache
+		m.HTTPHandler(nil)
+	}
+
+	// tls-alpn-01 challenges reach the HTTPS listener, which asks this
+	// manager while the attempt runs
+	s.renewalMgr.Store(m)
+	defer s.renewalMgr.Store(nil)
+
+	hello := &tls.ClientHelloInfo{
+		ServerName:   domain,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	}
+	_, err := m.GetCertificate(hello)
+	cache.issued()
+	return err
+}
+
+// acmeCertificate serves ACME certificates, answering tls-alpn-01
+// challenges of a renewal in progress
+func (s *Server) acmeCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if isACMEChallenge(hello) {
+		if m := s.renewalMgr.Load(); m != nil {
+			if cert, err := m.GetCertificate(hello); err == nil {
+				return cert, nil
+			}
+		}
+	}
+	return s.tlsManager.GetCertificate(hello)
+}
+
+// isACMEChallenge reports whether a handshake is a tls-alpn-01 challenge
+func isACMEChallenge(hello *tls.ClientHelloInfo) bool {
+	return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto
+}
+
+// renewalAlert posts a failed renewal to the renewal webhook, if any
+func (s *Server) renewalAlert(alert RenewalAlert) {
+	webhook := s.config.Load().TLS.RenewalWebhook
+	if webhook == "" {
+		return
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+
+	client := &http.Client{Timeout: acmeAlertTimeout}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Warning: failed to send renewal alert: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Warning: renewal webhook returned %s", resp.Status)
+	}
+}
+
+// renewalCache hides a domain's cached certificate from the renewal manager
+// until the new one is issued, so that it requests a new certificate
+type renewalCache struct {
+	autocert.Cache
+	domain string
+	shown  atomic.Bool
+}
+
+func (c *renewalCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if key == c.domain && !c.shown.Load() {
+		return nil, autocert.ErrCacheMiss
+	}
+	return c.Cache.Get(ctx, key)
+}
+
+// issued makes the cached certificate visible again once the attempt is over
+func (c *renewalCache) issued() {
+	c.shown.Store(true)
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// fakeRenewal drives a certRenewer without an ACME server
+type fakeRenewal struct {
+	now     time.Time
+	expires map[string]time.Time
+	errs    map[string]error
+	issued  []string
+	alerts  []RenewalAlert
+}
+
+func (f *fakeRenewal) renewer(domains ...string) *certRenewer {
+	return &certRenewer{
+		renewBefore: defaultRenewBefore,
+		domains:     func() []string { return domains },
+		expiry: func(ctx context.Context, domain string) (time.Time, error) {
+			return f.expires[domain], nil
+		},
+		issue: func(ctx context.Context, domain string) error {
+			f.issued = append(f.issued, domain)
+			if err := f.errs[domain]; err != nil {
+				return err
+			}
+			f.expires[domain] = f.now.Add(90 * 24 * time.Hour)
+			return nil
+		},
+		alert: func(alert RenewalAlert) { f.alerts = append(f.alerts, alert) },
+		now:   func() time.Time { return f.now },
+	}
+}
+
+func TestCertRenewerRenewsBeforeExpiry(t *testing.T) {
+	f := &fakeRenewal{
+		now:  time.Unix(1_700_000_000, 0),
+		errs: map[string]error{},
+	}
+	f.expires = map[string]time.Time{
+		"fresh.example.com":    f.now.Add(60 * 24 * time.Hour),
+		"expiring.example.com": f.now.Add(20 * 24 * time.Hour),
+	}
+	r := f.renewer("fresh.example.com", "expiring.example.com", "new.example.com")
+
+	wait := r.check(context.Background())
+	if fmt.Sprint(f.issued) != "[expiring.example.com new.example.com]" {
+		t.Errorf("issued = %v, want the expiring and the missing certificate", f.issued)
+	}
+	if wait < acmeCheckInterval || wait > acmeCheckInterval+acmeCheckJitter {
+		t.Errorf("wait = %s, want the check interval plus jitter", wait)
+	}
+
+	// Renewed certificates are left alone until they enter the window
+	f.issued = nil
+	r.check(context.Background())
+	if len(f.issued) != 0 || len(f.alerts) != 0 {
+		t.Errorf("second check issued %v, alerts %v", f.issued, f.alerts)
+	}
+}
+
+func TestCertRenewerBackoff(t *testing.T) {
+	f := &fakeRenewal{now: time.Unix(1_700_000_000, 0)}
+	f.expires = map[string]time.Time{"app.example.com": f.now.Add(10 * 24 * time.Hour)}
+	f.errs = map[string]error{"app.example.com": errors.New("connection refused")}
+	r := f.renewer("app.example.com")
+
+	if wait := r.check(context.Background()); wait != acmeRetryMin {
+		t.Errorf("wait after failure = %s, want %s", wait, acmeRetryMin)
+	}
+	if len(f.alerts) != 1 || f.alerts[0].Failures != 1 || f.alerts[0].RateLimited || !f.alerts[0].Expires.Equal(f.expires["app.example.com"]) {
+		t.Fatalf("alerts = %+v", f.alerts)
+	}
+
+	// No retry before the backoff elapsed
+	f.now = f.now.Add(10 * time.Minute)
+	if wait := r.check(context.Background()); wait != 5*time.Minute || len(f.issued) != 1 {
+		t.Errorf("check during backoff: wait %s, issued %v", wait, f.issued)
+	}
+
+	// The backoff doubles with every failure
+	f.now = f.now.Add(5 * time.Minute)
+	if wait := r.check(context.Background()); wait != 2*acmeRetryMin || f.alerts[1].Failures != 2 {
+		t.Errorf("wait after second failure = %s, alert %+v", wait, f.alerts[1])
+	}
+
+	// Rate limits wait for Retry-After
+	f.now = f.now.Add(time.Hour)
+	f.errs["app.example.com"] = fmt.Errorf("acme/autocert: %w", &acme.Error{
+		StatusCode:  http.StatusTooManyRequests,
+		ProblemType: "urn:ietf:params:acme:error:rateLimited",
+		Header:      http.Header{"Retry-After": []string{"7200"}},
+	})
+	if wait := r.check(context.Background()); wait != 2*time.Hour || !f.alerts[2].RateLimited {
+		t.Errorf("wait after rate limit = %s, alert %+v", wait, f.alerts[2])
+	}
+
+	// Success clears the failures
+	f.now = f.now.Add(2 * time.Hour)
+	delete(f.errs, "app.example.com")
+	r.check(context.Background())
+	if len(r.state) != 0 || len(f.alerts) != 3 {
+		t.Errorf("state after renewal = %v, alerts %d", r.state, len(f.alerts))
+	}
+}
+
+// testCacheEntry returns an autocert cache entry (key first, then the
+// chain) with a self-signed certificate for host
+func testCacheEntry(t *testing.T, host string, notAfter time.Time) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotAfter:     notAfter,
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Test CA"}}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return append(entry, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+}
+
+func TestRenewalCacheAndExpiry(t *testing.T) {
+	notAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second).UTC()
+	entry := testCacheEntry(t, "app.example.com", notAfter)
+
+	ctx := context.Background()
+	cache := autocert.DirCache(t.TempDir())
+	if err := cache.Put(ctx, "app.example.com", entry); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{tlsManager: &autocert.Manager{Cache: cache}}
+	expires, err := s.cachedCertExpiry(ctx, "app.example.com")
+	if err != nil || !expires.Equal(notAfter) {
+		t.Errorf("cachedCertExpiry() = %v, %v, want %v", expires, err, notAfter)
+	}
+	if expires, err := s.cachedCertExpiry(ctx, "other.example.com"); err != nil || !expires.IsZero() {
+		t.Errorf("cachedCertExpiry() of a missing domain = %v, %v", expires, err)
+	}
+
+	// The renewal manager does not see the old certificate until it is done
+	rc := &renewalCache{Cache: cache, domain: "app.example.com"}
+	if _, err := rc.Get(ctx, "app.example.com"); err != autocert.ErrCacheMiss {
+		t.Errorf("Get() during renewal = %v, want cache miss", err)
+	}
+	rc.issued()
+	if _, err := rc.Get(ctx, "app.example.com"); err != nil {
+		t.Errorf("Get() after renewal = %v", err)
+	}
+}
+
+func TestACMEChallengeConfig(t *testing.T) {
+	state, err := buildTLSState(TLSConfig{}, func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := state.configForClient(&tls.ClientHelloInfo{ServerName: "app.example.com", SupportedProtos: []string{acme.ALPNProto}})
+	if err != nil || config == nil || len(config.NextProtos) != 1 || config.NextProtos[0] != acme.ALPNProto {
+		t.Errorf("challenge config = %v, %v, want acme-tls/1 only", config, err)
+	}
+
+	config, err = state.configForClient(&tls.ClientHelloInfo{ServerName: "app.example.com", SupportedProtos: []string{"h2", acme.ALPNProto}})
+	if err != nil || config != nil {
+		t.Errorf("regular handshake got %v, %v, want the listener policy", config, err)
+	}
+}
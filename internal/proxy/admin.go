@@ -0,0 +1,380 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// BackendStatus describes a load-balanced backend in admin API responses
+type BackendStatus struct {
+	Route       string         `json:"route"`
+	Name        string         `json:"name,omitempty"`
+	URL         string         `json:"url"`
+	Health      HealthStatus   `json:"health"`
+	Connections int32          `json:"connections"`
+	Outlier     *OutlierStatus `json:"outlier,omitempty"`
+}
+
+// BackendStatuses returns the state of every load-balanced backend
+func (s *Server) BackendStatuses() []BackendStatus {
+	var statuses []BackendStatus
+
+	for _, route := range s.router.Load().GetRoutes() {
+		for _, backend := range route.Backends {
+			status := BackendStatus{
+				Route:  describeRoute(route),
+				Name:   backend.Name,
+				URL:    backend.URLStr,
+				Health: HealthStatusUnknown,
+			}
+			if backend.Health != nil {
+				status.Health = backend.Health.GetStatus()
+				status.Connections = backend.Health.GetConnections()
+			}
+			if route.outliers != nil {
+				if outlier, ok := route.outliers.status(backend); ok {
+					status.Outlier = &outlier
+				}
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses
+}
+
+// RouteStatuses returns the live traffic statistics of every route
+func (s *Server) RouteStatuses() []RouteStatus {
+	now := time.Now()
+
+	var statuses []RouteStatus
+	for _, route := range s.router.Load().GetRoutes() {
+		status := RouteStatus{Route: describeRoute(route)}
+		if route.drain != nil {
+			status.Active = route.drain.inflight.Load()
+		}
+		if route.stats != nil {
+			status.OneMinute = route.stats.window(now, time.Minute)
+			status.FiveMinutes = route.stats.window(now, 5*time.Minute)
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// adminHandler serves the admin API:
+//
+//	GET /backends      backend health and outlier detection state (JSON)
+//	GET /routes        per-route traffic over the last 1m and 5m (JSON)
+//	GET /drains        routes and backends draining after a reload (JSON)
+//	GET /certificates  served certificates and their expiry (JSON)
+//	GET /metrics       backend, route and certificate metrics in Prometheus text format,
+//	                   plus those added with AddMetrics
+//	POST /reload       reload the configuration with the function set by SetReloader (operator)
+//	POST /stop         shut the proxy down gracefully (admin)
+//
+// Reads need the read-only role; see adminAuth.
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern, role string, h http.HandlerFunc) {
+		mux.Handle(pattern, s.adminAuth(role, h))
+	}
+
+	handle("GET /backends", RoleReadOnly, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.BackendStatuses())
+	})
+
+	handle("GET /routes", RoleReadOnly, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.RouteStatuses())
+	})
+
+	handle("GET /drains", RoleReadOnly, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.drains.status())
+	})
+
+	handle("GET /certificates", RoleReadOnly, func(w http.ResponseWriter, r *http.Request) {
+		certs, err := s.Certificates()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(certs)
+	})
+
+	handle("GET /metrics", RoleReadOnly, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeBackendMetrics(w, s.BackendStatuses())
+		writeRouteMetrics(w, s.router.Load().GetRoutes())
+		if certs, err := s.Certificates(); err == nil {
+			writeCertificateMetrics(w, certs)
+		}
+		for _, write := range s.metrics {
+			write(w)
+		}
+	})
+
+	handle("POST /reload", RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		err := s.ReloadConfig()
+		if errors.Is(err, ErrNoReloader) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handle("POST /stop", RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		// Shutdown waits for this request, so it can't run inside it
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			s.Shutdown(ctx)
+		}()
+	})
+
+	return mux
+}
+
+// SetReloader sets how POST /reload, SIGHUP and config watching get the
+// new configuration, e.g. by reading the config file again. Call it before
+// Start.
+func (s *Server) SetReloader(load func() (*Config, error)) {
+	s.reloader = load
+}
+
+// AddMetrics adds metrics to the admin API's /metrics, e.g. those of
+// supervised processes. Call it before Start.
+func (s *Server) AddMetrics(write func(io.Writer)) {
+	s.metrics = append(s.metrics, write)
+}
+
+// SupervisorState returns the supervisor state file the server reads
+// process readiness from
+func (s *Server) SupervisorState() string {
+	return s.readiness.path
+}
+
+// DefaultAdminAddr is the admin API address CLI commands use by default
+const DefaultAdminAddr = "127.0.0.1:9901"
+
+// AdminTokenEnv holds the token CLI commands send to the admin API
+const AdminTokenEnv = "OPHID_ADMIN_TOKEN"
+
+// AdminGet fetches an admin API endpoint of a running proxy and decodes the
+// JSON response into v
+func AdminGet(addr, path string, v interface{}) error {
+	resp, err := adminRequest("GET", addr, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode admin API response: %w", err)
+	}
+	return nil
+}
+
+// AdminPost asks a running proxy to perform an admin API operation
+func AdminPost(addr, path string) error {
+	resp, err := adminRequest("POST", addr, path)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// adminRequest sends a request to the admin API, with the token from
+// AdminTokenEnv, and fails on non-2xx responses
+func adminRequest(method, addr, path string) (*http.Response, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	req, err := http.NewRequest(method, "http://"+addr+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv(AdminTokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach admin API at %s (is general.admin_listen set?): %w", addr, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := strings.TrimSpace(string(body))
+		if resp.StatusCode == http.StatusUnauthorized {
+			msg += " (set " + AdminTokenEnv + ")"
+		}
+		return nil, fmt.Errorf("admin API %s %s returned %s: %s", method, path, resp.Status, msg)
+	}
+	return resp, nil
+}
+
+// startAdmin starts the admin API server
+func (s *Server) startAdmin(addr string) {
+	s.adminServer = &http.Server{
+		Addr:              addr,
+		Handler:           s.adminHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("Starting admin API on %s", addr)
+	if err := s.adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Admin API error: %v", err)
+	}
+}
+
+// writeBackendMetrics writes backend gauges in Prometheus text format
+func writeBackendMetrics(w io.Writer, statuses []BackendStatus) {
+	type metric struct {
+		name, help, kind string
+		value            func(BackendStatus) (float64, bool)
+	}
+
+	metrics := []metric{
+		{"ophid_proxy_backend_healthy", "Whether the backend is healthy (1) or not (0).", "gauge",
+			func(b BackendStatus) (float64, bool) { return boolFloat(b.Health == HealthStatusHealthy), true }},
+		{"ophid_proxy_backend_connections", "Active connections to the backend.", "gauge",
+			func(b BackendStatus) (float64, bool) { return float64(b.Connections), true }},
+		{"ophid_proxy_backend_ejected", "Whether outlier detection has ejected the backend.", "gauge",
+			func(b BackendStatus) (float64, bool) {
+				return boolFloat(b.Outlier != nil && b.Outlier.Ejected), b.Outlier != nil
+			}},
+		{"ophid_proxy_backend_ejections_total", "Times outlier detection ejected the backend.", "counter",
+			func(b BackendStatus) (float64, bool) {
+				return outlierValue(b, func(o *OutlierStatus) float64 { return float64(o.Ejections) })
+			}},
+		{"ophid_proxy_backend_latency_p95_seconds", "Recent p95 response latency.", "gauge",
+			func(b BackendStatus) (float64, bool) {
+				return outlierValue(b, func(o *OutlierStatus) float64 { return o.LatencyP95 })
+			}},
+		{"ophid_proxy_backend_latency_ewma_seconds", "Moving average of response latency.", "gauge",
+			func(b BackendStatus) (float64, bool) {
+				return outlierValue(b, func(o *OutlierStatus) float64 { return o.LatencyEWMA })
+			}},
+		{"ophid_proxy_backend_error_rate", "Moving average of the 5xx/transport error rate.", "gauge",
+			func(b BackendStatus) (float64, bool) {
+				return outlierValue(b, func(o *OutlierStatus) float64 { return o.ErrorRate })
+			}},
+	}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, b := range statuses {
+			if v, ok := m.value(b); ok {
+				fmt.Fprintf(w, "%s{route=\"%s\",backend=\"%s\"} %g\n", m.name, labelEscaper.Replace(b.Route), labelEscaper.Replace(b.URL), v)
+			}
+		}
+	}
+}
+
+// writeRouteMetrics writes route request counters and duration and size
+// histograms in Prometheus text format
+func writeRouteMetrics(w io.Writer, routes []*Route) {
+	type routeSnapshot struct {
+		name                        string
+		active                      int64
+		requests, errors            uint64
+		duration, reqSize, respSize histogram
+	}
+
+	snapshots := make([]routeSnapshot, 0, len(routes))
+	for _, route := range routes {
+		if route.stats == nil {
+			continue
+		}
+		snap := routeSnapshot{name: labelEscaper.Replace(describeRoute(route))}
+		if route.drain != nil {
+			snap.active = route.drain.inflight.Load()
+		}
+		route.stats.mu.Lock()
+		snap.requests, snap.errors = route.stats.requests, route.stats.errors
+		snap.duration = route.stats.duration.clone()
+		snap.reqSize = route.stats.reqSize.clone()
+		snap.respSize = route.stats.respSize.clone()
+		route.stats.mu.Unlock()
+		snapshots = append(snapshots, snap)
+	}
+
+	counters := []struct {
+		name, help, kind string
+		value            func(routeSnapshot) float64
+	}{
+		{"ophid_proxy_route_requests_total", "Requests handled by the route.", "counter",
+			func(r routeSnapshot) float64 { return float64(r.requests) }},
+		{"ophid_proxy_route_errors_total", "Requests answered with a 5xx status.", "counter",
+			func(r routeSnapshot) float64 { return float64(r.errors) }},
+		{"ophid_proxy_route_active_requests", "Requests in flight.", "gauge",
+			func(r routeSnapshot) float64 { return float64(r.active) }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", c.name, c.help, c.name, c.kind)
+		for _, r := range snapshots {
+			fmt.Fprintf(w, "%s{route=\"%s\"} %g\n", c.name, r.name, c.value(r))
+		}
+	}
+
+	histograms := []struct {
+		name, help string
+		value      func(routeSnapshot) histogram
+	}{
+		{"ophid_proxy_route_request_duration_seconds", "Request duration.",
+			func(r routeSnapshot) histogram { return r.duration }},
+		{"ophid_proxy_route_request_size_bytes", "Request body size.",
+			func(r routeSnapshot) histogram { return r.reqSize }},
+		{"ophid_proxy_route_response_size_bytes", "Response body size.",
+			func(r routeSnapshot) histogram { return r.respSize }},
+	}
+	for _, h := range histograms {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+		for _, r := range snapshots {
+			hist := h.value(r)
+			var cumulative uint64
+			for i, bound := range hist.bounds {
+				cumulative += hist.counts[i]
+				fmt.Fprintf(w, "%s_bucket{route=\"%s\",le=\"%g\"} %d\n", h.name, r.name, bound, cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket{route=\"%s\",le=\"+Inf\"} %d\n", h.name, r.name, hist.count)
+			fmt.Fprintf(w, "%s_sum{route=\"%s\"} %g\n", h.name, r.name, hist.sum)
+			fmt.Fprintf(w, "%s_count{route=\"%s\"} %d\n", h.name, r.name, hist.count)
+		}
+	}
+}
+
+func outlierValue(b BackendStatus, value func(*OutlierStatus) float64) (float64, bool) {
+	if b.Outlier == nil {
+		return 0, false
+	}
+	return value(b.Outlier), true
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// labelEscaper escapes Prometheus label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
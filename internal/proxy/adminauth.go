@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Admin API roles, each allowed what the previous one is
+const (
+	RoleReadOnly = "read-only" // Status, certificates and metrics
+	RoleOperator = "operator"  // Reload the configuration
+	RoleAdmin    = "admin"     // Stop the proxy
+)
+
+var roleRank = map[string]int{RoleReadOnly: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// ValidRole reports whether role is an admin API role
+func ValidRole(role string) bool {
+	return roleRank[role] > 0
+}
+
+// localCaller attributes requests when no tokens are configured
+const localCaller = "local"
+
+// AuditEntry is a line of the admin audit log
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Caller string    `json:"caller"` // Token name, or "local"
+	Role   string    `json:"role,omitempty"`
+	Remote string    `json:"remote"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+}
+
+// adminAuth lets requests reach next only with at least role. Without
+// configured tokens, reads are open and changes are limited to loopback
+// clients, as the API always was; with tokens, every request needs one.
+// Changes and refusals are attributed in the audit log.
+func (s *Server) adminAuth(role string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		general := s.config.Load().General
+		caller, granted := localCaller, RoleAdmin
+		status := 0
+
+		if len(general.AdminTokens) == 0 {
+			if role != RoleReadOnly && !loopbackClient(r) {
+				status = http.StatusForbidden
+			}
+		} else if token, ok := adminToken(general.AdminTokens, r); !ok {
+			caller, granted, status = "", "", http.StatusUnauthorized
+		} else {
+			caller, granted = token.Name, token.Role
+			if roleRank[granted] < roleRank[role] {
+				status = http.StatusForbidden
+			}
+		}
+
+		if status != 0 {
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="ophid-admin"`)
+			}
+			http.Error(w, fmt.Sprintf("%s: %s role required", http.StatusText(status), role), status)
+		} else {
+			rw := &auditResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			next(rw, r)
+			status = rw.status
+			if role == RoleReadOnly {
+				return
+			}
+		}
+
+		s.audit(general.AdminAuditLog, AuditEntry{
+			Time:   time.Now().UTC(),
+			Caller: caller,
+			Role:   granted,
+			Remote: r.RemoteAddr,
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Status: status,
+		})
+	})
+}
+
+// adminToken returns the configured token a request carries
+func adminToken(tokens []AdminToken, r *http.Request) (AdminToken, bool) {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || bearer == "" {
+		return AdminToken{}, false
+	}
+	// Compare digests, so neither contents nor lengths leak through timing
+	got := sha256.Sum256([]byte(bearer))
+	for _, token := range tokens {
+		want := sha256.Sum256([]byte(token.Token))
+		if token.Token != "" && subtle.ConstantTimeCompare(got[:], want[:]) == 1 {
+			return token, true
+		}
+	}
+	return AdminToken{}, false
+}
+
+// loopbackClient reports whether a request comes from this host
+func loopbackClient(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// audit records an admin API change or refusal in the error log and, when
+// configured, the audit log
+func (s *Server) audit(path string, e AuditEntry) {
+	caller := e.Caller
+	if caller == "" {
+		caller = "unauthenticated client"
+	}
+	log.Printf("Admin API: %s %s by %s from %s: %d", e.Method, e.Path, caller, e.Remote, e.Status)
+
+	if path == "" {
+		return
+	}
+	path = expandHome(path)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Printf("Admin audit log error: %v", err)
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("Admin audit log error: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Printf("Admin audit log error: %v", err)
+	}
+}
+
+// auditResponseWriter remembers the status a handler writes
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
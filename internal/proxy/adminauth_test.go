@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminAuthWithoutTokens(t *testing.T) {
+	s := &Server{}
+	s.config.Store(&Config{})
+	s.router.Store(NewRouter())
+	handler := s.adminHandler()
+
+	serve := func(method, path, remote string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve("GET", "/routes", "192.0.2.1:4000"); code != http.StatusOK {
+		t.Errorf("remote GET /routes = %d", code)
+	}
+	if code := serve("POST", "/reload", "192.0.2.1:4000"); code != http.StatusForbidden {
+		t.Errorf("remote POST /reload = %d, want 403", code)
+	}
+	// Local clients get through; this server has nothing to reload from
+	if code := serve("POST", "/reload", "127.0.0.1:4000"); code != http.StatusNotImplemented {
+		t.Errorf("local POST /reload = %d, want 501", code)
+	}
+}
+
+func TestAdminAuthRoles(t *testing.T) {
+	auditLog := filepath.Join(t.TempDir(), "audit", "admin.jsonl")
+	config := &Config{General: GeneralConfig{
+		AdminTokens: []AdminToken{
+			{Name: "grafana", Token: "read-token", Role: RoleReadOnly},
+			{Name: "deploy", Token: "operator-token", Role: RoleOperator},
+			{Name: "oncall", Token: "admin-token", Role: RoleAdmin},
+		},
+		AdminAuditLog: auditLog,
+	}}
+	s := &Server{}
+	s.config.Store(config)
+	s.router.Store(NewRouter())
+	reloads := 0
+	s.SetReloader(func() (*Config, error) {
+		reloads++
+		return config, nil
+	})
+	handler := s.adminHandler()
+
+	serve := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		method, path, token string
+		want                int
+	}{
+		{"GET", "/routes", "", http.StatusUnauthorized},
+		{"GET", "/routes", "wrong-token", http.StatusUnauthorized},
+		{"GET", "/routes", "read-token", http.StatusOK},
+		{"POST", "/reload", "read-token", http.StatusForbidden},
+		{"POST", "/reload", "operator-token", http.StatusNoContent},
+		{"POST", "/stop", "operator-token", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if code := serve(tt.method, tt.path, tt.token); code != tt.want {
+			t.Errorf("%s %s with %q = %d, want %d", tt.method, tt.path, tt.token, code, tt.want)
+		}
+	}
+	if reloads != 1 {
+		t.Errorf("reloaded %d times, want 1", reloads)
+	}
+
+	// Refusals and changes are attributed; successful reads aren't logged
+	f, err := os.Open(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, strings.Join([]string{e.Caller, e.Method, e.Path, http.StatusText(e.Status)}, " "))
+	}
+	want := []string{
+		" GET /routes Unauthorized",
+		" GET /routes Unauthorized",
+		"grafana POST /reload Forbidden",
+		"deploy POST /reload No Content",
+		"deploy POST /stop Forbidden",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit log:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAdminStop(t *testing.T) {
+	s, err := NewServer(&Config{General: GeneralConfig{
+		AdminTokens: []AdminToken{{Name: "oncall", Token: "admin-token", Role: RoleAdmin}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/stop", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rec := httptest.NewRecorder()
+	s.adminHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /stop = %d", rec.Code)
+	}
+
+	select {
+	case <-s.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
+
+func TestCheckAdmin(t *testing.T) {
+	report := CheckConfig(&Config{General: GeneralConfig{
+		AdminListen: "0.0.0.0:9901",
+		AdminTokens: []AdminToken{
+			{Name: "deploy", Token: "{{secret:deploy-token}}", Role: "operator"},
+			{Name: "deploy", Token: "plain", Role: "root"},
+		},
+	}}, CheckOptions{})
+
+	var messages []string
+	for _, issue := range report.Issues {
+		messages = append(messages, issue.Severity+": "+issue.Message)
+	}
+	all := strings.Join(messages, "\n")
+	for _, want := range []string{
+		`error: admin_tokens[1]: duplicate name "deploy"`,
+		"error: admin_tokens[1]: role must be",
+		"warning: admin_tokens[1]: token is in plain text",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("issues missing %q:\n%s", want, all)
+		}
+	}
+	if strings.Contains(all, "admin_tokens[0]") || strings.Contains(all, "reachable from other hosts") {
+		t.Errorf("unexpected issues:\n%s", all)
+	}
+
+	report = CheckConfig(&Config{General: GeneralConfig{AdminListen: ":9901"}}, CheckOptions{})
+	found := false
+	for _, issue := range report.Issues {
+		found = found || strings.Contains(issue.Message, "reachable from other hosts")
+	}
+	if !found {
+		t.Error("no warning for an unauthenticated admin API on all interfaces")
+	}
+}
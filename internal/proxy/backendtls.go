@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gleicon/ophid/internal/httpclient"
+)
+
+// newBackendTransport creates a pooled transport for backends, verifying
+// https ones with tlsConfig, or the configured CAs when it is nil
+func newBackendTransport(tlsConfig *tls.Config) *http.Transport {
+	if tlsConfig == nil {
+		tlsConfig = httpclient.TLSClientConfig()
+	}
+	return &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		DisableCompression:  false,
+		TLSClientConfig:     tlsConfig,
+	}
+}
+
+// prepareBackendTLS builds the transports of a route's backend_tls and of
+// the backends with a tls table of their own. With preserve_sni and an
+// upstream_host, that host is the SNI of backends without a server_name.
+func prepareBackendTLS(route *Route) error {
+	route.transport = nil
+	sni := route.sniHost()
+	if route.BackendTLS != nil || sni != "" {
+		config, err := backendClientConfig(route.BackendTLS, sni)
+		if err != nil {
+			return fmt.Errorf("backend_tls: %w", err)
+		}
+		route.transport = newBackendTransport(config)
+	}
+
+	for _, backend := range route.Backends {
+		backend.transport = route.transport
+		if backend.TLS == nil {
+			continue
+		}
+		config, err := backendClientConfig(backend.TLS, sni)
+		if err != nil {
+			return fmt.Errorf("backend %s: tls: %w", backend.URLStr, err)
+		}
+		backend.transport = newBackendTransport(config)
+	}
+	return nil
+}
+
+// backendClientConfig builds the TLS client config of backend options,
+// which may be nil, sending sni unless they name a server
+func backendClientConfig(c *BackendTLSConfig, sni string) (*tls.Config, error) {
+	config := &tls.Config{RootCAs: httpclient.RootCAs()}
+	if c != nil {
+		var err error
+		if config, err = c.clientConfig(); err != nil {
+			return nil, err
+		}
+	}
+	if config.ServerName == "" {
+		config.ServerName = sni
+	}
+	return config, nil
+}
+
+// clientConfig builds the TLS client config of the options
+func (c *BackendTLSConfig) clientConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		RootCAs:            httpclient.RootCAs(),
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		data, err := os.ReadFile(expandHome(c.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_file: %w", err)
+		}
+		pool := config.RootCAs
+		if pool != nil {
+			pool = pool.Clone()
+		} else if pool, err = x509.SystemCertPool(); err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates in ca_file %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("cert_file and key_file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(expandHome(c.CertFile), expandHome(c.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// insecureBackends returns the URLs of a route's backends whose
+// certificates aren't verified
+func insecureBackends(route *Route) []string {
+	var insecure []string
+	if route.Target != "" && route.BackendTLS != nil && route.BackendTLS.InsecureSkipVerify {
+		insecure = append(insecure, route.Target)
+	}
+	for _, backend := range route.Backends {
+		tlsConfig := route.BackendTLS
+		if backend.TLS != nil {
+			tlsConfig = backend.TLS
+		}
+		if tlsConfig != nil && tlsConfig.InsecureSkipVerify {
+			insecure = append(insecure, backend.URLStr)
+		}
+	}
+	return insecure
+}
+
+// logInsecureBackends warns about every backend whose certificate isn't
+// verified, so an insecure_skip_verify left in a config doesn't go unseen
+func logInsecureBackends(routes []*Route) {
+	for _, route := range routes {
+		for _, backend := range insecureBackends(route) {
+			log.Printf("WARNING: route %s: TLS verification of backend %s is disabled (insecure_skip_verify); its traffic can be intercepted and altered", describeRoute(route), backend)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/proxy/localca"
+)
+
+func TestBackendTLS(t *testing.T) {
+	var clientCerts int
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientCerts = len(r.TLS.PeerCertificates)
+		w.Write([]byte("ok"))
+	}))
+	backend.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	backend.StartTLS()
+	defer backend.Close()
+
+	dir := t.TempDir()
+	writePEM := func(name, kind string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	caFile := writePEM("backend-ca.pem", "CERTIFICATE", backend.Certificate().Raw)
+
+	ca, err := localca.LoadOrCreate(filepath.Join(dir, "ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ca.Certificate("proxy.internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(client.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM("client.pem", "CERTIFICATE", client.Certificate[0])
+	keyFile := writePEM("client-key.pem", "PRIVATE KEY", key)
+
+	tests := []struct {
+		name     string
+		tls      *BackendTLSConfig
+		want     int
+		wantCert bool
+	}{
+		{"no options", nil, http.StatusBadGateway, false},
+		{"ca_file", &BackendTLSConfig{CAFile: caFile}, http.StatusOK, false},
+		{"server_name", &BackendTLSConfig{CAFile: caFile, ServerName: "example.com"}, http.StatusOK, false},
+		{"wrong server_name", &BackendTLSConfig{CAFile: caFile, ServerName: "other.internal"}, http.StatusBadGateway, false},
+		{"client certificate", &BackendTLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, http.StatusOK, true},
+		{"insecure_skip_verify", &BackendTLSConfig{InsecureSkipVerify: true}, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientCerts = 0
+			route := &Route{Host: "app.example.com", Target: backend.URL, BackendTLS: tt.tls}
+			if err := prepareRoute(route); err != nil {
+				t.Fatalf("prepareRoute() error = %v", err)
+			}
+			rec := httptest.NewRecorder()
+			NewHTTPProxy(route).ServeHTTP(rec, httptest.NewRequest("GET", "http://app.example.com/", nil))
+			if rec.Code != tt.want {
+				t.Errorf("got %d, want %d", rec.Code, tt.want)
+			}
+			if tt.wantCert != (clientCerts > 0) {
+				t.Errorf("backend saw %d client certificates", clientCerts)
+			}
+		})
+	}
+
+	// A backend's own options replace the route's
+	route := &Route{
+		Host:       "app.example.com",
+		BackendTLS: &BackendTLSConfig{InsecureSkipVerify: true},
+		Backends:   []*Backend{{Name: "strict", URLStr: backend.URL, TLS: &BackendTLSConfig{ServerName: "example.com"}}},
+	}
+	if err := prepareRoute(route); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	NewHTTPProxy(route).ServeHTTP(rec, httptest.NewRequest("GET", "http://app.example.com/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("a backend without its CA got %d, want 502", rec.Code)
+	}
+	if insecure := insecureBackends(route); len(insecure) != 0 {
+		t.Errorf("insecureBackends() = %v, want none", insecure)
+	}
+}
+
+func TestBackendTLSErrors(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0644)
+
+	for name, config := range map[string]*BackendTLSConfig{
+		"missing ca_file":  {CAFile: "/nonexistent/ca.pem"},
+		"ca_file":          {CAFile: notPEM},
+		"cert without key": {CertFile: notPEM},
+		"bad key pair":     {CertFile: notPEM, KeyFile: notPEM},
+	} {
+		route := &Route{Target: "https://backend.internal", BackendTLS: config}
+		if err := prepareRoute(route); err == nil {
+			t.Errorf("%s: prepareRoute() accepted %+v", name, config)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/proxy/localca"
+)
+
+// CertExpiryWarning is how close to expiry a certificate is reported as
+// expiring
+const CertExpiryWarning = 14 * 24 * time.Hour
+
+// Certificate sources
+const (
+	CertSourceACME    = "acme"
+	CertSourceStatic  = "static"
+	CertSourceLocalCA = "local-ca"
+)
+
+// CertificateInfo describes a cached or loaded certificate
+type CertificateInfo struct {
+	Name     string    `json:"name"`   // ACME cache key, certificate file or CA name
+	Source   string    `json:"source"` // "acme", "static" or "local-ca"
+	SANs     []string  `json:"sans"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+	DaysLeft int       `json:"days_left"`
+}
+
+// Status returns "expired", "expiring" (within CertExpiryWarning) or "valid"
+func (c CertificateInfo) Status() string {
+	remaining := time.Until(c.NotAfter)
+	switch {
+	case remaining <= 0:
+		return "expired"
+	case remaining < CertExpiryWarning:
+		return "expiring"
+	}
+	return "valid"
+}
+
+// newCertificateInfo describes a parsed certificate
+func newCertificateInfo(name, source string, leaf *x509.Certificate) CertificateInfo {
+	sans := append([]string{}, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+
+	issuer := leaf.Issuer.CommonName
+	if issuer == "" && len(leaf.Issuer.Organization) > 0 {
+		issuer = leaf.Issuer.Organization[0]
+	}
+
+	return CertificateInfo{
+		Name:     name,
+		Source:   source,
+		SANs:     sans,
+		Issuer:   issuer,
+		NotAfter: leaf.NotAfter,
+		DaysLeft: int(time.Until(leaf.NotAfter).Hours() / 24),
+	}
+}
+
+// ListCertificates returns the certificates a TLS configuration serves,
+// read from disk: the ACME cache, cert_file, or the local CA root (leaf
+// certificates of the local CA are minted in memory). Sorted by expiry.
+func ListCertificates(cfg TLSConfig) ([]CertificateInfo, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var certs []CertificateInfo
+	switch {
+	case cfg.CertFile != "":
+		info, err := staticCertificateInfo(cfg.CertFile)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, info)
+	case cfg.ACMEProvider == "local":
+		dir := cfg.LocalCADir
+		if dir == "" {
+			dir = DefaultLocalCADir
+		}
+		info, err := staticCertificateInfo(filepath.Join(expandHome(dir), localca.CertFile))
+		if errors.Is(err, fs.ErrNotExist) {
+			break // Created on first start
+		}
+		if err != nil {
+			return nil, err
+		}
+		info.Source = CertSourceLocalCA
+		certs = append(certs, info)
+	default:
+		cached, err := cachedCertificates(acmeCacheDir(cfg))
+		if err != nil {
+			return nil, err
+		}
+		certs = cached
+	}
+
+	sortCertificates(certs)
+	return certs, nil
+}
+
+// Certificates returns the certificates the running proxy serves. The
+// static certificate is the one loaded at startup.
+func (s *Server) Certificates() ([]CertificateInfo, error) {
+	cfg := s.config.Load().TLS
+	if s.tls == nil || s.tls.static == nil {
+		return ListCertificates(cfg)
+	}
+
+	s.tls.staticMu.RLock()
+	raw := s.tls.static.Certificate[0]
+	s.tls.staticMu.RUnlock()
+
+	leaf, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return []CertificateInfo{newCertificateInfo(cfg.CertFile, CertSourceStatic, leaf)}, nil
+}
+
+// staticCertificateInfo describes the first certificate of a PEM file
+func staticCertificateInfo(path string) (CertificateInfo, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return CertificateInfo{}, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	leaf, err := parseCachedLeaf(data)
+	if err != nil {
+		return CertificateInfo{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return newCertificateInfo(path, CertSourceStatic, leaf), nil
+}
+
+// cachedCertificates describes the certificates in an autocert cache
+// directory, skipping the account key and challenge tokens
+func cachedCertificates(dir string) ([]CertificateInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate cache: %w", err)
+	}
+
+	var certs []CertificateInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, "acme_account") || strings.HasSuffix(name, "+token") ||
+			strings.HasSuffix(name, "+http-01") || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate cache: %w", err)
+		}
+		leaf, err := parseCachedLeaf(data)
+		if err != nil {
+			continue // Not a certificate entry
+		}
+		certs = append(certs, newCertificateInfo(name, CertSourceACME, leaf))
+	}
+	return certs, nil
+}
+
+// acmeCacheDir returns the ACME certificate cache directory
+func acmeCacheDir(cfg TLSConfig) string {
+	if cfg.CacheDir == "" {
+		return ".ophid/certs"
+	}
+	return cfg.CacheDir
+}
+
+// sortCertificates orders certificates by expiry, soonest first
+func sortCertificates(certs []CertificateInfo) {
+	sort.Slice(certs, func(i, j int) bool {
+		if !certs[i].NotAfter.Equal(certs[j].NotAfter) {
+			return certs[i].NotAfter.Before(certs[j].NotAfter)
+		}
+		return certs[i].Name < certs[j].Name
+	})
+}
+
+// writeCertificateMetrics writes the time left until each certificate expires
+func writeCertificateMetrics(w io.Writer, certs []CertificateInfo) {
+	if len(certs) == 0 {
+		return
+	}
+
+	const name = "ophid_proxy_certificate_expiry_seconds"
+	now := time.Now()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, "Seconds until the certificate expires (negative once expired).", name)
+	for _, cert := range certs {
+		fmt.Fprintf(w, "%s{name=\"%s\",source=\"%s\"} %g\n", name, labelEscaper.Replace(cert.Name), cert.Source, cert.NotAfter.Sub(now).Seconds())
+	}
+}
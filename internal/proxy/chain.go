@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gleicon/ophid/internal/proxy/middleware"
+)
+
+// mergeMiddleware combines the general middleware chain with a route's
+// entries. A route entry replaces the general entry of the same type in
+// place (its options merged over the general ones) or drops it when
+// disabled; entries of other types run after the general chain.
+func mergeMiddleware(general, route []MiddlewareConfig) ([]MiddlewareConfig, error) {
+	if err := checkDuplicateMiddleware(general); err != nil {
+		return nil, fmt.Errorf("general.middleware: %w", err)
+	}
+	if err := checkDuplicateMiddleware(route); err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[string]MiddlewareConfig, len(route))
+	for _, mw := range route {
+		overrides[mw.Type] = mw
+	}
+
+	var merged []MiddlewareConfig
+	for _, mw := range general {
+		override, ok := overrides[mw.Type]
+		if !ok {
+			if !mw.Disabled {
+				merged = append(merged, mw)
+			}
+			continue
+		}
+		delete(overrides, mw.Type)
+
+		if override.Disabled {
+			continue
+		}
+		options := make(map[string]interface{}, len(mw.Options)+len(override.Options))
+		for k, v := range mw.Options {
+			options[k] = v
+		}
+		for k, v := range override.Options {
+			options[k] = v
+		}
+		merged = append(merged, MiddlewareConfig{Type: mw.Type, Options: options})
+	}
+
+	for _, mw := range route {
+		if _, ok := overrides[mw.Type]; ok && !mw.Disabled {
+			merged = append(merged, mw)
+		}
+	}
+
+	return merged, nil
+}
+
+// checkDuplicateMiddleware rejects a chain listing a type twice
+func checkDuplicateMiddleware(chain []MiddlewareConfig) error {
+	seen := make(map[string]bool, len(chain))
+	for _, mw := range chain {
+		if seen[mw.Type] {
+			return fmt.Errorf("middleware %q listed more than once", mw.Type)
+		}
+		seen[mw.Type] = true
+	}
+	return nil
+}
+
+// buildChain builds a route's middleware from the general chain and its own
+// entries. Each route gets its own instances (e.g., rate limiter state).
+func buildChain(general []MiddlewareConfig, route *Route) ([]Middleware, error) {
+	configs, err := mergeMiddleware(general, route.MiddlewareList)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := make([]Middleware, 0, len(configs))
+	for _, cfg := range configs {
+		mw, err := buildMiddleware(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("middleware %q: %w", cfg.Type, err)
+		}
+		chain = append(chain, mw)
+	}
+	return chain, nil
+}
+
+// buildMiddleware creates a middleware from its configuration
+func buildMiddleware(cfg MiddlewareConfig) (Middleware, error) {
+	opts := middlewareOptions(cfg.Options)
+
+	switch cfg.Type {
+	case "ratelimit":
+		rps, err := opts.int("rps", 0)
+		if err != nil {
+			return nil, err
+		}
+		if rps <= 0 {
+			return nil, fmt.Errorf("rps must be positive")
+		}
+		burst, err := opts.int("burst", rps)
+		if err != nil {
+			return nil, err
+		}
+		return middleware.NewRateLimiter(rps, burst).Middleware, nil
+
+	case "cors":
+		origins, err := opts.strings("allow_origins", []string{"*"})
+		if err != nil {
+			return nil, err
+		}
+		methods, err := opts.strings("allow_methods", nil)
+		if err != nil {
+			return nil, err
+		}
+		headers, err := opts.strings("allow_headers", nil)
+		if err != nil {
+			return nil, err
+		}
+		return middleware.NewCORS(origins, methods, headers).Middleware, nil
+
+	case "request_id":
+		header, err := opts.string("header", middleware.DefaultRequestIDHeader)
+		if err != nil {
+			return nil, err
+		}
+		return middleware.NewRequestID(header).Middleware, nil
+
+	case "access_log":
+		enabled, err := opts.bool("enabled", true)
+		if err != nil {
+			return nil, err
+		}
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				middleware.SetAccessLog(r, enabled)
+				next.ServeHTTP(w, r)
+			})
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown middleware type (supported: ratelimit, cors, request_id, access_log)")
+	}
+}
+
+// middlewareOptions reads typed options decoded from TOML or JSON
+type middlewareOptions map[string]interface{}
+
+func (o middlewareOptions) int(name string, def int) (int, error) {
+	switch v := o[name].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("option %s must be an integer", name)
+}
+
+func (o middlewareOptions) string(name, def string) (string, error) {
+	switch v := o[name].(type) {
+	case nil:
+		return def, nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("option %s must be a string", name)
+}
+
+func (o middlewareOptions) bool(name string, def bool) (bool, error) {
+	switch v := o[name].(type) {
+	case nil:
+		return def, nil
+	case bool:
+		return v, nil
+	}
+	return false, fmt.Errorf("option %s must be a boolean", name)
+}
+
+func (o middlewareOptions) strings(name string, def []string) ([]string, error) {
+	switch v := o[name].(type) {
+	case nil:
+		return def, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("option %s must be a list of strings", name)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("option %s must be a list of strings", name)
+}
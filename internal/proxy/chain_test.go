@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/proxy/middleware"
+)
+
+func TestMergeMiddleware(t *testing.T) {
+	general := []MiddlewareConfig{
+		{Type: "request_id"},
+		{Type: "ratelimit", Options: map[string]interface{}{"rps": int64(100), "burst": int64(200)}},
+		{Type: "access_log"},
+	}
+
+	tests := []struct {
+		name  string
+		route []MiddlewareConfig
+		want  []MiddlewareConfig
+	}{
+		{"inherit", nil, general},
+		{
+			"override options",
+			[]MiddlewareConfig{{Type: "ratelimit", Options: map[string]interface{}{"rps": int64(5)}}},
+			[]MiddlewareConfig{
+				general[0],
+				{Type: "ratelimit", Options: map[string]interface{}{"rps": int64(5), "burst": int64(200)}},
+				general[2],
+			},
+		},
+		{
+			"disable and append",
+			[]MiddlewareConfig{{Type: "access_log", Disabled: true}, {Type: "cors"}},
+			[]MiddlewareConfig{general[0], general[1], {Type: "cors"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeMiddleware(general, tt.route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeMiddleware() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := mergeMiddleware(general, []MiddlewareConfig{{Type: "cors"}, {Type: "cors"}}); err == nil {
+		t.Error("duplicate route middleware should be rejected")
+	}
+}
+
+func TestBuildMiddlewareErrors(t *testing.T) {
+	for _, cfg := range []MiddlewareConfig{
+		{Type: "ratelimit"},
+		{Type: "ratelimit", Options: map[string]interface{}{"rps": "ten"}},
+		{Type: "cors", Options: map[string]interface{}{"allow_origins": "*"}},
+		{Type: "access_log", Options: map[string]interface{}{"enabled": "no"}},
+		{Type: "auth"},
+	} {
+		if _, err := buildMiddleware(cfg); err == nil {
+			t.Errorf("buildMiddleware(%+v) should fail", cfg)
+		}
+	}
+}
+
+func TestGeneralMiddleware(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Request-ID")))
+	}))
+	defer backend.Close()
+
+	config, err := ParseConfig([]byte(`
+[[general.middleware]]
+type = "request_id"
+
+[[general.middleware]]
+type = "ratelimit"
+options = { rps = 1, burst = 1 }
+
+[[routes]]
+host = "app.example.com"
+target = "` + backend.URL + `"
+
+[[routes]]
+host = "health.example.com"
+target = "` + backend.URL + `"
+[[routes.middleware]]
+type = "ratelimit"
+disabled = true
+[[routes.middleware]]
+type = "access_log"
+options = { enabled = false }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	handler := middleware.NewLoggerWithFormat(log.New(&logs, "", 0), "json").Middleware(s)
+
+	serve := func(host string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://"+host+"/", nil))
+		return rec
+	}
+
+	// The general chain applies to every route
+	rec := serve("app.example.com")
+	id := rec.Header().Get("X-Request-ID")
+	if rec.Code != http.StatusOK || id == "" || rec.Body.String() != id {
+		t.Fatalf("request ID not set and forwarded: %d %q %q", rec.Code, id, rec.Body.String())
+	}
+	if !strings.Contains(logs.String(), `"request_id":"`+id+`"`) {
+		t.Errorf("access log misses the request ID: %s", logs.String())
+	}
+	if rec := serve("app.example.com"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("general rate limit not applied: %d", rec.Code)
+	}
+
+	// The route override drops the rate limit and access logging
+	logs.Reset()
+	for i := 0; i < 3; i++ {
+		if rec := serve("health.example.com"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d to the unlimited route got %d", i, rec.Code)
+		}
+	}
+	if logs.Len() != 0 {
+		t.Errorf("access_log enabled = false still logged: %s", logs.String())
+	}
+}
@@ -0,0 +1,544 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/proxy/middleware"
+	"github.com/gleicon/ophid/internal/secrets"
+	"github.com/gleicon/ophid/internal/supervisor"
+)
+
+// Check severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// CheckIssue is a problem found while validating a configuration
+type CheckIssue struct {
+	Severity string
+	Message  string
+}
+
+// CheckReport collects the results of CheckConfig
+type CheckReport struct {
+	Issues []CheckIssue
+}
+
+// CheckOptions tunes CheckConfig
+type CheckOptions struct {
+	ResolveDNS bool          // Resolve backend and domain names
+	DNSTimeout time.Duration // Per-lookup timeout (default 5s)
+}
+
+// HasErrors reports whether any issue is an error
+func (r *CheckReport) HasErrors() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *CheckReport) errorf(format string, args ...interface{}) {
+	r.Issues = append(r.Issues, CheckIssue{Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *CheckReport) warnf(format string, args ...interface{}) {
+	r.Issues = append(r.Issues, CheckIssue{Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+// CheckConfig validates a configuration without opening listeners, log
+// sinks or other side effects
+func CheckConfig(cfg *Config, opts CheckOptions) *CheckReport {
+	report := &CheckReport{}
+
+	if opts.DNSTimeout == 0 {
+		opts.DNSTimeout = 5 * time.Second
+	}
+
+	if len(cfg.Routes) == 0 && cfg.Dynamic.Backend == "" {
+		report.warnf("no routes configured")
+	}
+
+	if _, err := drainTimeout(cfg); err != nil {
+		report.errorf("general: %v", err)
+	}
+
+	checkListen(cfg, report)
+	checkAdmin(cfg, report)
+	checkLogSinks(cfg, report)
+	checkMiddleware(cfg, report)
+	checkRoutes(cfg, report, opts)
+	checkDependencies(cfg, report)
+	checkTLS(cfg, report, opts)
+
+	if cfg.Dynamic.Backend != "" {
+		if _, err := NewRouteSource(cfg.Dynamic); err != nil {
+			report.errorf("dynamic: %v", err)
+		}
+	}
+
+	if cfg.General.GeoIPDatabase != "" {
+		if _, err := os.Stat(expandHome(cfg.General.GeoIPDatabase)); err != nil {
+			report.errorf("geoip_database: %v", err)
+		}
+	}
+	if _, err := middleware.ParseTrustedProxies(cfg.General.GeoIPTrustedProxies); err != nil {
+		report.errorf("geoip_trusted_proxies: %v", err)
+	}
+
+	if cfg.Egress.InterceptTLS && (cfg.Egress.CACert == "" || cfg.Egress.CAKey == "") {
+		report.errorf("egress: intercept_tls requires ca_cert and ca_key")
+	}
+
+	return report
+}
+
+// checkListen validates listen addresses
+func checkListen(cfg *Config, report *CheckReport) {
+	for _, addr := range cfg.General.Listen {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			report.errorf("listen address %q: %v", addr, err)
+		}
+	}
+	if len(cfg.General.Listen) > 2 {
+		report.warnf("only the first two listen addresses are used (HTTP, HTTPS)")
+	}
+}
+
+// checkAdmin validates the admin API address, tokens and audit log
+func checkAdmin(cfg *Config, report *CheckReport) {
+	general := cfg.General
+	if general.AdminListen == "" {
+		if len(general.AdminTokens) > 0 || general.AdminAuditLog != "" {
+			report.warnf("admin_tokens and admin_audit_log have no effect without admin_listen")
+		}
+		return
+	}
+
+	host, _, err := net.SplitHostPort(general.AdminListen)
+	if err != nil {
+		report.errorf("admin_listen %q: %v", general.AdminListen, err)
+		return
+	}
+	if ip := net.ParseIP(host); len(general.AdminTokens) == 0 && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		report.warnf("admin_listen %s is reachable from other hosts without admin_tokens; anyone there can read proxy state", general.AdminListen)
+	}
+
+	names := make(map[string]bool)
+	for i, token := range general.AdminTokens {
+		name := fmt.Sprintf("admin_tokens[%d]", i)
+		if token.Name == "" {
+			report.errorf("%s: name is required (it attributes requests in the audit log)", name)
+		} else if names[token.Name] {
+			report.errorf("%s: duplicate name %q", name, token.Name)
+		}
+		names[token.Name] = true
+		if !ValidRole(token.Role) {
+			report.errorf("%s: role must be %s, %s or %s", name, RoleReadOnly, RoleOperator, RoleAdmin)
+		}
+		switch {
+		case token.Token == "":
+			report.errorf("%s: token is empty", name)
+		case !secrets.HasRefs(token.Token):
+			report.warnf("%s: token is in plain text; keep it in the secrets store and use \"{{secret:name}}\"", name)
+		}
+	}
+
+	if general.AdminAuditLog != "" {
+		if err := checkWritableDir(filepath.Dir(expandHome(general.AdminAuditLog))); err != nil {
+			report.errorf("admin_audit_log: %v", err)
+		}
+	}
+}
+
+// checkLogSinks validates log sink settings without opening them
+func checkLogSinks(cfg *Config, report *CheckReport) {
+	check := func(kind string, sinks []LogSinkConfig) {
+		for i, sink := range sinks {
+			name := fmt.Sprintf("%s_log_sinks[%d]", kind, i)
+			switch sink.Type {
+			case "file", "":
+				if sink.Path == "" {
+					report.errorf("%s: file sink requires path", name)
+				}
+			case "syslog":
+				if sink.Address == "" {
+					report.errorf("%s: syslog sink requires address", name)
+				}
+			case "http":
+				if u, err := url.Parse(sink.URL); err != nil || u.Scheme == "" || u.Host == "" {
+					report.errorf("%s: http sink requires an absolute url", name)
+				}
+				if sink.FlushInterval != "" {
+					if _, err := time.ParseDuration(sink.FlushInterval); err != nil {
+						report.errorf("%s: invalid flush_interval %q", name, sink.FlushInterval)
+					}
+				}
+			default:
+				report.errorf("%s: unknown type %q (supported: file, syslog, http)", name, sink.Type)
+			}
+
+			for _, l := range sink.Listeners {
+				if !containsString(cfg.General.Listen, l) {
+					report.warnf("%s: listener %s is not in general.listen", name, l)
+				}
+			}
+		}
+	}
+
+	check("access", cfg.General.AccessLogSinks)
+	check("error", cfg.General.ErrorLogSinks)
+
+	if f := cfg.General.AccessLogFormat; f != "" && f != "text" && f != "json" {
+		report.errorf("access_log_format: unknown format %q (supported: text, json)", f)
+	}
+}
+
+// checkMiddleware validates the general middleware chain
+func checkMiddleware(cfg *Config, report *CheckReport) {
+	if err := checkDuplicateMiddleware(cfg.General.Middleware); err != nil {
+		report.errorf("general.middleware: %v", err)
+	}
+
+	for _, mw := range cfg.General.Middleware {
+		if _, err := buildMiddleware(mw); err != nil {
+			report.errorf("general.middleware: middleware %q: %v", mw.Type, err)
+		}
+		if mw.Type == "access_log" && cfg.General.AccessLog == "" && len(cfg.General.AccessLogSinks) == 0 {
+			report.warnf("general.middleware: access_log has no effect without access_log or access_log_sinks")
+		}
+	}
+}
+
+// checkRoutes validates routes, backends, and route shadowing
+func checkRoutes(cfg *Config, report *CheckReport, opts CheckOptions) {
+	resolved := make(map[string]bool)
+
+	for i := range cfg.Routes {
+		// Work on a copy: prepareRoute fills in runtime fields
+		route := cfg.Routes[i]
+		name := routeName(i, &route)
+
+		if err := prepareRoute(&route); err != nil {
+			report.errorf("%s: %v", name, err)
+			continue
+		}
+
+		switch {
+		case route.Static:
+			if route.StaticRoot == "" {
+				report.errorf("%s: static route requires static_root", name)
+			} else if info, err := os.Stat(route.StaticRoot); err != nil || !info.IsDir() {
+				report.errorf("%s: static_root %s is not a directory", name, route.StaticRoot)
+			}
+		case route.Target == "" && len(route.Backends) == 0:
+			report.errorf("%s: no target or backends", name)
+		}
+
+		if len(route.MiddlewareList) > 0 {
+			if _, err := buildChain(cfg.General.Middleware, &route); err != nil {
+				report.errorf("%s: %v", name, err)
+			}
+		}
+
+		for _, backend := range insecureBackends(&route) {
+			report.warnf("%s: TLS verification of backend %s is disabled (insecure_skip_verify)", name, backend)
+		}
+
+		if route.LoadBalance.Outlier != nil && len(route.Backends) < 2 {
+			report.warnf("%s: outlier detection needs at least two backends", name)
+		}
+
+		if route.Target != "" {
+			if u, err := url.Parse(route.Target); err != nil || u.Host == "" {
+				report.errorf("%s: invalid target %q (expected e.g. http://host:port)", name, route.Target)
+			}
+		}
+
+		for _, c := range []struct {
+			kind       string
+			conditions map[string]string
+		}{
+			{"match_headers", route.MatchHeaders},
+			{"match_query", route.MatchQuery},
+			{"match_cookies", route.MatchCookies},
+		} {
+			for key := range c.conditions {
+				if strings.TrimSpace(key) == "" {
+					report.errorf("%s: %s has an empty name", name, c.kind)
+				}
+			}
+		}
+
+		if (len(route.GeoIP.Countries) > 0 || len(route.GeoIP.AllowCountries) > 0 ||
+			len(route.GeoIP.BlockCountries) > 0 || route.GeoIP.Header != "") && cfg.General.GeoIPDatabase == "" {
+			report.errorf("%s: geoip options require general.geoip_database", name)
+		}
+
+		if opts.ResolveDNS {
+			for _, host := range routeBackendHosts(&route) {
+				if resolved[host] {
+					continue
+				}
+				resolved[host] = true
+				if err := resolveHost(host, opts.DNSTimeout); err != nil {
+					report.errorf("%s: backend host %s does not resolve: %v", name, host, err)
+				}
+			}
+		}
+	}
+
+	// Shadowing: a route matched earlier that covers every request a later
+	// one would match makes the later route unreachable
+	ordered := make([]*Route, 0, len(cfg.Routes))
+	index := make(map[*Route]int, len(cfg.Routes))
+	for _, i := range RouteOrder(cfg.Routes) {
+		ordered = append(ordered, &cfg.Routes[i])
+		index[&cfg.Routes[i]] = i
+	}
+
+	for _, c := range routeConflicts(ordered) {
+		name := routeName(index[c.route], c.route)
+		other := routeName(index[c.shadowedBy], c.shadowedBy)
+		if c.duplicate {
+			report.errorf("%s conflicts with %s: identical match criteria", name, other)
+		} else {
+			report.warnf("%s is unreachable: shadowed by %s", name, other)
+		}
+	}
+}
+
+// checkDependencies warns about depends_on processes the supervisor doesn't
+// know, whose routes would answer 503 until they are started
+func checkDependencies(cfg *Config, report *CheckReport) {
+	if !slices.ContainsFunc(cfg.Routes, func(r Route) bool { return r.DependsOn != "" }) {
+		return
+	}
+
+	known := make(map[string]bool)
+	statePath := supervisorStatePath(cfg.General)
+	states, err := supervisor.LoadState(statePath)
+	for _, state := range states {
+		known[state.Name] = true
+	}
+
+	for i := range cfg.Routes {
+		route := &cfg.Routes[i]
+		if route.DependsOn == "" || known[route.DependsOn] {
+			continue
+		}
+		if err != nil {
+			report.warnf("%s: depends_on %s, but no supervisor state was found at %s; it answers 503 until the process is supervised and ready",
+				routeName(i, route), route.DependsOn, statePath)
+		} else {
+			report.warnf("%s: depends_on %s, which is not supervised; it answers 503 until the process is started and ready",
+				routeName(i, route), route.DependsOn)
+		}
+	}
+}
+
+// checkTLS validates certificate and ACME prerequisites
+func checkTLS(cfg *Config, report *CheckReport, opts CheckOptions) {
+	t := cfg.TLS
+	if !t.Enabled {
+		if t.AutoRedirect {
+			report.warnf("tls: auto_redirect has no effect while TLS is disabled")
+		}
+		return
+	}
+
+	if err := validateRedirect(t); err != nil {
+		report.errorf("tls: %v", err)
+	}
+
+	// Validate policies (and load cert_file) with a placeholder ACME source
+	placeholder := func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil }
+	state, err := buildTLSState(t, placeholder)
+	if err != nil {
+		report.errorf("tls: %v", err)
+	}
+
+	switch {
+	case t.CertFile != "" || t.KeyFile != "":
+		if state != nil {
+			checkStaticCert(state.static, t.Domains, report)
+		}
+	case t.ACMEProvider == "local":
+		dir := t.LocalCADir
+		if dir == "" {
+			dir = DefaultLocalCADir
+		}
+		if err := checkWritableDir(expandHome(dir)); err != nil {
+			report.errorf("tls: local_ca_dir %s: %v", dir, err)
+		}
+	default:
+		if len(t.Domains) == 0 {
+			report.errorf("tls: ACME requires at least one domain")
+		}
+		if t.ACMEEmail == "" {
+			report.warnf("tls: acme_email is not set; expiry notices will not be delivered")
+		}
+		if t.ACMEProvider == "zerossl" && (t.ACMEEABKeyID == "" || t.ACMEEABHMACKey == "") {
+			report.errorf("tls: zerossl requires acme_eab_kid and acme_eab_hmac_key")
+		}
+		if !secrets.HasRefs(t.ACMEEABHMACKey) {
+			if _, err := externalAccountBinding(t); err != nil {
+				report.errorf("tls: %v", err)
+			} else if t.ACMEEABHMACKey != "" {
+				report.warnf("tls: acme_eab_hmac_key is in plain text; keep it in the secrets store and use \"{{secret:name}}\"")
+			}
+		}
+
+		// HTTP-01 challenges are answered on the plain HTTP listener
+		httpAddr := ":80"
+		if len(cfg.General.Listen) > 0 {
+			httpAddr = cfg.General.Listen[0]
+		}
+		if _, port, err := net.SplitHostPort(httpAddr); err == nil && port != "80" {
+			report.warnf("tls: HTTP listener %s is not on port 80; ACME HTTP-01 challenges need a port 80 forward", httpAddr)
+		}
+
+		cacheDir := acmeCacheDir(t)
+		if err := checkWritableDir(cacheDir); err != nil {
+			report.errorf("tls: cache_dir %s: %v", cacheDir, err)
+		}
+
+		if _, err := parseRenewBefore(t.RenewBefore); err != nil {
+			report.errorf("tls: %v", err)
+		}
+		if t.RenewalWebhook != "" {
+			if u, err := url.Parse(t.RenewalWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				report.errorf("tls: renewal_webhook must be an http(s) URL")
+			}
+		}
+
+		if opts.ResolveDNS {
+			for _, domain := range t.Domains {
+				if err := resolveHost(domain, opts.DNSTimeout); err != nil {
+					report.warnf("tls: domain %s does not resolve: %v", domain, err)
+				}
+			}
+		}
+	}
+
+	if t.OCSPStapling && t.CertFile == "" {
+		report.warnf("tls: ocsp_stapling only applies to cert_file")
+	}
+	if (t.RenewBefore != "" || t.RenewalWebhook != "") && (t.CertFile != "" || t.ACMEProvider == "local") {
+		report.warnf("tls: renew_before and renewal_webhook only apply to ACME certificates")
+	}
+}
+
+// checkStaticCert checks a static certificate's expiry and names
+func checkStaticCert(cert *tls.Certificate, domains []string, report *CheckReport) {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		report.errorf("tls: failed to parse certificate: %v", err)
+		return
+	}
+
+	if remaining := time.Until(leaf.NotAfter); remaining <= 0 {
+		report.errorf("tls: certificate expired on %s", leaf.NotAfter.Format("2006-01-02"))
+	} else if remaining < CertExpiryWarning {
+		report.warnf("tls: certificate expires on %s", leaf.NotAfter.Format("2006-01-02"))
+	}
+
+	for _, domain := range domains {
+		if err := leaf.VerifyHostname(domain); err != nil {
+			report.warnf("tls: certificate does not cover %s", domain)
+		}
+	}
+}
+
+// routeName describes a route for messages
+func routeName(i int, route *Route) string {
+	host := route.Host
+	if host == "" {
+		host = "*"
+	}
+	return fmt.Sprintf("route #%d (%s%s)", i+1, host, route.Path)
+}
+
+// routeBackendHosts returns the host names a route proxies to
+func routeBackendHosts(route *Route) []string {
+	var urls []string
+	if route.Target != "" {
+		urls = append(urls, route.Target)
+	}
+	for _, backend := range route.Backends {
+		urls = append(urls, backend.URLStr)
+	}
+
+	var hosts []string
+	for _, raw := range urls {
+		if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	return hosts
+}
+
+// resolveHost resolves a host name; IP literals always succeed
+func resolveHost(host string, timeout time.Duration) error {
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err := net.DefaultResolver.LookupHost(ctx, host)
+	return err
+}
+
+// checkWritableDir checks that dir, or the nearest existing parent it would
+// be created under, is a writable directory. Nothing is created.
+func checkWritableDir(dir string) error {
+	dir = filepath.Clean(dir)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+
+	probe, err := os.CreateTemp(dir, ".ophid-check-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
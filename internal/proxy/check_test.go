@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRouteShadows(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Route
+		want bool
+	}{
+		{"catch-all", Route{}, Route{Host: "example.com", Path: "/api/*"}, true},
+		{"same host prefix", Route{Host: "example.com", Path: "/api/*"}, Route{Host: "example.com", Path: "/api/v1/*"}, true},
+		{"narrower first", Route{Host: "example.com", Path: "/api/v1/*"}, Route{Host: "example.com", Path: "/api/*"}, false},
+		{"wildcard host", Route{Host: "*.example.com"}, Route{Host: "app.example.com"}, true},
+		{"wildcard apex", Route{Host: "*.example.com"}, Route{Host: "example.com"}, false},
+		{"different hosts", Route{Host: "a.example.com"}, Route{Host: "b.example.com"}, false},
+		{"method specific", Route{Path: "/api/*", Method: "GET"}, Route{Path: "/api/users"}, false},
+		{"any method", Route{Path: "/api/*", Method: "*"}, Route{Path: "/api/users", Method: "POST"}, true},
+		{"suffix", Route{Path: "/*.jpg"}, Route{Path: "/logo.jpg"}, true},
+		{"country conditional", Route{GeoIP: GeoIPConfig{Countries: []string{"US"}}}, Route{Path: "/x"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routeShadows(&tt.a, &tt.b); got != tt.want {
+				t.Errorf("routeShadows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	cfg := &Config{
+		General: GeneralConfig{
+			Listen:          []string{":8080"},
+			AccessLogFormat: "xml",
+		},
+		Routes: []Route{
+			{Host: "example.com", Path: "/api/*", Target: "http://127.0.0.1:3000"},
+			{Host: "example.com", Path: "/api/v1/*", Target: "http://127.0.0.1:3001"},
+			{Host: "example.com", Path: "/api/*", Target: "http://127.0.0.1:3002"},
+			{Host: "other.com", Target: "127.0.0.1:4000"},
+			{Host: "hooks.com", Target: "http://127.0.0.1:5000", Hooks: &HooksConfig{Reject: "request.path.("}},
+			{Host: "*.example.com", Target: "http://127.0.0.1:6000", Priority: 5},
+			{Host: "app.example.com", Target: "http://127.0.0.1:6001"},
+			{Host: "internal.com", Target: "https://10.0.0.5", BackendTLS: &BackendTLSConfig{InsecureSkipVerify: true}},
+			{Host: "mtls.com", Target: "https://10.0.0.6", BackendTLS: &BackendTLSConfig{CertFile: "/nonexistent/client.pem"}},
+		},
+	}
+
+	report := CheckConfig(cfg, CheckOptions{})
+	if !report.HasErrors() {
+		t.Fatal("expected errors")
+	}
+
+	expect := []struct {
+		severity string
+		contains string
+	}{
+		{SeverityWarning, "route #7 (app.example.com) is unreachable: shadowed by route #6"},
+		{SeverityError, "route #3 (example.com/api/*) conflicts with route #1"},
+		{SeverityError, "route #4 (other.com): invalid target"},
+		{SeverityError, "route #5 (hooks.com)"},
+		{SeverityError, "access_log_format"},
+		{SeverityWarning, "route #8 (internal.com): TLS verification of backend https://10.0.0.5 is disabled"},
+		{SeverityError, "backend_tls: cert_file and key_file must be set together"},
+	}
+
+	for _, e := range expect {
+		found := false
+		for _, issue := range report.Issues {
+			if issue.Severity == e.severity && strings.Contains(issue.Message, e.contains) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing %s containing %q in %+v", e.severity, e.contains, report.Issues)
+		}
+	}
+
+	// More specific routes are matched first, whatever their position
+	for _, issue := range report.Issues {
+		if strings.Contains(issue.Message, "route #2") {
+			t.Errorf("unexpected issue for route #2: %s", issue.Message)
+		}
+	}
+
+	// The config itself is not modified
+	if cfg.Routes[4].hooks != nil {
+		t.Error("CheckConfig compiled hooks into the caller's config")
+	}
+}
+
+func TestCheckConfigValid(t *testing.T) {
+	cfg := &Config{
+		General: GeneralConfig{Listen: []string{":8080"}},
+		Routes: []Route{
+			{Host: "example.com", Path: "/api/*", Target: "http://127.0.0.1:3000"},
+			{Host: "example.com", Target: "http://127.0.0.1:3001"},
+		},
+	}
+
+	report := CheckConfig(cfg, CheckOptions{ResolveDNS: true})
+	if len(report.Issues) != 0 {
+		t.Errorf("unexpected issues: %+v", report.Issues)
+	}
+}
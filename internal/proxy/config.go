@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// DefaultLocalCADir holds the development CA used by acme_provider = "local"
+const DefaultLocalCADir = "~/.ophid/ca"
+
+// LoadConfig loads a proxy configuration from a TOML file and the files it
+// includes
+func LoadConfig(path string) (*Config, error) {
+	return LoadConfigEnv(path, "")
+}
+
+// ParseConfig parses a TOML proxy configuration
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	if err := toml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	config.TLS.CacheDir = expandHome(config.TLS.CacheDir)
+	for i := range config.Routes {
+		config.Routes[i].StaticRoot = expandHome(config.Routes[i].StaticRoot)
+	}
+
+	return &config, nil
+}
+
+// expandHome expands a leading ~ to the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
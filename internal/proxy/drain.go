@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultDrainTimeout bounds how long removed routes and backends may keep
+// serving in-flight requests after a reload
+const defaultDrainTimeout = 30 * time.Second
+
+// drainPollInterval is how often a drain checks for finished requests
+const drainPollInterval = 100 * time.Millisecond
+
+// drainTracker counts in-flight requests for a route or backend and lets a
+// drain cancel the ones still running at its deadline
+type drainTracker struct {
+	inflight   atomic.Int64
+	draining   atomic.Bool
+	closeConns atomic.Bool
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// newDrainTracker creates a tracker
+func newDrainTracker() *drainTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &drainTracker{ctx: ctx, cancel: cancel}
+}
+
+// track registers an in-flight request. The returned context is cancelled
+// when the request's own context is or when a drain deadline expires; done
+// must be called when the request finishes.
+func (t *drainTracker) track(parent context.Context) (context.Context, func()) {
+	t.inflight.Add(1)
+
+	ctx, cancel := context.WithCancel(parent)
+	stop := context.AfterFunc(t.ctx, cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+		t.inflight.Add(-1)
+	}
+}
+
+// serve tracks a request while next handles it. Responses started while
+// draining with closeConns set ask the client to close the connection.
+func (t *drainTracker) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	ctx, done := t.track(r.Context())
+	defer done()
+
+	next.ServeHTTP(&drainResponseWriter{ResponseWriter: w, tracker: t}, r.WithContext(ctx))
+}
+
+// drainResponseWriter adds "Connection: close" to responses started while
+// its tracker is draining
+type drainResponseWriter struct {
+	http.ResponseWriter
+	tracker     *drainTracker
+	wroteHeader bool
+}
+
+func (w *drainResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.tracker.draining.Load() && w.tracker.closeConns.Load() {
+			w.Header().Set("Connection", "close")
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *drainResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *drainResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// DrainStatus reports the progress of a route or backend drain
+type DrainStatus struct {
+	Kind     string    `json:"kind"` // "route" or "backend"
+	Name     string    `json:"name"`
+	Started  time.Time `json:"started"`
+	Deadline time.Time `json:"deadline"`
+	Inflight int64     `json:"inflight"`
+}
+
+// drainEntry is a running drain
+type drainEntry struct {
+	kind, name string
+	started    time.Time
+	deadline   time.Time
+	tracker    *drainTracker
+}
+
+// drainRegistry keeps the drains in progress
+type drainRegistry struct {
+	closeConns bool // Mark client connections of draining requests for close
+	entries    map[*drainEntry]struct{}
+	mu         sync.Mutex
+}
+
+// newDrainRegistry creates an empty registry
+func newDrainRegistry(closeConns bool) *drainRegistry {
+	return &drainRegistry{closeConns: closeConns, entries: make(map[*drainEntry]struct{})}
+}
+
+// start drains a tracker: it waits for in-flight requests to finish and
+// cancels whatever is left at the deadline
+func (d *drainRegistry) start(kind, name string, tracker *drainTracker, timeout time.Duration) {
+	tracker.closeConns.Store(d.closeConns)
+	tracker.draining.Store(true)
+	if tracker.inflight.Load() == 0 {
+		tracker.cancel()
+		return
+	}
+
+	now := time.Now()
+	entry := &drainEntry{kind: kind, name: name, started: now, deadline: now.Add(timeout), tracker: tracker}
+
+	d.mu.Lock()
+	d.entries[entry] = struct{}{}
+	d.mu.Unlock()
+
+	log.Printf("Draining %s %s: %d in-flight request(s), deadline %s", kind, name, tracker.inflight.Load(), timeout)
+
+	go func() {
+		ticker := time.NewTicker(drainPollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if tracker.inflight.Load() == 0 {
+				log.Printf("Drained %s %s in %s", kind, name, time.Since(now).Round(time.Millisecond))
+				break
+			}
+			if time.Now().After(entry.deadline) {
+				log.Printf("Drain deadline for %s %s reached: cancelling %d request(s)", kind, name, tracker.inflight.Load())
+				break
+			}
+		}
+
+		tracker.cancel()
+
+		d.mu.Lock()
+		delete(d.entries, entry)
+		d.mu.Unlock()
+	}()
+}
+
+// status returns the drains in progress, oldest first
+func (d *drainRegistry) status() []DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	statuses := make([]DrainStatus, 0, len(d.entries))
+	for entry := range d.entries {
+		statuses = append(statuses, DrainStatus{
+			Kind:     entry.kind,
+			Name:     entry.name,
+			Started:  entry.started,
+			Deadline: entry.deadline,
+			Inflight: entry.tracker.inflight.Load(),
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Started.Before(statuses[j].Started)
+	})
+	return statuses
+}
+
+// drainRemoved starts draining the routes and backends of oldRoutes that are
+// not part of newRoutes. Routes are identified by their match criteria and
+// backends by route and URL.
+func (d *drainRegistry) drainRemoved(oldRoutes []*Route, newRoutes []Route, timeout time.Duration) {
+	kept := make(map[string]map[string]bool, len(newRoutes))
+	for i := range newRoutes {
+		route := &newRoutes[i]
+		urls := make(map[string]bool)
+		for _, backend := range route.Backends {
+			urls[backend.URLStr] = true
+		}
+		if route.Target != "" {
+			urls[route.Target] = true
+		}
+		kept[describeRoute(route)] = urls
+	}
+
+	for _, route := range oldRoutes {
+		name := describeRoute(route)
+		urls, ok := kept[name]
+		if !ok {
+			if route.drain != nil {
+				d.start("route", name, route.drain, timeout)
+			}
+			continue
+		}
+
+		for _, backend := range route.Backends {
+			if !urls[backend.URLStr] && backend.drain != nil {
+				d.start("backend", name+" "+backend.URLStr, backend.drain, timeout)
+			}
+		}
+
+		// A replaced target only served requests of the old route
+		if route.Target != "" && !urls[route.Target] && route.drain != nil {
+			d.start("backend", name+" "+route.Target, route.drain, timeout)
+		}
+	}
+}
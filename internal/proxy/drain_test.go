@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blockingBackend holds requests until release is closed or the request is
+// cancelled
+func blockingBackend(t *testing.T) (*httptest.Server, chan struct{}, chan struct{}) {
+	t.Helper()
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			w.Write([]byte("done"))
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	return backend, started, release
+}
+
+func serveAsync(s *Server, url string) chan *httptest.ResponseRecorder {
+	result := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		result <- rec
+	}()
+	return result
+}
+
+func TestDrainRemovedRoute(t *testing.T) {
+	backend, started, release := blockingBackend(t)
+
+	s, err := NewServer(&Config{
+		General: GeneralConfig{DrainCloseConnections: true},
+		Routes:  []Route{{Host: "old.example.com", Target: backend.URL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := serveAsync(s, "http://old.example.com/slow")
+	<-started
+
+	if err := s.Reload(&Config{Routes: []Route{{Host: "new.example.com", Target: backend.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	drains := s.drains.status()
+	if len(drains) != 1 || drains[0].Kind != "route" || drains[0].Inflight != 1 {
+		t.Fatalf("drains = %+v, want one route with 1 in-flight request", drains)
+	}
+
+	// The in-flight request completes normally and asks the client to close
+	close(release)
+	rec := <-result
+	if rec.Code != http.StatusOK || rec.Body.String() != "done" {
+		t.Errorf("in-flight request got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Connection") != "close" {
+		t.Error("draining response did not set Connection: close")
+	}
+
+	// The removed route no longer matches new requests
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "http://old.example.com/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("removed route still served a new request: %d", rec.Code)
+	}
+}
+
+func TestDrainDeadlineCancelsRequests(t *testing.T) {
+	backend, started, _ := blockingBackend(t)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	s, err := NewServer(&Config{
+		General: GeneralConfig{DrainTimeout: "50ms"},
+		Routes: []Route{{
+			Host:     "example.com",
+			Backends: []*Backend{{Name: "a", URLStr: backend.URL}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := serveAsync(s, "http://example.com/slow")
+	<-started
+
+	// Replace the backend: the route stays, the old backend drains
+	err = s.Reload(&Config{
+		General: GeneralConfig{DrainTimeout: "50ms"},
+		Routes: []Route{{
+			Host:     "example.com",
+			Backends: []*Backend{{Name: "b", URLStr: other.URL}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drains := s.drains.status()
+	if len(drains) != 1 || drains[0].Kind != "backend" {
+		t.Fatalf("drains = %+v, want one backend", drains)
+	}
+
+	select {
+	case rec := <-result:
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("cancelled request got %d, want 502", rec.Code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not cancelled at the drain deadline")
+	}
+
+	// The drain is removed once finished
+	deadline := time.Now().Add(time.Second)
+	for len(s.drains.status()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(s.drains.status()) > 0 {
+		t.Error("finished drain still reported")
+	}
+}
+
+func TestReloadKeepsUnchangedRoutes(t *testing.T) {
+	backend, started, release := blockingBackend(t)
+
+	config := func() *Config {
+		return &Config{Routes: []Route{{Host: "example.com", Target: backend.URL}}}
+	}
+
+	s, err := NewServer(config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := serveAsync(s, "http://example.com/slow")
+	<-started
+
+	if err := s.Reload(config()); err != nil {
+		t.Fatal(err)
+	}
+	if drains := s.drains.status(); len(drains) != 0 {
+		t.Errorf("unchanged route is draining: %+v", drains)
+	}
+
+	close(release)
+	if rec := <-result; rec.Code != http.StatusOK {
+		t.Errorf("request on unchanged route got %d", rec.Code)
+	}
+}
@@ -0,0 +1,374 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultDynamicWait is the blocking query wait time / retry interval
+	defaultDynamicWait = 5 * time.Minute
+
+	// dynamicRetryDelay is the delay before retrying after a store error
+	dynamicRetryDelay = 5 * time.Second
+)
+
+// RouteSource supplies routes from an external configuration store
+type RouteSource interface {
+	// Watch calls apply with the complete set of dynamic routes every time
+	// the store changes. It blocks until ctx is cancelled.
+	Watch(ctx context.Context, apply func([]Route) error) error
+}
+
+// NewRouteSource creates a route source for the configured dynamic backend
+func NewRouteSource(cfg DynamicConfig) (RouteSource, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("dynamic config address is required")
+	}
+
+	wait := defaultDynamicWait
+	if cfg.WaitTime != "" {
+		d, err := time.ParseDuration(cfg.WaitTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wait_time %q: %w", cfg.WaitTime, err)
+		}
+		wait = d
+	}
+
+	address := strings.TrimSuffix(cfg.Address, "/")
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	switch cfg.Backend {
+	case "consul":
+		return &ConsulSource{
+			address: address,
+			prefix:  strings.TrimPrefix(cfg.Prefix, "/"),
+			token:   cfg.Token,
+			wait:    wait,
+			client:  &http.Client{Timeout: wait + 30*time.Second},
+		}, nil
+	case "etcd":
+		return &EtcdSource{
+			address: address,
+			prefix:  cfg.Prefix,
+			token:   cfg.Token,
+			wait:    wait,
+			client:  &http.Client{},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dynamic backend: %s (supported: consul, etcd)", cfg.Backend)
+	}
+}
+
+// ConsulSource watches a Consul KV prefix using blocking queries
+type ConsulSource struct {
+	address string
+	prefix  string
+	token   string
+	wait    time.Duration
+	client  *http.Client
+}
+
+// Watch implements RouteSource
+func (c *ConsulSource) Watch(ctx context.Context, apply func([]Route) error) error {
+	var index uint64
+
+	for {
+		routes, newIndex, err := c.fetch(ctx, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Consul route watch error: %v", err)
+			if !sleepContext(ctx, dynamicRetryDelay) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		// Consul may reset the index (e.g., after a snapshot restore)
+		if newIndex < index {
+			index = 0
+			continue
+		}
+
+		if newIndex != index {
+			if err := apply(routes); err != nil {
+				log.Printf("Failed to apply routes from Consul: %v", err)
+			}
+			index = newIndex
+		}
+	}
+}
+
+// fetch performs a (blocking) recursive KV read of the prefix
+func (c *ConsulSource) fetch(ctx context.Context, index uint64) ([]Route, uint64, error) {
+	query := url.Values{}
+	query.Set("recurse", "true")
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int(c.wait.Seconds())))
+	}
+
+	reqURL := fmt.Sprintf("%s/v1/kv/%s?%s", c.address, c.prefix, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	// An empty prefix is reported as 404
+	if resp.StatusCode == http.StatusNotFound {
+		return []Route{}, newIndex, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, 0, fmt.Errorf("consul returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var pairs []struct {
+		Key   string `json:"Key"`
+		Value []byte `json:"Value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	entries := make(map[string][]byte, len(pairs))
+	for _, pair := range pairs {
+		entries[pair.Key] = pair.Value
+	}
+
+	return decodeRoutes(entries), newIndex, nil
+}
+
+// EtcdSource watches an etcd v3 key prefix through the JSON gRPC gateway
+type EtcdSource struct {
+	address string
+	prefix  string
+	token   string
+	wait    time.Duration
+	client  *http.Client
+}
+
+// Watch implements RouteSource
+func (e *EtcdSource) Watch(ctx context.Context, apply func([]Route) error) error {
+	for {
+		routes, revision, err := e.fetch(ctx)
+		if err == nil {
+			if err := apply(routes); err != nil {
+				log.Printf("Failed to apply routes from etcd: %v", err)
+			}
+
+			// Block until something under the prefix changes
+			err = e.waitForChange(ctx, revision)
+			if err == nil {
+				continue
+			}
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("etcd route watch error: %v", err)
+		if !sleepContext(ctx, dynamicRetryDelay) {
+			return ctx.Err()
+		}
+	}
+}
+
+// etcdKeyValue is a key/value pair as returned by the etcd JSON gateway
+type etcdKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// etcdHeader is the response header returned by the etcd JSON gateway
+type etcdHeader struct {
+	Revision string `json:"revision"`
+}
+
+// fetch reads all keys under the prefix and returns the store revision
+func (e *EtcdSource) fetch(ctx context.Context) ([]Route, int64, error) {
+	body := map[string]string{
+		"key":       base64.StdEncoding.EncodeToString([]byte(e.prefix)),
+		"range_end": base64.StdEncoding.EncodeToString(prefixRangeEnd(e.prefix)),
+	}
+
+	resp, err := e.post(ctx, "/v3/kv/range", body)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Header etcdHeader     `json:"header"`
+		Kvs    []etcdKeyValue `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	revision, _ := strconv.ParseInt(result.Header.Revision, 10, 64)
+
+	entries := make(map[string][]byte, len(result.Kvs))
+	for _, kv := range result.Kvs {
+		entries[string(kv.Key)] = kv.Value
+	}
+
+	return decodeRoutes(entries), revision, nil
+}
+
+// waitForChange opens a watch stream after revision and returns once an
+// event arrives, or with nil after the wait time elapses so the full key
+// set is periodically re-read
+func (e *EtcdSource) waitForChange(ctx context.Context, revision int64) error {
+	watchCtx, cancel := context.WithTimeout(ctx, e.wait)
+	defer cancel()
+
+	body := map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            base64.StdEncoding.EncodeToString([]byte(e.prefix)),
+			"range_end":      base64.StdEncoding.EncodeToString(prefixRangeEnd(e.prefix)),
+			"start_revision": strconv.FormatInt(revision+1, 10),
+		},
+	}
+
+	resp, err := e.post(watchCtx, "/v3/watch", body)
+	if err != nil {
+		if watchCtx.Err() != nil && ctx.Err() == nil {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The gateway streams one JSON object per watch response
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Result struct {
+				Events []json.RawMessage `json:"events"`
+			} `json:"result"`
+		}
+		if err := decoder.Decode(&msg); err != nil {
+			if watchCtx.Err() != nil && ctx.Err() == nil {
+				return nil
+			}
+			return fmt.Errorf("watch stream failed: %w", err)
+		}
+
+		if len(msg.Result.Events) > 0 {
+			return nil
+		}
+	}
+}
+
+// post sends a JSON request to the etcd gateway
+func (e *EtcdSource) post(ctx context.Context, path string, payload interface{}) (*http.Response, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.address+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.token != "" {
+		req.Header.Set("Authorization", e.token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("etcd returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return resp, nil
+}
+
+// decodeRoutes decodes one JSON route per key, ordered by key name.
+// Keys with an empty value (e.g., Consul "folders") are skipped, and
+// invalid entries are logged and ignored so one bad key cannot take
+// down every route.
+func decodeRoutes(entries map[string][]byte) []Route {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	routes := make([]Route, 0, len(keys))
+	for _, key := range keys {
+		value := bytes.TrimSpace(entries[key])
+		if len(value) == 0 {
+			continue
+		}
+
+		var route Route
+		if err := json.Unmarshal(value, &route); err != nil {
+			log.Printf("Ignoring invalid route at key %s: %v", key, err)
+			continue
+		}
+		routes = append(routes, route)
+	}
+
+	return routes
+}
+
+// prefixRangeEnd returns the etcd range end covering every key with prefix
+func prefixRangeEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// Prefix is all 0xff bytes (or empty): range to the end of the keyspace
+	return []byte{0}
+}
+
+// sleepContext sleeps for d, returning false if ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
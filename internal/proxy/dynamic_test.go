@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPrefixRangeEnd(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"ophid/routes/", "ophid/routes0"},
+		{"a", "b"},
+		{"a\xff", "b"},
+		{"", "\x00"},
+	}
+
+	for _, tt := range tests {
+		if got := string(prefixRangeEnd(tt.prefix)); got != tt.want {
+			t.Errorf("prefixRangeEnd(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeRoutes(t *testing.T) {
+	entries := map[string][]byte{
+		"routes/b":      []byte(`{"host":"b.example.com","target":"http://10.0.0.2"}`),
+		"routes/a":      []byte(`{"host":"a.example.com","target":"http://10.0.0.1"}`),
+		"routes/":       nil,
+		"routes/broken": []byte(`{not json`),
+	}
+
+	routes := decodeRoutes(entries)
+	if len(routes) != 2 {
+		t.Fatalf("decodeRoutes() returned %d routes, want 2", len(routes))
+	}
+
+	// Routes are ordered by key
+	if routes[0].Host != "a.example.com" || routes[1].Host != "b.example.com" {
+		t.Errorf("unexpected route order: %s, %s", routes[0].Host, routes[1].Host)
+	}
+}
+
+func TestConsulSource_Watch(t *testing.T) {
+	value, _ := json.Marshal(Route{Host: "api.example.com", Target: "http://10.0.1.10:8000"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/ophid/routes/" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			t.Errorf("missing consul token")
+		}
+
+		// Simulate a blocking query that never changes after the first read
+		if r.URL.Query().Get("index") != "" {
+			<-r.Context().Done()
+			return
+		}
+
+		w.Header().Set("X-Consul-Index", "42")
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"Key": "ophid/routes/api", "Value": value},
+		})
+	}))
+	defer server.Close()
+
+	source, err := NewRouteSource(DynamicConfig{
+		Backend: "consul",
+		Address: server.URL,
+		Prefix:  "/ophid/routes/",
+		Token:   "secret",
+	})
+	if err != nil {
+		t.Fatalf("NewRouteSource() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	applied := make(chan []Route, 1)
+	go source.Watch(ctx, func(routes []Route) error {
+		applied <- routes
+		return nil
+	})
+
+	select {
+	case routes := <-applied:
+		if len(routes) != 1 || routes[0].Host != "api.example.com" {
+			t.Errorf("applied routes = %+v", routes)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for routes")
+	}
+}
+
+func TestNewRouteSource_Invalid(t *testing.T) {
+	if _, err := NewRouteSource(DynamicConfig{Backend: "zookeeper", Address: "localhost:2181"}); err == nil {
+		t.Error("expected error for unsupported backend")
+	}
+	if _, err := NewRouteSource(DynamicConfig{Backend: "consul"}); err == nil {
+		t.Error("expected error for missing address")
+	}
+}
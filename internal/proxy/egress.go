@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gleicon/ophid/internal/httpclient"
+	"github.com/gleicon/ophid/internal/proxy/egress"
+	"github.com/gleicon/ophid/internal/proxy/logsink"
+)
+
+// NewEgressProxy creates the outbound proxy described by cfg
+func NewEgressProxy(cfg EgressConfig) (*egress.Proxy, error) {
+	opts := egress.Options{Allow: cfg.Allow, RootCAs: httpclient.RootCAs()}
+
+	if cfg.Log != "" {
+		sink, err := logsink.NewFileSink(expandHome(cfg.Log), 0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open egress log: %w", err)
+		}
+		opts.Logger = log.New(sink, "", log.LstdFlags)
+	}
+
+	if cfg.InterceptTLS {
+		if cfg.CACert == "" || cfg.CAKey == "" {
+			return nil, fmt.Errorf("egress intercept_tls requires ca_cert and ca_key")
+		}
+		interceptor, err := egress.NewInterceptor(expandHome(cfg.CACert), expandHome(cfg.CAKey))
+		if err != nil {
+			return nil, err
+		}
+		opts.Intercept = interceptor
+	}
+
+	return egress.New(opts), nil
+}
+
+// StartEgress starts the egress listeners in the background
+func StartEgress(p *egress.Proxy, cfg EgressConfig) error {
+	if cfg.Listen == "" && cfg.SOCKSListen == "" {
+		return fmt.Errorf("egress proxy needs listen and/or socks_listen")
+	}
+
+	if cfg.Listen != "" {
+		go func() {
+			if err := p.ListenAndServe(cfg.Listen); err != nil {
+				log.Printf("Egress HTTP proxy error: %v", err)
+			}
+		}()
+	}
+
+	if cfg.SOCKSListen != "" {
+		go func() {
+			if err := p.ListenAndServeSOCKS(cfg.SOCKSListen); err != nil {
+				log.Printf("Egress SOCKS5 proxy error: %v", err)
+			}
+		}()
+	}
+
+	return nil
+}
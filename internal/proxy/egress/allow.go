@@ -0,0 +1,67 @@
+package egress
+
+import (
+	"net"
+	"strings"
+)
+
+// Allowlist decides which destination hosts may be reached. An empty
+// allowlist permits everything.
+type Allowlist struct {
+	patterns []string
+	networks []*net.IPNet
+}
+
+// NewAllowlist creates an allowlist from host patterns: "example.com"
+// (exact), "*.example.com" (any subdomain), "*" (everything) or a CIDR such
+// as "10.0.0.0/8" (IP destinations in that network; host names are not
+// resolved)
+func NewAllowlist(patterns []string) *Allowlist {
+	a := &Allowlist{patterns: make([]string, 0, len(patterns))}
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(p); err == nil {
+			a.networks = append(a.networks, network)
+			continue
+		}
+		a.patterns = append(a.patterns, strings.TrimSuffix(p, "."))
+	}
+	return a
+}
+
+// Allowed reports whether a destination ("host" or "host:port") is permitted
+func (a *Allowlist) Allowed(dest string) bool {
+	if len(a.patterns) == 0 && len(a.networks) == 0 {
+		return true
+	}
+
+	host := dest
+	if h, _, err := net.SplitHostPort(dest); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range a.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	for _, pattern := range a.patterns {
+		switch {
+		case pattern == "*" || pattern == host:
+			return true
+		case strings.HasPrefix(pattern, "*."):
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
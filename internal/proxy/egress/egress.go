@@ -0,0 +1,319 @@
+package egress
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures the outbound proxy
+type Options struct {
+	Allow       []string       // Destination host patterns; empty allows everything
+	WarnOnly    bool           // Log destinations outside Allow instead of blocking them
+	Logger      *log.Logger    // Egress log (defaults to the standard logger)
+	Intercept   *Interceptor   // Optional TLS interception for CONNECT tunnels
+	RootCAs     *x509.CertPool // CAs upstream servers are verified with when forwarding; the system's if nil
+	DialTimeout time.Duration
+}
+
+// Proxy is a forward proxy (HTTP, CONNECT and SOCKS5) for outbound traffic
+// of managed tools, providing egress logging and domain allowlisting
+type Proxy struct {
+	allow     *Allowlist
+	warnOnly  bool
+	logger    *log.Logger
+	intercept *Interceptor
+	dialer    *net.Dialer
+	transport *http.Transport
+
+	servers   []*http.Server
+	listeners []net.Listener
+	mu        sync.Mutex
+}
+
+// New creates an outbound proxy
+func New(opts Options) *Proxy {
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	dialTimeout := opts.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = 30 * time.Second
+	}
+
+	p := &Proxy{
+		allow:     NewAllowlist(opts.Allow),
+		warnOnly:  opts.WarnOnly,
+		logger:    logger,
+		intercept: opts.Intercept,
+		dialer:    &net.Dialer{Timeout: dialTimeout},
+	}
+
+	p.transport = &http.Transport{
+		Proxy:               nil, // never chain through the environment's proxy
+		DialContext:         p.dialer.DialContext,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	if opts.RootCAs != nil {
+		p.transport.TLSClientConfig = &tls.Config{RootCAs: opts.RootCAs}
+	}
+
+	return p
+}
+
+// ListenAndServe serves HTTP forward proxy requests (including CONNECT)
+func (p *Proxy) ListenAndServe(addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           p,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	p.mu.Lock()
+	p.servers = append(p.servers, server)
+	p.mu.Unlock()
+
+	p.logger.Printf("Egress HTTP proxy listening on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Serve serves HTTP forward proxy requests on an existing listener
+func (p *Proxy) Serve(listener net.Listener) error {
+	server := &http.Server{
+		Handler:           p,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	p.mu.Lock()
+	p.servers = append(p.servers, server)
+	p.mu.Unlock()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops all listeners
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for _, server := range p.servers {
+		if err := server.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, l := range p.listeners {
+		l.Close()
+	}
+	p.transport.CloseIdleConnections()
+
+	return firstErr
+}
+
+// ServeHTTP implements http.Handler
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.handleConnect(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "This is a forward proxy; requests must use an absolute URL", http.StatusBadRequest)
+		return
+	}
+
+	p.forward(w, r, clientAddr(r.RemoteAddr))
+}
+
+// forward proxies a plain HTTP request (or an intercepted HTTPS request)
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, client string) {
+	start := time.Now()
+	host := r.URL.Host
+
+	if !p.permit(client, r.Method, r.URL.String(), host, start) {
+		http.Error(w, fmt.Sprintf("Egress to %s is not allowed", host), http.StatusForbidden)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	removeHopHeaders(out.Header)
+
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		p.logf(client, r.Method, r.URL.String(), "error: "+err.Error(), 0, 0, start)
+		http.Error(w, fmt.Sprintf("Bad Gateway: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for k, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	n, _ := io.Copy(w, resp.Body)
+
+	p.logf(client, r.Method, r.URL.String(), fmt.Sprintf("%d", resp.StatusCode), r.ContentLength, n, start)
+}
+
+// handleConnect tunnels (or intercepts) a CONNECT request
+func (p *Proxy) handleConnect(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	client := clientAddr(r.RemoteAddr)
+	dest := r.Host
+
+	if !p.permit(client, "CONNECT", dest, dest, start) {
+		http.Error(w, fmt.Sprintf("Egress to %s is not allowed", dest), http.StatusForbidden)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if p.intercept != nil {
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+		p.logf(client, "CONNECT", dest, "intercepted", 0, 0, start)
+		p.intercept.serve(conn, dest, func(w http.ResponseWriter, r *http.Request) {
+			p.forward(w, r, client)
+		})
+		return
+	}
+
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", dest)
+	if err != nil {
+		p.logf(client, "CONNECT", dest, "error: "+err.Error(), 0, 0, start)
+		http.Error(w, fmt.Sprintf("Bad Gateway: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	// Forward anything the client sent ahead of the tunnel being established
+	if n := buffered.Reader.Buffered(); n > 0 {
+		data, _ := buffered.Reader.Peek(n)
+		upstream.Write(data)
+	}
+
+	sent, received := tunnel(conn, upstream)
+	p.logf(client, "CONNECT", dest, "closed", sent, received, start)
+}
+
+// tunnel copies data both ways until either side closes. It returns the
+// bytes sent by the client and the bytes received from upstream.
+func tunnel(client, upstream net.Conn) (int64, int64) {
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		sent, _ = io.Copy(upstream, client)
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		} else {
+			upstream.Close()
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		received, _ = io.Copy(client, upstream)
+		client.Close()
+	}()
+
+	wg.Wait()
+	upstream.Close()
+	client.Close()
+
+	return sent, received
+}
+
+// permit checks a destination against the allowlist and logs what was
+// refused. In warn-only mode refused destinations are logged as
+// "not-allowed" and let through.
+func (p *Proxy) permit(client, method, target, dest string, start time.Time) bool {
+	if p.allow.Allowed(dest) {
+		return true
+	}
+	if p.warnOnly {
+		p.logf(client, method, target, "not-allowed", 0, 0, start)
+		return true
+	}
+	p.logf(client, method, target, "blocked", 0, 0, start)
+	return false
+}
+
+// logf writes one egress log line
+func (p *Proxy) logf(client, method, dest, result string, sent, received int64, start time.Time) {
+	if sent < 0 {
+		sent = 0
+	}
+	p.logger.Printf("egress client=%s method=%s dest=%s result=%q sent=%d received=%d duration=%s",
+		client, method, dest, result, sent, received, time.Since(start).Round(time.Millisecond))
+}
+
+// hopHeaders are removed when forwarding (RFC 7230 section 6.1)
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders strips hop-by-hop headers
+func removeHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			h.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// clientAddr strips the port from a remote address
+func clientAddr(remote string) string {
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
@@ -0,0 +1,115 @@
+package egress
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAllowlist(t *testing.T) {
+	allow := NewAllowlist([]string{"pypi.org", "*.pythonhosted.org"})
+
+	tests := []struct {
+		dest string
+		want bool
+	}{
+		{"pypi.org", true},
+		{"pypi.org:443", true},
+		{"PyPI.org.", true},
+		{"files.pythonhosted.org:443", true},
+		{"pythonhosted.org", false},
+		{"evil.com", false},
+		{"pypi.org.evil.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := allow.Allowed(tt.dest); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.dest, got, tt.want)
+		}
+	}
+
+	cidrs := NewAllowlist([]string{"10.0.0.0/8", "2001:db8::/32", "api.internal"})
+	for dest, want := range map[string]bool{
+		"10.1.2.3:443":      true,
+		"[2001:db8::1]:80":  true,
+		"11.0.0.1":          false,
+		"api.internal:8080": true,
+		"10.example.com":    false,
+	} {
+		if got := cidrs.Allowed(dest); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", dest, got, want)
+		}
+	}
+
+	if !NewAllowlist(nil).Allowed("anything.example") {
+		t.Errorf("empty allowlist should allow everything")
+	}
+}
+
+func TestForwardProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer backend.Close()
+
+	var logs strings.Builder
+	p := New(Options{Allow: []string{"127.0.0.1"}, Logger: log.New(&logs, "", 0)})
+	proxyServer := httptest.NewServer(p)
+	defer proxyServer.Close()
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatalf("GET via proxy failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("body = %q, want hello", body)
+	}
+
+	resp, err = client.Get("http://blocked.example/")
+	if err != nil {
+		t.Fatalf("GET via proxy failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("blocked status = %d, want 403", resp.StatusCode)
+	}
+
+	if !strings.Contains(logs.String(), "dest=http://blocked.example/ result=\"blocked\"") {
+		t.Errorf("expected blocked request in egress log, got:\n%s", logs.String())
+	}
+}
+
+func TestSOCKSHandshake(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		// Greeting (no auth) + CONNECT example.com:443
+		client.Write([]byte{0x05, 0x01, 0x00})
+		reply := make([]byte, 2)
+		io.ReadFull(client, reply)
+		req := []byte{0x05, 0x01, 0x00, 0x03, byte(len("example.com"))}
+		req = append(req, "example.com"...)
+		req = append(req, 0x01, 0xbb)
+		client.Write(req)
+	}()
+
+	dest, err := socksHandshake(bufio.NewReader(server), server)
+	if err != nil {
+		t.Fatalf("socksHandshake() error = %v", err)
+	}
+	if dest != "example.com:443" {
+		t.Errorf("dest = %q, want example.com:443", dest)
+	}
+}
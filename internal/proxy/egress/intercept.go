@@ -0,0 +1,107 @@
+package egress
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gleicon/ophid/internal/proxy/localca"
+)
+
+// Interceptor terminates TLS for CONNECT tunnels with certificates signed
+// by a local CA so individual HTTPS requests can be logged and filtered.
+// Clients must trust the CA (e.g., via SSL_CERT_FILE / REQUESTS_CA_BUNDLE).
+type Interceptor struct {
+	ca *localca.CA
+}
+
+// NewInterceptor loads the CA certificate and key (PEM) used for interception
+func NewInterceptor(caCertFile, caKeyFile string) (*Interceptor, error) {
+	ca, err := localca.Load(caCertFile, caKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("interception: %w", err)
+	}
+
+	return &Interceptor{ca: ca}, nil
+}
+
+// serve terminates TLS on conn and passes each decrypted request to handle
+// with its URL rewritten to https://dest
+func (ic *Interceptor) serve(conn net.Conn, dest string, handle http.HandlerFunc) {
+	host, _, err := net.SplitHostPort(dest)
+	if err != nil {
+		host = dest
+	}
+
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = host
+			}
+			return ic.ca.Certificate(name)
+		},
+		NextProtos: []string{"http/1.1"},
+	})
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Scheme = "https"
+			r.URL.Host = dest
+			handle(w, r)
+		}),
+		ReadHeaderTimeout: 30 * time.Second,
+		IdleTimeout:       90 * time.Second,
+	}
+
+	listener := newConnListener(tlsConn)
+	server.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateClosed || state == http.StateHijacked {
+			listener.Close()
+		}
+	}
+	server.Serve(listener)
+}
+
+// connListener is a net.Listener that yields a single connection
+type connListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+	addr  net.Addr
+}
+
+// newConnListener wraps conn so it can be served by an http.Server
+func newConnListener(conn net.Conn) *connListener {
+	l := &connListener{
+		conns: make(chan net.Conn, 1),
+		done:  make(chan struct{}),
+		addr:  conn.LocalAddr(),
+	}
+	l.conns <- conn
+	return l
+}
+
+// Accept returns the wrapped connection once, then blocks until Close
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close unblocks Accept
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr implements net.Listener
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,179 @@
+package egress
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// SOCKS5 protocol constants (RFC 1928)
+const (
+	socksVersion = 0x05
+
+	socksNoAuth       = 0x00
+	socksNoAcceptable = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksAddrIPv4   = 0x01
+	socksAddrDomain = 0x03
+	socksAddrIPv6   = 0x04
+
+	socksSucceeded        = 0x00
+	socksGeneralFailure   = 0x01
+	socksNotAllowed       = 0x02
+	socksHostUnreachable  = 0x04
+	socksCmdNotSupported  = 0x07
+	socksAddrNotSupported = 0x08
+)
+
+// ListenAndServeSOCKS serves SOCKS5 CONNECT requests (no authentication).
+// Only local listeners are expected, since SOCKS traffic is unauthenticated.
+func (p *Proxy) ListenAndServeSOCKS(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	p.mu.Lock()
+	p.listeners = append(p.listeners, listener)
+	p.mu.Unlock()
+
+	p.logger.Printf("Egress SOCKS5 proxy listening on %s", addr)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return nil
+		}
+		go p.serveSOCKS(conn)
+	}
+}
+
+// serveSOCKS handles one SOCKS5 client connection
+func (p *Proxy) serveSOCKS(conn net.Conn) {
+	start := time.Now()
+	client := clientAddr(conn.RemoteAddr().String())
+
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	dest, err := socksHandshake(reader, conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	if !p.permit(client, "SOCKS", dest, dest, start) {
+		socksReply(conn, socksNotAllowed)
+		conn.Close()
+		return
+	}
+
+	upstream, err := p.dialer.Dial("tcp", dest)
+	if err != nil {
+		p.logf(client, "SOCKS", dest, "error: "+err.Error(), 0, 0, start)
+		socksReply(conn, socksHostUnreachable)
+		conn.Close()
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+	socksReply(conn, socksSucceeded)
+
+	// Forward anything the client pipelined after the request
+	if n := reader.Buffered(); n > 0 {
+		data, _ := reader.Peek(n)
+		upstream.Write(data)
+	}
+
+	sent, received := tunnel(conn, upstream)
+	p.logf(client, "SOCKS", dest, "closed", sent, received, start)
+}
+
+// socksHandshake negotiates authentication and reads a CONNECT request,
+// returning the destination as host:port
+func socksHandshake(r *bufio.Reader, w io.Writer) (string, error) {
+	// Greeting: VER NMETHODS METHODS...
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return "", err
+	}
+
+	noAuth := false
+	for _, m := range methods {
+		if m == socksNoAuth {
+			noAuth = true
+		}
+	}
+	if !noAuth {
+		w.Write([]byte{socksVersion, socksNoAcceptable})
+		return "", fmt.Errorf("client does not support unauthenticated SOCKS")
+	}
+	if _, err := w.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return "", err
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(r, request); err != nil {
+		return "", err
+	}
+	if request[1] != socksCmdConnect {
+		socksReply(w, socksCmdNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		size := net.IPv4len
+		if request[3] == socksAddrIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socksAddrDomain:
+		length, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		domain := make([]byte, length)
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		socksReply(w, socksAddrNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS address type %d", request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socksReply sends a reply with an unspecified bound address
+func socksReply(w io.Writer, status byte) {
+	w.Write([]byte{socksVersion, status, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+}
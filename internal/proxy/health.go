@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gleicon/ophid/internal/events"
+)
+
+// Active health check defaults
+const (
+	defaultHealthInterval     = 10 * time.Second
+	defaultHealthTimeout      = 5 * time.Second
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+)
+
+// healthCheckTCP as the health check of a route connects to its backends
+// instead of sending them a request
+const healthCheckTCP = "tcp"
+
+// healthChecker probes a route's backends. A backend is marked unhealthy
+// after unhealthy failed checks in a row, and healthy again after healthy
+// passed checks in a row.
+type healthChecker struct {
+	path      *url.URL // Request path; nil for a TCP check
+	interval  time.Duration
+	timeout   time.Duration
+	healthy   int
+	unhealthy int
+
+	name     string // Route description for logs
+	backends []*Backend
+	client   *http.Client
+}
+
+// newHealthChecker creates the health checker of a route from its load
+// balancing config
+func newHealthChecker(route *Route, cfg LoadBalanceConfig) (*healthChecker, error) {
+	hc := &healthChecker{
+		healthy:   cfg.HealthyThreshold,
+		unhealthy: cfg.UnhealthyThreshold,
+		name:      describeRoute(route),
+		backends:  route.Backends,
+	}
+
+	if cfg.HealthCheck != healthCheckTCP {
+		if !strings.HasPrefix(cfg.HealthCheck, "/") {
+			return nil, fmt.Errorf("invalid health_check %q: must be a path or \"tcp\"", cfg.HealthCheck)
+		}
+		path, err := url.Parse(cfg.HealthCheck)
+		if err != nil {
+			return nil, fmt.Errorf("invalid health_check %q: %w", cfg.HealthCheck, err)
+		}
+		hc.path = path
+	}
+
+	if hc.healthy < 0 || hc.unhealthy < 0 {
+		return nil, fmt.Errorf("health check thresholds must be positive")
+	}
+	if hc.healthy == 0 {
+		hc.healthy = defaultHealthyThreshold
+	}
+	if hc.unhealthy == 0 {
+		hc.unhealthy = defaultUnhealthyThreshold
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+		def   time.Duration
+	}{
+		{"health_interval", cfg.HealthInterval, &hc.interval, defaultHealthInterval},
+		{"health_timeout", cfg.HealthTimeout, &hc.timeout, defaultHealthTimeout},
+	}
+	for _, dur := range durations {
+		*dur.dst = dur.def
+		if dur.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(dur.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", dur.name, dur.value, err)
+		}
+		if parsed <= 0 {
+			return nil, fmt.Errorf("invalid %s %q: must be positive", dur.name, dur.value)
+		}
+		*dur.dst = parsed
+	}
+
+	hc.client = &http.Client{
+		Timeout: hc.timeout,
+		// A redirect answers the check; following it could leave the backend
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return hc, nil
+}
+
+// run checks the backends right away, then every interval until ctx is done
+func (hc *healthChecker) run(ctx context.Context) {
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+
+	for {
+		hc.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll checks every backend concurrently and records the results
+func (hc *healthChecker) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, backend := range hc.backends {
+		if backend.URL == nil || backend.Health == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(backend *Backend) {
+			defer wg.Done()
+			err := hc.check(ctx, backend)
+			if ctx.Err() != nil {
+				return
+			}
+			status, changed := backend.Health.recordCheck(err == nil, hc.healthy, hc.unhealthy)
+			switch {
+			case changed && status == HealthStatusHealthy:
+				log.Printf("Health check: backend %s of route %s is healthy again", backend.URLStr, hc.name)
+				events.Emit(events.RouteHealth, backend.URLStr, "healthy", map[string]string{"route": hc.name, "status": "healthy"})
+			case changed:
+				log.Printf("Health check: backend %s of route %s is unhealthy: %v", backend.URLStr, hc.name, err)
+				events.Emit(events.RouteHealth, backend.URLStr, "unhealthy: "+err.Error(), map[string]string{"route": hc.name, "status": "unhealthy"})
+			}
+		}(backend)
+	}
+	wg.Wait()
+}
+
+// check probes one backend: a GET of the health check path that must
+// answer 2xx or 3xx, or a TCP connection
+func (hc *healthChecker) check(ctx context.Context, backend *Backend) error {
+	if hc.path == nil {
+		host := backend.URL.Host
+		if backend.URL.Port() == "" {
+			port := "80"
+			if backend.URL.Scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(backend.URL.Hostname(), port)
+		}
+		dialer := net.Dialer{Timeout: hc.timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", backend.URL.ResolveReference(hc.path).String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "ophid-health-check")
+	client := hc.client
+	if backend.transport != nil {
+		// Check https backends the way they are proxied to
+		withTLS := *client
+		withTLS.Transport = backend.transport
+		client = &withTLS
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordCheck counts an active health check result and flips the status
+// once enough checks in a row agree. It returns the status and whether it
+// changed.
+func (h *Health) recordCheck(passed bool, healthyAfter, unhealthyAfter int) (HealthStatus, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.LastCheck = now
+	if passed {
+		h.FailCount = 0
+		h.passCount++
+		if h.Status != HealthStatusHealthy && int(h.passCount) >= healthyAfter {
+			h.Status = HealthStatusHealthy
+			h.Since = now
+			return h.Status, true
+		}
+		return h.Status, false
+	}
+
+	h.passCount = 0
+	h.FailCount++
+	if h.Status != HealthStatusUnhealthy && int(h.FailCount) >= unhealthyAfter {
+		h.Status = HealthStatusUnhealthy
+		return h.Status, true
+	}
+	return h.Status, false
+}
+
+// healthChecks runs the health checkers of the routes being served
+type healthChecks struct {
+	ctx    context.Context    // Set by start; checks stop when it's done
+	cancel context.CancelFunc // Stops the checkers of the current routes
+	mu     sync.Mutex
+}
+
+// start runs the checkers of routes until ctx is done
+func (h *healthChecks) start(ctx context.Context, routes []*Route) {
+	h.mu.Lock()
+	h.ctx = ctx
+	h.mu.Unlock()
+	h.replace(routes)
+}
+
+// replace stops the running checkers and runs those of routes instead,
+// once started
+func (h *healthChecks) replace(routes []*Route) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.ctx == nil {
+		return
+	}
+	if h.cancel != nil {
+		h.cancel()
+	}
+	ctx, cancel := context.WithCancel(h.ctx)
+	h.cancel = cancel
+	for _, route := range routes {
+		if route.health != nil {
+			go route.health.run(ctx)
+		}
+	}
+}
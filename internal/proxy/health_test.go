@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	var down atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte("flaky"))
+	}))
+	defer flaky.Close()
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stable"))
+	}))
+	defer stable.Close()
+
+	s, err := NewServer(&Config{Routes: []Route{{
+		Host:     "app.example.com",
+		Backends: []*Backend{{URLStr: flaky.URL}, {URLStr: stable.URL}},
+		LoadBalance: LoadBalanceConfig{
+			HealthCheck:        "/health",
+			HealthInterval:     "10ms",
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 2,
+		},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.health.start(ctx, s.router.Load().GetRoutes())
+
+	flakyHealth := s.router.Load().GetRoutes()[0].Backends[0].Health
+	waitFor := func(want HealthStatus) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for flakyHealth.GetStatus() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("backend did not become %s", want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	down.Store(true)
+	waitFor(HealthStatusUnhealthy)
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", "http://app.example.com/", nil))
+		if rec.Body.String() != "stable" {
+			t.Fatalf("request went to %q, want the healthy backend", rec.Body.String())
+		}
+	}
+
+	down.Store(false)
+	waitFor(HealthStatusHealthy)
+
+	// A reload keeps the state, and a route without checks puts the backend back
+	down.Store(true)
+	waitFor(HealthStatusUnhealthy)
+	if err := s.Reload(&Config{Routes: []Route{{
+		Host:     "app.example.com",
+		Backends: []*Backend{{URLStr: flaky.URL}, {URLStr: stable.URL}},
+	}}}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(HealthStatusHealthy)
+}
+
+func TestHealthCheckTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	route := &Route{
+		Backends:    []*Backend{{URLStr: "http://" + addr}},
+		LoadBalance: LoadBalanceConfig{HealthCheck: "tcp", HealthTimeout: "1s"},
+	}
+	if err := prepareRoute(route); err != nil {
+		t.Fatal(err)
+	}
+	backend := route.Backends[0]
+
+	if err := route.health.check(context.Background(), backend); err != nil {
+		t.Errorf("check of a listening backend failed: %v", err)
+	}
+	listener.Close()
+	if err := route.health.check(context.Background(), backend); err == nil {
+		t.Error("check of a closed backend passed")
+	}
+}
+
+func TestHealthCheckConfig(t *testing.T) {
+	for _, lb := range []LoadBalanceConfig{
+		{HealthCheck: "health"},
+		{HealthCheck: "/health", HealthInterval: "soon"},
+		{HealthCheck: "/health", HealthTimeout: "0s"},
+		{HealthCheck: "/health", UnhealthyThreshold: -1},
+	} {
+		route := &Route{Backends: []*Backend{{URLStr: "http://127.0.0.1:1"}}, LoadBalance: lb}
+		if err := prepareRoute(route); err == nil {
+			t.Errorf("%+v: expected an error", lb)
+		}
+	}
+}
+
+func TestRecordCheck(t *testing.T) {
+	h := newHealth()
+	for i, want := range []struct {
+		passed  bool
+		status  HealthStatus
+		changed bool
+	}{
+		{false, HealthStatusHealthy, false},
+		{true, HealthStatusHealthy, false}, // A pass resets the failures
+		{false, HealthStatusHealthy, false},
+		{false, HealthStatusHealthy, false},
+		{false, HealthStatusUnhealthy, true},
+		{true, HealthStatusUnhealthy, false},
+		{true, HealthStatusHealthy, true},
+	} {
+		status, changed := h.recordCheck(want.passed, 2, 3)
+		if status != want.status || changed != want.changed {
+			t.Errorf("check %d: got %s (changed %v), want %s (changed %v)", i, status, changed, want.status, want.changed)
+		}
+	}
+}
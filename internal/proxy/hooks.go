@@ -0,0 +1,334 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+)
+
+const (
+	// defaultHookTimeout bounds the wall time of one hook phase
+	defaultHookTimeout = 10 * time.Millisecond
+
+	// defaultHookCostLimit bounds the CEL evaluation cost of one expression
+	defaultHookCostLimit = 10000
+)
+
+// routeHooks holds the compiled CEL programs for a route
+type routeHooks struct {
+	reject          cel.Program
+	rejectStatus    int
+	backend         cel.Program
+	requestHeaders  map[string]cel.Program
+	responseHeaders map[string]cel.Program
+	timeout         time.Duration
+}
+
+// hookEnv declares the variables visible to hook expressions
+func hookEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("response", cel.MapType(cel.StringType, cel.DynType)),
+		cel.OptionalTypes(),
+		ext.Strings(),
+	)
+}
+
+// compileHooks compiles a route's hook expressions
+func compileHooks(cfg *HooksConfig) (*routeHooks, error) {
+	env, err := hookEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+
+	costLimit := cfg.CostLimit
+	if costLimit == 0 {
+		costLimit = defaultHookCostLimit
+	}
+
+	compile := func(name, expr string) (cel.Program, error) {
+		ast, issues := env.Compile(expr)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("invalid %s expression: %w", name, issues.Err())
+		}
+		prg, err := env.Program(ast, cel.CostLimit(costLimit), cel.InterruptCheckFrequency(100))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s expression: %w", name, err)
+		}
+		return prg, nil
+	}
+
+	hooks := &routeHooks{
+		rejectStatus:    http.StatusForbidden,
+		requestHeaders:  make(map[string]cel.Program),
+		responseHeaders: make(map[string]cel.Program),
+		timeout:         defaultHookTimeout,
+	}
+
+	if cfg.Timeout != "" {
+		hooks.timeout, err = time.ParseDuration(cfg.Timeout)
+		if err != nil || hooks.timeout <= 0 {
+			return nil, fmt.Errorf("invalid hooks timeout %q", cfg.Timeout)
+		}
+	}
+
+	if cfg.RejectStatus != 0 {
+		if cfg.RejectStatus < 400 || cfg.RejectStatus > 599 {
+			return nil, fmt.Errorf("invalid reject_status %d", cfg.RejectStatus)
+		}
+		hooks.rejectStatus = cfg.RejectStatus
+	}
+
+	if cfg.Reject != "" {
+		if hooks.reject, err = compile("reject", cfg.Reject); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Backend != "" {
+		if hooks.backend, err = compile("backend", cfg.Backend); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, expr := range cfg.RequestHeaders {
+		if hooks.requestHeaders[name], err = compile("request header "+name, expr); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, expr := range cfg.ResponseHeaders {
+		if hooks.responseHeaders[name], err = compile("response header "+name, expr); err != nil {
+			return nil, err
+		}
+	}
+
+	return hooks, nil
+}
+
+// requestVars exposes a request to hook expressions
+func requestVars(r *http.Request) map[string]any {
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+
+	query := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		if len(values) > 0 {
+			query[name] = values[0]
+		}
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	clientIP, _, _ := extractClientIP(r)
+
+	return map[string]any{
+		"method":    r.Method,
+		"scheme":    scheme,
+		"host":      r.Host,
+		"path":      r.URL.Path,
+		"query":     query,
+		"headers":   headers,
+		"remote_ip": clientIP,
+	}
+}
+
+// wrap applies the hooks around a route handler: reject, compute request
+// headers and select a backend before proxying, then set response headers
+func (h *routeHooks) wrap(route *Route, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+		defer cancel()
+
+		vars := map[string]any{
+			"request":  requestVars(r),
+			"response": map[string]any{},
+		}
+
+		if h.reject != nil {
+			reject, err := evalBool(ctx, h.reject, vars)
+			if err != nil {
+				log.Printf("Hook error (reject) for %s%s: %v", r.Host, r.URL.Path, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if reject {
+				http.Error(w, http.StatusText(h.rejectStatus), h.rejectStatus)
+				return
+			}
+		}
+
+		for name, prg := range h.requestHeaders {
+			value, err := evalString(ctx, prg, vars)
+			if err != nil {
+				log.Printf("Hook error (request header %s) for %s%s: %v", name, r.Host, r.URL.Path, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if value == "" {
+				r.Header.Del(name)
+			} else {
+				r.Header.Set(name, value)
+			}
+		}
+
+		handler := next
+		if h.backend != nil {
+			target, err := evalString(ctx, h.backend, vars)
+			if err != nil {
+				log.Printf("Hook error (backend) for %s%s: %v", r.Host, r.URL.Path, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if target != "" {
+				override, err := routeWithBackend(route, target)
+				if err != nil {
+					log.Printf("Hook error (backend) for %s%s: %v", r.Host, r.URL.Path, err)
+					http.Error(w, "Bad Gateway", http.StatusBadGateway)
+					return
+				}
+				handler = NewHTTPProxy(override)
+			}
+		}
+
+		if len(h.responseHeaders) > 0 {
+			w = &hookResponseWriter{ResponseWriter: w, hooks: h, request: vars["request"]}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// routeWithBackend returns a copy of route proxying to target, which is
+// either the name of one of the route's backends or an absolute URL
+func routeWithBackend(route *Route, target string) (*Route, error) {
+	override := *route
+	override.Backends = nil
+	override.hooks = nil
+	override.outliers = nil
+
+	for _, backend := range route.Backends {
+		if backend.Name == target {
+			override.Target = backend.URLStr
+			if backend.transport != nil {
+				override.transport = backend.transport
+			}
+			return &override, nil
+		}
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("backend %q is neither a backend name nor an absolute URL", target)
+	}
+	override.Target = target
+	return &override, nil
+}
+
+// hookResponseWriter evaluates response header hooks before the status
+// line is written
+type hookResponseWriter struct {
+	http.ResponseWriter
+	hooks       *routeHooks
+	request     any
+	wroteHeader bool
+}
+
+// WriteHeader sets computed response headers, then writes the status
+func (hw *hookResponseWriter) WriteHeader(status int) {
+	if !hw.wroteHeader {
+		hw.wroteHeader = true
+		hw.applyHeaders(status)
+	}
+	hw.ResponseWriter.WriteHeader(status)
+}
+
+// Write ensures headers are computed for implicit 200 responses
+func (hw *hookResponseWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+// Flush supports streaming responses
+func (hw *hookResponseWriter) Flush() {
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (hw *hookResponseWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+// applyHeaders evaluates the response header hooks
+func (hw *hookResponseWriter) applyHeaders(status int) {
+	ctx, cancel := context.WithTimeout(context.Background(), hw.hooks.timeout)
+	defer cancel()
+
+	headers := make(map[string]string)
+	for name, values := range hw.Header() {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+
+	vars := map[string]any{
+		"request": hw.request,
+		"response": map[string]any{
+			"status":  status,
+			"headers": headers,
+		},
+	}
+
+	for name, prg := range hw.hooks.responseHeaders {
+		value, err := evalString(ctx, prg, vars)
+		if err != nil {
+			log.Printf("Hook error (response header %s): %v", name, err)
+			continue
+		}
+		if value == "" {
+			hw.Header().Del(name)
+		} else {
+			hw.Header().Set(name, value)
+		}
+	}
+}
+
+// evalBool evaluates an expression that must yield a bool
+func evalBool(ctx context.Context, prg cel.Program, vars map[string]any) (bool, error) {
+	out, _, err := prg.ContextEval(ctx, vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s, want bool", out.Type())
+	}
+	return b, nil
+}
+
+// evalString evaluates an expression that must yield a string
+func evalString(ctx context.Context, prg cel.Program, vars map[string]any) (string, error) {
+	out, _, err := prg.ContextEval(ctx, vars)
+	if err != nil {
+		return "", err
+	}
+	s, ok := out.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("expression returned %s, want string", out.Type())
+	}
+	return s, nil
+}
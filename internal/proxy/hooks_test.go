@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteHooks(t *testing.T) {
+	var gotTenant, gotBackend string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTenant = r.Header.Get("X-Tenant")
+		gotBackend = "canary"
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer backend.Close()
+
+	route := &Route{
+		Path:   "/*",
+		Target: "http://127.0.0.1:1", // default backend is unreachable
+		Backends: []*Backend{
+			{Name: "canary", URLStr: backend.URL},
+		},
+		Hooks: &HooksConfig{
+			Reject:  `request.path.startsWith("/admin") && request.remote_ip != "10.0.0.1"`,
+			Backend: `request.headers[?"x-canary"].orValue("") == "1" ? "canary" : ""`,
+			RequestHeaders: map[string]string{
+				"X-Tenant": `request.host.split(".")[0]`,
+			},
+			ResponseHeaders: map[string]string{
+				"X-Upstream-Status": `string(response.status)`,
+			},
+		},
+	}
+	if err := prepareRoute(route); err != nil {
+		t.Fatalf("prepareRoute() error = %v", err)
+	}
+
+	router := NewRouter()
+	router.AddRoute(route)
+
+	// Rejected by expression
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "http://acme.example.com/admin/users", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("reject status = %d, want 403", rec.Code)
+	}
+
+	// Routed to the canary backend with computed headers
+	req := httptest.NewRequest("GET", "http://acme.example.com/api", nil)
+	req.Header.Set("X-Canary", "1")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated || gotBackend != "canary" {
+		t.Fatalf("expected canary backend, got status %d", rec.Code)
+	}
+	if gotTenant != "acme" {
+		t.Errorf("X-Tenant = %q, want acme", gotTenant)
+	}
+	if got := rec.Header().Get("X-Upstream-Status"); got != "201" {
+		t.Errorf("X-Upstream-Status = %q, want 201", got)
+	}
+}
+
+func TestCompileHooksErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  HooksConfig
+	}{
+		{"syntax error", HooksConfig{Reject: `request.path ==`}},
+		{"unknown variable", HooksConfig{Reject: `req.path == "/"`}},
+		{"bad timeout", HooksConfig{Timeout: "soon"}},
+		{"bad reject status", HooksConfig{RejectStatus: 200}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileHooks(&tt.cfg); err == nil {
+				t.Errorf("compileHooks() expected error")
+			}
+		})
+	}
+}
+
+func TestHookCostLimit(t *testing.T) {
+	hooks, err := compileHooks(&HooksConfig{
+		Reject:    `[1,2,3,4,5,6,7,8,9,10].all(x, [1,2,3,4,5,6,7,8,9,10].all(y, [1,2,3,4,5,6,7,8,9,10].all(z, x + y + z > 0)))`,
+		CostLimit: 100,
+	})
+	if err != nil {
+		t.Fatalf("compileHooks() error = %v", err)
+	}
+
+	handler := hooks.wrap(&Route{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500 when the cost limit is exceeded", rec.Code)
+	}
+}
@@ -15,6 +15,7 @@ type HTTPProxy struct {
 	route        *Route
 	loadBalancer *LoadBalancer
 	transport    *http.Transport
+	sni          sniTransports // Per client host, for preserve_host and preserve_sni
 }
 
 // NewHTTPProxy creates a new HTTP proxy for a route
@@ -27,6 +28,8 @@ func NewHTTPProxy(route *Route) *HTTPProxy {
 			strategy = route.LoadBalance.Strategy
 		}
 		lb = NewLoadBalancer(strategy, route.Backends)
+		lb.outliers = route.outliers
+		lb.slowStart = route.slowStart
 	} else if route.Target != "" {
 		// Single backend - create a simple load balancer with one backend
 		targetURL, err := url.Parse(route.Target)
@@ -40,19 +43,16 @@ func NewHTTPProxy(route *Route) *HTTPProxy {
 			URL:    targetURL,
 			URLStr: route.Target,
 			Weight: 1,
-			Health: &Health{
-				Status: HealthStatusHealthy,
-			},
+			Health: newHealth(),
 		}
 		lb = NewLoadBalancer(StrategyRoundRobin, []*Backend{backend})
 	}
 
-	// Create transport with connection pooling
-	transport := &http.Transport{
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
-		IdleConnTimeout:     90 * time.Second,
-		DisableCompression:  false,
+	// Create transport with connection pooling; https backends are verified
+	// with the route's backend_tls, or else the configured CAs
+	transport := route.transport
+	if transport == nil {
+		transport = newBackendTransport(nil)
 	}
 
 	return &HTTPProxy{
@@ -75,14 +75,40 @@ func (hp *HTTPProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	backend.Health.IncrementConnections()
 	defer backend.Health.DecrementConnections()
 
+	// Backends with TLS options of their own have their own transport
+	transport := hp.transport
+	if backend.transport != nil {
+		transport = backend.transport
+	}
+	if hp.route.PreserveHost && hp.route.PreserveSNI && backend.URL.Scheme == "https" {
+		transport = hp.sni.get(transport, req.Host)
+	}
+
 	// Create reverse proxy
 	proxy := &httputil.ReverseProxy{
 		Director:     hp.createDirector(backend, req),
-		Transport:    hp.transport,
+		Transport:    transport,
 		ErrorHandler: hp.errorHandler,
 	}
 
-	// Proxy the request
+	// Feed response status and latency (to headers) to outlier detection
+	if outliers := hp.loadBalancer.outliers; outliers != nil {
+		start := time.Now()
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			outliers.record(backend, resp.StatusCode, time.Since(start))
+			return nil
+		}
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			outliers.record(backend, 0, time.Since(start))
+			hp.errorHandler(w, r, err)
+		}
+	}
+
+	// Proxy the request, tracking it for backend draining
+	if backend.drain != nil {
+		backend.drain.serve(w, req, proxy)
+		return
+	}
 	proxy.ServeHTTP(w, req)
 }
 
@@ -92,7 +118,7 @@ func (hp *HTTPProxy) createDirector(backend *Backend, originalReq *http.Request)
 		// Set target URL
 		r.URL.Scheme = backend.URL.Scheme
 		r.URL.Host = backend.URL.Host
-		r.Host = backend.URL.Host
+		r.Host = hp.route.upstreamHost(originalReq, backend)
 
 		// Combine backend path with request path
 		if backend.URL.Path != "" {
@@ -114,20 +140,7 @@ func (hp *HTTPProxy) createDirector(backend *Backend, originalReq *http.Request)
 		}
 
 		// Add standard proxy headers
-		if clientIP, _, err := extractClientIP(originalReq); err == nil {
-			r.Header.Set("X-Forwarded-For", clientIP)
-		}
-
-		r.Header.Set("X-Forwarded-Proto", originalReq.URL.Scheme)
-		if originalReq.URL.Scheme == "" {
-			if originalReq.TLS != nil {
-				r.Header.Set("X-Forwarded-Proto", "https")
-			} else {
-				r.Header.Set("X-Forwarded-Proto", "http")
-			}
-		}
-
-		r.Header.Set("X-Forwarded-Host", originalReq.Host)
+		setForwardedHeaders(r, originalReq, hp.route.XForwarded)
 	}
 }
 
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/httpclient"
+)
+
+func TestHTTPProxyBackendCAs(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	route := &Route{Host: "app.example.com", Target: backend.URL}
+
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		NewHTTPProxy(route).ServeHTTP(rec, httptest.NewRequest("GET", "http://app.example.com/", nil))
+		return rec.Code
+	}
+	if code := serve(); code != http.StatusBadGateway {
+		t.Fatalf("a backend with an unknown CA got %d, want 502", code)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw})
+	if err := os.WriteFile(caFile, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := httpclient.Configure(httpclient.Options{CAFiles: []string{caFile}}); err != nil {
+		t.Fatal(err)
+	}
+	defer httpclient.Configure(httpclient.Options{})
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("with the backend's CA configured got %d, want 200", code)
+	}
+}
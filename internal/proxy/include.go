@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// LoadConfigEnv loads a proxy configuration like LoadConfig and, when env is
+// set, merges the environment overlay next to it (proxy.toml + "prod" reads
+// proxy.prod.toml)
+func LoadConfigEnv(path, env string) (*Config, error) {
+	merged, err := loadConfigTree(path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if env != "" {
+		overlay, err := loadConfigTree(OverlayPath(path, env), nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s overlay: %w", env, err)
+		}
+		mergeTables(merged, overlay)
+	}
+
+	data, err := toml.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge config %s: %w", path, err)
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ConfigDirs returns the directories a configuration is read from: those
+// of its file, its env overlay and the files and patterns they include.
+// Files that can't be read are skipped, so a broken configuration can be
+// watched until it is fixed.
+func ConfigDirs(path, env string) []string {
+	dirs := make(map[string]bool)
+	loadConfigTree(path, nil, dirs)
+	if env != "" {
+		loadConfigTree(OverlayPath(path, env), nil, dirs)
+	}
+	list := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		list = append(list, dir)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// OverlayPath returns the overlay file of an environment for a config file
+func OverlayPath(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// loadConfigTree reads a config file and merges the files it includes, in
+// lexical order of each pattern's matches. Patterns are relative to the
+// including file. stack holds the files being loaded, to detect cycles;
+// dirs, when not nil, collects the directories files are read from.
+func loadConfigTree(path string, stack []string, dirs map[string]bool) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if dirs != nil {
+		dirs[filepath.Dir(abs)] = true
+	}
+	for _, p := range stack {
+		if p == abs {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+		}
+	}
+	stack = append(stack, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	table := make(map[string]interface{})
+	if err := toml.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	includes, err := includePatterns(table["include"])
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	delete(table, "include")
+
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), expandHome(pattern))
+		}
+
+		if dirs != nil {
+			if dir, err := filepath.Abs(filepath.Dir(pattern)); err == nil {
+				dirs[dir] = true
+			}
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: invalid include %q: %w", path, pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("config %s: included file %s does not exist", path, pattern)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			included, err := loadConfigTree(match, stack, dirs)
+			if err != nil {
+				return nil, err
+			}
+			mergeTables(table, included)
+		}
+	}
+
+	return table, nil
+}
+
+// includePatterns reads the include key of a config file
+func includePatterns(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		patterns := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("include must be a list of file patterns")
+			}
+			patterns = append(patterns, s)
+		}
+		return patterns, nil
+	}
+	return nil, fmt.Errorf("include must be a list of file patterns")
+}
+
+// mergeTables merges src into dst: tables are merged recursively, other
+// values (including arrays) are replaced, and routes are merged by their
+// match criteria (see mergeRoutes)
+func mergeTables(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if key == "routes" {
+			dst[key] = mergeRoutes(dst[key], value)
+			continue
+		}
+
+		if srcTable, ok := value.(map[string]interface{}); ok {
+			if dstTable, ok := dst[key].(map[string]interface{}); ok {
+				mergeTables(dstTable, srcTable)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// mergeRoutes adds the routes of src to dst. A route with the same match
+// criteria as an earlier one is merged into it; other routes are appended.
+func mergeRoutes(dst, src interface{}) interface{} {
+	dstRoutes, _ := dst.([]interface{})
+	srcRoutes, ok := src.([]interface{})
+	if !ok {
+		return src
+	}
+
+	index := make(map[string]int, len(dstRoutes))
+	for i, route := range dstRoutes {
+		if table, ok := route.(map[string]interface{}); ok {
+			index[routeTableKey(table)] = i
+		}
+	}
+
+	merged := append([]interface{}(nil), dstRoutes...)
+	for _, route := range srcRoutes {
+		table, ok := route.(map[string]interface{})
+		if !ok {
+			merged = append(merged, route)
+			continue
+		}
+
+		key := routeTableKey(table)
+		if i, ok := index[key]; ok {
+			if existing, ok := merged[i].(map[string]interface{}); ok {
+				mergeTables(existing, table)
+				continue
+			}
+		}
+		index[key] = len(merged)
+		merged = append(merged, table)
+	}
+	return merged
+}
+
+// routeTableKey identifies a route table by its match criteria
+func routeTableKey(table map[string]interface{}) string {
+	var route Route
+	if data, err := toml.Marshal(table); err == nil {
+		toml.Unmarshal(data, &route)
+	}
+
+	// fmt prints maps with sorted keys
+	return fmt.Sprint(describeRoute(&route), route.MatchHeaders, route.MatchQuery, route.MatchCookies, route.GeoIP.Countries)
+}
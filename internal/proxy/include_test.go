@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadConfigIncludesAndOverlay(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"proxy.toml": `
+include = ["routes.d/*.toml"]
+
+[general]
+listen = [":8080"]
+access_log_format = "text"
+
+[[routes]]
+host = "app.example.com"
+target = "http://localhost:3000"
+`,
+		"routes.d/20-billing.toml": `
+[[routes]]
+host = "billing.example.com"
+target = "http://localhost:4000"
+`,
+		"routes.d/10-api.toml": `
+[[routes]]
+host = "api.example.com"
+path = "/v1/*"
+target = "http://localhost:5000"
+strip_prefix = "/v1"
+`,
+		"proxy.prod.toml": `
+[general]
+access_log_format = "json"
+
+# Same match criteria: merged into the base route
+[[routes]]
+host = "api.example.com"
+path = "/v1/*"
+target = "http://10.0.0.5:5000"
+
+[[routes]]
+host = "status.example.com"
+target = "http://localhost:6000"
+`,
+	})
+	path := filepath.Join(dir, "proxy.toml")
+
+	base, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Base routes first, then includes in lexical order
+	var hosts []string
+	for _, route := range base.Routes {
+		hosts = append(hosts, route.Host)
+	}
+	if got := strings.Join(hosts, ","); got != "app.example.com,api.example.com,billing.example.com" {
+		t.Errorf("routes = %s", got)
+	}
+	if len(base.Include) != 0 {
+		t.Errorf("Include = %v, want resolved", base.Include)
+	}
+
+	prod, err := LoadConfigEnv(path, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.General.AccessLogFormat != "json" || len(prod.General.Listen) != 1 {
+		t.Errorf("general = %+v, want overlay format and base listen", prod.General)
+	}
+	if len(prod.Routes) != 4 {
+		t.Fatalf("prod routes = %d, want 4", len(prod.Routes))
+	}
+	api := prod.Routes[1]
+	if api.Target != "http://10.0.0.5:5000" || api.StripPrefix != "/v1" {
+		t.Errorf("overlaid route = %+v, want prod target and base strip_prefix", api)
+	}
+	if prod.Routes[3].Host != "status.example.com" {
+		t.Errorf("overlay route not appended: %+v", prod.Routes[3])
+	}
+
+	if _, err := LoadConfigEnv(path, "stage"); err == nil {
+		t.Error("missing overlay should be an error")
+	}
+}
+
+func TestLoadConfigIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			"cycle",
+			map[string]string{
+				"proxy.toml": `include = ["a.toml"]`,
+				"a.toml":     `include = ["proxy.toml"]`,
+			},
+			"include cycle",
+		},
+		{
+			"missing file",
+			map[string]string{"proxy.toml": `include = ["extra.toml"]`},
+			"does not exist",
+		},
+		{
+			"invalid include",
+			map[string]string{"proxy.toml": `include = 5`},
+			"list of file patterns",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfigFiles(t, tt.files)
+			_, err := LoadConfig(filepath.Join(dir, "proxy.toml"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// A pattern without matches is fine (e.g., an empty routes.d)
+	dir := writeConfigFiles(t, map[string]string{"proxy.toml": `include = ["routes.d/*.toml"]`})
+	if _, err := LoadConfig(filepath.Join(dir, "proxy.toml")); err != nil {
+		t.Errorf("LoadConfig() with empty glob: %v", err)
+	}
+}
@@ -2,17 +2,25 @@ package proxy
 
 import (
 	"hash/fnv"
+	"math/rand/v2"
 	"net/http"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// slowStartMinShare is the traffic share (relative to its weight) a backend
+// gets at the start of its slow start window
+const slowStartMinShare = 0.1
+
 // LoadBalancer handles backend selection
 type LoadBalancer struct {
-	backends []*Backend
-	strategy LoadBalanceStrategy
-	current  atomic.Int32
-	mu       sync.RWMutex
+	backends  []*Backend
+	strategy  LoadBalanceStrategy
+	outliers  *outlierDetector // Optional; ejected backends are skipped
+	slowStart time.Duration    // Ramp-up window for new/recovered backends
+	current   atomic.Int32
+	mu        sync.RWMutex
 }
 
 // NewLoadBalancer creates a new load balancer
@@ -20,9 +28,7 @@ func NewLoadBalancer(strategy LoadBalanceStrategy, backends []*Backend) *LoadBal
 	// Initialize health for all backends
 	for _, backend := range backends {
 		if backend.Health == nil {
-			backend.Health = &Health{
-				Status: HealthStatusHealthy,
-			}
+			backend.Health = newHealth()
 		}
 	}
 
@@ -40,9 +46,7 @@ func (lb *LoadBalancer) AddBackend(backend *Backend) {
 	defer lb.mu.Unlock()
 
 	if backend.Health == nil {
-		backend.Health = &Health{
-			Status: HealthStatusHealthy,
-		}
+		backend.Health = newHealth()
 	}
 
 	lb.backends = append(lb.backends, backend)
@@ -79,6 +83,13 @@ func (lb *LoadBalancer) SelectBackend(req *http.Request) *Backend {
 		return nil
 	}
 
+	// Ramp traffic up for backends that joined or recovered recently
+	if lb.slowStart > 0 && lb.strategy != StrategyIPHash {
+		if backend := lb.slowStartSelect(healthy, time.Now()); backend != nil {
+			return backend
+		}
+	}
+
 	// Select based on strategy
 	switch lb.strategy {
 	case StrategyRoundRobin:
@@ -183,7 +194,58 @@ func (lb *LoadBalancer) weighted(backends []*Backend) *Backend {
 	return backends[0]
 }
 
-// healthyBackends returns only healthy backends
+// slowStartSelect picks a backend at random, scaling the weight of backends
+// still in their slow start window by how far into it they are. It returns
+// nil when no backend is warming up, so the configured strategy applies.
+func (lb *LoadBalancer) slowStartSelect(backends []*Backend, now time.Time) *Backend {
+	weights := make([]float64, len(backends))
+	total := 0.0
+	warming := false
+
+	for i, backend := range backends {
+		weight := float64(backend.Weight)
+		if weight <= 0 {
+			weight = 1
+		}
+		if share := slowStartShare(backend.Health.AvailableSince(), now, lb.slowStart); share < 1 {
+			weight *= share
+			warming = true
+		}
+		weights[i] = weight
+		total += weight
+	}
+
+	if !warming || len(backends) < 2 {
+		return nil
+	}
+
+	pick := rand.Float64() * total
+	for i, weight := range weights {
+		pick -= weight
+		if pick < 0 {
+			return backends[i]
+		}
+	}
+	return backends[len(backends)-1]
+}
+
+// slowStartShare returns the fraction (slowStartMinShare to 1) of its
+// normal traffic a backend available since the given time should receive
+func slowStartShare(since, now time.Time, window time.Duration) float64 {
+	elapsed := now.Sub(since)
+	if since.IsZero() || elapsed >= window {
+		return 1
+	}
+
+	share := float64(elapsed) / float64(window)
+	if share < slowStartMinShare {
+		share = slowStartMinShare
+	}
+	return share
+}
+
+// healthyBackends returns only healthy backends, skipping ejected outliers
+// unless every healthy backend is ejected
 func (lb *LoadBalancer) healthyBackends() []*Backend {
 	lb.mu.RLock()
 	defer lb.mu.RUnlock()
@@ -195,5 +257,19 @@ func (lb *LoadBalancer) healthyBackends() []*Backend {
 		}
 	}
 
-	return healthy
+	if lb.outliers == nil {
+		return healthy
+	}
+
+	available := make([]*Backend, 0, len(healthy))
+	for _, backend := range healthy {
+		if !lb.outliers.ejected(backend) {
+			available = append(available, backend)
+		}
+	}
+	if len(available) == 0 {
+		return healthy
+	}
+
+	return available
 }
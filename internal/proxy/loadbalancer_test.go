@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSlowStartShare(t *testing.T) {
+	now := time.Now()
+	window := 100 * time.Second
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  float64
+	}{
+		{"unknown", time.Time{}, 1},
+		{"just joined", now, slowStartMinShare},
+		{"halfway", now.Add(-50 * time.Second), 0.5},
+		{"warmed up", now.Add(-200 * time.Second), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slowStartShare(tt.since, now, window); got != tt.want {
+				t.Errorf("slowStartShare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlowStartSelect(t *testing.T) {
+	old := &Backend{Name: "old", Health: &Health{Status: HealthStatusHealthy, Since: time.Now().Add(-time.Hour)}}
+	fresh := &Backend{Name: "fresh", Health: newHealth()}
+
+	lb := NewLoadBalancer(StrategyRoundRobin, []*Backend{old, fresh})
+	lb.slowStart = time.Minute
+
+	picks := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		picks[lb.SelectBackend(httptest.NewRequest("GET", "/", nil)).Name]++
+	}
+
+	// A backend at the start of its window gets ~10% of its normal share
+	if share := float64(picks["fresh"]) / 2000; share < 0.03 || share > 0.2 {
+		t.Errorf("fresh backend got %.0f%% of traffic, want ~9%%", share*100)
+	}
+
+	// Once warmed up, the configured strategy applies again
+	fresh.Health.Since = time.Now().Add(-time.Hour)
+	if lb.slowStartSelect(lb.GetBackends(), time.Now()) != nil {
+		t.Error("slowStartSelect should defer to the strategy when no backend is warming")
+	}
+}
+
+func TestHealthRecoveryRestartsSlowStart(t *testing.T) {
+	h := &Health{Status: HealthStatusHealthy, Since: time.Now().Add(-time.Hour)}
+
+	h.SetStatus(HealthStatusUnhealthy)
+	h.SetStatus(HealthStatusHealthy)
+
+	if time.Since(h.AvailableSince()) > time.Second {
+		t.Error("recovering backend did not restart its slow start window")
+	}
+
+	since := h.AvailableSince()
+	h.SetStatus(HealthStatusHealthy)
+	if !h.AvailableSince().Equal(since) {
+		t.Error("staying healthy should not restart the slow start window")
+	}
+}
+
+func TestCarryBackendHealth(t *testing.T) {
+	kept := &Backend{URLStr: "http://10.0.0.1:8000", Health: &Health{Status: HealthStatusHealthy, Since: time.Now().Add(-time.Hour)}}
+	oldRoutes := []*Route{{Host: "example.com", Backends: []*Backend{kept}}}
+
+	newRoutes := []Route{
+		{Host: "example.com", Backends: []*Backend{{URLStr: "http://10.0.0.1:8000"}, {URLStr: "http://10.0.0.2:8000"}}},
+		{Host: "other.com", Backends: []*Backend{{URLStr: "http://10.0.0.1:8000"}}},
+	}
+	carryBackendHealth(oldRoutes, newRoutes)
+
+	if newRoutes[0].Backends[0].Health != kept.Health {
+		t.Error("backend kept on the same route lost its health state")
+	}
+	if newRoutes[0].Backends[1].Health != nil {
+		t.Error("new backend inherited health state")
+	}
+	if newRoutes[1].Backends[0].Health != nil {
+		t.Error("backend on a different route inherited health state")
+	}
+}
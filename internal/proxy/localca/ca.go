@@ -0,0 +1,244 @@
+package localca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CertFile and KeyFile are the root CA file names inside the CA directory
+	CertFile = "rootCA.pem"
+	KeyFile  = "rootCA-key.pem"
+
+	rootValidity = 10 * 365 * 24 * time.Hour
+	leafValidity = 30 * 24 * time.Hour
+)
+
+// DefaultDomains are served when no domains are configured
+var DefaultDomains = []string{"localhost", "*.localhost"}
+
+// CA is a local certificate authority that mints leaf certificates on
+// demand, for development HTTPS and TLS interception
+type CA struct {
+	Cert     *x509.Certificate
+	CertPath string
+
+	key     crypto.Signer
+	leafKey *ecdsa.PrivateKey
+	cache   map[string]*tls.Certificate
+	mu      sync.Mutex
+}
+
+// LoadOrCreate loads the root CA from dir, generating it on first use
+func LoadOrCreate(dir string) (*CA, error) {
+	certPath := filepath.Join(dir, CertFile)
+	keyPath := filepath.Join(dir, KeyFile)
+
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		if err := create(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return Load(certPath, keyPath)
+}
+
+// Load loads an existing CA certificate and key (PEM)
+func Load(certPath, keyPath string) (*CA, error) {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", certPath)
+	}
+
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type")
+	}
+
+	// One key for all leaves keeps minting cheap
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate leaf key: %w", err)
+	}
+
+	return &CA{
+		Cert:     cert,
+		CertPath: certPath,
+		key:      signer,
+		leafKey:  leafKey,
+		cache:    make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// create generates a new root CA in dir
+func create(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create CA directory: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	name := "ophid local development CA"
+	if u, err := user.Current(); err == nil {
+		hostname, _ := os.Hostname()
+		name = fmt.Sprintf("%s (%s@%s)", name, u.Username, hostname)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"ophid development CA"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(rootValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode CA key: %w", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, KeyFile), keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write CA key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, CertFile), certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+
+	return nil
+}
+
+// Certificate returns a cached or newly minted leaf certificate for host
+func (ca *CA) Certificate(host string) (*tls.Certificate, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if cert, ok := ca.cache[host]; ok && time.Until(cert.Leaf.NotAfter) > 24*time.Hour {
+		return cert, nil
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host, Organization: []string{"ophid development certificate"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, &ca.leafKey.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mint certificate for %s: %w", host, err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, ca.Cert.Raw},
+		PrivateKey:  ca.leafKey,
+		Leaf:        leaf,
+	}
+	ca.cache[host] = cert
+
+	return cert, nil
+}
+
+// GetCertificateFunc returns a tls.Config GetCertificate callback serving
+// hosts that match domains ("example.test", "*.localhost"). Requests without
+// SNI get a certificate for "localhost".
+func (ca *CA) GetCertificateFunc(domains []string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if len(domains) == 0 {
+		domains = DefaultDomains
+	}
+
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		name := hello.ServerName
+		if name == "" {
+			name = "localhost"
+		}
+		if !MatchDomain(domains, name) {
+			return nil, fmt.Errorf("local CA: %s is not a configured development domain", name)
+		}
+		return ca.Certificate(name)
+	}
+}
+
+// MatchDomain reports whether host matches one of the domain patterns
+func MatchDomain(domains []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if d == host {
+			return true
+		}
+		if strings.HasPrefix(d, "*.") && strings.HasSuffix(host, d[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomSerial returns a random 128-bit certificate serial number
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
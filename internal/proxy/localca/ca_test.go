@@ -0,0 +1,73 @@
+package localca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreate(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, err := LoadOrCreate(dir)
+	if err != nil {
+		t.Fatalf("LoadOrCreate() error = %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, KeyFile))
+	if err != nil {
+		t.Fatalf("CA key not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("CA key mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Loading again reuses the same CA
+	again, err := LoadOrCreate(dir)
+	if err != nil {
+		t.Fatalf("LoadOrCreate() second call error = %v", err)
+	}
+	if !again.Cert.Equal(ca.Cert) {
+		t.Errorf("expected the existing CA to be reused")
+	}
+
+	getCert := ca.GetCertificateFunc(nil)
+	cert, err := getCert(&tls.ClientHelloInfo{ServerName: "app.localhost"})
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "app.localhost", Roots: roots}); err != nil {
+		t.Errorf("leaf does not verify against the CA: %v", err)
+	}
+
+	if _, err := getCert(&tls.ClientHelloInfo{ServerName: "example.com"}); err == nil {
+		t.Errorf("expected an error for a non-development domain")
+	}
+}
+
+func TestMatchDomain(t *testing.T) {
+	domains := []string{"localhost", "*.localhost", "myapp.test"}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"api.localhost", true},
+		{"a.b.localhost", true},
+		{"myapp.test", true},
+		{"other.test", false},
+		{"localhost.example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchDomain(domains, tt.host); got != tt.want {
+			t.Errorf("MatchDomain(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package localca
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// trustFileName is the name used for the CA in system trust stores
+const trustFileName = "ophid-local-ca"
+
+// runPrivileged runs a command, through sudo when not already root
+func runPrivileged(name string, args ...string) error {
+	if os.Geteuid() != 0 {
+		if _, err := exec.LookPath("sudo"); err == nil {
+			args = append([]string{name}, args...)
+			name = "sudo"
+		}
+	}
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
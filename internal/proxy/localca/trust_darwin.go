@@ -0,0 +1,9 @@
+//go:build darwin
+
+package localca
+
+// InstallTrust adds the CA certificate to the system keychain
+func InstallTrust(certPath string) error {
+	return runPrivileged("security", "add-trusted-cert", "-d", "-r", "trustRoot",
+		"-k", "/Library/Keychains/System.keychain", certPath)
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package localca
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// linuxTrustStores lists anchor directories and refresh commands by distribution
+var linuxTrustStores = []struct {
+	dir     string
+	refresh []string
+}{
+	{"/usr/local/share/ca-certificates", []string{"update-ca-certificates"}},           // Debian, Ubuntu, Alpine
+	{"/etc/pki/ca-trust/source/anchors", []string{"update-ca-trust", "extract"}},       // RHEL, Fedora
+	{"/etc/ca-certificates/trust-source/anchors", []string{"trust", "extract-compat"}}, // Arch
+	{"/usr/share/pki/trust/anchors", []string{"update-ca-certificates"}},               // openSUSE
+}
+
+// InstallTrust adds the CA certificate to the system trust store
+func InstallTrust(certPath string) error {
+	for _, store := range linuxTrustStores {
+		if _, err := os.Stat(store.dir); err != nil {
+			continue
+		}
+
+		dest := filepath.Join(store.dir, trustFileName+".crt")
+		if err := runPrivileged("cp", certPath, dest); err != nil {
+			return err
+		}
+		return runPrivileged(store.refresh[0], store.refresh[1:]...)
+	}
+
+	return fmt.Errorf("no supported system trust store found; add %s to your trust store manually", certPath)
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package localca
+
+import "fmt"
+
+// InstallTrust is not supported on this platform
+func InstallTrust(certPath string) error {
+	return fmt.Errorf("automatic trust installation is not supported on this platform; add %s to your trust store manually", certPath)
+}
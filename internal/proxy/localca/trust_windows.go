@@ -0,0 +1,20 @@
+//go:build windows
+
+package localca
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// InstallTrust adds the CA certificate to the current user's root store
+func InstallTrust(certPath string) error {
+	cmd := exec.Command("certutil", "-addstore", "-user", "-f", "ROOT", certPath)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("certutil failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gleicon/ophid/internal/proxy/logsink"
+	"github.com/gleicon/ophid/internal/proxy/middleware"
+)
+
+// logSink is an opened log destination bound to a set of listeners
+type logSink struct {
+	writer    io.WriteCloser
+	listeners []string
+}
+
+// appliesTo reports whether the sink receives logs for a listen address
+func (ls *logSink) appliesTo(addr string) bool {
+	if len(ls.listeners) == 0 {
+		return true
+	}
+	for _, l := range ls.listeners {
+		if l == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// openLogSinks opens the access and error log sinks from the configuration.
+// The legacy access_log / error_log paths are treated as file sinks.
+func (s *Server) openLogSinks() error {
+	general := s.config.Load().General
+
+	accessConfigs := general.AccessLogSinks
+	if general.AccessLog != "" {
+		accessConfigs = append([]LogSinkConfig{{Type: "file", Path: general.AccessLog}}, accessConfigs...)
+	}
+
+	errorConfigs := general.ErrorLogSinks
+	if general.ErrorLog != "" {
+		errorConfigs = append([]LogSinkConfig{{Type: "file", Path: general.ErrorLog}}, errorConfigs...)
+	}
+
+	for _, cfg := range accessConfigs {
+		sink, err := openLogSink(cfg, "access", logsink.SeverityInfo)
+		if err != nil {
+			s.closeLogSinks()
+			return fmt.Errorf("failed to open access log sink: %w", err)
+		}
+		s.accessSinks = append(s.accessSinks, sink)
+	}
+
+	for _, cfg := range errorConfigs {
+		sink, err := openLogSink(cfg, "error", logsink.SeverityError)
+		if err != nil {
+			s.closeLogSinks()
+			return fmt.Errorf("failed to open error log sink: %w", err)
+		}
+		s.errorSinks = append(s.errorSinks, sink)
+	}
+
+	return nil
+}
+
+// openLogSink opens a single sink
+func openLogSink(cfg LogSinkConfig, msgID string, severity int) (*logSink, error) {
+	var writer io.WriteCloser
+	var err error
+
+	switch cfg.Type {
+	case "file", "":
+		writer, err = logsink.NewFileSink(expandHome(cfg.Path), cfg.MaxSizeMB, cfg.MaxBackups)
+	case "syslog":
+		tag := cfg.Tag
+		if tag == "" {
+			tag = "ophid-proxy"
+		}
+		writer, err = logsink.NewSyslogSink(cfg.Network, cfg.Address, cfg.Facility, tag, msgID, severity)
+	case "http":
+		var interval time.Duration
+		if cfg.FlushInterval != "" {
+			interval, err = time.ParseDuration(cfg.FlushInterval)
+			if err != nil {
+				return nil, fmt.Errorf("invalid flush_interval %q: %w", cfg.FlushInterval, err)
+			}
+		}
+		writer, err = logsink.NewHTTPSink(cfg.URL, cfg.Headers, cfg.ContentType, cfg.BatchSize, interval)
+	default:
+		return nil, fmt.Errorf("unknown log sink type: %s (supported: file, syslog, http)", cfg.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &logSink{writer: writer, listeners: cfg.Listeners}, nil
+}
+
+// closeLogSinks flushes and closes all sinks
+func (s *Server) closeLogSinks() {
+	for _, sink := range append(s.accessSinks, s.errorSinks...) {
+		if err := sink.writer.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to close log sink: %v\n", err)
+		}
+	}
+	s.accessSinks = nil
+	s.errorSinks = nil
+}
+
+// sinkWriter combines the sinks that apply to a listen address
+func sinkWriter(sinks []*logSink, addr string) io.Writer {
+	writers := []io.Writer{}
+	for _, sink := range sinks {
+		if sink.appliesTo(addr) {
+			writers = append(writers, sink.writer)
+		}
+	}
+
+	if len(writers) == 0 {
+		return nil
+	}
+	return io.MultiWriter(writers...)
+}
+
+// handlerFor wraps a listener's handler with access logging when any
+// access log sink applies to it
+func (s *Server) handlerFor(addr string, handler http.Handler) http.Handler {
+	if w := sinkWriter(s.accessSinks, addr); w != nil {
+		format := s.config.Load().General.AccessLogFormat
+		flags := log.LstdFlags
+		if format == "json" {
+			flags = 0
+		}
+		logger := middleware.NewLoggerWithFormat(log.New(w, "", flags), format)
+		handler = logger.Middleware(handler)
+	}
+
+	return handler
+}
+
+// errorLogFor returns the error logger for a listener's http.Server
+func (s *Server) errorLogFor(addr string) *log.Logger {
+	w := sinkWriter(s.errorSinks, addr)
+	if w == nil {
+		return nil
+	}
+	return log.New(io.MultiWriter(os.Stderr, w), "", log.LstdFlags)
+}
+
+// redirectErrorLog sends the proxy's own log output to the error sinks that
+// are not bound to specific listeners
+func (s *Server) redirectErrorLog() {
+	writers := []io.Writer{}
+	for _, sink := range s.errorSinks {
+		if len(sink.listeners) == 0 {
+			writers = append(writers, sink.writer)
+		}
+	}
+
+	if len(writers) > 0 {
+		log.SetOutput(io.MultiWriter(append([]io.Writer{os.Stderr}, writers...)...))
+	}
+}
@@ -0,0 +1,118 @@
+package logsink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileSink writes log lines to a local file with size-based rotation
+type FileSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	mu         sync.Mutex
+}
+
+// NewFileSink opens (or creates) a log file. When maxSizeMB is greater than
+// zero the file is rotated to path.1, path.2, ... once it exceeds that size,
+// keeping at most maxBackups old files.
+func NewFileSink(path string, maxSizeMB, maxBackups int) (*FileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file sink path is required")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	fs := &FileSink{
+		path:       path,
+		maxBytes:   int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+
+	if err := fs.open(); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// Write implements io.Writer
+func (fs *FileSink) Write(p []byte) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.file == nil {
+		return 0, fmt.Errorf("file sink %s is closed", fs.path)
+	}
+
+	if fs.maxBytes > 0 && fs.size+int64(len(p)) > fs.maxBytes && fs.size > 0 {
+		if err := fs.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := fs.file.Write(p)
+	fs.size += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer
+func (fs *FileSink) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.file == nil {
+		return nil
+	}
+
+	err := fs.file.Close()
+	fs.file = nil
+	return err
+}
+
+// open opens the log file for appending
+func (fs *FileSink) open() error {
+	file, err := os.OpenFile(fs.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	fs.file = file
+	fs.size = info.Size()
+	return nil
+}
+
+// rotate shifts path.N-1 -> path.N, moves the current file to path.1 and
+// reopens a fresh file. Must be called with fs.mu held.
+func (fs *FileSink) rotate() error {
+	if err := fs.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	fs.file = nil
+
+	if fs.maxBackups <= 0 {
+		os.Remove(fs.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", fs.path, fs.maxBackups))
+		for i := fs.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", fs.path, i), fmt.Sprintf("%s.%d", fs.path, i+1))
+		}
+		if err := os.Rename(fs.path, fs.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+
+	return fs.open()
+}
@@ -0,0 +1,33 @@
+package logsink
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSinkRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	fs, err := NewFileSink(path, 1, 2)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer fs.Close()
+
+	line := make([]byte, 600*1024)
+	for i := 0; i < 4; i++ {
+		if _, err := fs.Write(line); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, found %s.3", path)
+	}
+}
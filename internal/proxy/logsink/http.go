@@ -0,0 +1,187 @@
+package logsink
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Second
+
+	// maxBufferedBatches bounds memory when the endpoint is unreachable
+	maxBufferedBatches = 10
+)
+
+// HTTPSink batches log lines and POSTs them to a bulk ingestion endpoint
+// (e.g., Logstash http input, Vector, Fluent Bit). Lines are sent
+// newline-delimited in a single request body.
+type HTTPSink struct {
+	url           string
+	headers       map[string]string
+	contentType   string
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+
+	buffer  [][]byte
+	dropped int
+	mu      sync.Mutex
+
+	flushCh chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewHTTPSink creates a sink posting batches to url. contentType defaults to
+// application/x-ndjson, which suits JSON-formatted access logs.
+func NewHTTPSink(url string, headers map[string]string, contentType string, batchSize int, flushInterval time.Duration) (*HTTPSink, error) {
+	if url == "" {
+		return nil, fmt.Errorf("http sink url is required")
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	if contentType == "" {
+		contentType = "application/x-ndjson"
+	}
+
+	hs := &HTTPSink{
+		url:           url,
+		headers:       headers,
+		contentType:   contentType,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		flushCh:       make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+
+	hs.wg.Add(1)
+	go hs.run()
+
+	return hs, nil
+}
+
+// Write implements io.Writer. Lines are buffered and sent asynchronously.
+func (hs *HTTPSink) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+
+	hs.mu.Lock()
+	hs.buffer = append(hs.buffer, line)
+	if len(hs.buffer) > hs.batchSize*maxBufferedBatches {
+		// Drop the oldest lines rather than growing without bound
+		overflow := len(hs.buffer) - hs.batchSize*maxBufferedBatches
+		hs.buffer = hs.buffer[overflow:]
+		hs.dropped += overflow
+	}
+	full := len(hs.buffer) >= hs.batchSize
+	hs.mu.Unlock()
+
+	if full {
+		select {
+		case hs.flushCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close flushes pending lines and stops the background sender
+func (hs *HTTPSink) Close() error {
+	close(hs.done)
+	hs.wg.Wait()
+	return nil
+}
+
+// run flushes the buffer on every tick or when a batch fills up
+func (hs *HTTPSink) run() {
+	defer hs.wg.Done()
+
+	ticker := time.NewTicker(hs.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hs.done:
+			hs.flush()
+			return
+		case <-ticker.C:
+			hs.flush()
+		case <-hs.flushCh:
+			hs.flush()
+		}
+	}
+}
+
+// flush sends buffered lines in batches. Failed batches are put back at
+// the front of the buffer and retried on the next flush.
+func (hs *HTTPSink) flush() {
+	for {
+		hs.mu.Lock()
+		if len(hs.buffer) == 0 {
+			hs.mu.Unlock()
+			return
+		}
+		n := len(hs.buffer)
+		if n > hs.batchSize {
+			n = hs.batchSize
+		}
+		batch := hs.buffer[:n]
+		hs.buffer = hs.buffer[n:]
+		dropped := hs.dropped
+		hs.dropped = 0
+		hs.mu.Unlock()
+
+		if dropped > 0 {
+			// Write to stderr: the standard logger may itself feed this sink
+			fmt.Fprintf(os.Stderr, "log sink %s: dropped %d lines (buffer full)\n", hs.url, dropped)
+		}
+
+		if err := hs.send(batch); err != nil {
+			fmt.Fprintf(os.Stderr, "log sink %s: %v\n", hs.url, err)
+			hs.mu.Lock()
+			hs.buffer = append(batch, hs.buffer...)
+			hs.mu.Unlock()
+			return
+		}
+	}
+}
+
+// send POSTs one batch
+func (hs *HTTPSink) send(batch [][]byte) error {
+	body := bytes.Join(batch, nil)
+
+	req, err := http.NewRequest("POST", hs.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", hs.contentType)
+	for k, v := range hs.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
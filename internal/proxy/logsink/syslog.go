@@ -0,0 +1,157 @@
+package logsink
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog severities used by the proxy
+const (
+	SeverityError = 3
+	SeverityInfo  = 6
+)
+
+// syslogFacilities maps facility names to RFC5424 facility codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3,
+	"auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogSink sends log lines to a syslog server using RFC5424 framing
+type SyslogSink struct {
+	network  string
+	address  string
+	facility int
+	severity int
+	appName  string
+	msgID    string
+	hostname string
+	conn     net.Conn
+	mu       sync.Mutex
+}
+
+// NewSyslogSink connects to a syslog server. network is "udp", "tcp",
+// "unix" or "unixgram"; facility is a name such as "local0"; msgID tags
+// every message (e.g., "access" or "error").
+func NewSyslogSink(network, address, facility, appName, msgID string, severity int) (*SyslogSink, error) {
+	if address == "" {
+		return nil, fmt.Errorf("syslog sink address is required")
+	}
+	if network == "" {
+		network = "udp"
+	}
+	if facility == "" {
+		facility = "local0"
+	}
+	if appName == "" {
+		appName = "ophid"
+	}
+
+	code, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility: %s", facility)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	ss := &SyslogSink{
+		network:  network,
+		address:  address,
+		facility: code,
+		severity: severity,
+		appName:  appName,
+		msgID:    msgID,
+		hostname: hostname,
+	}
+
+	if err := ss.connect(); err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// Write implements io.Writer. Each call is sent as one syslog message.
+func (ss *SyslogSink) Write(p []byte) (int, error) {
+	msg := ss.format(bytes.TrimRight(p, "\n"))
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	// Retry once on a fresh connection (e.g., TCP peer restarted)
+	for attempt := 0; attempt < 2; attempt++ {
+		if ss.conn == nil {
+			if err := ss.connect(); err != nil {
+				return 0, err
+			}
+		}
+
+		if _, err := ss.conn.Write(msg); err == nil {
+			return len(p), nil
+		}
+
+		ss.conn.Close()
+		ss.conn = nil
+	}
+
+	return 0, fmt.Errorf("failed to write to syslog %s://%s", ss.network, ss.address)
+}
+
+// Close implements io.Closer
+func (ss *SyslogSink) Close() error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.conn == nil {
+		return nil
+	}
+
+	err := ss.conn.Close()
+	ss.conn = nil
+	return err
+}
+
+// connect dials the syslog server
+func (ss *SyslogSink) connect() error {
+	conn, err := net.DialTimeout(ss.network, ss.address, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog %s://%s: %w", ss.network, ss.address, err)
+	}
+	ss.conn = conn
+	return nil
+}
+
+// format builds an RFC5424 message:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID - MSG
+// Stream transports use octet-counting framing (RFC6587).
+func (ss *SyslogSink) format(line []byte) []byte {
+	msgID := ss.msgID
+	if msgID == "" {
+		msgID = "-"
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		ss.facility*8+ss.severity,
+		time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		ss.hostname,
+		ss.appName,
+		os.Getpid(),
+		msgID,
+		line,
+	)
+
+	if ss.network == "tcp" || ss.network == "unix" {
+		return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+	}
+	return []byte(msg)
+}
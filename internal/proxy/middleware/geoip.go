@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// CountryLookup resolves the ISO 3166-1 alpha-2 country code of a request's
+// client. An empty string means the country is unknown (e.g., private IPs).
+type CountryLookup interface {
+	Country(r *http.Request) string
+}
+
+// GeoIP resolves client countries from a MaxMind GeoLite2/GeoIP2 database
+type GeoIP struct {
+	db      *maxminddb.Reader
+	trusted []*net.IPNet // Proxies whose forwarded headers name the client
+}
+
+// NewGeoIP opens a MaxMind database (e.g., GeoLite2-Country.mmdb).
+// X-Forwarded-For and X-Real-IP are only believed on requests from the
+// trusted proxies, IPs or CIDRs; anyone else could forge them.
+func NewGeoIP(path string, trustedProxies []string) (*GeoIP, error) {
+	trusted, err := ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+
+	return &GeoIP{db: db, trusted: trusted}, nil
+}
+
+// ParseTrustedProxies parses trusted proxy IPs and CIDRs
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q (want an IP or CIDR)", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q (want an IP or CIDR)", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// Country implements CountryLookup
+func (g *GeoIP) Country(r *http.Request) string {
+	ip := g.clientIP(r)
+	if ip == nil {
+		return ""
+	}
+
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := g.db.Lookup(ip, &record); err != nil {
+		return ""
+	}
+
+	return record.Country.ISOCode
+}
+
+// clientIP returns the IP of a request's client: its peer, or, when the
+// peer is a trusted proxy, the nearest untrusted hop of X-Forwarded-For
+// (read from the right, as clients can prepend anything) or X-Real-IP
+func (g *GeoIP) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !g.trusts(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	if len(hops) == 0 {
+		if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+			return realIP
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !g.trusts(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// trusts reports whether ip is a trusted proxy
+func (g *GeoIP) trusts(ip net.IP) bool {
+	for _, ipNet := range g.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close releases the database
+func (g *GeoIP) Close() error {
+	return g.db.Close()
+}
+
+// GeoFilter blocks requests by client country and optionally passes the
+// country to backends in a request header
+type GeoFilter struct {
+	lookup CountryLookup
+	allow  map[string]bool
+	block  map[string]bool
+	header string
+}
+
+// NewGeoFilter creates a country filter. When allow is non-empty only those
+// countries are admitted (unknown countries are rejected); block rejects the
+// listed countries. header, if set, receives the country code (e.g., "X-Country").
+func NewGeoFilter(lookup CountryLookup, allow, block []string, header string) *GeoFilter {
+	return &GeoFilter{
+		lookup: lookup,
+		allow:  countrySet(allow),
+		block:  countrySet(block),
+		header: header,
+	}
+}
+
+// Middleware returns the GeoIP filtering middleware
+func (g *GeoFilter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		country := g.lookup.Country(r)
+
+		if len(g.allow) > 0 && !g.allow[country] || g.block[country] {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if g.header != "" {
+			// Always overwrite so clients cannot spoof the header
+			if country != "" {
+				r.Header.Set(g.header, country)
+			} else {
+				r.Header.Del(g.header)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// countrySet normalizes country codes to an upper-case lookup set
+func countrySet(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			set[code] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// staticCountry resolves every request to the same country
+type staticCountry string
+
+func (c staticCountry) Country(r *http.Request) string { return string(c) }
+
+func TestGeoFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		country    string
+		allow      []string
+		block      []string
+		wantStatus int
+	}{
+		{"no rules", "BR", nil, nil, http.StatusOK},
+		{"allowed", "BR", []string{"br", "PT"}, nil, http.StatusOK},
+		{"not allowed", "US", []string{"BR"}, nil, http.StatusForbidden},
+		{"unknown with allow list", "", []string{"BR"}, nil, http.StatusForbidden},
+		{"blocked", "RU", nil, []string{"RU"}, http.StatusForbidden},
+		{"not blocked", "BR", nil, []string{"RU"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotHeader string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotHeader = r.Header.Get("X-Country")
+			})
+
+			filter := NewGeoFilter(staticCountry(tt.country), tt.allow, tt.block, "X-Country")
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-Country", "spoofed")
+			rec := httptest.NewRecorder()
+			filter.Middleware(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && gotHeader != tt.country {
+				t.Errorf("X-Country = %q, want %q", gotHeader, tt.country)
+			}
+		})
+	}
+}
+
+func TestGeoIPClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "fd00::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &GeoIP{trusted: trusted}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		realIP     string
+		want       string
+	}{
+		{"peer", "203.0.113.7:4321", "", "", "203.0.113.7"},
+		{"ipv6 peer", "[2001:db8::7]:4321", "", "", "2001:db8::7"},
+		{"ipv6 loopback", "[::1]:4321", "", "", "::1"},
+		{"spoofed X-Forwarded-For", "203.0.113.7:4321", "198.51.100.1", "", "203.0.113.7"},
+		{"spoofed X-Real-IP", "203.0.113.7:4321", "", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:4321", "203.0.113.7", "", "203.0.113.7"},
+		{"trusted ipv6 proxy", "[fd00::1]:4321", "203.0.113.7", "", "203.0.113.7"},
+		{"trusted proxy X-Real-IP", "10.0.0.2:4321", "", "203.0.113.7", "203.0.113.7"},
+		{"client prepended hop", "10.0.0.2:4321", "198.51.100.1, 203.0.113.7", "", "203.0.113.7"},
+		{"proxy chain", "10.0.0.2:4321", "203.0.113.7, 10.0.0.3", "", "203.0.113.7"},
+		{"garbage hop", "10.0.0.2:4321", "not-an-ip", "", "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := g.clientIP(req); got.String() != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("ParseTrustedProxies() accepted an invalid CIDR")
+	}
+}
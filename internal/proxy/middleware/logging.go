@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 	"time"
@@ -9,16 +11,67 @@ import (
 // Logger implements access logging middleware
 type Logger struct {
 	logger *log.Logger
+	format string
 }
 
 // NewLogger creates a new logging middleware
 func NewLogger(logger *log.Logger) *Logger {
+	return NewLoggerWithFormat(logger, "text")
+}
+
+// NewLoggerWithFormat creates a logging middleware writing "text" lines or
+// one "json" object per request (suited to ELK/SIEM ingestion)
+func NewLoggerWithFormat(logger *log.Logger, format string) *Logger {
 	if logger == nil {
 		logger = log.Default()
 	}
 
+	if format == "" {
+		format = "text"
+	}
+
 	return &Logger{
 		logger: logger,
+		format: format,
+	}
+}
+
+// accessLogEntry is the JSON access log record
+type accessLogEntry struct {
+	Time       string  `json:"time"`
+	RemoteIP   string  `json:"remote_ip"`
+	Method     string  `json:"method"`
+	Host       string  `json:"host"`
+	URI        string  `json:"uri"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+	Referer    string  `json:"referer,omitempty"`
+	RequestID  string  `json:"request_id,omitempty"`
+}
+
+// accessLogState lets route middleware running inside the Logger adjust how
+// a request is logged
+type accessLogState struct {
+	skip      bool
+	requestID string
+}
+
+type accessLogKey struct{}
+
+// SetAccessLog turns access logging of a request on or off. It has no
+// effect when the request is not wrapped by a Logger.
+func SetAccessLog(r *http.Request, enabled bool) {
+	if state, ok := r.Context().Value(accessLogKey{}).(*accessLogState); ok {
+		state.skip = !enabled
+	}
+}
+
+// setAccessLogRequestID records the request ID written to JSON access logs
+func setAccessLogRequestID(r *http.Request, id string) {
+	if state, ok := r.Context().Value(accessLogKey{}).(*accessLogState); ok {
+		state.requestID = id
 	}
 }
 
@@ -27,6 +80,9 @@ func (l *Logger) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		state := &accessLogState{}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, state))
+
 		// Wrap response writer to capture status code
 		wrapped := &responseWriter{
 			ResponseWriter: w,
@@ -37,7 +93,31 @@ func (l *Logger) Middleware(next http.Handler) http.Handler {
 		next.ServeHTTP(wrapped, r)
 
 		// Log request
+		if state.skip {
+			return
+		}
 		duration := time.Since(start)
+
+		if l.format == "json" {
+			data, err := json.Marshal(accessLogEntry{
+				Time:       start.UTC().Format(time.RFC3339Nano),
+				RemoteIP:   extractIP(r),
+				Method:     r.Method,
+				Host:       r.Host,
+				URI:        r.RequestURI,
+				Proto:      r.Proto,
+				Status:     wrapped.status,
+				DurationMS: float64(duration.Microseconds()) / 1000,
+				UserAgent:  r.UserAgent(),
+				Referer:    r.Referer(),
+				RequestID:  state.requestID,
+			})
+			if err == nil {
+				l.logger.Print(string(data))
+			}
+			return
+		}
+
 		l.logger.Printf("%s %s %s %d %s %s",
 			extractIP(r),
 			r.Method,
@@ -68,3 +148,8 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	}
 	return rw.ResponseWriter.Write(b)
 }
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
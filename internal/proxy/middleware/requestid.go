@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// DefaultRequestIDHeader carries request IDs when no header is configured
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// RequestID tags each request with an ID, sent to the backend and back to
+// the client. IDs set by the client (or an upstream proxy) are kept.
+type RequestID struct {
+	header string
+}
+
+// NewRequestID creates a request ID middleware using header
+func NewRequestID(header string) *RequestID {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	return &RequestID{header: http.CanonicalHeaderKey(header)}
+}
+
+// Middleware returns the request ID middleware
+func (rid *RequestID) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(rid.header)
+		if id == "" {
+			id = newRequestID()
+			r.Header.Set(rid.header, id)
+		}
+
+		w.Header().Set(rid.header, id)
+		setAccessLogRequestID(r, id)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newRequestID returns a random 128-bit hex ID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,296 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Outlier detection defaults
+const (
+	defaultOutlierLatencyFactor  = 3.0
+	defaultOutlierMinLatency     = 50 * time.Millisecond
+	defaultOutlierErrorRateDelta = 0.3
+	defaultOutlierMinRequests    = 20
+	defaultOutlierEjectionTime   = 30 * time.Second
+	defaultOutlierMaxEjection    = 50
+	defaultOutlierInterval       = 10 * time.Second
+
+	outlierEWMAAlpha   = 0.1 // Weight of the newest sample
+	outlierWindowSize  = 128 // Latency samples kept for p95
+	outlierMaxBackoffN = 10  // Cap on the ejection time multiplier
+)
+
+// outlierDetector tracks latency and 5xx rates for a route's backends and
+// temporarily ejects backends that deviate strongly from the rest of the pool
+type outlierDetector struct {
+	latencyFactor  float64
+	minLatency     time.Duration
+	errorRateDelta float64
+	minRequests    int
+	ejectionTime   time.Duration
+	maxEjection    int
+	interval       time.Duration
+
+	name      string // Route description for logs
+	backends  []*Backend
+	stats     map[*Backend]*backendStats
+	lastCheck time.Time
+	mu        sync.Mutex
+}
+
+// backendStats holds one backend's outlier detection state
+type backendStats struct {
+	requests     int
+	latencyEWMA  float64 // Seconds
+	errorEWMA    float64 // Fraction of 5xx responses
+	window       []time.Duration
+	next         int
+	ejectedUntil time.Time
+	ejections    int
+}
+
+// OutlierStatus is a snapshot of a backend's outlier detection state
+type OutlierStatus struct {
+	Requests     int       `json:"requests"`
+	LatencyEWMA  float64   `json:"latency_ewma_seconds"`
+	LatencyP95   float64   `json:"latency_p95_seconds"`
+	ErrorRate    float64   `json:"error_rate"`
+	Ejected      bool      `json:"ejected"`
+	EjectedUntil time.Time `json:"ejected_until,omitempty"`
+	Ejections    int       `json:"ejections"`
+}
+
+// newOutlierDetector creates a detector for a route's backend pool
+func newOutlierDetector(route *Route, cfg *OutlierConfig) (*outlierDetector, error) {
+	d := &outlierDetector{
+		latencyFactor:  cfg.LatencyFactor,
+		errorRateDelta: cfg.ErrorRateDelta,
+		minRequests:    cfg.MinRequests,
+		maxEjection:    cfg.MaxEjectionPercent,
+		name:           describeRoute(route),
+		backends:       route.Backends,
+		stats:          make(map[*Backend]*backendStats, len(route.Backends)),
+	}
+
+	if d.latencyFactor <= 0 {
+		d.latencyFactor = defaultOutlierLatencyFactor
+	}
+	if d.errorRateDelta <= 0 {
+		d.errorRateDelta = defaultOutlierErrorRateDelta
+	}
+	if d.minRequests <= 0 {
+		d.minRequests = defaultOutlierMinRequests
+	}
+	if d.maxEjection <= 0 {
+		d.maxEjection = defaultOutlierMaxEjection
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+		def   time.Duration
+	}{
+		{"min_latency", cfg.MinLatency, &d.minLatency, defaultOutlierMinLatency},
+		{"ejection_time", cfg.EjectionTime, &d.ejectionTime, defaultOutlierEjectionTime},
+		{"interval", cfg.Interval, &d.interval, defaultOutlierInterval},
+	}
+	for _, dur := range durations {
+		*dur.dst = dur.def
+		if dur.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(dur.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid outlier %s %q: %w", dur.name, dur.value, err)
+		}
+		*dur.dst = parsed
+	}
+
+	for _, backend := range route.Backends {
+		d.stats[backend] = &backendStats{}
+	}
+
+	return d, nil
+}
+
+// record adds a response (status 0 for transport errors) and periodically
+// re-evaluates the pool
+func (d *outlierDetector) record(backend *Backend, status int, latency time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st, ok := d.stats[backend]
+	if !ok {
+		return
+	}
+
+	failed := 0.0
+	if status == 0 || status >= 500 {
+		failed = 1
+	}
+
+	if st.requests == 0 {
+		st.latencyEWMA = latency.Seconds()
+		st.errorEWMA = failed
+	} else {
+		st.latencyEWMA += outlierEWMAAlpha * (latency.Seconds() - st.latencyEWMA)
+		st.errorEWMA += outlierEWMAAlpha * (failed - st.errorEWMA)
+	}
+	st.requests++
+
+	if len(st.window) < outlierWindowSize {
+		st.window = append(st.window, latency)
+	} else {
+		st.window[st.next] = latency
+		st.next = (st.next + 1) % outlierWindowSize
+	}
+
+	now := time.Now()
+	if now.Sub(d.lastCheck) >= d.interval {
+		d.lastCheck = now
+		d.evaluate(now)
+	}
+}
+
+// ejected reports whether a backend is currently ejected
+func (d *outlierDetector) ejected(backend *Backend) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st, ok := d.stats[backend]
+	if !ok || st.ejectedUntil.IsZero() {
+		return false
+	}
+
+	now := time.Now()
+	if now.Before(st.ejectedUntil) {
+		return true
+	}
+	d.restore(backend, st)
+	return false
+}
+
+// restore returns a backend whose ejection expired to the pool, judging it
+// on fresh traffic. It must be called with d.mu held.
+func (d *outlierDetector) restore(backend *Backend, st *backendStats) {
+	log.Printf("Outlier detection: backend %s of route %s returned to the pool", backend.URLStr, d.name)
+	*st = backendStats{ejections: st.ejections}
+	if backend.Health != nil {
+		backend.Health.MarkRecovered()
+	}
+}
+
+// evaluate compares each backend with the rest of the pool. It must be
+// called with d.mu held.
+func (d *outlierDetector) evaluate(now time.Time) {
+	type candidate struct {
+		backend *Backend
+		stats   *backendStats
+		p95     time.Duration
+	}
+
+	var active []candidate
+	ejectedCount := 0
+	for _, backend := range d.backends {
+		st := d.stats[backend]
+
+		if !st.ejectedUntil.IsZero() {
+			if now.Before(st.ejectedUntil) {
+				ejectedCount++
+				continue
+			}
+			d.restore(backend, st)
+		}
+
+		if st.requests >= d.minRequests {
+			active = append(active, candidate{backend: backend, stats: st, p95: percentile(st.window, 0.95)})
+		}
+	}
+
+	if len(active) < 2 {
+		return
+	}
+
+	for i, c := range active {
+		if (ejectedCount+1)*100 > d.maxEjection*len(d.backends) {
+			return
+		}
+
+		// Compare with the other active backends
+		var others []time.Duration
+		var otherErrors float64
+		for j, o := range active {
+			if i != j && now.After(o.stats.ejectedUntil) {
+				others = append(others, o.p95)
+				otherErrors += o.stats.errorEWMA
+			}
+		}
+		if len(others) == 0 {
+			continue
+		}
+		poolP95 := percentile(others, 0.5)
+		poolErrors := otherErrors / float64(len(others))
+
+		var reason string
+		switch {
+		case c.stats.errorEWMA-poolErrors >= d.errorRateDelta:
+			reason = fmt.Sprintf("5xx rate %.0f%% vs pool %.0f%%", c.stats.errorEWMA*100, poolErrors*100)
+		case float64(c.p95) > d.latencyFactor*float64(poolP95) && c.p95-poolP95 >= d.minLatency:
+			reason = fmt.Sprintf("p95 latency %s vs pool %s", c.p95.Round(time.Millisecond), poolP95.Round(time.Millisecond))
+		default:
+			continue
+		}
+
+		c.stats.ejections++
+		n := c.stats.ejections
+		if n > outlierMaxBackoffN {
+			n = outlierMaxBackoffN
+		}
+		duration := d.ejectionTime * time.Duration(n)
+		c.stats.ejectedUntil = now.Add(duration)
+		ejectedCount++
+
+		log.Printf("Outlier detection: ejecting backend %s of route %s for %s (%s)", c.backend.URLStr, d.name, duration, reason)
+	}
+}
+
+// status returns a snapshot of a backend's state
+func (d *outlierDetector) status(backend *Backend) (OutlierStatus, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st, ok := d.stats[backend]
+	if !ok {
+		return OutlierStatus{}, false
+	}
+
+	status := OutlierStatus{
+		Requests:    st.requests,
+		LatencyEWMA: st.latencyEWMA,
+		LatencyP95:  percentile(st.window, 0.95).Seconds(),
+		ErrorRate:   st.errorEWMA,
+		Ejections:   st.ejections,
+	}
+	if time.Now().Before(st.ejectedUntil) {
+		status.Ejected = true
+		status.EjectedUntil = st.ejectedUntil
+	}
+	return status, true
+}
+
+// percentile returns the p-th percentile (0-1) of samples
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	idx := int(p*float64(len(sorted)-1) + 0.5)
+	return sorted[idx]
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, n int, cfg *OutlierConfig) (*Route, []*Backend) {
+	t.Helper()
+
+	route := &Route{Path: "/*", LoadBalance: LoadBalanceConfig{Outlier: cfg}}
+	for i := 0; i < n; i++ {
+		route.Backends = append(route.Backends, &Backend{
+			Name:   string(rune('a' + i)),
+			URLStr: "http://10.0.0." + string(rune('1'+i)) + ":8000",
+		})
+	}
+	if err := prepareRoute(route); err != nil {
+		t.Fatal(err)
+	}
+	return route, route.Backends
+}
+
+func feed(d *outlierDetector, backend *Backend, n, status int, latency time.Duration) {
+	for i := 0; i < n; i++ {
+		d.record(backend, status, latency)
+	}
+}
+
+func TestOutlierEjectsSlowBackend(t *testing.T) {
+	route, backends := newTestPool(t, 3, &OutlierConfig{Interval: "1h", MinRequests: 10})
+	d := route.outliers
+
+	feed(d, backends[0], 20, 200, 10*time.Millisecond)
+	feed(d, backends[1], 20, 200, 12*time.Millisecond)
+	feed(d, backends[2], 20, 200, 400*time.Millisecond)
+
+	d.mu.Lock()
+	d.evaluate(time.Now())
+	d.mu.Unlock()
+
+	if !d.ejected(backends[2]) {
+		t.Error("slow backend was not ejected")
+	}
+	if d.ejected(backends[0]) || d.ejected(backends[1]) {
+		t.Error("fast backend was ejected")
+	}
+
+	// Ejected backends are skipped by the load balancer
+	lb := NewLoadBalancer(StrategyRoundRobin, backends)
+	lb.outliers = d
+	for i := 0; i < 10; i++ {
+		if b := lb.SelectBackend(httptest.NewRequest("GET", "/", nil)); b == backends[2] {
+			t.Fatal("load balancer selected an ejected backend")
+		}
+	}
+
+	status, _ := d.status(backends[2])
+	if !status.Ejected || status.Ejections != 1 {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestOutlierEjectsFailingBackend(t *testing.T) {
+	route, backends := newTestPool(t, 3, &OutlierConfig{Interval: "1h", MinRequests: 10})
+	d := route.outliers
+
+	feed(d, backends[0], 20, 200, 10*time.Millisecond)
+	feed(d, backends[1], 20, 200, 10*time.Millisecond)
+	feed(d, backends[2], 20, 503, 10*time.Millisecond)
+
+	d.mu.Lock()
+	d.evaluate(time.Now())
+	d.mu.Unlock()
+
+	if !d.ejected(backends[2]) {
+		t.Error("failing backend was not ejected")
+	}
+}
+
+func TestOutlierKeepsUniformPool(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  [3]int
+		latencies [3]time.Duration
+	}{
+		// Every backend failing is a pool problem, not an outlier
+		{"all failing", [3]int{502, 502, 502}, [3]time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond}},
+		// Small absolute differences are ignored even if the ratio is large
+		{"fast pool", [3]int{200, 200, 200}, [3]time.Duration{time.Millisecond, time.Millisecond, 8 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, backends := newTestPool(t, 3, &OutlierConfig{Interval: "1h", MinRequests: 10})
+			d := route.outliers
+
+			for i, b := range backends {
+				feed(d, b, 20, tt.statuses[i], tt.latencies[i])
+			}
+
+			d.mu.Lock()
+			d.evaluate(time.Now())
+			d.mu.Unlock()
+
+			for _, b := range backends {
+				if d.ejected(b) {
+					t.Errorf("backend %s ejected from a uniform pool", b.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestOutlierMaxEjectionPercent(t *testing.T) {
+	route, backends := newTestPool(t, 4, &OutlierConfig{Interval: "1h", MinRequests: 10, MaxEjectionPercent: 25})
+	d := route.outliers
+
+	feed(d, backends[0], 20, 200, 10*time.Millisecond)
+	feed(d, backends[1], 20, 200, 10*time.Millisecond)
+	feed(d, backends[2], 20, 500, 10*time.Millisecond)
+	feed(d, backends[3], 20, 500, 10*time.Millisecond)
+
+	d.mu.Lock()
+	d.evaluate(time.Now())
+	d.mu.Unlock()
+
+	ejected := 0
+	for _, b := range backends {
+		if d.ejected(b) {
+			ejected++
+		}
+	}
+	if ejected != 1 {
+		t.Errorf("ejected %d backends, want 1 (25%% of 4)", ejected)
+	}
+}
+
+func TestOutlierEjectionExpires(t *testing.T) {
+	route, backends := newTestPool(t, 2, &OutlierConfig{Interval: "1h", MinRequests: 5, EjectionTime: "1s"})
+	d := route.outliers
+
+	feed(d, backends[0], 10, 200, 10*time.Millisecond)
+	feed(d, backends[1], 10, 500, 10*time.Millisecond)
+
+	now := time.Now()
+	d.mu.Lock()
+	d.evaluate(now)
+	d.mu.Unlock()
+	if !d.ejected(backends[1]) {
+		t.Fatal("failing backend was not ejected")
+	}
+
+	// After the ejection time the backend returns with fresh stats
+	d.mu.Lock()
+	d.evaluate(now.Add(2 * time.Second))
+	d.mu.Unlock()
+
+	status, _ := d.status(backends[1])
+	if status.Ejected || status.Requests != 0 || status.Ejections != 1 {
+		t.Errorf("status after expiry = %+v", status)
+	}
+}
+
+func TestAdminMetrics(t *testing.T) {
+	route, backends := newTestPool(t, 2, &OutlierConfig{Interval: "1h"})
+	route.outliers.record(backends[0], 200, 20*time.Millisecond)
+
+	router := NewRouter()
+	router.AddRoute(route)
+	s := &Server{}
+	s.config.Store(&Config{})
+	s.router.Store(router)
+
+	rec := httptest.NewRecorder()
+	s.adminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`ophid_proxy_backend_ejected{route="*/*",backend="http://10.0.0.1:8000"} 0`,
+		`ophid_proxy_backend_latency_p95_seconds{route="*/*",backend="http://10.0.0.1:8000"} 0.02`,
+		"# TYPE ophid_proxy_backend_ejections_total counter",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	s.adminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/backends", nil))
+	if !strings.Contains(rec.Body.String(), `"url":"http://10.0.0.2:8000"`) {
+		t.Errorf("unexpected /backends response: %s", rec.Body.String())
+	}
+}
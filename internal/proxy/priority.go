@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// routeConflict describes a route that can never match because an earlier
+// route (in match order) covers every request it would match
+type routeConflict struct {
+	route      *Route
+	shadowedBy *Route
+	duplicate  bool // Identical host, path and method
+}
+
+// sortRoutes orders routes for matching: higher priority first, then the
+// most specific match (exact host before wildcard host before any host,
+// exact path before longer prefix before suffix before any path, a specific
+// method before any method). Routes that tie keep their configured order.
+func sortRoutes(routes []*Route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routeLess(routes[i], routes[j])
+	})
+}
+
+// RouteOrder returns the indexes of routes in the order they are matched
+func RouteOrder(routes []Route) []int {
+	ordered := make([]*Route, len(routes))
+	index := make(map[*Route]int, len(routes))
+	for i := range routes {
+		ordered[i] = &routes[i]
+		index[&routes[i]] = i
+	}
+	sortRoutes(ordered)
+
+	order := make([]int, len(ordered))
+	for i, route := range ordered {
+		order[i] = index[route]
+	}
+	return order
+}
+
+// routeLess reports whether route a should be matched before route b
+func routeLess(a, b *Route) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+
+	if ra, rb := hostRank(a.Host), hostRank(b.Host); ra != rb {
+		return ra > rb
+	}
+	if len(a.Host) != len(b.Host) {
+		return len(a.Host) > len(b.Host)
+	}
+
+	if ra, rb := pathRank(a.Path), pathRank(b.Path); ra != rb {
+		return ra > rb
+	}
+	if len(a.Path) != len(b.Path) {
+		return len(a.Path) > len(b.Path)
+	}
+
+	if ma, mb := normalizeMethod(a.Method) != "*", normalizeMethod(b.Method) != "*"; ma != mb {
+		return ma
+	}
+
+	// Routes with more conditions (headers, query, cookies, countries) fall
+	// through when they don't match, so try them first
+	return conditionCount(a) > conditionCount(b)
+}
+
+// conditionCount counts a route's header, query, cookie and country conditions
+func conditionCount(route *Route) int {
+	n := len(route.MatchHeaders) + len(route.MatchQuery) + len(route.MatchCookies)
+	if len(route.GeoIP.Countries) > 0 {
+		n++
+	}
+	return n
+}
+
+// hostRank scores host pattern specificity
+func hostRank(host string) int {
+	switch {
+	case host == "" || host == "*":
+		return 0
+	case strings.HasPrefix(host, "*."):
+		return 1
+	}
+	return 2
+}
+
+// pathRank scores path pattern specificity
+func pathRank(path string) int {
+	switch {
+	case path == "" || path == "/*":
+		return 0
+	case strings.HasSuffix(path, "/*"):
+		return 2
+	case strings.HasPrefix(path, "/*"):
+		return 1
+	}
+	return 3
+}
+
+// routeConflicts finds routes that are unreachable in the given match order
+func routeConflicts(routes []*Route) []routeConflict {
+	var conflicts []routeConflict
+
+	for j, b := range routes {
+		for _, a := range routes[:j] {
+			if !routeShadows(a, b) {
+				continue
+			}
+			conflicts = append(conflicts, routeConflict{
+				route:      b,
+				shadowedBy: a,
+				duplicate: a.Host == b.Host && a.Path == b.Path && normalizeMethod(a.Method) == normalizeMethod(b.Method) &&
+					routeShadows(b, a),
+			})
+			break
+		}
+	}
+
+	return conflicts
+}
+
+// routeShadows reports whether route a matches every request route b
+// matches, making b unreachable when a is matched first
+func routeShadows(a, b *Route) bool {
+	// A country list makes a route conditional, so it never fully covers
+	if len(a.GeoIP.Countries) > 0 {
+		return false
+	}
+
+	return hostCovers(a.Host, b.Host) && pathCovers(a.Path, b.Path) && methodCovers(a.Method, b.Method) &&
+		conditionsCover(a.MatchHeaders, b.MatchHeaders, http.CanonicalHeaderKey) &&
+		conditionsCover(a.MatchQuery, b.MatchQuery, nil) &&
+		conditionsCover(a.MatchCookies, b.MatchCookies, nil)
+}
+
+// conditionsCover reports whether conditions a hold for every request that
+// satisfies conditions b: each condition in a must be implied by one in b
+func conditionsCover(a, b map[string]string, canonical func(string) string) bool {
+	if len(a) == 0 {
+		return true
+	}
+
+	normalized := make(map[string]string, len(b))
+	for name, value := range b {
+		if canonical != nil {
+			name = canonical(name)
+		}
+		normalized[name] = value
+	}
+
+	for name, want := range a {
+		if canonical != nil {
+			name = canonical(name)
+		}
+		have, ok := normalized[name]
+		switch {
+		case !ok:
+			return false
+		case want == "*":
+			if have == "!" {
+				return false
+			}
+		case want != have:
+			return false
+		}
+	}
+	return true
+}
+
+// hostCovers reports whether host pattern a matches every host b matches
+func hostCovers(a, b string) bool {
+	switch {
+	case a == "" || a == "*" || a == b:
+		return true
+	case b == "" || b == "*":
+		return false
+	case strings.HasPrefix(a, "*."):
+		suffix := a[1:]
+		if strings.HasPrefix(b, "*.") {
+			return strings.HasSuffix(b[1:], suffix)
+		}
+		return strings.HasSuffix(b, suffix)
+	}
+	return false
+}
+
+// pathCovers reports whether path pattern a matches every path b matches
+func pathCovers(a, b string) bool {
+	switch {
+	case a == "" || a == "/*" || a == b:
+		return true
+	case b == "":
+		return false
+	case strings.HasSuffix(a, "/*"):
+		prefix := strings.TrimSuffix(a, "/*")
+		return strings.HasPrefix(strings.TrimSuffix(b, "/*"), prefix) && !strings.HasPrefix(b, "/*")
+	case strings.HasPrefix(a, "/*"):
+		suffix := strings.TrimPrefix(a, "/*")
+		return !strings.HasSuffix(b, "/*") && strings.HasSuffix(b, suffix)
+	}
+	return false
+}
+
+// methodCovers reports whether method a matches every method b matches
+func methodCovers(a, b string) bool {
+	a, b = normalizeMethod(a), normalizeMethod(b)
+	return a == "*" || a == b
+}
+
+func normalizeMethod(m string) string {
+	if m == "" {
+		return "*"
+	}
+	return m
+}
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSortRoutes(t *testing.T) {
+	routes := []*Route{
+		{Target: "catch-all"},
+		{Path: "/api/*", Target: "api"},
+		{Host: "*.example.com", Target: "wildcard"},
+		{Host: "app.example.com", Target: "app"},
+		{Host: "app.example.com", Path: "/api/*", Target: "app-api"},
+		{Host: "app.example.com", Path: "/api/v1/*", Target: "app-api-v1"},
+		{Host: "app.example.com", Path: "/api/v1/*", Method: "POST", Target: "app-api-v1-post"},
+		{Host: "app.example.com", Path: "/login", Target: "app-login"},
+		{Path: "/*.jpg", Target: "images"},
+		{Target: "pinned", Priority: 10},
+		{Host: "app.example.com", Target: "app-second"},
+	}
+
+	sortRoutes(routes)
+
+	want := []string{
+		"pinned",
+		"app-login",
+		"app-api-v1-post",
+		"app-api-v1",
+		"app-api",
+		"app",
+		"app-second",
+		"wildcard",
+		"api",
+		"images",
+		"catch-all",
+	}
+	for i, route := range routes {
+		if route.Target != want[i] {
+			t.Errorf("routes[%d] = %s, want %s", i, route.Target, want[i])
+		}
+	}
+}
+
+func TestRouterMatchesMostSpecific(t *testing.T) {
+	router := NewRouter()
+	router.AddRoute(&Route{Host: "example.com", Path: "/api/*", Target: "api"})
+	router.AddRoute(&Route{Host: "example.com", Path: "/api/admin/*", Target: "admin"})
+	router.AddRoute(&Route{Host: "*.example.com", Target: "wildcard"})
+	router.AddRoute(&Route{Host: "www.example.com", Target: "www"})
+
+	tests := []struct {
+		host, path string
+		want       string
+	}{
+		{"example.com", "/api/users", "api"},
+		{"example.com", "/api/admin/users", "admin"},
+		{"www.example.com", "/", "www"},
+		{"shop.example.com", "/", "wildcard"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://"+tt.host+tt.path, nil)
+		route := router.match(req)
+		if route == nil || route.Target != tt.want {
+			t.Errorf("match(%s%s) = %v, want %s", tt.host, tt.path, route, tt.want)
+		}
+	}
+}
+
+func TestRouteConflicts(t *testing.T) {
+	routes := []*Route{
+		{Host: "example.com", Path: "/api/*", Target: "a"},
+		{Host: "example.com", Path: "/api/*", Target: "b"},
+		{Path: "/*", Priority: 1, Target: "everything"},
+		{Host: "example.com", Path: "/login", Target: "login"},
+	}
+	sortRoutes(routes)
+
+	conflicts := routeConflicts(routes)
+	if len(conflicts) != 3 {
+		t.Fatalf("got %d conflicts, want 3", len(conflicts))
+	}
+	for _, c := range conflicts {
+		if c.shadowedBy.Target != "everything" {
+			t.Errorf("%s shadowed by %s, want everything", c.route.Target, c.shadowedBy.Target)
+		}
+		if c.duplicate {
+			t.Errorf("%s reported as duplicate", c.route.Target)
+		}
+	}
+
+	conflicts = routeConflicts(routes[1:])
+	if len(conflicts) != 1 || !conflicts[0].duplicate || conflicts[0].route.Target != "b" {
+		t.Errorf("expected b to duplicate a, got %+v", conflicts)
+	}
+}
+
+func TestRouterConditionMatching(t *testing.T) {
+	router := NewRouter()
+	router.AddRoute(&Route{Path: "/api/*", Target: "v1"})
+	router.AddRoute(&Route{Path: "/api/*", Target: "v2", MatchHeaders: map[string]string{"x-api-version": "2"}})
+	router.AddRoute(&Route{Path: "/api/*", Target: "beta", MatchQuery: map[string]string{"beta": "*"}})
+	router.AddRoute(&Route{Path: "/api/*", Target: "tenant", MatchCookies: map[string]string{"tenant": "acme"}})
+	router.AddRoute(&Route{Path: "/api/*", Target: "anonymous", MatchHeaders: map[string]string{"Authorization": "!"}, Method: "POST"})
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		header map[string]string
+		want   string
+	}{
+		{"default", "GET", "/api/users", nil, "v1"},
+		{"header", "GET", "/api/users", map[string]string{"X-Api-Version": "2"}, "v2"},
+		{"header mismatch", "GET", "/api/users", map[string]string{"X-Api-Version": "3"}, "v1"},
+		{"query presence", "GET", "/api/users?beta", nil, "beta"},
+		{"cookie", "GET", "/api/users", map[string]string{"Cookie": "a=b; tenant=acme"}, "tenant"},
+		{"cookie mismatch", "GET", "/api/users", map[string]string{"Cookie": "tenant=other"}, "v1"},
+		{"header absent", "POST", "/api/users", nil, "anonymous"},
+		{"header present", "POST", "/api/users", map[string]string{"Authorization": "Bearer x"}, "v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://example.com"+tt.url, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			route := router.match(req)
+			if route == nil || route.Target != tt.want {
+				t.Errorf("match() = %v, want %s", route, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionsCover(t *testing.T) {
+	conditional := &Route{Path: "/api/*", MatchHeaders: map[string]string{"X-Version": "2"}}
+	narrower := &Route{Path: "/api/*", MatchHeaders: map[string]string{"x-version": "2"}, MatchQuery: map[string]string{"debug": "1"}}
+	plain := &Route{Path: "/api/*"}
+
+	if !routeShadows(conditional, narrower) {
+		t.Error("route with a subset of conditions should shadow")
+	}
+	if routeShadows(narrower, conditional) {
+		t.Error("route with extra conditions should not shadow")
+	}
+	if routeShadows(conditional, plain) {
+		t.Error("conditional route should not shadow an unconditional one")
+	}
+	if !routeShadows(plain, conditional) {
+		t.Error("unconditional route should shadow a conditional one")
+	}
+}
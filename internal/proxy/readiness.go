@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gleicon/ophid/internal/supervisor"
+)
+
+// DefaultSupervisorState is where `ophid supervise` persists process state
+const DefaultSupervisorState = "~/.ophid/supervisor/state.json"
+
+// readinessRefresh is how often the supervisor state is re-read
+const readinessRefresh = time.Second
+
+// ReadinessLookup reports whether a supervised process is ready for traffic
+type ReadinessLookup interface {
+	Ready(name string) bool
+}
+
+// processReadiness reads process readiness from the supervisor's state file
+type processReadiness struct {
+	path    string
+	mu      sync.Mutex
+	checked time.Time
+	ready   map[string]bool
+	failed  bool // Last read failed (logged once until it recovers)
+}
+
+// newProcessReadiness creates a readiness lookup backed by a state file
+func newProcessReadiness(path string) *processReadiness {
+	return &processReadiness{path: path}
+}
+
+// supervisorStatePath returns the configured supervisor state file
+func supervisorStatePath(cfg GeneralConfig) string {
+	if cfg.SupervisorState != "" {
+		return expandHome(cfg.SupervisorState)
+	}
+	return expandHome(DefaultSupervisorState)
+}
+
+// Ready reports whether a process is running and passed its readiness
+// check. The state file is re-read at most once per readinessRefresh, so a
+// restart flips routes within about a second.
+func (p *processReadiness) Ready(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now := time.Now(); now.Sub(p.checked) >= readinessRefresh {
+		p.checked = now
+		p.refresh()
+	}
+	return p.ready[name]
+}
+
+// refresh reloads the state file. Without one no process is ready; an
+// unreadable one keeps the last known state.
+func (p *processReadiness) refresh() {
+	if _, err := os.Stat(p.path); os.IsNotExist(err) {
+		p.ready = nil
+		return
+	}
+
+	states, err := supervisor.LoadState(p.path)
+	if err != nil {
+		if !p.failed {
+			log.Printf("Warning: %v", err)
+		}
+		p.failed = true
+		return
+	}
+	p.failed = false
+
+	ready := make(map[string]bool, len(states))
+	for _, state := range states {
+		ready[state.Name] = state.Status == supervisor.StatusRunning && state.Ready
+	}
+	p.ready = ready
+}
+
+// unavailablePage is served while a route's process is not ready
+const unavailablePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="%d">
+<title>Starting up</title>
+<style>body{font-family:sans-serif;max-width:32em;margin:4em auto;color:#333}</style>
+</head>
+<body>
+<h1>Starting up</h1>
+<p>%s is not ready yet. This page reloads in a few seconds.</p>
+</body>
+</html>
+`
+
+// unavailableRetry is the Retry-After of the unavailable page, in seconds
+const unavailableRetry = 5
+
+// gateReadiness holds requests for a route with a 503 until the supervised
+// process it depends on is ready
+func gateReadiness(readiness ReadinessLookup, process string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if readiness != nil && readiness.Ready(process) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Retry-After", fmt.Sprint(unavailableRetry))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, unavailablePage, unavailableRetry, html.EscapeString(process))
+	})
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gleicon/ophid/internal/supervisor"
+)
+
+func TestReadinessGate(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer backend.Close()
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	writeState := func(states ...supervisor.ProcessState) {
+		t.Helper()
+		data, err := json.Marshal(states)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(statePath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readiness := newProcessReadiness(statePath)
+	router := NewRouter()
+	router.SetReadiness(readiness)
+	route := &Route{Path: "/*", Target: backend.URL, DependsOn: "web"}
+	if err := prepareRoute(route); err != nil {
+		t.Fatal(err)
+	}
+	router.AddRoute(route)
+
+	get := func() *httptest.ResponseRecorder {
+		t.Helper()
+		readiness.checked = time.Time{} // Don't wait for the refresh interval
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec
+	}
+
+	// No supervisor state yet
+	rec := get()
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" || !strings.Contains(rec.Body.String(), "web is not ready") {
+		t.Fatalf("without state: %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	// Running but not yet passing its health check
+	writeState(supervisor.ProcessState{Name: "web", Status: supervisor.StatusRunning})
+	if rec := get(); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("starting: status = %d, want 503", rec.Code)
+	}
+
+	writeState(supervisor.ProcessState{Name: "web", Status: supervisor.StatusRunning, Ready: true})
+	if rec := get(); rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("ready: %d %q", rec.Code, rec.Body.String())
+	}
+
+	// Crashed and waiting to restart
+	writeState(supervisor.ProcessState{Name: "web", Status: supervisor.StatusBackoff, Ready: true})
+	if rec := get(); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("backoff: status = %d, want 503", rec.Code)
+	}
+}
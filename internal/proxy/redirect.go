@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// hstsPreloadMinAge is the minimum max-age accepted by the HSTS preload list
+const hstsPreloadMinAge = 31536000
+
+// validRedirectStatus lists the status codes allowed for HTTP -> HTTPS redirects
+var validRedirectStatus = map[int]bool{
+	http.StatusMovedPermanently:  true,
+	http.StatusFound:             true,
+	http.StatusTemporaryRedirect: true,
+	http.StatusPermanentRedirect: true,
+}
+
+// hstsHeader builds a Strict-Transport-Security value. It returns an empty
+// string when HSTS is not configured or max_age is 0.
+func hstsHeader(cfg *HSTSConfig) (string, error) {
+	if cfg == nil || cfg.MaxAge <= 0 {
+		return "", nil
+	}
+
+	if cfg.Preload && (cfg.MaxAge < hstsPreloadMinAge || !cfg.IncludeSubDomains) {
+		return "", fmt.Errorf("hsts preload requires include_subdomains and max_age >= %d", hstsPreloadMinAge)
+	}
+
+	value := fmt.Sprintf("max-age=%d", cfg.MaxAge)
+	if cfg.IncludeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if cfg.Preload {
+		value += "; preload"
+	}
+
+	return value, nil
+}
+
+// redirectHandler redirects plain HTTP requests to HTTPS, except for ACME
+// challenges and exempt paths, which are served directly
+func (s *Server) redirectHandler(httpsAddr string) http.Handler {
+	// Keep non-default HTTPS ports in the redirect target
+	httpsPort := ""
+	if _, port, err := net.SplitHostPort(httpsAddr); err == nil && port != "443" {
+		httpsPort = port
+	}
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Read per request so reloads apply to the running listener
+		cfg := s.config.Load().TLS
+
+		for _, pattern := range cfg.RedirectExempt {
+			if matchPath(pattern, r.URL.Path) {
+				s.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		host := r.Host
+		if httpsPort != "" {
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		status := cfg.RedirectStatus
+		if status == 0 {
+			status = http.StatusMovedPermanently
+		}
+
+		// Redirect to HTTPS
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, status)
+	})
+
+	// ACME HTTP-01 challenges take precedence; everything else falls through
+	if s.tlsManager != nil {
+		handler = s.tlsManager.HTTPHandler(handler)
+	}
+
+	return handler
+}
+
+// withHSTS adds the Strict-Transport-Security header to HTTPS responses
+func (s *Server) withHSTS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if value := s.tls.hstsFor(r.Host); value != "" {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateRedirect checks the redirect options
+func validateRedirect(cfg TLSConfig) error {
+	if cfg.RedirectStatus != 0 && !validRedirectStatus[cfg.RedirectStatus] {
+		return fmt.Errorf("invalid redirect_status %d (supported: 301, 302, 307, 308)", cfg.RedirectStatus)
+	}
+	for _, pattern := range cfg.RedirectExempt {
+		if !strings.HasPrefix(pattern, "/") {
+			return fmt.Errorf("invalid redirect_exempt pattern %q: must start with /", pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHSTSHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *HSTSConfig
+		want    string
+		wantErr bool
+	}{
+		{"not configured", nil, "", false},
+		{"disabled", &HSTSConfig{MaxAge: 0}, "", false},
+		{"max age", &HSTSConfig{MaxAge: 300}, "max-age=300", false},
+		{"subdomains", &HSTSConfig{MaxAge: 300, IncludeSubDomains: true}, "max-age=300; includeSubDomains", false},
+		{"preload", &HSTSConfig{MaxAge: 63072000, IncludeSubDomains: true, Preload: true}, "max-age=63072000; includeSubDomains; preload", false},
+		{"preload too short", &HSTSConfig{MaxAge: 300, IncludeSubDomains: true, Preload: true}, "", true},
+		{"preload without subdomains", &HSTSConfig{MaxAge: 63072000, Preload: true}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hstsHeader(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("hstsHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("hstsHeader() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	s := &Server{}
+	s.config.Store(&Config{TLS: TLSConfig{
+		RedirectStatus: http.StatusPermanentRedirect,
+		RedirectExempt: []string{"/healthz"},
+	}})
+	s.router.Store(NewRouter())
+	handler := s.redirectHandler(":8443")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "http://example.com/api/items?x=1", nil))
+	if rec.Code != http.StatusPermanentRedirect {
+		t.Errorf("status = %d, want 308", rec.Code)
+	}
+	if got := rec.Header().Get("Location"); got != "https://example.com:8443/api/items?x=1" {
+		t.Errorf("Location = %q", got)
+	}
+
+	// Exempt paths reach the router (no route configured -> 404)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/healthz", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("exempt path status = %d, want 404 from router", rec.Code)
+	}
+}
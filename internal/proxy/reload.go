@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configWatchDelay is how long the watcher waits for changes to settle
+// before reloading, so an editor's or deploy's burst of writes reloads once
+const configWatchDelay = 500 * time.Millisecond
+
+// ErrNoReloader is returned when reloading a proxy that was not started
+// from a config file
+var ErrNoReloader = errors.New("the proxy was not started from a config file")
+
+// ReloadConfig reads the configuration again with the function set by
+// SetReloader and applies it, keeping the routes of the dynamic backend. A
+// configuration that fails to load or validate is rejected, and the current
+// routing table kept.
+func (s *Server) ReloadConfig() error {
+	if s.reloader == nil {
+		return ErrNoReloader
+	}
+	config, err := s.reloader()
+	if err == nil {
+		err = s.Reload(config)
+	}
+	if err != nil {
+		log.Printf("Reload rejected, keeping the current configuration: %v", err)
+		return err
+	}
+	return nil
+}
+
+// SetConfigWatch makes the server reload when a file changes in the
+// directories dirs returns, e.g. ConfigDirs of its config file. dirs is
+// called again after each reload, as includes may have changed. Call it
+// before Start.
+func (s *Server) SetConfigWatch(dirs func() []string) {
+	s.watchDirs = dirs
+}
+
+// reloadOnHangup reloads the configuration on each SIGHUP until ctx is done
+func (s *Server) reloadOnHangup(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Println("Received SIGHUP")
+			s.ReloadConfig()
+		}
+	}
+}
+
+// watchConfig reloads the configuration when TOML files change in the
+// watched directories, until ctx is done
+func (s *Server) watchConfig(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config: %w", err)
+	}
+	defer watcher.Close()
+
+	watched := make(map[string]bool)
+	watch := func() {
+		for _, dir := range s.watchDirs() {
+			if watched[dir] {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				log.Printf("Warning: not watching %s: %v", dir, err)
+				continue
+			}
+			watched[dir] = true
+			log.Printf("Watching %s for config changes", dir)
+		}
+	}
+	watch()
+
+	// Changes are batched: the timer restarts on each one
+	settle := time.NewTimer(configWatchDelay)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Config watcher error: %v", err)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !isConfigFile(event.Name) || event.Op == fsnotify.Chmod {
+				continue
+			}
+			settle.Reset(configWatchDelay)
+		case <-settle.C:
+			log.Println("Config changed")
+			if s.ReloadConfig() == nil {
+				watch()
+			}
+		}
+	}
+}
+
+// isConfigFile reports whether a changed file may be part of a proxy
+// configuration; editors' swap and backup files aren't
+func isConfigFile(path string) bool {
+	name := filepath.Base(path)
+	return filepath.Ext(name) == ".toml" && !strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,257 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestReloadUnderLoad reloads repeatedly while requests are being served.
+// Run with -race to check the router and config swap.
+func TestReloadUnderLoad(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	configFor := func(generation int) *Config {
+		return &Config{
+			General: GeneralConfig{DrainTimeout: "1s"},
+			Routes: []Route{
+				{Host: "app.example.com", Backends: []*Backend{{URLStr: backend.URL}, {URLStr: backend.URL + "/v2"}}},
+				{Host: fmt.Sprintf("gen%d.example.com", generation), Target: backend.URL},
+			},
+		}
+	}
+
+	s, err := NewServer(configFor(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	var failures atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				rec := httptest.NewRecorder()
+				s.ServeHTTP(rec, httptest.NewRequest("GET", "http://app.example.com/", nil))
+				if rec.Code != http.StatusOK {
+					failures.Add(1)
+				}
+				s.BackendStatuses()
+			}
+		}()
+	}
+
+	for generation := 1; generation <= 50; generation++ {
+		if err := s.Reload(configFor(generation)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if n := failures.Load(); n > 0 {
+		t.Errorf("%d requests to a route kept across reloads failed", n)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "http://gen50.example.com/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("route of the last reload got %d", rec.Code)
+	}
+}
+
+func TestReloadTLSPolicies(t *testing.T) {
+	getCert := func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil }
+	state, err := buildTLSState(TLSConfig{Enabled: true}, getCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{tls: state}
+	s.config.Store(&Config{TLS: TLSConfig{Enabled: true}})
+	s.router.Store(NewRouter())
+
+	hello := &tls.ClientHelloInfo{ServerName: "legacy.example.com"}
+	if cfg, _ := state.configForClient(hello); cfg != nil {
+		t.Fatal("no host policy should match before the reload")
+	}
+
+	if err := s.Reload(&Config{TLS: TLSConfig{
+		Enabled:      true,
+		HostPolicies: map[string]TLSPolicy{"legacy.example.com": {MinVersion: "1.2", HSTS: &HSTSConfig{MaxAge: 300}}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _ := state.configForClient(hello)
+	if cfg == nil || cfg.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("reloaded host policy not applied: %+v", cfg)
+	}
+	if got := state.hstsFor("legacy.example.com"); got != "max-age=300" {
+		t.Errorf("hstsFor() = %q, want max-age=300", got)
+	}
+
+	// An invalid policy keeps the current one
+	if err := s.Reload(&Config{TLS: TLSConfig{
+		Enabled:      true,
+		HostPolicies: map[string]TLSPolicy{"legacy.example.com": {MinVersion: "0.9"}},
+	}}); err == nil {
+		t.Fatal("Reload() accepted an invalid host policy")
+	}
+	if cfg, _ := state.configForClient(hello); cfg == nil || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("failed reload replaced the host policy: %+v", cfg)
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "proxy.toml")
+	routes := filepath.Join(dir, "routes")
+	os.Mkdir(routes, 0755)
+	write := func(file, content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(path, "include = [\"routes/*.toml\"]\n")
+	write(filepath.Join(routes, "a.toml"), "[[routes]]\nhost = \"a.example.com\"\ntarget = \"http://127.0.0.1:9\"\n")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetReloader(func() (*Config, error) { return LoadConfig(path) })
+	s.SetConfigWatch(func() []string { return ConfigDirs(path, "") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchConfig(ctx)
+	time.Sleep(100 * time.Millisecond) // Let the watcher start
+
+	hosts := func() string {
+		var routes []string
+		for _, r := range s.RouteStatuses() {
+			routes = append(routes, r.Route)
+		}
+		return strings.Join(routes, ",")
+	}
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(hosts(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("routes = %s, want %s", hosts(), want)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	// A file added to an included directory is picked up
+	write(filepath.Join(routes, "b.toml"), "[[routes]]\nhost = \"b.example.com\"\ntarget = \"http://127.0.0.1:9\"\n")
+	waitFor("b.example.com")
+
+	// A broken file keeps the routing table
+	before := hosts()
+	write(filepath.Join(routes, "b.toml"), "[[routes]\n")
+	time.Sleep(configWatchDelay + 300*time.Millisecond)
+	if got := hosts(); got != before {
+		t.Errorf("routes after a broken config = %s, want %s", got, before)
+	}
+
+	write(filepath.Join(routes, "b.toml"), "[[routes]]\nhost = \"c.example.com\"\ntarget = \"http://127.0.0.1:9\"\n")
+	waitFor("c.example.com")
+}
+
+func TestDynamicRoutesAfterReload(t *testing.T) {
+	static := func(host string) *Config {
+		return &Config{Routes: []Route{{Host: host, Target: "http://127.0.0.1:9"}}}
+	}
+	s, err := NewServer(static("a.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := func() string {
+		var routes []string
+		for _, r := range s.RouteStatuses() {
+			routes = append(routes, r.Route)
+		}
+		return strings.Join(routes, ",")
+	}
+
+	// A dynamic update after a reload builds on the reloaded routes, not
+	// on those the server started with
+	if err := s.Reload(static("b.example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.setDynamicRoutes([]Route{{Host: "dyn.example.com", Target: "http://127.0.0.1:9"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := hosts(); !strings.Contains(got, "b.example.com") || !strings.Contains(got, "dyn.example.com") || strings.Contains(got, "a.example.com") {
+		t.Errorf("routes after a reload and a dynamic update = %s", got)
+	}
+}
+
+func TestReloadKeepsDynamicRoutes(t *testing.T) {
+	static := func(host string) *Config {
+		return &Config{Routes: []Route{{Host: host, Target: "http://127.0.0.1:9"}}}
+	}
+	s, err := NewServer(static("a.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetReloader(func() (*Config, error) { return static("b.example.com"), nil })
+	if err := s.setDynamicRoutes([]Route{{Host: "dyn.example.com", Target: "http://127.0.0.1:9"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	serves := func(host string) bool {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", "http://"+host+"/", nil))
+		return rec.Code != http.StatusNotFound
+	}
+	if err := s.ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if !serves("b.example.com") || !serves("dyn.example.com") {
+		t.Error("a config file reload dropped the dynamic routes")
+	}
+	if err := s.Reload(static("c.example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if !serves("c.example.com") || !serves("dyn.example.com") || serves("b.example.com") {
+		t.Error("Reload() dropped the dynamic routes")
+	}
+
+	// A dynamic update replaces them
+	if err := s.setDynamicRoutes(nil); err != nil {
+		t.Fatal(err)
+	}
+	if serves("dyn.example.com") || !serves("c.example.com") {
+		t.Error("routes the dynamic backend removed are still served")
+	}
+}
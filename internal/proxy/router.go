@@ -4,12 +4,16 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+
+	"github.com/gleicon/ophid/internal/proxy/middleware"
 )
 
 // Router handles request routing to backends
 type Router struct {
-	routes []*Route
-	mu     sync.RWMutex
+	routes    []*Route
+	geoip     middleware.CountryLookup
+	readiness ReadinessLookup
+	mu        sync.RWMutex
 }
 
 // NewRouter creates a new router
@@ -19,11 +23,12 @@ func NewRouter() *Router {
 	}
 }
 
-// AddRoute adds a route to the router
+// AddRoute adds a route to the router, keeping routes in match order
 func (r *Router) AddRoute(route *Route) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.routes = append(r.routes, route)
+	sortRoutes(r.routes)
 }
 
 // RemoveRoute removes a route by host
@@ -39,7 +44,22 @@ func (r *Router) RemoveRoute(host string) {
 	}
 }
 
-// GetRoutes returns all routes
+// SetGeoIP sets the country lookup used by GeoIP route options
+func (r *Router) SetGeoIP(geoip middleware.CountryLookup) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.geoip = geoip
+}
+
+// SetReadiness sets the lookup used by routes that depend on a supervised
+// process
+func (r *Router) SetReadiness(readiness ReadinessLookup) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readiness = readiness
+}
+
+// GetRoutes returns all routes in match order
 func (r *Router) GetRoutes() []*Route {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -61,17 +81,40 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// Build handler
 	handler := r.buildHandler(route)
 
-	// Apply middleware
-	for i := len(route.MiddlewareList) - 1; i >= 0; i-- {
-		// TODO: Build middleware from config
-		// handler = middleware(handler)
+	// Hold requests until the supervised process behind the route is ready
+	if route.DependsOn != "" {
+		handler = gateReadiness(r.readiness, route.DependsOn, handler)
+	}
+
+	// Apply scripted hooks (reject, headers, backend selection)
+	if route.hooks != nil {
+		handler = route.hooks.wrap(route, handler)
+	}
+
+	// Apply GeoIP blocking / country header
+	if geo := route.GeoIP; r.geoip != nil && (len(geo.AllowCountries) > 0 || len(geo.BlockCountries) > 0 || geo.Header != "") {
+		handler = middleware.NewGeoFilter(r.geoip, geo.AllowCountries, geo.BlockCountries, geo.Header).Middleware(handler)
+	}
+
+	// Apply middleware (general chain first, then route entries)
+	for i := len(route.chain) - 1; i >= 0; i-- {
+		handler = route.chain[i](handler)
 	}
 
-	// Execute handler
+	// Record request statistics
+	if route.stats != nil {
+		handler = route.stats.wrap(handler)
+	}
+
+	// Execute handler, tracking in-flight requests for draining
+	if route.drain != nil {
+		route.drain.serve(w, req, handler)
+		return
+	}
 	handler.ServeHTTP(w, req)
 }
 
-// match finds the first matching route for a request
+// match finds the first matching route (in priority order) for a request
 func (r *Router) match(req *http.Request) *Route {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -102,9 +145,94 @@ func (r *Router) matchRoute(route *Route, req *http.Request) bool {
 		return false
 	}
 
+	// Match headers, query parameters and cookies
+	if !matchConditions(route, req) {
+		return false
+	}
+
+	// Match client country
+	if len(route.GeoIP.Countries) > 0 && !r.matchCountry(route.GeoIP.Countries, req) {
+		return false
+	}
+
 	return true
 }
 
+// matchConditions checks a route's header, query and cookie conditions
+func matchConditions(route *Route, req *http.Request) bool {
+	if !matchValues(route.MatchHeaders, func(name string) []string {
+		return req.Header.Values(name)
+	}) {
+		return false
+	}
+
+	if len(route.MatchQuery) > 0 {
+		query := req.URL.Query()
+		if !matchValues(route.MatchQuery, func(name string) []string {
+			return query[name]
+		}) {
+			return false
+		}
+	}
+
+	return matchValues(route.MatchCookies, func(name string) []string {
+		var values []string
+		for _, cookie := range req.Cookies() {
+			if cookie.Name == name {
+				values = append(values, cookie.Value)
+			}
+		}
+		return values
+	})
+}
+
+// matchValues checks conditions against the values lookup returns: "*"
+// requires at least one value, "!" requires none, anything else must equal
+// one of the values
+func matchValues(conditions map[string]string, lookup func(name string) []string) bool {
+	for name, want := range conditions {
+		values := lookup(name)
+		switch want {
+		case "*":
+			if len(values) == 0 {
+				return false
+			}
+		case "!":
+			if len(values) > 0 {
+				return false
+			}
+		default:
+			found := false
+			for _, v := range values {
+				if v == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchCountry checks if the client country is one of codes. Routes with a
+// country list never match when no GeoIP database is configured.
+func (r *Router) matchCountry(codes []string, req *http.Request) bool {
+	if r.geoip == nil {
+		return false
+	}
+
+	country := r.geoip.Country(req)
+	for _, code := range codes {
+		if strings.EqualFold(code, country) {
+			return true
+		}
+	}
+	return false
+}
+
 // buildHandler builds the appropriate handler for a route
 func (r *Router) buildHandler(route *Route) http.Handler {
 	if route.Static {
@@ -112,7 +240,7 @@ func (r *Router) buildHandler(route *Route) http.Handler {
 	}
 
 	if route.WebSocket {
-		return &WebSocketProxy{route: route}
+		return NewWebSocketProxy(route)
 	}
 
 	return NewHTTPProxy(route)
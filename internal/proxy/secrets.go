@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gleicon/ophid/internal/secrets"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// zeroSSLDirectory is ZeroSSL's ACME directory
+const zeroSSLDirectory = "https://acme.zerossl.com/v2/DV90"
+
+// ExpandSecrets resolves the {{secret:name}} references of the settings
+// that hold credentials: the ACME external account binding, the dynamic
+// backend token, admin API tokens, log sink headers and route headers.
+// Resolved values stay in memory only.
+func (c *Config) ExpandSecrets(lookup secrets.Lookup) error {
+	var firstErr error
+	expand := func(field string, value *string) {
+		expanded, err := secrets.Expand(*value, lookup)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", field, err)
+		}
+		*value = expanded
+	}
+	expandMap := func(field string, values map[string]string) {
+		for k, v := range values {
+			expand(field+"."+k, &v)
+			values[k] = v
+		}
+	}
+
+	expand("tls.acme_eab_kid", &c.TLS.ACMEEABKeyID)
+	expand("tls.acme_eab_hmac_key", &c.TLS.ACMEEABHMACKey)
+	expand("dynamic.token", &c.Dynamic.Token)
+	for i := range c.General.AdminTokens {
+		expand(fmt.Sprintf("admin_tokens[%d].token", i), &c.General.AdminTokens[i].Token)
+	}
+	for i := range c.General.AccessLogSinks {
+		expandMap(fmt.Sprintf("access_log_sinks[%d].headers", i), c.General.AccessLogSinks[i].Headers)
+	}
+	for i := range c.General.ErrorLogSinks {
+		expandMap(fmt.Sprintf("error_log_sinks[%d].headers", i), c.General.ErrorLogSinks[i].Headers)
+	}
+	for i := range c.Routes {
+		expandMap(fmt.Sprintf("routes[%d].add_headers", i), c.Routes[i].AddHeaders)
+	}
+	return firstErr
+}
+
+// configureACME points an ACME manager at the configured CA and sets its
+// external account binding
+func configureACME(m *autocert.Manager, cfg TLSConfig) error {
+	if cfg.ACMEProvider == "zerossl" {
+		m.Client = &acme.Client{DirectoryURL: zeroSSLDirectory}
+	}
+
+	eab, err := externalAccountBinding(cfg)
+	if err != nil {
+		return err
+	}
+	m.ExternalAccountBinding = eab
+	return nil
+}
+
+// externalAccountBinding returns the configured ACME external account
+// binding, or nil when there is none
+func externalAccountBinding(cfg TLSConfig) (*acme.ExternalAccountBinding, error) {
+	if cfg.ACMEEABKeyID == "" && cfg.ACMEEABHMACKey == "" {
+		return nil, nil
+	}
+	if cfg.ACMEEABKeyID == "" || cfg.ACMEEABHMACKey == "" {
+		return nil, errors.New("acme_eab_kid and acme_eab_hmac_key must be set together")
+	}
+	if secrets.HasRefs(cfg.ACMEEABHMACKey) {
+		return nil, errors.New("acme_eab_hmac_key references a secret that wasn't resolved")
+	}
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cfg.ACMEEABHMACKey, "="))
+	if err != nil {
+		return nil, fmt.Errorf("acme_eab_hmac_key is not base64url: %w", err)
+	}
+	return &acme.ExternalAccountBinding{KID: cfg.ACMEEABKeyID, Key: key}, nil
+}
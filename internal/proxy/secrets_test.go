@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConfigExpandSecrets(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+[general]
+access_log_sinks = [{type = "http", url = "https://logs.example.com", headers = {Authorization = "Bearer {{secret:logs}}"}}]
+admin_tokens = [{name = "deploy", token = "{{secret:admin}}", role = "operator"}]
+
+[tls]
+enabled = true
+acme_provider = "zerossl"
+acme_eab_kid = "kid-1"
+acme_eab_hmac_key = "{{secret:zerossl-hmac}}"
+
+[dynamic]
+token = "{{secret:consul}}"
+
+[[routes]]
+target = "http://localhost:3000"
+add_headers = {X-Api-Key = "{{secret:api}}", X-Plain = "plain"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]string{"logs": "l0gs", "zerossl-hmac": "aG1hYy1rZXk", "consul": "c0nsul", "api": "ap1", "admin": "adm1n"}
+	lookup := func(name string) (string, error) {
+		if v, ok := values[name]; ok {
+			return v, nil
+		}
+		return "", errors.New("not found")
+	}
+	if err := config.ExpandSecrets(lookup); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.General.AccessLogSinks[0].Headers["Authorization"]; got != "Bearer l0gs" {
+		t.Errorf("sink header = %q", got)
+	}
+	if config.TLS.ACMEEABHMACKey != "aG1hYy1rZXk" || config.Dynamic.Token != "c0nsul" {
+		t.Errorf("tls = %+v, dynamic = %+v", config.TLS, config.Dynamic)
+	}
+	if got := config.General.AdminTokens[0].Token; got != "adm1n" {
+		t.Errorf("admin token = %q", got)
+	}
+	if h := config.Routes[0].AddHeaders; h["X-Api-Key"] != "ap1" || h["X-Plain"] != "plain" {
+		t.Errorf("route headers = %v", h)
+	}
+
+	eab, err := externalAccountBinding(config.TLS)
+	if err != nil || eab.KID != "kid-1" || string(eab.Key) != "hmac-key" {
+		t.Errorf("externalAccountBinding = %+v, %v", eab, err)
+	}
+
+	config.Dynamic.Token = "{{secret:missing}}"
+	if err := config.ExpandSecrets(lookup); err == nil || !strings.Contains(err.Error(), "dynamic.token") {
+		t.Errorf("ExpandSecrets with a missing secret = %v", err)
+	}
+}
+
+func TestExternalAccountBinding(t *testing.T) {
+	for _, tc := range []struct {
+		kid, key string
+		ok       bool
+	}{
+		{"", "", true},
+		{"kid", "", false},
+		{"kid", "{{secret:hmac}}", false},
+		{"kid", "not base64!", false},
+		{"kid", "aG1hYy1rZXk=", true},
+	} {
+		_, err := externalAccountBinding(TLSConfig{ACMEEABKeyID: tc.kid, ACMEEABHMACKey: tc.key})
+		if (err == nil) != tc.ok {
+			t.Errorf("externalAccountBinding(%q, %q) = %v", tc.kid, tc.key, err)
+		}
+	}
+}
@@ -4,21 +4,50 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gleicon/ophid/internal/proxy/egress"
+	"github.com/gleicon/ophid/internal/proxy/localca"
+	"github.com/gleicon/ophid/internal/proxy/middleware"
 	"golang.org/x/crypto/acme/autocert"
 )
 
 // Server is the main HTTP/HTTPS reverse proxy server
 type Server struct {
-	config      *Config
-	router      *Router
+	config      atomic.Pointer[Config]
+	router      atomic.Pointer[Router]
 	tlsManager  *autocert.Manager
+	renewer     *certRenewer
+	renewalMgr  atomic.Pointer[autocert.Manager] // Manager of the renewal in progress
 	httpServer  *http.Server
 	httpsServer *http.Server
+	adminServer *http.Server
+	cancel      context.CancelFunc
+	accessSinks []*logSink
+	errorSinks  []*logSink
+	geoip       *middleware.GeoIP
+	tls         *tlsState
+	egress      *egress.Proxy
+	drains      *drainRegistry
+	readiness   *processReadiness
+	health      healthChecks // Active backend health checks
+	reloadMu    sync.Mutex
+	static      *Config                 // Configuration dynamic routes are added to; guarded by reloadMu
+	dynamic     []Route                 // Latest routes of the dynamic backend; guarded by reloadMu
+	metrics     []func(io.Writer)       // Extra metrics for the admin API
+	reloader    func() (*Config, error) // Configuration for admin API, SIGHUP and watched reloads
+	watchDirs   func() []string         // Directories whose changes trigger a reload
+	auditMu     sync.Mutex
+	stopped     chan struct{} // Closed when Shutdown completes
+	stopOnce    sync.Once
 }
 
 // NewServer creates a new proxy server
@@ -26,83 +55,350 @@ func NewServer(config *Config) (*Server, error) {
 	// Create router and add routes
 	router := NewRouter()
 	for i := range config.Routes {
-		// Parse backend URLs
-		for j := range config.Routes[i].Backends {
-			backend := config.Routes[i].Backends[j]
-			if backend.URLStr != "" && backend.URL == nil {
-				parsedURL, err := parseBackendURL(backend.URLStr)
-				if err != nil {
-					return nil, fmt.Errorf("invalid backend URL %s: %w", backend.URLStr, err)
-				}
-				backend.URL = parsedURL
-			}
+		if err := prepareRoute(&config.Routes[i]); err != nil {
+			return nil, err
+		}
+		if err := prepareChain(&config.Routes[i], config.General.Middleware); err != nil {
+			return nil, err
 		}
 		router.AddRoute(&config.Routes[i])
 	}
+	logRouteConflicts(router.GetRoutes())
+	logInsecureBackends(router.GetRoutes())
 
 	server := &Server{
-		config: config,
-		router: router,
+		drains:    newDrainRegistry(config.General.DrainCloseConnections),
+		readiness: newProcessReadiness(supervisorStatePath(config.General)),
+		static:    config,
+		stopped:   make(chan struct{}),
+	}
+	router.SetReadiness(server.readiness)
+	server.config.Store(config)
+	server.router.Store(router)
+
+	if _, err := drainTimeout(config); err != nil {
+		return nil, err
+	}
+
+	// Open GeoIP database for country routing/blocking
+	if err := server.setupGeoIP(); err != nil {
+		return nil, err
+	}
+
+	// Open access/error log sinks
+	if err := server.openLogSinks(); err != nil {
+		return nil, err
+	}
+
+	// Outbound proxy for managed tools
+	if config.Egress.Listen != "" || config.Egress.SOCKSListen != "" {
+		egressProxy, err := NewEgressProxy(config.Egress)
+		if err != nil {
+			return nil, err
+		}
+		server.egress = egressProxy
 	}
 
 	// Setup TLS if enabled
 	if config.TLS.Enabled {
-		server.setupTLS()
+		if err := server.setupTLS(); err != nil {
+			return nil, err
+		}
 	}
 
 	return server, nil
 }
 
-// setupTLS configures TLS with Let's Encrypt
-func (s *Server) setupTLS() {
-	cacheDir := s.config.TLS.CacheDir
-	if cacheDir == "" {
-		cacheDir = ".ophid/certs"
+// prepareRoute parses backend URLs and slow start, loads backend TLS
+// options, compiles hooks and sets up health checks, outlier detection and
+// drain tracking for a route
+func prepareRoute(route *Route) error {
+	for _, backend := range route.Backends {
+		if backend.URLStr != "" && backend.URL == nil {
+			parsedURL, err := parseBackendURL(backend.URLStr)
+			if err != nil {
+				return fmt.Errorf("invalid backend URL %s: %w", backend.URLStr, err)
+			}
+			backend.URL = parsedURL
+		}
+		if backend.Health == nil {
+			backend.Health = newHealth()
+		}
+		if backend.drain == nil {
+			backend.drain = newDrainTracker()
+		}
+	}
+
+	if route.drain == nil {
+		route.drain = newDrainTracker()
+	}
+	if route.stats == nil {
+		route.stats = newRouteStats()
+	}
+
+	if route.LoadBalance.SlowStart != "" {
+		d, err := time.ParseDuration(route.LoadBalance.SlowStart)
+		if err != nil {
+			return fmt.Errorf("route %s%s: invalid slow_start %q: %w", route.Host, route.Path, route.LoadBalance.SlowStart, err)
+		}
+		route.slowStart = d
 	}
 
-	s.tlsManager = &autocert.Manager{
-		Prompt:     autocert.AcceptTOS,
-		Email:      s.config.TLS.ACMEEmail,
-		HostPolicy: autocert.HostWhitelist(s.config.TLS.Domains...),
-		Cache:      autocert.DirCache(cacheDir),
+	if err := validateUpstream(route); err != nil {
+		return fmt.Errorf("route %s%s: %w", route.Host, route.Path, err)
 	}
+	if err := prepareBackendTLS(route); err != nil {
+		return fmt.Errorf("route %s%s: %w", route.Host, route.Path, err)
+	}
+
+	if route.Hooks != nil && route.hooks == nil {
+		hooks, err := compileHooks(route.Hooks)
+		if err != nil {
+			return fmt.Errorf("route %s%s: %w", route.Host, route.Path, err)
+		}
+		route.hooks = hooks
+	}
+
+	if route.LoadBalance.HealthCheck != "" && len(route.Backends) > 0 {
+		health, err := newHealthChecker(route, route.LoadBalance)
+		if err != nil {
+			return fmt.Errorf("route %s%s: %w", route.Host, route.Path, err)
+		}
+		route.health = health
+	} else {
+		// Only health checks mark backends unhealthy; without them, backends
+		// carried over from a reload are back in the pool
+		for _, backend := range route.Backends {
+			if backend.Health.GetStatus() == HealthStatusUnhealthy {
+				backend.Health.SetStatus(HealthStatusHealthy)
+			}
+		}
+	}
+
+	if route.LoadBalance.Outlier != nil && len(route.Backends) > 1 && route.outliers == nil {
+		outliers, err := newOutlierDetector(route, route.LoadBalance.Outlier)
+		if err != nil {
+			return fmt.Errorf("route %s%s: %w", route.Host, route.Path, err)
+		}
+		route.outliers = outliers
+	}
+
+	return nil
+}
+
+// prepareChain builds a route's middleware from the general chain and the
+// route's overrides
+func prepareChain(route *Route, general []MiddlewareConfig) error {
+	chain, err := buildChain(general, route)
+	if err != nil {
+		return fmt.Errorf("route %s%s: %w", route.Host, route.Path, err)
+	}
+	route.chain = chain
+	return nil
+}
+
+// setupGeoIP opens the GeoIP database and attaches it to the router
+func (s *Server) setupGeoIP() error {
+	cfg := s.config.Load()
+	if cfg.General.GeoIPDatabase == "" {
+		for _, route := range cfg.Routes {
+			geo := route.GeoIP
+			if len(geo.Countries) > 0 || len(geo.AllowCountries) > 0 || len(geo.BlockCountries) > 0 || geo.Header != "" {
+				return fmt.Errorf("route %s%s uses geoip options but general.geoip_database is not set", route.Host, route.Path)
+			}
+		}
+		return nil
+	}
+
+	geoip, err := middleware.NewGeoIP(expandHome(cfg.General.GeoIPDatabase), cfg.General.GeoIPTrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	s.geoip = geoip
+	s.router.Load().SetGeoIP(geoip)
+	return nil
+}
+
+// setupTLS configures TLS with Let's Encrypt, or with a static certificate
+// when tls.cert_file is set, and applies the configured TLS policies
+func (s *Server) setupTLS() error {
+	cfg := s.config.Load().TLS
+	var getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	if cfg.CertFile == "" && cfg.ACMEProvider == "local" {
+		ca, err := localca.LoadOrCreate(s.localCADir())
+		if err != nil {
+			return err
+		}
+		domains := cfg.Domains
+		if len(domains) == 0 {
+			domains = localca.DefaultDomains
+		}
+		log.Printf("Using local development CA %s for %s", ca.CertPath, strings.Join(domains, ", "))
+		getCertificate = ca.GetCertificateFunc(domains)
+	} else if cfg.CertFile == "" {
+		s.tlsManager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Email:      cfg.ACMEEmail,
+			HostPolicy: s.acmeHostPolicy,
+			Cache:      autocert.DirCache(acmeCacheDir(cfg)),
+		}
+		if err := configureACME(s.tlsManager, cfg); err != nil {
+			return fmt.Errorf("invalid TLS configuration: %w", err)
+		}
+		if err := s.setupRenewal(cfg); err != nil {
+			return fmt.Errorf("invalid TLS configuration: %w", err)
+		}
+		getCertificate = s.acmeCertificate
+	}
+
+	if err := validateRedirect(cfg); err != nil {
+		return fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+
+	state, err := buildTLSState(cfg, getCertificate)
+	if err != nil {
+		return fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+	s.tls = state
+
+	return nil
+}
+
+// acmeHostPolicy allows certificates for the currently configured domains,
+// so domains added on reload are served without a restart
+func (s *Server) acmeHostPolicy(ctx context.Context, host string) error {
+	return autocert.HostWhitelist(s.config.Load().TLS.Domains...)(ctx, host)
+}
+
+// localCADir returns the development CA directory
+func (s *Server) localCADir() string {
+	if dir := s.config.Load().TLS.LocalCADir; dir != "" {
+		return expandHome(dir)
+	}
+	return expandHome(DefaultLocalCADir)
+}
+
+// startTLSMaintenance starts session ticket rotation, OCSP stapling and
+// ACME certificate renewal
+func (s *Server) startTLSMaintenance(ctx context.Context) error {
+	cfg := s.config.Load().TLS
+
+	if cfg.SessionTicketRotation != "" && !s.tls.base.SessionTicketsDisabled {
+		interval, err := time.ParseDuration(cfg.SessionTicketRotation)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid session_ticket_rotation %q", cfg.SessionTicketRotation)
+		}
+		go s.tls.rotateSessionTickets(ctx, interval)
+	}
+
+	if cfg.OCSPStapling {
+		if s.tls.static == nil {
+			log.Printf("OCSP stapling requires tls.cert_file; ignoring for ACME certificates")
+		} else {
+			go s.tls.stapleOCSP(ctx)
+		}
+	}
+
+	if s.renewer != nil {
+		go s.renewer.run(ctx)
+	}
+
+	return nil
 }
 
 // Start starts the proxy server
 func (s *Server) Start() error {
+	cfg := s.config.Load()
+
 	// Determine listen addresses
 	httpAddr := ":80"
 	httpsAddr := ":443"
 
-	if len(s.config.General.Listen) > 0 {
-		httpAddr = s.config.General.Listen[0]
+	if len(cfg.General.Listen) > 0 {
+		httpAddr = cfg.General.Listen[0]
+	}
+	if len(cfg.General.Listen) > 1 {
+		httpsAddr = cfg.General.Listen[1]
+	}
+
+	// Send proxy error output to the configured error log sinks
+	s.redirectErrorLog()
+
+	// Background tasks run until Shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	// Rotate session tickets / staple OCSP / renew certificates
+	if s.tls != nil {
+		if err := s.startTLSMaintenance(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Start the egress proxy if configured
+	if s.egress != nil {
+		if err := StartEgress(s.egress, cfg.Egress); err != nil {
+			return err
+		}
+	}
+
+	// Probe the backends of routes with health checks
+	s.health.start(ctx, s.router.Load().GetRoutes())
+
+	// Watch dynamic routes if a config backend is configured
+	if cfg.Dynamic.Backend != "" {
+		go func() {
+			if err := s.WatchDynamicRoutes(ctx); err != nil && err != context.Canceled {
+				log.Printf("Dynamic route watcher stopped: %v", err)
+			}
+		}()
 	}
-	if len(s.config.General.Listen) > 1 {
-		httpsAddr = s.config.General.Listen[1]
+
+	// Reload the config file on SIGHUP, and when it changes if watched
+	if s.reloader != nil {
+		go s.reloadOnHangup(ctx)
+		if s.watchDirs != nil {
+			go func() {
+				if err := s.watchConfig(ctx); err != nil && err != context.Canceled {
+					log.Printf("Config watcher stopped: %v", err)
+				}
+			}()
+		}
+	}
+
+	// Admin API (backend state, metrics)
+	if cfg.General.AdminListen != "" {
+		go s.startAdmin(cfg.General.AdminListen)
 	}
 
 	// Start HTTP server
-	if s.config.TLS.Enabled && s.config.TLS.AutoRedirect {
+	if cfg.TLS.Enabled && cfg.TLS.AutoRedirect {
 		// Redirect HTTP to HTTPS
-		go s.startHTTPRedirect(httpAddr)
+		go s.startHTTPRedirect(httpAddr, httpsAddr)
 	} else {
 		go s.startHTTP(httpAddr)
 	}
 
 	// Start HTTPS server if TLS is enabled
-	if s.config.TLS.Enabled {
-		return s.startHTTPS(httpsAddr)
+	if cfg.TLS.Enabled {
+		if err := s.startHTTPS(httpsAddr); err != nil {
+			return err
+		}
 	}
 
-	// If no TLS, keep HTTP server running
-	select {}
+	// Run until Shutdown
+	<-s.stopped
+	return nil
 }
 
 // startHTTP starts the HTTP server
 func (s *Server) startHTTP(addr string) error {
 	s.httpServer = &http.Server{
 		Addr:         addr,
-		Handler:      s.router,
+		Handler:      s.handlerFor(addr, s),
+		ErrorLog:     s.errorLogFor(addr),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  120 * time.Second,
@@ -118,25 +414,11 @@ func (s *Server) startHTTP(addr string) error {
 }
 
 // startHTTPRedirect starts HTTP server that redirects to HTTPS
-func (s *Server) startHTTPRedirect(addr string) error {
-	// Create redirect handler that also handles ACME challenges
-	redirectHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if it's an ACME challenge
-		if s.tlsManager != nil {
-			if h := s.tlsManager.HTTPHandler(nil); h != nil {
-				h.ServeHTTP(w, r)
-				return
-			}
-		}
-
-		// Redirect to HTTPS
-		target := "https://" + r.Host + r.RequestURI
-		http.Redirect(w, r, target, http.StatusMovedPermanently)
-	})
-
+func (s *Server) startHTTPRedirect(addr, httpsAddr string) error {
 	s.httpServer = &http.Server{
 		Addr:         addr,
-		Handler:      redirectHandler,
+		Handler:      s.handlerFor(addr, s.redirectHandler(httpsAddr)),
+		ErrorLog:     s.errorLogFor(addr),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
@@ -152,15 +434,12 @@ func (s *Server) startHTTPRedirect(addr string) error {
 
 // startHTTPS starts the HTTPS server
 func (s *Server) startHTTPS(addr string) error {
-	tlsConfig := &tls.Config{
-		GetCertificate: s.tlsManager.GetCertificate,
-		NextProtos:     []string{"h2", "http/1.1"}, // HTTP/2 support
-		MinVersion:     tls.VersionTLS12,
-	}
+	tlsConfig := s.tls.base
 
 	s.httpsServer = &http.Server{
 		Addr:         addr,
-		Handler:      s.router,
+		Handler:      s.handlerFor(addr, s.withHSTS(s)),
+		ErrorLog:     s.errorLogFor(addr),
 		TLSConfig:    tlsConfig,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
@@ -176,9 +455,24 @@ func (s *Server) startHTTPS(addr string) error {
 	return nil
 }
 
+// ServeHTTP implements http.Handler by dispatching to the current router
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.Load().ServeHTTP(w, r)
+}
+
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
 	log.Println("Shutting down proxy server...")
+	// Start returns once shutdown is over
+	defer s.stopOnce.Do(func() {
+		if s.stopped != nil {
+			close(s.stopped)
+		}
+	})
+
+	if s.cancel != nil {
+		s.cancel()
+	}
 
 	errChan := make(chan error, 2)
 
@@ -211,39 +505,228 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		return err2
 	}
 
+	if s.adminServer != nil {
+		s.adminServer.Shutdown(ctx)
+	}
+
+	if s.egress != nil {
+		s.egress.Shutdown(ctx)
+	}
+
+	s.closeLogSinks()
+
+	if s.geoip != nil {
+		s.geoip.Close()
+	}
+
 	log.Println("Proxy server shutdown complete")
 	return nil
 }
 
-// Reload reloads the configuration without downtime
+// Reload reloads the configuration without downtime. Routes of the
+// dynamic backend are kept until it changes them.
 func (s *Server) Reload(newConfig *Config) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.apply(newConfig, s.dynamic)
+}
+
+// setDynamicRoutes routes with new dynamic routes on top of the current
+// static configuration, so reloads since the watch started are kept
+func (s *Server) setDynamicRoutes(routes []Route) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.apply(s.static, routes)
+}
+
+// apply swaps in a static configuration with dynamic routes appended to
+// its own. Callers hold reloadMu.
+func (s *Server) apply(static *Config, dynamic []Route) error {
 	log.Println("Reloading proxy configuration...")
 
+	config := *static
+	config.Routes = append(append([]Route{}, static.Routes...), dynamic...)
+	newConfig := &config
+
+	// Backends that stay in the pool keep their health state (and so are not
+	// slow-started again)
+	carryBackendHealth(s.router.Load().GetRoutes(), newConfig.Routes)
+
+	// Unchanged routes keep their traffic statistics
+	carryRouteStats(s.router.Load().GetRoutes(), newConfig.Routes)
+
 	// Create new router with new routes
 	newRouter := NewRouter()
 	for i := range newConfig.Routes {
-		// Parse backend URLs
-		for j := range newConfig.Routes[i].Backends {
-			backend := newConfig.Routes[i].Backends[j]
-			if backend.URLStr != "" && backend.URL == nil {
-				parsedURL, err := parseBackendURL(backend.URLStr)
-				if err != nil {
-					return fmt.Errorf("invalid backend URL %s: %w", backend.URLStr, err)
-				}
-				backend.URL = parsedURL
-			}
+		if err := prepareRoute(&newConfig.Routes[i]); err != nil {
+			return err
+		}
+		if err := prepareChain(&newConfig.Routes[i], newConfig.General.Middleware); err != nil {
+			return err
 		}
 		newRouter.AddRoute(&newConfig.Routes[i])
 	}
+	logRouteConflicts(newRouter.GetRoutes())
+	logInsecureBackends(newRouter.GetRoutes())
+
+	if s.geoip != nil {
+		newRouter.SetGeoIP(s.geoip)
+	}
+	if path := supervisorStatePath(newConfig.General); s.readiness == nil || path != s.readiness.path {
+		s.readiness = newProcessReadiness(path)
+	}
+	newRouter.SetReadiness(s.readiness)
+
+	timeout, err := drainTimeout(newConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := s.reloadTLS(newConfig.TLS); err != nil {
+		return err
+	}
+
+	// Atomically swap routers; requests already dispatched finish on the old one
+	oldRouter := s.router.Swap(newRouter)
+	s.config.Store(newConfig)
+	s.static, s.dynamic = static, dynamic
+	s.health.replace(newRouter.GetRoutes())
 
-	// Atomically swap routers
-	s.router = newRouter
-	s.config = newConfig
+	// Removed routes and backends finish their in-flight requests
+	s.drains.drainRemoved(oldRouter.GetRoutes(), newConfig.Routes, timeout)
 
 	log.Println("Configuration reloaded successfully")
 	return nil
 }
 
+// reloadTLS applies the host policies and HSTS values of a new TLS
+// configuration. Listener-level settings only change on restart.
+func (s *Server) reloadTLS(cfg TLSConfig) error {
+	old := s.config.Load().TLS
+	if s.tls == nil || !cfg.Enabled {
+		if cfg.Enabled != old.Enabled {
+			log.Printf("Warning: enabling or disabling TLS requires a restart")
+		}
+		return nil
+	}
+
+	if err := validateRedirect(cfg); err != nil {
+		return fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+	if err := s.tls.updatePolicies(cfg); err != nil {
+		return fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+
+	// HSTS is applied per request and so reloads with the host policies
+	listener, oldListener := cfg.TLSPolicy, old.TLSPolicy
+	listener.HSTS, oldListener.HSTS = nil, nil
+	if cfg.CertFile != old.CertFile || cfg.KeyFile != old.KeyFile || cfg.ACMEProvider != old.ACMEProvider || cfg.RenewBefore != old.RenewBefore ||
+		!reflect.DeepEqual(listener, oldListener) {
+		log.Printf("Warning: TLS certificate and listener policy changes require a restart; host policies were reloaded")
+	}
+	return nil
+}
+
+// WatchDynamicRoutes watches the configured dynamic backend and reloads the
+// router whenever its routes change. Routes from the static configuration,
+// as last reloaded, are kept and win over dynamic routes of equal priority
+// and specificity.
+func (s *Server) WatchDynamicRoutes(ctx context.Context) error {
+	cfg := s.config.Load().Dynamic
+	source, err := NewRouteSource(cfg)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Watching %s at %s for dynamic routes (prefix %q)",
+		cfg.Backend, cfg.Address, cfg.Prefix)
+
+	return source.Watch(ctx, func(routes []Route) error {
+		log.Printf("Applying %d dynamic route(s) from %s", len(routes), cfg.Backend)
+		return s.setDynamicRoutes(routes)
+	})
+}
+
+// drainTimeout returns the configured drain timeout
+func drainTimeout(config *Config) (time.Duration, error) {
+	if config.General.DrainTimeout == "" {
+		return defaultDrainTimeout, nil
+	}
+
+	d, err := time.ParseDuration(config.General.DrainTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid drain_timeout %q: %w", config.General.DrainTimeout, err)
+	}
+	return d, nil
+}
+
+// carryBackendHealth reuses the health state of backends that appear with
+// the same URL on a route with the same match criteria
+func carryBackendHealth(oldRoutes []*Route, newRoutes []Route) {
+	health := make(map[string]*Health)
+	for _, route := range oldRoutes {
+		for _, backend := range route.Backends {
+			if backend.Health != nil {
+				health[describeRoute(route)+" "+backend.URLStr] = backend.Health
+			}
+		}
+	}
+
+	for i := range newRoutes {
+		route := &newRoutes[i]
+		for _, backend := range route.Backends {
+			if h, ok := health[describeRoute(route)+" "+backend.URLStr]; ok && backend.Health == nil {
+				backend.Health = h
+			}
+		}
+	}
+}
+
+// carryRouteStats moves the statistics of routes that stay in the
+// configuration to the new routes
+func carryRouteStats(oldRoutes []*Route, newRoutes []Route) {
+	stats := make(map[string]*routeStats)
+	for _, route := range oldRoutes {
+		if route.stats != nil {
+			stats[describeRoute(route)] = route.stats
+		}
+	}
+
+	for i := range newRoutes {
+		route := &newRoutes[i]
+		if rs, ok := stats[describeRoute(route)]; ok && route.stats == nil {
+			route.stats = rs
+		}
+	}
+}
+
+// logRouteConflicts warns about routes that can never match
+func logRouteConflicts(routes []*Route) {
+	for _, c := range routeConflicts(routes) {
+		if c.duplicate {
+			log.Printf("Warning: route %s is a duplicate of an earlier route and will never match", describeRoute(c.route))
+		} else {
+			log.Printf("Warning: route %s is unreachable: shadowed by %s", describeRoute(c.route), describeRoute(c.shadowedBy))
+		}
+	}
+}
+
+// describeRoute formats a route's match criteria for log messages
+func describeRoute(route *Route) string {
+	host := route.Host
+	if host == "" {
+		host = "*"
+	}
+	desc := host + route.Path
+	if m := normalizeMethod(route.Method); m != "*" {
+		desc += " [" + m + "]"
+	}
+	if route.Priority != 0 {
+		desc += fmt.Sprintf(" (priority %d)", route.Priority)
+	}
+	return desc
+}
+
 // parseBackendURL parses a backend URL string
 func parseBackendURL(urlStr string) (*url.URL, error) {
 	parsedURL, err := url.Parse(urlStr)
@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// statsBuckets is the number of one-second buckets kept per route, enough
+// for the longest status window (5m)
+const statsBuckets = 300
+
+// Histogram bucket upper bounds
+var (
+	latencyBounds = [...]float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10} // Seconds
+	sizeBounds    = [...]float64{100, 1000, 10000, 100000, 1e6, 1e7, 1e8}                                // Bytes
+)
+
+// routeStats keeps live request statistics for a route: per-second buckets
+// for the status windows and cumulative histograms for /metrics
+type routeStats struct {
+	buckets  [statsBuckets]statsBucket
+	requests uint64
+	errors   uint64
+	duration histogram
+	reqSize  histogram
+	respSize histogram
+	mu       sync.Mutex
+}
+
+// statsBucket aggregates the requests finished in one second
+type statsBucket struct {
+	second   int64
+	requests int64
+	errors   int64
+	bytesIn  int64
+	bytesOut int64
+	latency  [len(latencyBounds) + 1]uint64 // Counts per latencyBounds bucket, plus overflow
+}
+
+// RouteWindowStats summarizes a route's requests over a time window
+type RouteWindowStats struct {
+	Requests   int64   `json:"requests"`
+	RPS        float64 `json:"rps"`
+	ErrorRate  float64 `json:"error_rate"` // Fraction of 5xx responses
+	LatencyP50 float64 `json:"latency_p50_seconds"`
+	LatencyP95 float64 `json:"latency_p95_seconds"`
+	BytesIn    int64   `json:"bytes_in"`
+	BytesOut   int64   `json:"bytes_out"`
+}
+
+// RouteStatus describes a route's live traffic in admin API responses
+type RouteStatus struct {
+	Route       string           `json:"route"`
+	Active      int64            `json:"active"` // In-flight requests
+	OneMinute   RouteWindowStats `json:"1m"`
+	FiveMinutes RouteWindowStats `json:"5m"`
+}
+
+// newRouteStats creates empty route statistics
+func newRouteStats() *routeStats {
+	return &routeStats{
+		duration: newHistogram(latencyBounds[:]),
+		reqSize:  newHistogram(sizeBounds[:]),
+		respSize: newHistogram(sizeBounds[:]),
+	}
+}
+
+// record adds a finished request
+func (rs *routeStats) record(now time.Time, status int, bytesIn, bytesOut int64, latency time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	failed := status >= 500
+
+	second := now.Unix()
+	b := &rs.buckets[second%statsBuckets]
+	if b.second != second {
+		*b = statsBucket{second: second}
+	}
+	b.requests++
+	if failed {
+		b.errors++
+	}
+	b.bytesIn += bytesIn
+	b.bytesOut += bytesOut
+	b.latency[bucketIndex(latencyBounds[:], latency.Seconds())]++
+
+	rs.requests++
+	if failed {
+		rs.errors++
+	}
+	rs.duration.observe(latency.Seconds())
+	rs.reqSize.observe(float64(bytesIn))
+	rs.respSize.observe(float64(bytesOut))
+}
+
+// window summarizes the requests finished in the last d (at most 5m)
+func (rs *routeStats) window(now time.Time, d time.Duration) RouteWindowStats {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	seconds := int64(d / time.Second)
+	if seconds > statsBuckets {
+		seconds = statsBuckets
+	}
+
+	var stats RouteWindowStats
+	var errors int64
+	var latency [len(latencyBounds) + 1]uint64
+	current := now.Unix()
+	for i := range rs.buckets {
+		b := &rs.buckets[i]
+		if b.requests == 0 || current-b.second >= seconds || b.second > current {
+			continue
+		}
+		stats.Requests += b.requests
+		errors += b.errors
+		stats.BytesIn += b.bytesIn
+		stats.BytesOut += b.bytesOut
+		for j, n := range b.latency {
+			latency[j] += n
+		}
+	}
+
+	if stats.Requests > 0 {
+		stats.RPS = float64(stats.Requests) / float64(seconds)
+		stats.ErrorRate = float64(errors) / float64(stats.Requests)
+		stats.LatencyP50 = bucketQuantile(latencyBounds[:], latency[:], 0.5)
+		stats.LatencyP95 = bucketQuantile(latencyBounds[:], latency[:], 0.95)
+	}
+	return stats
+}
+
+// wrap records the requests next handles
+func (rs *routeStats) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+		sw := &statsResponseWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		rs.record(time.Now(), status, body.n, sw.bytes, time.Since(start))
+	})
+}
+
+// countingReader counts request body bytes read by the handler
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// statsResponseWriter captures the status and response body size
+type statsResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statsResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statsResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush supports streaming responses
+func (w *statsResponseWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statsResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// histogram is a cumulative histogram with fixed bucket bounds
+type histogram struct {
+	bounds []float64
+	counts []uint64 // Per bucket, plus overflow
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	h.counts[bucketIndex(h.bounds, v)]++
+	h.sum += v
+	h.count++
+}
+
+// clone returns a copy that does not share bucket counts
+func (h *histogram) clone() histogram {
+	c := *h
+	c.counts = append([]uint64(nil), h.counts...)
+	return c
+}
+
+// bucketIndex returns the bucket of v: the first bound >= v, or the
+// overflow bucket
+func bucketIndex(bounds []float64, v float64) int {
+	for i, bound := range bounds {
+		if v <= bound {
+			return i
+		}
+	}
+	return len(bounds)
+}
+
+// bucketQuantile estimates the q-th quantile (0-1) from bucket counts,
+// interpolating linearly inside the bucket. Values in the overflow bucket
+// are reported as the largest bound.
+func bucketQuantile(bounds []float64, counts []uint64, q float64) float64 {
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := q * float64(total)
+	var seen uint64
+	for i, n := range counts {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		if i == len(bounds) {
+			return bounds[len(bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = bounds[i-1]
+		}
+		return lower + (bounds[i]-lower)*(rank-float64(seen))/float64(n)
+	}
+	return bounds[len(bounds)-1]
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteStatsWindows(t *testing.T) {
+	rs := newRouteStats()
+	now := time.Unix(1_700_000_000, 0)
+
+	// 10 minutes ago: outside both windows
+	rs.record(now.Add(-10*time.Minute), 200, 1, 1, time.Second)
+
+	// 3 minutes ago: only in the 5m window
+	for i := 0; i < 30; i++ {
+		rs.record(now.Add(-3*time.Minute), 500, 100, 1000, 40*time.Millisecond)
+	}
+
+	// Last minute: 60 requests, 6 errors
+	for i := 0; i < 60; i++ {
+		status := 200
+		if i%10 == 0 {
+			status = 502
+		}
+		rs.record(now.Add(-time.Duration(i)*time.Second), status, 10, 2000, 8*time.Millisecond)
+	}
+
+	m1 := rs.window(now, time.Minute)
+	if m1.Requests != 60 || m1.RPS != 1 || math.Abs(m1.ErrorRate-0.1) > 1e-9 {
+		t.Errorf("1m window = %+v, want 60 requests, 1 rps, 10%% errors", m1)
+	}
+	if m1.BytesIn != 600 || m1.BytesOut != 120000 {
+		t.Errorf("1m bytes = %d/%d, want 600/120000", m1.BytesIn, m1.BytesOut)
+	}
+	if m1.LatencyP50 <= 0.005 || m1.LatencyP50 > 0.01 || m1.LatencyP95 > 0.01 {
+		t.Errorf("1m latency p50/p95 = %g/%g, want within the 5-10ms bucket", m1.LatencyP50, m1.LatencyP95)
+	}
+
+	m5 := rs.window(now, 5*time.Minute)
+	if m5.Requests != 90 || math.Abs(m5.ErrorRate-36.0/90) > 1e-9 {
+		t.Errorf("5m window = %+v, want 90 requests, 40%% errors", m5)
+	}
+	if m5.LatencyP95 <= 0.025 || m5.LatencyP95 > 0.05 {
+		t.Errorf("5m p95 = %g, want within the 25-50ms bucket", m5.LatencyP95)
+	}
+}
+
+func TestBucketQuantile(t *testing.T) {
+	bounds := []float64{1, 2, 4}
+
+	tests := []struct {
+		counts []uint64
+		q      float64
+		want   float64
+	}{
+		{[]uint64{0, 0, 0, 0}, 0.5, 0},
+		{[]uint64{10, 0, 0, 0}, 0.5, 0.5},
+		{[]uint64{0, 10, 0, 0}, 0.5, 1.5},
+		{[]uint64{5, 0, 5, 0}, 0.9, 3.6},
+		{[]uint64{0, 0, 0, 4}, 0.5, 4},
+	}
+
+	for _, tt := range tests {
+		if got := bucketQuantile(bounds, tt.counts, tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("bucketQuantile(%v, %g) = %g, want %g", tt.counts, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestRouteStatsRecordedByRouter(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer backend.Close()
+
+	s, err := NewServer(&Config{Routes: []Route{{Host: "app.example.com", Target: backend.URL}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("POST", "http://app.example.com/", strings.NewReader("payload")))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d", rec.Code)
+		}
+	}
+
+	// Statistics survive a reload that keeps the route
+	if err := s.Reload(&Config{Routes: []Route{{Host: "app.example.com", Target: backend.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := s.RouteStatuses()
+	if len(statuses) != 1 {
+		t.Fatalf("RouteStatuses() = %+v", statuses)
+	}
+	m1 := statuses[0].OneMinute
+	if m1.Requests != 3 || m1.BytesIn != 21 || m1.BytesOut != 15 || m1.ErrorRate != 0 {
+		t.Errorf("1m window = %+v, want 3 requests, 21 bytes in, 15 bytes out", m1)
+	}
+
+	rec := httptest.NewRecorder()
+	s.adminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`ophid_proxy_route_requests_total{route="app.example.com"} 3`,
+		`ophid_proxy_route_request_size_bytes_bucket{route="app.example.com",le="100"} 3`,
+		`ophid_proxy_route_response_size_bytes_sum{route="app.example.com"} 15`,
+		`ophid_proxy_route_request_duration_seconds_count{route="app.example.com"} 3`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// sessionTicketKeysKept is how many old ticket keys still decrypt
+	// tickets after a rotation
+	sessionTicketKeysKept = 3
+
+	// ocspRefreshFallback is used when a response has no NextUpdate
+	ocspRefreshFallback = 12 * time.Hour
+
+	// ocspRetryDelay is the wait after a failed OCSP fetch
+	ocspRetryDelay = 5 * time.Minute
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519":         tls.X25519,
+	"X25519MLKEM768": tls.X25519MLKEM768,
+	"P256":           tls.CurveP256,
+	"P384":           tls.CurveP384,
+	"P521":           tls.CurveP521,
+}
+
+var tlsClientAuth = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// tlsState holds the HTTPS listener's TLS configuration and the background
+// state it depends on (static certificate, session ticket keys)
+type tlsState struct {
+	base       *tls.Config
+	challenge  *tls.Config // Answers ACME tls-alpn-01 challenges
+	policies   atomic.Pointer[tlsPolicies]
+	staticMu   sync.RWMutex
+	static     *tls.Certificate
+	ticketMu   sync.Mutex
+	ticketKeys [][32]byte
+}
+
+// tlsPolicies are the per-host TLS configurations and HSTS values, swapped
+// as a whole on reload
+type tlsPolicies struct {
+	hsts  string
+	hosts []hostTLSConfig
+}
+
+// hostTLSConfig is a TLS configuration selected by SNI host pattern
+type hostTLSConfig struct {
+	pattern string
+	config  *tls.Config
+	hsts    string
+}
+
+// buildTLSState builds the HTTPS listener configuration from the TLS config.
+// getCertificate is used when no static certificate is configured.
+func buildTLSState(cfg TLSConfig, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*tlsState, error) {
+	state := &tlsState{}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(expandHome(cfg.CertFile), expandHome(cfg.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		state.static = &cert
+		getCertificate = state.getStaticCertificate
+	}
+
+	if getCertificate == nil {
+		return nil, fmt.Errorf("no certificate source: set tls.cert_file/key_file or enable ACME")
+	}
+
+	base, err := buildTLSPolicy(cfg.TLSPolicy)
+	if err != nil {
+		return nil, err
+	}
+	base.GetCertificate = getCertificate
+	base.GetConfigForClient = state.configForClient
+	state.base = base
+
+	// tls-alpn-01 challenges negotiate only acme-tls/1, which the listener
+	// policy does not advertise
+	state.challenge = base.Clone()
+	state.challenge.NextProtos = []string{acme.ALPNProto}
+	state.challenge.GetConfigForClient = nil
+
+	policies, err := buildTLSPolicies(cfg, getCertificate)
+	if err != nil {
+		return nil, err
+	}
+	state.policies.Store(policies)
+
+	return state, nil
+}
+
+// buildTLSPolicies builds the host policies and HSTS values of the TLS config
+func buildTLSPolicies(cfg TLSConfig, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*tlsPolicies, error) {
+	policies := &tlsPolicies{}
+
+	var err error
+	if policies.hsts, err = hstsHeader(cfg.HSTS); err != nil {
+		return nil, err
+	}
+
+	// Host policies inherit every field they don't set from the listener policy
+	for pattern, policy := range cfg.HostPolicies {
+		merged := mergeTLSPolicy(cfg.TLSPolicy, policy)
+		hostConfig, err := buildTLSPolicy(merged)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS policy for %s: %w", pattern, err)
+		}
+		hostConfig.GetCertificate = getCertificate
+
+		hsts, err := hstsHeader(merged.HSTS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS policy for %s: %w", pattern, err)
+		}
+
+		policies.hosts = append(policies.hosts, hostTLSConfig{pattern: pattern, config: hostConfig, hsts: hsts})
+	}
+
+	// Exact hosts before wildcards, more specific wildcards first
+	sort.Slice(policies.hosts, func(i, j int) bool {
+		wi := strings.HasPrefix(policies.hosts[i].pattern, "*")
+		wj := strings.HasPrefix(policies.hosts[j].pattern, "*")
+		if wi != wj {
+			return !wi
+		}
+		return len(policies.hosts[i].pattern) > len(policies.hosts[j].pattern)
+	})
+
+	return policies, nil
+}
+
+// updatePolicies replaces the host policies and HSTS values with those of
+// cfg. Handshakes in progress keep the configuration they selected; the
+// listener policy and certificate source are fixed at startup.
+func (ts *tlsState) updatePolicies(cfg TLSConfig) error {
+	policies, err := buildTLSPolicies(cfg, ts.base.GetCertificate)
+	if err != nil {
+		return err
+	}
+
+	// New host configurations share the current session ticket keys so
+	// existing tickets stay valid
+	ts.ticketMu.Lock()
+	defer ts.ticketMu.Unlock()
+	if len(ts.ticketKeys) > 0 {
+		for _, host := range policies.hosts {
+			host.config.SetSessionTicketKeys(ts.ticketKeys)
+		}
+	}
+	ts.policies.Store(policies)
+
+	return nil
+}
+
+// buildTLSPolicy converts a policy into a tls.Config
+func buildTLSPolicy(policy TLSPolicy) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"}, // HTTP/2 support
+	}
+
+	if policy.MinVersion != "" {
+		version, ok := tlsVersions[policy.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown min_version: %s (supported: 1.0, 1.1, 1.2, 1.3)", policy.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if policy.MaxVersion != "" {
+		version, ok := tlsVersions[policy.MaxVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown max_version: %s (supported: 1.0, 1.1, 1.2, 1.3)", policy.MaxVersion)
+		}
+		if version < config.MinVersion {
+			return nil, fmt.Errorf("max_version %s is lower than min_version", policy.MaxVersion)
+		}
+		config.MaxVersion = version
+	}
+
+	if len(policy.CipherSuites) > 0 {
+		suites, err := parseCipherSuites(policy.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		config.CipherSuites = suites
+	}
+
+	for _, name := range policy.CurvePreferences {
+		curve, ok := tlsCurves[strings.ToUpper(strings.ReplaceAll(name, "-", ""))]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve: %s", name)
+		}
+		config.CurvePreferences = append(config.CurvePreferences, curve)
+	}
+
+	if len(policy.ALPN) > 0 {
+		config.NextProtos = policy.ALPN
+	}
+
+	if policy.SessionTickets != nil && !*policy.SessionTickets {
+		config.SessionTicketsDisabled = true
+	}
+
+	if policy.ClientAuth != "" {
+		clientAuth, ok := tlsClientAuth[policy.ClientAuth]
+		if !ok {
+			return nil, fmt.Errorf("unknown client_auth: %s", policy.ClientAuth)
+		}
+		config.ClientAuth = clientAuth
+	}
+
+	if policy.ClientCAFile != "" {
+		data, err := os.ReadFile(expandHome(policy.ClientCAFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", policy.ClientCAFile)
+		}
+		config.ClientCAs = pool
+	} else if config.ClientAuth == tls.VerifyClientCertIfGiven || config.ClientAuth == tls.RequireAndVerifyClientCert {
+		return nil, fmt.Errorf("client_auth %s requires client_ca_file", policy.ClientAuth)
+	}
+
+	return config, nil
+}
+
+// parseCipherSuites resolves cipher suite names. Suites Go considers
+// insecure are accepted but logged, since some baselines still need them.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]*tls.CipherSuite)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		known[suite.Name] = suite
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		suite, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite: %s", name)
+		}
+		if suite.Insecure {
+			log.Printf("Warning: cipher suite %s is considered insecure", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+
+	return ids, nil
+}
+
+// mergeTLSPolicy overlays the non-empty fields of override onto base
+func mergeTLSPolicy(base, override TLSPolicy) TLSPolicy {
+	merged := base
+	if override.MinVersion != "" {
+		merged.MinVersion = override.MinVersion
+	}
+	if override.MaxVersion != "" {
+		merged.MaxVersion = override.MaxVersion
+	}
+	if len(override.CipherSuites) > 0 {
+		merged.CipherSuites = override.CipherSuites
+	}
+	if len(override.CurvePreferences) > 0 {
+		merged.CurvePreferences = override.CurvePreferences
+	}
+	if len(override.ALPN) > 0 {
+		merged.ALPN = override.ALPN
+	}
+	if override.SessionTickets != nil {
+		merged.SessionTickets = override.SessionTickets
+	}
+	if override.ClientAuth != "" {
+		merged.ClientAuth = override.ClientAuth
+	}
+	if override.ClientCAFile != "" {
+		merged.ClientCAFile = override.ClientCAFile
+	}
+	if override.HSTS != nil {
+		merged.HSTS = override.HSTS
+	}
+	return merged
+}
+
+// configForClient selects a host policy by SNI, falling back to the
+// listener policy
+func (ts *tlsState) configForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	if isACMEChallenge(hello) {
+		return ts.challenge, nil
+	}
+	for _, host := range ts.policies.Load().hosts {
+		if matchHost(host.pattern, hello.ServerName) {
+			return host.config, nil
+		}
+	}
+	return nil, nil
+}
+
+// hstsFor returns the Strict-Transport-Security value for a request host
+func (ts *tlsState) hstsFor(host string) string {
+	policies := ts.policies.Load()
+	for _, h := range policies.hosts {
+		if matchHost(h.pattern, host) {
+			return h.hsts
+		}
+	}
+	return policies.hsts
+}
+
+// getStaticCertificate returns the static certificate with its current
+// OCSP staple
+func (ts *tlsState) getStaticCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	ts.staticMu.RLock()
+	defer ts.staticMu.RUnlock()
+	return ts.static, nil
+}
+
+// rotateSessionTickets replaces the session ticket key every interval,
+// keeping a few previous keys so recently issued tickets stay valid
+func (ts *tlsState) rotateSessionTickets(ctx context.Context, interval time.Duration) {
+	for {
+		var key [32]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			log.Printf("Failed to generate session ticket key: %v", err)
+		} else {
+			ts.ticketMu.Lock()
+			ts.ticketKeys = append([][32]byte{key}, ts.ticketKeys...)
+			if len(ts.ticketKeys) > sessionTicketKeysKept {
+				ts.ticketKeys = ts.ticketKeys[:sessionTicketKeysKept]
+			}
+			ts.base.SetSessionTicketKeys(ts.ticketKeys)
+			for _, host := range ts.policies.Load().hosts {
+				host.config.SetSessionTicketKeys(ts.ticketKeys)
+			}
+			ts.ticketMu.Unlock()
+		}
+
+		if !sleepContext(ctx, interval) {
+			return
+		}
+	}
+}
+
+// stapleOCSP keeps the static certificate's OCSP staple fresh
+func (ts *tlsState) stapleOCSP(ctx context.Context) {
+	for {
+		next := ocspRefreshFallback
+
+		staple, nextUpdate, err := fetchOCSP(ctx, ts.static)
+		if err != nil {
+			log.Printf("OCSP stapling: %v", err)
+			next = ocspRetryDelay
+		} else {
+			ts.staticMu.Lock()
+			cert := *ts.static
+			cert.OCSPStaple = staple
+			ts.static = &cert
+			ts.staticMu.Unlock()
+
+			// Refresh halfway to NextUpdate
+			if !nextUpdate.IsZero() {
+				if half := time.Until(nextUpdate) / 2; half > time.Minute {
+					next = half
+				}
+			}
+		}
+
+		if !sleepContext(ctx, next) {
+			return
+		}
+	}
+}
+
+// fetchOCSP requests a fresh OCSP response for a certificate chain
+func fetchOCSP(ctx context.Context, cert *tls.Certificate) ([]byte, time.Time, error) {
+	if len(cert.Certificate) < 2 {
+		return nil, time.Time{}, fmt.Errorf("certificate chain has no issuer")
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse issuer: %w", err)
+	}
+	if len(leaf.OCSPServer) == 0 {
+		return nil, time.Time{}, fmt.Errorf("certificate has no OCSP responder")
+	}
+
+	reqBytes, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to create OCSP request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", leaf.OCSPServer[0], bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("OCSP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("OCSP responder returned status %d", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read OCSP response: %w", err)
+	}
+
+	parsed, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid OCSP response: %w", err)
+	}
+	if parsed.Status != ocsp.Good {
+		return nil, time.Time{}, fmt.Errorf("certificate OCSP status is not good (%d)", parsed.Status)
+	}
+
+	return raw, parsed.NextUpdate, nil
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestParseTLSPolicyConfig(t *testing.T) {
+	data := []byte(`
+[tls]
+enabled = true
+min_version = "1.3"
+curve_preferences = ["X25519", "P-256"]
+alpn = ["http/1.1"]
+
+[tls.host_policies."legacy.example.com"]
+min_version = "1.2"
+cipher_suites = ["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"]
+`)
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+
+	if config.TLS.MinVersion != "1.3" {
+		t.Errorf("MinVersion = %q, want 1.3", config.TLS.MinVersion)
+	}
+
+	getCert := func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil }
+	state, err := buildTLSState(config.TLS, getCert)
+	if err != nil {
+		t.Fatalf("buildTLSState() error = %v", err)
+	}
+
+	if state.base.MinVersion != tls.VersionTLS13 {
+		t.Errorf("base MinVersion = %x, want TLS 1.3", state.base.MinVersion)
+	}
+	if len(state.base.CurvePreferences) != 2 || state.base.CurvePreferences[1] != tls.CurveP256 {
+		t.Errorf("base CurvePreferences = %v", state.base.CurvePreferences)
+	}
+
+	legacy, _ := state.configForClient(&tls.ClientHelloInfo{ServerName: "legacy.example.com"})
+	if legacy == nil || legacy.MinVersion != tls.VersionTLS12 || len(legacy.CipherSuites) != 1 {
+		t.Fatalf("legacy host policy not applied: %+v", legacy)
+	}
+	if len(legacy.NextProtos) != 1 || legacy.NextProtos[0] != "http/1.1" {
+		t.Errorf("host policy should inherit alpn, got %v", legacy.NextProtos)
+	}
+
+	if other, _ := state.configForClient(&tls.ClientHelloInfo{ServerName: "www.example.com"}); other != nil {
+		t.Errorf("unmatched host should use the listener policy")
+	}
+}
+
+func TestBuildTLSPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy TLSPolicy
+	}{
+		{"unknown version", TLSPolicy{MinVersion: "1.4"}},
+		{"max below min", TLSPolicy{MinVersion: "1.3", MaxVersion: "1.2"}},
+		{"unknown cipher", TLSPolicy{CipherSuites: []string{"TLS_NOPE"}}},
+		{"unknown curve", TLSPolicy{CurvePreferences: []string{"P192"}}},
+		{"unknown client auth", TLSPolicy{ClientAuth: "maybe"}},
+		{"verify without CA", TLSPolicy{ClientAuth: "require_and_verify"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildTLSPolicy(tt.policy); err == nil {
+				t.Errorf("buildTLSPolicy() expected error")
+			}
+		})
+	}
+}
@@ -11,10 +11,10 @@ import (
 type LoadBalanceStrategy string
 
 const (
-	StrategyRoundRobin  LoadBalanceStrategy = "round-robin"
-	StrategyLeastConn   LoadBalanceStrategy = "least-conn"
-	StrategyIPHash      LoadBalanceStrategy = "ip-hash"
-	StrategyWeighted    LoadBalanceStrategy = "weighted"
+	StrategyRoundRobin LoadBalanceStrategy = "round-robin"
+	StrategyLeastConn  LoadBalanceStrategy = "least-conn"
+	StrategyIPHash     LoadBalanceStrategy = "ip-hash"
+	StrategyWeighted   LoadBalanceStrategy = "weighted"
 )
 
 // HealthStatus represents backend health status
@@ -28,80 +28,296 @@ const (
 
 // Config is the main proxy configuration
 type Config struct {
-	General GeneralConfig `json:"general"`
-	TLS     TLSConfig     `json:"tls"`
-	Routes  []Route       `json:"routes"`
+	Include []string      `json:"include,omitempty" toml:"include"` // Config snippets merged by LoadConfig (e.g., "routes.d/*.toml")
+	General GeneralConfig `json:"general" toml:"general"`
+	TLS     TLSConfig     `json:"tls" toml:"tls"`
+	Routes  []Route       `json:"routes" toml:"routes"`
+	Dynamic DynamicConfig `json:"dynamic" toml:"dynamic"`
+	Egress  EgressConfig  `json:"egress" toml:"egress"`
 }
 
 // GeneralConfig contains general proxy settings
 type GeneralConfig struct {
-	Listen    []string `json:"listen"`     // Listen addresses, e.g., ["0.0.0.0:80", "0.0.0.0:443"]
-	AccessLog string   `json:"access_log"` // Access log path
-	ErrorLog  string   `json:"error_log"`  // Error log path
+	Listen    []string `json:"listen" toml:"listen"`         // Listen addresses, e.g., ["0.0.0.0:80", "0.0.0.0:443"]
+	AccessLog string   `json:"access_log" toml:"access_log"` // Access log path
+	ErrorLog  string   `json:"error_log" toml:"error_log"`   // Error log path
+
+	AccessLogFormat string          `json:"access_log_format,omitempty" toml:"access_log_format"` // "text" (default) or "json"
+	AccessLogSinks  []LogSinkConfig `json:"access_log_sinks,omitempty" toml:"access_log_sinks"`
+	ErrorLogSinks   []LogSinkConfig `json:"error_log_sinks,omitempty" toml:"error_log_sinks"`
+
+	GeoIPDatabase       string   `json:"geoip_database,omitempty" toml:"geoip_database"`               // MaxMind .mmdb path (e.g., GeoLite2-Country.mmdb)
+	GeoIPTrustedProxies []string `json:"geoip_trusted_proxies,omitempty" toml:"geoip_trusted_proxies"` // Proxy IPs/CIDRs whose X-Forwarded-For/X-Real-IP name the client
+
+	AdminListen   string       `json:"admin_listen,omitempty" toml:"admin_listen"`       // Admin API address (e.g., "127.0.0.1:9901"); disabled when empty
+	AdminTokens   []AdminToken `json:"admin_tokens,omitempty" toml:"admin_tokens"`       // Bearer tokens the admin API requires; without any, only local clients may change state
+	AdminAuditLog string       `json:"admin_audit_log,omitempty" toml:"admin_audit_log"` // JSON lines of admin API changes and refused requests
+
+	DrainTimeout          string `json:"drain_timeout,omitempty" toml:"drain_timeout"`                     // How long removed routes/backends finish in-flight requests (default "30s")
+	DrainCloseConnections bool   `json:"drain_close_connections,omitempty" toml:"drain_close_connections"` // Send "Connection: close" on responses of draining requests
+
+	Middleware []MiddlewareConfig `json:"middleware,omitempty" toml:"middleware"` // Chain applied to every route
+
+	SupervisorState string `json:"supervisor_state,omitempty" toml:"supervisor_state"` // Process state read for depends_on (default "~/.ophid/supervisor/state.json")
+}
+
+// AdminToken grants a role on the admin API
+type AdminToken struct {
+	Name  string `json:"name" toml:"name"`   // Who holds it, recorded in the audit log
+	Token string `json:"token" toml:"token"` // Bearer token; use "{{secret:name}}"
+	Role  string `json:"role" toml:"role"`   // "read-only", "operator" or "admin"
+}
+
+// LogSinkConfig configures a destination for access or error logs
+type LogSinkConfig struct {
+	Type      string   `json:"type" toml:"type"`                     // "file", "syslog", "http"
+	Listeners []string `json:"listeners,omitempty" toml:"listeners"` // Listen addresses this sink applies to (empty = all)
+
+	// File sink
+	Path       string `json:"path,omitempty" toml:"path"`
+	MaxSizeMB  int    `json:"max_size_mb,omitempty" toml:"max_size_mb"` // Rotate after this size (0 = never)
+	MaxBackups int    `json:"max_backups,omitempty" toml:"max_backups"` // Rotated files to keep
+
+	// Syslog sink (RFC5424)
+	Network  string `json:"network,omitempty" toml:"network"`   // "udp" (default), "tcp", "unix", "unixgram"
+	Address  string `json:"address,omitempty" toml:"address"`   // e.g., "10.0.0.5:514"
+	Facility string `json:"facility,omitempty" toml:"facility"` // e.g., "local0"
+	Tag      string `json:"tag,omitempty" toml:"tag"`           // APP-NAME field (default "ophid-proxy")
+
+	// HTTP bulk sink
+	URL           string            `json:"url,omitempty" toml:"url"`
+	Headers       map[string]string `json:"headers,omitempty" toml:"headers"`
+	ContentType   string            `json:"content_type,omitempty" toml:"content_type"`
+	BatchSize     int               `json:"batch_size,omitempty" toml:"batch_size"`
+	FlushInterval string            `json:"flush_interval,omitempty" toml:"flush_interval"` // e.g., "5s"
 }
 
 // TLSConfig contains TLS/ACME configuration
 type TLSConfig struct {
-	Enabled      bool     `json:"enabled"`
-	AutoRedirect bool     `json:"auto_redirect"` // HTTP -> HTTPS redirect
-	ACMEProvider string   `json:"acme_provider"` // "letsencrypt", "zerossl"
-	ACMEEmail    string   `json:"acme_email"`
-	CacheDir     string   `json:"cache_dir"`
-	Domains      []string `json:"domains"`
+	Enabled      bool     `json:"enabled" toml:"enabled"`
+	AutoRedirect bool     `json:"auto_redirect" toml:"auto_redirect"` // HTTP -> HTTPS redirect
+	ACMEProvider string   `json:"acme_provider" toml:"acme_provider"` // "letsencrypt", "zerossl", or "local" (development CA)
+	ACMEEmail    string   `json:"acme_email" toml:"acme_email"`
+	CacheDir     string   `json:"cache_dir" toml:"cache_dir"`
+	Domains      []string `json:"domains" toml:"domains"`
+
+	LocalCADir string `json:"local_ca_dir,omitempty" toml:"local_ca_dir"` // Development CA directory (default ~/.ophid/ca)
+
+	// ACME external account binding, required by zerossl. The HMAC key is
+	// base64url encoded; keep it in the secrets store: "{{secret:name}}"
+	ACMEEABKeyID   string `json:"acme_eab_kid,omitempty" toml:"acme_eab_kid"`
+	ACMEEABHMACKey string `json:"acme_eab_hmac_key,omitempty" toml:"acme_eab_hmac_key"`
+
+	// Static certificate (used instead of ACME when set)
+	CertFile     string `json:"cert_file,omitempty" toml:"cert_file"`
+	KeyFile      string `json:"key_file,omitempty" toml:"key_file"`
+	OCSPStapling bool   `json:"ocsp_stapling,omitempty" toml:"ocsp_stapling"` // Staple OCSP responses for cert_file
+
+	SessionTicketRotation string `json:"session_ticket_rotation,omitempty" toml:"session_ticket_rotation"` // Ticket key rotation interval (e.g., "12h")
+
+	// Background renewal of ACME certificates
+	RenewBefore    string `json:"renew_before,omitempty" toml:"renew_before"`       // Renew this long before expiry (default "720h")
+	RenewalWebhook string `json:"renewal_webhook,omitempty" toml:"renewal_webhook"` // URL notified (POST, JSON) when a renewal fails
+
+	// HTTP -> HTTPS redirect options (auto_redirect)
+	RedirectStatus int      `json:"redirect_status,omitempty" toml:"redirect_status"` // 301 (default), 302, 307 or 308 (308/307 preserve the method)
+	RedirectExempt []string `json:"redirect_exempt,omitempty" toml:"redirect_exempt"` // Path patterns served over plain HTTP (e.g., "/healthz")
+
+	// Policy for the HTTPS listener, optionally overridden per SNI host
+	TLSPolicy
+	HostPolicies map[string]TLSPolicy `json:"host_policies,omitempty" toml:"host_policies"` // Keyed by host pattern (e.g., "api.example.com", "*.example.com")
+}
+
+// TLSPolicy tunes TLS handshakes. Empty fields keep the defaults.
+type TLSPolicy struct {
+	MinVersion       string   `json:"min_version,omitempty" toml:"min_version"`             // "1.0", "1.1", "1.2" (default), "1.3"
+	MaxVersion       string   `json:"max_version,omitempty" toml:"max_version"`             // Defaults to the highest supported
+	CipherSuites     []string `json:"cipher_suites,omitempty" toml:"cipher_suites"`         // TLS 1.0-1.2 suites (e.g., "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	CurvePreferences []string `json:"curve_preferences,omitempty" toml:"curve_preferences"` // e.g., "X25519", "P256", "P384", "X25519MLKEM768"
+	ALPN             []string `json:"alpn,omitempty" toml:"alpn"`                           // Defaults to ["h2", "http/1.1"]
+
+	SessionTickets *bool `json:"session_tickets,omitempty" toml:"session_tickets"` // Set to false to disable resumption tickets
+
+	ClientAuth   string `json:"client_auth,omitempty" toml:"client_auth"`       // "none", "request", "require", "verify_if_given", "require_and_verify"
+	ClientCAFile string `json:"client_ca_file,omitempty" toml:"client_ca_file"` // PEM bundle used to verify client certificates
+
+	HSTS *HSTSConfig `json:"hsts,omitempty" toml:"hsts"` // Strict-Transport-Security for HTTPS responses
+}
+
+// HSTSConfig configures the Strict-Transport-Security header
+type HSTSConfig struct {
+	MaxAge            int  `json:"max_age" toml:"max_age"` // Seconds; 0 disables the header
+	IncludeSubDomains bool `json:"include_subdomains,omitempty" toml:"include_subdomains"`
+	Preload           bool `json:"preload,omitempty" toml:"preload"`
+}
+
+// DynamicConfig configures an external key/value store that supplies
+// additional routes at runtime (Consul KV or etcd v3)
+type DynamicConfig struct {
+	Backend  string `json:"backend" toml:"backend"`               // "consul", "etcd" or empty to disable
+	Address  string `json:"address" toml:"address"`               // e.g., "http://127.0.0.1:8500"
+	Prefix   string `json:"prefix" toml:"prefix"`                 // Key prefix holding one JSON route per key
+	Token    string `json:"token,omitempty" toml:"token"`         // ACL token (Consul) or bearer token (etcd)
+	WaitTime string `json:"wait_time,omitempty" toml:"wait_time"` // Blocking query / retry interval (e.g., "5m")
+}
+
+// EgressConfig configures the outbound (forward) proxy for managed tools
+type EgressConfig struct {
+	Listen       string   `json:"listen,omitempty" toml:"listen"`               // HTTP/CONNECT proxy address (e.g., "127.0.0.1:3128")
+	SOCKSListen  string   `json:"socks_listen,omitempty" toml:"socks_listen"`   // SOCKS5 address (e.g., "127.0.0.1:1080")
+	Allow        []string `json:"allow,omitempty" toml:"allow"`                 // Destination host patterns; empty allows all
+	Log          string   `json:"log,omitempty" toml:"log"`                     // Egress log file (default: proxy log output)
+	InterceptTLS bool     `json:"intercept_tls,omitempty" toml:"intercept_tls"` // Decrypt CONNECT tunnels to log/filter each request
+	CACert       string   `json:"ca_cert,omitempty" toml:"ca_cert"`             // CA used to mint interception certificates
+	CAKey        string   `json:"ca_key,omitempty" toml:"ca_key"`
 }
 
 // Route represents a routing rule
 type Route struct {
 	// Matching criteria
-	Host   string `json:"host"`   // Host pattern (e.g., "example.com", "*.example.com")
-	Path   string `json:"path"`   // Path pattern (e.g., "/api/*")
-	Method string `json:"method"` // HTTP method (e.g., "GET", "*")
+	Host   string `json:"host" toml:"host"`     // Host pattern (e.g., "example.com", "*.example.com")
+	Path   string `json:"path" toml:"path"`     // Path pattern (e.g., "/api/*")
+	Method string `json:"method" toml:"method"` // HTTP method (e.g., "GET", "*")
+
+	// Header, query parameter and cookie conditions. A value of "*" only
+	// requires presence, "!" requires absence; anything else must be equal.
+	MatchHeaders map[string]string `json:"match_headers,omitempty" toml:"match_headers"`
+	MatchQuery   map[string]string `json:"match_query,omitempty" toml:"match_query"`
+	MatchCookies map[string]string `json:"match_cookies,omitempty" toml:"match_cookies"`
+
+	// Priority orders routes before specificity; higher matches first (default 0)
+	Priority int `json:"priority,omitempty" toml:"priority"`
 
 	// Target configuration
-	Target   string     `json:"target,omitempty"`   // Single backend URL
-	Backends []*Backend `json:"backends,omitempty"` // Multiple backends for load balancing
+	Target   string     `json:"target,omitempty" toml:"target"`     // Single backend URL
+	Backends []*Backend `json:"backends,omitempty" toml:"backends"` // Multiple backends for load balancing
 
 	// Options
-	WebSocket      bool              `json:"websocket,omitempty"`
-	StripPrefix    string            `json:"strip_prefix,omitempty"`
-	AddHeaders     map[string]string `json:"add_headers,omitempty"`
-	LoadBalance    LoadBalanceConfig `json:"load_balance,omitempty"`
-	MiddlewareList []MiddlewareConfig `json:"middleware,omitempty"`
+	WebSocket      bool               `json:"websocket,omitempty" toml:"websocket"`
+	StripPrefix    string             `json:"strip_prefix,omitempty" toml:"strip_prefix"`
+	AddHeaders     map[string]string  `json:"add_headers,omitempty" toml:"add_headers"`
+	LoadBalance    LoadBalanceConfig  `json:"load_balance,omitempty" toml:"load_balance"`
+	MiddlewareList []MiddlewareConfig `json:"middleware,omitempty" toml:"middleware"`
+	GeoIP          GeoIPConfig        `json:"geoip,omitempty" toml:"geoip"`
+	Hooks          *HooksConfig       `json:"hooks,omitempty" toml:"hooks"`
+
+	// Host header and SNI sent to backends (default: the backend's host),
+	// and X-Forwarded-* handling: append (default), replace or strip
+	PreserveHost bool   `json:"preserve_host,omitempty" toml:"preserve_host"` // Send the client's Host
+	UpstreamHost string `json:"upstream_host,omitempty" toml:"upstream_host"` // Send this Host
+	PreserveSNI  bool   `json:"preserve_sni,omitempty" toml:"preserve_sni"`   // Also send that host as SNI to https backends, and verify it
+	XForwarded   string `json:"x_forwarded,omitempty" toml:"x_forwarded"`
+
+	// BackendTLS sets how https backends are verified and authenticated
+	// to; backends with a tls table of their own use that instead
+	BackendTLS *BackendTLSConfig `json:"backend_tls,omitempty" toml:"backend_tls"`
 
 	// Static file serving
-	Static     bool   `json:"static,omitempty"`
-	StaticRoot string `json:"static_root,omitempty"`
+	Static     bool   `json:"static,omitempty" toml:"static"`
+	StaticRoot string `json:"static_root,omitempty" toml:"static_root"`
+
+	// DependsOn names a supervised process; the route answers 503 until the
+	// process passes its readiness check
+	DependsOn string `json:"depends_on,omitempty" toml:"depends_on"`
+
+	hooks     *routeHooks      // Compiled Hooks (runtime only)
+	outliers  *outlierDetector // Outlier detection state (runtime only)
+	health    *healthChecker   // Active health checks (runtime only)
+	slowStart time.Duration    // Parsed LoadBalance.SlowStart (runtime only)
+	drain     *drainTracker    // In-flight requests (runtime only)
+	chain     []Middleware     // General + route middleware (runtime only)
+	stats     *routeStats      // Live request statistics (runtime only)
+	transport *http.Transport  // Transport of BackendTLS; nil for the default (runtime only)
+}
+
+// HooksConfig holds CEL expressions evaluated per request. Expressions see
+// a "request" map (method, scheme, host, path, query, headers, remote_ip;
+// header names are lower-case) and, for response headers, a "response" map
+// (status, headers).
+type HooksConfig struct {
+	Reject          string            `json:"reject,omitempty" toml:"reject"`                     // bool: true rejects the request
+	RejectStatus    int               `json:"reject_status,omitempty" toml:"reject_status"`       // Status for rejected requests (default 403)
+	Backend         string            `json:"backend,omitempty" toml:"backend"`                   // string: backend name or URL ("" keeps the default)
+	RequestHeaders  map[string]string `json:"request_headers,omitempty" toml:"request_headers"`   // Header -> string expression sent to the backend
+	ResponseHeaders map[string]string `json:"response_headers,omitempty" toml:"response_headers"` // Header -> string expression sent to the client
+	Timeout         string            `json:"timeout,omitempty" toml:"timeout"`                   // Wall time limit per phase (default "10ms")
+	CostLimit       uint64            `json:"cost_limit,omitempty" toml:"cost_limit"`             // CEL cost limit per expression (default 10000)
+}
+
+// GeoIPConfig configures country-based routing and blocking for a route.
+// Requires general.geoip_database.
+type GeoIPConfig struct {
+	Countries      []string `json:"countries,omitempty" toml:"countries"`             // Route only matches clients from these countries
+	AllowCountries []string `json:"allow_countries,omitempty" toml:"allow_countries"` // Reject all other countries (403)
+	BlockCountries []string `json:"block_countries,omitempty" toml:"block_countries"` // Reject these countries (403)
+	Header         string   `json:"header,omitempty" toml:"header"`                   // Pass the country to backends (e.g., "X-Country")
 }
 
 // Backend represents a backend server
 type Backend struct {
-	Name    string  `json:"name"`
-	URL     *url.URL `json:"-"` // Parsed URL
-	URLStr  string  `json:"url"` // String representation for JSON
-	Weight  int     `json:"weight,omitempty"`
-	Health  *Health `json:"-"` // Health status (runtime only)
+	Name   string   `json:"name" toml:"name"`
+	URL    *url.URL `json:"-"`              // Parsed URL
+	URLStr string   `json:"url" toml:"url"` // String representation for JSON
+	Weight int      `json:"weight,omitempty" toml:"weight"`
+	Health *Health  `json:"-"` // Health status (runtime only)
+
+	TLS *BackendTLSConfig `json:"tls,omitempty" toml:"tls"` // Overrides the route's backend_tls
+
+	drain     *drainTracker   // In-flight requests (runtime only)
+	transport *http.Transport // Transport of TLS or the route's BackendTLS; nil for the default (runtime only)
+}
+
+// BackendTLSConfig configures the TLS connections to https backends.
+// Without it they are verified against the system CAs and tls.ca_files.
+type BackendTLSConfig struct {
+	CAFile             string `json:"ca_file,omitempty" toml:"ca_file"`                           // PEM CAs to trust besides those, e.g. of a self-signed backend
+	CertFile           string `json:"cert_file,omitempty" toml:"cert_file"`                       // Client certificate for backends requiring mTLS
+	KeyFile            string `json:"key_file,omitempty" toml:"key_file"`                         // Key of cert_file
+	ServerName         string `json:"server_name,omitempty" toml:"server_name"`                   // SNI and verified name, instead of the backend URL's host
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" toml:"insecure_skip_verify"` // Don't verify the certificate at all; logged loudly
 }
 
 // Health tracks backend health
 type Health struct {
 	Status      HealthStatus
 	Connections int32
-	FailCount   int32
+	FailCount   int32 // Failed health checks in a row
 	LastCheck   time.Time
+	Since       time.Time // When the backend joined the pool or last recovered
+	passCount   int32     // Passed health checks in a row
 	mu          sync.RWMutex
 }
 
 // LoadBalanceConfig configures load balancing
 type LoadBalanceConfig struct {
-	Strategy       LoadBalanceStrategy `json:"strategy"`
-	HealthCheck    string              `json:"health_check,omitempty"`    // Health check path
-	HealthInterval string              `json:"health_interval,omitempty"` // Check interval (e.g., "10s")
+	Strategy           LoadBalanceStrategy `json:"strategy" toml:"strategy"`
+	HealthCheck        string              `json:"health_check,omitempty" toml:"health_check"`               // Health check path, or "tcp" to connect only
+	HealthInterval     string              `json:"health_interval,omitempty" toml:"health_interval"`         // Check interval (default "10s")
+	HealthTimeout      string              `json:"health_timeout,omitempty" toml:"health_timeout"`           // Check timeout (default "5s")
+	HealthyThreshold   int                 `json:"healthy_threshold,omitempty" toml:"healthy_threshold"`     // Passed checks in a row to mark a backend healthy (default 2)
+	UnhealthyThreshold int                 `json:"unhealthy_threshold,omitempty" toml:"unhealthy_threshold"` // Failed checks in a row to mark a backend unhealthy (default 3)
+	Outlier            *OutlierConfig      `json:"outlier,omitempty" toml:"outlier"`                         // Eject slow/failing backends
+	SlowStart          string              `json:"slow_start,omitempty" toml:"slow_start"`                   // Ramp up new/recovered backends over this window (e.g., "60s")
 }
 
-// MiddlewareConfig configures middleware
+// OutlierConfig configures outlier detection: backends whose p95 latency or
+// 5xx rate deviates strongly from the rest of the pool are ejected for a while
+type OutlierConfig struct {
+	LatencyFactor      float64 `json:"latency_factor,omitempty" toml:"latency_factor"`             // Eject when p95 exceeds the pool's by this factor (default 3)
+	MinLatency         string  `json:"min_latency,omitempty" toml:"min_latency"`                   // ...and by at least this much (default "50ms")
+	ErrorRateDelta     float64 `json:"error_rate_delta,omitempty" toml:"error_rate_delta"`         // Eject when the 5xx rate exceeds the pool's by this fraction (default 0.3)
+	MinRequests        int     `json:"min_requests,omitempty" toml:"min_requests"`                 // Samples needed before a backend is judged (default 20)
+	EjectionTime       string  `json:"ejection_time,omitempty" toml:"ejection_time"`               // Base ejection time, multiplied by the ejection count (default "30s")
+	MaxEjectionPercent int     `json:"max_ejection_percent,omitempty" toml:"max_ejection_percent"` // Never eject more of the pool than this (default 50)
+	Interval           string  `json:"interval,omitempty" toml:"interval"`                         // Evaluation interval (default "10s")
+}
+
+// MiddlewareConfig configures middleware. Route entries override the
+// general entry of the same type.
 type MiddlewareConfig struct {
-	Type string                 `json:"type"` // "ratelimit", "cors", "auth"
-	Options map[string]interface{} `json:"options,omitempty"`
+	Type     string                 `json:"type" toml:"type"`                   // "ratelimit", "cors", "request_id", "access_log"
+	Options  map[string]interface{} `json:"options,omitempty" toml:"options"`   // Route options are merged over the general ones
+	Disabled bool                   `json:"disabled,omitempty" toml:"disabled"` // Drop the general entry of this type for the route
 }
 
 // Middleware is a function that wraps an http.Handler
@@ -118,8 +334,34 @@ func (h *Health) GetStatus() HealthStatus {
 func (h *Health) SetStatus(status HealthStatus) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	now := time.Now()
+	if status == HealthStatusHealthy && h.Status != HealthStatusHealthy {
+		h.Since = now
+	}
 	h.Status = status
-	h.LastCheck = time.Now()
+	h.LastCheck = now
+}
+
+// AvailableSince returns when the backend joined the pool or last recovered
+func (h *Health) AvailableSince() time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.Since
+}
+
+// MarkRecovered records that the backend just became available again
+func (h *Health) MarkRecovered() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Since = time.Now()
+}
+
+// newHealth returns the health of a backend joining the pool
+func newHealth() *Health {
+	return &Health{
+		Status: HealthStatusHealthy,
+		Since:  time.Now(),
+	}
 }
 
 // IncrementConnections increments connection count
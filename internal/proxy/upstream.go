@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gleicon/ophid/internal/httpclient"
+)
+
+// X-Forwarded-* modes of a route (Route.XForwarded)
+const (
+	// XForwardedAppend adds the client's address to the X-Forwarded-For
+	// chain the request came with (the default)
+	XForwardedAppend = "append"
+	// XForwardedReplace drops the incoming chain, so X-Forwarded-For holds
+	// just the client's address; for proxies facing untrusted clients
+	XForwardedReplace = "replace"
+	// XForwardedStrip sends no X-Forwarded-* headers at all
+	XForwardedStrip = "strip"
+)
+
+// maxSNITransports bounds the transports a route with preserve_host and
+// preserve_sni keeps, one per client host; further hosts use the backend's
+// host as SNI
+const maxSNITransports = 64
+
+// validateUpstream checks a route's Host header, SNI and X-Forwarded-*
+// options
+func validateUpstream(route *Route) error {
+	switch route.XForwarded {
+	case "", XForwardedAppend, XForwardedReplace, XForwardedStrip:
+	default:
+		return fmt.Errorf("invalid x_forwarded %q: must be append, replace or strip", route.XForwarded)
+	}
+	if route.PreserveHost && route.UpstreamHost != "" {
+		return fmt.Errorf("preserve_host and upstream_host can't both be set")
+	}
+	if route.PreserveSNI {
+		if !route.PreserveHost && route.UpstreamHost == "" {
+			return fmt.Errorf("preserve_sni needs preserve_host or upstream_host")
+		}
+		if route.BackendTLS != nil && route.BackendTLS.ServerName != "" {
+			return fmt.Errorf("preserve_sni and backend_tls.server_name can't both be set")
+		}
+	}
+	return nil
+}
+
+// upstreamHost returns the Host header to send a backend
+func (route *Route) upstreamHost(req *http.Request, backend *Backend) string {
+	switch {
+	case route.UpstreamHost != "":
+		return route.UpstreamHost
+	case route.PreserveHost:
+		return req.Host
+	}
+	return backend.URL.Host
+}
+
+// sniHost returns the name of the fixed Host a route sends as SNI, or ""
+func (route *Route) sniHost() string {
+	if !route.PreserveSNI || route.UpstreamHost == "" {
+		return ""
+	}
+	return hostname(route.UpstreamHost)
+}
+
+// hostname strips the port of a Host header
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// setForwardedHeaders sets the X-Forwarded-* headers of a request to a
+// backend. The reverse proxy appends the client's address to whatever
+// X-Forwarded-For is left, unless it is set to nil.
+func setForwardedHeaders(r, originalReq *http.Request, mode string) {
+	switch mode {
+	case XForwardedStrip:
+		r.Header["X-Forwarded-For"] = nil
+		r.Header.Del("X-Forwarded-Proto")
+		r.Header.Del("X-Forwarded-Host")
+		return
+	case XForwardedReplace:
+		r.Header.Del("X-Forwarded-For")
+	}
+
+	proto := originalReq.URL.Scheme
+	if proto == "" {
+		proto = "http"
+		if originalReq.TLS != nil {
+			proto = "https"
+		}
+	}
+	r.Header.Set("X-Forwarded-Proto", proto)
+	r.Header.Set("X-Forwarded-Host", originalReq.Host)
+}
+
+// sniTransports are the transports of a preserve_host and preserve_sni
+// route, each sending a client host as SNI
+type sniTransports struct {
+	mu         sync.Mutex
+	transports map[sniKey]*http.Transport
+}
+
+// sniKey identifies a transport by the one it was cloned from and its SNI
+type sniKey struct {
+	base *http.Transport
+	host string
+}
+
+// get returns a clone of base sending host as SNI, or base itself once
+// maxSNITransports hosts have one
+func (s *sniTransports) get(base *http.Transport, host string) *http.Transport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sniKey{base, hostname(host)}
+	if t, ok := s.transports[key]; ok {
+		return t
+	}
+	if len(s.transports) >= maxSNITransports {
+		return base
+	}
+	if s.transports == nil {
+		s.transports = make(map[sniKey]*http.Transport)
+	}
+	t := base.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{RootCAs: httpclient.RootCAs()}
+	}
+	t.TLSClientConfig.ServerName = key.host
+	s.transports[key] = t
+	return t
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUpstreamHeaders(t *testing.T) {
+	var got http.Header
+	var host string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, host = r.Header.Clone(), r.Host
+	}))
+	defer backend.Close()
+	backendHost := strings.TrimPrefix(backend.URL, "http://")
+
+	tests := []struct {
+		name      string
+		route     Route
+		wantHost  string
+		wantXFF   string
+		forwarded bool
+	}{
+		{"default", Route{}, backendHost, "203.0.113.9, 192.0.2.1", true},
+		{"preserve_host", Route{PreserveHost: true}, "app.example.com", "203.0.113.9, 192.0.2.1", true},
+		{"upstream_host", Route{UpstreamHost: "app.internal:8080"}, "app.internal:8080", "203.0.113.9, 192.0.2.1", true},
+		{"replace", Route{XForwarded: XForwardedReplace}, backendHost, "192.0.2.1", true},
+		{"strip", Route{XForwarded: XForwardedStrip}, backendHost, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := tt.route
+			route.Host, route.Target = "app.example.com", backend.URL
+			if err := prepareRoute(&route); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", "http://app.example.com/", nil)
+			req.RemoteAddr = "192.0.2.1:4321"
+			req.Header.Set("X-Forwarded-For", "203.0.113.9")
+			rec := httptest.NewRecorder()
+			NewHTTPProxy(&route).ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got %d", rec.Code)
+			}
+
+			if host != tt.wantHost {
+				t.Errorf("backend got Host %q, want %q", host, tt.wantHost)
+			}
+			if xff := got.Get("X-Forwarded-For"); xff != tt.wantXFF {
+				t.Errorf("X-Forwarded-For = %q, want %q", xff, tt.wantXFF)
+			}
+			if forwarded := got.Get("X-Forwarded-Host") == "app.example.com" && got.Get("X-Forwarded-Proto") == "http"; forwarded != tt.forwarded {
+				t.Errorf("X-Forwarded-Host %q, X-Forwarded-Proto %q", got.Get("X-Forwarded-Host"), got.Get("X-Forwarded-Proto"))
+			}
+		})
+	}
+}
+
+func TestUpstreamSNI(t *testing.T) {
+	var serverName string
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverName = r.TLS.ServerName
+	}))
+	defer backend.Close()
+	insecure := &BackendTLSConfig{InsecureSkipVerify: true}
+	backendURL, _ := url.Parse(backend.URL)
+
+	tests := []struct {
+		name  string
+		route Route
+		want  string
+	}{
+		{"backend host", Route{PreserveHost: true, BackendTLS: insecure}, ""}, // No SNI for an IP
+		{"upstream_host", Route{UpstreamHost: "app.internal:8443", PreserveSNI: true, BackendTLS: insecure}, "app.internal"},
+		{"preserve_host", Route{PreserveHost: true, PreserveSNI: true, BackendTLS: insecure}, "app.example.com"},
+		{"backend server_name", Route{
+			UpstreamHost: "app.internal", PreserveSNI: true, BackendTLS: insecure,
+			Backends: []*Backend{{Name: "b", URLStr: backend.URL, URL: backendURL, TLS: &BackendTLSConfig{InsecureSkipVerify: true, ServerName: "b.internal"}}},
+		}, "b.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverName = "unset"
+			route := tt.route
+			route.Host = "app.example.com"
+			if len(route.Backends) == 0 {
+				route.Target = backend.URL
+			}
+			if err := prepareRoute(&route); err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			NewHTTPProxy(&route).ServeHTTP(rec, httptest.NewRequest("GET", "http://app.example.com:8080/", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got %d: %s", rec.Code, rec.Body)
+			}
+			if serverName != tt.want {
+				t.Errorf("backend got SNI %q, want %q", serverName, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateUpstream(t *testing.T) {
+	for name, route := range map[string]Route{
+		"x_forwarded":          {XForwarded: "keep"},
+		"both hosts":           {PreserveHost: true, UpstreamHost: "app.internal"},
+		"sni without a host":   {PreserveSNI: true},
+		"sni with server_name": {UpstreamHost: "app.internal", PreserveSNI: true, BackendTLS: &BackendTLSConfig{ServerName: "other"}},
+	} {
+		if err := validateUpstream(&route); err == nil {
+			t.Errorf("%s: validateUpstream() accepted %+v", name, route)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gleicon/ophid/internal/proxy/middleware"
+)
+
+func TestWebSocketProxy(t *testing.T) {
+	// Backend: switches protocols, then echoes lines
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "" {
+			io.WriteString(w, "plain")
+			return
+		}
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+		for {
+			line, err := buf.ReadString('\n')
+			if err != nil {
+				return
+			}
+			buf.WriteString("echo " + line)
+			buf.Flush()
+		}
+	}))
+	defer backend.Close()
+
+	route := &Route{Target: backend.URL, WebSocket: true}
+	// Behind the access log and stats wrappers, as the server runs routes
+	logger := middleware.NewLogger(log.New(io.Discard, "", 0))
+	front := httptest.NewUnstartedServer(logger.Middleware(&statsHandler{next: NewWebSocketProxy(route)}))
+	front.Config.ReadTimeout = 200 * time.Millisecond
+	front.Config.WriteTimeout = 200 * time.Millisecond
+	front.Start()
+	defer front.Close()
+
+	resp, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "plain" {
+		t.Errorf("plain request got %q", body)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(front.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: lab.example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	upgraded, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upgraded.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", upgraded.StatusCode)
+	}
+
+	// Past the server's timeouts the connection still carries messages
+	time.Sleep(400 * time.Millisecond)
+	io.WriteString(conn, "hello\n")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "echo hello\n" {
+		t.Errorf("got %q, %v, want an echo", line, err)
+	}
+}
+
+// statsHandler wraps the response writer the way the server does
+type statsHandler struct {
+	next http.Handler
+}
+
+func (h *statsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.next.ServeHTTP(&statsResponseWriter{ResponseWriter: w}, r)
+}
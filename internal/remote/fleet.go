@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of a fleet operation on one host
+type Result struct {
+	Host     string
+	Err      error
+	Skipped  bool // Not attempted after an earlier host failed
+	Duration time.Duration
+}
+
+// FleetOptions tune a fleet rollout
+type FleetOptions struct {
+	Parallel  int       // Hosts worked on at once (default 1, a rolling rollout)
+	KeepGoing bool      // Carry on after a host fails; by default hosts not started yet are skipped
+	Output    io.Writer // Where host output goes, each line prefixed with "[host] "
+}
+
+// Fleet runs fn for every host, in inventory order, and returns a result
+// per host in the same order
+func Fleet(ctx context.Context, hosts []string, opts FleetOptions, fn func(ctx context.Context, host string, out io.Writer) error) []Result {
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	output := opts.Output
+	if output == nil {
+		output = io.Discard
+	}
+
+	results := make([]Result, len(hosts))
+	var mu sync.Mutex // Guards failed and writes to output
+	failed := false
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for i, host := range hosts {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := failed && !opts.KeepGoing
+		mu.Unlock()
+		if stop || ctx.Err() != nil {
+			<-sem
+			results[i] = Result{Host: host, Skipped: true}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			out := &prefixWriter{prefix: "[" + host + "] ", w: output, mu: &mu}
+			started := time.Now()
+			err := fn(ctx, host, out)
+			out.Flush()
+
+			results[i] = Result{Host: host, Err: err, Duration: time.Since(started)}
+			if err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(i, host)
+	}
+	wg.Wait()
+	return results
+}
+
+// prefixWriter writes whole lines to w, each starting with prefix, so the
+// output of hosts worked on at once doesn't interleave mid-line
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mu     *sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf.Write(data)
+	for {
+		line, err := p.buf.ReadBytes('\n')
+		if err != nil {
+			// Keep the partial line for the next write
+			p.buf.Write(line)
+			break
+		}
+		p.writeLine(line)
+	}
+	return len(data), nil
+}
+
+// Flush writes a trailing partial line
+func (p *prefixWriter) Flush() {
+	if p.buf.Len() > 0 {
+		line := append(p.buf.Bytes(), '\n')
+		p.buf.Reset()
+		p.writeLine(line)
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	io.WriteString(p.w, p.prefix)
+	p.w.Write(line)
+}
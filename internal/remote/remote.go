@@ -0,0 +1,287 @@
+// Package remote runs ophid on other hosts over SSH: it finds or
+// bootstraps the ophid binary there, copies files and runs commands. It
+// drives the system ssh client, so ~/.ssh/config, agents and known_hosts
+// apply as they do for any ssh session.
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	goruntime "runtime"
+	"strings"
+
+	"github.com/gleicon/ophid/internal/bundle"
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// BinaryPath is where bootstrapping puts ophid on a remote host
+const BinaryPath = "$HOME/.ophid/bin/ophid"
+
+// Client runs commands on a host through ssh
+type Client struct {
+	Destination string   // ssh destination: host, user@host or ssh://user@host:port
+	SSH         string   // ssh binary (default "ssh")
+	Options     []string // Extra ssh arguments, e.g. "-i", "key" or "-o", "BatchMode=yes"
+	Binary      string   // ophid binary to bootstrap hosts with (default this executable)
+	TTY         bool     // Allocate a terminal, for interactive commands
+}
+
+// NewClient creates a client for an ssh destination
+func NewClient(destination string) *Client {
+	return &Client{Destination: destination, SSH: "ssh"}
+}
+
+// Platform is a host's GOOS/GOARCH
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+// LocalPlatform is the platform of this binary
+func LocalPlatform() Platform {
+	return Platform{OS: goruntime.GOOS, Arch: goruntime.GOARCH}
+}
+
+// Run runs a POSIX shell script on the host
+func (c *Client) Run(ctx context.Context, script string, stdin io.Reader, stdout, stderr io.Writer) error {
+	ssh := c.SSH
+	if ssh == "" {
+		ssh = "ssh"
+	}
+	args := append([]string{}, c.Options...)
+	if c.TTY {
+		args = append(args, "-t")
+	}
+	// "--" keeps a destination starting with "-" from being read as an option
+	args = append(args, "--", c.Destination, script)
+
+	cmd := exec.CommandContext(ctx, ssh, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		// ssh exits 255 when it can't connect or authenticate
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 255 {
+			return errcode.Wrap(errcode.Network, fmt.Errorf("%s: ssh failed: %w", c.Destination, err))
+		}
+		return fmt.Errorf("%s: %w", c.Destination, err)
+	}
+	return nil
+}
+
+// probeScript prints the host's platform and the ophid it would run, if any
+const probeScript = `uname -s; uname -m; ` +
+	`if command -v ophid >/dev/null 2>&1; then command -v ophid; ` +
+	`elif [ -x "` + BinaryPath + `" ]; then echo "` + BinaryPath + `"; fi`
+
+// Probe returns the host's platform and the path of its ophid, or "" when
+// it has none
+func (c *Client) Probe(ctx context.Context) (Platform, string, error) {
+	var stdout, stderr bytes.Buffer
+	if err := c.Run(ctx, probeScript, nil, &stdout, &stderr); err != nil {
+		return Platform{}, "", withStderr(err, &stderr)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) < 2 {
+		return Platform{}, "", fmt.Errorf("%s: unexpected probe output %q", c.Destination, stdout.String())
+	}
+	platform := Platform{OS: goOS(lines[0]), Arch: goArch(lines[1])}
+	path := ""
+	if len(lines) > 2 {
+		path = strings.TrimSpace(lines[2])
+	}
+	return platform, path, nil
+}
+
+// Ensure returns the host's ophid, copying the bootstrap binary to
+// BinaryPath first when it has none
+func (c *Client) Ensure(ctx context.Context) (string, error) {
+	platform, path, err := c.Probe(ctx)
+	if err != nil {
+		return "", err
+	}
+	if path != "" {
+		return path, nil
+	}
+
+	binary := c.Binary
+	if binary == "" {
+		if platform != LocalPlatform() {
+			return "", fmt.Errorf("%s has no ophid and is %s, not %s like this binary; pass an ophid build for it with --binary", c.Destination, platform, LocalPlatform())
+		}
+		if binary, err = os.Executable(); err != nil {
+			return "", fmt.Errorf("failed to find the ophid binary: %w", err)
+		}
+	}
+
+	f, err := os.Open(binary)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", binary, err)
+	}
+	defer f.Close()
+	if err := c.Upload(ctx, f, BinaryPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to bootstrap ophid on %s: %w", c.Destination, err)
+	}
+	return BinaryPath, nil
+}
+
+// Upload writes r to path on the host, which may start with $HOME. The
+// file appears complete or not at all.
+func (c *Client) Upload(ctx context.Context, r io.Reader, path string, mode os.FileMode) error {
+	target := shellPath(path)
+	script := fmt.Sprintf(`mkdir -p "$(dirname %[1]s)" && cat > %[1]s.tmp && chmod %[2]o %[1]s.tmp && mv -f %[1]s.tmp %[1]s`, target, mode.Perm())
+	var stderr bytes.Buffer
+	if err := c.Run(ctx, script, r, io.Discard, &stderr); err != nil {
+		return withStderr(err, &stderr)
+	}
+	return nil
+}
+
+// Ophid runs ophid with args on the host, bootstrapping it if needed
+func (c *Client) Ophid(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	path, err := c.Ensure(ctx)
+	if err != nil {
+		return err
+	}
+	return c.runOphid(ctx, path, args, stdin, stdout, stderr)
+}
+
+// runOphid runs the ophid at path on the host
+func (c *Client) runOphid(ctx context.Context, path string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	command := shellPath(path)
+	for _, arg := range args {
+		command += " " + ShellQuote(arg)
+	}
+	return c.Run(ctx, command, stdin, stdout, stderr)
+}
+
+// ApplyBundle installs an ophid.toml, and its lock and signature when
+// given, on the host with ophid bundle install, from a temporary directory
+// removed afterwards
+func (c *Client) ApplyBundle(ctx context.Context, bundleData, lockData, sigData []byte, stdout, stderr io.Writer) error {
+	ophid, err := c.Ensure(ctx)
+	if err != nil {
+		return err
+	}
+
+	var dirOut, runErr bytes.Buffer
+	if err := c.Run(ctx, "mktemp -d", nil, &dirOut, &runErr); err != nil {
+		return withStderr(err, &runErr)
+	}
+	dir := strings.TrimSpace(dirOut.String())
+	if dir == "" || !strings.HasPrefix(dir, "/") {
+		return fmt.Errorf("%s: mktemp returned %q", c.Destination, dir)
+	}
+	defer c.Run(context.WithoutCancel(ctx), "rm -rf "+ShellQuote(dir), nil, io.Discard, io.Discard)
+
+	file := dir + "/" + bundle.DefaultFile
+	if err := c.Upload(ctx, bytes.NewReader(bundleData), file, 0644); err != nil {
+		return err
+	}
+	if lockData != nil {
+		if err := c.Upload(ctx, bytes.NewReader(lockData), bundle.LockPath(file), 0644); err != nil {
+			return err
+		}
+	}
+	if sigData != nil {
+		if err := c.Upload(ctx, bytes.NewReader(sigData), bundle.SignaturePath(file), 0644); err != nil {
+			return err
+		}
+	}
+	return c.runOphid(ctx, ophid, []string{"bundle", "install", "-f", file}, nil, stdout, stderr)
+}
+
+// ShellQuote quotes s for a POSIX shell
+func ShellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:@,+%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellPath quotes a path for a shell, leaving a leading $HOME to expand
+func shellPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "$HOME/"); ok {
+		return `"$HOME"/` + ShellQuote(rest)
+	}
+	return ShellQuote(path)
+}
+
+// LoadInventory reads an inventory file: one ssh destination per line,
+// with blank lines and # comments ignored
+func LoadInventory(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %w", err)
+	}
+	defer f.Close()
+
+	var hosts []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.ContainsAny(line, " \t") || strings.HasPrefix(line, "-") {
+			return nil, fmt.Errorf("%s:%d: invalid host %q", path, n, line)
+		}
+		if !seen[line] {
+			hosts = append(hosts, line)
+			seen[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %w", err)
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("inventory lists no hosts")
+	}
+	return hosts, nil
+}
+
+// goOS maps uname -s to GOOS
+func goOS(uname string) string {
+	return strings.ToLower(strings.TrimSpace(uname))
+}
+
+// goArch maps uname -m to GOARCH
+func goArch(uname string) string {
+	switch machine := strings.TrimSpace(uname); machine {
+	case "x86_64", "amd64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
+	case "i386", "i686":
+		return "386"
+	default:
+		if strings.HasPrefix(machine, "armv") {
+			return "arm"
+		}
+		return machine
+	}
+}
+
+// withStderr adds what a failed command printed to its error
+func withStderr(err error, stderr *bytes.Buffer) error {
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
+}
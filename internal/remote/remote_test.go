@@ -0,0 +1,151 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeClient returns a client whose "ssh" runs scripts on this machine,
+// with HOME set to a temporary directory, bootstrapping with a shell
+// script that echoes its arguments
+func fakeClient(t *testing.T) (*Client, string) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	if _, err := exec.LookPath("ophid"); err == nil {
+		t.Skip("an ophid on PATH would be used instead of bootstrapping")
+	}
+
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	t.Setenv("HOME", home)
+
+	ssh := filepath.Join(dir, "ssh")
+	os.WriteFile(ssh, []byte("#!/bin/sh\nwhile [ \"$1\" != \"--\" ]; do shift; done\nshift; shift\nexec sh -c \"$1\"\n"), 0755)
+	binary := filepath.Join(dir, "ophid")
+	os.WriteFile(binary, []byte("#!/bin/sh\necho \"ophid $*\"\nif [ \"$1\" = bundle ]; then cat \"$4\"; fi\n"), 0755)
+
+	c := NewClient("web1")
+	c.SSH = ssh
+	c.Binary = binary
+	return c, home
+}
+
+func TestClientBootstrap(t *testing.T) {
+	c, home := fakeClient(t)
+	ctx := context.Background()
+
+	platform, path, err := c.Probe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "" || platform.OS == "" || platform.Arch == "" {
+		t.Errorf("Probe = %v, %q", platform, path)
+	}
+
+	var out bytes.Buffer
+	if err := c.Ophid(ctx, []string{"version", "it's here"}, nil, &out, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "ophid version it's here\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	if info, err := os.Stat(filepath.Join(home, ".ophid", "bin", "ophid")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("bootstrapped binary: %v, %v", info, err)
+	}
+
+	// The next probe finds it
+	if _, path, err := c.Probe(ctx); err != nil || path != filepath.Join(home, ".ophid", "bin", "ophid") {
+		t.Errorf("Probe after bootstrap = %q, %v", path, err)
+	}
+
+	out.Reset()
+	if err := c.ApplyBundle(ctx, []byte("[tools.ansible]\n"), []byte("version = 1\n"), nil, &out, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	first, rest, _ := strings.Cut(out.String(), "\n")
+	file := strings.TrimPrefix(first, "ophid bundle install -f ")
+	if file == first || rest != "[tools.ansible]\n" {
+		t.Errorf("ApplyBundle output = %q", out.String())
+	}
+	if _, err := os.Stat(filepath.Dir(file)); !os.IsNotExist(err) {
+		t.Errorf("temporary directory left behind: %v", err)
+	}
+}
+
+func TestFleet(t *testing.T) {
+	hosts := []string{"a", "b", "c"}
+	apply := func(ctx context.Context, host string, out io.Writer) error {
+		io.WriteString(out, "applying\npartial")
+		if host == "b" {
+			return errors.New("failed")
+		}
+		return nil
+	}
+
+	var out bytes.Buffer
+	results := Fleet(context.Background(), hosts, FleetOptions{Output: &out}, apply)
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Host+":"+map[bool]string{true: "skipped", false: "run"}[r.Skipped]+":"+map[bool]string{true: "error", false: "ok"}[r.Err != nil])
+	}
+	if want := []string{"a:run:ok", "b:run:error", "c:skipped:ok"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %v, want %v", got, want)
+	}
+	if out.String() != "[a] applying\n[a] partial\n[b] applying\n[b] partial\n" {
+		t.Errorf("output = %q", out.String())
+	}
+
+	results = Fleet(context.Background(), hosts, FleetOptions{Parallel: 3, KeepGoing: true}, apply)
+	if results[2].Skipped || results[2].Err != nil || results[1].Err == nil {
+		t.Errorf("keep going results = %+v", results)
+	}
+}
+
+func TestLoadInventory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	os.WriteFile(path, []byte("# web tier\nweb1\ndeploy@web2  # canary\n\nssh://ops@db1:2222\nweb1\n"), 0644)
+	hosts, err := LoadInventory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"web1", "deploy@web2", "ssh://ops@db1:2222"}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts = %v, want %v", hosts, want)
+	}
+
+	os.WriteFile(path, []byte("-oProxyCommand=x\n"), 0644)
+	if _, err := LoadInventory(path); err == nil {
+		t.Error("accepted a host that ssh would read as an option")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"install":          "install",
+		"--version=1.2":    "--version=1.2",
+		"":                 "''",
+		"a b":              "'a b'",
+		"it's":             `'it'\''s'`,
+		"$(rm -rf /)":      "'$(rm -rf /)'",
+		"$HOME/.ophid/bin": "'$HOME/.ophid/bin'",
+	} {
+		if got := ShellQuote(in); got != want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+	if got := shellPath(BinaryPath); got != `"$HOME"/.ophid/bin/ophid` {
+		t.Errorf("shellPath = %s", got)
+	}
+	if goArch("aarch64") != "arm64" || goArch("x86_64") != "amd64" || goOS("Darwin") != "darwin" {
+		t.Error("uname mapping")
+	}
+}
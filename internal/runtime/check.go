@@ -0,0 +1,131 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// checkTimeout bounds running a runtime's interpreter to check it
+const checkTimeout = 10 * time.Second
+
+// pythonHealthScript imports what tool installs need of a Python: ssl to
+// download from PyPI, zlib to unpack wheels, and venv and ensurepip to
+// build the tools' venvs with pip in them
+const pythonHealthScript = "import ssl, zlib, venv, ensurepip; print(ssl.OPENSSL_VERSION)"
+
+// Check runs a runtime's interpreter and verifies it reports the version
+// the runtime is installed as; a Python must also import the modules
+// tool installs need. Runtimes ophid doesn't install yet pass.
+func (m *Manager) Check(rt *Runtime) error {
+	var binary string
+	var env []string
+	switch rt.Type {
+	case RuntimePython:
+		binary = filepath.Join(rt.Path, "bin", "python3")
+	case RuntimeNode:
+		binary = filepath.Join(rt.Path, "bin", "node")
+		if m.platform.OS == "windows" {
+			// Node's Windows zip has node.exe at the top, not in bin
+			binary = filepath.Join(rt.Path, "node")
+		}
+	case RuntimeRuby:
+		binary = filepath.Join(rt.Path, "bin", "ruby")
+	case RuntimeRust:
+		binary = filepath.Join(rt.Path, "cargo", "bin", "rustc")
+		env = []string{"RUSTUP_HOME=" + filepath.Join(rt.Path, "rustup"), "CARGO_HOME=" + filepath.Join(rt.Path, "cargo")}
+	default:
+		return nil
+	}
+	if m.platform.OS == "windows" {
+		binary += ".exe"
+	}
+	if _, err := os.Stat(binary); err != nil {
+		return errcode.Errorf(errcode.Verification, "%s is missing", binary)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binary, "--version")
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errcode.Errorf(errcode.Verification, "%s --version failed: %v%s", filepath.Base(binary), err, m.checkHint(out))
+	}
+
+	// Channels like rust@stable name no version to compare
+	reported := strings.TrimSpace(string(out))
+	if rt.Version != "" && rt.Version[0] >= '0' && rt.Version[0] <= '9' && !strings.Contains(reported, rt.Version) {
+		return errcode.Errorf(errcode.Verification, "installed as %s %s but reports %q", rt.Type.DisplayName(), rt.Version, reported)
+	}
+
+	if rt.Type == RuntimePython {
+		cmd := exec.CommandContext(ctx, binary, "-c", pythonHealthScript)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return errcode.Errorf(errcode.Verification, "%s runs but can't import the modules tool installs need (ssl, zlib, venv, ensurepip): %s%s",
+				filepath.Base(binary), lastLine(out, err), m.checkHint(out))
+		}
+	}
+	return nil
+}
+
+// checkHint suggests what to do about a runtime that fails to run on this
+// host, from its output, or returns ""
+func (m *Manager) checkHint(out []byte) string {
+	if m.platform.OS != "linux" {
+		return ""
+	}
+	if musl, _ := filepath.Glob("/lib/ld-musl-*.so.1"); len(musl) > 0 {
+		// Alpine and the like: the standalone builds link against glibc
+		return ". This host uses musl libc and ophid's runtimes are built for glibc: use the runtime of the system packages (like apk add python3) or a glibc-based image"
+	}
+	if strings.Contains(string(out), "GLIBC_") {
+		return ". This host's glibc is older than the runtime needs: upgrade the OS, or use the system Python"
+	}
+	if strings.Contains(string(out), "error while loading shared libraries") {
+		return ". A system library the runtime links against is missing; install it with the OS package manager"
+	}
+	return ""
+}
+
+// lastLine returns the last line of a command's output, or its error when
+// it printed nothing
+func lastLine(out []byte, err error) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if last := lines[len(lines)-1]; last != "" {
+		return last
+	}
+	return err.Error()
+}
+
+// Reinstall installs a runtime again. The old install is set aside until
+// the new one is in place, and restored if installing fails.
+func (m *Manager) Reinstall(rt *Runtime) (*Runtime, error) {
+	if !rt.Type.IsImplemented() {
+		return nil, fmt.Errorf("ophid can't install %s runtimes", rt.Type.DisplayName())
+	}
+	aside := rt.Path + ".old"
+	if err := os.RemoveAll(aside); err != nil {
+		return nil, fmt.Errorf("failed to clear %s: %w", aside, err)
+	}
+	if err := os.Rename(rt.Path, aside); err != nil {
+		return nil, fmt.Errorf("failed to set the runtime aside: %w", err)
+	}
+
+	reinstalled, err := m.Install(fmt.Sprintf("%s@%s", rt.Type, rt.Version))
+	if err != nil {
+		os.RemoveAll(rt.Path)
+		if restoreErr := os.Rename(aside, rt.Path); restoreErr != nil {
+			return nil, fmt.Errorf("%w; restoring the old runtime failed too, it is in %s: %v", err, aside, restoreErr)
+		}
+		return nil, err
+	}
+	os.RemoveAll(aside)
+	return reinstalled, nil
+}
@@ -0,0 +1,174 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Constraint is a PEP 440 style version requirement such as
+// ">=3.10,<3.13": every clause must allow a version. A bare version is a
+// prefix, so "3.11" allows 3.11.7 like "==3.11.*" does. Only final releases
+// are compared; pre-release and local version labels aren't supported.
+type Constraint []clause
+
+// clause is one comparison of a constraint
+type clause struct {
+	op       string // One of ==, !=, <, <=, >, >=, ~=
+	version  []int
+	wildcard bool // "==3.11.*" or "!=3.11.*": compare the prefix only
+}
+
+// operators are the clause operators, two-character ones first so that
+// "<=" isn't read as "<"
+var operators = []string{"==", "!=", "<=", ">=", "~=", "<", ">"}
+
+// ParseConstraint parses a version requirement. An empty one allows any
+// version.
+func ParseConstraint(s string) (Constraint, error) {
+	var c Constraint
+	if strings.TrimSpace(s) == "" {
+		return c, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		// A bare version is a prefix
+		cl := clause{op: "==", wildcard: true}
+		for _, op := range operators {
+			if rest, ok := strings.CutPrefix(part, op); ok {
+				cl.op, cl.wildcard, part = op, false, strings.TrimSpace(rest)
+				break
+			}
+		}
+		if rest, ok := strings.CutSuffix(part, ".*"); ok {
+			if cl.op != "==" && cl.op != "!=" {
+				return nil, fmt.Errorf("invalid version requirement %q: .* only goes with == and !=", s)
+			}
+			cl.wildcard, part = true, rest
+		}
+		version, err := parseVersion(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version requirement %q: %w", s, err)
+		}
+		if cl.op == "~=" && len(version) < 2 {
+			return nil, fmt.Errorf("invalid version requirement %q: ~= needs at least two version segments", s)
+		}
+		cl.version = version
+		c = append(c, cl)
+	}
+	return c, nil
+}
+
+// Allows reports whether a version satisfies every clause. Versions that
+// don't parse, such as rust channels, are never allowed.
+func (c Constraint) Allows(version string) bool {
+	v, err := parseVersion(version)
+	if err != nil {
+		return false
+	}
+	for _, cl := range c {
+		if !cl.allows(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Exact returns the version the constraint pins with a full major.minor.patch
+// "==" clause, or "" if it doesn't pin one
+func (c Constraint) Exact() string {
+	for _, cl := range c {
+		if cl.op == "==" && len(cl.version) >= 3 {
+			return formatVersion(cl.version)
+		}
+	}
+	return ""
+}
+
+// allows reports whether a version satisfies the clause
+func (cl clause) allows(v []int) bool {
+	switch cl.op {
+	case "==":
+		if cl.wildcard {
+			return hasPrefix(v, cl.version)
+		}
+		return compareVersions(v, cl.version) == 0
+	case "!=":
+		if cl.wildcard {
+			return !hasPrefix(v, cl.version)
+		}
+		return compareVersions(v, cl.version) != 0
+	case "<":
+		return compareVersions(v, cl.version) < 0
+	case "<=":
+		return compareVersions(v, cl.version) <= 0
+	case ">":
+		return compareVersions(v, cl.version) > 0
+	case ">=":
+		return compareVersions(v, cl.version) >= 0
+	case "~=":
+		// ~=3.10.2 is >=3.10.2,==3.10.*
+		return compareVersions(v, cl.version) >= 0 && hasPrefix(v, cl.version[:len(cl.version)-1])
+	}
+	return false
+}
+
+// parseVersion splits a release version such as 3.12.1 into its numbers
+func parseVersion(s string) ([]int, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing version")
+	}
+	fields := strings.Split(s, ".")
+	version := make([]int, len(fields))
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%q is not a release version", s)
+		}
+		version[i] = n
+	}
+	return version, nil
+}
+
+// formatVersion joins version numbers with dots
+func formatVersion(version []int) string {
+	fields := make([]string, len(version))
+	for i, n := range version {
+		fields[i] = strconv.Itoa(n)
+	}
+	return strings.Join(fields, ".")
+}
+
+// compareVersions orders versions numerically, padding the shorter with
+// zeros, so 3.10 equals 3.10.0 and comes after 3.9.18
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// hasPrefix reports whether a version starts with the segments of prefix
+func hasPrefix(v, prefix []int) bool {
+	if len(v) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if v[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,13 +1,20 @@
 package runtime
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/httpclient"
 	"github.com/schollz/progressbar/v3"
 )
 
@@ -18,22 +25,30 @@ const (
 	// pythonBuildDate is the release date to use
 	// TODO: Make this configurable or fetch latest
 	pythonBuildDate = "20240107"
-
-	// nodejsDistURL is the base URL for official Node.js distributions
-	nodejsDistURL = "https://nodejs.org/dist"
 )
 
+// nodejsDistURL is the base URL for official Node.js distributions; tests
+// point it elsewhere
+var nodejsDistURL = "https://nodejs.org/dist"
+
+// pythonReleaseAPI is the GitHub API URL of python-build-standalone releases
+// by tag
+var pythonReleaseAPI = "https://api.github.com/repos/astral-sh/python-build-standalone/releases/tags/"
+
 // Downloader handles downloading Python runtimes
 type Downloader struct {
-	cacheDir string
-	platform Platform
+	cacheDir     string
+	releaseCache string // Where GitHub release metadata is cached
+	platform     Platform
 }
 
-// NewDownloader creates a new downloader
-func NewDownloader(cacheDir string) *Downloader {
+// NewDownloader creates a new downloader keeping downloads in cacheDir and
+// the GitHub releases it reads in releaseCache
+func NewDownloader(cacheDir, releaseCache string) *Downloader {
 	return &Downloader{
-		cacheDir: cacheDir,
-		platform: DetectPlatform(),
+		cacheDir:     cacheDir,
+		releaseCache: releaseCache,
+		platform:     DetectPlatform(),
 	}
 }
 
@@ -72,12 +87,15 @@ func (d *Downloader) Download(version string) (string, error) {
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to download: %w", err)
+		return "", errcode.Wrap(errcode.Network, fmt.Errorf("failed to download: %w", err))
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errcode.Errorf(errcode.NotFound, "no Python %s build for %s in python-build-standalone release %s", version, d.platform, pythonBuildDate)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("download failed with status: %d", resp.StatusCode)
+		return "", errcode.Errorf(errcode.Network, "download failed with status: %d", resp.StatusCode)
 	}
 
 	// Create output file
@@ -94,16 +112,57 @@ func (d *Downloader) Download(version string) (string, error) {
 	)
 
 	// Copy with progress
-	_, err = io.Copy(io.MultiWriter(out, bar), resp.Body)
+	_, err = io.Copy(io.MultiWriter(out, bar), httpclient.Throttle(context.Background(), resp.Body))
 	if err != nil {
 		os.Remove(outputPath) // Clean up partial download
-		return "", fmt.Errorf("download failed: %w", err)
+		return "", errcode.Wrap(errcode.Network, fmt.Errorf("download failed: %w", err))
 	}
 
 	fmt.Println() // New line after progress bar
 	return outputPath, nil
 }
 
+// AvailableVersions lists the Python versions the python-build-standalone
+// release ophid downloads from has builds of for this platform
+func (d *Downloader) AvailableVersions() ([]string, error) {
+	if !d.platform.IsSupported() {
+		return nil, fmt.Errorf("unsupported platform: %s", d.platform)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	data, err := fetchPythonRelease(ctx, d.releaseCache, pythonBuildDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var release struct {
+		Assets []struct {
+			Name string `json:"name"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, fmt.Errorf("failed to parse release data: %w", err)
+	}
+
+	// Same file names as buildURL: cpython-{version}+{date}-{triple}-install_only.tar.gz
+	suffix := fmt.Sprintf("+%s-%s-install_only.tar.gz", pythonBuildDate, d.platform.ToPythonBuildStandalone())
+	var versions []string
+	for _, asset := range release.Assets {
+		name, ok := strings.CutPrefix(asset.Name, "cpython-")
+		if !ok {
+			continue
+		}
+		if version, ok := strings.CutSuffix(name, suffix); ok && !slices.Contains(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, errcode.Errorf(errcode.NotFound, "release %s has no Python builds for %s", pythonBuildDate, d.platform)
+	}
+	return versions, nil
+}
+
 // buildURL builds the download URL for a specific Python version
 func (d *Downloader) buildURL(version string) string {
 	// Format: cpython-{version}+{date}-{triple}-install_only.tar.gz
@@ -158,12 +217,15 @@ func (d *Downloader) DownloadNodeJS(version string, platform Platform) (string,
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to download: %w", err)
+		return "", errcode.Wrap(errcode.Network, fmt.Errorf("failed to download: %w", err))
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errcode.Errorf(errcode.NotFound, "no Node.js %s build for %s at %s/v%s/", version, platform, nodejsDistURL, version)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("download failed with status: %d", resp.StatusCode)
+		return "", errcode.Errorf(errcode.Network, "download failed with status: %d", resp.StatusCode)
 	}
 
 	// Create output file
@@ -180,10 +242,10 @@ func (d *Downloader) DownloadNodeJS(version string, platform Platform) (string,
 	)
 
 	// Copy with progress
-	_, err = io.Copy(io.MultiWriter(out, bar), resp.Body)
+	_, err = io.Copy(io.MultiWriter(out, bar), httpclient.Throttle(context.Background(), resp.Body))
 	if err != nil {
 		os.Remove(outputPath) // Clean up partial download
-		return "", fmt.Errorf("download failed: %w", err)
+		return "", errcode.Wrap(errcode.Network, fmt.Errorf("download failed: %w", err))
 	}
 
 	fmt.Println() // New line after progress bar
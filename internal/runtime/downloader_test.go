@@ -0,0 +1,37 @@
+package runtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func TestDownloadNodeJSNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	oldDist := nodejsDistURL
+	nodejsDistURL = srv.URL + "/dist"
+	t.Cleanup(func() { nodejsDistURL = oldDist })
+
+	cache := t.TempDir()
+	d := NewDownloader(cache, "")
+	_, err := d.DownloadNodeJS("99.0.0", Platform{OS: "linux", Arch: "x86_64"})
+	if errcode.Of(err) != errcode.NotFound {
+		t.Fatalf("DownloadNodeJS() of a missing version = %v, want not found", err)
+	}
+	for _, want := range []string{"Node.js 99.0.0", "linux/x86_64", srv.URL + "/dist/v99.0.0/"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't name %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "Python") {
+		t.Errorf("error %q talks about Python", err)
+	}
+	if entries, _ := os.ReadDir(cache); len(entries) != 0 {
+		t.Errorf("a failed download left %d file(s) in the cache", len(entries))
+	}
+}
@@ -2,116 +2,413 @@ package runtime
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"archive/zip"
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
 )
 
-// Extractor handles extracting tar.gz archives
-type Extractor struct{}
+// maxBufferedFile is the size up to which a file is read into memory and
+// written by a worker while the archive is read on; larger ones are written
+// as they are read
+const maxBufferedFile = 1 << 20
+
+// Extractor extracts runtime archives: tar, compressed with gzip, zstd or
+// xz or not at all, and zip. The format comes from the archive's first
+// bytes, not its name.
+type Extractor struct {
+	workers int // Goroutines writing files
+}
 
 // NewExtractor creates a new extractor
 func NewExtractor() *Extractor {
-	return &Extractor{}
+	return &Extractor{workers: min(runtime.NumCPU(), 8)}
+}
+
+// Archive formats, by their magic bytes
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zipMagic  = []byte{'P', 'K', 0x03, 0x04}
+	// tarMagic is at offset 257 of a tar header; "ustar\x00" for POSIX
+	// archives, "ustar " for GNU ones
+	tarMagic = []byte("ustar")
+)
+
+// fileJob is a file read from the archive, waiting to be written
+type fileJob struct {
+	name   string
+	target string
+	mode   fs.FileMode
+	mtime  time.Time
+	data   []byte
 }
 
-// Extract extracts a tar.gz file to the destination directory
-func (e *Extractor) Extract(tarballPath, destDir string) error {
-	// Open the tarball
-	file, err := os.Open(tarballPath)
+// dirEntry is a directory of the archive, whose mode and time are set once
+// everything in it is written
+type dirEntry struct {
+	name  string
+	mode  fs.FileMode
+	mtime time.Time
+}
+
+// Extract extracts an archive to the destination directory. Files keep
+// their permissions and modification times and hard links stay links.
+// When every entry is under one top-level directory, like python/ or
+// node-v20.11.0-linux-x64/, its contents are extracted into destDir.
+func (e *Extractor) Extract(archivePath, destDir string) error {
+	file, err := os.Open(archivePath)
 	if err != nil {
-		return fmt.Errorf("failed to open tarball: %w", err)
+		return fmt.Errorf("failed to open archive: %w", err)
 	}
 	defer file.Close()
 
-	// Create gzip reader
-	gzr, err := gzip.NewReader(file)
-	if err != nil {
-		return fmt.Errorf("failed to create gzip reader: %w", err)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	head = head[:n]
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
 	}
-	defer gzr.Close()
-
-	// Create tar reader
-	tr := tar.NewReader(gzr)
 
 	// Create destination directory
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return fmt.Errorf("failed to create destination dir: %w", err)
 	}
 
-	// Extract files
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break // End of archive
+	var dirs []dirEntry
+	switch {
+	case bytes.HasPrefix(head, zipMagic):
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		dirs, err = e.extractZip(file, info.Size(), destDir)
+		if err != nil {
+			return err
+		}
+
+	case bytes.HasPrefix(head, gzipMagic):
+		// Decompress ahead of the tar reader, on other cores
+		gzr, err := pgzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		defer gzr.Close()
+		if dirs, err = e.extractTar(tar.NewReader(gzr), destDir); err != nil {
+			return err
 		}
+
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(file)
 		if err != nil {
-			return fmt.Errorf("failed to read tar header: %w", err)
+			return fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		defer zr.Close()
+		if dirs, err = e.extractTar(tar.NewReader(zr), destDir); err != nil {
+			return err
 		}
 
-		// Construct target path
-		target := filepath.Join(destDir, header.Name)
+	case bytes.HasPrefix(head, xzMagic):
+		xr, err := xz.NewReader(bufio.NewReader(file))
+		if err != nil {
+			return fmt.Errorf("failed to create xz reader: %w", err)
+		}
+		if dirs, err = e.extractTar(tar.NewReader(xr), destDir); err != nil {
+			return err
+		}
 
-		// Security: Prevent path traversal
-		if !strings.HasPrefix(target, filepath.Clean(destDir)+string(os.PathSeparator)) {
-			return fmt.Errorf("illegal file path: %s", header.Name)
+	case len(head) >= 262 && bytes.Equal(head[257:262], tarMagic):
+		if dirs, err = e.extractTar(tar.NewReader(file), destDir); err != nil {
+			return err
 		}
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			// Create directory
-			if err := os.MkdirAll(target, 0755); err != nil {
-				return fmt.Errorf("failed to create directory: %w", err)
+	default:
+		return fmt.Errorf("%s isn't a tar (gzip, zstd or xz compressed or not) or zip archive", filepath.Base(archivePath))
+	}
+
+	top, err := flattenSingleDir(destDir)
+	if err != nil {
+		return err
+	}
+
+	// Deepest first, so neither a read-only mode nor a time set on a
+	// directory is undone by its subdirectories
+	slices.SortFunc(dirs, func(a, b dirEntry) int { return strings.Compare(b.name, a.name) })
+	for _, dir := range dirs {
+		name := filepath.Clean(filepath.FromSlash(dir.name))
+		if top != "" {
+			rest, ok := strings.CutPrefix(name, top+string(os.PathSeparator))
+			if !ok {
+				continue // The top-level directory itself, now destDir
 			}
+			name = rest
+		}
+		target := filepath.Join(destDir, name)
+		if err := os.Chmod(target, dir.mode); err != nil {
+			return fmt.Errorf("failed to set mode of %s: %w", dir.name, err)
+		}
+		os.Chtimes(target, dir.mtime, dir.mtime)
+	}
+	return nil
+}
 
-		case tar.TypeReg:
-			// Create file
-			if err := e.extractFile(tr, target, header); err != nil {
-				return fmt.Errorf("failed to extract file %s: %w", header.Name, err)
+// extractTar extracts a tar archive into destDir, handing files to workers
+// that write them while the archive is read on. It returns the directories
+// whose attributes are left to set.
+func (e *Extractor) extractTar(tr *tar.Reader, destDir string) ([]dirEntry, error) {
+	jobs := make(chan fileJob, e.workers*4)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var writeErr error
+	for range e.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := writeFile(job.target, job.mode, job.mtime, bytes.NewReader(job.data)); err != nil {
+					mu.Lock()
+					if writeErr == nil {
+						writeErr = fmt.Errorf("failed to extract file %s: %w", job.name, err)
+					}
+					mu.Unlock()
+				}
 			}
+		}()
+	}
+	failed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return writeErr
+	}
 
-		case tar.TypeSymlink:
-			// Create symlink
-			if err := e.extractSymlink(target, header); err != nil {
-				return fmt.Errorf("failed to create symlink %s: %w", header.Name, err)
+	// Hard links wait for every file to be written
+	var links []*tar.Header
+	var dirs []dirEntry
+	err := func() error {
+		defer func() {
+			close(jobs)
+			wg.Wait()
+		}()
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil // End of archive
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read tar header: %w", err)
+			}
+			if err := failed(); err != nil {
+				return err
+			}
+
+			target, err := extractTarget(destDir, header.Name)
+			if err != nil {
+				return err
+			}
+			mode := header.FileInfo().Mode().Perm()
+
+			switch header.Typeflag {
+			case tar.TypeDir:
+				// Kept writable until the files in it are written
+				if err := os.MkdirAll(target, 0755); err != nil {
+					return fmt.Errorf("failed to create directory: %w", err)
+				}
+				dirs = append(dirs, dirEntry{header.Name, mode, header.ModTime})
+
+			case tar.TypeReg:
+				if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+					return fmt.Errorf("failed to create directory: %w", err)
+				}
+				if header.Size > maxBufferedFile {
+					if err := writeFile(target, mode, header.ModTime, tr); err != nil {
+						return fmt.Errorf("failed to extract file %s: %w", header.Name, err)
+					}
+					continue
+				}
+				data := make([]byte, header.Size)
+				if _, err := io.ReadFull(tr, data); err != nil {
+					return fmt.Errorf("failed to read file %s: %w", header.Name, err)
+				}
+				jobs <- fileJob{name: header.Name, target: target, mode: mode, mtime: header.ModTime, data: data}
+
+			case tar.TypeLink:
+				if _, err := extractTarget(destDir, header.Linkname); err != nil {
+					return fmt.Errorf("illegal hard link: %s -> %s", header.Name, header.Linkname)
+				}
+				links = append(links, header)
+
+			case tar.TypeSymlink:
+				// Create symlink
+				if err := e.extractSymlink(target, header.Linkname); err != nil {
+					return fmt.Errorf("failed to create symlink %s: %w", header.Name, err)
+				}
+
+			default:
+				// Skip other types (char devices, block devices, etc.)
+				fmt.Printf("  skipping: %s (type %c)\n", header.Name, header.Typeflag)
+			}
+		}
+	}()
+	if err == nil {
+		err = failed()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, header := range links {
+		if err := extractHardLink(filepath.Join(destDir, header.Name), filepath.Join(destDir, header.Linkname)); err != nil {
+			return nil, fmt.Errorf("failed to create hard link %s: %w", header.Name, err)
+		}
+	}
+	return dirs, nil
+}
+
+// extractZip extracts a zip archive into destDir and returns the
+// directories whose attributes are left to set
+func (e *Extractor) extractZip(r io.ReaderAt, size int64, destDir string) ([]dirEntry, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip archive: %w", err)
+	}
+
+	var dirs []dirEntry
+	for _, f := range zr.File {
+		target, err := extractTarget(destDir, f.Name)
+		if err != nil {
+			return nil, err
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create directory: %w", err)
+			}
+			dirs = append(dirs, dirEntry{f.Name, mode.Perm(), f.Modified})
+
+		case mode&fs.ModeSymlink != 0:
+			// A zip symlink's content is its target
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			linkname, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			if err := e.extractSymlink(target, string(linkname)); err != nil {
+				return nil, fmt.Errorf("failed to create symlink %s: %w", f.Name, err)
 			}
 
 		default:
-			// Skip other types (char devices, block devices, etc.)
-			fmt.Printf("  skipping: %s (type %c)\n", header.Name, header.Typeflag)
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create directory: %w", err)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			err = writeFile(target, mode.Perm(), f.Modified, rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to extract file %s: %w", f.Name, err)
+			}
 		}
 	}
+	return dirs, nil
+}
 
-	return nil
+// extractTarget returns where an archive entry goes in destDir, refusing
+// names that would land outside it
+func extractTarget(destDir, name string) (string, error) {
+	target := filepath.Join(destDir, filepath.FromSlash(name))
+	// Security: Prevent path traversal
+	if !strings.HasPrefix(target, filepath.Clean(destDir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal file path: %s", name)
+	}
+	return target, nil
 }
 
-// extractFile extracts a single file from the tar archive
-func (e *Extractor) extractFile(tr *tar.Reader, target string, header *tar.Header) error {
-	// Ensure parent directory exists
-	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+// writeFile writes a file from r with its mode and modification time
+func writeFile(target string, mode fs.FileMode, mtime time.Time, r io.Reader) error {
+	// Remove a file a link may share first, rather than write through it
+	os.Remove(target)
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
 		return err
 	}
 
-	// Create the file
-	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
-	if err != nil {
+	// OpenFile's mode is subject to the umask; set it as the archive has it
+	if err := os.Chmod(target, mode); err != nil {
 		return err
 	}
-	defer file.Close()
+	return os.Chtimes(target, mtime, mtime)
+}
 
-	// Copy contents
-	if _, err := io.Copy(file, tr); err != nil {
+// extractHardLink links target to the file linked, written before, or
+// copies it where the filesystem has no hard links
+func extractHardLink(target, linked string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
 		return err
 	}
+	os.Remove(target)
+	if err := os.Link(linked, target); err == nil {
+		return nil
+	}
 
-	return nil
+	src, err := os.Open(linked)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm()|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(target, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
 }
 
 // extractSymlink creates a symbolic link
-func (e *Extractor) extractSymlink(target string, header *tar.Header) error {
+func (e *Extractor) extractSymlink(target, linkname string) error {
 	// Ensure parent directory exists
 	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
 		return err
@@ -121,9 +418,41 @@ func (e *Extractor) extractSymlink(target string, header *tar.Header) error {
 	os.Remove(target)
 
 	// Create symlink
-	if err := os.Symlink(header.Linkname, target); err != nil {
+	if err := os.Symlink(linkname, target); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// flattenSingleDir moves the contents of dir's only entry, when that is a
+// directory, into dir, and returns that directory's name
+func flattenSingleDir(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return "", nil
+	}
+
+	// Renamed first, in case it holds an entry of its own name
+	top, err := os.MkdirTemp(dir, ".extract-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	os.Remove(top)
+	if err := os.Rename(filepath.Join(dir, entries[0].Name()), top); err != nil {
+		return "", fmt.Errorf("failed to move %s: %w", entries[0].Name(), err)
+	}
+	children, err := os.ReadDir(top)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", top, err)
+	}
+	for _, child := range children {
+		if err := os.Rename(filepath.Join(top, child.Name()), filepath.Join(dir, child.Name())); err != nil {
+			return "", fmt.Errorf("failed to move %s: %w", child.Name(), err)
+		}
+	}
+	return entries[0].Name(), os.Remove(top)
+}
@@ -0,0 +1,192 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// githubReleaseTTL is how long a cached release is used before GitHub is
+// asked whether it changed. Revalidating with the ETag doesn't count
+// against the rate limit when nothing changed.
+const githubReleaseTTL = time.Hour
+
+// RateLimitError is GitHub refusing API requests until its rate limit
+// resets: 60 an hour without a token, 5000 with GITHUB_TOKEN
+type RateLimitError struct {
+	Reset         time.Time // When requests are allowed again; zero if GitHub didn't say
+	Authenticated bool      // Whether the requests carried GITHUB_TOKEN
+}
+
+func (e *RateLimitError) Error() string {
+	msg := "GitHub API rate limit exceeded"
+	if !e.Reset.IsZero() {
+		msg += " until " + e.Reset.Local().Format("15:04")
+	}
+	if !e.Authenticated {
+		msg += "; set GITHUB_TOKEN to raise it"
+	}
+	return msg
+}
+
+// releaseCacheEntry is a cached GitHub release
+type releaseCacheEntry struct {
+	ETag      string          `json:"etag,omitempty"`
+	CheckedAt time.Time       `json:"checked_at"` // When GitHub last confirmed it
+	Body      json.RawMessage `json:"body"`
+}
+
+// githubToken returns the token GitHub API requests authenticate with, if
+// any
+func githubToken() string {
+	return os.Getenv("GITHUB_TOKEN")
+}
+
+// fetchPythonRelease returns the GitHub API document of a
+// python-build-standalone release. Answers are cached in cacheDir for
+// githubReleaseTTL, then revalidated with their ETag; a stale answer is
+// used when GitHub can't be reached or rate limits the request. An empty
+// cacheDir disables the cache.
+func fetchPythonRelease(ctx context.Context, cacheDir, tag string) ([]byte, error) {
+	var cached *releaseCacheEntry
+	path := filepath.Join(cacheDir, "python-build-standalone-"+tag+".json")
+	if cacheDir != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			var entry releaseCacheEntry
+			if err := json.Unmarshal(data, &entry); err == nil && len(entry.Body) > 0 {
+				cached = &entry
+			}
+		}
+	}
+	if cached != nil && time.Since(cached.CheckedAt) < githubReleaseTTL {
+		return cached.Body, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", pythonReleaseAPI+tag, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	// Set user agent (GitHub API requires it)
+	req.Header.Set("User-Agent", "ophid")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	token := githubToken()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		if cached != nil && ctx.Err() == nil {
+			slog.Debug("using cached GitHub release", "release", tag, "checked_at", cached.CheckedAt, "error", err)
+			return cached.Body, nil
+		}
+		return nil, errcode.Wrap(errcode.Network, fmt.Errorf("failed to fetch release %s: %w", tag, err))
+	}
+	defer resp.Body.Close()
+
+	var entry releaseCacheEntry
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		entry = *cached
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errcode.Errorf(errcode.NotFound, "python-build-standalone release %s not found on GitHub", tag)
+	case rateLimited(resp):
+		limitErr := &RateLimitError{Reset: rateLimitReset(resp), Authenticated: token != ""}
+		if cached != nil {
+			slog.Warn("using cached GitHub release", "release", tag, "checked_at", cached.CheckedAt, "error", limitErr)
+			return cached.Body, nil
+		}
+		return nil, errcode.Wrap(errcode.Network, limitErr)
+	case resp.StatusCode == http.StatusUnauthorized && token != "":
+		return nil, fmt.Errorf("GitHub rejected GITHUB_TOKEN (status %d)", resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return nil, errcode.Errorf(errcode.Network, "GitHub API returned status %d for release %s", resp.StatusCode, tag)
+	default:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, errcode.Wrap(errcode.Network, fmt.Errorf("failed to read release %s: %w", tag, err))
+		}
+		if !json.Valid(body) {
+			return nil, fmt.Errorf("failed to parse release data: invalid JSON")
+		}
+		entry = releaseCacheEntry{ETag: resp.Header.Get("ETag"), Body: body}
+	}
+	entry.CheckedAt = time.Now()
+
+	if cacheDir != "" {
+		if err := writeReleaseCache(path, &entry); err != nil {
+			slog.Debug("failed to cache GitHub release", "release", tag, "error", err)
+		}
+	}
+	return entry.Body, nil
+}
+
+// rateLimited reports whether GitHub refused a request for its primary
+// rate limit (no requests remaining) or a secondary one (Retry-After)
+func rateLimited(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		resp.Header.Get("X-RateLimit-Remaining") == "0" ||
+		resp.Header.Get("Retry-After") != ""
+}
+
+// rateLimitReset returns when a rate limited request may be retried
+func rateLimitReset(resp *http.Response) time.Time {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	if epoch, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		return time.Unix(epoch, 0)
+	}
+	return time.Time{}
+}
+
+// IsRateLimited reports whether err comes from GitHub's rate limit
+func IsRateLimited(err error) bool {
+	var limitErr *RateLimitError
+	return errors.As(err, &limitErr)
+}
+
+// writeReleaseCache writes a cache entry through a temporary file, as
+// installs may run concurrently
+func writeReleaseCache(path string, entry *releaseCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".release-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
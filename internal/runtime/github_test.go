@@ -0,0 +1,94 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func TestFetchPythonRelease(t *testing.T) {
+	var requests, revalidated int
+	var auth string
+	limited := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		auth = r.Header.Get("Authorization")
+		switch {
+		case limited:
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "1700000000")
+			w.WriteHeader(http.StatusForbidden)
+		case !strings.HasSuffix(r.URL.Path, "/20240107"):
+			http.NotFound(w, r)
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(`{"tag_name": "20240107"}`))
+		}
+	}))
+	defer srv.Close()
+	oldAPI := pythonReleaseAPI
+	pythonReleaseAPI = srv.URL + "/releases/tags/"
+	t.Cleanup(func() { pythonReleaseAPI = oldAPI })
+	t.Setenv("GITHUB_TOKEN", "")
+
+	cache := t.TempDir()
+	fetch := func(tag string) ([]byte, error) {
+		return fetchPythonRelease(context.Background(), cache, tag)
+	}
+	// expire makes the cached release older than the TTL
+	expire := func() {
+		path := filepath.Join(cache, "python-build-standalone-20240107.json")
+		var entry releaseCacheEntry
+		data, _ := os.ReadFile(path)
+		json.Unmarshal(data, &entry)
+		entry.CheckedAt = time.Now().Add(-githubReleaseTTL)
+		data, _ = json.Marshal(entry)
+		os.WriteFile(path, data, 0644)
+	}
+
+	if body, err := fetch("20240107"); err != nil || !strings.Contains(string(body), "20240107") || requests != 1 {
+		t.Fatalf("first fetch = %s, %v after %d requests", body, err, requests)
+	}
+	if _, err := fetch("20240107"); err != nil || requests != 1 {
+		t.Errorf("cached fetch = %v after %d requests, want no request", err, requests)
+	}
+	expire()
+	t.Setenv("GITHUB_TOKEN", "secret")
+	if _, err := fetch("20240107"); err != nil || requests != 2 || revalidated != 1 {
+		t.Errorf("expired fetch = %v after %d requests, %d revalidated", err, requests, revalidated)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the GITHUB_TOKEN", auth)
+	}
+
+	if _, err := fetch("19700101"); errcode.Of(err) != errcode.NotFound || IsRateLimited(err) {
+		t.Errorf("missing release = %v, want not found", err)
+	}
+
+	// Rate limited, a cached release is still used; an uncached one fails
+	// saying so
+	limited = true
+	expire()
+	if _, err := fetch("20240107"); err != nil {
+		t.Errorf("rate limited fetch of a cached release = %v", err)
+	}
+	_, err := fetch("20240108")
+	if !IsRateLimited(err) || errcode.Of(err) != errcode.Network || strings.Contains(err.Error(), "GITHUB_TOKEN") {
+		t.Errorf("rate limited fetch = %v, want a rate limit error with a token in use", err)
+	}
+	t.Setenv("GITHUB_TOKEN", "")
+	if _, err := fetch("20240108"); err == nil || !strings.Contains(err.Error(), "set GITHUB_TOKEN") {
+		t.Errorf("rate limited fetch without a token = %v, want a hint to set GITHUB_TOKEN", err)
+	}
+}
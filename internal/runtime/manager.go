@@ -7,6 +7,10 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/store"
+	"github.com/gleicon/ophid/internal/ui"
 )
 
 // Runtime represents a runtime interpreter installation (Python, Node, Bun, etc.)
@@ -31,12 +35,13 @@ type Manager struct {
 // NewManager creates a new runtime manager
 func NewManager(homeDir string) *Manager {
 	cacheDir := filepath.Join(homeDir, "cache", "downloads")
+	releaseCache := filepath.Join(homeDir, "cache", "github")
 	platform := DetectPlatform()
 
 	return &Manager{
 		homeDir:    homeDir,
-		downloader: NewDownloader(cacheDir),
-		verifier:   NewVerifier(),
+		downloader: NewDownloader(cacheDir, releaseCache),
+		verifier:   NewVerifier(releaseCache),
 		extractor:  NewExtractor(),
 		platform:   platform,
 	}
@@ -83,6 +88,8 @@ func (m *Manager) InstallFromSpec(spec *RuntimeSpec) (*Runtime, error) {
 		return m.installPython(spec, runtimePath)
 	case RuntimeNode:
 		return m.installNodeJS(spec, runtimePath)
+	case RuntimeRust:
+		return m.installRust(spec, runtimePath)
 	default:
 		return nil, fmt.Errorf("runtime type %s is not yet implemented", spec.Type.DisplayName())
 	}
@@ -99,16 +106,25 @@ func (m *Manager) installPython(spec *RuntimeSpec, runtimePath string) (*Runtime
 	// Verify checksum
 	slog.Info("verifying download integrity", "file", tarballPath)
 	if err := m.verifier.VerifyFileExists(tarballPath); err != nil {
-		return nil, fmt.Errorf("verification failed: %w", err)
+		return nil, errcode.Wrap(errcode.Verification, fmt.Errorf("verification failed: %w", err))
 	}
 
 	// Get expected SHA256 hash from GitHub releases
 	expectedHash, err := m.verifier.GetSHA256ForVersion(spec.Version, m.platform, pythonBuildDate)
-	if err != nil {
+	switch {
+	case IsRateLimited(err):
+		slog.Warn("GitHub rate limits checksum lookups, skipping integrity check",
+			"error", err,
+			"version", spec.Version)
+	case errcode.Of(err) == errcode.NotFound:
+		slog.Warn("no published SHA256 hash for this build, skipping integrity check",
+			"error", err,
+			"version", spec.Version)
+	case err != nil:
 		slog.Warn("failed to fetch SHA256 hash, skipping integrity check",
 			"error", err,
 			"version", spec.Version)
-	} else {
+	default:
 		// Verify SHA256 hash
 		slog.Info("verifying SHA256 checksum", "version", spec.Version)
 		if err := m.verifier.VerifySHA256(tarballPath, expectedHash); err != nil {
@@ -118,24 +134,51 @@ func (m *Manager) installPython(spec *RuntimeSpec, runtimePath string) (*Runtime
 	}
 
 	// Extract to ~/.ophid/runtimes
+	return m.extractRuntime(spec, tarballPath, runtimePath)
+}
+
+// extractRuntime extracts a downloaded runtime into runtimePath and checks
+// its interpreter runs, removing it again when either fails so that a
+// broken install isn't taken for an installed runtime
+func (m *Manager) extractRuntime(spec *RuntimeSpec, tarballPath, runtimePath string) (*Runtime, error) {
 	slog.Info("extracting runtime", "type", spec.Type.DisplayName(), "destination", runtimePath)
+	started := time.Now()
 	if err := m.extractor.Extract(tarballPath, runtimePath); err != nil {
+		os.RemoveAll(runtimePath)
 		return nil, fmt.Errorf("extraction failed: %w", err)
 	}
+	slog.Info("runtime extracted", "duration", time.Since(started))
 
-	slog.Info("runtime installed successfully",
-		"type", spec.Type.DisplayName(),
-		"version", spec.Version,
-		"path", runtimePath)
-
-	return &Runtime{
+	rt := &Runtime{
 		Type:       spec.Type,
 		Version:    spec.Version,
 		Path:       runtimePath,
 		OS:         m.platform.OS,
 		Arch:       m.platform.Arch,
 		Downloaded: time.Now(),
-	}, nil
+	}
+	if err := m.Check(rt); err != nil {
+		os.RemoveAll(runtimePath)
+		return nil, fmt.Errorf("extracted runtime doesn't run: %w", err)
+	}
+
+	// Keep the archive and the runtime's files under their hashes, shared
+	// with identical copies
+	st := store.NewStore(m.homeDir)
+	if _, err := st.ShareFile(tarballPath); err != nil {
+		slog.Warn("failed to share the runtime archive with the store", "path", tarballPath, "error", err)
+	}
+	if stats, err := st.Share(runtimePath); err != nil {
+		slog.Warn("failed to share the runtime with the store", "path", runtimePath, "error", err)
+	} else if stats.Files > 0 {
+		slog.Info("shared runtime files with the store", "files", stats.Files, "bytes", stats.Bytes)
+	}
+
+	slog.Info("runtime installed successfully",
+		"type", spec.Type.DisplayName(),
+		"version", spec.Version,
+		"path", runtimePath)
+	return rt, nil
 }
 
 // installNodeJS installs Node.js runtime from official distributions
@@ -149,28 +192,11 @@ func (m *Manager) installNodeJS(spec *RuntimeSpec, runtimePath string) (*Runtime
 	// Verify file exists
 	slog.Info("verifying download integrity", "file", tarballPath)
 	if err := m.verifier.VerifyFileExists(tarballPath); err != nil {
-		return nil, fmt.Errorf("verification failed: %w", err)
+		return nil, errcode.Wrap(errcode.Verification, fmt.Errorf("verification failed: %w", err))
 	}
 
 	// Extract to ~/.ophid/runtimes
-	slog.Info("extracting runtime", "type", spec.Type.DisplayName(), "destination", runtimePath)
-	if err := m.extractor.Extract(tarballPath, runtimePath); err != nil {
-		return nil, fmt.Errorf("extraction failed: %w", err)
-	}
-
-	slog.Info("runtime installed successfully",
-		"type", spec.Type.DisplayName(),
-		"version", spec.Version,
-		"path", runtimePath)
-
-	return &Runtime{
-		Type:       spec.Type,
-		Version:    spec.Version,
-		Path:       runtimePath,
-		OS:         m.platform.OS,
-		Arch:       m.platform.Arch,
-		Downloaded: time.Now(),
-	}, nil
+	return m.extractRuntime(spec, tarballPath, runtimePath)
 }
 
 // List lists installed runtimes (Python, Node, Bun, etc.)
@@ -235,7 +261,7 @@ func (m *Manager) Get(specString string) (*Runtime, error) {
 	runtimePath := filepath.Join(m.homeDir, "runtimes", fmt.Sprintf("%s-%s", spec.Type, spec.Version))
 
 	if _, err := os.Stat(runtimePath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("%s %s is not installed", spec.Type.DisplayName(), spec.Version)
+		return nil, errcode.Errorf(errcode.NotFound, "%s %s is not installed", spec.Type.DisplayName(), spec.Version)
 	}
 
 	info, err := os.Stat(runtimePath)
@@ -265,34 +291,101 @@ func (m *Manager) Remove(specString string) error {
 	runtimePath := filepath.Join(m.homeDir, "runtimes", fmt.Sprintf("%s-%s", spec.Type, spec.Version))
 
 	if _, err := os.Stat(runtimePath); os.IsNotExist(err) {
-		return fmt.Errorf("%s %s is not installed", spec.Type.DisplayName(), spec.Version)
+		return errcode.Errorf(errcode.NotFound, "%s %s is not installed", spec.Type.DisplayName(), spec.Version)
 	}
 
 	if err := os.RemoveAll(runtimePath); err != nil {
 		return fmt.Errorf("failed to remove runtime: %w", err)
 	}
+	// Free the stored files only the runtime linked to
+	if _, _, err := store.NewStore(m.homeDir).Prune(); err != nil {
+		slog.Warn("failed to prune the store", "error", err)
+	}
 
 	slog.Info("runtime removed",
 		"type", spec.Type.DisplayName(),
 		"version", spec.Version,
 		"path", runtimePath)
 
-	fmt.Printf("✓ %s %s removed\n", spec.Type.DisplayName(), spec.Version)
+	ui.Success("%s %s removed", spec.Type.DisplayName(), spec.Version)
 	return nil
 }
 
-// EnsureRuntime ensures a Python runtime matching requirements is available
+// FindPython returns the newest installed Python runtime satisfying a
+// requirement: an exact version like 3.11.7, a prefix like 3.11 or a
+// constraint like ">=3.10,<3.13" (see ParseConstraint). An empty
+// requirement finds the newest Python installed.
+func (m *Manager) FindPython(requirement string) (*Runtime, error) {
+	constraint, err := ParseConstraint(requirement)
+	if err != nil {
+		return nil, err
+	}
+	runtimes, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	var found *Runtime
+	for _, rt := range runtimes {
+		if rt.Type == RuntimePython && constraint.Allows(rt.Version) && (found == nil || newerVersion(rt.Version, found.Version)) {
+			found = rt
+		}
+	}
+	if found == nil && requirement == "" {
+		return nil, errcode.Errorf(errcode.NotFound, "no Python runtime installed")
+	}
+	if found == nil {
+		return nil, errcode.Errorf(errcode.NotFound, "no installed Python satisfies %s", requirement)
+	}
+	return found, nil
+}
+
+// EnsureRuntime returns the newest installed Python runtime satisfying a
+// requirement (see FindPython). When none does, it installs the newest
+// Python of the python-build-standalone release that does.
 func (m *Manager) EnsureRuntime(requirement string) (*Runtime, error) {
-	// TODO: Parse requirement (e.g., ">=3.10,<4")
-	// For now, just use the requirement as an exact version
-	version := requirement
+	rt, err := m.FindPython(requirement)
+	if errcode.Of(err) != errcode.NotFound {
+		return rt, err
+	}
+	constraint, err := ParseConstraint(requirement)
+	if err != nil {
+		return nil, err
+	}
 
-	// Check if already installed
-	runtime, err := m.Get(version)
-	if err == nil {
-		return runtime, nil
+	var version string
+	available, err := m.downloader.AvailableVersions()
+	switch {
+	case err != nil && constraint.Exact() == "":
+		return nil, fmt.Errorf("failed to list the Python versions available: %w", err)
+	case err != nil:
+		// An exact version can be installed without the list, as before
+		slog.Warn("failed to list the Python versions available", "error", err)
+		version = constraint.Exact()
+	default:
+		for _, v := range available {
+			if constraint.Allows(v) && (version == "" || newerVersion(v, version)) {
+				version = v
+			}
+		}
+		if version == "" {
+			return nil, errcode.Errorf(errcode.NotFound, "no Python release satisfies %s; available: %s", requirement, strings.Join(available, ", "))
+		}
 	}
 
-	// Not installed, install it
-	return m.Install(version)
+	ui.Printf("Installing Python %s...\n", version)
+	return m.Install(string(RuntimePython) + "@" + version)
+}
+
+// newerVersion reports whether release version a is newer than b; versions
+// that don't parse are never newer
+func newerVersion(a, b string) bool {
+	av, err := parseVersion(a)
+	if err != nil {
+		return false
+	}
+	bv, err := parseVersion(b)
+	if err != nil {
+		return true
+	}
+	return compareVersions(av, bv) > 0
 }
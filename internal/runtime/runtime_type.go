@@ -20,6 +20,14 @@ const (
 
 	// RuntimeDeno represents Deno runtime (future)
 	RuntimeDeno RuntimeType = "deno"
+
+	// RuntimeRust represents a Rust toolchain, installed with rustup to
+	// build Rust tools
+	RuntimeRust RuntimeType = "rust"
+
+	// RuntimeRuby represents a Ruby interpreter, which ophid doesn't
+	// download yet but uses from runtimes/ruby-<version> for Ruby tools
+	RuntimeRuby RuntimeType = "ruby"
 )
 
 // String returns the string representation of the runtime type
@@ -30,7 +38,7 @@ func (rt RuntimeType) String() string {
 // IsValid checks if the runtime type is supported
 func (rt RuntimeType) IsValid() bool {
 	switch rt {
-	case RuntimePython, RuntimeNode, RuntimeBun, RuntimeDeno:
+	case RuntimePython, RuntimeNode, RuntimeBun, RuntimeDeno, RuntimeRust, RuntimeRuby:
 		return true
 	default:
 		return false
@@ -40,9 +48,9 @@ func (rt RuntimeType) IsValid() bool {
 // IsImplemented checks if the runtime type is currently implemented
 func (rt RuntimeType) IsImplemented() bool {
 	switch rt {
-	case RuntimePython, RuntimeNode:
+	case RuntimePython, RuntimeNode, RuntimeRust:
 		return true
-	case RuntimeBun, RuntimeDeno:
+	case RuntimeBun, RuntimeDeno, RuntimeRuby:
 		return false
 	default:
 		return false
@@ -59,6 +67,7 @@ type RuntimeSpec struct {
 // Formats supported:
 // - "python@3.12.1" - explicit runtime type
 // - "node@20.0.0" - explicit runtime type
+// - "rust@stable" - a Rust toolchain: a channel or a version like 1.82.0
 // - "3.12.1" - defaults to Python for backward compatibility
 // - "20.0.0" - defaults to Python (but this could be ambiguous!)
 func ParseRuntimeSpec(spec string) (*RuntimeSpec, error) {
@@ -77,11 +86,11 @@ func ParseRuntimeSpec(spec string) (*RuntimeSpec, error) {
 		}
 
 		if !runtimeType.IsValid() {
-			return nil, fmt.Errorf("unsupported runtime type: %s (supported: python, node, bun, deno)", runtimeType)
+			return nil, fmt.Errorf("unsupported runtime type: %s (supported: python, node, rust, ruby, bun, deno)", runtimeType)
 		}
 
 		if !runtimeType.IsImplemented() {
-			return nil, fmt.Errorf("runtime type not yet implemented: %s (currently only Python is supported)", runtimeType)
+			return nil, fmt.Errorf("runtime type not yet implemented: %s (currently Python, Node.js and Rust are supported)", runtimeType)
 		}
 
 		return &RuntimeSpec{
@@ -118,6 +127,10 @@ func (rt RuntimeType) DisplayName() string {
 		return "Bun"
 	case RuntimeDeno:
 		return "Deno"
+	case RuntimeRust:
+		return "Rust"
+	case RuntimeRuby:
+		return "Ruby"
 	default:
 		return string(rt)
 	}
@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/httpclient"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// rustupURL is where rustup-init is published: target triple and file name
+const rustupURL = "https://static.rust-lang.org/rustup/dist/%s/%s"
+
+// installRust installs a Rust toolchain with rustup, kept inside the
+// runtime directory: rustup's data in rustup/ and cargo in cargo/bin
+func (m *Manager) installRust(spec *RuntimeSpec, runtimePath string) (*Runtime, error) {
+	if !m.platform.IsSupported() {
+		return nil, fmt.Errorf("unsupported platform: %s", m.platform)
+	}
+	name := "rustup-init"
+	if m.platform.OS == "windows" {
+		name += ".exe"
+	}
+	url := fmt.Sprintf(rustupURL, m.platform.ToPythonBuildStandalone(), name)
+
+	// Fetched on every install, as rustup-init changes under the same URL
+	dir, err := os.MkdirTemp("", "ophid-rustup-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	rustupInit := filepath.Join(dir, name)
+	if err := fetch(url, rustupInit); err != nil {
+		return nil, err
+	}
+
+	sums := rustupInit + ".sha256"
+	if err := fetch(url+".sha256", sums); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(sums)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checksum: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return nil, errcode.Errorf(errcode.Verification, "empty checksum for %s", name)
+	}
+	slog.Info("verifying SHA256 checksum", "file", name)
+	if err := m.verifier.VerifySHA256(rustupInit, fields[0]); err != nil {
+		return nil, fmt.Errorf("SHA256 verification failed: %w\nThis indicates the download may be corrupted or tampered with", err)
+	}
+	if err := os.Chmod(rustupInit, 0755); err != nil {
+		return nil, fmt.Errorf("failed to make %s executable: %w", name, err)
+	}
+
+	ui.Printf("Installing Rust %s toolchain\n", spec.Version)
+	cmd := exec.Command(rustupInit, "-y", "--no-modify-path", "--profile", "minimal", "--default-toolchain", spec.Version)
+	cmd.Env = append(os.Environ(),
+		"RUSTUP_HOME="+filepath.Join(runtimePath, "rustup"),
+		"CARGO_HOME="+filepath.Join(runtimePath, "cargo"))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(runtimePath)
+		return nil, fmt.Errorf("rustup failed: %w", err)
+	}
+
+	slog.Info("runtime installed successfully",
+		"type", spec.Type.DisplayName(),
+		"version", spec.Version,
+		"path", runtimePath)
+
+	return &Runtime{
+		Type:       spec.Type,
+		Version:    spec.Version,
+		Path:       runtimePath,
+		OS:         m.platform.OS,
+		Arch:       m.platform.Arch,
+		Downloaded: time.Now(),
+	}, nil
+}
+
+// fetch downloads url to path
+func fetch(url, path string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return errcode.Wrap(errcode.Network, fmt.Errorf("failed to download: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errcode.Errorf(errcode.Network, "download of %s failed with status: %d", url, resp.StatusCode)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if _, err := io.Copy(out, httpclient.Throttle(context.Background(), resp.Body)); err != nil {
+		out.Close()
+		return errcode.Wrap(errcode.Network, fmt.Errorf("download failed: %w", err))
+	}
+	return out.Close()
+}
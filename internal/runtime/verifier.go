@@ -8,19 +8,23 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"net/http"
 	"os"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
 )
 
 // Verifier handles checksum verification of downloaded files
-type Verifier struct{}
+type Verifier struct {
+	releaseCache string // Where GitHub release metadata is cached
+}
 
-// NewVerifier creates a new verifier
-func NewVerifier() *Verifier {
-	return &Verifier{}
+// NewVerifier creates a new verifier caching the GitHub releases it reads
+// in releaseCache
+func NewVerifier(releaseCache string) *Verifier {
+	return &Verifier{releaseCache: releaseCache}
 }
 
 // VerifySHA256 verifies the SHA256 checksum of a file
@@ -33,7 +37,7 @@ func (v *Verifier) VerifySHA256(filePath, expectedHash string) error {
 
 	// Compare hashes
 	if actualHash != expectedHash {
-		return fmt.Errorf("checksum mismatch:\n  expected: %s\n  got:      %s",
+		return errcode.Errorf(errcode.Verification, "checksum mismatch:\n  expected: %s\n  got:      %s",
 			expectedHash, actualHash)
 	}
 
@@ -90,27 +94,9 @@ func (v *Verifier) GetSHA256ForVersion(version string, platform Platform, buildD
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Use astral-sh repo (was indygreg/python-build-standalone)
-	releaseURL := fmt.Sprintf("https://api.github.com/repos/astral-sh/python-build-standalone/releases/tags/%s", buildDate)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", releaseURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set user agent (GitHub API requires it)
-	req.Header.Set("User-Agent", "ophid/0.1.0")
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	data, err := fetchPythonRelease(ctx, v.releaseCache, buildDate)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch release data: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("GitHub API returned status %d for release %s", resp.StatusCode, buildDate)
+		return "", err
 	}
 
 	// Parse release response
@@ -119,7 +105,7 @@ func (v *Verifier) GetSHA256ForVersion(version string, platform Platform, buildD
 		Body    string `json:"body"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+	if err := json.Unmarshal(data, &release); err != nil {
 		return "", fmt.Errorf("failed to parse release data: %w", err)
 	}
 
@@ -127,7 +113,7 @@ func (v *Verifier) GetSHA256ForVersion(version string, platform Platform, buildD
 	// Format in release notes: "sha256:ca8f0ba14dbcf474fe3b9cd5d8839a48eb08b00f6e90244546e761a2ba956ee0"
 	hash, err := v.extractSHA256FromReleaseNotes(release.Body, filename)
 	if err != nil {
-		return "", fmt.Errorf("failed to extract SHA256 for %s: %w", filename, err)
+		return "", errcode.Wrap(errcode.NotFound, fmt.Errorf("failed to extract SHA256 for %s: %w", filename, err))
 	}
 
 	slog.Info("successfully fetched SHA256 hash",
@@ -0,0 +1,82 @@
+// Package sandbox restricts the filesystem and network access of a tool at
+// run time: bubblewrap (bwrap) namespaces on Linux, sandbox-exec on macOS.
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Home access levels
+const (
+	HomeReadWrite = ""          // Default: home is untouched
+	HomeReadOnly  = "read-only" // Home can be read but not written
+	HomeHidden    = "hidden"    // Home is replaced by an empty directory
+)
+
+// Profile describes what a tool may access. The zero value imposes no
+// restrictions.
+type Profile struct {
+	NoNetwork bool     `json:"no_network,omitempty"`
+	Home      string   `json:"home,omitempty"`     // "", "read-only" or "hidden"
+	Writable  []string `json:"writable,omitempty"` // Paths kept writable (and visible) despite Home
+}
+
+// Enabled reports whether the profile restricts anything
+func (p Profile) Enabled() bool {
+	return p.NoNetwork || p.Home != HomeReadWrite
+}
+
+// Validate checks the profile's settings
+func (p Profile) Validate() error {
+	switch p.Home {
+	case HomeReadWrite, HomeReadOnly, HomeHidden:
+	default:
+		return fmt.Errorf("invalid home access %q (use read-only or hidden)", p.Home)
+	}
+
+	for _, path := range p.Writable {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("writable path %s must be absolute", path)
+		}
+	}
+	return nil
+}
+
+// String describes the profile, e.g. "no network, home read-only"
+func (p Profile) String() string {
+	var parts []string
+	if p.NoNetwork {
+		parts = append(parts, "no network")
+	}
+	if p.Home != HomeReadWrite {
+		parts = append(parts, "home "+p.Home)
+	}
+	if len(p.Writable) > 0 {
+		parts = append(parts, "writable "+strings.Join(p.Writable, ", "))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Wrap returns the command line that runs command inside the sandbox. keep
+// lists paths the tool needs even when home is hidden, such as its virtual
+// environment; they stay readable.
+func Wrap(p Profile, command string, args []string, keep ...string) (string, []string, error) {
+	if !p.Enabled() {
+		return command, args, nil
+	}
+	if err := p.Validate(); err != nil {
+		return "", nil, err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return wrap(p, home, command, args, keep)
+}
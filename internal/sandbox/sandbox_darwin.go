@@ -0,0 +1,45 @@
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// wrap runs command under sandbox-exec
+func wrap(p Profile, home, command string, args, keep []string) (string, []string, error) {
+	return "/usr/bin/sandbox-exec", append([]string{"-p", seatbeltProfile(p, home, keep), command}, args...), nil
+}
+
+// seatbeltProfile builds a sandbox-exec profile: everything allowed, then
+// the profile's restrictions, then the paths the tool keeps. The last
+// matching rule wins.
+func seatbeltProfile(p Profile, home string, keep []string) string {
+	var b strings.Builder
+	b.WriteString("(version 1)\n(allow default)\n")
+
+	if p.NoNetwork {
+		// Local IPC over unix sockets keeps working
+		b.WriteString("(deny network*)\n(allow network* (remote unix-socket))\n")
+	}
+
+	switch p.Home {
+	case HomeReadOnly:
+		fmt.Fprintf(&b, "(deny file-write* (subpath %s))\n", quote(home))
+	case HomeHidden:
+		fmt.Fprintf(&b, "(deny file-read* file-write* (subpath %s))\n", quote(home))
+		for _, path := range keep {
+			fmt.Fprintf(&b, "(allow file-read* (subpath %s))\n", quote(path))
+		}
+	}
+
+	for _, path := range p.Writable {
+		fmt.Fprintf(&b, "(allow file-read* file-write* (subpath %s))\n", quote(path))
+	}
+
+	return b.String()
+}
+
+// quote quotes a path as a profile string literal
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,43 @@
+package sandbox
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// wrap runs command under bubblewrap
+func wrap(p Profile, home, command string, args, keep []string) (string, []string, error) {
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return "", nil, fmt.Errorf("sandboxing requires bubblewrap (bwrap) on Linux: %w", err)
+	}
+	return bwrap, bwrapArgs(p, home, command, args, keep), nil
+}
+
+// bwrapArgs builds the bubblewrap command line: the host filesystem as is,
+// then home remounted read-only or replaced by a tmpfs, then the paths the
+// tool keeps on top. Later mounts win.
+func bwrapArgs(p Profile, home, command string, args, keep []string) []string {
+	bargs := []string{"--die-with-parent", "--dev-bind", "/", "/"}
+
+	switch p.Home {
+	case HomeReadOnly:
+		bargs = append(bargs, "--ro-bind", home, home)
+	case HomeHidden:
+		bargs = append(bargs, "--tmpfs", home)
+		for _, path := range keep {
+			bargs = append(bargs, "--ro-bind-try", path, path)
+		}
+	}
+
+	for _, path := range p.Writable {
+		bargs = append(bargs, "--bind", path, path)
+	}
+
+	if p.NoNetwork {
+		bargs = append(bargs, "--unshare-net")
+	}
+
+	bargs = append(bargs, "--", command)
+	return append(bargs, args...)
+}
@@ -0,0 +1,29 @@
+package sandbox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBwrapArgs(t *testing.T) {
+	p := Profile{NoNetwork: true, Home: HomeHidden, Writable: []string{"/home/me/out"}}
+	got := bwrapArgs(p, "/home/me", "/home/me/.ophid/tools/x/venv/bin/x", []string{"-v"}, []string{"/home/me/.ophid/tools/x"})
+
+	want := []string{
+		"--die-with-parent", "--dev-bind", "/", "/",
+		"--tmpfs", "/home/me",
+		"--ro-bind-try", "/home/me/.ophid/tools/x", "/home/me/.ophid/tools/x",
+		"--bind", "/home/me/out", "/home/me/out",
+		"--unshare-net",
+		"--", "/home/me/.ophid/tools/x/venv/bin/x", "-v",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bwrapArgs() =\n%v\nwant\n%v", got, want)
+	}
+
+	got = bwrapArgs(Profile{Home: HomeReadOnly}, "/home/me", "x", nil, []string{"/home/me/.ophid/tools/x"})
+	want = []string{"--die-with-parent", "--dev-bind", "/", "/", "--ro-bind", "/home/me", "/home/me", "--", "x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bwrapArgs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package sandbox
+
+import "fmt"
+
+// wrap is not supported on this platform
+func wrap(p Profile, home, command string, args, keep []string) (string, []string, error) {
+	return "", nil, fmt.Errorf("sandboxing is not supported on this platform")
+}
@@ -0,0 +1,49 @@
+package sandbox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfile_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		wantErr bool
+	}{
+		{"empty", Profile{}, false},
+		{"read-only home", Profile{Home: HomeReadOnly, NoNetwork: true}, false},
+		{"hidden home", Profile{Home: HomeHidden, Writable: []string{"/tmp/work"}}, false},
+		{"unknown home", Profile{Home: "none"}, true},
+		{"relative writable", Profile{Writable: []string{"work"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.profile.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProfile_String(t *testing.T) {
+	if got := (Profile{}).String(); got != "none" {
+		t.Errorf("String() = %q, want none", got)
+	}
+
+	p := Profile{NoNetwork: true, Home: HomeReadOnly, Writable: []string{"/srv/out"}}
+	if got := p.String(); got != "no network, home read-only, writable /srv/out" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestWrap_Disabled(t *testing.T) {
+	command, args, err := Wrap(Profile{}, "/bin/tool", []string{"-v"})
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	if command != "/bin/tool" || !reflect.DeepEqual(args, []string{"-v"}) {
+		t.Errorf("Wrap() = %s %v, want the command unchanged", command, args)
+	}
+}
@@ -0,0 +1,194 @@
+// Package scaffold creates ops projects from templates: built-in ones
+// embedded in ophid, or any git repository laid out the same way.
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+//go:embed all:templates
+var builtin embed.FS
+
+// serviceFiles are left out of projects created without a service
+var serviceFiles = []string{"services.yaml", "proxy.toml"}
+
+// Vars are the values templates are rendered with. Templates use [% %]
+// delimiters, so supervisor {{var}} references pass through untouched.
+type Vars struct {
+	Name   string // Project and executable name, e.g. "disk-report"
+	Module string // Python package name, e.g. "disk_report"
+	Python string // Runtime version, e.g. "3.12.1"
+	Port   int    // Port the service listens on
+}
+
+// Options controls how a project is created
+type Options struct {
+	Vars
+	NoService bool // Skip services.yaml and proxy.toml
+}
+
+// Builtin returns the names of the built-in templates
+func Builtin() []string {
+	entries, _ := fs.ReadDir(builtin, "templates")
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ModuleName turns a project name into a Python package name
+func ModuleName(name string) string {
+	module := regexp.MustCompile(`[^A-Za-z0-9_]+`).ReplaceAllString(strings.ToLower(name), "_")
+	if module == "" || (module[0] >= '0' && module[0] <= '9') {
+		module = "_" + module
+	}
+	return module
+}
+
+// Create renders a template into dir, which must not exist or be empty.
+// The template is a built-in name, a GitHub user/repo[@ref] or a git URL.
+// It returns the files written, relative to dir.
+func Create(templateName, dir string, opts Options) ([]string, error) {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, errcode.Errorf(errcode.Conflict, "%s already exists and isn't empty", dir)
+	}
+	if opts.Module == "" {
+		opts.Module = ModuleName(opts.Name)
+	}
+
+	src, cleanup, err := open(templateName)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	return render(src, dir, opts)
+}
+
+// open returns the file tree of a template
+func open(name string) (fs.FS, func(), error) {
+	if sub, err := fs.Sub(builtin, "templates/"+name); err == nil && !strings.ContainsAny(name, "/:") {
+		if _, err := fs.Stat(sub, "."); err == nil {
+			return sub, func() {}, nil
+		}
+	}
+
+	url, ref := gitSource(name)
+	if url == "" {
+		return nil, nil, errcode.Errorf(errcode.NotFound, "unknown template %s (built-in: %s; or user/repo[@ref], or a git URL)",
+			name, strings.Join(Builtin(), ", "))
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ophid-template-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+
+	args := []string{"clone", "--depth", "1", "--quiet"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	cmd := exec.Command("git", append(args, url, tmpDir)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		cleanup()
+		return nil, nil, errcode.Wrap(errcode.Network, fmt.Errorf("failed to clone template %s: %w\n%s", url, err, out))
+	}
+	return os.DirFS(tmpDir), cleanup, nil
+}
+
+// gitSource parses a git template: user/repo[@ref] on GitHub, or a URL
+// with an optional #ref
+func gitSource(name string) (url, ref string) {
+	if strings.Contains(name, "://") || strings.HasPrefix(name, "git@") {
+		url, ref, _ = strings.Cut(name, "#")
+		return url, ref
+	}
+
+	repo, ref, _ := strings.Cut(name, "@")
+	if parts := strings.Split(repo, "/"); len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+		return "https://github.com/" + repo, ref
+	}
+	return "", ""
+}
+
+// render writes every file of src into dir, rendering file names and
+// UTF-8 contents as templates
+func render(src fs.FS, dir string, opts Options) ([]string, error) {
+	var written []string
+	err := fs.WalkDir(src, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if opts.NoService && slices.Contains(serviceFiles, path) {
+			return nil
+		}
+
+		rel, err := expand(path, path, opts.Vars)
+		if err != nil {
+			return err
+		}
+		data, err := fs.ReadFile(src, path)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %w", path, err)
+		}
+		if utf8.Valid(data) {
+			content, err := expand(path, string(data), opts.Vars)
+			if err != nil {
+				return err
+			}
+			data = []byte(content)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+		written = append(written, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return written, nil
+}
+
+// expand renders text as a template named after the file it came from
+func expand(name, text string, vars Vars) (string, error) {
+	tmpl, err := template.New(name).Delims("[%", "%]").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
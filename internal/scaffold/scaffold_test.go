@@ -0,0 +1,127 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/gleicon/ophid/internal/bundle"
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/proxy"
+	"github.com/gleicon/ophid/internal/supervisor"
+)
+
+func TestCreateWeb(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hello-api")
+	files, err := Create("web", dir, Options{Vars: Vars{Name: "hello-api", Python: "3.12.1", Port: 8123}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	for _, want := range []string{"pyproject.toml", "ophid.toml", "services.yaml", "proxy.toml", "src/hello_api/main.py"} {
+		if !slices.Contains(files, want) {
+			t.Errorf("missing %s in %v", want, files)
+		}
+	}
+
+	b, err := bundle.Load(filepath.Join(dir, "ophid.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(b.Runtimes, []string{"python@3.12.1"}) || b.Tools["hello-api"].Source != "local" {
+		t.Errorf("bundle = %+v", b)
+	}
+
+	sf, err := supervisor.LoadServiceFile(filepath.Join(dir, "services.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf.Tool != "hello-api" || sf.Vars["http_port"] != "8123" || sf.Process.Command != "{{venv_bin}}/hello-api" {
+		t.Errorf("service file = %+v", sf)
+	}
+	if sf.Process.HealthCheck.Timeout == 0 {
+		t.Error("health check has no timeout")
+	}
+
+	var cfg proxy.Config
+	data, _ := os.ReadFile(filepath.Join(dir, "proxy.toml"))
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Routes) != 1 || cfg.Routes[0].Target != "http://127.0.0.1:8123" || cfg.Routes[0].DependsOn != "hello-api" {
+		t.Errorf("routes = %+v", cfg.Routes)
+	}
+}
+
+func TestCreateNoService(t *testing.T) {
+	dir := t.TempDir()
+	files, err := Create("web", dir, Options{Vars: Vars{Name: "api", Python: "3.12.1", Port: 8000}, NoService: true})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if slices.Contains(files, "services.yaml") || slices.Contains(files, "proxy.toml") {
+		t.Errorf("service files written: %v", files)
+	}
+}
+
+func TestCreateNotEmpty(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "keep.txt"), nil, 0644)
+
+	_, err := Create("script", dir, Options{Vars: Vars{Name: "x"}})
+	if errcode.Of(err) != errcode.Conflict {
+		t.Errorf("Create() into a non-empty dir: %v, want a conflict", err)
+	}
+	if _, err := Create("nope", t.TempDir(), Options{}); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("Create(nope): %v, want not found", err)
+	}
+}
+
+func TestRenderSkipsBinaryAndGit(t *testing.T) {
+	src := fstest.MapFS{
+		"[%.Module%].txt": {Data: []byte("hi [%.Name%]")},
+		"logo.bin":        {Data: []byte{0xff, 0xfe, '[', '%'}},
+		".git/HEAD":       {Data: []byte("ref: main")},
+	}
+	dir := t.TempDir()
+	files, err := render(src, dir, Options{Vars: Vars{Name: "my-tool", Module: "my_tool"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(files, []string{"my_tool.txt", "logo.bin"}) {
+		t.Errorf("files = %v", files)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "my_tool.txt")); string(data) != "hi my-tool" {
+		t.Errorf("rendered = %q", data)
+	}
+
+	_, err = render(fstest.MapFS{"bad": {Data: []byte("[%.Nope%]")}}, t.TempDir(), Options{})
+	if err == nil || !strings.Contains(err.Error(), "bad") {
+		t.Errorf("render() of an unknown var = %v", err)
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	tests := []struct{ name, url, ref string }{
+		{"acme/ops-template", "https://github.com/acme/ops-template", ""},
+		{"acme/ops-template@v2", "https://github.com/acme/ops-template", "v2"},
+		{"https://git.example.com/t.git#main", "https://git.example.com/t.git", "main"},
+		{"git@github.com:acme/t.git", "git@github.com:acme/t.git", ""},
+		{"web", "", ""},
+		{"a/b/c", "", ""},
+	}
+	for _, tt := range tests {
+		url, ref := gitSource(tt.name)
+		if url != tt.url || ref != tt.ref {
+			t.Errorf("gitSource(%q) = %q, %q, want %q, %q", tt.name, url, ref, tt.url, tt.ref)
+		}
+	}
+	if got := ModuleName("9-Disk Report"); got != "_9_disk_report" {
+		t.Errorf("ModuleName = %q", got)
+	}
+}
@@ -0,0 +1,17 @@
+"""[%.Name%]: an operations script."""
+
+import argparse
+import logging
+
+
+def main():
+    parser = argparse.ArgumentParser(prog="[%.Name%]")
+    parser.add_argument("-v", "--verbose", action="store_true", help="log debug messages")
+    args = parser.parse_args()
+
+    logging.basicConfig(level=logging.DEBUG if args.verbose else logging.INFO)
+    logging.info("hello from [%.Name%]")
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,26 @@
+"""[%.Name%]: a web service."""
+
+import os
+
+import uvicorn
+from fastapi import FastAPI
+
+app = FastAPI(title="[%.Name%]")
+
+
+@app.get("/health")
+def health():
+    return {"status": "ok"}
+
+
+@app.get("/")
+def index():
+    return {"service": "[%.Name%]"}
+
+
+def main():
+    uvicorn.run(app, host="127.0.0.1", port=int(os.environ.get("PORT", "[%.Port%]")))
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// secretRef matches {{secret:name}} references
+var secretRef = regexp.MustCompile(`\{\{\s*secret:([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// Lookup returns the value of a secret
+type Lookup func(name string) (string, error)
+
+// HasRefs reports whether s references any secret
+func HasRefs(s string) bool {
+	return secretRef.MatchString(s)
+}
+
+// Expand replaces the {{secret:name}} references in s with the secrets'
+// values. Strings without references are returned as they are, without
+// calling lookup.
+func Expand(s string, lookup Lookup) (string, error) {
+	if !HasRefs(s) {
+		return s, nil
+	}
+	if lookup == nil {
+		return "", errors.New("secret references need a secrets store")
+	}
+
+	var firstErr error
+	expanded := secretRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := secretRef.FindStringSubmatch(ref)[1]
+		value, err := lookup(name)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to resolve {{secret:%s}}: %w", name, err)
+		}
+		return value
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return expanded, nil
+}
@@ -0,0 +1,35 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keychainService names ophid's entries in the OS keychain
+const keychainService = "ophid"
+
+// Keychain keeps values in the OS credential store
+type Keychain interface {
+	Get(account string) (string, error)
+	Set(account, value string) error
+	Delete(account string) error
+}
+
+// runKeychain runs a keychain command, feeding it stdin, and returns its
+// trimmed output
+func runKeychain(stdin string, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
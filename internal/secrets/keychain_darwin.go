@@ -0,0 +1,30 @@
+package secrets
+
+import "os/exec"
+
+// macKeychain uses the login keychain through security(1)
+type macKeychain struct{}
+
+// SystemKeychain returns the OS keychain, or nil when there is none
+func SystemKeychain() Keychain {
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil
+	}
+	return macKeychain{}
+}
+
+func (macKeychain) Get(account string) (string, error) {
+	return runKeychain("", "security", "find-generic-password", "-s", keychainService, "-a", account, "-w")
+}
+
+// Set passes the value as an argument: security(1) only reads it from the
+// terminal otherwise
+func (macKeychain) Set(account, value string) error {
+	_, err := runKeychain("", "security", "add-generic-password", "-U", "-s", keychainService, "-a", account, "-w", value)
+	return err
+}
+
+func (macKeychain) Delete(account string) error {
+	_, err := runKeychain("", "security", "delete-generic-password", "-s", keychainService, "-a", account)
+	return err
+}
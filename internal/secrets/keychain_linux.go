@@ -0,0 +1,36 @@
+package secrets
+
+import (
+	"os"
+	"os/exec"
+)
+
+// secretService uses the desktop Secret Service (GNOME Keyring, KWallet)
+// through secret-tool(1)
+type secretService struct{}
+
+// SystemKeychain returns the OS keychain, or nil when there is none: no
+// secret-tool or no session bus to reach the service on, as on servers
+func SystemKeychain() Keychain {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil
+	}
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil
+	}
+	return secretService{}
+}
+
+func (secretService) Get(account string) (string, error) {
+	return runKeychain("", "secret-tool", "lookup", "service", keychainService, "account", account)
+}
+
+func (secretService) Set(account, value string) error {
+	_, err := runKeychain(value, "secret-tool", "store", "--label=ophid "+account, "service", keychainService, "account", account)
+	return err
+}
+
+func (secretService) Delete(account string) error {
+	_, err := runKeychain("", "secret-tool", "clear", "service", keychainService, "account", account)
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package secrets
+
+// SystemKeychain returns the OS keychain, or nil when there is none
+func SystemKeychain() Keychain {
+	return nil
+}
@@ -0,0 +1,278 @@
+// Package secrets keeps named secrets in an encrypted file, so process
+// environments and proxy configs can reference credentials instead of
+// holding them in plain text.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key sources of a store
+const (
+	KeyKeychain   = "keychain"   // A random key kept in the OS keychain
+	KeyPassphrase = "passphrase" // A key derived from a passphrase
+)
+
+// fileVersion is the format version written to store files
+const fileVersion = 1
+
+// keychainAccount names the store key in the OS keychain
+const keychainAccount = "secrets"
+
+// validName matches secret names
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ErrNotFound is returned for secrets the store doesn't hold
+var ErrNotFound = errors.New("secret not found")
+
+// Options say where a store's key comes from
+type Options struct {
+	Keychain      Keychain                           // OS keychain; nil when there is none
+	Passphrase    func(confirm bool) (string, error) // Asks for the passphrase; confirm is set when creating a store
+	UsePassphrase bool                               // Create the store with a passphrase even when a keychain is available
+}
+
+// Store is an open secrets file
+type Store struct {
+	path   string
+	opts   Options
+	source string
+	salt   []byte
+	key    []byte
+	values map[string]string
+}
+
+// storeFile is the on-disk format: the secrets, JSON encoded and sealed
+// with AES-256-GCM
+type storeFile struct {
+	Version int    `json:"version"`
+	Key     string `json:"key"`            // KeyKeychain or KeyPassphrase
+	Salt    string `json:"salt,omitempty"` // scrypt salt of passphrase keys
+	Nonce   string `json:"nonce"`
+	Data    string `json:"data"`
+}
+
+// DefaultPath returns the secrets file under the ophid home
+func DefaultPath(homeDir string) string {
+	return filepath.Join(homeDir, "secrets.enc")
+}
+
+// Open opens the store at path. A missing store is opened empty; Save
+// creates it, with a key kept in the keychain unless opts asks for a
+// passphrase or there is no keychain.
+func Open(path string, opts Options) (*Store, error) {
+	s := &Store{path: path, opts: opts, values: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets: %w", err)
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if file.Version > fileVersion {
+		return nil, fmt.Errorf("%s has format %d; this ophid reads up to %d", path, file.Version, fileVersion)
+	}
+	s.source = file.Key
+
+	switch file.Key {
+	case KeyKeychain:
+		if opts.Keychain == nil {
+			return nil, fmt.Errorf("%s is keyed in the OS keychain, which isn't available", path)
+		}
+		encoded, err := opts.Keychain.Get(keychainAccount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the secrets key from the keychain: %w", err)
+		}
+		if s.key, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("invalid secrets key in the keychain: %w", err)
+		}
+	case KeyPassphrase:
+		if s.salt, err = base64.StdEncoding.DecodeString(file.Salt); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if s.key, err = passphraseKey(opts, s.salt, false); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown key source %q", path, file.Key)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(file.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(file.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	aead, err := newAEAD(s.key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, sealed, []byte(file.Key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: wrong passphrase or key", path)
+	}
+	if err := json.Unmarshal(plain, &s.values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// newKey picks the key of a store about to be created
+func (s *Store) newKey() error {
+	opts := s.opts
+	if opts.Keychain != nil && !opts.UsePassphrase {
+		s.source = KeyKeychain
+		s.key = make([]byte, 32)
+		_, err := rand.Read(s.key)
+		return err
+	}
+
+	s.source = KeyPassphrase
+	s.salt = make([]byte, 16)
+	if _, err := rand.Read(s.salt); err != nil {
+		return err
+	}
+	key, err := passphraseKey(opts, s.salt, true)
+	s.key = key
+	return err
+}
+
+// passphraseKey derives a key from the passphrase opts asks for
+func passphraseKey(opts Options, salt []byte, confirm bool) ([]byte, error) {
+	if opts.Passphrase == nil {
+		return nil, errors.New("the secrets store needs a passphrase")
+	}
+	passphrase, err := opts.Passphrase(confirm)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, errors.New("the secrets passphrase is empty")
+	}
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// KeySource returns where the store's key comes from: KeyKeychain,
+// KeyPassphrase, or "" for a store not created yet
+func (s *Store) KeySource() string {
+	return s.source
+}
+
+// Get returns a secret
+func (s *Store) Get(name string) (string, error) {
+	value, ok := s.values[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return value, nil
+}
+
+// Set sets a secret
+func (s *Store) Set(name, value string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q: use letters, digits, '_', '.' and '-'", name)
+	}
+	s.values[name] = value
+	return nil
+}
+
+// Delete removes a secret, reporting whether it existed
+func (s *Store) Delete(name string) bool {
+	_, ok := s.values[name]
+	delete(s.values, name)
+	return ok
+}
+
+// Names returns the names of the secrets, sorted
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save encrypts the secrets to the store's file, readable only by its
+// owner. Creating the store picks its key, kept in the keychain or derived
+// from a new passphrase.
+func (s *Store) Save() error {
+	if s.key == nil {
+		if err := s.newKey(); err != nil {
+			return err
+		}
+		if s.source == KeyKeychain {
+			if err := s.opts.Keychain.Set(keychainAccount, base64.StdEncoding.EncodeToString(s.key)); err != nil {
+				return fmt.Errorf("failed to store the secrets key in the keychain: %w", err)
+			}
+		}
+	}
+
+	plain, err := json.Marshal(s.values)
+	if err != nil {
+		return fmt.Errorf("failed to encode secrets: %w", err)
+	}
+	aead, err := newAEAD(s.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	file := storeFile{
+		Version: fileVersion,
+		Key:     s.source,
+		Nonce:   base64.StdEncoding.EncodeToString(nonce),
+		Data:    base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plain, []byte(s.source))),
+	}
+	if s.salt != nil {
+		file.Salt = base64.StdEncoding.EncodeToString(s.salt)
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode secrets: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write secrets: %w", err)
+	}
+	return nil
+}
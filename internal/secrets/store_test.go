@@ -0,0 +1,146 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeKeychain keeps values in memory
+type fakeKeychain map[string]string
+
+func (k fakeKeychain) Get(account string) (string, error) {
+	value, ok := k[account]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return value, nil
+}
+
+func (k fakeKeychain) Set(account, value string) error {
+	k[account] = value
+	return nil
+}
+
+func (k fakeKeychain) Delete(account string) error {
+	delete(k, account)
+	return nil
+}
+
+func passphrase(p string) func(bool) (string, error) {
+	return func(bool) (string, error) { return p, nil }
+}
+
+func TestStorePassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	opts := Options{Passphrase: passphrase("correct horse")}
+
+	s, err := Open(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Names()) != 0 || s.KeySource() != "" {
+		t.Errorf("new store: names %v, key %q", s.Names(), s.KeySource())
+	}
+	if err := s.Set("zerossl.hmac", "s3cr3t-value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("bad name", "x"); err == nil {
+		t.Error("set a secret with a space in its name")
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cr3t-value") || strings.Contains(string(data), "zerossl") {
+		t.Errorf("store holds plain text: %s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("store mode = %v", info.Mode())
+	}
+
+	s, err = Open(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := s.Get("zerossl.hmac"); err != nil || value != "s3cr3t-value" {
+		t.Errorf("Get = %q, %v", value, err)
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) = %v", err)
+	}
+
+	if _, err := Open(path, Options{Passphrase: passphrase("wrong")}); err == nil {
+		t.Error("opened with the wrong passphrase")
+	}
+}
+
+func TestStoreKeychain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	keychain := fakeKeychain{}
+	opts := Options{Keychain: keychain, Passphrase: func(bool) (string, error) {
+		t.Error("asked for a passphrase with a keychain")
+		return "", errors.New("no passphrase")
+	}}
+
+	s, err := Open(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("token", "abc")
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if s.KeySource() != KeyKeychain || keychain[keychainAccount] == "" {
+		t.Errorf("key source %q, keychain %v", s.KeySource(), keychain)
+	}
+
+	s, err = Open(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Delete("token") || s.Delete("token") {
+		t.Error("Delete didn't report the secret once")
+	}
+
+	if _, err := Open(path, Options{}); err == nil {
+		t.Error("opened a keychain store without the keychain")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	lookup := func(name string) (string, error) {
+		if name == "token" {
+			return "abc", nil
+		}
+		return "", ErrNotFound
+	}
+
+	for in, want := range map[string]string{
+		"plain":                           "plain",
+		"{{secret:token}}":                "abc",
+		"Bearer {{ secret:token }}":       "Bearer abc",
+		"{{port.admin}} {{secret:token}}": "{{port.admin}} abc",
+	} {
+		got, err := Expand(in, lookup)
+		if err != nil || got != want {
+			t.Errorf("Expand(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	if _, err := Expand("{{secret:other}}", lookup); err == nil || !strings.Contains(err.Error(), "other") {
+		t.Errorf("Expand of a missing secret = %v", err)
+	}
+	if _, err := Expand("{{secret:token}}", nil); err == nil {
+		t.Error("expanded without a store")
+	}
+	if got, err := Expand("no refs", nil); err != nil || got != "no refs" {
+		t.Errorf("Expand without refs = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,274 @@
+package security
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	gocvss40 "github.com/pandatix/go-cvss/40"
+)
+
+// Severity is how bad a vulnerability is, from its CVSS base score:
+// critical from 9.0, high from 7.0, medium from 4.0 and low below
+type Severity int
+
+// Severities, in order
+const (
+	SeverityNone Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"none", "low", "medium", "high", "critical"}
+
+// String returns the severity's name
+func (s Severity) String() string {
+	if s < SeverityNone || s > SeverityCritical {
+		return "unknown"
+	}
+	return severityNames[s]
+}
+
+// MarshalText encodes the severity as its name in JSON
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity name
+func (s *Severity) UnmarshalText(text []byte) error {
+	severity, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = severity
+	return nil
+}
+
+// ParseSeverity parses a severity name like "high"; GitHub's "moderate"
+// is medium
+func ParseSeverity(name string) (Severity, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "moderate" {
+		return SeverityMedium, nil
+	}
+	for i, n := range severityNames {
+		if n == name {
+			return Severity(i), nil
+		}
+	}
+	return SeverityNone, fmt.Errorf("unknown severity %q (available: %s)", name, strings.Join(severityNames, ", "))
+}
+
+// ScoreSeverity returns the severity of a CVSS base score
+func ScoreSeverity(score float64) Severity {
+	switch {
+	case score >= 9.0:
+		return SeverityCritical
+	case score >= 7.0:
+		return SeverityHigh
+	case score >= 4.0:
+		return SeverityMedium
+	case score > 0:
+		return SeverityLow
+	}
+	return SeverityNone
+}
+
+// CVSSScore computes the base score of a CVSS v3.0, v3.1 or v4.0 vector,
+// like "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H" (9.8)
+func CVSSScore(vector string) (float64, error) {
+	switch {
+	case strings.HasPrefix(vector, "CVSS:3.0/"), strings.HasPrefix(vector, "CVSS:3.1/"):
+		return cvss3Score(vector)
+	case strings.HasPrefix(vector, "CVSS:4.0/"):
+		// v4.0 scores come from the specification's tables of macro
+		// vectors rather than a formula
+		cvss, err := gocvss40.ParseVector(vector)
+		if err != nil {
+			return 0, fmt.Errorf("invalid CVSS vector %q: %w", vector, err)
+		}
+		return cvss.Score(), nil
+	}
+	return 0, fmt.Errorf("unsupported CVSS vector %q", vector)
+}
+
+// CVSS v3 metric weights
+var cvss3Weights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"PR": {"N": 0.85, "L": 0.62, "H": 0.27},
+	"UI": {"N": 0.85, "R": 0.62},
+	"S":  {"U": 0, "C": 0},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// cvss3Score computes the base score of a CVSS v3.x vector, as the v3.1
+// specification defines it. Temporal and environmental metrics are
+// validated but don't change the base score.
+func cvss3Score(vector string) (float64, error) {
+	metrics := make(map[string]string)
+	for _, part := range strings.Split(vector, "/")[1:] {
+		name, value, ok := strings.Cut(part, ":")
+		if !ok || value == "" {
+			return 0, fmt.Errorf("invalid CVSS vector %q: malformed metric %q", vector, part)
+		}
+		if _, dup := metrics[name]; dup {
+			return 0, fmt.Errorf("invalid CVSS vector %q: %s given twice", vector, name)
+		}
+		if weights, base := cvss3Weights[name]; base {
+			if _, ok := weights[value]; !ok {
+				return 0, fmt.Errorf("invalid CVSS vector %q: unknown %s value %q", vector, name, value)
+			}
+		}
+		metrics[name] = value
+	}
+	for name := range cvss3Weights {
+		if _, ok := metrics[name]; !ok {
+			return 0, fmt.Errorf("invalid CVSS vector %q: missing %s", vector, name)
+		}
+	}
+
+	changed := metrics["S"] == "C"
+	pr := cvss3Weights["PR"][metrics["PR"]]
+	if changed {
+		// Privileges matter more when the impact crosses a scope
+		switch metrics["PR"] {
+		case "L":
+			pr = 0.68
+		case "H":
+			pr = 0.5
+		}
+	}
+
+	iss := 1 - (1-cvss3Weights["C"][metrics["C"]])*(1-cvss3Weights["I"][metrics["I"]])*(1-cvss3Weights["A"][metrics["A"]])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, nil
+	}
+	exploitability := 8.22 * cvss3Weights["AV"][metrics["AV"]] * cvss3Weights["AC"][metrics["AC"]] * pr * cvss3Weights["UI"][metrics["UI"]]
+	if changed {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10)), nil
+	}
+	return roundUp(math.Min(impact+exploitability, 10)), nil
+}
+
+// roundUp rounds up to one decimal, as CVSS v3.1 does to avoid floating
+// point artifacts like 4.000000001 becoming 4.1
+func roundUp(x float64) float64 {
+	n := int(math.Round(x * 100000))
+	if n%10000 == 0 {
+		return float64(n) / 100000
+	}
+	return float64(n/10000+1) / 10
+}
+
+// Rating returns the highest CVSS base score of a vulnerability and its
+// severity. Vulnerabilities without a vector fall back to their database's
+// severity, like GitHub's "HIGH", with no score; ok is false when neither
+// is known.
+func (v OSVVulnerability) Rating() (score float64, severity Severity, ok bool) {
+	for _, sev := range v.Severity {
+		if !strings.HasPrefix(sev.Type, "CVSS_V") {
+			continue
+		}
+		s, err := CVSSScore(sev.Score)
+		if err != nil {
+			continue
+		}
+		if !ok || s > score {
+			score, ok = s, true
+		}
+	}
+	if ok {
+		return score, ScoreSeverity(score), true
+	}
+	if severity, err := ParseSeverity(v.DatabaseSpecific.Severity); err == nil && v.DatabaseSpecific.Severity != "" {
+		return 0, severity, true
+	}
+	return 0, SeverityNone, false
+}
+
+// SeverityCounts counts vulnerabilities by severity
+type SeverityCounts struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+	Unknown  int `json:"unknown"` // Neither scored nor rated by their database
+}
+
+// Add counts another's vulnerabilities too
+func (c *SeverityCounts) Add(other SeverityCounts) {
+	c.Critical += other.Critical
+	c.High += other.High
+	c.Medium += other.Medium
+	c.Low += other.Low
+	c.Unknown += other.Unknown
+}
+
+// String summarizes the counts, like "2 critical, 1 high"
+func (c SeverityCounts) String() string {
+	var parts []string
+	for _, count := range []struct {
+		n    int
+		name string
+	}{{c.Critical, "critical"}, {c.High, "high"}, {c.Medium, "medium"}, {c.Low, "low"}, {c.Unknown, "unknown"}} {
+		if count.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", count.n, count.name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Severities counts the result's vulnerabilities by severity. Those rated
+// none (CVSS 0.0) carry no risk and aren't counted.
+func (sr *ScanResult) Severities() SeverityCounts {
+	var counts SeverityCounts
+	for _, vuln := range sr.Vulnerabilities {
+		_, severity, ok := vuln.Rating()
+		switch {
+		case !ok:
+			counts.Unknown++
+		case severity == SeverityCritical:
+			counts.Critical++
+		case severity == SeverityHigh:
+			counts.High++
+		case severity == SeverityMedium:
+			counts.Medium++
+		case severity == SeverityNone:
+			// No risk; counting it as low would trip low thresholds
+		default:
+			counts.Low++
+		}
+	}
+	return counts
+}
+
+// MaxSeverity returns the severity of the result's worst vulnerability.
+// One of unknown severity counts as high, so that it can't pass a
+// threshold unnoticed.
+func (sr *ScanResult) MaxSeverity() Severity {
+	max := SeverityNone
+	for _, vuln := range sr.Vulnerabilities {
+		_, severity, ok := vuln.Rating()
+		if !ok {
+			severity = SeverityHigh
+		}
+		if severity > max {
+			max = severity
+		}
+	}
+	return max
+}
+
+// CriticalCount returns the number of critical vulnerabilities
+func (sr *ScanResult) CriticalCount() int {
+	return sr.Severities().Critical
+}
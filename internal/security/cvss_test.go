@@ -0,0 +1,88 @@
+package security
+
+import "testing"
+
+func TestCVSSScore(t *testing.T) {
+	tests := []struct {
+		vector string
+		score  float64
+	}{
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", 9.8},
+		{"CVSS:3.0/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H", 10.0},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N", 6.1},
+		{"CVSS:3.1/AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:N/A:N", 5.5},
+		{"CVSS:3.1/AV:P/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N", 1.6},
+		{"CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:N/I:N/A:N", 0},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H/E:P/RL:O", 9.8},
+		{"CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N", 9.3},
+	}
+	for _, tt := range tests {
+		score, err := CVSSScore(tt.vector)
+		if err != nil {
+			t.Errorf("CVSSScore(%q): %v", tt.vector, err)
+			continue
+		}
+		if score != tt.score {
+			t.Errorf("CVSSScore(%q) = %.1f, want %.1f", tt.vector, score, tt.score)
+		}
+	}
+
+	for _, vector := range []string{
+		"AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H",
+		"CVSS:2.0/AV:N/AC:L/Au:N/C:P/I:P/A:P",
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H",
+		"CVSS:3.1/AV:X/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H",
+		"CVSS:3.1/AV:N/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H",
+		"CVSS:4.0/AV:N",
+	} {
+		if _, err := CVSSScore(vector); err == nil {
+			t.Errorf("CVSSScore(%q) succeeded", vector)
+		}
+	}
+}
+
+func TestSeverities(t *testing.T) {
+	cvss := func(vector string) []OSVSeverity {
+		return []OSVSeverity{{Type: "CVSS_V3", Score: vector}}
+	}
+	result := ScanResult{Vulnerabilities: []OSVVulnerability{
+		{ID: "critical", Severity: cvss("CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H")},
+		// Confidentiality high alone isn't critical, whatever the vector says
+		{ID: "medium", Severity: cvss("CVSS:3.1/AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:N/A:N")},
+		{ID: "low", Severity: cvss("CVSS:3.1/AV:P/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N")},
+		{ID: "none", Severity: cvss("CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:N/I:N/A:N")},
+		{ID: "rated", DatabaseSpecific: OSVDatabaseSpecific{Severity: "MODERATE"}},
+		{ID: "unknown"},
+	}}
+	want := SeverityCounts{Critical: 1, Medium: 2, Low: 1, Unknown: 1}
+	if got := result.Severities(); got != want {
+		t.Errorf("Severities() = %+v, want %+v", got, want)
+	}
+	if got := result.CriticalCount(); got != 1 {
+		t.Errorf("CriticalCount() = %d, want 1", got)
+	}
+	if got := want.String(); got != "1 critical, 2 medium, 1 low, 1 unknown" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := result.MaxSeverity(); got != SeverityCritical {
+		t.Errorf("MaxSeverity() = %s, want critical", got)
+	}
+
+	// Unknown severity mustn't pass for none
+	unknown := ScanResult{Vulnerabilities: []OSVVulnerability{{ID: "unknown"}}}
+	if got := unknown.MaxSeverity(); got != SeverityHigh {
+		t.Errorf("MaxSeverity() of an unrated vulnerability = %s, want high", got)
+	}
+}
+
+func TestRating(t *testing.T) {
+	vuln := OSVVulnerability{Severity: []OSVSeverity{
+		{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N"},
+		{Type: "CVSS_V4", Score: "CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N"},
+		{Type: "CVSS_V3", Score: "not a vector"},
+	}}
+	score, severity, ok := vuln.Rating()
+	if !ok || score != 9.3 || severity != SeverityCritical {
+		t.Errorf("Rating() = %.1f, %s, %v, want the highest score", score, severity, ok)
+	}
+}
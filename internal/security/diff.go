@@ -0,0 +1,149 @@
+package security
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v8/detect"
+)
+
+// Change is a file of a diff with the lines the diff adds to it
+type Change struct {
+	Path    string
+	Deleted bool
+	Added   []AddedLine
+}
+
+// AddedLine is a line a diff adds, numbered in the new file
+type AddedLine struct {
+	Number int
+	Text   string
+}
+
+// ParseDiff reads the changes of a unified diff, as printed by
+// git diff --no-color. Binary and deleted files are listed without lines.
+func ParseDiff(r io.Reader) ([]Change, error) {
+	var changes []Change
+	var current *Change
+	next := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			// The header names files without +++ lines too, like binaries
+			changes = append(changes, Change{})
+			current = &changes[len(changes)-1]
+			if i := strings.LastIndex(line, " b/"); i >= 0 {
+				current.Path = line[i+3:]
+			}
+			next = 0
+		case current == nil:
+			continue
+		case next == 0 && strings.HasPrefix(line, "+++ "):
+			if path := strings.TrimPrefix(line, "+++ "); path == "/dev/null" {
+				current.Deleted = true
+			} else {
+				current.Path = unquoteDiffPath(strings.TrimPrefix(path, "b/"))
+			}
+		case strings.HasPrefix(line, "@@ "):
+			start, err := hunkStart(line)
+			if err != nil {
+				return nil, err
+			}
+			next = start
+		case next > 0 && strings.HasPrefix(line, "+"):
+			current.Added = append(current.Added, AddedLine{Number: next, Text: line[1:]})
+			next++
+		case next > 0 && strings.HasPrefix(line, " "):
+			next++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read diff: %w", err)
+	}
+	return changes, nil
+}
+
+// hunkStart returns the first new-file line of a "@@ -a,b +c,d @@" header.
+// It is never zero, which marks being outside of a hunk.
+func hunkStart(header string) (int, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0, fmt.Errorf("malformed hunk header %q", header)
+	}
+	start, _, _ := strings.Cut(fields[2][1:], ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, fmt.Errorf("malformed hunk header %q", header)
+	}
+	if n == 0 {
+		n = 1
+	}
+	return n, nil
+}
+
+// unquoteDiffPath undoes git's quoting of paths with special characters
+func unquoteDiffPath(path string) string {
+	if !strings.HasPrefix(path, `"`) {
+		return path
+	}
+	if unquoted, err := strconv.Unquote(path); err == nil {
+		path = unquoted
+	}
+	// The a/ and b/ prefixes are inside the quotes
+	if len(path) > 2 && (strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/")) {
+		path = path[2:]
+	}
+	return path
+}
+
+// ScanChanges scans only the lines a diff adds for secrets, so a commit
+// is checked in the time it takes to read it rather than the whole tree
+func (gs *GitLeaksScanner) ScanChanges(ctx context.Context, changes []Change) []SecretFinding {
+	var findings []SecretFinding
+	for _, change := range changes {
+		if ctx.Err() != nil {
+			break
+		}
+		if change.Deleted || len(change.Added) == 0 {
+			continue
+		}
+		texts := make([]string, len(change.Added))
+		for i, line := range change.Added {
+			texts[i] = line.Text
+		}
+		fragment := detect.Fragment{Raw: strings.Join(texts, "\n"), FilePath: change.Path}
+		for _, finding := range convertGitleaksFindings(gs.detector.Detect(fragment)) {
+			// Map the line of the fragment back to the file
+			if finding.Line >= 1 && finding.Line <= len(change.Added) {
+				finding.Line = change.Added[finding.Line-1].Number
+			}
+			finding.File = change.Path
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// NewPackages returns the packages of after that before doesn't have at
+// the same version: what a change to a dependency file brings in
+func NewPackages(before, after []Package) []Package {
+	seen := make(map[string]bool, len(before))
+	for _, pkg := range before {
+		seen[pkg.Ecosystem+"\x00"+strings.ToLower(pkg.Name)+"\x00"+pkg.Version] = true
+	}
+	var added []Package
+	for _, pkg := range after {
+		if !seen[pkg.Ecosystem+"\x00"+strings.ToLower(pkg.Name)+"\x00"+pkg.Version] {
+			added = append(added, pkg)
+		}
+	}
+	return added
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gleicon/ophid/internal/ui"
 	"github.com/zricethezav/gitleaks/v8/detect"
 	"github.com/zricethezav/gitleaks/v8/report"
 )
@@ -71,7 +72,7 @@ func (gs *GitLeaksScanner) Scan(ctx context.Context, path string) (*SecretsRepor
 		findings, err := gs.ScanFile(ctx, filePath)
 		if err != nil {
 			// Log warning but continue
-			fmt.Printf("Warning: failed to scan %s: %v\n", filePath, err)
+			ui.Warn("failed to scan %s: %v", filePath, err)
 			continue
 		}
 		report.Findings = append(report.Findings, findings...)
@@ -117,7 +118,7 @@ func convertGitleaksFindings(findings []report.Finding) []SecretFinding {
 			Type:        f.RuleID,
 			Description: f.Description,
 			File:        f.File,
-			Line:        f.StartLine,
+			Line:        f.StartLine + 1, // gitleaks counts lines from zero
 			Secret:      f.Secret,
 			Match:       f.Match,
 			Entropy:     float64(f.Entropy), // Convert float32 to float64
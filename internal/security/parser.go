@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 )
 
-// ParseRequirementsTxt parses a Python requirements.txt file
+// ParseRequirementsTxt parses a Python requirements.txt file. Lines
+// continued with a backslash are joined, --hash options become the
+// package's hashes, and the "# via" comments pip-compile writes tell the
+// packages the project requires from those its dependencies pull in.
 func ParseRequirementsTxt(path string) ([]Package, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -17,36 +21,77 @@ func ParseRequirementsTxt(path string) ([]Package, error) {
 	defer file.Close()
 
 	packages := []Package{}
+	via := map[int][]string{} // What required each package, by index
+	last := -1                // The package "# via" comments are about
+	inVia := false
 	scanner := bufio.NewScanner(file)
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
+		for strings.HasSuffix(line, "\\") && scanner.Scan() {
+			line = strings.TrimSuffix(line, "\\") + " " + strings.TrimSpace(scanner.Text())
+		}
 
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
+		switch {
+		case line == "":
+			inVia = false
+			continue
+		case strings.HasPrefix(line, "#"):
+			comment := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			if last < 0 {
+				continue
+			}
+			if rest, ok := strings.CutPrefix(comment, "via"); ok && (rest == "" || rest[0] == ' ') {
+				inVia = true
+				comment = strings.TrimSpace(rest)
+			} else if !inVia {
+				continue
+			}
+			if comment != "" {
+				via[last] = append(via[last], comment)
+			}
+			continue
+		case strings.HasPrefix(line, "-"):
+			// Options: -r, -c, -e, --index-url and the like
+			last, inVia = -1, false
 			continue
 		}
 
-		// Parse package line
+		// An inline "# via" is pip-compile's older, single-line form
+		line, comment, _ := strings.Cut(line, " #")
+		line, options, _ := strings.Cut(line, " --")
 		pkg, err := parseRequirementLine(line)
 		if err != nil {
+			last, inVia = -1, false
 			continue // Skip invalid lines
 		}
+		for _, option := range strings.Fields("--" + options) {
+			if hash, ok := strings.CutPrefix(option, "--hash=sha256:"); ok {
+				pkg.Hashes = append(pkg.Hashes, hash)
+			}
+		}
 
 		packages = append(packages, pkg)
+		last, inVia = len(packages)-1, false
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(comment), "via "); ok {
+			for _, item := range strings.Split(rest, ",") {
+				via[last] = append(via[last], strings.TrimSpace(item))
+			}
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
 
+	resolveVia(packages, via)
 	return packages, nil
 }
 
 // parseRequirementLine parses a single requirements.txt line
 func parseRequirementLine(line string) (Package, error) {
-	// Remove inline comments
-	if idx := strings.Index(line, "#"); idx != -1 {
+	// Remove inline comments and environment markers
+	if idx := strings.IndexAny(line, "#;"); idx != -1 {
 		line = line[:idx]
 	}
 	line = strings.TrimSpace(line)
@@ -89,6 +134,38 @@ func parseRequirementLine(line string) (Package, error) {
 	}, nil
 }
 
+// resolveVia marks the packages only other packages required as indirect,
+// and records them as dependencies of those packages. Packages required
+// by a requirements file (-r, -c) or by the project itself ("name
+// (pyproject.toml)") are direct.
+func resolveVia(packages []Package, via map[int][]string) {
+	index := make(map[string]int, len(packages))
+	for n, pkg := range packages {
+		index[normalizePyPIName(pkg.Name)] = n
+	}
+	for n, items := range via {
+		direct := false
+		for _, item := range items {
+			if strings.HasPrefix(item, "-") || strings.Contains(item, " (") {
+				direct = true
+				continue
+			}
+			if parent, ok := index[normalizePyPIName(item)]; ok && parent != n {
+				packages[parent].Dependencies = append(packages[parent].Dependencies, packages[n].Name)
+			}
+		}
+		packages[n].Indirect = len(items) > 0 && !direct
+	}
+	for n := range packages {
+		sort.Strings(packages[n].Dependencies)
+	}
+}
+
+// normalizePyPIName normalizes a Python project name as PEP 503 does
+func normalizePyPIName(name string) string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(name))
+}
+
 // ParsePackageJSON parses a package.json file
 func ParsePackageJSON(path string) ([]Package, error) {
 	file, err := os.Open(path)
@@ -220,5 +297,6 @@ func parseGoModLine(line string) (Package, error) {
 		Name:      name,
 		Version:   version,
 		Ecosystem: "Go",
+		Indirect:  strings.Contains(line, "// indirect"),
 	}, nil
 }
@@ -3,6 +3,7 @@ package security
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -85,6 +86,55 @@ pytest==7.0.0
 	}
 }
 
+func TestParseRequirementsTxtCompiled(t *testing.T) {
+	// As pip-compile --generate-hashes writes it
+	reqFile := filepath.Join(t.TempDir(), "requirements.txt")
+	content := `#
+# This file is autogenerated by pip-compile with Python 3.12
+#
+--index-url https://pypi.org/simple
+
+certifi==2024.2.2 \
+    --hash=sha256:0569859f95fc761b18b45ef421b1290a0f65f147e92a1e5eb3e635f9a5e4e66f \
+    --hash=sha256:dc383c07b76109f368f6106eee2b593b04a011ea4d55f652c6ca24a754d1cdd1
+    # via requests
+charset-normalizer==3.3.2 ; python_version >= "3.8" \
+    --hash=sha256:06435b539f889b1f6f4ac1758871aae42dc3a8c0e24ac9e60c2384973ad73027
+    # via requests
+requests==2.31.0 \
+    --hash=sha256:58cd2187c01e70e6e26505bca751777aa9f2ee0b7f4300988b709f44e013003f
+    # via
+    #   -r requirements.in
+    #   webapp (pyproject.toml)
+urllib3==2.2.1  # via requests, -r requirements.in
+`
+	if err := os.WriteFile(reqFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	packages, err := ParseRequirementsTxt(reqFile)
+	if err != nil {
+		t.Fatalf("ParseRequirementsTxt() error = %v", err)
+	}
+	if len(packages) != 4 {
+		t.Fatalf("ParseRequirementsTxt() got %d packages, want 4: %+v", len(packages), packages)
+	}
+
+	certifi, charset, requests, urllib3 := packages[0], packages[1], packages[2], packages[3]
+	if certifi.Version != "2024.2.2" || len(certifi.Hashes) != 2 || !certifi.Indirect {
+		t.Errorf("certifi = %+v, want two hashes and indirect", certifi)
+	}
+	if charset.Version != "3.3.2" || len(charset.Hashes) != 1 {
+		t.Errorf("charset-normalizer = %+v, want the version without its marker", charset)
+	}
+	if requests.Indirect || !slices.Equal(requests.Dependencies, []string{"certifi", "charset-normalizer", "urllib3"}) {
+		t.Errorf("requests = %+v, want direct with its dependencies", requests)
+	}
+	if urllib3.Indirect || urllib3.Hashes != nil {
+		t.Errorf("urllib3 = %+v, want direct as the requirements file asks for it", urllib3)
+	}
+}
+
 func TestParseGoModLine(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -130,6 +180,7 @@ go 1.21
 require (
 	github.com/spf13/cobra v1.8.0
 	github.com/sirupsen/logrus v1.9.3
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 )
 `
 	if err := os.WriteFile(goModFile, []byte(content), 0644); err != nil {
@@ -141,7 +192,10 @@ require (
 		t.Fatalf("ParseGoMod() error = %v", err)
 	}
 
-	if len(packages) != 2 {
-		t.Errorf("ParseGoMod() got %d packages, want 2", len(packages))
+	if len(packages) != 3 {
+		t.Fatalf("ParseGoMod() got %d packages, want 3", len(packages))
+	}
+	if packages[0].Indirect || !packages[2].Indirect {
+		t.Errorf("ParseGoMod() = %+v, want only mousetrap indirect", packages)
 	}
 }
@@ -0,0 +1,313 @@
+// Package policy decides whether a tool may be installed: the highest
+// vulnerability severity allowed, banned licenses and packages, how old a
+// release must be, and which sources each source type may install from,
+// plus CEL rules over all of that and the time for nuanced policies.
+// Policies are read from ~/.ophid/policy.yaml; in block mode violations
+// refuse the install, in warn mode they are reported.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleicon/ophid/internal/config"
+	"github.com/gleicon/ophid/internal/security"
+)
+
+// File is the policy file in the ophid home
+const File = "policy.yaml"
+
+// Modes: what violations do
+const (
+	ModeWarn  = "warn"  // Report them (default)
+	ModeBlock = "block" // Refuse the install
+)
+
+// Severity is a vulnerability's severity, from its CVSS score
+type Severity = security.Severity
+
+// Severities, in order
+const (
+	SeverityNone     = security.SeverityNone
+	SeverityLow      = security.SeverityLow
+	SeverityMedium   = security.SeverityMedium
+	SeverityHigh     = security.SeverityHigh
+	SeverityCritical = security.SeverityCritical
+)
+
+// ParseSeverity parses a severity name like "high"
+func ParseSeverity(name string) (Severity, error) {
+	return security.ParseSeverity(name)
+}
+
+// SourceRule lists the sources of a source type installs may and may not
+// come from, as patterns like "github.com/myorg/*". Deny wins over allow;
+// with an allow list, sources it doesn't match are denied.
+type SourceRule struct {
+	Allow []string `yaml:"allow,omitempty"`
+	Deny  []string `yaml:"deny,omitempty"`
+}
+
+// Policy is what installs must comply with. Zero fields don't restrict.
+type Policy struct {
+	Mode           string                `yaml:"mode,omitempty"`
+	MaxSeverity    string                `yaml:"max_severity,omitempty"`    // Highest vulnerability severity allowed
+	BannedLicenses []string              `yaml:"banned_licenses,omitempty"` // SPDX IDs or patterns, e.g. "AGPL-*"
+	BannedPackages []string              `yaml:"banned_packages,omitempty"` // Package name patterns
+	MinPackageAge  string                `yaml:"min_package_age,omitempty"` // Releases younger than this are refused, e.g. "7d"
+	Sources        map[string]SourceRule `yaml:"sources,omitempty"`         // Keyed by source type: pypi, git, github, local, npm, ...
+	Rules          []Rule                `yaml:"rules,omitempty"`           // CEL expressions, for what the thresholds can't express
+
+	maxSeverity Severity
+	minAge      time.Duration
+}
+
+// Input is what a policy is evaluated against: a package, where it comes
+// from and what its scan found. What isn't known is left zero and the
+// rules needing it pass.
+type Input struct {
+	Name       string
+	Version    string
+	SourceType string    // "pypi", "git", ...
+	Location   string    // Package name, repository URL (without scheme) or path
+	Licenses   []string  // SPDX expressions
+	Released   time.Time // When the version was published
+	ScanFailed bool      // The vulnerability scan didn't complete
+	Severity   Severity  // Worst vulnerability found
+	Vulns      int       // Vulnerabilities found
+}
+
+// Violation is a rule an input breaks
+type Violation struct {
+	Rule    string `json:"rule"` // max_severity, banned_licenses, ...
+	Message string `json:"message"`
+}
+
+// Path returns the policy file of an ophid home
+func Path(homeDir string) string {
+	return filepath.Join(homeDir, File)
+}
+
+// Load reads the policy of an ophid home; nil when it has none
+func Load(homeDir string) (*Policy, error) {
+	data, err := os.ReadFile(Path(homeDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", Path(homeDir), err)
+	}
+	return p, nil
+}
+
+// Parse parses and validates a policy
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Default is the policy of homes without a policy file: nothing above
+// high severity, so critical vulnerabilities violate it
+func Default() *Policy {
+	p := &Policy{MaxSeverity: "high"}
+	p.validate()
+	return p
+}
+
+// validate checks the policy and parses its severity and age
+func (p *Policy) validate() error {
+	switch p.Mode {
+	case "":
+		p.Mode = ModeWarn
+	case ModeWarn, ModeBlock:
+	default:
+		return fmt.Errorf("unknown policy mode %q (available: %s, %s)", p.Mode, ModeWarn, ModeBlock)
+	}
+
+	p.maxSeverity = SeverityCritical
+	if p.MaxSeverity != "" {
+		severity, err := ParseSeverity(p.MaxSeverity)
+		if err != nil {
+			return fmt.Errorf("max_severity: %w", err)
+		}
+		p.maxSeverity = severity
+	}
+
+	p.minAge = 0
+	if p.MinPackageAge != "" {
+		age, err := config.ParseAge(p.MinPackageAge)
+		if err != nil {
+			return fmt.Errorf("invalid min_package_age %q (e.g. 72h, 7d)", p.MinPackageAge)
+		}
+		p.minAge = age
+	}
+
+	patterns := append(append([]string{}, p.BannedLicenses...), p.BannedPackages...)
+	for _, rule := range p.Sources {
+		patterns = append(append(patterns, rule.Allow...), rule.Deny...)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return compileRules(p.Rules)
+}
+
+// Blocks reports whether violations refuse the install
+func (p *Policy) Blocks() bool {
+	return p.Mode == ModeBlock
+}
+
+// NeedsMetadata reports whether the policy has rules that may need a
+// release's licenses or publication time, which are worth looking up
+func (p *Policy) NeedsMetadata() bool {
+	return len(p.BannedLicenses) > 0 || p.minAge > 0 || len(p.Rules) > 0
+}
+
+// Evaluate returns the rules an input breaks
+func (p *Policy) Evaluate(in Input) []Violation {
+	return append(p.EvaluateSource(in), p.EvaluateRelease(in)...)
+}
+
+// EvaluateSource checks what can be known before resolving a version:
+// banned packages and the source rules
+func (p *Policy) EvaluateSource(in Input) []Violation {
+	var violations []Violation
+	if in.Name != "" {
+		if pattern, ok := match(p.BannedPackages, strings.ToLower(in.Name)); ok {
+			violations = append(violations, Violation{
+				Rule:    "banned_packages",
+				Message: fmt.Sprintf("%s is banned (%s)", in.Name, pattern),
+			})
+		}
+	}
+	if rule, ok := p.Sources[in.SourceType]; ok && in.SourceType != "" {
+		if pattern, denied := matchLocation(rule.Deny, in.Location); denied {
+			violations = append(violations, Violation{
+				Rule:    "sources",
+				Message: fmt.Sprintf("%s source %s is denied (%s)", in.SourceType, in.Location, pattern),
+			})
+		} else if _, allowed := matchLocation(rule.Allow, in.Location); len(rule.Allow) > 0 && !allowed {
+			violations = append(violations, Violation{
+				Rule:    "sources",
+				Message: fmt.Sprintf("%s source %s isn't in the allow list", in.SourceType, in.Location),
+			})
+		}
+	}
+	return violations
+}
+
+// EvaluateRelease checks a resolved version: its scan, licenses and age,
+// then the rules, which may exempt it from those thresholds
+func (p *Policy) EvaluateRelease(in Input) []Violation {
+	ruled, allowed := p.evaluateRules(in)
+	if allowed {
+		return ruled
+	}
+	return append(p.evaluateThresholds(in), ruled...)
+}
+
+// subject names the package of an input, with its version when known
+func (in Input) subject() string {
+	if in.Version != "" {
+		return in.Name + "@" + in.Version
+	}
+	return in.Name
+}
+
+// evaluateThresholds checks a release against the severity, license, age
+// and scan thresholds
+func (p *Policy) evaluateThresholds(in Input) []Violation {
+	subject := in.subject()
+
+	var violations []Violation
+	if in.ScanFailed && p.Blocks() {
+		violations = append(violations, Violation{
+			Rule:    "max_severity",
+			Message: fmt.Sprintf("%s couldn't be scanned for vulnerabilities", subject),
+		})
+	}
+	if in.Severity > p.maxSeverity {
+		violations = append(violations, Violation{
+			Rule: "max_severity",
+			Message: fmt.Sprintf("%s has %d vulnerabilities, up to %s severity (at most %s allowed)",
+				subject, in.Vulns, in.Severity, p.maxSeverity),
+		})
+	}
+	for _, license := range in.Licenses {
+		for _, id := range licenseIDs(license) {
+			if pattern, ok := match(p.BannedLicenses, id); ok {
+				violations = append(violations, Violation{
+					Rule:    "banned_licenses",
+					Message: fmt.Sprintf("%s is licensed under %s, which is banned (%s)", subject, license, pattern),
+				})
+			}
+		}
+	}
+	if p.minAge > 0 && !in.Released.IsZero() {
+		if age := time.Since(in.Released); age < p.minAge {
+			violations = append(violations, Violation{
+				Rule: "min_package_age",
+				Message: fmt.Sprintf("%s was released %s ago (at least %s required)",
+					subject, age.Round(time.Hour), p.MinPackageAge),
+			})
+		}
+	}
+	return violations
+}
+
+// licenseIDs returns the license IDs of an SPDX expression, like
+// "MIT OR (Apache-2.0 WITH LLVM-exception)"
+func licenseIDs(expression string) []string {
+	var ids []string
+	fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(expression))
+	for i := 0; i < len(fields); i++ {
+		switch strings.ToUpper(fields[i]) {
+		case "AND", "OR":
+		case "WITH":
+			i++ // The exception, not a license
+		default:
+			ids = append(ids, fields[i])
+		}
+	}
+	return ids
+}
+
+// matchLocation matches a source location like match, but with * also
+// matching /, so that "*" denies every path and "github.com/org/*" allows
+// the repositories of the org's subgroups too
+func matchLocation(patterns []string, location string) (string, bool) {
+	for _, pattern := range patterns {
+		if _, ok := match([]string{strings.ReplaceAll(pattern, "/", "\x00")}, strings.ReplaceAll(location, "/", "\x00")); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// match returns the first of patterns s matches, case-insensitively
+func match(patterns []string, s string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(s)); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	home := t.TempDir()
+	if p, err := Load(home); err != nil || p != nil {
+		t.Fatalf("Load() without a policy file = %v, %v", p, err)
+	}
+
+	os.WriteFile(filepath.Join(home, File), []byte("mode: block\nmax_severity: medium\nmin_package_age: 7d\n"), 0644)
+	p, err := Load(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Blocks() || p.maxSeverity != SeverityMedium || p.minAge != 7*24*time.Hour {
+		t.Errorf("Load() = %+v", p)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, data := range []string{
+		"mode: deny",
+		"max_severity: severe",
+		"min_package_age: a week",
+		"banned_packages: ['[']",
+		"sources: {git: {allow: ['[']}}",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%q) succeeded", data)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(`
+max_severity: medium
+banned_licenses: ["AGPL-*"]
+banned_packages: ["*-nightly"]
+min_package_age: 7d
+sources:
+  github:
+    allow: ["github.com/myorg/*"]
+  local:
+    deny: ["*"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		in   Input
+		rule string
+	}{
+		{"compliant", Input{Name: "httpie", Version: "3.2.2", Severity: SeverityLow, Licenses: []string{"BSD-3-Clause"}, Released: time.Now().Add(-30 * 24 * time.Hour)}, ""},
+		{"severity", Input{Name: "httpie", Severity: SeverityHigh, Vulns: 2}, "max_severity"},
+		{"license", Input{Name: "httpie", Licenses: []string{"MIT OR AGPL-3.0-only"}}, "banned_licenses"},
+		{"license exception", Input{Name: "httpie", Licenses: []string{"Apache-2.0 WITH AGPL-exception"}}, ""},
+		{"package", Input{Name: "Ruff-Nightly"}, "banned_packages"},
+		{"age", Input{Name: "httpie", Released: time.Now().Add(-time.Hour)}, "min_package_age"},
+		{"allowed source", Input{Name: "tool", SourceType: "github", Location: "github.com/myorg/tool"}, ""},
+		{"unlisted source", Input{Name: "tool", SourceType: "github", Location: "github.com/other/tool"}, "sources"},
+		{"denied source", Input{Name: "tool", SourceType: "local", Location: "/src/tool"}, "sources"},
+		{"unrestricted source", Input{Name: "tool", SourceType: "git", Location: "gitlab.com/x/tool"}, ""},
+		{"scan failed, warn", Input{Name: "httpie", ScanFailed: true}, ""},
+	}
+	for _, tt := range tests {
+		violations := p.Evaluate(tt.in)
+		switch {
+		case tt.rule == "" && len(violations) > 0:
+			t.Errorf("%s: violations %+v, want none", tt.name, violations)
+		case tt.rule != "" && (len(violations) != 1 || violations[0].Rule != tt.rule):
+			t.Errorf("%s: violations %+v, want one of %s", tt.name, violations, tt.rule)
+		}
+	}
+
+	p.Mode = ModeBlock
+	if v := p.Evaluate(Input{Name: "httpie", ScanFailed: true}); len(v) != 1 {
+		t.Errorf("a blocking policy passed a failed scan: %+v", v)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	p := Default()
+	if p.Blocks() {
+		t.Error("the default policy blocks")
+	}
+	if v := p.Evaluate(Input{Name: "x", Severity: SeverityHigh}); len(v) != 0 {
+		t.Errorf("the default policy refused high severity: %+v", v)
+	}
+	if v := p.Evaluate(Input{Name: "x", Severity: SeverityCritical}); len(v) != 1 {
+		t.Errorf("the default policy passed critical severity: %+v", v)
+	}
+}
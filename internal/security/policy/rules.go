@@ -0,0 +1,174 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+)
+
+const (
+	// ruleTimeout bounds the wall time of one rule's evaluation
+	ruleTimeout = 100 * time.Millisecond
+
+	// ruleCostLimit bounds the CEL evaluation cost of one rule
+	ruleCostLimit = 10000
+)
+
+// Rule is a CEL expression over the package, its scan, its source and
+// the time, for rules the thresholds can't express. A deny rule that holds
+// is a violation; an allow rule that holds exempts the release from the
+// severity, license, age and scan thresholds.
+type Rule struct {
+	Name    string `yaml:"name"`
+	Allow   string `yaml:"allow,omitempty"`
+	Deny    string `yaml:"deny,omitempty"`
+	Message string `yaml:"message,omitempty"` // Reported when a deny rule holds
+
+	program cel.Program
+}
+
+// ruleEnv declares the variables visible to rule expressions:
+//
+//	pkg      name, version, licenses (list), and when known released
+//	         (timestamp) and age (duration); "package" is reserved in CEL
+//	scan     failed (bool), vulnerabilities (int), severity ("none" to
+//	         "critical") and level (0 to 4)
+//	source   type ("pypi", "git", ...) and location (package, repository
+//	         or path)
+//	now      the time of the check; now.getHours("Local") is the local hour
+func ruleEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("pkg", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("scan", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("source", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("now", cel.TimestampType),
+		cel.OptionalTypes(),
+		ext.Strings(),
+	)
+}
+
+// compileRules compiles the rules of a policy
+func compileRules(rules []Rule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	env, err := ruleEnv()
+	if err != nil {
+		return fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+	names := make(map[string]bool)
+	for n := range rules {
+		r := &rules[n]
+		if r.Name == "" {
+			return fmt.Errorf("rule %d has no name", n+1)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("rule %s is defined twice", r.Name)
+		}
+		names[r.Name] = true
+		expr := r.Deny
+		if (r.Allow == "") == (r.Deny == "") {
+			return fmt.Errorf("rule %s needs either allow or deny", r.Name)
+		}
+		if r.Allow != "" {
+			expr = r.Allow
+		}
+
+		ast, issues := env.Compile(expr)
+		if issues != nil && issues.Err() != nil {
+			return fmt.Errorf("invalid rule %s: %w", r.Name, issues.Err())
+		}
+		if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+			return fmt.Errorf("invalid rule %s: expression returns %s, want bool", r.Name, t)
+		}
+		if r.program, err = env.Program(ast, cel.CostLimit(ruleCostLimit), cel.InterruptCheckFrequency(100)); err != nil {
+			return fmt.Errorf("invalid rule %s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// ruleVars exposes an input to rule expressions. What isn't known is
+// missing, so that rules can test it with has(), e.g.
+// has(pkg.age) && pkg.age < duration("168h").
+func ruleVars(in Input, now time.Time) map[string]any {
+	licenses := in.Licenses
+	if licenses == nil {
+		licenses = []string{}
+	}
+	pkg := map[string]any{
+		"name":     in.Name,
+		"version":  in.Version,
+		"licenses": licenses,
+	}
+	if !in.Released.IsZero() {
+		pkg["released"] = in.Released
+		pkg["age"] = now.Sub(in.Released)
+	}
+	return map[string]any{
+		"pkg": pkg,
+		"scan": map[string]any{
+			"failed":          in.ScanFailed,
+			"vulnerabilities": in.Vulns,
+			"severity":        in.Severity.String(),
+			"level":           int(in.Severity),
+		},
+		"source": map[string]any{
+			"type":     in.SourceType,
+			"location": in.Location,
+		},
+		"now": now,
+	}
+}
+
+// evaluateRules returns the violations of the deny rules, and whether an
+// allow rule exempts the input from the thresholds. An allow rule that
+// fails to evaluate, e.g. on a missing field, doesn't hold; a deny rule
+// that does is a violation itself, so that a broken rule can't let
+// everything through.
+func (p *Policy) evaluateRules(in Input) (violations []Violation, allowed bool) {
+	if len(p.Rules) == 0 {
+		return nil, false
+	}
+	vars := ruleVars(in, time.Now())
+	for _, r := range p.Rules {
+		holds, err := evalRule(r.program, vars)
+		switch {
+		case err != nil && r.Deny != "":
+			violations = append(violations, Violation{
+				Rule:    r.Name,
+				Message: fmt.Sprintf("rule %s failed on %s: %v", r.Name, in.subject(), err),
+			})
+		case err != nil:
+			slog.Warn("policy rule failed", "rule", r.Name, "package", in.subject(), "error", err)
+		case holds && r.Allow != "":
+			allowed = true
+		case holds:
+			message := r.Message
+			if message == "" {
+				message = "denied by rule " + r.Name
+			}
+			violations = append(violations, Violation{Rule: r.Name, Message: in.subject() + ": " + message})
+		}
+	}
+	return violations, allowed
+}
+
+// evalRule evaluates a rule's expression, which must yield a bool
+func evalRule(prg cel.Program, vars map[string]any) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ruleTimeout)
+	defer cancel()
+	out, _, err := prg.ContextEval(ctx, vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s, want bool", out.Type())
+	}
+	return b, nil
+}
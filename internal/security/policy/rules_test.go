@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRules(t *testing.T) {
+	p, err := Parse([]byte(`
+mode: block
+max_severity: medium
+rules:
+  - name: internal-tools
+    allow: source.type == "git" && source.location.startsWith("github.com/myorg/")
+  - name: fresh-after-hours
+    deny: has(pkg.age) && pkg.age < duration("336h") && now.getHours("Local") >= 0
+    message: releases younger than two weeks wait for review
+  - name: no-copyleft-git
+    deny: source.type == "git" && pkg.licenses.exists(l, l.startsWith("GPL"))
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		in    Input
+		rules []string
+	}{
+		{"compliant", Input{Name: "httpie", SourceType: "pypi", Released: time.Now().Add(-30 * 24 * time.Hour)}, nil},
+		{"threshold", Input{Name: "httpie", SourceType: "pypi", Severity: SeverityCritical}, []string{"max_severity"}},
+		{"allowed past the threshold", Input{Name: "tool", SourceType: "git", Location: "github.com/myorg/tool", Severity: SeverityCritical}, nil},
+		{"deny", Input{Name: "httpie", SourceType: "pypi", Released: time.Now().Add(-time.Hour)}, []string{"fresh-after-hours"}},
+		{"unknown age", Input{Name: "httpie", SourceType: "pypi"}, nil},
+		{"deny despite allow", Input{Name: "tool", SourceType: "git", Location: "github.com/myorg/tool", Licenses: []string{"GPL-3.0"}}, []string{"no-copyleft-git"}},
+	}
+	for _, tt := range tests {
+		var rules []string
+		for _, v := range p.EvaluateRelease(tt.in) {
+			rules = append(rules, v.Rule)
+		}
+		if strings.Join(rules, ",") != strings.Join(tt.rules, ",") {
+			t.Errorf("%s: violated %v, want %v", tt.name, rules, tt.rules)
+		}
+	}
+
+	for _, v := range p.EvaluateRelease(Input{Name: "httpie", Released: time.Now()}) {
+		if v.Rule == "fresh-after-hours" && !strings.Contains(v.Message, "wait for review") {
+			t.Errorf("message = %q, want the rule's", v.Message)
+		}
+	}
+}
+
+func TestRuleErrors(t *testing.T) {
+	for _, data := range []string{
+		"rules: [{allow: 'true'}]",
+		"rules: [{name: x}]",
+		"rules: [{name: x, allow: 'true', deny: 'false'}]",
+		"rules: [{name: x, deny: 'pkg.name +'}]",
+		"rules: [{name: x, deny: '\"not a bool\"'}]",
+		"rules: [{name: x, deny: 'true'}, {name: x, deny: 'false'}]",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%q) succeeded", data)
+		}
+	}
+
+	// A deny rule failing at runtime is a violation, not a pass
+	p, err := Parse([]byte("rules: [{name: age, deny: 'pkg.age < duration(\"1h\")'}]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := p.EvaluateRelease(Input{Name: "httpie"}); len(v) != 1 || v[0].Rule != "age" {
+		t.Errorf("violations = %+v, want the failing rule", v)
+	}
+}
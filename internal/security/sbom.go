@@ -4,23 +4,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 )
 
 // SBOM represents a Software Bill of Materials in CycloneDX format
 type SBOM struct {
-	BOMFormat   string       `json:"bomFormat"`
-	SpecVersion string       `json:"specVersion"`
-	Version     int          `json:"version"`
-	Metadata    SBOMMetadata `json:"metadata"`
-	Components  []Component  `json:"components"`
+	BOMFormat    string       `json:"bomFormat"`
+	SpecVersion  string       `json:"specVersion"`
+	Version      int          `json:"version"`
+	Metadata     SBOMMetadata `json:"metadata"`
+	Components   []Component  `json:"components"`
+	Dependencies []Dependency `json:"dependencies,omitempty"`
 }
 
 // SBOMMetadata contains SBOM metadata
 type SBOMMetadata struct {
-	Timestamp string        `json:"timestamp"`
-	Tools     []SBOMTool    `json:"tools"`
-	Component *Component    `json:"component,omitempty"`
+	Timestamp string     `json:"timestamp"`
+	Tools     []SBOMTool `json:"tools"`
+	Component *Component `json:"component,omitempty"`
 }
 
 // SBOMTool represents the tool that generated the SBOM
@@ -32,18 +34,21 @@ type SBOMTool struct {
 
 // Component represents a software component
 type Component struct {
-	Type       string            `json:"type"`
-	Name       string            `json:"name"`
-	Version    string            `json:"version"`
-	PackageURL string            `json:"purl,omitempty"`
-	Licenses   []License         `json:"licenses,omitempty"`
-	Hashes     []Hash            `json:"hashes,omitempty"`
-	ExternalRefs []ExternalRef   `json:"externalReferences,omitempty"`
+	BOMRef       string        `json:"bom-ref,omitempty"`
+	Type         string        `json:"type"`
+	Name         string        `json:"name"`
+	Version      string        `json:"version,omitempty"`
+	PackageURL   string        `json:"purl,omitempty"`
+	Licenses     []License     `json:"licenses,omitempty"`
+	Hashes       []Hash        `json:"hashes,omitempty"`
+	ExternalRefs []ExternalRef `json:"externalReferences,omitempty"`
 }
 
-// License represents a software license
+// License represents a software license: a single license, or an SPDX
+// expression combining several
 type License struct {
-	License LicenseChoice `json:"license"`
+	License    *LicenseChoice `json:"license,omitempty"`
+	Expression string         `json:"expression,omitempty"`
 }
 
 // LicenseChoice represents a license choice
@@ -64,21 +69,69 @@ type ExternalRef struct {
 	URL  string `json:"url"`
 }
 
-// GenerateSBOM generates an SBOM from packages
-func GenerateSBOM(packages []Package, toolName string) (*SBOM, error) {
+// Dependency lists the components a component requires, by bom-ref
+type Dependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// GenerateSBOM generates an SBOM of the packages of project, which
+// becomes the metadata component. The project depends on its direct
+// packages, and each package on the packages it requires among the
+// others; a package listed twice is one component.
+func GenerateSBOM(packages []Package, project Package) (*SBOM, error) {
+	root := Component{
+		BOMRef:     buildPURL(project),
+		Type:       "application",
+		Name:       project.Name,
+		Version:    project.Version,
+		PackageURL: buildPURL(project),
+		Licenses:   sbomLicenses(project.Licenses),
+		Hashes:     sbomHashes(project.Hashes),
+	}
 	components := make([]Component, 0, len(packages))
+	refs := make(map[string]string, len(packages)) // Ecosystem and name to bom-ref
+	var listed []Package
 
 	for _, pkg := range packages {
+		purl := buildPURL(pkg)
+		key := packageKey(pkg.Ecosystem, pkg.Name)
+		if _, ok := refs[key]; ok {
+			continue
+		}
+		refs[key] = purl
+		listed = append(listed, pkg)
+
 		component := Component{
+			BOMRef:     purl,
 			Type:       "library",
 			Name:       pkg.Name,
 			Version:    pkg.Version,
-			PackageURL: buildPURL(pkg),
+			PackageURL: purl,
+			Licenses:   sbomLicenses(pkg.Licenses),
+			Hashes:     sbomHashes(pkg.Hashes),
 		}
 
 		components = append(components, component)
 	}
 
+	direct := Dependency{Ref: root.BOMRef}
+	dependencies := make([]Dependency, 0, len(listed)+1)
+	for _, pkg := range listed {
+		ref := refs[packageKey(pkg.Ecosystem, pkg.Name)]
+		if !pkg.Indirect {
+			direct.DependsOn = append(direct.DependsOn, ref)
+		}
+		dependency := Dependency{Ref: ref}
+		for _, name := range pkg.Dependencies {
+			if dep, ok := refs[packageKey(pkg.Ecosystem, name)]; ok {
+				dependency.DependsOn = append(dependency.DependsOn, dep)
+			}
+		}
+		dependencies = append(dependencies, dependency)
+	}
+	dependencies = append([]Dependency{direct}, dependencies...)
+
 	sbom := &SBOM{
 		BOMFormat:   "CycloneDX",
 		SpecVersion: "1.4",
@@ -92,13 +145,52 @@ func GenerateSBOM(packages []Package, toolName string) (*SBOM, error) {
 					Version: "0.1.0",
 				},
 			},
+			Component: &root,
 		},
-		Components: components,
+		Components:   components,
+		Dependencies: dependencies,
 	}
 
 	return sbom, nil
 }
 
+// packageKey identifies a package of an ecosystem, whatever the case and
+// separators of its name
+func packageKey(ecosystem, name string) string {
+	if ecosystem == "PyPI" {
+		name = normalizePyPIName(name)
+	}
+	return ecosystem + "\x00" + name
+}
+
+// sbomLicenses returns the CycloneDX licenses of a package: SPDX ids ophid
+// knows as ids, expressions as expressions, and anything else by name
+func sbomLicenses(licenses []string) []License {
+	var result []License
+	for _, license := range licenses {
+		license = strings.TrimSpace(license)
+		switch {
+		case license == "":
+		case strings.Contains(license, " OR ") || strings.Contains(license, " AND ") || strings.Contains(license, " WITH "):
+			result = append(result, License{Expression: license})
+		case knownLicenses[license].Name != "":
+			result = append(result, License{License: &LicenseChoice{ID: license}})
+		default:
+			result = append(result, License{License: &LicenseChoice{Name: license}})
+		}
+	}
+	return result
+}
+
+// sbomHashes returns the CycloneDX hashes of SHA-256 hex digests
+func sbomHashes(digests []string) []Hash {
+	var result []Hash
+	for _, digest := range digests {
+		result = append(result, Hash{Algorithm: "SHA-256", Content: strings.ToLower(digest)})
+	}
+	return result
+}
+
 // WriteSBOM writes an SBOM to a file
 func WriteSBOM(sbom *SBOM, path string) error {
 	file, err := os.Create(path)
@@ -120,15 +212,20 @@ func WriteSBOM(sbom *SBOM, path string) error {
 // buildPURL builds a Package URL (purl) for a package
 func buildPURL(pkg Package) string {
 	// Package URL format: pkg:<type>/<namespace>/<name>@<version>
+	var purl string
 	ecosystem := pkg.Ecosystem
 	switch ecosystem {
 	case "PyPI":
-		return fmt.Sprintf("pkg:pypi/%s@%s", pkg.Name, pkg.Version)
+		purl = "pkg:pypi/" + pkg.Name
 	case "npm":
-		return fmt.Sprintf("pkg:npm/%s@%s", pkg.Name, pkg.Version)
+		purl = "pkg:npm/" + pkg.Name
 	case "Go":
-		return fmt.Sprintf("pkg:golang/%s@%s", pkg.Name, pkg.Version)
+		purl = "pkg:golang/" + pkg.Name
 	default:
-		return fmt.Sprintf("pkg:generic/%s@%s", pkg.Name, pkg.Version)
+		purl = "pkg:generic/" + pkg.Name
+	}
+	if pkg.Version == "" {
+		return purl
 	}
+	return purl + "@" + pkg.Version
 }
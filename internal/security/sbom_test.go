@@ -3,6 +3,7 @@ package security
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -45,7 +46,7 @@ func TestGenerateSBOM(t *testing.T) {
 		{Name: "flask", Version: "2.0.0", Ecosystem: "PyPI"},
 	}
 
-	sbom, err := GenerateSBOM(packages, "test-tool")
+	sbom, err := GenerateSBOM(packages, Package{Name: "test-tool", Version: "1.0.0"})
 	if err != nil {
 		t.Fatalf("GenerateSBOM() error = %v", err)
 	}
@@ -67,6 +68,52 @@ func TestGenerateSBOM(t *testing.T) {
 	}
 }
 
+func TestGenerateSBOMGraph(t *testing.T) {
+	packages := []Package{
+		{Name: "requests", Version: "2.31.0", Ecosystem: "PyPI", Licenses: []string{"Apache-2.0"},
+			Hashes: []string{"ABC123"}, Dependencies: []string{"certifi", "urllib3"}},
+		{Name: "certifi", Version: "2024.2.2", Ecosystem: "PyPI", Licenses: []string{"MPL-2.0 OR MIT"}, Indirect: true},
+		{Name: "urllib3", Version: "2.2.1", Ecosystem: "PyPI", Licenses: []string{"MIT License"}, Indirect: true},
+		{Name: "Requests", Version: "2.31.0", Ecosystem: "PyPI"},
+	}
+
+	sbom, err := GenerateSBOM(packages, Package{Name: "webapp", Version: "0.3.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := sbom.Metadata.Component
+	if root == nil || root.Name != "webapp" || root.Type != "application" || root.BOMRef != "pkg:generic/webapp@0.3.0" {
+		t.Errorf("metadata component = %+v", root)
+	}
+	if len(sbom.Components) != 3 {
+		t.Fatalf("Components count = %d, want 3 without the duplicate", len(sbom.Components))
+	}
+
+	requests := sbom.Components[0]
+	if len(requests.Licenses) != 1 || requests.Licenses[0].License == nil || requests.Licenses[0].License.ID != "Apache-2.0" {
+		t.Errorf("requests licenses = %+v, want the SPDX id", requests.Licenses)
+	}
+	if len(requests.Hashes) != 1 || requests.Hashes[0] != (Hash{Algorithm: "SHA-256", Content: "abc123"}) {
+		t.Errorf("requests hashes = %+v", requests.Hashes)
+	}
+	if l := sbom.Components[1].Licenses; len(l) != 1 || l[0].Expression != "MPL-2.0 OR MIT" {
+		t.Errorf("certifi licenses = %+v, want an expression", l)
+	}
+	if l := sbom.Components[2].Licenses; len(l) != 1 || l[0].License == nil || l[0].License.Name != "MIT License" {
+		t.Errorf("urllib3 licenses = %+v, want a name", l)
+	}
+
+	want := []Dependency{
+		{Ref: "pkg:generic/webapp@0.3.0", DependsOn: []string{"pkg:pypi/requests@2.31.0"}},
+		{Ref: "pkg:pypi/requests@2.31.0", DependsOn: []string{"pkg:pypi/certifi@2024.2.2", "pkg:pypi/urllib3@2.2.1"}},
+		{Ref: "pkg:pypi/certifi@2024.2.2"},
+		{Ref: "pkg:pypi/urllib3@2.2.1"},
+	}
+	if !reflect.DeepEqual(sbom.Dependencies, want) {
+		t.Errorf("Dependencies = %+v, want %+v", sbom.Dependencies, want)
+	}
+}
+
 func TestWriteSBOM(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "sbom.json")
@@ -75,7 +122,7 @@ func TestWriteSBOM(t *testing.T) {
 		{Name: "requests", Version: "2.28.0", Ecosystem: "PyPI"},
 	}
 
-	sbom, err := GenerateSBOM(packages, "test-tool")
+	sbom, err := GenerateSBOM(packages, Package{Name: "test-tool", Version: "1.0.0"})
 	if err != nil {
 		t.Fatalf("GenerateSBOM() error = %v", err)
 	}
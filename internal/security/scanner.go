@@ -7,15 +7,23 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/gleicon/ophid/internal/events"
+	"github.com/gleicon/ophid/internal/httpclient"
+	"github.com/gleicon/ophid/internal/ui"
 	"golang.org/x/time/rate"
 )
 
+// osvAPI is the OSV.dev API; tests point it elsewhere
+var osvAPI = "https://api.osv.dev/v1/"
+
 const (
-	osvAPIURL = "https://api.osv.dev/v1/query"
+	osvBatchSize = 1000 // Most queries OSV.dev takes in one querybatch request
+	osvWorkers   = 8    // Vulnerabilities fetched at once after a querybatch
 )
 
 // OSVResponse represents the response from OSV.dev API
@@ -28,12 +36,20 @@ type OSVResponse struct {
 type OSVVulnerability struct {
 	ID       string                `json:"id"`
 	Summary  string                `json:"summary"`
+	Aliases  []string              `json:"aliases,omitempty"` // e.g. the CVE of a GHSA
 	Details  string                `json:"details"`
 	Affected []OSVAffected         `json:"affected"`
 	Severity []OSVSeverity         `json:"severity,omitempty"`
 	Modified string                `json:"modified"`
 	Published string               `json:"published"`
 	References []OSVReference      `json:"references,omitempty"`
+	DatabaseSpecific OSVDatabaseSpecific `json:"database_specific,omitempty"`
+}
+
+// OSVDatabaseSpecific holds what the advisory database adds, like GitHub's
+// severity rating
+type OSVDatabaseSpecific struct {
+	Severity string `json:"severity,omitempty"` // "CRITICAL", "HIGH", "MODERATE" or "LOW"
 }
 
 // OSVAffected represents affected packages
@@ -85,6 +101,26 @@ type PackageQuery struct {
 	Ecosystem string `json:"ecosystem"`
 }
 
+// BatchRequest represents a querybatch request to OSV.dev
+type BatchRequest struct {
+	Queries []QueryRequest `json:"queries"`
+}
+
+// BatchResponse represents the response to a querybatch request: for each
+// query, in order, the IDs of the vulnerabilities affecting it
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// BatchResult is the answer to one query of a batch. Only IDs are given;
+// the vulnerabilities are fetched by ID.
+type BatchResult struct {
+	Vulns []struct {
+		ID string `json:"id"`
+	} `json:"vulns"`
+	NextPageToken string `json:"next_page_token,omitempty"` // Set when more vulnerabilities than fit were found
+}
+
 // RateLimiter provides rate limiting for API calls
 // Adapted from mcp-osv
 type RateLimiter struct {
@@ -110,39 +146,41 @@ func (rl *RateLimiter) Wait(ctx context.Context) error {
 type Scanner struct {
 	client        *http.Client
 	rateLimiter   *RateLimiter
+	vulnLimiter   *RateLimiter // Paces the vulnerability fetches of batch scans
 	secretScanner SecretScanner
 }
 
+// osvTransport reaches OSV.dev through the configured proxy and CAs
+func osvTransport() *http.Transport {
+	t := httpclient.Transport()
+	t.MaxIdleConns = 10
+	t.IdleConnTimeout = 30 * time.Second
+	return t
+}
+
 // NewScanner creates a new vulnerability scanner
 func NewScanner() *Scanner {
 	secretScanner, err := NewGitLeaksScanner()
 	if err != nil {
-		fmt.Printf("[WARN] failed to initialize secret scanner: %v\n", err)
+		ui.Warn("failed to initialize secret scanner: %v", err)
 		secretScanner = nil
 	}
 
 	return &Scanner{
 		client: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:       10,
-				IdleConnTimeout:    30 * time.Second,
-				DisableCompression: false,
-			},
+			Timeout:   30 * time.Second,
+			Transport: osvTransport(),
 		},
 		rateLimiter:   NewRateLimiter(1.0), // 1 request per second, same as mcp-osv
+		vulnLimiter:   NewRateLimiter(10.0),
 		secretScanner: secretScanner,
 	}
 }
 
 // ScanPackage scans a single package for vulnerabilities
 func (s *Scanner) ScanPackage(ctx context.Context, ecosystem, name, version string) (*OSVResponse, error) {
-	// Input validation (from mcp-osv pattern)
-	if err := validatePackageName(name); err != nil {
-		return nil, fmt.Errorf("invalid package name: %w", err)
-	}
-	if err := validateVersion(version); err != nil {
-		return nil, fmt.Errorf("invalid version: %w", err)
+	if err := validateQuery(name, version); err != nil {
+		return nil, err
 	}
 
 	// Rate limit
@@ -150,7 +188,6 @@ func (s *Scanner) ScanPackage(ctx context.Context, ecosystem, name, version stri
 		return nil, fmt.Errorf("rate limiter error: %w", err)
 	}
 
-	// Build request
 	req := QueryRequest{
 		Package: &PackageQuery{
 			Name:      name,
@@ -158,65 +195,205 @@ func (s *Scanner) ScanPackage(ctx context.Context, ecosystem, name, version stri
 		},
 		Version: version,
 	}
+	var osvResp OSVResponse
+	if err := s.do(ctx, "POST", "query", req, &osvResp); err != nil {
+		return nil, err
+	}
+	return &osvResp, nil
+}
 
-	// Marshal request
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+// ScanPackages scans multiple packages, returning a result for each in
+// order. They are looked up with OSV.dev's querybatch, up to osvBatchSize
+// per request, and the vulnerabilities found are then fetched by ID with
+// osvWorkers at once. Each vulnerable package is emitted as a scan.finding
+// event.
+func (s *Scanner) ScanPackages(ctx context.Context, packages []Package) ([]ScanResult, error) {
+	results, err := s.scanPackages(ctx, packages)
+	for _, r := range results {
+		if !r.HasVulnerabilities() {
+			continue
+		}
+		ids := make([]string, len(r.Vulnerabilities))
+		for i, v := range r.Vulnerabilities {
+			ids[i] = v.ID
+		}
+		events.Emit(events.ScanFinding, r.Package.Name+"@"+r.Package.Version,
+			fmt.Sprintf("%d vulnerabilities (%d critical)", len(ids), r.CriticalCount()), map[string]string{
+				"ecosystem":       r.Package.Ecosystem,
+				"vulnerabilities": strings.Join(ids, ","),
+				"severity":        r.MaxSeverity().String(),
+			})
 	}
+	return results, err
+}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", osvAPIURL, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// scanPackages looks up packages as ScanPackages describes
+func (s *Scanner) scanPackages(ctx context.Context, packages []Package) ([]ScanResult, error) {
+	results := make([]ScanResult, len(packages))
+	var queued []int
+	for i, pkg := range packages {
+		results[i].Package = pkg
+		if err := validateQuery(pkg.Name, pkg.Version); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		queued = append(queued, i)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("User-Agent", "ophid/0.1.0")
+	// A single query returns the vulnerabilities whole
+	if len(queued) == 1 {
+		i := queued[0]
+		resp, err := s.ScanPackage(ctx, packages[i].Ecosystem, packages[i].Name, packages[i].Version)
+		if err != nil {
+			results[i].Error = err.Error()
+		} else {
+			results[i].Vulnerabilities = resp.Vulns
+		}
+		return results, nil
+	}
 
-	// Execute request
-	resp, err := s.client.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	found := make(map[int][]string) // Package index -> vulnerability IDs
+	for start := 0; start < len(queued); start += osvBatchSize {
+		batch := queued[start:min(start+osvBatchSize, len(queued))]
+		answers, err := s.queryBatch(ctx, packages, batch)
+		if err != nil {
+			for _, i := range batch {
+				results[i].Error = err.Error()
+			}
+			continue
+		}
+		for j, i := range batch {
+			if answers[j].NextPageToken != "" {
+				// More vulnerabilities than a batch answer holds: ask alone
+				resp, err := s.ScanPackage(ctx, packages[i].Ecosystem, packages[i].Name, packages[i].Version)
+				if err != nil {
+					results[i].Error = err.Error()
+				} else {
+					results[i].Vulnerabilities = resp.Vulns
+				}
+				continue
+			}
+			for _, v := range answers[j].Vulns {
+				found[i] = append(found[i], v.ID)
+			}
+		}
 	}
-	defer resp.Body.Close()
 
-	// Check status
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("OSV API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	vulns, errs := s.fetchVulns(ctx, found)
+	for i, ids := range found {
+		for _, id := range ids {
+			if err, failed := errs[id]; failed {
+				results[i].Error = err.Error()
+				continue
+			}
+			results[i].Vulnerabilities = append(results[i].Vulnerabilities, vulns[id])
+		}
 	}
+	return results, nil
+}
 
-	// Parse response
-	var osvResp OSVResponse
-	if err := json.NewDecoder(resp.Body).Decode(&osvResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// queryBatch asks OSV.dev which vulnerabilities affect the packages at
+// indexes batch, and returns the answers in the same order
+func (s *Scanner) queryBatch(ctx context.Context, packages []Package, batch []int) ([]BatchResult, error) {
+	req := BatchRequest{Queries: make([]QueryRequest, len(batch))}
+	for j, i := range batch {
+		req.Queries[j] = QueryRequest{
+			Package: &PackageQuery{Name: packages[i].Name, Ecosystem: packages[i].Ecosystem},
+			Version: packages[i].Version,
+		}
 	}
 
-	return &osvResp, nil
+	if err := s.rateLimiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limiter error: %w", err)
+	}
+	var resp BatchResponse
+	if err := s.do(ctx, "POST", "querybatch", req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Results) != len(batch) {
+		return nil, fmt.Errorf("OSV API answered %d of %d queries", len(resp.Results), len(batch))
+	}
+	return resp.Results, nil
 }
 
-// ScanPackages scans multiple packages
-func (s *Scanner) ScanPackages(ctx context.Context, packages []Package) ([]ScanResult, error) {
-	results := make([]ScanResult, 0, len(packages))
+// fetchVulns fetches each vulnerability found once, osvWorkers at a time,
+// returning them and the errors of the ones that failed by ID
+func (s *Scanner) fetchVulns(ctx context.Context, found map[int][]string) (map[string]OSVVulnerability, map[string]error) {
+	vulns := make(map[string]OSVVulnerability)
+	errs := make(map[string]error)
+	ids := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range osvWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				var vuln OSVVulnerability
+				err := s.vulnLimiter.Wait(ctx)
+				if err == nil {
+					err = s.do(ctx, "GET", "vulns/"+url.PathEscape(id), nil, &vuln)
+				}
+				mu.Lock()
+				if err != nil {
+					errs[id] = fmt.Errorf("failed to fetch %s: %w", id, err)
+				} else {
+					vulns[id] = vuln
+				}
+				mu.Unlock()
+			}
+		}()
+	}
 
-	for _, pkg := range packages {
-		resp, err := s.ScanPackage(ctx, pkg.Ecosystem, pkg.Name, pkg.Version)
+	seen := make(map[string]bool)
+	for _, list := range found {
+		for _, id := range list {
+			if !seen[id] {
+				seen[id] = true
+				ids <- id
+			}
+		}
+	}
+	close(ids)
+	wg.Wait()
+	return vulns, errs
+}
+
+// do sends a request to an OSV.dev API endpoint, with body as JSON unless
+// it's nil, and decodes the JSON response into out
+func (s *Scanner) do(ctx context.Context, method, endpoint string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
 		if err != nil {
-			results = append(results, ScanResult{
-				Package: pkg,
-				Error:   err.Error(),
-			})
-			continue
+			return fmt.Errorf("failed to marshal request: %w", err)
 		}
+		reader = bytes.NewReader(data)
+	}
 
-		results = append(results, ScanResult{
-			Package:         pkg,
-			Vulnerabilities: resp.Vulns,
-		})
+	httpReq, err := http.NewRequestWithContext(ctx, method, osvAPI+endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
 	}
+	httpReq.Header.Set("User-Agent", "ophid/0.1.0")
 
-	return results, nil
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("OSV API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
 }
 
 // ScanResult represents the scan result for a package
@@ -231,20 +408,15 @@ func (sr *ScanResult) HasVulnerabilities() bool {
 	return len(sr.Vulnerabilities) > 0
 }
 
-// CriticalCount returns the number of critical vulnerabilities
-func (sr *ScanResult) CriticalCount() int {
-	count := 0
-	for _, vuln := range sr.Vulnerabilities {
-		for _, sev := range vuln.Severity {
-			if sev.Type == "CVSS_V3" && strings.HasPrefix(sev.Score, "CVSS:3") {
-				// Parse score (simplified - production should use proper CVSS parser)
-				if strings.Contains(sev.Score, "/C:H") || strings.Contains(sev.Score, "/9.") {
-					count++
-				}
-			}
-		}
+// validateQuery checks a package name and version before they're sent
+func validateQuery(name, version string) error {
+	if err := validatePackageName(name); err != nil {
+		return fmt.Errorf("invalid package name: %w", err)
 	}
-	return count
+	if err := validateVersion(version); err != nil {
+		return fmt.Errorf("invalid version: %w", err)
+	}
+	return nil
 }
 
 // Input validation functions (adapted from mcp-osv)
@@ -1,6 +1,14 @@
 package security
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -86,3 +94,85 @@ func TestScanResult_HasVulnerabilities(t *testing.T) {
 		})
 	}
 }
+
+func TestScanPackagesBatch(t *testing.T) {
+	var mu sync.Mutex
+	fetched := map[string]int{}
+	batches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/querybatch":
+			var req BatchRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			mu.Lock()
+			batches++
+			mu.Unlock()
+			var answers []string
+			for _, q := range req.Queries {
+				switch q.Package.Name {
+				case "requests", "urllib3":
+					answers = append(answers, `{"vulns": [{"id": "GHSA-shared"}, {"id": "PYSEC-`+q.Package.Name+`"}]}`)
+				case "paged":
+					answers = append(answers, `{"vulns": [{"id": "PYSEC-1"}], "next_page_token": "more"}`)
+				default:
+					answers = append(answers, `{}`)
+				}
+			}
+			fmt.Fprintf(w, `{"results": [%s]}`, strings.Join(answers, ","))
+		case r.URL.Path == "/query":
+			fmt.Fprint(w, `{"vulns": [{"id": "PYSEC-1"}, {"id": "PYSEC-2"}]}`)
+		case strings.HasPrefix(r.URL.Path, "/vulns/"):
+			id := strings.TrimPrefix(r.URL.Path, "/vulns/")
+			mu.Lock()
+			fetched[id]++
+			mu.Unlock()
+			fmt.Fprintf(w, `{"id": %q, "summary": "summary of %s"}`, id, id)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	old := osvAPI
+	osvAPI = srv.URL + "/"
+	defer func() { osvAPI = old }()
+
+	s := &Scanner{client: srv.Client(), rateLimiter: NewRateLimiter(1000), vulnLimiter: NewRateLimiter(1000)}
+	packages := []Package{
+		{Name: "requests", Version: "2.0.0", Ecosystem: "PyPI"},
+		{Name: "../evil", Version: "1.0", Ecosystem: "PyPI"},
+		{Name: "clean", Version: "1.0", Ecosystem: "PyPI"},
+		{Name: "urllib3", Version: "1.0", Ecosystem: "PyPI"},
+		{Name: "paged", Version: "1.0", Ecosystem: "PyPI"},
+	}
+	results, err := s.ScanPackages(context.Background(), packages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(packages) {
+		t.Fatalf("got %d results for %d packages", len(results), len(packages))
+	}
+	for i, r := range results {
+		if !reflect.DeepEqual(r.Package, packages[i]) {
+			t.Errorf("result %d is for %s, want %s", i, r.Package.Name, packages[i].Name)
+		}
+	}
+
+	if r := results[0]; len(r.Vulnerabilities) != 2 || r.Vulnerabilities[1].Summary != "summary of PYSEC-requests" {
+		t.Errorf("requests: %+v", r)
+	}
+	if results[1].Error == "" {
+		t.Error("scanned an invalid package name")
+	}
+	if r := results[2]; r.HasVulnerabilities() || r.Error != "" {
+		t.Errorf("clean: %+v", r)
+	}
+	if r := results[4]; len(r.Vulnerabilities) != 2 {
+		t.Errorf("paged answer wasn't asked again alone: %+v", r)
+	}
+	if batches != 1 {
+		t.Errorf("sent %d batches, want 1", batches)
+	}
+	if fetched["GHSA-shared"] != 1 || len(fetched) != 3 {
+		t.Errorf("fetched %v, want each vulnerability once", fetched)
+	}
+}
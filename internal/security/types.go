@@ -5,4 +5,10 @@ type Package struct {
 	Name      string
 	Version   string
 	Ecosystem string
+
+	// What dependency files and registries tell about a package, for SBOMs
+	Licenses     []string `json:",omitempty"` // SPDX ids or expressions, else license names
+	Hashes       []string `json:",omitempty"` // SHA-256 hex digests of its artifacts
+	Indirect     bool     `json:",omitempty"` // Required by another package, not the project
+	Dependencies []string `json:",omitempty"` // Names of the packages it requires
 }
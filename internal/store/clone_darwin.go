@@ -0,0 +1,16 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile creates dst as a clone of src, which APFS supports
+func cloneFile(src, dst string) error {
+	if err := unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW); err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+	}
+	return nil
+}
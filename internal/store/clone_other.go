@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package store
+
+import "errors"
+
+// cloneFile can't clone files on this platform
+func cloneFile(src, dst string) error {
+	return errors.ErrUnsupported
+}
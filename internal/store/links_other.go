@@ -0,0 +1,10 @@
+//go:build !unix
+
+package store
+
+import "io/fs"
+
+// linkCount isn't known from a FileInfo on this platform
+func linkCount(info fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,316 @@
+// Package store keeps files under the sha256 of their content, so that a
+// file several runtimes, tool venvs and downloads hold takes disk space
+// once. Copies are replaced with reflinks to the stored file where the
+// filesystem clones files (btrfs, XFS, APFS), and with hard links elsewhere.
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DirName is the store's directory in an ophid home
+const DirName = "store"
+
+// How files are shared with the store
+const (
+	ModeAuto    = "auto"    // Reflinks where the filesystem clones files, hard links elsewhere (default)
+	ModeReflink = "reflink" // Reflinks only; nothing is shared where the filesystem can't clone
+	ModeOff     = "off"     // Nothing is shared
+)
+
+// minShareSize is the size below which a file isn't worth hashing and
+// linking
+const minShareSize = 16 << 10
+
+// mode is the configured sharing mode
+var mode = ModeAuto
+
+// Configure sets how files are shared with the store, "" being auto. It
+// runs before any file is shared.
+func Configure(m string) error {
+	switch m {
+	case "":
+		mode = ModeAuto
+	case ModeAuto, ModeReflink, ModeOff:
+		mode = m
+	default:
+		return fmt.Errorf("unknown dedupe mode %q (available: %s, %s, %s)", m, ModeAuto, ModeReflink, ModeOff)
+	}
+	return nil
+}
+
+// Store is the content-addressed store of an ophid home
+type Store struct {
+	dir string
+
+	probe  sync.Once
+	clones bool // Whether the store's filesystem clones files
+}
+
+// Stats is what sharing a directory did
+type Stats struct {
+	Files int   // Files replaced by a link to the stored copy
+	Bytes int64 // Disk space that frees
+}
+
+// Usage is the disk use of the store
+type Usage struct {
+	Objects int
+	Bytes   int64
+}
+
+// NewStore creates the store of an ophid home
+func NewStore(homeDir string) *Store {
+	return &Store{dir: filepath.Join(homeDir, DirName)}
+}
+
+// Dir returns the store's directory
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Share replaces each file under root that the store has a copy of with a
+// link to it, and adds the others. Files that can't be shared are left as
+// they are; only failing to walk root is an error.
+func (s *Store) Share(root string) (Stats, error) {
+	var stats Stats
+	if mode == ModeOff {
+		return stats, nil
+	}
+	clones := s.canClone()
+	if mode == ModeReflink && !clones {
+		slog.Debug("filesystem can't clone files; not sharing", "dir", s.dir)
+		return stats, nil
+	}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() < minShareSize {
+			return nil
+		}
+		// A hard link takes the stored file's mtime, which would make
+		// Python recompile the modules of every venv but the first
+		if !clones && (strings.HasSuffix(path, ".py") || strings.HasSuffix(path, ".pyc")) {
+			return nil
+		}
+		shared, err := s.share(path, info, clones)
+		if err != nil {
+			slog.Debug("failed to share file", "path", path, "error", err)
+			return nil
+		}
+		if shared {
+			stats.Files++
+			stats.Bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to share %s: %w", root, err)
+	}
+	return stats, nil
+}
+
+// ShareFile shares one file with the store, whatever its size, like a
+// downloaded archive, and reports whether it was linked to a stored copy
+func (s *Store) ShareFile(path string) (bool, error) {
+	if mode == ModeOff {
+		return false, nil
+	}
+	clones := s.canClone()
+	if mode == ModeReflink && !clones {
+		return false, nil
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() {
+		return false, fmt.Errorf("%s isn't a regular file", path)
+	}
+	return s.share(path, info, clones)
+}
+
+// share replaces a file with a link to its stored copy, or stores it when
+// there is none yet, and reports whether it was replaced
+func (s *Store) share(path string, info fs.FileInfo, clones bool) (bool, error) {
+	sum, err := hashFile(path)
+	if err != nil {
+		return false, err
+	}
+	object := s.objectPath(sum, info.Mode().Perm())
+
+	stored, err := os.Lstat(object)
+	if errors.Is(err, fs.ErrNotExist) {
+		// The first copy is the stored one, hard linked in either mode so
+		// that its link count tells Prune whether anything still uses it
+		if err := os.MkdirAll(filepath.Dir(object), 0755); err != nil {
+			return false, err
+		}
+		tmp := tempName(object)
+		if err := os.Link(path, tmp); err != nil {
+			return false, err
+		}
+		if err := os.Rename(tmp, object); err != nil {
+			os.Remove(tmp)
+			return false, err
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(stored, info) {
+		return false, nil
+	}
+
+	tmp := tempName(path)
+	if err := s.link(object, tmp, info, clones); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
+
+// link makes dst a copy of a stored file sharing its data: a reflink
+// keeping the mode and mtime of info, or a hard link
+func (s *Store) link(src, dst string, info fs.FileInfo, clones bool) error {
+	if !clones {
+		return os.Link(src, dst)
+	}
+	if err := cloneFile(src, dst); err != nil {
+		return err
+	}
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// canClone reports whether the store's filesystem clones files, trying it
+// once
+func (s *Store) canClone() bool {
+	s.probe.Do(func() {
+		if err := os.MkdirAll(s.dir, 0755); err != nil {
+			return
+		}
+		src := filepath.Join(s.dir, ".probe")
+		if err := os.WriteFile(src, []byte("ophid"), 0644); err != nil {
+			return
+		}
+		defer os.Remove(src)
+		dst := tempName(src)
+		if err := cloneFile(src, dst); err != nil {
+			slog.Debug("filesystem can't clone files; sharing with hard links", "dir", s.dir, "error", err)
+			return
+		}
+		os.Remove(dst)
+		s.clones = true
+	})
+	return s.clones
+}
+
+// objectPath returns where the store keeps a file: by hash, under a
+// directory of its first two hex digits, and by permissions, which hard
+// links share
+func (s *Store) objectPath(sum string, perm fs.FileMode) string {
+	return filepath.Join(s.dir, "sha256", sum[:2], fmt.Sprintf("%s-%03o", sum, perm))
+}
+
+// Usage returns how many files the store holds and their size
+func (s *Store) Usage() (Usage, error) {
+	var usage Usage
+	err := s.walkObjects(func(path string, info fs.FileInfo) error {
+		usage.Objects++
+		usage.Bytes += info.Size()
+		return nil
+	})
+	return usage, err
+}
+
+// Prune removes the stored files no runtime, venv or download links to
+// any more, returning how many it removed and their size. A file whose
+// first copy is gone is removed even if reflinks of it remain, which keep
+// its data. Where link counts aren't known (Windows) nothing is removed.
+func (s *Store) Prune() (int, int64, error) {
+	removed, freed := 0, int64(0)
+	err := s.walkObjects(func(path string, info fs.FileInfo) error {
+		if n, ok := linkCount(info); !ok || n > 1 {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	return removed, freed, err
+}
+
+// walkObjects calls fn with each stored file. A missing store has none.
+func (s *Store) walkObjects(fn func(path string, info fs.FileInfo) error) error {
+	root := filepath.Join(s.dir, "sha256")
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == root {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(path, info)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read the store: %w", err)
+	}
+	return nil
+}
+
+// hashFile returns the hex sha256 of a file
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// tempName returns a name next to path for a file renamed over it
+func tempName(path string) string {
+	return fmt.Sprintf("%s.ophid-%d", path, os.Getpid())
+}
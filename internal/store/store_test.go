@@ -0,0 +1,102 @@
+//go:build unix
+
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShare(t *testing.T) {
+	home := t.TempDir()
+	s := NewStore(home)
+	heavy := bytes.Repeat([]byte("shared library "), 2<<10)
+	var dirs []string
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(home, "tools", name, "venv")
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "_lib.so"), heavy, 0755)
+		os.WriteFile(filepath.Join(dir, "module.py"), heavy, 0644)
+		os.WriteFile(filepath.Join(dir, "small.txt"), []byte("small"), 0644)
+		os.WriteFile(filepath.Join(dir, "own.dat"), append(heavy, name...), 0644)
+		dirs = append(dirs, dir)
+	}
+
+	stats, err := s.Share(dirs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 0 {
+		t.Errorf("sharing the first copies replaced %d file(s)", stats.Files)
+	}
+	stats, err = s.Share(dirs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// module.py is shared only where the filesystem clones files
+	want := 1
+	if s.canClone() {
+		want = 2
+	}
+	if stats.Files != want || stats.Bytes != int64(want*len(heavy)) {
+		t.Errorf("Share() = %+v, want %d file(s) of %d bytes", stats, want, len(heavy))
+	}
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, "_lib.so"))
+		if err != nil || !bytes.Equal(data, heavy) {
+			t.Fatalf("%s/_lib.so changed: %v", dir, err)
+		}
+		if info, _ := os.Stat(filepath.Join(dir, "_lib.so")); info.Mode().Perm() != 0755 {
+			t.Errorf("%s/_lib.so lost its mode: %v", dir, info.Mode())
+		}
+	}
+	if !s.canClone() {
+		a, _ := os.Stat(filepath.Join(dirs[0], "_lib.so"))
+		b, _ := os.Stat(filepath.Join(dirs[1], "_lib.so"))
+		if !os.SameFile(a, b) {
+			t.Error("the copies aren't hard linked")
+		}
+	}
+
+	// Sharing again changes nothing
+	if stats, err := s.Share(dirs[1]); err != nil || stats.Files != 0 {
+		t.Errorf("Share() again = %+v, %v", stats, err)
+	}
+
+	usage, err := s.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Objects < 3 {
+		t.Errorf("Usage() = %+v, want the heavy files stored", usage)
+	}
+	if removed, _, err := s.Prune(); err != nil || removed != 0 {
+		t.Errorf("Prune() with every file in use removed %d, %v", removed, err)
+	}
+	os.RemoveAll(filepath.Join(home, "tools"))
+	if removed, freed, err := s.Prune(); err != nil || removed != usage.Objects || freed != usage.Bytes {
+		t.Errorf("Prune() = %d, %d, %v; want %d, %d", removed, freed, err, usage.Objects, usage.Bytes)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer Configure("")
+	if err := Configure("copy"); err == nil {
+		t.Error("accepted an unknown mode")
+	}
+	if err := Configure(ModeOff); err != nil {
+		t.Fatal(err)
+	}
+
+	home := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		os.WriteFile(filepath.Join(home, name), bytes.Repeat([]byte("x"), minShareSize), 0644)
+	}
+	s := NewStore(home)
+	s.ShareFile(filepath.Join(home, "a"))
+	if shared, err := s.ShareFile(filepath.Join(home, "b")); err != nil || shared {
+		t.Errorf("shared with dedupe off: %v, %v", shared, err)
+	}
+}
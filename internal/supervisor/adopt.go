@@ -0,0 +1,75 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adoptPollInterval is how often an adopted process is checked for exit
+const adoptPollInterval = time.Second
+
+// errAdoptedExited ends an adopted process. It is not a child of the
+// supervisor, so its exit status is unknown.
+var errAdoptedExited = errors.New("adopted process exited")
+
+// ReadPIDFile reads the PID in a PID file
+func ReadPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read PID file: %w", err)
+	}
+
+	content := strings.TrimSpace(string(data))
+	pid, err := strconv.Atoi(content)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s: %q", path, content)
+	}
+	return pid, nil
+}
+
+// findAdoptable returns the running process of a PID file, or nil when the
+// file is missing or its process is gone
+func findAdoptable(path string) (*os.Process, error) {
+	pid, err := ReadPIDFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !processAlive(pid) {
+		return nil, nil
+	}
+	return os.FindProcess(pid)
+}
+
+// adopt takes over a running process as if the manager had started it.
+// Callers hold proc.mu once the process is shared with other goroutines.
+func (m *Manager) adopt(proc *Process, process *os.Process) {
+	proc.Cmd = &exec.Cmd{Path: proc.Config.Command, Process: process}
+	proc.StartTime = m.clock.Now()
+	proc.Status = StatusRunning
+	emitState(proc)
+	proc.adopted = true
+	proc.ready = !proc.Config.HealthCheck.Enabled
+	proc.done = make(chan struct{})
+}
+
+// waitAdopted waits for an adopted process to exit
+func waitAdopted(pid int) error {
+	ticker := time.NewTicker(adoptPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !processAlive(pid) {
+			break
+		}
+	}
+	return errAdoptedExited
+}
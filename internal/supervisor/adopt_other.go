@@ -0,0 +1,15 @@
+//go:build !unix
+
+package supervisor
+
+import "os"
+
+// processAlive reports whether a process exists
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive reports whether a process exists. EPERM means it does, but
+// belongs to another user.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
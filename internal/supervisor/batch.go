@@ -0,0 +1,146 @@
+package supervisor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchPlaceholder in a batch command's arguments is replaced by the item
+const BatchPlaceholder = "{}"
+
+// BatchResult is the outcome of one item of a batch run
+type BatchResult struct {
+	Item     string        `json:"item"`
+	ExitCode int           `json:"exit_code"`       // -1 if it didn't exit normally
+	Error    string        `json:"error,omitempty"` // Why it didn't exit normally
+	Duration time.Duration `json:"duration"`
+}
+
+// Failed reports whether the item failed
+func (r BatchResult) Failed() bool {
+	return r.ExitCode != 0 || r.Error != ""
+}
+
+// BatchArgs returns the arguments for one item: every "{}" is replaced by
+// the item, or the item is appended when there is none
+func BatchArgs(args []string, item string) []string {
+	result := make([]string, 0, len(args)+1)
+	replaced := false
+	for _, arg := range args {
+		if strings.Contains(arg, BatchPlaceholder) {
+			arg = strings.ReplaceAll(arg, BatchPlaceholder, item)
+			replaced = true
+		}
+		result = append(result, arg)
+	}
+	if !replaced {
+		result = append(result, item)
+	}
+	return result
+}
+
+// ReadBatchItems reads batch items, one per line, skipping blank lines and
+// # comments
+func ReadBatchItems(r io.Reader) ([]string, error) {
+	var items []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, line)
+	}
+	return items, scanner.Err()
+}
+
+// RunBatch runs one command per item, at most parallel at a time, and
+// returns the results in item order. build creates the command of an item;
+// its output is prefixed with "[item] " and written to stdout and stderr
+// line by line. Items not started when ctx is canceled fail as canceled.
+func RunBatch(ctx context.Context, items []string, parallel int, limits Limits, build func(item string) (*exec.Cmd, error), stdout, stderr io.Writer) []BatchResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	// Lines of concurrent items must not interleave
+	var mu sync.Mutex
+	stdout, stderr = &lockedWriter{w: stdout, mu: &mu}, &lockedWriter{w: stderr, mu: &mu}
+
+	results := make([]BatchResult, len(items))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		results[i] = BatchResult{Item: item, ExitCode: -1}
+		if ctx.Err() != nil {
+			results[i].Error = "canceled"
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Error = "canceled"
+			continue
+		}
+
+		wg.Add(1)
+		go func(result *BatchResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			runBatchItem(result, limits, build, stdout, stderr)
+		}(&results[i])
+	}
+
+	wg.Wait()
+	return results
+}
+
+// runBatchItem runs the command of one item
+func runBatchItem(result *BatchResult, limits Limits, build func(string) (*exec.Cmd, error), stdout, stderr io.Writer) {
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	cmd, err := build(result.Item)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	out := &processOutput{name: result.Item, prefix: "[" + result.Item + "] "}
+	out.stdout = &lineWriter{out: out, stream: "stdout", sinks: []io.Writer{stdout}}
+	out.stderr = &lineWriter{out: out, stream: "stderr", sinks: []io.Writer{stderr}}
+	cmd.Stdout, cmd.Stderr = out.stdout, out.stderr
+
+	err = RunWithLimits(cmd, limits)
+	out.Flush()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.Error = err.Error()
+	}
+}
+
+// lockedWriter serializes writes through a shared mutex
+type lockedWriter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
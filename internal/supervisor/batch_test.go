@@ -0,0 +1,67 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestBatchArgs(t *testing.T) {
+	if got := BatchArgs([]string{"site.yml", "--limit", "{}"}, "web1"); fmt.Sprint(got) != "[site.yml --limit web1]" {
+		t.Errorf("BatchArgs() = %v", got)
+	}
+	if got := BatchArgs([]string{"-c", "conf/{}.yml:{}"}, "db"); fmt.Sprint(got) != "[-c conf/db.yml:db]" {
+		t.Errorf("BatchArgs() = %v", got)
+	}
+	if got := BatchArgs([]string{"-d", "relaxed"}, "app.yml"); fmt.Sprint(got) != "[-d relaxed app.yml]" {
+		t.Errorf("BatchArgs() = %v, want the item appended", got)
+	}
+}
+
+func TestReadBatchItems(t *testing.T) {
+	items, err := ReadBatchItems(strings.NewReader("web1\n\n# staging\n  web2  \ndb1\n"))
+	if err != nil || fmt.Sprint(items) != "[web1 web2 db1]" {
+		t.Errorf("ReadBatchItems() = %v, %v", items, err)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	// Each item names the helper mode it runs
+	build := func(item string) (*exec.Cmd, error) {
+		if item == "missing" {
+			return nil, fmt.Errorf("no such target")
+		}
+		cmd := exec.Command(os.Args[0])
+		cmd.Env = append(os.Environ(), helperEnv+"="+item)
+		return cmd, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	results := RunBatch(context.Background(), []string{"print", "crash", "missing"}, 2, Limits{}, build, &stdout, &stderr)
+
+	var got []string
+	for _, r := range results {
+		got = append(got, fmt.Sprintf("%s:%d:%s:%v", r.Item, r.ExitCode, r.Error, r.Failed()))
+	}
+	if want := "[print:0::false crash:3::true missing:-1:no such target:true]"; fmt.Sprint(got) != want {
+		t.Errorf("results = %v, want %s", got, want)
+	}
+
+	if stdout.String() != "[print] hello\n[print] world\n" || stderr.String() != "[print] oops\n" {
+		t.Errorf("output = %q / %q", stdout.String(), stderr.String())
+	}
+
+	// Nothing starts once canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = RunBatch(ctx, []string{"print"}, 1, Limits{}, build, &stdout, &stderr)
+	if results[0].Error != "canceled" || !results[0].Failed() {
+		t.Errorf("canceled result = %+v", results[0])
+	}
+}
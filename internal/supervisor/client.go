@@ -0,0 +1,188 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// Client talks to a daemon over its control socket
+type Client struct {
+	socketPath string
+	http       *http.Client
+}
+
+// NewClient creates a client of the daemon listening on socketPath
+func NewClient(socketPath string) *Client {
+	return &Client{
+		socketPath: socketPath,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Ping checks that the daemon is running
+func (c *Client) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return c.do(ctx, "GET", "/ping", nil, nil)
+}
+
+// List returns the daemon's processes
+func (c *Client) List() ([]ProcessState, error) {
+	var states []ProcessState
+	if err := c.do(context.Background(), "GET", "/processes", nil, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// Start has the daemon start a process
+func (c *Client) Start(config ProcessConfig) (*ProcessState, error) {
+	var state ProcessState
+	if err := c.do(context.Background(), "POST", "/processes", config, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Stop has the daemon stop a process
+func (c *Client) Stop(name string) error {
+	return c.do(context.Background(), "POST", "/processes/"+url.PathEscape(name)+"/stop", nil, nil)
+}
+
+// Restart has the daemon restart a process
+func (c *Client) Restart(name string) (*ProcessState, error) {
+	var state ProcessState
+	if err := c.do(context.Background(), "POST", "/processes/"+url.PathEscape(name)+"/restart", nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Logs copies the last lines of a process's log to w (all of it for 0),
+// then with follow its new output until ctx is done
+func (c *Client) Logs(ctx context.Context, name string, lines int, follow bool, w io.Writer) error {
+	query := url.Values{"lines": {strconv.Itoa(lines)}, "follow": {strconv.FormatBool(follow)}}
+	resp, err := c.request(ctx, "GET", "/processes/"+url.PathEscape(name)+"/logs?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read logs: %w", err)
+	}
+	return nil
+}
+
+// Shutdown has the daemon stop its processes and exit
+func (c *Client) Shutdown() error {
+	return c.do(context.Background(), "POST", "/shutdown", nil, nil)
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out, when given
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	resp, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode daemon response: %w", err)
+	}
+	return nil
+}
+
+// request sends a request to the daemon and turns error responses back
+// into errors with their codes
+func (c *Client) request(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://ophid"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, errcode.Errorf(errcode.NotFound, "the ophid daemon isn't running (start it with: ophid daemon --detach)")
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var e daemonError
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return nil, fmt.Errorf("daemon returned status %d", resp.StatusCode)
+		}
+		return nil, errcode.Errorf(e.Code, "%s", e.Error)
+	}
+	return resp, nil
+}
+
+// StartDaemon starts `executable daemon` in the background, detached from
+// the terminal and logging to daemonLog, and waits until it answers on
+// socketPath
+func StartDaemon(executable, socketPath, daemonLog string) error {
+	if err := os.MkdirAll(filepath.Dir(daemonLog), 0700); err != nil {
+		return fmt.Errorf("failed to create daemon log directory: %w", err)
+	}
+	log, err := os.OpenFile(daemonLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open daemon log: %w", err)
+	}
+	defer log.Close()
+
+	cmd := exec.Command(executable, "daemon")
+	cmd.Stdout, cmd.Stderr = log, log
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start daemon: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	client := NewClient(socketPath)
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("daemon exited on start (%v); see %s", err, daemonLog)
+		case <-deadline:
+			return fmt.Errorf("daemon didn't answer on %s within 10s; see %s", socketPath, daemonLog)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if client.Ping() == nil {
+			cmd.Process.Release()
+			return nil
+		}
+	}
+}
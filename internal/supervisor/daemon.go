@@ -0,0 +1,315 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// Daemon log defaults, for processes started without a log file
+const (
+	daemonLogMaxSizeMB  = 10
+	daemonLogMaxBackups = 3
+)
+
+// logFollowInterval is how often a followed log is checked for new output
+const logFollowInterval = 250 * time.Millisecond
+
+// SocketPath returns the control socket of the daemon of an ophid home
+func SocketPath(homeDir string) string {
+	return filepath.Join(homeDir, "supervisor", "daemon.sock")
+}
+
+// LogDir returns where the daemon of an ophid home writes process output
+func LogDir(homeDir string) string {
+	return filepath.Join(homeDir, "supervisor", "logs")
+}
+
+// Daemon owns supervised processes beyond a single CLI invocation. CLI
+// commands start, list and stop them, and read their logs, through an HTTP
+// API on a Unix socket only the user can reach.
+type Daemon struct {
+	manager    *Manager
+	socketPath string
+	logDir     string
+	ctx        context.Context // Processes live as long as it does
+	shutdown   context.CancelFunc
+}
+
+// NewDaemon creates a daemon serving manager on socketPath, writing the
+// output of processes without a log file to logDir
+func NewDaemon(manager *Manager, socketPath, logDir string) *Daemon {
+	return &Daemon{manager: manager, socketPath: socketPath, logDir: logDir}
+}
+
+// Serve runs the daemon until ctx is done or a client asks it to shut
+// down, then stops every process
+func (d *Daemon) Serve(ctx context.Context) error {
+	listener, err := d.listen()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(d.socketPath)
+
+	d.ctx, d.shutdown = context.WithCancel(ctx)
+	defer d.shutdown()
+	go NewHealthChecker(d.manager).StartMonitoring(d.ctx)
+
+	server := &http.Server{Handler: d.Handler()}
+	serverErr := make(chan error, 1)
+	go func() { serverErr <- server.Serve(listener) }()
+
+	select {
+	case err := <-serverErr:
+		d.manager.StopAll()
+		return fmt.Errorf("control socket failed: %w", err)
+	case <-d.ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	return d.manager.StopAll()
+}
+
+// listen opens the control socket, replacing one left by a daemon that
+// didn't exit cleanly
+func (d *Daemon) listen() (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(d.socketPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	if NewClient(d.socketPath).Ping() == nil {
+		return nil, errcode.Errorf(errcode.Conflict, "an ophid daemon is already running on %s", d.socketPath)
+	}
+	os.Remove(d.socketPath)
+
+	listener, err := net.Listen("unix", d.socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", d.socketPath, err)
+	}
+	if err := os.Chmod(d.socketPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict %s: %w", d.socketPath, err)
+	}
+	return listener, nil
+}
+
+// Handler returns the daemon's control API
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ping", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]int{"pid": os.Getpid()})
+	})
+	mux.HandleFunc("GET /processes", d.handleList)
+	mux.HandleFunc("POST /processes", d.handleStart)
+	mux.HandleFunc("POST /processes/{name}/stop", d.handleStop)
+	mux.HandleFunc("POST /processes/{name}/restart", d.handleRestart)
+	mux.HandleFunc("GET /processes/{name}/logs", d.handleLogs)
+	mux.HandleFunc("POST /shutdown", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		d.shutdown()
+	})
+	return mux
+}
+
+func (d *Daemon) handleList(w http.ResponseWriter, r *http.Request) {
+	states := []ProcessState{}
+	for _, proc := range d.manager.List() {
+		states = append(states, proc.State())
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	writeJSON(w, states)
+}
+
+func (d *Daemon) handleStart(w http.ResponseWriter, r *http.Request) {
+	var config ProcessConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		writeError(w, fmt.Errorf("invalid process config: %w", err))
+		return
+	}
+	if config.Name == "" || strings.ContainsAny(config.Name, `/\`) {
+		writeError(w, fmt.Errorf("invalid process name %q", config.Name))
+		return
+	}
+
+	// Nobody watches the daemon's console: output goes to a file logs reads
+	if config.Log.File == "" {
+		config.Log.File = filepath.Join(d.logDir, config.Name+".log")
+		if config.Log.MaxSizeMB == 0 {
+			config.Log.MaxSizeMB, config.Log.MaxBackups = daemonLogMaxSizeMB, daemonLogMaxBackups
+		}
+	}
+	config.Log.Console = false
+
+	if err := d.manager.Start(d.ctx, config); err != nil {
+		writeError(w, err)
+		return
+	}
+	proc, _ := d.manager.Get(config.Name)
+	writeJSON(w, proc.State())
+}
+
+func (d *Daemon) handleStop(w http.ResponseWriter, r *http.Request) {
+	if err := d.manager.Stop(r.PathValue("name")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *Daemon) handleRestart(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := d.manager.Restart(d.ctx, name); err != nil {
+		writeError(w, err)
+		return
+	}
+	proc, _ := d.manager.Get(name)
+	writeJSON(w, proc.State())
+}
+
+// handleLogs writes the last ?lines= lines of a process's log file (100 by
+// default, 0 for all), then with ?follow=true its new output as it comes
+func (d *Daemon) handleLogs(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	path := filepath.Join(d.logDir, name+".log")
+	if proc, ok := d.manager.Get(name); ok {
+		path = proc.Config.Log.File
+	}
+	if path == "" {
+		writeError(w, errcode.Errorf(errcode.NotFound, "process %s has no log file", name))
+		return
+	}
+
+	lines := 100
+	if s := r.URL.Query().Get("lines"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			writeError(w, fmt.Errorf("invalid line count %q", s))
+			return
+		}
+		lines = n
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		writeError(w, errcode.Errorf(errcode.NotFound, "no logs of %s", name))
+		return
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to open log: %w", err))
+		return
+	}
+	defer func() { f.Close() }()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	offset, err := writeTail(w, f, lines)
+	if err != nil || r.URL.Query().Get("follow") != "true" {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-d.ctx.Done():
+			return
+		case <-time.After(logFollowInterval):
+		}
+
+		// Rotated: carry on from the start of the new file
+		if info, err := os.Stat(path); err == nil && (info.Size() < offset || !sameFile(f, info)) {
+			if next, err := os.Open(path); err == nil {
+				f.Close()
+				f, offset = next, 0
+			}
+		}
+		n, err := io.Copy(w, f)
+		offset += n
+		if err != nil {
+			return
+		}
+	}
+}
+
+// sameFile reports whether f is still the file info describes
+func sameFile(f *os.File, info os.FileInfo) bool {
+	current, err := f.Stat()
+	return err == nil && os.SameFile(current, info)
+}
+
+// writeTail writes the last n lines of f (all of it for 0) and returns the
+// offset it read up to
+func writeTail(w io.Writer, f *os.File, n int) (int64, error) {
+	const maxTail = 1 << 20
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	start := int64(0)
+	if n > 0 && info.Size() > maxTail {
+		start = info.Size() - maxTail
+	}
+	data := make([]byte, info.Size()-start)
+	if _, err := f.ReadAt(data, start); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	if n > 0 {
+		content := strings.TrimSuffix(string(data), "\n")
+		all := strings.Split(content, "\n")
+		if len(all) > n && content != "" {
+			data = []byte(strings.Join(all[len(all)-n:], "\n") + "\n")
+		}
+	}
+	if _, err := w.Write(data); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(info.Size(), io.SeekStart); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// daemonError is the body of a failed control API request
+type daemonError struct {
+	Error string       `json:"error"`
+	Code  errcode.Code `json:"code"`
+}
+
+// writeError writes an error response keeping err's code, so the CLI exits
+// as if it had failed itself
+func writeError(w http.ResponseWriter, err error) {
+	code := errcode.Of(err)
+	status := http.StatusInternalServerError
+	switch code {
+	case errcode.NotFound:
+		status = http.StatusNotFound
+	case errcode.Conflict:
+		status = http.StatusConflict
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(daemonError{Error: err.Error(), Code: code})
+}
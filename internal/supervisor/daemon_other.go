@@ -0,0 +1,11 @@
+//go:build !unix
+
+package supervisor
+
+import "syscall"
+
+// detachedProcAttr returns no attributes: a child process already
+// outlives its parent
+func detachedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,98 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func TestDaemon(t *testing.T) {
+	// Unix socket paths are short; t.TempDir's can be too long
+	dir, err := os.MkdirTemp("", "ophid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "daemon.sock")
+
+	client := NewClient(socket)
+	if _, err := client.List(); errcode.Of(err) != errcode.NotFound {
+		t.Fatalf("List() without a daemon = %v, want not found", err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- NewDaemon(NewManager(), socket, filepath.Join(dir, "logs")).Serve(context.Background())
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Ping() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("daemon didn't start")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := NewDaemon(NewManager(), socket, dir).Serve(context.Background()); errcode.Of(err) != errcode.Conflict {
+		t.Errorf("second daemon = %v, want conflict", err)
+	}
+
+	state, err := client.Start(ProcessConfig{Name: "talk", Command: "sh", Args: []string{"-c", "echo one; echo two; echo three; exec sleep 10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.PID == 0 || state.Config.Log.File != filepath.Join(dir, "logs", "talk.log") {
+		t.Errorf("started %+v", state)
+	}
+	if _, err := client.Start(ProcessConfig{Name: "talk", Command: "sleep", Args: []string{"10"}}); err == nil {
+		t.Error("started a process twice")
+	}
+
+	states, err := client.List()
+	if err != nil || len(states) != 1 || !states[0].Running() {
+		t.Fatalf("List() = %+v, %v", states, err)
+	}
+
+	var out bytes.Buffer
+	for time.Now().Before(deadline) && !strings.Contains(out.String(), "three") {
+		out.Reset()
+		if err := client.Logs(context.Background(), "talk", 2, false, &out); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if out.String() != "two\nthree\n" {
+		t.Errorf("Logs(2) = %q", out.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	out.Reset()
+	if err := client.Logs(ctx, "talk", 0, true, &out); err != nil || out.String() != "one\ntwo\nthree\n" {
+		t.Errorf("Logs(follow) = %q, %v", out.String(), err)
+	}
+
+	if err := client.Stop("talk"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Stop("talk"); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("Stop() of a stopped process = %v, want not found", err)
+	}
+	if states, _ := client.List(); len(states) != 0 {
+		t.Errorf("List() after Stop() = %+v", states)
+	}
+
+	if err := client.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Serve() = %v", err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Error("socket left behind")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package supervisor
+
+import "syscall"
+
+// detachedProcAttr starts the daemon in a session of its own, so it
+// outlives the terminal it was started from
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,86 @@
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gleicon/ophid/internal/support"
+)
+
+// SetDiagnosticsDir makes the manager write a diagnostics bundle to dir
+// when an auto-restart process fails after using up its restarts
+func (m *Manager) SetDiagnosticsDir(dir string) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.diagnosticsDir = dir
+}
+
+// writeDiagnostics bundles what is known about a failed process into
+// <dir>/<name>-<time>.tar.gz and returns the bundle's path: its state and
+// config, environment, last output lines, recent health checks and system
+// information. Secret-looking values are redacted.
+func (m *Manager) writeDiagnostics(proc *Process) (string, error) {
+	m.stateMu.Lock()
+	dir := m.diagnosticsDir
+	m.stateMu.Unlock()
+	if dir == "" {
+		return "", nil
+	}
+
+	state := proc.State()
+	proc.mu.RLock()
+	health := append([]healthResult{}, proc.healthLog...)
+	output := proc.output
+	egressURL := proc.egressURL
+	proc.mu.RUnlock()
+
+	sanitizer := support.NewSanitizer("")
+	bundle := support.NewBundle()
+	for _, file := range []struct {
+		name string
+		data any
+	}{
+		{"process.json", state},
+		{"health.json", health},
+		{"system.json", support.SystemInfo(m.clock.Now())},
+	} {
+		data, err := sanitizer.JSON(file.data)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode %s: %w", file.name, err)
+		}
+		bundle.Add(file.name, data)
+	}
+
+	env := sanitizer.Env(processEnv(proc.Config, egressURL))
+	bundle.Add("env.txt", []byte(strings.Join(env, "\n")+"\n"))
+
+	log := "# Output went straight to the console and was not captured; set a log option to capture it\n"
+	if output != nil {
+		log = strings.Join(output.Tail(), "\n") + "\n"
+	}
+	bundle.Add("output.log", []byte(log))
+
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.tar.gz", state.Name, m.clock.Now().Format("20060102-150405")))
+	if err := bundle.Write(path, m.clock.Now()); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// processEnv returns the environment a process runs with, sorted
+func processEnv(config ProcessConfig, egressURL string) []string {
+	egressProxy := config.EgressProxy
+	if egressURL != "" {
+		egressProxy = egressURL
+	}
+
+	env := append(os.Environ(), EgressEnv(egressProxy, config.EgressCA)...)
+	for k, v := range config.Environment {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
@@ -0,0 +1,90 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/httpclient"
+	"github.com/gleicon/ophid/internal/proxy/egress"
+)
+
+// EgressEnv returns the environment variables that point a tool's outbound
+// traffic at an egress proxy. socks5:// URLs set ALL_PROXY; http:// URLs set
+// HTTP_PROXY/HTTPS_PROXY. caCert, when set, makes common Python and CLI
+// clients trust a TLS-intercepting proxy.
+func EgressEnv(proxyURL, caCert string) []string {
+	var env []string
+
+	if proxyURL != "" {
+		vars := []string{"HTTP_PROXY", "HTTPS_PROXY"}
+		if strings.HasPrefix(proxyURL, "socks5://") || strings.HasPrefix(proxyURL, "socks5h://") {
+			vars = []string{"ALL_PROXY"}
+		}
+
+		for _, name := range vars {
+			// Both spellings: libraries disagree on which one they read
+			env = append(env, name+"="+proxyURL, strings.ToLower(name)+"="+proxyURL)
+		}
+
+		noProxy := "localhost,127.0.0.1,::1"
+		env = append(env, "NO_PROXY="+noProxy, "no_proxy="+noProxy)
+	}
+
+	if caCert != "" {
+		for _, name := range []string{"SSL_CERT_FILE", "REQUESTS_CA_BUNDLE", "PIP_CERT", "CURL_CA_BUNDLE"} {
+			env = append(env, name+"="+caCert)
+		}
+	}
+
+	return env
+}
+
+// startEgress starts the egress proxy of a process with an egress allowlist.
+// It runs on loopback for the life of the process, across restarts, and
+// logs every outbound connection with the process name.
+func startEgress(proc *Process) error {
+	if proc.Config.EgressProxy != "" {
+		return fmt.Errorf("egress_allow runs its own egress proxy and can't be combined with egress_proxy")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to start egress proxy: %w", err)
+	}
+
+	logger := log.New(os.Stdout, fmt.Sprintf("[%s] ", proc.Config.Name), log.LstdFlags)
+	proxy := egress.New(egress.Options{
+		Allow:    proc.Config.EgressAllow,
+		WarnOnly: proc.Config.EgressWarnOnly,
+		Logger:   logger,
+		RootCAs:  httpclient.RootCAs(),
+	})
+	go func() {
+		if err := proxy.Serve(listener); err != nil {
+			logger.Printf("Egress proxy error: %v", err)
+		}
+	}()
+
+	proc.egress = proxy
+	proc.egressURL = "http://" + listener.Addr().String()
+	return nil
+}
+
+// stopEgress shuts down the egress proxy of a process, if it has one
+func stopEgress(proc *Process) {
+	proc.mu.Lock()
+	proxy := proc.egress
+	proc.egress = nil
+	proc.mu.Unlock()
+
+	if proxy != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		proxy.Shutdown(ctx)
+	}
+}
@@ -9,6 +9,19 @@ import (
 	"time"
 )
 
+// readinessInterval is how often processes that haven't passed a health
+// check since they started are probed
+const readinessInterval = time.Second
+
+// healthLogSize is how many health check results are kept for diagnostics
+const healthLogSize = 20
+
+// healthResult is the outcome of one health check
+type healthResult struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
 // HealthChecker performs health checks on processes
 // Adapted from guvnor health checker
 type HealthChecker struct {
@@ -118,6 +131,8 @@ func (h *HealthChecker) checkProcess(proc *Process) error {
 func (h *HealthChecker) StartMonitoring(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
+	readiness := time.NewTicker(readinessInterval)
+	defer readiness.Stop()
 
 	for {
 		select {
@@ -125,6 +140,25 @@ func (h *HealthChecker) StartMonitoring(ctx context.Context) {
 			return
 		case <-ticker.C:
 			h.checkAll(ctx)
+		case <-readiness.C:
+			h.checkReadiness()
+		}
+	}
+}
+
+// checkReadiness probes running processes that aren't ready yet, so they
+// are marked ready as soon as they pass. Failures don't count towards a
+// restart: the process may still be starting.
+func (h *HealthChecker) checkReadiness() {
+	for _, proc := range h.manager.List() {
+		if !proc.Config.HealthCheck.Enabled || !proc.IsRunning() || proc.IsReady() {
+			continue
+		}
+		if h.CheckProcess(proc) != nil {
+			continue
+		}
+		if _, changed := proc.recordHealth(nil); changed {
+			h.manager.stateChanged(proc)
 		}
 	}
 }
@@ -138,21 +172,67 @@ func (h *HealthChecker) checkAll(ctx context.Context) {
 			continue
 		}
 
-		if err := h.CheckProcess(proc); err != nil {
-			slog.Warn("health check failed",
-				"process", name,
-				"error", err)
-
-			// Restart if auto-restart is enabled
-			if proc.Config.AutoRestart {
-				slog.Info("restarting process due to failed health check",
-					"process", name)
-				if err := h.manager.Restart(ctx, name); err != nil {
-					slog.Error("failed to restart process",
-						"process", name,
-						"error", err)
-				}
+		err := h.CheckProcess(proc)
+		failures, changed := proc.recordHealth(err)
+		if changed {
+			h.manager.stateChanged(proc)
+		} else if err != nil {
+			h.manager.persistState() // For the failure count
+		}
+		if err == nil {
+			continue
+		}
+
+		slog.Warn("health check failed",
+			"process", name,
+			"failures", failures,
+			"error", err)
+
+		// Restart after enough consecutive failures if auto-restart is enabled
+		if proc.Config.AutoRestart && failures >= healthThreshold(proc.Config.HealthCheck) {
+			slog.Info("restarting process due to failed health check",
+				"process", name)
+			if err := h.manager.Restart(ctx, name); err != nil {
+				slog.Error("failed to restart process",
+					"process", name,
+					"error", err)
 			}
 		}
 	}
 }
+
+// healthThreshold returns the consecutive failures that restart a process
+func healthThreshold(cfg HealthCheckConfig) int {
+	if cfg.Retries > 0 {
+		return cfg.Retries
+	}
+	return 1
+}
+
+// recordHealth records a health check result and returns the number of
+// consecutive failures and whether the process's readiness changed
+func (p *Process) recordHealth(err error) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil {
+		p.healthFailures = 0
+	} else {
+		p.healthFailures++
+		p.healthFailed++
+	}
+
+	result := healthResult{Time: time.Now()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	p.healthLog = append(p.healthLog, result)
+	if len(p.healthLog) > healthLogSize {
+		p.healthLog = p.healthLog[len(p.healthLog)-healthLogSize:]
+	}
+
+	ready := err == nil && p.Status == StatusRunning
+	changed := ready != p.ready
+	p.ready = ready
+	return p.healthFailures, changed
+}
@@ -0,0 +1,241 @@
+package supervisor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Job defaults
+const (
+	defaultJobRetryDelay    = 10 * time.Second
+	defaultJobMaxRetryDelay = 10 * time.Minute
+)
+
+// Job statuses
+const (
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobConfig describes a one-shot job: it runs until it exits, and failed
+// runs are retried with backoff
+type JobConfig struct {
+	Name        string            `json:"name"`
+	Command     string            `json:"command"`
+	Args        []string          `json:"args,omitempty"`
+	WorkingDir  string            `json:"working_dir,omitempty"`
+	Environment map[string]string `json:"environment,omitempty"`
+
+	Retries       int           `json:"retries,omitempty"`         // Retries after a failed run
+	RetryDelay    time.Duration `json:"retry_delay,omitempty"`     // First retry delay, doubled per retry (default 10s)
+	MaxRetryDelay time.Duration `json:"max_retry_delay,omitempty"` // Retry delay cap (default 10m)
+	Timeout       time.Duration `json:"timeout,omitempty"`         // Per-run deadline, 0 for none
+
+	SuccessCodes []int `json:"success_codes,omitempty"` // Exit codes that count as success (default 0)
+	RetryCodes   []int `json:"retry_codes,omitempty"`   // Exit codes worth retrying (default any failure)
+
+	Log LogConfig `json:"log,omitempty"`
+}
+
+// succeeded reports whether an exit code counts as success
+func (c JobConfig) succeeded(code int) bool {
+	if len(c.SuccessCodes) == 0 {
+		return code == 0
+	}
+	return slices.Contains(c.SuccessCodes, code)
+}
+
+// retryable reports whether a failed run with this exit code is retried.
+// Runs that didn't exit normally (-1: not started, killed, timed out) are.
+func (c JobConfig) retryable(code int) bool {
+	return len(c.RetryCodes) == 0 || code == -1 || slices.Contains(c.RetryCodes, code)
+}
+
+// JobResult is the outcome of a job run, including its retries
+type JobResult struct {
+	Name      string        `json:"name"`
+	Status    string        `json:"status"` // "succeeded" or "failed"
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"` // All attempts and retry delays
+	Attempts  int           `json:"attempts"`
+	ExitCode  int           `json:"exit_code"`       // Of the last attempt, -1 if it didn't exit normally
+	Error     string        `json:"error,omitempty"` // Why the last attempt didn't exit normally
+	LogPath   string        `json:"log_path,omitempty"`
+}
+
+// JobStore keeps job results and logs under a directory
+type JobStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewJobStore creates a job store under homeDir
+func NewJobStore(homeDir string) *JobStore {
+	return &JobStore{dir: filepath.Join(homeDir, "jobs")}
+}
+
+// LogPath returns the default log file of a job
+func (s *JobStore) LogPath(name string) string {
+	return filepath.Join(s.dir, "logs", name+".log")
+}
+
+// Record appends a job result
+func (s *JobStore) Record(result JobResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create jobs directory: %w", err)
+	}
+
+	line, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job result: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir, "results.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open job results: %w", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write job result: %w", err)
+	}
+	return nil
+}
+
+// List returns job results, newest first. With latest set, only the most
+// recent result of each job is returned.
+func (s *JobStore) List(latest bool) ([]JobResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(s.dir, "results.jsonl"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job results: %w", err)
+	}
+
+	var results []JobResult
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var result JobResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue // Cut short by a crash
+		}
+		results = append(results, result)
+	}
+	slices.Reverse(results)
+
+	if latest {
+		seen := make(map[string]bool)
+		results = slices.DeleteFunc(results, func(r JobResult) bool {
+			dup := seen[r.Name]
+			seen[r.Name] = true
+			return dup
+		})
+	}
+	return results, scanner.Err()
+}
+
+// RunJob runs a job to completion, retrying failed runs, and returns its
+// result. The output of every attempt goes to the job's log sinks.
+func RunJob(ctx context.Context, config JobConfig) (result JobResult) {
+	result = JobResult{Name: config.Name, StartedAt: time.Now(), LogPath: config.Log.File}
+	defer func() { result.Duration = time.Since(result.StartedAt) }()
+
+	output, err := newProcessOutput(config.Name, config.Log)
+	if err != nil {
+		result.Status, result.ExitCode, result.Error = JobFailed, -1, err.Error()
+		return result
+	}
+	defer output.Close()
+
+	delay, maxDelay := config.RetryDelay, config.MaxRetryDelay
+	if delay <= 0 {
+		delay = defaultJobRetryDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultJobMaxRetryDelay
+	}
+
+	for {
+		result.Attempts++
+		result.ExitCode, result.Error = runJobOnce(config, output)
+		output.Flush()
+
+		if result.Error == "" && config.succeeded(result.ExitCode) {
+			result.Status = JobSucceeded
+			return result
+		}
+		result.Status = JobFailed
+		if result.Attempts > config.Retries || !config.retryable(result.ExitCode) {
+			return result
+		}
+
+		delay = min(delay, maxDelay)
+		fmt.Printf("Job %s failed (%s), retrying in %s (attempt %d/%d)...\n",
+			config.Name, jobExitDescription(result), delay, result.Attempts+1, config.Retries+1)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			result.Error = "canceled"
+			return result
+		}
+		delay *= 2
+	}
+}
+
+// runJobOnce runs one attempt, returning the exit code and, when the job
+// didn't exit normally, why
+func runJobOnce(config JobConfig, output *processOutput) (int, string) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Dir = config.WorkingDir
+	cmd.Stdout = output.stdout
+	cmd.Stderr = output.stderr
+	if len(config.Environment) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range config.Environment {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+
+	err := RunWithLimits(cmd, Limits{Timeout: config.Timeout})
+	if err == nil {
+		return 0, ""
+	}
+
+	var limitErr *LimitError
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &limitErr):
+		return -1, err.Error()
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		return exitErr.ExitCode(), ""
+	}
+	return -1, err.Error()
+}
+
+// jobExitDescription describes how the last attempt of a job ended
+func jobExitDescription(result JobResult) string {
+	if result.Error != "" {
+		return result.Error
+	}
+	return fmt.Sprintf("exit status %d", result.ExitCode)
+}
@@ -0,0 +1,103 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// helperJob returns a job running a helper process (see TestMain)
+func helperJob(name, mode string) JobConfig {
+	return JobConfig{
+		Name:        name,
+		Command:     os.Args[0],
+		Environment: map[string]string{helperEnv: mode},
+		RetryDelay:  time.Millisecond,
+	}
+}
+
+func TestRunJob_ExitCodePolicies(t *testing.T) {
+	tests := []struct {
+		name         string
+		successCodes []int
+		retryCodes   []int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"retried until out of retries", nil, nil, JobFailed, 3},
+		{"exit code counted as success", []int{0, 3}, nil, JobSucceeded, 1},
+		{"exit code not worth retrying", nil, []int{75}, JobFailed, 1},
+		{"exit code worth retrying", nil, []int{3, 75}, JobFailed, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := helperJob("crasher", "crash")
+			config.Retries = 2
+			config.SuccessCodes = tt.successCodes
+			config.RetryCodes = tt.retryCodes
+
+			result := RunJob(context.Background(), config)
+			if result.Status != tt.wantStatus || result.Attempts != tt.wantAttempts || result.ExitCode != 3 || result.Error != "" {
+				t.Errorf("RunJob() = %+v, want %s after %d attempts", result, tt.wantStatus, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRunJob_TimeoutAndLog(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "printer.log")
+	config := helperJob("printer", "print")
+	config.Log = LogConfig{File: logFile, Streams: true}
+
+	result := RunJob(context.Background(), config)
+	if result.Status != JobSucceeded || result.LogPath != logFile || result.Duration <= 0 {
+		t.Errorf("RunJob() = %+v", result)
+	}
+	data, _ := os.ReadFile(logFile)
+	for _, line := range []string{"stdout hello\n", "stdout world\n", "stderr oops\n"} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("log %q lacks %q", data, line)
+		}
+	}
+
+	config = helperJob("server", "serve")
+	config.Timeout = 100 * time.Millisecond
+	config.Retries = 1
+	result = RunJob(context.Background(), config)
+	if result.Status != JobFailed || result.Attempts != 2 || result.ExitCode != -1 || !strings.HasPrefix(result.Error, "exceeded timeout") {
+		t.Errorf("RunJob() = %+v, want a timed out failure", result)
+	}
+}
+
+func TestJobStore(t *testing.T) {
+	store := NewJobStore(t.TempDir())
+
+	if results, err := store.List(true); err != nil || len(results) != 0 {
+		t.Fatalf("List() on an empty store = %v, %v", results, err)
+	}
+
+	for _, r := range []JobResult{
+		{Name: "backup", Status: JobFailed, ExitCode: 1},
+		{Name: "playbook", Status: JobSucceeded},
+		{Name: "backup", Status: JobSucceeded},
+	} {
+		if err := store.Record(r); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	all, _ := store.List(false)
+	latest, _ := store.List(true)
+	if len(all) != 3 || len(latest) != 2 {
+		t.Fatalf("List() = %d results, %d latest; want 3 and 2", len(all), len(latest))
+	}
+	if latest[0].Name != "backup" || latest[0].Status != JobSucceeded || latest[1].Name != "playbook" {
+		t.Errorf("latest = %+v", latest)
+	}
+}
@@ -0,0 +1,108 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// limitKillGrace is how long a process that ran out of time gets to exit
+// after SIGTERM before it is killed
+const limitKillGrace = 5 * time.Second
+
+// Limits bounds the time and resources of a foreground run
+type Limits struct {
+	Timeout   time.Duration // Wall-clock deadline, 0 for none
+	MaxMemory uint64        // Address space limit in bytes (RLIMIT_AS), 0 for none
+	Nice      int           // Scheduling priority adjustment, 0 to leave it alone
+}
+
+// LimitError reports a run stopped by one of its limits
+type LimitError struct {
+	Limit string // "timeout"
+	Value string
+	Err   error // How the process exited
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("exceeded %s of %s (%v)", e.Limit, e.Value, e.Err)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// RunWithLimits starts cmd, applies limits to it and waits for it to exit.
+// A process past its timeout gets SIGTERM, then SIGKILL after
+// limitKillGrace, and the run returns a *LimitError.
+func RunWithLimits(cmd *exec.Cmd, limits Limits) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// rlimits and priority can only be set once the process exists, so
+	// they apply from right after exec
+	if err := applyLimits(cmd.Process.Pid, limits); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	if limits.Timeout <= 0 {
+		return <-done
+	}
+
+	timer := time.NewTimer(limits.Timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	}
+
+	// Signals other than kill are not supported everywhere
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		cmd.Process.Kill()
+	}
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(limitKillGrace):
+		cmd.Process.Kill()
+		err = <-done
+	}
+	if err == nil {
+		err = errors.New("exit status 0")
+	}
+	return &LimitError{Limit: "timeout", Value: limits.Timeout.String(), Err: err}
+}
+
+// ParseMemory parses a memory size: bytes, or a number with a K, M, G or T
+// suffix (binary units, e.g. "512M", "2G")
+func ParseMemory(size string) (uint64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := uint64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i >= 0 {
+			multiplier = 1 << (10 * (i + 1))
+			s = s[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid memory size %q (e.g. 512M, 2G)", size)
+	}
+	return uint64(value * float64(multiplier)), nil
+}
@@ -0,0 +1,26 @@
+package supervisor
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// applyLimits sets the memory rlimit and priority of a running process
+func applyLimits(pid int, limits Limits) error {
+	if limits.MaxMemory > 0 {
+		rlimit := unix.Rlimit{Cur: limits.MaxMemory, Max: limits.MaxMemory}
+		if err := unix.Prlimit(pid, unix.RLIMIT_AS, &rlimit, nil); err != nil {
+			return fmt.Errorf("failed to set memory limit: %w", err)
+		}
+	}
+
+	if limits.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, limits.Nice); err != nil {
+			return fmt.Errorf("failed to set priority: %w", err)
+		}
+	}
+
+	return nil
+}
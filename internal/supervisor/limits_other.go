@@ -0,0 +1,13 @@
+//go:build !unix
+
+package supervisor
+
+import "fmt"
+
+// applyLimits only supports timeouts on this platform
+func applyLimits(pid int, limits Limits) error {
+	if limits.MaxMemory > 0 || limits.Nice != 0 {
+		return fmt.Errorf("memory and priority limits are not supported on this platform")
+	}
+	return nil
+}
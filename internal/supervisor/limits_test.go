@@ -0,0 +1,34 @@
+package supervisor
+
+import "testing"
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    uint64
+		wantErr bool
+	}{
+		{"1048576", 1 << 20, false},
+		{"512K", 512 << 10, false},
+		{"512M", 512 << 20, false},
+		{"2G", 2 << 30, false},
+		{"1.5g", 3 << 29, false},
+		{"2GiB", 2 << 30, false},
+		{"1T", 1 << 40, false},
+		{"", 0, true},
+		{"0", 0, true},
+		{"-1G", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMemory(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMemory(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMemory(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build unix && !linux
+
+package supervisor
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// applyLimits sets the priority of a running process. Other processes'
+// rlimits can't be changed here, so memory limits are not supported.
+func applyLimits(pid int, limits Limits) error {
+	if limits.MaxMemory > 0 {
+		return fmt.Errorf("memory limits are only supported on Linux")
+	}
+
+	if limits.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, limits.Nice); err != nil {
+			return fmt.Errorf("failed to set priority: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -2,52 +2,186 @@ package supervisor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"sync"
+	"syscall"
 	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/secrets"
+)
+
+// Restart and stop defaults
+const (
+	defaultRestartDelay    = 2 * time.Second
+	defaultMaxRestartDelay = time.Minute
+	defaultStopTimeout     = 10 * time.Second
+
+	// stableRunTime is how long a process must run before a crash restarts
+	// it with the initial delay again
+	stableRunTime = time.Minute
 )
 
 // Manager manages multiple processes
 type Manager struct {
 	processes map[string]*Process
 	mu        sync.RWMutex
+	clock     clock
+	stateFile string
+	stateMu   sync.Mutex
+
+	diagnosticsDir string             // Where bundles of processes out of restarts go
+	secrets        secrets.Lookup     // Resolves {{secret:name}} in environments
+	onChange       func(ProcessState) // Test hook, called after every state change
+}
+
+// clock provides time to the manager, so tests can drive restarts and
+// stop timeouts without sleeping
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
 }
 
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
 // NewManager creates a new process manager
 func NewManager() *Manager {
 	return &Manager{
 		processes: make(map[string]*Process),
+		clock:     realClock{},
 	}
 }
 
+// SetSecrets sets where {{secret:name}} references in process environments
+// are resolved. They are resolved on every start and never written out.
+func (m *Manager) SetSecrets(lookup secrets.Lookup) {
+	m.secrets = lookup
+}
+
+// SetStateFile makes the manager persist process state to path (JSON) on
+// every change
+func (m *Manager) SetStateFile(path string) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.stateFile = path
+}
+
+// LoadState reads process state persisted by a manager
+func LoadState(path string) ([]ProcessState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var states []ProcessState
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	return states, nil
+}
+
+// Running reports whether a persisted process is running: its state says
+// so and its PID still exists, which it doesn't once the supervisor that
+// wrote the state is gone
+func (s ProcessState) Running() bool {
+	if s.Status != StatusRunning && s.Status != StatusBackoff {
+		return false
+	}
+	return s.PID == 0 || processAlive(s.PID)
+}
+
 // Start starts a process
 func (m *Manager) Start(ctx context.Context, config ProcessConfig) error {
+	return m.start(ctx, config, nil)
+}
+
+// start starts a process, handing it sockets kept from a previous instance
+// instead of opening new ones
+func (m *Manager) start(ctx context.Context, config ProcessConfig, sockets []*os.File) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
 
 	// Check if already running
 	if proc, exists := m.processes[config.Name]; exists {
-		if proc.IsRunning() {
-			return fmt.Errorf("process %s is already running", config.Name)
+		if status := proc.GetStatus(); status == StatusRunning || status == StatusBackoff {
+			m.mu.Unlock()
+			return errcode.Errorf(errcode.Conflict, "process %s is already running", config.Name)
+		}
+	}
+
+	// Adopt the process of a PID file if it is running, instead of starting one
+	var adoptee *os.Process
+	if config.PIDFile != "" {
+		if len(config.Sockets) > 0 {
+			m.mu.Unlock()
+			return fmt.Errorf("process %s: pid_file can't be combined with sockets", config.Name)
+		}
+		var err error
+		if adoptee, err = findAdoptable(config.PIDFile); err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		if adoptee == nil && config.Command == "" {
+			m.mu.Unlock()
+			return fmt.Errorf("process %s: no running process in %s and no command to start", config.Name, config.PIDFile)
 		}
 	}
 
 	// Create process
 	proc := &Process{
-		Config:    config,
-		StartTime: time.Now(),
-		Status:    StatusStarting,
+		Config:       config,
+		StartTime:    m.clock.Now(),
+		Status:       StatusStarting,
+		stop:         make(chan struct{}),
+		restartDelay: restartDelay(config),
+		sockets:      sockets,
+	}
+
+	if !config.Log.passthrough() {
+		output, err := newProcessOutput(config.Name, config.Log)
+		if err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		proc.output = output
+	}
+
+	if len(config.EgressAllow) > 0 {
+		if err := startEgress(proc); err != nil {
+			m.mu.Unlock()
+			release(proc)
+			return err
+		}
+	}
+
+	if len(config.Sockets) > 0 && sockets == nil {
+		if err := openSockets(proc); err != nil {
+			m.mu.Unlock()
+			release(proc)
+			return err
+		}
 	}
 
 	// Start process
-	if err := m.startProcess(proc); err != nil {
+	if adoptee != nil {
+		m.adopt(proc, adoptee)
+	} else if err := m.startProcess(proc); err != nil {
+		m.mu.Unlock()
 		proc.SetStatus(StatusFailed)
+		release(proc)
 		return fmt.Errorf("failed to start process: %w", err)
 	}
 
 	m.processes[config.Name] = proc
+	m.mu.Unlock()
+	m.stateChanged(proc)
 
 	// Monitor process
 	go m.monitorProcess(ctx, proc)
@@ -55,48 +189,87 @@ func (m *Manager) Start(ctx context.Context, config ProcessConfig) error {
 	return nil
 }
 
-// Stop stops a process
+// Stop stops a process: SIGTERM, then SIGKILL if it is still running after
+// its stop timeout
 func (m *Manager) Stop(name string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	proc, exists := m.processes[name]
 	if !exists {
-		return fmt.Errorf("process %s not found", name)
+		m.mu.Unlock()
+		return errcode.Errorf(errcode.NotFound, "process %s not found", name)
 	}
 
-	if !proc.IsRunning() {
+	if status := proc.GetStatus(); status != StatusRunning && status != StatusBackoff {
+		m.mu.Unlock()
 		return fmt.Errorf("process %s is not running", name)
 	}
 
-	// Kill process
-	if proc.Cmd != nil && proc.Cmd.Process != nil {
-		if err := proc.Cmd.Process.Kill(); err != nil {
-			return fmt.Errorf("failed to kill process: %w", err)
+	delete(m.processes, name)
+	m.mu.Unlock()
+
+	// Don't hold the manager lock during the grace period
+	err := m.terminate(proc)
+	m.persistState()
+	return err
+}
+
+// terminate stops a process and waits for it to exit
+func (m *Manager) terminate(proc *Process) error {
+	proc.mu.Lock()
+	proc.stopping = true
+	close(proc.stop)
+	cmd, done := proc.Cmd, proc.done
+	timeout := proc.Config.StopTimeout
+	proc.mu.Unlock()
+
+	if timeout <= 0 {
+		timeout = defaultStopTimeout
+	}
+
+	if cmd != nil && cmd.Process != nil {
+		select {
+		case <-done:
+			// Already exited (waiting to restart)
+		default:
+			// Signals other than kill are not supported everywhere
+			if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+				cmd.Process.Kill()
+			}
+
+			select {
+			case <-done:
+			case <-m.clock.After(timeout):
+				fmt.Printf("Process %s did not exit within %s, killing\n", proc.Config.Name, timeout)
+				if err := cmd.Process.Kill(); err != nil {
+					return fmt.Errorf("failed to kill process: %w", err)
+				}
+				<-done
+			}
 		}
 	}
 
 	proc.SetStatus(StatusStopped)
-	delete(m.processes, name)
-
+	release(proc)
 	return nil
 }
 
 // Restart restarts a process
 func (m *Manager) Restart(ctx context.Context, name string) error {
-	if err := m.Stop(name); err != nil {
-		return err
+	proc, exists := m.Get(name)
+	if !exists {
+		return errcode.Errorf(errcode.NotFound, "process %s not found", name)
 	}
 
-	m.mu.RLock()
-	proc, exists := m.processes[name]
-	m.mu.RUnlock()
-
-	if !exists {
-		return fmt.Errorf("process %s not found after stop", name)
+	// Listening sockets carry over, so connections queue while it restarts
+	sockets := proc.takeSockets()
+	if err := m.Stop(name); err != nil {
+		for _, file := range sockets {
+			file.Close()
+		}
+		return err
 	}
 
-	return m.Start(ctx, proc.Config)
+	return m.start(ctx, proc.Config, sockets)
 }
 
 // List returns all processes
@@ -138,9 +311,14 @@ func (m *Manager) StopAll() error {
 	return nil
 }
 
-// startProcess starts the actual process
+// startProcess starts the actual process. Callers hold proc.mu once the
+// process is shared with other goroutines.
 func (m *Manager) startProcess(proc *Process) error {
-	cmd := exec.Command(proc.Config.Command, proc.Config.Args...)
+	command, args := proc.Config.Command, proc.Config.Args
+	if len(proc.sockets) > 0 {
+		command, args = socketCommand(command, args)
+	}
+	cmd := exec.Command(command, args...)
 
 	// Set working directory
 	if proc.Config.WorkingDir != "" {
@@ -148,17 +326,36 @@ func (m *Manager) startProcess(proc *Process) error {
 	}
 
 	// Set environment
-	if len(proc.Config.Environment) > 0 {
+	egressProxy := proc.Config.EgressProxy
+	if proc.egressURL != "" {
+		egressProxy = proc.egressURL
+	}
+	if len(proc.Config.Environment) > 0 || egressProxy != "" || proc.Config.EgressCA != "" || len(proc.sockets) > 0 {
 		env := os.Environ()
+		env = append(env, EgressEnv(egressProxy, proc.Config.EgressCA)...)
 		for k, v := range proc.Config.Environment {
-			env = append(env, fmt.Sprintf("%s=%s", k, v))
+			value, err := secrets.Expand(v, m.secrets)
+			if err != nil {
+				return fmt.Errorf("environment %s: %w", k, err)
+			}
+			env = append(env, fmt.Sprintf("%s=%s", k, value))
+		}
+		if len(proc.sockets) > 0 {
+			env = append(env, socketEnv(len(proc.sockets))...)
 		}
 		cmd.Env = env
 	}
 
-	// Inherit stdout/stderr
+	// Listening sockets, from descriptor 3
+	cmd.ExtraFiles = proc.sockets
+
+	// Inherit stdout/stderr, or hand them to the configured log sinks
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	if proc.output != nil {
+		cmd.Stdout = proc.output.stdout
+		cmd.Stderr = proc.output.stderr
+	}
 
 	// Start process
 	if err := cmd.Start(); err != nil {
@@ -166,7 +363,12 @@ func (m *Manager) startProcess(proc *Process) error {
 	}
 
 	proc.Cmd = cmd
-	proc.SetStatus(StatusRunning)
+	proc.StartTime = m.clock.Now()
+	proc.Status = StatusRunning
+	emitState(proc)
+	proc.adopted = false
+	proc.ready = !proc.Config.HealthCheck.Enabled
+	proc.done = make(chan struct{})
 
 	return nil
 }
@@ -174,35 +376,205 @@ func (m *Manager) startProcess(proc *Process) error {
 // monitorProcess monitors a process and handles auto-restart
 func (m *Manager) monitorProcess(ctx context.Context, proc *Process) {
 	// Wait for process to exit
-	err := proc.Cmd.Wait()
+	var err error
+	if proc.adopted {
+		err = waitAdopted(proc.Cmd.Process.Pid)
+	} else {
+		err = proc.Cmd.Wait()
+	}
 
-	// Process exited
-	proc.SetStatus(StatusStopped)
+	proc.mu.Lock()
+	if proc.output != nil {
+		proc.output.Flush()
+	}
+	ran := m.clock.Now().Sub(proc.StartTime)
+	proc.LastExit = exitDescription(err)
+	proc.ready = false
+	stopping := proc.stopping
+	if stopping {
+		proc.Status = StatusStopped
+		emitState(proc)
+	}
+	close(proc.done)
+	proc.mu.Unlock()
+
+	// Stopped on purpose: Stop persists the state
+	if stopping {
+		return
+	}
 
 	// Check if should auto-restart
-	if proc.Config.AutoRestart && proc.RestartCount < proc.Config.MaxRetries {
+	proc.mu.Lock()
+	if proc.stopping {
+		proc.mu.Unlock()
+		return
+	}
+	// An adopted process without a command can't be started again
+	restart := proc.Config.AutoRestart && proc.RestartCount < proc.Config.MaxRetries && proc.Config.Command != ""
+	var delay time.Duration
+	if restart {
 		proc.RestartCount++
-		fmt.Printf("Process %s exited (error: %v), restarting (attempt %d/%d)...\n",
-			proc.Config.Name, err, proc.RestartCount, proc.Config.MaxRetries)
-
-		// Wait a bit before restarting
-		time.Sleep(2 * time.Second)
-
-		// Restart
-		if err := m.startProcess(proc); err != nil {
-			fmt.Printf("Failed to restart %s: %v\n", proc.Config.Name, err)
-			proc.SetStatus(StatusFailed)
-			return
+		delay = nextRestartDelay(proc, ran)
+		proc.Status = StatusBackoff
+	} else if err != nil {
+		proc.Status = StatusFailed
+	} else {
+		proc.Status = StatusStopped
+	}
+	emitState(proc)
+	proc.mu.Unlock()
+
+	// Out of restarts: keep what is needed to find out why
+	var diagnostics string
+	if !restart && err != nil && proc.Config.AutoRestart {
+		path, diagErr := m.writeDiagnostics(proc)
+		if diagErr != nil {
+			fmt.Printf("Failed to save diagnostics of %s: %v\n", proc.Config.Name, diagErr)
 		}
+		diagnostics = path
+		proc.mu.Lock()
+		proc.diagnostics = path
+		proc.mu.Unlock()
+	}
+	m.stateChanged(proc)
 
-		// Continue monitoring
-		go m.monitorProcess(ctx, proc)
-	} else {
-		if err != nil {
-			proc.SetStatus(StatusFailed)
+	if !restart {
+		release(proc)
+		if err != nil && diagnostics != "" {
+			fmt.Printf("Process %s failed: %v (diagnostics: %s)\n", proc.Config.Name, err, diagnostics)
+		} else if err != nil {
 			fmt.Printf("Process %s failed: %v\n", proc.Config.Name, err)
 		} else {
 			fmt.Printf("Process %s stopped\n", proc.Config.Name)
 		}
+		return
+	}
+
+	fmt.Printf("Process %s exited (error: %v), restarting in %s (attempt %d/%d)...\n",
+		proc.Config.Name, err, delay, proc.RestartCount, proc.Config.MaxRetries)
+
+	// Wait before restarting, unless stopped meanwhile
+	select {
+	case <-m.clock.After(delay):
+	case <-proc.stop:
+		return
+	case <-ctx.Done():
+		proc.SetStatus(StatusStopped)
+		release(proc)
+		m.stateChanged(proc)
+		return
+	}
+
+	// Restart
+	proc.mu.Lock()
+	if proc.stopping {
+		proc.mu.Unlock()
+		return
+	}
+	err = m.startProcess(proc)
+	proc.mu.Unlock()
+	if err != nil {
+		fmt.Printf("Failed to restart %s: %v\n", proc.Config.Name, err)
+		proc.SetStatus(StatusFailed)
+		release(proc)
+		m.stateChanged(proc)
+		return
+	}
+	m.stateChanged(proc)
+
+	// Continue monitoring
+	go m.monitorProcess(ctx, proc)
+}
+
+// release stops the egress proxy and closes the listening sockets and log
+// sinks of a process that won't run again
+func release(proc *Process) {
+	stopEgress(proc)
+	closeSockets(proc)
+
+	proc.mu.Lock()
+	output := proc.output
+	proc.output = nil
+	proc.mu.Unlock()
+
+	if output != nil {
+		output.Close()
+	}
+}
+
+// restartDelay returns the initial restart delay of a process
+func restartDelay(config ProcessConfig) time.Duration {
+	if config.RestartDelay > 0 {
+		return config.RestartDelay
+	}
+	return defaultRestartDelay
+}
+
+// nextRestartDelay returns the delay before restarting a process that ran
+// for ran, and doubles the following one up to the configured cap. A
+// process that ran for stableRunTime starts over from the initial delay.
+func nextRestartDelay(proc *Process, ran time.Duration) time.Duration {
+	maxDelay := proc.Config.MaxRestartDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxRestartDelay
+	}
+
+	if ran >= stableRunTime || proc.restartDelay <= 0 {
+		proc.restartDelay = restartDelay(proc.Config)
+	}
+
+	delay := min(proc.restartDelay, maxDelay)
+	proc.restartDelay = min(delay*2, maxDelay)
+	return delay
+}
+
+// exitDescription describes how a process exited
+func exitDescription(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
+
+// stateChanged persists the process table after a process changed state
+func (m *Manager) stateChanged(proc *Process) {
+	m.persistState()
+	if m.onChange != nil {
+		m.onChange(proc.State())
+	}
+}
+
+// persistState writes the state of every known process to the state file
+func (m *Manager) persistState() {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	if m.stateFile == "" {
+		return
+	}
+
+	states := []ProcessState{}
+	for _, proc := range m.List() {
+		states = append(states, proc.State())
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return
+	}
+
+	// Write and rename, so readers never see a partial file
+	if err := os.MkdirAll(filepath.Dir(m.stateFile), 0755); err != nil {
+		fmt.Printf("Failed to save supervisor state: %v\n", err)
+		return
+	}
+	tmp := m.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		fmt.Printf("Failed to save supervisor state: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, m.stateFile); err != nil {
+		fmt.Printf("Failed to save supervisor state: %v\n", err)
 	}
 }
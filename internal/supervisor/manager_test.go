@@ -95,7 +95,7 @@ func TestManager_AutoRestart(t *testing.T) {
 	}
 
 	// Should have attempted restarts
-	if proc.RestartCount == 0 {
+	if proc.State().RestartCount == 0 {
 		t.Error("Expected restart attempts, got 0")
 	}
 }
@@ -0,0 +1,257 @@
+package supervisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gleicon/ophid/internal/proxy/logsink"
+)
+
+// journaldSocket is where journald (and most syslog daemons) accept local
+// syslog messages
+const journaldSocket = "/dev/log"
+
+// maxLineBytes caps a buffered output line; longer lines are split
+const maxLineBytes = 64 * 1024
+
+// tailLines is how many recent output lines are kept for diagnostics
+const tailLines = 200
+
+// LogConfig controls where a process's output goes. The zero value passes
+// output straight through to the supervisor's stdout and stderr.
+type LogConfig struct {
+	Console    bool   `json:"console,omitempty"`     // Also write to the supervisor's stdout/stderr when File or Syslog is set
+	File       string `json:"file,omitempty"`        // Log file for both streams
+	MaxSizeMB  int    `json:"max_size_mb,omitempty"` // Rotate File after this size (0 = never)
+	MaxBackups int    `json:"max_backups,omitempty"` // Rotated files to keep
+	Syslog     string `json:"syslog,omitempty"`      // "journald", or a syslog URL such as udp://10.0.0.5:514 or unix:///dev/log
+	Timestamps bool   `json:"timestamps,omitempty"`  // Prefix each line with the time it was written
+	Streams    bool   `json:"streams,omitempty"`     // Tag each line with stdout or stderr
+	JSON       bool   `json:"json,omitempty"`        // Write each line as a JSON object (time, process, stream, line)
+}
+
+// passthrough reports whether output goes straight to the console
+func (c LogConfig) passthrough() bool {
+	return c.File == "" && c.Syslog == "" && !c.Timestamps && !c.Streams && !c.JSON
+}
+
+// processOutput formats process output line by line and fans it out to the
+// configured sinks. It lives across restarts of the process.
+type processOutput struct {
+	name    string
+	prefix  string // Leads every text line, e.g. "[host1] "
+	config  LogConfig
+	stdout  *lineWriter
+	stderr  *lineWriter
+	closers []io.Closer
+	tail    []string // Most recent lines, a ring of tailLines
+	next    int
+	mu      sync.Mutex // Keeps lines of both streams whole
+}
+
+// newProcessOutput opens the sinks of a log configuration
+func newProcessOutput(name string, config LogConfig) (*processOutput, error) {
+	out := &processOutput{name: name, config: config}
+
+	var shared []io.Writer
+	if config.File != "" {
+		sink, err := logsink.NewFileSink(config.File, config.MaxSizeMB, config.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out.closers = append(out.closers, sink)
+		shared = append(shared, sink)
+	}
+
+	stdoutSinks := append([]io.Writer{}, shared...)
+	stderrSinks := append([]io.Writer{}, shared...)
+
+	if config.Syslog != "" {
+		network, address, err := parseSyslogAddress(config.Syslog)
+		if err != nil {
+			out.Close()
+			return nil, err
+		}
+
+		// One connection per stream, so stderr is logged with error severity
+		for _, stream := range []struct {
+			msgID    string
+			severity int
+			sinks    *[]io.Writer
+		}{
+			{"stdout", logsink.SeverityInfo, &stdoutSinks},
+			{"stderr", logsink.SeverityError, &stderrSinks},
+		} {
+			sink, err := logsink.NewSyslogSink(network, address, "daemon", name, stream.msgID, stream.severity)
+			if err != nil {
+				out.Close()
+				return nil, err
+			}
+			out.closers = append(out.closers, sink)
+			*stream.sinks = append(*stream.sinks, sink)
+		}
+	}
+
+	if config.Console || len(out.closers) == 0 {
+		stdoutSinks = append(stdoutSinks, os.Stdout)
+		stderrSinks = append(stderrSinks, os.Stderr)
+	}
+
+	out.stdout = &lineWriter{out: out, stream: "stdout", sinks: stdoutSinks}
+	out.stderr = &lineWriter{out: out, stream: "stderr", sinks: stderrSinks}
+	return out, nil
+}
+
+// parseSyslogAddress turns "journald" or a syslog URL into a network and
+// address for logsink.NewSyslogSink
+func parseSyslogAddress(addr string) (string, string, error) {
+	if addr == "journald" {
+		return "unixgram", journaldSocket, nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog address %q: %w", addr, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("invalid syslog address %q: missing host", addr)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix", "unixgram":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("invalid syslog address %q: missing socket path", addr)
+		}
+		return u.Scheme, u.Path, nil
+	}
+	return "", "", fmt.Errorf("invalid syslog address %q (use journald, udp://, tcp://, unix:// or unixgram://)", addr)
+}
+
+// Flush writes out partial lines, once the process has exited
+func (o *processOutput) Flush() {
+	o.stdout.flush()
+	o.stderr.flush()
+}
+
+// Close flushes and closes the sinks
+func (o *processOutput) Close() {
+	if o.stdout != nil {
+		o.Flush()
+	}
+	for _, c := range o.closers {
+		if err := c.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close log of %s: %v\n", o.name, err)
+		}
+	}
+	o.closers = nil
+}
+
+// Tail returns the most recent output lines, oldest first
+func (o *processOutput) Tail() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.tail) < tailLines {
+		return append([]string{}, o.tail...)
+	}
+	return append(append([]string{}, o.tail[o.next:]...), o.tail[:o.next]...)
+}
+
+// remember adds a formatted line to the tail. Callers hold o.mu.
+func (o *processOutput) remember(line []byte) {
+	text := string(bytes.TrimSuffix(line, []byte{'\n'}))
+	if len(o.tail) < tailLines {
+		o.tail = append(o.tail, text)
+		return
+	}
+	o.tail[o.next] = text
+	o.next = (o.next + 1) % tailLines
+}
+
+// format renders one output line
+func (o *processOutput) format(stream string, line []byte, now time.Time) []byte {
+	if o.config.JSON {
+		data, _ := json.Marshal(struct {
+			Time    time.Time `json:"time"`
+			Process string    `json:"process"`
+			Stream  string    `json:"stream"`
+			Line    string    `json:"line"`
+		}{now, o.name, stream, string(line)})
+		return append(data, '\n')
+	}
+
+	var b bytes.Buffer
+	b.WriteString(o.prefix)
+	if o.config.Timestamps {
+		b.WriteString(now.Format("2006-01-02T15:04:05.000Z07:00"))
+		b.WriteByte(' ')
+	}
+	if o.config.Streams {
+		b.WriteString(stream)
+		b.WriteByte(' ')
+	}
+	b.Write(line)
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// lineWriter splits one output stream into lines
+type lineWriter struct {
+	out    *processOutput
+	stream string
+	sinks  []io.Writer
+	buf    []byte
+}
+
+// Write implements io.Writer. exec.Cmd calls it from a single goroutine
+// per stream.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			if len(w.buf) >= maxLineBytes {
+				w.emit(w.buf[:maxLineBytes])
+				w.buf = w.buf[maxLineBytes:]
+				continue
+			}
+			break
+		}
+		w.emit(bytes.TrimSuffix(w.buf[:i], []byte{'\r'}))
+		w.buf = w.buf[i+1:]
+	}
+
+	// Don't hold on to a large backing array
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// flush emits a trailing partial line
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
+
+// emit writes one line to every sink. A failing sink doesn't stop the
+// others or the process.
+func (w *lineWriter) emit(line []byte) {
+	w.out.mu.Lock()
+	defer w.out.mu.Unlock()
+
+	formatted := w.out.format(w.stream, line, time.Now())
+	w.out.remember(formatted)
+	for _, sink := range w.sinks {
+		sink.Write(formatted)
+	}
+}
@@ -0,0 +1,95 @@
+package supervisor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLineWriter(t *testing.T) {
+	var sink bytes.Buffer
+	out := &processOutput{name: "web", config: LogConfig{Streams: true}}
+	w := &lineWriter{out: out, stream: "stderr", sinks: []io.Writer{&sink}}
+
+	w.Write([]byte("first\r\nsec"))
+	w.Write([]byte("ond\nthi"))
+	if got := sink.String(); got != "stderr first\nstderr second\n" {
+		t.Errorf("before flush: %q", got)
+	}
+
+	w.flush()
+	if got := sink.String(); got != "stderr first\nstderr second\nstderr thi\n" {
+		t.Errorf("after flush: %q", got)
+	}
+
+	// Lines without a newline are split at maxLineBytes
+	sink.Reset()
+	w.Write(bytes.Repeat([]byte("x"), maxLineBytes+10))
+	w.flush()
+	if lines := bytes.Count(sink.Bytes(), []byte("\n")); lines != 2 {
+		t.Errorf("long line written as %d lines, want 2", lines)
+	}
+}
+
+func TestProcessOutputFormat(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		config LogConfig
+		want   string
+	}{
+		{LogConfig{}, "ready\n"},
+		{LogConfig{Timestamps: true}, "2026-03-01T12:00:00.000Z ready\n"},
+		{LogConfig{Timestamps: true, Streams: true}, "2026-03-01T12:00:00.000Z stdout ready\n"},
+		{LogConfig{JSON: true}, `{"time":"2026-03-01T12:00:00Z","process":"web","stream":"stdout","line":"ready"}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		out := &processOutput{name: "web", config: tt.config}
+		if got := string(out.format("stdout", []byte("ready"), now)); got != tt.want {
+			t.Errorf("format(%+v) = %q, want %q", tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestProcessOutputTail(t *testing.T) {
+	out := &processOutput{name: "web"}
+	w := &lineWriter{out: out, stream: "stdout"}
+	for i := 0; i < tailLines+5; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+
+	tail := out.Tail()
+	if len(tail) != tailLines || tail[0] != "line 5" || tail[len(tail)-1] != fmt.Sprintf("line %d", tailLines+4) {
+		t.Errorf("tail = %d lines, %q ... %q", len(tail), tail[0], tail[len(tail)-1])
+	}
+}
+
+func TestParseSyslogAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		network string
+		address string
+		wantErr bool
+	}{
+		{"journald", "unixgram", "/dev/log", false},
+		{"udp://10.0.0.5:514", "udp", "10.0.0.5:514", false},
+		{"tcp://logs.internal:601", "tcp", "logs.internal:601", false},
+		{"unix:///var/run/syslog", "unix", "/var/run/syslog", false},
+		{"10.0.0.5:514", "", "", true},
+		{"udp://", "", "", true},
+	}
+
+	for _, tt := range tests {
+		network, address, err := parseSyslogAddress(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSyslogAddress(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			continue
+		}
+		if network != tt.network || address != tt.address {
+			t.Errorf("parseSyslogAddress(%q) = %s %s, want %s %s", tt.addr, network, address, tt.network, tt.address)
+		}
+	}
+}
@@ -0,0 +1,785 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// The test binary doubles as the helper processes of the scenarios below:
+// started with OPHID_SUPERVISOR_HELPER set, it behaves as that helper
+// instead of running the tests.
+const (
+	helperEnv      = "OPHID_SUPERVISOR_HELPER"
+	helperReadyEnv = "OPHID_SUPERVISOR_HELPER_READY"
+	helperURLsEnv  = "OPHID_SUPERVISOR_HELPER_URLS"
+	helperTokenEnv = "OPHID_SUPERVISOR_HELPER_TOKEN"
+)
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(helperEnv); mode != "" {
+		runHelper(mode)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runHelper runs a helper process:
+//
+//	crash  exits with status 3 right away
+//	fail   writes a line to stderr and exits with status 3
+//	serve  runs until SIGTERM
+//	hang   ignores SIGTERM and runs until killed
+//	print  writes two lines to stdout and a partial line to stderr
+//	token  writes OPHID_SUPERVISOR_HELPER_TOKEN to stdout
+//	fetch  GETs each URL in OPHID_SUPERVISOR_HELPER_URLS and exits with
+//	       the number of requests the egress proxy refused
+//	socket serves its PID over HTTP on the socket passed as LISTEN_FDS
+//
+// serve and hang connect to OPHID_SUPERVISOR_HELPER_READY once their signal
+// handling is set up, so tests know when to signal them.
+func runHelper(mode string) {
+	switch mode {
+	case "crash":
+		os.Exit(3)
+	case "fail":
+		fmt.Fprintln(os.Stderr, "boom")
+		os.Exit(3)
+	case "hang":
+		signal.Ignore(syscall.SIGTERM)
+	case "serve":
+	case "print":
+		fmt.Print("hello\nworld\n")
+		fmt.Fprint(os.Stderr, "oops")
+		os.Exit(0)
+	case "token":
+		fmt.Println(os.Getenv(helperTokenEnv))
+		os.Exit(0)
+	case "fetch":
+		refused := 0
+		for _, u := range strings.Split(os.Getenv(helperURLsEnv), ",") {
+			resp, err := http.Get(u)
+			if err != nil {
+				os.Exit(100)
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusForbidden {
+				refused++
+			}
+		}
+		os.Exit(refused)
+	case "socket":
+		if os.Getenv("LISTEN_FDS") != "1" || os.Getenv("LISTEN_PID") != fmt.Sprint(os.Getpid()) {
+			os.Exit(4)
+		}
+		listener, err := net.FileListener(os.NewFile(listenFDsStart, "socket"))
+		if err != nil {
+			os.Exit(5)
+		}
+		http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, os.Getpid())
+		}))
+		os.Exit(6)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown helper mode %q\n", mode)
+		os.Exit(2)
+	}
+
+	if addr := os.Getenv(helperReadyEnv); addr != "" {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			os.Exit(2)
+		}
+		defer conn.Close()
+	}
+	select {}
+}
+
+// scenario runs supervisor scenarios against helper processes, with a fake
+// clock and a feed of state changes so no step depends on sleeping
+type scenario struct {
+	t       *testing.T
+	mgr     *Manager
+	clock   *fakeClock
+	changes chan ProcessState
+	ready   net.Listener
+	state   string
+}
+
+func newScenario(t *testing.T) *scenario {
+	t.Helper()
+
+	ready, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ready.Close() })
+
+	sc := &scenario{
+		t:       t,
+		clock:   &fakeClock{now: time.Unix(1_700_000_000, 0), timers: make(chan fakeTimer, 16)},
+		changes: make(chan ProcessState, 64),
+		ready:   ready,
+		state:   filepath.Join(t.TempDir(), "state.json"),
+	}
+	sc.mgr = NewManager()
+	sc.mgr.clock = sc.clock
+	sc.mgr.onChange = func(state ProcessState) { sc.changes <- state }
+	sc.mgr.SetStateFile(sc.state)
+	t.Cleanup(func() { sc.mgr.StopAll() })
+
+	return sc
+}
+
+// config returns a process config running a helper
+func (sc *scenario) config(name, mode string) ProcessConfig {
+	return ProcessConfig{
+		Name:    name,
+		Command: os.Args[0],
+		Environment: map[string]string{
+			helperEnv:      mode,
+			helperReadyEnv: sc.ready.Addr().String(),
+		},
+	}
+}
+
+// start starts a process and waits for a serve/hang helper to be ready
+func (sc *scenario) start(config ProcessConfig) {
+	sc.t.Helper()
+	if err := sc.mgr.Start(context.Background(), config); err != nil {
+		sc.t.Fatalf("Start() error = %v", err)
+	}
+	sc.expect(config.Name, StatusRunning)
+	if mode := config.Environment[helperEnv]; mode == "serve" || mode == "hang" {
+		sc.waitReady()
+	}
+}
+
+// waitReady waits for a helper to connect
+func (sc *scenario) waitReady() {
+	sc.t.Helper()
+	sc.ready.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+	conn, err := sc.ready.Accept()
+	if err != nil {
+		sc.t.Fatalf("helper not ready: %v", err)
+	}
+	sc.t.Cleanup(func() { conn.Close() })
+}
+
+// expect waits for the next state change and checks its status
+func (sc *scenario) expect(name string, status ProcessStatus) ProcessState {
+	sc.t.Helper()
+	select {
+	case state := <-sc.changes:
+		if state.Name != name || state.Status != status {
+			sc.t.Fatalf("state change = %s %s (%s), want %s %s", state.Name, state.Status, state.LastExit, name, status)
+		}
+		return state
+	case <-time.After(10 * time.Second):
+		sc.t.Fatalf("timed out waiting for %s to become %s", name, status)
+	}
+	return ProcessState{}
+}
+
+// fakeClock hands out timers that tests fire explicitly
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers chan fakeTimer
+}
+
+type fakeTimer struct {
+	d time.Duration
+	c chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	timer := fakeTimer{d: d, c: make(chan time.Time, 1)}
+	c.timers <- timer
+	return timer.c
+}
+
+// next returns the next timer the manager waits on
+func (c *fakeClock) next(t *testing.T) fakeTimer {
+	t.Helper()
+	select {
+	case timer := <-c.timers:
+		return timer
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for a timer")
+	}
+	return fakeTimer{}
+}
+
+// fire advances the clock by the timer's duration and fires it
+func (c *fakeClock) fire(timer fakeTimer) {
+	c.mu.Lock()
+	c.now = c.now.Add(timer.d)
+	now := c.now
+	c.mu.Unlock()
+	timer.c <- now
+}
+
+func TestScenarioCrashLoopBackoff(t *testing.T) {
+	sc := newScenario(t)
+
+	config := sc.config("crasher", "crash")
+	config.AutoRestart = true
+	config.MaxRetries = 3
+	config.RestartDelay = time.Second
+	config.MaxRestartDelay = 3 * time.Second
+	sc.start(config)
+
+	// Each crash waits twice as long as the previous one, up to the cap
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		state := sc.expect("crasher", StatusBackoff)
+		if state.RestartCount != i+1 || state.LastExit != "exit status 3" {
+			t.Errorf("crash %d: state = %+v", i+1, state)
+		}
+
+		timer := sc.clock.next(t)
+		if timer.d != want {
+			t.Errorf("restart %d delay = %s, want %s", i+1, timer.d, want)
+		}
+		sc.clock.fire(timer)
+		sc.expect("crasher", StatusRunning)
+	}
+
+	// Out of retries
+	sc.expect("crasher", StatusFailed)
+
+	states, err := LoadState(sc.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Status != StatusFailed || states[0].RestartCount != 3 || states[0].LastExit != "exit status 3" {
+		t.Errorf("persisted state = %+v", states)
+	}
+}
+
+func TestScenarioDiagnostics(t *testing.T) {
+	sc := newScenario(t)
+	dir := t.TempDir()
+	sc.mgr.SetDiagnosticsDir(dir)
+
+	config := sc.config("worker", "fail")
+	config.AutoRestart = true
+	config.MaxRetries = 1
+	config.Environment["API_TOKEN"] = "hunter2"
+	config.Log = LogConfig{Streams: true}
+	sc.start(config)
+
+	sc.expect("worker", StatusBackoff)
+	sc.clock.fire(sc.clock.next(t))
+	sc.expect("worker", StatusRunning)
+	state := sc.expect("worker", StatusFailed)
+	if filepath.Dir(state.Diagnostics) != dir || !strings.HasPrefix(filepath.Base(state.Diagnostics), "worker-") {
+		t.Fatalf("diagnostics = %q, want a bundle in %s", state.Diagnostics, dir)
+	}
+
+	f, err := os.Open(state.Diagnostics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[header.Name] = string(data)
+	}
+
+	// Both runs' output, with the secret kept out of every file
+	if got := strings.Count(files["output.log"], "stderr boom"); got != 2 {
+		t.Errorf("output.log = %q, want two runs of output", files["output.log"])
+	}
+	if !strings.Contains(files["env.txt"], "API_TOKEN=[redacted]") {
+		t.Errorf("env.txt does not redact API_TOKEN")
+	}
+	for _, name := range []string{"process.json", "health.json", "system.json", "env.txt", "output.log"} {
+		data, ok := files[name]
+		if !ok {
+			t.Errorf("bundle has no %s", name)
+		}
+		if strings.Contains(data, "hunter2") {
+			t.Errorf("%s leaks a secret", name)
+		}
+	}
+}
+
+func TestScenarioStopEscalation(t *testing.T) {
+	sc := newScenario(t)
+
+	// A process that exits on SIGTERM stops without the timeout firing
+	sc.start(sc.config("polite", "serve"))
+	polite, _ := sc.mgr.Get("polite")
+	if err := sc.mgr.Stop("polite"); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if state := polite.State(); state.Status != StatusStopped || state.LastExit != "signal: terminated" {
+		t.Errorf("polite state = %+v", state)
+	}
+	sc.clock.next(t) // Stop timeout, never fired
+
+	// A process ignoring SIGTERM is killed once the stop timeout fires
+	config := sc.config("stubborn", "hang")
+	config.StopTimeout = 5 * time.Second
+	sc.start(config)
+	stubborn, _ := sc.mgr.Get("stubborn")
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- sc.mgr.Stop("stubborn") }()
+
+	timer := sc.clock.next(t)
+	if timer.d != 5*time.Second {
+		t.Errorf("stop timeout = %s, want 5s", timer.d)
+	}
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop() returned before the timeout fired: %v", err)
+	default:
+	}
+
+	sc.clock.fire(timer)
+	if err := <-stopped; err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if state := stubborn.State(); state.Status != StatusStopped || state.LastExit != "signal: killed" {
+		t.Errorf("stubborn state = %+v", state)
+	}
+
+	// Stopped processes leave the persisted state
+	states, err := LoadState(sc.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Errorf("persisted state = %+v, want empty", states)
+	}
+}
+
+func TestScenarioHealthFlapping(t *testing.T) {
+	sc := newScenario(t)
+
+	var healthy atomic.Bool
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer health.Close()
+
+	config := sc.config("web", "serve")
+	config.AutoRestart = true
+	config.HealthCheck = HealthCheckConfig{
+		Enabled:  true,
+		Type:     "http",
+		Endpoint: health.URL,
+		Timeout:  5 * time.Second,
+		Retries:  3,
+	}
+	sc.start(config)
+	first, _ := sc.mgr.Get("web")
+	pid := first.State().PID
+
+	checker := NewHealthChecker(sc.mgr)
+	ctx := context.Background()
+
+	// Failures below the threshold, interrupted by a success, keep it running
+	for _, ok := range []bool{false, false, true, false, false} {
+		healthy.Store(ok)
+		checker.checkAll(ctx)
+	}
+	if proc, _ := sc.mgr.Get("web"); proc != first || first.State().PID != pid {
+		t.Fatalf("process restarted while flapping below the threshold")
+	}
+	// Every failure counts towards the persisted total
+	if states, _ := LoadState(sc.state); len(states) != 1 || states[0].HealthFailed != 4 {
+		t.Errorf("persisted state = %+v, want 4 failed health checks", states)
+	}
+
+	// The third failure in a row restarts it
+	healthy.Store(false)
+	checker.checkAll(ctx)
+	sc.waitReady()
+
+	restarted, _ := sc.mgr.Get("web")
+	if restarted == first || restarted.State().PID == pid || !restarted.IsRunning() {
+		t.Fatalf("process not restarted after consecutive failures")
+	}
+	if state := first.State(); state.Status != StatusStopped || state.LastExit != "signal: terminated" {
+		t.Errorf("old process state = %+v", state)
+	}
+
+	states, err := LoadState(sc.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].PID != restarted.State().PID {
+		t.Errorf("persisted state = %+v, want the restarted process", states)
+	}
+}
+
+func TestScenarioReadiness(t *testing.T) {
+	sc := newScenario(t)
+
+	// Without a health check a process is ready once it runs
+	sc.start(sc.config("plain", "serve"))
+	if proc, _ := sc.mgr.Get("plain"); !proc.IsReady() {
+		t.Error("process without a health check not ready")
+	}
+
+	var healthy atomic.Bool
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer health.Close()
+
+	config := sc.config("web", "serve")
+	config.HealthCheck = HealthCheckConfig{Enabled: true, Type: "http", Endpoint: health.URL, Timeout: 5 * time.Second}
+	sc.start(config)
+	web, _ := sc.mgr.Get("web")
+	checker := NewHealthChecker(sc.mgr)
+
+	// Failed readiness probes neither make it ready nor count as failures
+	checker.checkReadiness()
+	if web.IsReady() || web.healthFailures != 0 {
+		t.Errorf("ready = %v, failures = %d after a failed probe", web.IsReady(), web.healthFailures)
+	}
+
+	healthy.Store(true)
+	checker.checkReadiness()
+	if state := sc.expect("web", StatusRunning); !state.Ready {
+		t.Errorf("state after a passing probe = %+v, want ready", state)
+	}
+
+	// A failing health check takes it out again, and the state file follows
+	healthy.Store(false)
+	checker.checkAll(context.Background())
+	if state := sc.expect("web", StatusRunning); state.Ready {
+		t.Errorf("state after a failed check = %+v, want not ready", state)
+	}
+
+	states, err := LoadState(sc.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := make(map[string]bool)
+	for _, state := range states {
+		ready[state.Name] = state.Ready
+	}
+	if !ready["plain"] || ready["web"] {
+		t.Errorf("persisted readiness = %v", ready)
+	}
+}
+
+func TestScenarioSocketHandover(t *testing.T) {
+	sc := newScenario(t)
+
+	port, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	config := sc.config("web", "socket")
+	config.Sockets = []string{addr}
+	sc.start(config)
+
+	get := func() string {
+		t.Helper()
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			t.Fatalf("GET error = %v", err)
+		}
+		defer resp.Body.Close()
+		var pid string
+		fmt.Fscan(resp.Body, &pid)
+		return pid
+	}
+
+	first := get()
+	proc, _ := sc.mgr.Get("web")
+	if state := proc.State(); first != fmt.Sprint(state.PID) {
+		t.Fatalf("served by PID %s, want %d", first, state.PID)
+	}
+
+	// The restarted process serves the same socket
+	if err := sc.mgr.Restart(context.Background(), "web"); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if second := get(); second == first {
+		t.Errorf("still served by PID %s after a restart", first)
+	}
+
+	// Stopping closes it
+	if err := sc.mgr.Stop("web"); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("socket still open after Stop")
+	}
+}
+
+// startExternal starts a serve helper outside the supervisor, as another
+// supervisor would, and writes its PID file
+func (sc *scenario) startExternal(pidFile string) *exec.Cmd {
+	sc.t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), helperEnv+"=serve", helperReadyEnv+"="+sc.ready.Addr().String())
+	if err := cmd.Start(); err != nil {
+		sc.t.Fatal(err)
+	}
+	sc.waitReady()
+
+	// Reap it once it exits, so it doesn't linger as a zombie
+	go cmd.Wait()
+	sc.t.Cleanup(func() { cmd.Process.Kill() })
+
+	if err := os.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", cmd.Process.Pid)), 0644); err != nil {
+		sc.t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestScenarioAdoptPIDFile(t *testing.T) {
+	sc := newScenario(t)
+	pidFile := filepath.Join(t.TempDir(), "web.pid")
+	external := sc.startExternal(pidFile)
+
+	// Adopted without a command: Stop still controls it
+	sc.start(ProcessConfig{Name: "web", PIDFile: pidFile})
+	proc, _ := sc.mgr.Get("web")
+	if state := proc.State(); !state.Adopted || state.PID != external.Process.Pid {
+		t.Fatalf("state = %+v, want adopted PID %d", state, external.Process.Pid)
+	}
+	if err := sc.mgr.Stop("web"); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if processAlive(external.Process.Pid) {
+		t.Error("adopted process still running after Stop")
+	}
+	sc.clock.next(t) // Stop timeout, never fired
+
+	// No running process and no command to start
+	if err := sc.mgr.Start(context.Background(), ProcessConfig{Name: "web", PIDFile: pidFile}); err == nil {
+		t.Error("Start() with a stale PID file and no command succeeded")
+	}
+
+	// With a command, an adopted process that exits is replaced by a child
+	external = sc.startExternal(pidFile)
+	config := sc.config("web", "serve")
+	config.PIDFile = pidFile
+	config.AutoRestart = true
+	config.MaxRetries = 1
+	if err := sc.mgr.Start(context.Background(), config); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	sc.expect("web", StatusRunning)
+	external.Process.Signal(syscall.SIGTERM)
+
+	if state := sc.expect("web", StatusBackoff); state.LastExit != "adopted process exited" {
+		t.Errorf("state after exit = %+v", state)
+	}
+	sc.clock.fire(sc.clock.next(t))
+	if state := sc.expect("web", StatusRunning); state.Adopted || state.PID == external.Process.Pid {
+		t.Errorf("state after restart = %+v, want a started process", state)
+	}
+	sc.waitReady()
+}
+
+func TestScenarioEgressAllowlist(t *testing.T) {
+	sc := newScenario(t)
+
+	// .test names never resolve: allowed requests fail upstream with 502,
+	// refused ones get 403 from the proxy
+	urls := "http://pypi.test/simple/,http://exfil.test/upload"
+
+	enforced := sc.config("enforced", "fetch")
+	enforced.Environment[helperURLsEnv] = urls
+	enforced.EgressAllow = []string{"*.pypi.test", "pypi.test"}
+	sc.start(enforced)
+	if state := sc.expect("enforced", StatusFailed); state.LastExit != "exit status 1" {
+		t.Errorf("enforced: %s, want one refused request", state.LastExit)
+	}
+
+	warned := sc.config("warned", "fetch")
+	warned.Environment[helperURLsEnv] = urls
+	warned.EgressAllow = []string{"pypi.test"}
+	warned.EgressWarnOnly = true
+	sc.start(warned)
+	if state := sc.expect("warned", StatusStopped); state.LastExit != "exit status 0" {
+		t.Errorf("warn-only: %s, want no refused requests", state.LastExit)
+	}
+
+	proc, _ := sc.mgr.Get("warned")
+	proc.mu.RLock()
+	defer proc.mu.RUnlock()
+	if proc.egress != nil {
+		t.Error("egress proxy still running after the process exited")
+	}
+
+	conflicting := sc.config("conflicting", "serve")
+	conflicting.EgressAllow = []string{"pypi.test"}
+	conflicting.EgressProxy = "http://127.0.0.1:3128"
+	if err := sc.mgr.Start(context.Background(), conflicting); err == nil {
+		t.Error("Start() should refuse egress_allow combined with egress_proxy")
+	}
+}
+
+func TestScenarioLogSinks(t *testing.T) {
+	sc := newScenario(t)
+
+	logFile := filepath.Join(t.TempDir(), "printer.log")
+	config := sc.config("printer", "print")
+	config.Log = LogConfig{File: logFile, JSON: true}
+	sc.start(config)
+	sc.expect("printer", StatusStopped)
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry struct {
+			Time    time.Time `json:"time"`
+			Process string    `json:"process"`
+			Stream  string    `json:"stream"`
+			Line    string    `json:"line"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		if entry.Process != "printer" || entry.Time.IsZero() {
+			t.Errorf("log entry = %+v", entry)
+		}
+		got = append(got, entry.Stream+": "+entry.Line)
+	}
+
+	// Streams are copied concurrently, so only per-stream order is fixed
+	sort.Strings(got)
+	if want := "[stderr: oops stdout: hello stdout: world]"; fmt.Sprint(got) != want {
+		t.Errorf("logged %v, want %s", got, want)
+	}
+}
+
+func TestScenarioSecrets(t *testing.T) {
+	sc := newScenario(t)
+	sc.mgr.SetSecrets(func(name string) (string, error) {
+		if name != "api-token" {
+			return "", fmt.Errorf("no secret %s", name)
+		}
+		return "t0ken", nil
+	})
+
+	logFile := filepath.Join(t.TempDir(), "token.log")
+	config := sc.config("token", "token")
+	config.Environment[helperTokenEnv] = "Bearer {{secret:api-token}}"
+	config.Log = LogConfig{File: logFile}
+	sc.start(config)
+	sc.expect("token", StatusStopped)
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Bearer t0ken") {
+		t.Errorf("process saw %q, want the resolved secret", data)
+	}
+	state, err := os.ReadFile(sc.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(state), "t0ken") {
+		t.Errorf("state file holds the secret: %s", state)
+	}
+
+	missing := sc.config("missing", "token")
+	missing.Environment[helperTokenEnv] = "{{secret:other}}"
+	if err := sc.mgr.Start(context.Background(), missing); err == nil || !strings.Contains(err.Error(), "other") {
+		t.Errorf("Start() with an unknown secret = %v", err)
+	}
+}
+
+func TestNextRestartDelay(t *testing.T) {
+	proc := &Process{Config: ProcessConfig{RestartDelay: time.Second, MaxRestartDelay: 4 * time.Second}}
+
+	var delays []time.Duration
+	for _, ran := range []time.Duration{0, 0, 0, 0, 2 * time.Minute, 0} {
+		delays = append(delays, nextRestartDelay(proc, ran))
+	}
+
+	// A process that ran for stableRunTime starts over
+	if got := fmt.Sprint(delays); got != "[1s 2s 4s 4s 1s 2s]" {
+		t.Errorf("delays = %s", got)
+	}
+}
+
+func TestRunWithLimitsTimeout(t *testing.T) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), helperEnv+"=serve")
+
+	start := time.Now()
+	err := RunWithLimits(cmd, Limits{Timeout: 200 * time.Millisecond, Nice: 5})
+
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("RunWithLimits() error = %v, want a LimitError", err)
+	}
+	if limitErr.Limit != "timeout" || limitErr.Err.Error() != "signal: terminated" {
+		t.Errorf("LimitError = %+v", limitErr)
+	}
+	if elapsed := time.Since(start); elapsed >= limitKillGrace {
+		t.Errorf("took %s, want the process to stop on SIGTERM", elapsed)
+	}
+
+	// Exiting in time is not a limit error
+	cmd = exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), helperEnv+"=crash")
+	err = RunWithLimits(cmd, Limits{Timeout: time.Minute})
+	if errors.As(err, &limitErr) || err == nil || err.Error() != "exit status 3" {
+		t.Errorf("RunWithLimits() error = %v, want exit status 3", err)
+	}
+}
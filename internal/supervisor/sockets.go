@@ -0,0 +1,93 @@
+package supervisor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first descriptor passed to a process, after stdin,
+// stdout and stderr, as in systemd socket activation
+const listenFDsStart = 3
+
+// openSockets opens the listening sockets of a process. They belong to the
+// supervisor and stay open across restarts, so connections arriving while
+// the process restarts wait in the listen backlog instead of being refused.
+func openSockets(proc *Process) error {
+	if !socketsSupported {
+		return fmt.Errorf("socket handover is not supported on this platform")
+	}
+
+	for _, addr := range proc.Config.Sockets {
+		network, address := socketAddress(addr)
+		if network == "unix" {
+			os.Remove(address) // Left behind by an earlier run
+		}
+
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			closeSockets(proc)
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+
+		// Keep a duplicate of the descriptor; the listener itself is not used
+		var file *os.File
+		switch l := listener.(type) {
+		case *net.TCPListener:
+			file, err = l.File()
+		case *net.UnixListener:
+			l.SetUnlinkOnClose(false)
+			file, err = l.File()
+		}
+		listener.Close()
+		if err != nil {
+			closeSockets(proc)
+			return fmt.Errorf("failed to hand over %s: %w", addr, err)
+		}
+		proc.sockets = append(proc.sockets, file)
+	}
+	return nil
+}
+
+// closeSockets closes the listening sockets of a process, if it has any
+func closeSockets(proc *Process) {
+	proc.mu.Lock()
+	sockets := proc.sockets
+	proc.sockets = nil
+	proc.mu.Unlock()
+
+	for i, file := range sockets {
+		file.Close()
+		if network, address := socketAddress(proc.Config.Sockets[i]); network == "unix" {
+			os.Remove(address)
+		}
+	}
+}
+
+// takeSockets detaches the listening sockets from a process, so they
+// survive it being stopped
+func (p *Process) takeSockets() []*os.File {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sockets := p.sockets
+	p.sockets = nil
+	return sockets
+}
+
+// socketAddress splits a socket address into a network and address:
+// "unix:/run/app.sock" is a Unix socket, anything else a TCP host:port
+func socketAddress(addr string) (string, string) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return "unix", path
+	}
+	return "tcp", addr
+}
+
+// socketEnv returns the socket activation variables for n passed sockets.
+// LISTEN_PID is set by the wrapper socketCommand adds, since only the
+// child knows its PID.
+func socketEnv(n int) []string {
+	return []string{"LISTEN_FDS=" + strconv.Itoa(n)}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package supervisor
+
+// socketsSupported reports whether sockets can be passed to processes
+const socketsSupported = false
+
+// socketCommand is not used on this platform
+func socketCommand(command string, args []string) (string, []string) {
+	return command, args
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package supervisor
+
+// socketsSupported reports whether sockets can be passed to processes
+const socketsSupported = true
+
+// socketCommand wraps a command so it sees its own PID as LISTEN_PID, which
+// socket activation libraries check before using the passed descriptors.
+// exec keeps the shell's PID.
+func socketCommand(command string, args []string) (string, []string) {
+	return "/bin/sh", append([]string{"-c", `LISTEN_PID=$$ exec "$0" "$@"`, command}, args...)
+}
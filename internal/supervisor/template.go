@@ -0,0 +1,180 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateRef matches {{name}} references, e.g. {{venv_bin}} or {{port.admin}}
+var templateRef = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// ServiceFile is a portable process definition: a process config whose
+// strings may reference template variables, the tool it runs and its own
+// variable defaults
+type ServiceFile struct {
+	Tool    string            `json:"tool,omitempty"` // Installed tool, provides {{venv_bin}} and {{tool_dir}}
+	Vars    map[string]string `json:"vars,omitempty"`
+	Process ProcessConfig     `json:"process"`
+}
+
+// LoadServiceFile reads a JSON service file, or a YAML one (.yaml or .yml)
+// with the same fields
+func LoadServiceFile(path string) (*ServiceFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service file: %w", err)
+	}
+
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("failed to parse service file %s: %w", path, err)
+		}
+	}
+
+	var service ServiceFile
+	if err := json.Unmarshal(data, &service); err != nil {
+		return nil, fmt.Errorf("failed to parse service file %s: %w", path, err)
+	}
+	if service.Process.Name == "" {
+		return nil, fmt.Errorf("service file %s: process name is required", path)
+	}
+	return &service, nil
+}
+
+// yamlToJSON converts a YAML document to JSON, so YAML service files share
+// the JSON field names and decoding
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// Template substitutes {{name}} references in process configs. Names are
+// looked up in its variables; port and port.<name> allocate a free local
+// port, the same one for every reference.
+type Template struct {
+	vars  map[string]string
+	ports map[string]int
+}
+
+// NewTemplate creates a template with the given variables
+func NewTemplate(vars map[string]string) *Template {
+	t := &Template{vars: make(map[string]string), ports: make(map[string]int)}
+	for k, v := range vars {
+		t.vars[k] = v
+	}
+	return t
+}
+
+// Ports returns the ports allocated so far, by reference name
+func (t *Template) Ports() map[string]int {
+	ports := make(map[string]int, len(t.ports))
+	for k, v := range t.ports {
+		ports[k] = v
+	}
+	return ports
+}
+
+// Expand substitutes the references in s
+func (t *Template) Expand(s string) (string, error) {
+	var firstErr error
+	result := templateRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := templateRef.FindStringSubmatch(ref)[1]
+		value, err := t.lookup(name)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return value
+	})
+	return result, firstErr
+}
+
+// lookup resolves one variable
+func (t *Template) lookup(name string) (string, error) {
+	if value, ok := t.vars[name]; ok {
+		return value, nil
+	}
+
+	if name == "port" || strings.HasPrefix(name, "port.") {
+		port, ok := t.ports[name]
+		if !ok {
+			var err error
+			if port, err = freePort(); err != nil {
+				return "", fmt.Errorf("failed to allocate {{%s}}: %w", name, err)
+			}
+			t.ports[name] = port
+		}
+		return strconv.Itoa(port), nil
+	}
+
+	return "", fmt.Errorf("undefined template variable {{%s}}", name)
+}
+
+// ExpandConfig returns a copy of config with the references in its command,
+// arguments, working directory, environment, health check endpoint, egress
+// settings, log file, sockets and PID file substituted
+func (t *Template) ExpandConfig(config ProcessConfig) (ProcessConfig, error) {
+	var firstErr error
+	expand := func(s string) string {
+		value, err := t.Expand(s)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return value
+	}
+	expandAll := func(values []string) []string {
+		if values == nil {
+			return nil
+		}
+		result := make([]string, len(values))
+		for i, v := range values {
+			result[i] = expand(v)
+		}
+		return result
+	}
+
+	config.Name = expand(config.Name)
+	config.Command = expand(config.Command)
+	config.Args = expandAll(config.Args)
+	config.WorkingDir = expand(config.WorkingDir)
+	if config.Environment != nil {
+		env := make(map[string]string, len(config.Environment))
+		for k, v := range config.Environment {
+			env[k] = expand(v)
+		}
+		config.Environment = env
+	}
+	config.HealthCheck.Endpoint = expand(config.HealthCheck.Endpoint)
+	config.EgressProxy = expand(config.EgressProxy)
+	config.EgressCA = expand(config.EgressCA)
+	config.EgressAllow = expandAll(config.EgressAllow)
+	config.Log.File = expand(config.Log.File)
+	config.Log.Syslog = expand(config.Log.Syslog)
+	config.Sockets = expandAll(config.Sockets)
+	config.PIDFile = expand(config.PIDFile)
+
+	if firstErr != nil {
+		return ProcessConfig{}, fmt.Errorf("process %s: %w", config.Name, firstErr)
+	}
+	return config, nil
+}
+
+// freePort asks the kernel for an unused local TCP port
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,111 @@
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTemplate_ExpandConfig(t *testing.T) {
+	tmpl := NewTemplate(map[string]string{
+		"venv_bin": "/home/ops/.ophid/tools/gunicorn/venv/bin",
+		"workers":  "4",
+	})
+
+	config := ProcessConfig{
+		Name:        "web",
+		Command:     "{{venv_bin}}/gunicorn",
+		Args:        []string{"--workers", "{{ workers }}", "--bind", "127.0.0.1:{{port}}"},
+		Environment: map[string]string{"PORT": "{{port}}", "ADMIN_PORT": "{{port.admin}}"},
+		HealthCheck: HealthCheckConfig{Endpoint: "http://127.0.0.1:{{port}}/health"},
+	}
+
+	got, err := tmpl.ExpandConfig(config)
+	if err != nil {
+		t.Fatalf("ExpandConfig() error = %v", err)
+	}
+
+	ports := tmpl.Ports()
+	port, admin := strconv.Itoa(ports["port"]), strconv.Itoa(ports["port.admin"])
+	if ports["port"] == 0 || ports["port.admin"] == 0 || port == admin {
+		t.Fatalf("Ports() = %v, want two distinct ports", ports)
+	}
+
+	if got.Command != "/home/ops/.ophid/tools/gunicorn/venv/bin/gunicorn" {
+		t.Errorf("Command = %s", got.Command)
+	}
+	if got.Args[1] != "4" || got.Args[3] != "127.0.0.1:"+port {
+		t.Errorf("Args = %v", got.Args)
+	}
+	if got.Environment["PORT"] != port || got.Environment["ADMIN_PORT"] != admin {
+		t.Errorf("Environment = %v", got.Environment)
+	}
+	if got.HealthCheck.Endpoint != "http://127.0.0.1:"+port+"/health" {
+		t.Errorf("Endpoint = %s", got.HealthCheck.Endpoint)
+	}
+
+	// The original is untouched
+	if config.Environment["PORT"] != "{{port}}" {
+		t.Errorf("ExpandConfig() modified its input")
+	}
+}
+
+func TestTemplate_Undefined(t *testing.T) {
+	_, err := NewTemplate(nil).ExpandConfig(ProcessConfig{Name: "web", Command: "{{venv_bin}}/gunicorn"})
+	if err == nil || err.Error() != "process web: undefined template variable {{venv_bin}}" {
+		t.Errorf("ExpandConfig() error = %v", err)
+	}
+
+	// Text that only looks like a reference is left alone
+	got, err := NewTemplate(nil).Expand("{{ not a var }} {x}")
+	if err != nil || got != "{{ not a var }} {x}" {
+		t.Errorf("Expand() = %q, %v", got, err)
+	}
+}
+
+func TestLoadServiceFile(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "web.json")
+	os.WriteFile(path, []byte(`{
+  "tool": "gunicorn",
+  "vars": {"workers": "2"},
+  "process": {"name": "web", "command": "{{venv_bin}}/gunicorn", "auto_restart": true}
+}`), 0644)
+
+	service, err := LoadServiceFile(path)
+	if err != nil {
+		t.Fatalf("LoadServiceFile() error = %v", err)
+	}
+	if service.Tool != "gunicorn" || service.Vars["workers"] != "2" || service.Process.Command != "{{venv_bin}}/gunicorn" || !service.Process.AutoRestart {
+		t.Errorf("LoadServiceFile() = %+v", service)
+	}
+
+	yamlPath := filepath.Join(dir, "web.yaml")
+	os.WriteFile(yamlPath, []byte(`tool: gunicorn
+vars:
+  workers: "2"
+process:
+  name: web
+  command: "{{venv_bin}}/gunicorn"
+  auto_restart: true
+  health_check:
+    enabled: true
+    timeout: 2000000000
+`), 0644)
+	fromYAML, err := LoadServiceFile(yamlPath)
+	if err != nil {
+		t.Fatalf("LoadServiceFile(yaml) error = %v", err)
+	}
+	if fromYAML.Tool != "gunicorn" || fromYAML.Vars["workers"] != "2" || !fromYAML.Process.AutoRestart || fromYAML.Process.HealthCheck.Timeout != 2*time.Second {
+		t.Errorf("LoadServiceFile(yaml) = %+v", fromYAML)
+	}
+
+	unnamed := filepath.Join(dir, "unnamed.json")
+	os.WriteFile(unnamed, []byte(`{"process": {"command": "sleep"}}`), 0644)
+	if _, err := LoadServiceFile(unnamed); err == nil {
+		t.Error("LoadServiceFile() should require a process name")
+	}
+}
@@ -1,9 +1,14 @@
 package supervisor
 
 import (
+	"os"
 	"os/exec"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/gleicon/ophid/internal/events"
+	"github.com/gleicon/ophid/internal/proxy/egress"
 )
 
 // ProcessConfig defines how to run a process
@@ -12,10 +17,35 @@ type ProcessConfig struct {
 	Command     string            `json:"command"`
 	Args        []string          `json:"args,omitempty"`
 	WorkingDir  string            `json:"working_dir,omitempty"`
-	Environment map[string]string `json:"environment,omitempty"`
+	Environment map[string]string `json:"environment,omitempty"` // Values may reference {{secret:name}}
 	AutoRestart bool              `json:"auto_restart"`
 	MaxRetries  int               `json:"max_retries"`
+
+	RestartDelay    time.Duration `json:"restart_delay,omitempty"`     // First restart delay, doubled per crash (default 2s)
+	MaxRestartDelay time.Duration `json:"max_restart_delay,omitempty"` // Restart delay cap (default 1m)
+	StopTimeout     time.Duration `json:"stop_timeout,omitempty"`      // Grace period after SIGTERM before SIGKILL (default 10s)
+
 	HealthCheck HealthCheckConfig `json:"health_check"`
+	Log         LogConfig         `json:"log,omitempty"`
+	EgressProxy string            `json:"egress_proxy,omitempty"`   // Outbound proxy URL injected as HTTP(S)_PROXY / ALL_PROXY
+	EgressCA    string            `json:"egress_ca_cert,omitempty"` // CA bundle to trust when the egress proxy intercepts TLS
+
+	// EgressAllow lists the destinations the process may reach (domains,
+	// "*.domain" or CIDRs). When set, the process gets its own egress proxy
+	// on loopback, injected as EgressProxy is.
+	EgressAllow    []string `json:"egress_allow,omitempty"`
+	EgressWarnOnly bool     `json:"egress_warn_only,omitempty"` // Log destinations outside EgressAllow instead of blocking them
+
+	// Sockets lists addresses the supervisor listens on and passes to the
+	// process as systemd-style LISTEN_FDS (descriptor 3 onwards), e.g.
+	// "127.0.0.1:8000" or "unix:/run/app.sock". The sockets outlive restarts
+	// of the process, so connections are never refused while it restarts.
+	Sockets []string `json:"sockets,omitempty"`
+
+	// PIDFile adopts the process it names, when that is running, instead of
+	// starting Command; e.g. a gunicorn started by another supervisor.
+	// Command, if set, replaces it once it exits.
+	PIDFile string `json:"pid_file,omitempty"`
 }
 
 // HealthCheckConfig defines health check parameters
@@ -25,17 +55,48 @@ type HealthCheckConfig struct {
 	Endpoint string        `json:"endpoint,omitempty"`
 	Interval time.Duration `json:"interval"`
 	Timeout  time.Duration `json:"timeout"`
-	Retries  int           `json:"retries"`
+	Retries  int           `json:"retries"` // Consecutive failures before a restart (default 1)
 }
 
 // Process represents a running process
 type Process struct {
-	Config      ProcessConfig
-	Cmd         *exec.Cmd
-	StartTime   time.Time
+	Config       ProcessConfig
+	Cmd          *exec.Cmd
+	StartTime    time.Time
 	RestartCount int
-	Status      ProcessStatus
-	mu          sync.RWMutex
+	Status       ProcessStatus
+	LastExit     string // How the last run ended (e.g., "exit status 1")
+	mu           sync.RWMutex
+
+	done           chan struct{} // Closed when the current run exits
+	stop           chan struct{} // Closed by Stop
+	stopping       bool
+	restartDelay   time.Duration // Delay before the next restart
+	healthFailures int           // Consecutive failed health checks
+	healthFailed   int           // Failed health checks since the supervisor started
+	ready          bool          // Passed a health check since it last started (or has none)
+	egress         *egress.Proxy // Per-process egress proxy, when EgressAllow is set
+	egressURL      string
+	output         *processOutput // Formats and routes output, unless it passes straight through
+	sockets        []*os.File     // Listening sockets passed to the process, one per Config.Sockets
+	adopted        bool           // Running process taken over from a PID file, not a child
+	healthLog      []healthResult // Recent health check results, oldest first
+	diagnostics    string         // Diagnostics bundle written when it failed for good
+}
+
+// ProcessState is the persisted state of a supervised process
+type ProcessState struct {
+	Name         string        `json:"name"`
+	Status       ProcessStatus `json:"status"`
+	PID          int           `json:"pid,omitempty"`
+	StartTime    time.Time     `json:"start_time"`
+	RestartCount int           `json:"restart_count"`
+	HealthFailed int           `json:"health_failed,omitempty"` // Failed health checks since the supervisor started
+	LastExit     string        `json:"last_exit,omitempty"`
+	Ready        bool          `json:"ready"`                 // Running and passed its health check, or has none
+	Adopted      bool          `json:"adopted,omitempty"`     // Taken over from a PID file
+	Diagnostics  string        `json:"diagnostics,omitempty"` // Bundle written when it ran out of restarts
+	Config       ProcessConfig `json:"config"`
 }
 
 // ProcessStatus represents process state
@@ -46,6 +107,7 @@ const (
 	StatusStarting ProcessStatus = "starting"
 	StatusRunning  ProcessStatus = "running"
 	StatusFailed   ProcessStatus = "failed"
+	StatusBackoff  ProcessStatus = "backoff" // Waiting to restart after a crash
 )
 
 // IsRunning returns true if the process is running
@@ -55,6 +117,14 @@ func (p *Process) IsRunning() bool {
 	return p.Status == StatusRunning
 }
 
+// IsReady returns true if the process is running and passed its health
+// check since it last started
+func (p *Process) IsReady() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.Status == StatusRunning && p.ready
+}
+
 // GetStatus returns the current status
 func (p *Process) GetStatus() ProcessStatus {
 	p.mu.RLock()
@@ -66,5 +136,45 @@ func (p *Process) GetStatus() ProcessStatus {
 func (p *Process) SetStatus(status ProcessStatus) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if p.Status == status {
+		return
+	}
 	p.Status = status
+	emitState(p)
+}
+
+// emitState emits the process's status as a process.state event. Callers
+// hold p.mu.
+func emitState(p *Process) {
+	data := map[string]string{"status": string(p.Status)}
+	if p.Status != StatusRunning && p.LastExit != "" {
+		data["last_exit"] = p.LastExit
+	}
+	if p.RestartCount > 0 {
+		data["restarts"] = strconv.Itoa(p.RestartCount)
+	}
+	events.Emit(events.ProcessState, p.Config.Name, string(p.Status), data)
+}
+
+// State returns a snapshot of the process state
+func (p *Process) State() ProcessState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	state := ProcessState{
+		Name:         p.Config.Name,
+		Status:       p.Status,
+		StartTime:    p.StartTime,
+		RestartCount: p.RestartCount,
+		HealthFailed: p.healthFailed,
+		LastExit:     p.LastExit,
+		Ready:        p.Status == StatusRunning && p.ready,
+		Adopted:      p.adopted,
+		Diagnostics:  p.diagnostics,
+		Config:       p.Config,
+	}
+	if p.Cmd != nil && p.Cmd.Process != nil && p.Status == StatusRunning {
+		state.PID = p.Cmd.Process.Pid
+	}
+	return state
 }
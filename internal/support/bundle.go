@@ -0,0 +1,83 @@
+package support
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Bundle collects files into a .tar.gz, e.g. for a bug report
+type Bundle struct {
+	files []bundleFile
+}
+
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// NewBundle creates an empty bundle
+func NewBundle() *Bundle {
+	return &Bundle{}
+}
+
+// Add adds a file
+func (b *Bundle) Add(name string, data []byte) {
+	b.files = append(b.files, bundleFile{name: name, data: data})
+}
+
+// Names returns the names of the files added so far
+func (b *Bundle) Names() []string {
+	names := make([]string, len(b.files))
+	for i, f := range b.files {
+		names[i] = f.name
+	}
+	return names
+}
+
+// Write writes the bundle to path, readable only by its owner. The file
+// appears complete or not at all.
+func (b *Bundle) Write(path string, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range b.files {
+		header := &tar.Header{Name: file.name, Mode: 0600, Size: int64(len(file.data)), ModTime: modTime}
+		if err = tw.WriteHeader(header); err != nil {
+			break
+		}
+		if _, err = tw.Write(file.data); err != nil {
+			break
+		}
+	}
+
+	if closeErr := tw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package support
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBundleWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report", "bundle.tar.gz")
+	b := NewBundle()
+	b.Add("a.txt", []byte("alpha\n"))
+	b.Add("b.json", []byte("{}\n"))
+	if err := b.Write(path, time.Now()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	got := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		got[header.Name] = string(data)
+	}
+	if len(got) != 2 || got["a.txt"] != "alpha\n" || got["b.json"] != "{}\n" {
+		t.Errorf("bundle = %v", got)
+	}
+}
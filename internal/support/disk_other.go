@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package support
+
+import "errors"
+
+// DiskSpace isn't available on this platform
+func DiskSpace(path string) (free, total uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
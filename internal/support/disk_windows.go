@@ -0,0 +1,16 @@
+package support
+
+import "golang.org/x/sys/windows"
+
+// DiskSpace returns the bytes available to the user and the size of the
+// filesystem holding path
+func DiskSpace(path string) (free, total uint64, err error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := windows.GetDiskFreeSpaceEx(dir, &free, &total, nil); err != nil {
+		return 0, 0, err
+	}
+	return free, total, nil
+}
@@ -0,0 +1,29 @@
+package support
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// reachableTimeout bounds a reachability check
+const reachableTimeout = 5 * time.Second
+
+// Reachable sends a HEAD request to url, through the proxy the environment
+// configures, and returns how long the answer took. Any HTTP status counts:
+// the check is whether the service can be reached at all.
+func Reachable(ctx context.Context, url string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, reachableTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return time.Since(start), nil
+}
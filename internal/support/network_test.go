@@ -0,0 +1,30 @@
+package support
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReachable(t *testing.T) {
+	// Any answer counts, even an error status
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer server.Close()
+	if _, err := Reachable(context.Background(), server.URL); err != nil {
+		t.Errorf("Reachable() error = %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + listener.Addr().String()
+	listener.Close()
+	if _, err := Reachable(context.Background(), closed); err == nil {
+		t.Error("Reachable() of a closed port succeeded")
+	}
+}
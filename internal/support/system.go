@@ -0,0 +1,29 @@
+package support
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// SystemInfo describes this machine: host, OS, CPUs and, where the kernel
+// exposes them, load and memory
+func SystemInfo(now time.Time) map[string]any {
+	hostname, _ := os.Hostname()
+	info := map[string]any{
+		"time":       now,
+		"hostname":   hostname,
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+		"cpus":       runtime.NumCPU(),
+		"go_version": runtime.Version(),
+	}
+
+	for key, path := range map[string]string{"loadavg": "/proc/loadavg", "meminfo": "/proc/meminfo"} {
+		if data, err := os.ReadFile(path); err == nil {
+			info[key] = strings.TrimSpace(string(data))
+		}
+	}
+	return info
+}
@@ -0,0 +1,309 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// Managers of the venvs ophid can adopt
+const (
+	ManagerPipx       = "pipx"
+	ManagerPyenv      = "pyenv"
+	ManagerVirtualenv = "virtualenv"
+)
+
+// AdoptedFromKey is the metadata key recording the manager a tool was
+// adopted from, and AdoptedPathKey the venv it was in
+const (
+	AdoptedFromKey = "adopted_from"
+	AdoptedPathKey = "adopted_path"
+)
+
+// Adoptable is a Python tool another manager installed into a venv, which
+// ophid can take over
+type Adoptable struct {
+	Name        string   `json:"name"`    // The tool's main package
+	Version     string   `json:"version"` // Installed version of it
+	Spec        string   `json:"spec"`    // What it was installed from: the name, or a URL or path
+	Manager     string   `json:"manager"` // pipx, pyenv or virtualenv
+	Venv        string   `json:"venv"`
+	Python      string   `json:"python,omitempty"` // Version the venv was built with
+	Executables []string `json:"executables"`
+}
+
+// pipxMetadata is the part of a pipx venv's pipx_metadata.json ophid reads
+type pipxMetadata struct {
+	MainPackage struct {
+		Package        string   `json:"package"`
+		PackageOrURL   string   `json:"package_or_url"`
+		PackageVersion string   `json:"package_version"`
+		Apps           []string `json:"apps"`
+		Suffix         string   `json:"suffix"`
+	} `json:"main_package"`
+}
+
+// PipxHome returns where pipx keeps its venvs: PIPX_HOME, else
+// ~/.local/share/pipx of pipx 1.3 and later if it exists, else ~/.local/pipx
+func PipxHome() string {
+	if home := os.Getenv("PIPX_HOME"); home != "" {
+		return home
+	}
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if dir := filepath.Join(userHome, ".local", "share", "pipx"); isDir(filepath.Join(dir, "venvs")) {
+		return dir
+	}
+	return filepath.Join(userHome, ".local", "pipx")
+}
+
+// PyenvRoot returns the root of pyenv: PYENV_ROOT, else ~/.pyenv
+func PyenvRoot() string {
+	if root := os.Getenv("PYENV_ROOT"); root != "" {
+		return root
+	}
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(userHome, ".pyenv")
+}
+
+// DiscoverPipx returns the tools pipx installed under pipxHome. Venvs
+// installed with a suffix, pipx's way of keeping a second version, are
+// skipped: ophid keeps one version of a tool.
+func DiscoverPipx(pipxHome string) ([]Adoptable, error) {
+	entries, err := os.ReadDir(filepath.Join(pipxHome, "venvs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipx venvs: %w", err)
+	}
+	var found []Adoptable
+	for _, e := range entries {
+		venv := filepath.Join(pipxHome, "venvs", e.Name())
+		data, err := os.ReadFile(filepath.Join(venv, "pipx_metadata.json"))
+		if err != nil {
+			continue // Not a pipx venv, or a broken one
+		}
+		var meta pipxMetadata
+		if err := json.Unmarshal(data, &meta); err != nil || meta.MainPackage.Package == "" {
+			slog.Warn("skipping pipx venv with unreadable metadata", "venv", venv, "error", err)
+			continue
+		}
+		main := meta.MainPackage
+		if main.Suffix != "" {
+			slog.Warn("skipping suffixed pipx venv", "venv", venv, "suffix", main.Suffix)
+			continue
+		}
+		a := Adoptable{
+			Name:        main.Package,
+			Version:     main.PackageVersion,
+			Spec:        main.PackageOrURL,
+			Manager:     ManagerPipx,
+			Venv:        venv,
+			Python:      venvConfig(venv, "version"),
+			Executables: main.Apps,
+		}
+		if a.Spec == "" {
+			a.Spec = a.Name
+		}
+		if a.Executables == nil {
+			a.Executables = []string{}
+		}
+		found = append(found, a)
+	}
+	return found, nil
+}
+
+// DiscoverPyenv returns the tools of the pyenv-virtualenv venvs under
+// pyenvRoot whose name is a package installed in them. pyenv's own Python
+// versions, which aren't venvs, are skipped.
+func DiscoverPyenv(pyenvRoot string) ([]Adoptable, error) {
+	entries, err := os.ReadDir(filepath.Join(pyenvRoot, "versions"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pyenv versions: %w", err)
+	}
+	var found []Adoptable
+	for _, e := range entries {
+		venv := filepath.Join(pyenvRoot, "versions", e.Name())
+		if _, err := os.Stat(filepath.Join(venv, "pyvenv.cfg")); err != nil {
+			continue
+		}
+		a, err := InspectVenv(venv, e.Name())
+		if err != nil {
+			slog.Debug("skipping pyenv virtualenv", "venv", venv, "error", err)
+			continue
+		}
+		a.Manager = ManagerPyenv
+		found = append(found, a)
+	}
+	return found, nil
+}
+
+// InspectVenv describes the tool name installed in a standalone venv, from
+// its pyvenv.cfg and the package's dist-info. Its executables are the
+// console and GUI scripts of the package, not those of its dependencies.
+func InspectVenv(venv, name string) (Adoptable, error) {
+	if _, err := os.Stat(filepath.Join(venv, "pyvenv.cfg")); err != nil {
+		return Adoptable{}, errcode.Errorf(errcode.NotFound, "%s is not a venv (no pyvenv.cfg)", venv)
+	}
+	distInfo, version, err := findDistInfo(venv, name)
+	if err != nil {
+		return Adoptable{}, err
+	}
+	return Adoptable{
+		Name:        name,
+		Version:     version,
+		Spec:        name,
+		Manager:     ManagerVirtualenv,
+		Venv:        venv,
+		Python:      venvConfig(venv, "version"),
+		Executables: entryPointScripts(distInfo),
+	}, nil
+}
+
+// findDistInfo returns the .dist-info directory of a package installed in
+// a venv, and the version its name carries
+func findDistInfo(venv, name string) (string, string, error) {
+	want := normalizeProjectName(name)
+	for _, dir := range sitePackagesDirs(venv) {
+		matches, _ := filepath.Glob(filepath.Join(venv, filepath.FromSlash(dir), "*.dist-info"))
+		for _, m := range matches {
+			project, version, ok := strings.Cut(strings.TrimSuffix(filepath.Base(m), ".dist-info"), "-")
+			if ok && normalizeProjectName(project) == want {
+				return m, version, nil
+			}
+		}
+	}
+	return "", "", errcode.Errorf(errcode.NotFound, "%s is not installed in %s", name, venv)
+}
+
+// entryPointScripts returns the console and GUI scripts a package's
+// entry_points.txt declares, which pip wrote into the venv's bin
+func entryPointScripts(distInfo string) []string {
+	scripts := []string{}
+	data, err := os.ReadFile(filepath.Join(distInfo, "entry_points.txt"))
+	if err != nil {
+		return scripts
+	}
+	section := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "["):
+			section = strings.Trim(line, "[]")
+		case section == "console_scripts" || section == "gui_scripts":
+			if script, _, ok := strings.Cut(line, "="); ok {
+				scripts = append(scripts, strings.TrimSpace(script))
+			}
+		}
+	}
+	sort.Strings(scripts)
+	return scripts
+}
+
+// Adopt adds a tool installed by another manager to the manifest, run
+// from the venv it is in. The venv stays where it is and is left behind
+// on uninstall; upgrades go into it, but --fresh ones can't rebuild it.
+// It is scanned and checked against the security policy like an install.
+func (i *Installer) Adopt(a Adoptable, opts InstallOptions) (*Tool, error) {
+	existing, replaced := i.manifest.Tools[a.Name]
+	if replaced && !opts.Force {
+		return nil, errcode.Errorf(errcode.Conflict, "%s is already installed (version %s); use --force to adopt it anyway", a.Name, existing.Version)
+	}
+	if !isDir(a.Venv) {
+		return nil, errcode.Errorf(errcode.NotFound, "venv %s doesn't exist", a.Venv)
+	}
+	source, err := NewSourceDetector().DetectSource(a.Spec, InstallOptions{})
+	if err != nil {
+		source = InstallSource{Type: SourcePyPI, URL: a.Name}
+	}
+	if err := checkSourcePolicy(a.Name, source, opts); err != nil {
+		return nil, err
+	}
+
+	var secInfo SecurityInfo
+	if !opts.SkipScan && source.Type == SourcePyPI && a.Version != "" {
+		ctx := context.Background()
+		var scanErr error
+		secInfo, scanErr = i.scanPackage(ctx, "pypi", a.Name, a.Version)
+		if err := i.checkPyPIRelease(ctx, opts.Policy, a.Name, a.Version, source, &secInfo, scanErr, "adoption"); err != nil {
+			return nil, err
+		}
+	}
+
+	rt := "python3"
+	if a.Python != "" {
+		rt = pythonRuntime + "@" + a.Python
+	}
+	now := time.Now()
+	tool := &Tool{
+		Name:        a.Name,
+		Version:     a.Version,
+		Ecosystem:   "python",
+		Runtime:     rt,
+		InstallPath: a.Venv,
+		Executables: a.Executables,
+		Source:      source,
+		Security:    secInfo,
+		Metadata:    map[string]string{AdoptedFromKey: a.Manager, AdoptedPathKey: a.Venv},
+		InstalledAt: now,
+	}
+	if integrity, err := RecordIntegrity(a.Venv); err != nil {
+		slog.Warn("failed to record integrity", "tool", a.Name, "error", err)
+	} else {
+		tool.Integrity = integrity
+	}
+
+	i.putTool(tool, opts.Prefer)
+	if err := i.writeLock(tool); err != nil {
+		slog.Warn("failed to write lockfile", "tool", a.Name, "error", err)
+	}
+	i.manifest.UpdatedAt = now
+	if err := i.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+	if replaced && existing.InstallPath != a.Venv {
+		// The venv ophid had built for the tool is no use any more
+		if err := i.venvManager.Remove(a.Name); err != nil {
+			slog.Warn("failed to remove the replaced venv", "tool", a.Name, "error", err)
+		}
+	}
+	i.syncShims()
+	ui.Success("%s@%s adopted from %s (%s)", a.Name, a.Version, a.Manager, a.Venv)
+	return tool, nil
+}
+
+// SortAdoptables orders tools by name, then manager
+func SortAdoptables(found []Adoptable) {
+	sort.Slice(found, func(x, y int) bool {
+		if found[x].Name != found[y].Name {
+			return found[x].Name < found[y].Name
+		}
+		return found[x].Manager < found[y].Manager
+	})
+}
+
+// isDir reports whether path is a directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,121 @@
+//go:build unix
+
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// otherVenv writes a venv with pkg installed, whose pip freezes it
+func otherVenv(t *testing.T, venv, pkg, version string, scripts ...string) {
+	t.Helper()
+	distInfo := filepath.Join(venv, "lib", "python3.11", "site-packages", pkg+"-"+version+".dist-info")
+	if err := os.MkdirAll(distInfo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(venv, "bin"), 0755)
+	os.WriteFile(filepath.Join(venv, "pyvenv.cfg"), []byte("home = /usr/bin\nversion = 3.11.7\n"), 0644)
+	os.WriteFile(filepath.Join(venv, "bin", "pip"), []byte("#!/bin/sh\necho '"+pkg+"=="+version+"'\n"), 0755)
+	entryPoints := "[console_scripts]\n"
+	for _, s := range scripts {
+		entryPoints += s + " = " + pkg + ":main\n"
+		os.WriteFile(filepath.Join(venv, "bin", s), []byte("#!"+venv+"/bin/python\n"), 0755)
+	}
+	os.WriteFile(filepath.Join(distInfo, "entry_points.txt"), []byte(entryPoints+"\n[pytest11]\nplugin = x\n"), 0644)
+}
+
+func TestDiscoverPipx(t *testing.T) {
+	pipxHome := t.TempDir()
+	black := filepath.Join(pipxHome, "venvs", "black")
+	otherVenv(t, black, "black", "24.1.0", "black", "blackd")
+	os.WriteFile(filepath.Join(black, "pipx_metadata.json"), []byte(`{"main_package": {
+		"package": "black", "package_or_url": "black", "package_version": "24.1.0",
+		"apps": ["black", "blackd"], "suffix": ""}, "pipx_metadata_version": "0.2"}`), 0644)
+	suffixed := filepath.Join(pipxHome, "venvs", "black@22")
+	os.MkdirAll(suffixed, 0755)
+	os.WriteFile(filepath.Join(suffixed, "pipx_metadata.json"), []byte(`{"main_package": {"package": "black", "suffix": "@22"}}`), 0644)
+	os.MkdirAll(filepath.Join(pipxHome, "venvs", "broken"), 0755)
+
+	found, err := DiscoverPipx(pipxHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("DiscoverPipx() = %+v, want black only", found)
+	}
+	a := found[0]
+	if a.Name != "black" || a.Version != "24.1.0" || a.Manager != ManagerPipx || a.Python != "3.11.7" || !slices.Equal(a.Executables, []string{"black", "blackd"}) {
+		t.Errorf("DiscoverPipx() = %+v", a)
+	}
+
+	if found, err := DiscoverPipx(filepath.Join(pipxHome, "missing")); err != nil || found != nil {
+		t.Errorf("DiscoverPipx() without pipx = %v, %v", found, err)
+	}
+}
+
+func TestInspectVenv(t *testing.T) {
+	venv := filepath.Join(t.TempDir(), "ansible")
+	otherVenv(t, venv, "ansible_core", "2.16.3", "ansible", "ansible-playbook")
+
+	a, err := InspectVenv(venv, "ansible-core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Version != "2.16.3" || !slices.Equal(a.Executables, []string{"ansible", "ansible-playbook"}) {
+		t.Errorf("InspectVenv() = %+v", a)
+	}
+	if _, err := InspectVenv(venv, "ansible"); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("InspectVenv() of a missing package: %v, want not found", err)
+	}
+	if _, err := InspectVenv(t.TempDir(), "ansible"); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("InspectVenv() of a directory that isn't a venv: %v, want not found", err)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	home := t.TempDir()
+	installer, err := NewInstaller(home, NewVenvManager(home, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	venv := filepath.Join(t.TempDir(), "httpie")
+	otherVenv(t, venv, "httpie", "3.2.2", "http", "https")
+	a, err := InspectVenv(venv, "httpie")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adopted, err := installer.Adopt(a, InstallOptions{SkipScan: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adopted.InstallPath != venv || adopted.Runtime != "python@3.11.7" || adopted.Metadata[AdoptedFromKey] != ManagerVirtualenv {
+		t.Errorf("Adopt() = %+v", adopted)
+	}
+	if installer.Rebuildable(adopted) {
+		t.Error("an adopted venv shouldn't be rebuildable")
+	}
+	if _, err := os.Stat(filepath.Join(installer.ShimDir(), "http")); err != nil {
+		t.Errorf("no shim for an adopted executable: %v", err)
+	}
+	if _, err := os.Stat(installer.LockPath("httpie")); err != nil {
+		t.Errorf("no lockfile for an adopted tool: %v", err)
+	}
+
+	if _, err := installer.Adopt(a, InstallOptions{SkipScan: true}); errcode.Of(err) != errcode.Conflict {
+		t.Errorf("adopting twice: %v, want a conflict", err)
+	}
+
+	// Uninstalling leaves the venv to its manager
+	if err := installer.Uninstall("httpie"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(venv, "pyvenv.cfg")); err != nil {
+		t.Errorf("uninstall removed the adopted venv: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package tool
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// BuildPolicy says whether pip may build packages from source, which
+// needs a compiler and headers servers often lack
+type BuildPolicy string
+
+const (
+	BuildPreferBinary BuildPolicy = "prefer-binary" // Wheels, even of an older version, over building (default)
+	BuildOnlyBinary   BuildPolicy = "only-binary"   // Wheels only; never build from source
+	BuildAllowSource  BuildPolicy = "allow-source"  // pip's own choice: the newest version, built if it must
+)
+
+// BuildPolicyKey is the Tool metadata key recording the build policy a
+// tool was installed with, which upgrades keep
+const BuildPolicyKey = "build_policy"
+
+// ParseBuildPolicy parses a build policy name; "" is the default
+func ParseBuildPolicy(s string) (BuildPolicy, error) {
+	switch p := BuildPolicy(s); p {
+	case "":
+		return BuildPreferBinary, nil
+	case BuildPreferBinary, BuildOnlyBinary, BuildAllowSource:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown build policy %s (available: %s, %s, %s)", s, BuildPreferBinary, BuildOnlyBinary, BuildAllowSource)
+}
+
+// PipArgs returns the pip install arguments enforcing the policy
+func (p BuildPolicy) PipArgs() []string {
+	switch p {
+	case BuildOnlyBinary:
+		return []string{"--only-binary", ":all:"}
+	case BuildAllowSource:
+		return nil
+	}
+	return []string{"--prefer-binary"}
+}
+
+// Failures runPip explains; pip prints them for the requirement it gave up on
+var (
+	noMatchingVersion = regexp.MustCompile(`Could not find a version that satisfies the requirement (\S+)`)
+	failedBuild       = regexp.MustCompile(`Failed (?:building wheel for|to build) (\S+)`)
+)
+
+// runPip runs a pip install, showing its output. When it fails for want
+// of a wheel, or building one from source failed, the error says so and
+// for which Python and platform.
+func runPip(cmd *exec.Cmd) error {
+	var output tailBuffer
+	cmd.Stdout = io.MultiWriter(os.Stdout, &output)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+	if err := cmd.Run(); err != nil {
+		return pipError(err, cmd.Args, output.String())
+	}
+	return nil
+}
+
+// pipError explains why the pip install run with args failed
+func pipError(err error, args []string, output string) error {
+	if m := noMatchingVersion.FindStringSubmatch(output); m != nil && slices.Contains(args, "--only-binary") {
+		return errcode.Errorf(errcode.NotFound, "no wheel of %s for %s, and the %s build policy forbids building it from source; allow that with --build-policy %s",
+			m[1], pipTarget(args[0]), BuildOnlyBinary, BuildPreferBinary)
+	}
+	if m := failedBuild.FindStringSubmatch(output); m != nil {
+		return fmt.Errorf("pip install failed: %s has no wheel for %s and building it from source failed, a compiler or headers may be missing; pick a version with wheels, or see which have none with --build-policy %s: %w",
+			strings.TrimSuffix(m[1], ","), pipTarget(args[0]), BuildOnlyBinary, err)
+	}
+	return fmt.Errorf("pip install failed: %w", err)
+}
+
+// pipTarget describes the Python and platform a pip installs for, like
+// "Python 3.12 on linux/amd64"
+func pipTarget(pipPath string) string {
+	target := fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
+	out, err := exec.Command(pipPath, "--version").Output()
+	if err != nil {
+		return target
+	}
+	// pip 24.0 from /path/to/site-packages/pip (python 3.12)
+	version := string(out)
+	if start := strings.LastIndex(version, "(python "); start >= 0 {
+		version = strings.TrimSuffix(strings.TrimSpace(version[start+len("(python "):]), ")")
+		return "Python " + version + " on " + target
+	}
+	return target
+}
+
+// tailBuffer keeps the last 64KB written to it, enough for pip's errors
+type tailBuffer struct {
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	const max = 64 << 10
+	b.data = append(b.data, p...)
+	if len(b.data) > max {
+		b.data = b.data[len(b.data)-max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.data)
+}
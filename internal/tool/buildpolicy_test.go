@@ -0,0 +1,74 @@
+package tool
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func TestParseBuildPolicy(t *testing.T) {
+	tests := map[string][]string{
+		"":              {"--prefer-binary"},
+		"prefer-binary": {"--prefer-binary"},
+		"only-binary":   {"--only-binary", ":all:"},
+		"allow-source":  nil,
+	}
+	for name, want := range tests {
+		policy, err := ParseBuildPolicy(name)
+		if err != nil {
+			t.Fatalf("%q: %v", name, err)
+		}
+		if got := policy.PipArgs(); !slices.Equal(got, want) {
+			t.Errorf("%q: pip args %v, want %v", name, got, want)
+		}
+	}
+	if _, err := ParseBuildPolicy("never"); err == nil {
+		t.Error("accepted an unknown build policy")
+	}
+}
+
+// fakeBuildPip fails like pip does without a wheel under --only-binary,
+// and when building psutil from source
+const fakeBuildPip = `#!/bin/sh
+case "$*" in
+--version) echo "pip 24.0 from /venv/lib/python3.12/site-packages/pip (python 3.12)" ;;
+*--only-binary*) echo "ERROR: Could not find a version that satisfies the requirement psutil (from versions: none)" >&2; exit 1 ;;
+*) echo "  error: command 'gcc' failed: No such file or directory" >&2
+   echo "  ERROR: Failed building wheel for psutil" >&2
+   echo "Failed to build psutil" >&2; exit 1 ;;
+esac
+`
+
+func TestRunPipErrors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake pip is a shell script")
+	}
+	pip := filepath.Join(t.TempDir(), "pip")
+	os.WriteFile(pip, []byte(fakeBuildPip), 0755)
+	target := "Python 3.12 on " + runtime.GOOS + "/" + runtime.GOARCH
+
+	err := runPip(exec.Command(pip, append(append([]string{"install"}, BuildOnlyBinary.PipArgs()...), "psutil")...))
+	if errcode.Of(err) != errcode.NotFound || !strings.Contains(err.Error(), "no wheel of psutil for "+target) {
+		t.Errorf("only-binary error = %v", err)
+	}
+
+	err = runPip(exec.Command(pip, "install", "psutil"))
+	if err == nil || !strings.Contains(err.Error(), "psutil has no wheel for "+target+" and building it from source failed") {
+		t.Errorf("source build error = %v", err)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	var b tailBuffer
+	b.Write([]byte(strings.Repeat("x", 70<<10)))
+	b.Write([]byte("end"))
+	if got := b.String(); len(got) != 64<<10 || !strings.HasSuffix(got, "xend") {
+		t.Errorf("kept %d bytes ending in %q", len(got), got[len(got)-4:])
+	}
+}
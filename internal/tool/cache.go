@@ -0,0 +1,185 @@
+package tool
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/gleicon/ophid/internal/store"
+)
+
+// CacheStat is the disk use of one cache under ~/.ophid/cache
+type CacheStat struct {
+	Name    string // downloads, git, conda, ...; archives for files in cache/ itself
+	Entries int
+	Bytes   int64
+}
+
+// cacheEntry is what pruning removes at once: a download, a git clone, a
+// package directory. Files inside one are never removed on their own,
+// which would leave a clone or package half there.
+type cacheEntry struct {
+	path     string
+	bytes    int64
+	modified time.Time // When its newest file was written
+}
+
+// CacheDir returns the cache directory of an ophid home
+func CacheDir(homeDir string) string {
+	return filepath.Join(homeDir, "cache")
+}
+
+// CacheStats returns the disk use of each cache
+func CacheStats(homeDir string) ([]CacheStat, error) {
+	entries, err := cacheEntries(CacheDir(homeDir))
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*CacheStat)
+	var stats []CacheStat
+	for _, e := range entries {
+		name := cacheName(homeDir, e.path)
+		stat, ok := byName[name]
+		if !ok {
+			stats = append(stats, CacheStat{Name: name})
+			stat = &stats[len(stats)-1]
+			byName[name] = stat
+		}
+		stat.Entries++
+		stat.Bytes += e.bytes
+	}
+	sort.Slice(stats, func(a, b int) bool { return stats[a].Name < stats[b].Name })
+	return stats, nil
+}
+
+// PruneCache removes cache entries last written more than maxAge ago,
+// then the oldest ones until the cache is at most maxSize bytes. Zero
+// disables a limit. Clones installed tools use are kept. It returns how
+// many entries it removed and the bytes freed.
+func PruneCache(homeDir string, maxSize int64, maxAge time.Duration) (int, int64, error) {
+	entries, err := cacheEntries(CacheDir(homeDir))
+	if err != nil {
+		return 0, 0, err
+	}
+	manifest, err := LoadManifest(homeDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	referenced := referencedClones(homeDir, manifest)
+	entries = slices.DeleteFunc(entries, func(e cacheEntry) bool { return referenced[e.path] })
+	sort.Slice(entries, func(a, b int) bool { return entries[a].modified.Before(entries[b].modified) })
+
+	var total int64
+	for _, e := range entries {
+		total += e.bytes
+	}
+	removed, freed := 0, int64(0)
+	for _, e := range entries {
+		expired := maxAge > 0 && time.Since(e.modified) > maxAge
+		oversize := maxSize > 0 && total > maxSize
+		if !expired && !oversize {
+			continue
+		}
+		if err := os.RemoveAll(e.path); err != nil {
+			return removed, freed, fmt.Errorf("failed to remove %s: %w", e.path, err)
+		}
+		removed++
+		freed += e.bytes
+		total -= e.bytes
+	}
+	return removed, freed, nil
+}
+
+// cacheEntries lists the entries of each cache directory, and the files
+// directly in the cache directory. A missing cache has none.
+func cacheEntries(dir string) ([]cacheEntry, error) {
+	top, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	var entries []cacheEntry
+	for _, t := range top {
+		path := filepath.Join(dir, t.Name())
+		if !t.IsDir() {
+			entries = append(entries, measureCacheEntry(path))
+			continue
+		}
+		children, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache: %w", err)
+		}
+		for _, c := range children {
+			entries = append(entries, measureCacheEntry(filepath.Join(path, c.Name())))
+		}
+	}
+	return entries, nil
+}
+
+// measureCacheEntry returns the size and newest modification of a cache
+// entry
+func measureCacheEntry(path string) cacheEntry {
+	e := cacheEntry{path: path}
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		e.bytes += info.Size()
+		if info.ModTime().After(e.modified) {
+			e.modified = info.ModTime()
+		}
+		return nil
+	})
+	return e
+}
+
+// cacheName names the cache an entry belongs to
+func cacheName(homeDir, path string) string {
+	rel, err := filepath.Rel(CacheDir(homeDir), path)
+	if err != nil || filepath.Dir(rel) == "." {
+		return "archives"
+	}
+	return filepath.Dir(rel)
+}
+
+// shareFiles links a tool's files to the copies other tools and runtimes
+// already have of them in the store, so that shared heavy dependencies
+// take disk space once
+func (i *Installer) shareFiles(t *Tool) {
+	stats, err := store.NewStore(i.homeDir).Share(t.InstallPath)
+	if err != nil {
+		slog.Warn("failed to share files with the store", "tool", t.Name, "error", err)
+		return
+	}
+	if stats.Files > 0 {
+		slog.Info("shared files with the store", "tool", t.Name, "files", stats.Files, "bytes", stats.Bytes)
+	}
+	// A reinstall or upgrade replaced files that may have been the last
+	// links to stored ones
+	i.pruneStore()
+}
+
+// pruneStore removes the stored files nothing links to any more, such as
+// those of an uninstalled tool, so that its disk space is freed
+func (i *Installer) pruneStore() {
+	if removed, freed, err := store.NewStore(i.homeDir).Prune(); err != nil {
+		slog.Warn("failed to prune the store", "error", err)
+	} else if removed > 0 {
+		slog.Debug("pruned store", "files", removed, "bytes", freed)
+	}
+}
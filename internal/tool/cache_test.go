@@ -0,0 +1,67 @@
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneCache(t *testing.T) {
+	home := t.TempDir()
+	cache := CacheDir(home)
+	now := time.Now()
+	write := func(path string, size int, age time.Duration) {
+		path = filepath.Join(cache, path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, make([]byte, size), 0644)
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+	}
+	write("downloads/old.tar.gz", 100, 60*24*time.Hour)
+	write("downloads/new.tar.gz", 100, time.Hour)
+	// A clone is one entry, as old as its newest file
+	write("git/repo/.git/HEAD", 50, 90*24*time.Hour)
+	write("git/repo/setup.py", 50, 2*time.Hour)
+	write("aws-cli.zip", 300, 3*time.Hour)
+
+	stats, err := CacheStats(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CacheStat{{"archives", 1, 300}, {"downloads", 2, 200}, {"git", 1, 100}}
+	if len(stats) != len(want) {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("stats[%d] = %+v, want %+v", i, stats[i], want[i])
+		}
+	}
+
+	removed, freed, err := PruneCache(home, 0, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || freed != 100 {
+		t.Errorf("pruned %d entries (%d bytes), want only the old download", removed, freed)
+	}
+	if _, err := os.Stat(filepath.Join(cache, "git", "repo", ".git", "HEAD")); err != nil {
+		t.Error("removed a file of a clone that was used recently")
+	}
+
+	// Oldest first until the cache fits
+	removed, freed, err = PruneCache(home, 150, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 || freed != 400 {
+		t.Errorf("pruned %d entries (%d bytes), want the archive and the clone", removed, freed)
+	}
+	if _, err := os.Stat(filepath.Join(cache, "downloads", "new.tar.gz")); err != nil {
+		t.Error("removed the newest download")
+	}
+
+	if _, _, err := PruneCache(t.TempDir(), 1, 0); err != nil {
+		t.Errorf("pruning a missing cache: %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// CondaDefaultChannel is the channel conda packages come from unless the
+// spec names another, as in conda:bioconda::samtools
+const CondaDefaultChannel = "conda-forge"
+
+// micromambaURL is where micromamba builds are downloaded from; tests
+// point it elsewhere
+var micromambaURL = "https://github.com/mamba-org/micromamba-releases/releases/latest/download/"
+
+// CondaInstaller installs tools whose dependencies are compiled stacks pip
+// struggles with (gdal, netcdf) from conda packages, each into an
+// environment of its own, with micromamba. The tool's bin directory holds
+// wrappers running its executables in that environment.
+type CondaInstaller struct {
+	homeDir string
+}
+
+// NewCondaInstaller creates a new conda installer
+func NewCondaInstaller(homeDir string) *CondaInstaller {
+	return &CondaInstaller{homeDir: homeDir}
+}
+
+// Root returns the install directory of a conda tool; its environment is
+// in env/ and the wrappers of its executables in bin/
+func (ci *CondaInstaller) Root(name string) string {
+	return filepath.Join(ci.homeDir, "tools", name, "conda")
+}
+
+// rootPrefix is micromamba's root prefix, holding the package cache all
+// environments share
+func (ci *CondaInstaller) rootPrefix() string {
+	return filepath.Join(ci.homeDir, "cache", "conda")
+}
+
+// managedMicromamba is where FindMicromamba bootstraps micromamba
+func (ci *CondaInstaller) managedMicromamba() string {
+	exe := "micromamba"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	return filepath.Join(ci.homeDir, "runtimes", "micromamba", "bin", exe)
+}
+
+// FindMicromamba returns the micromamba to install with: the one ophid
+// bootstrapped, or else micromamba from PATH. When there is neither, it
+// downloads micromamba into ~/.ophid/runtimes/micromamba.
+func (ci *CondaInstaller) FindMicromamba(ctx context.Context) (string, error) {
+	managed := ci.managedMicromamba()
+	if isExecutable(managed) {
+		return managed, nil
+	}
+	if mamba, err := exec.LookPath("micromamba"); err == nil {
+		return mamba, nil
+	}
+	if err := ci.Bootstrap(ctx); err != nil {
+		return "", err
+	}
+	return managed, nil
+}
+
+// Bootstrap downloads the micromamba build for this platform, checked
+// against its published checksum
+func (ci *CondaInstaller) Bootstrap(ctx context.Context) error {
+	platform := condaPlatform(runtime.GOOS, runtime.GOARCH)
+	if platform == "" {
+		return fmt.Errorf("micromamba has no build for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	asset := "micromamba-" + platform
+
+	dir, err := os.MkdirTemp("", "ophid-micromamba-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	download, sums := filepath.Join(dir, asset), filepath.Join(dir, asset+".sha256")
+	if err := downloadFile(ctx, micromambaURL+asset, download); err != nil {
+		return err
+	}
+	if err := downloadFile(ctx, micromambaURL+asset+".sha256", sums); err != nil {
+		return err
+	}
+	expected, err := checksumFor(sums, asset)
+	if err != nil {
+		return err
+	}
+	actual, err := hashFile(download)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(expected, actual) {
+		return errcode.Errorf(errcode.Verification, "checksum mismatch for %s: expected %s, got %s", asset, expected, actual)
+	}
+
+	path := ci.managedMicromamba()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.Open(download)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", download, err)
+	}
+	defer f.Close()
+	if err := writeExecutable(path, f); err != nil {
+		return fmt.Errorf("failed to install micromamba: %w", err)
+	}
+	ui.OK("micromamba installed in %s", filepath.Dir(path))
+	return nil
+}
+
+// Create creates the environment prefix with a package from channel, at
+// version or the newest if version is ""
+func (ci *CondaInstaller) Create(ctx context.Context, mamba, prefix, channel, name, version string) error {
+	spec := name
+	if version != "" {
+		spec += "==" + version
+	}
+	args := []string{"create", "--yes", "--root-prefix", ci.rootPrefix(), "--prefix", prefix,
+		"--override-channels", "--channel", channel, spec}
+	ui.Printf("Running: micromamba %s\n", strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, mamba, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("micromamba create failed: %w", err)
+	}
+	return nil
+}
+
+// condaRecord is the part of a package's conda-meta record ophid reads
+type condaRecord struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version"`
+	Files   []string `json:"files"`
+}
+
+// PackageRecord returns the conda-meta record of a package installed in
+// the environment prefix
+func (ci *CondaInstaller) PackageRecord(prefix, name string) (*condaRecord, error) {
+	paths, _ := filepath.Glob(filepath.Join(prefix, "conda-meta", name+"-*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		var record condaRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		// The glob also matches packages whose name only starts with name
+		if record.Name == name {
+			return &record, nil
+		}
+	}
+	return nil, errcode.Errorf(errcode.NotFound, "%s isn't installed in %s", name, prefix)
+}
+
+// Executables returns the executables a package itself installed, leaving
+// out those of its dependencies, like python
+func (r *condaRecord) Executables() []string {
+	dirs := []string{"bin/"}
+	if runtime.GOOS == "windows" {
+		dirs = []string{"Library/bin/", "Scripts/"}
+	}
+	var executables []string
+	for _, file := range r.Files {
+		for _, dir := range dirs {
+			if name, ok := strings.CutPrefix(file, dir); ok && !strings.Contains(name, "/") {
+				if runtime.GOOS == "windows" && !strings.EqualFold(filepath.Ext(name), ".exe") {
+					continue
+				}
+				executables = append(executables, name)
+			}
+		}
+	}
+	sort.Strings(executables)
+	return executables
+}
+
+// WriteWrappers writes a wrapper into binDir for each executable, running
+// it with micromamba in the environment prefix so its activation scripts
+// (GDAL_DATA, PROJ_DATA) apply, and returns their names
+func (ci *CondaInstaller) WriteWrappers(mamba, prefix, binDir string, executables []string) ([]string, error) {
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", binDir, err)
+	}
+	var names []string
+	for _, exe := range executables {
+		name := strings.TrimSuffix(exe, filepath.Ext(exe))
+		path, content := filepath.Join(binDir, exe), ""
+		if runtime.GOOS == "windows" {
+			path = filepath.Join(binDir, name+".cmd")
+			content = fmt.Sprintf("@echo off\r\n\"%s\" run --root-prefix \"%s\" --prefix \"%s\" %s %%*\r\n", mamba, ci.rootPrefix(), prefix, exe)
+		} else {
+			content = fmt.Sprintf("#!/bin/sh\nexec %s run --root-prefix %s --prefix %s %s \"$@\"\n",
+				shellQuote(mamba), shellQuote(ci.rootPrefix()), shellQuote(prefix), shellQuote(exe))
+		}
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			return nil, fmt.Errorf("failed to write %s wrapper: %w", exe, err)
+		}
+		names = append(names, filepath.Base(path))
+	}
+	return names, nil
+}
+
+// installFromConda installs a conda package into an environment of its own
+func (i *Installer) installFromConda(ctx context.Context, source InstallSource, opts InstallOptions) (*Tool, error) {
+	name := source.URL
+	channel := source.Metadata["channel"]
+	if channel == "" {
+		channel = CondaDefaultChannel
+	}
+	version := opts.Version
+	if version == "latest" {
+		version = ""
+	}
+	if !opts.SkipScan {
+		// OSV has no conda ecosystem to look the package up in
+		ui.Warn("Vulnerability scanning isn't available for conda packages; %s is installed unscanned", name)
+	}
+
+	mamba, err := i.condaInstaller.FindMicromamba(ctx)
+	if err != nil {
+		return nil, err
+	}
+	root := i.condaInstaller.Root(name)
+	if err := os.RemoveAll(root); err != nil {
+		return nil, fmt.Errorf("failed to remove old install: %w", err)
+	}
+	prefix := filepath.Join(root, "env")
+	if err := i.condaInstaller.Create(ctx, mamba, prefix, channel, name, version); err != nil {
+		os.RemoveAll(root)
+		return nil, err
+	}
+
+	record, err := i.condaInstaller.PackageRecord(prefix, name)
+	if err != nil {
+		os.RemoveAll(root)
+		return nil, err
+	}
+	executables, err := i.condaInstaller.WriteWrappers(mamba, prefix, i.venvManager.GetBinDir(root), record.Executables())
+	if err != nil || len(executables) == 0 {
+		os.RemoveAll(root)
+		if err == nil {
+			err = fmt.Errorf("%s installed no executables", name)
+		}
+		return nil, err
+	}
+
+	source.Metadata = map[string]string{"channel": channel}
+	tool := &Tool{
+		Name:        name,
+		Version:     record.Version,
+		Ecosystem:   "conda",
+		Runtime:     "micromamba",
+		InstallPath: root,
+		Executables: executables,
+		Source:      source,
+		Metadata:    map[string]string{"micromamba": mamba},
+		InstalledAt: time.Now(),
+	}
+	i.putTool(tool, opts.Prefer)
+	i.manifest.UpdatedAt = time.Now()
+	if err := i.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	ui.Println()
+	ui.Success("%s@%s installed successfully from %s", name, record.Version, channel)
+	ui.Printf("  Executables: %s\n", strings.Join(executables, ", "))
+	return tool, nil
+}
+
+// condaPlatform returns conda's name of a platform, or "" when micromamba
+// has no build for it
+func condaPlatform(goos, goarch string) string {
+	platforms := map[string]string{
+		"linux/amd64":   "linux-64",
+		"linux/arm64":   "linux-aarch64",
+		"linux/ppc64le": "linux-ppc64le",
+		"darwin/amd64":  "osx-64",
+		"darwin/arm64":  "osx-arm64",
+		"windows/amd64": "win-64",
+	}
+	return platforms[goos+"/"+goarch]
+}
@@ -0,0 +1,150 @@
+//go:build unix
+
+package tool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// fakeMicromamba stands in for micromamba: create installs the requested
+// package, which ships gdalinfo and ogr2ogr, next to a python dependency;
+// run prints the prefix and command it ran
+const fakeMicromamba = `#!/bin/sh
+cmd=$1; shift
+while [ $# -gt 1 ]; do
+	case "$1" in
+	--prefix) prefix=$2; shift ;;
+	--root-prefix|--channel) shift ;;
+	--yes|--override-channels) ;;
+	*) break ;;
+	esac
+	shift
+done
+if [ "$cmd" = run ]; then
+	echo "$prefix $*"
+	exit 0
+fi
+name=${1%%==*}
+mkdir -p "$prefix/conda-meta"
+echo '{"name": "python", "version": "3.12.0", "files": ["bin/python3"]}' > "$prefix/conda-meta/python-3.12.0-h0.json"
+echo '{"name": "'$name'-data", "version": "1.0", "files": ["bin/extra"]}' > "$prefix/conda-meta/$name-data-1.0-h0.json"
+echo '{"name": "'$name'", "version": "3.9.1", "files": ["bin/gdalinfo", "bin/ogr2ogr", "share/gdal/header.dxf"]}' > "$prefix/conda-meta/$name-3.9.1-h0.json"
+`
+
+func TestInstallFromConda(t *testing.T) {
+	home := t.TempDir()
+	mambaBin := filepath.Join(home, "runtimes", "micromamba", "bin")
+	os.MkdirAll(mambaBin, 0755)
+	os.WriteFile(filepath.Join(mambaBin, "micromamba"), []byte(fakeMicromamba), 0755)
+	installer, err := NewInstaller(home, NewVenvManager(home, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tool, err := installer.Install("conda:gdal", InstallOptions{SkipScan: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(home, "tools", "gdal", "conda")
+	if tool.Version != "3.9.1" || tool.Ecosystem != "conda" || tool.InstallPath != root {
+		t.Errorf("tool = %s@%s (%s) in %s", tool.Name, tool.Version, tool.Ecosystem, tool.InstallPath)
+	}
+	if got := strings.Join(tool.Executables, ","); got != "gdalinfo,ogr2ogr" {
+		t.Errorf("executables = %s, want only the package's own", got)
+	}
+	if tool.Source.Metadata["channel"] != CondaDefaultChannel {
+		t.Errorf("channel = %q", tool.Source.Metadata["channel"])
+	}
+
+	// The wrapper runs the executable in the tool's environment
+	out, err := exec.Command(filepath.Join(root, "bin", "gdalinfo"), "--version").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(out)), filepath.Join(root, "env")+" gdalinfo --version"; got != want {
+		t.Errorf("wrapper ran %q, want %q", got, want)
+	}
+
+	if err := installer.Uninstall("gdal"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Error("uninstall left the conda environment behind")
+	}
+}
+
+func TestBootstrapMicromamba(t *testing.T) {
+	platform := condaPlatform(runtime.GOOS, runtime.GOARCH)
+	if platform == "" {
+		t.Skip("micromamba has no build for this platform")
+	}
+	body := []byte("#!/bin/sh\necho micromamba\n")
+	sum := sha256.Sum256(body)
+	checksum := hex.EncodeToString(sum[:])
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/micromamba-" + platform:
+			w.Write(body)
+		case "/micromamba-" + platform + ".sha256":
+			fmt.Fprintln(w, checksum)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	old := micromambaURL
+	micromambaURL = srv.URL + "/"
+	defer func() { micromambaURL = old }()
+
+	ci := NewCondaInstaller(t.TempDir())
+	checksum = "0000"
+	if err := ci.Bootstrap(context.Background()); errcode.Of(err) != errcode.Verification {
+		t.Fatalf("err = %v, want a verification error", err)
+	}
+	if _, err := os.Stat(ci.managedMicromamba()); !os.IsNotExist(err) {
+		t.Error("a download that failed verification was installed")
+	}
+
+	checksum = hex.EncodeToString(sum[:])
+	if err := ci.Bootstrap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !isExecutable(ci.managedMicromamba()) {
+		t.Error("micromamba wasn't installed as an executable")
+	}
+}
+
+func TestDetectCondaSource(t *testing.T) {
+	sd := NewSourceDetector()
+	tests := map[string]string{
+		"conda:gdal":                            "conda-forge/gdal",
+		"conda:bioconda::samtools":              "bioconda/samtools",
+		"https://anaconda.org/conda-forge/gdal": "conda-forge/gdal",
+		"anaconda.org/bioconda/samtools/files":  "bioconda/samtools",
+	}
+	for spec, want := range tests {
+		source, err := sd.DetectSource(spec, InstallOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if got := source.Metadata["channel"] + "/" + source.URL; source.Type != SourceConda || got != want {
+			t.Errorf("%s: got %s %s, want conda %s", spec, source.Type, got, want)
+		}
+	}
+	if source, _ := sd.DetectSource("conda:../evil", InstallOptions{}); source.Type == SourceConda {
+		t.Error("accepted a package name with a path in it")
+	}
+}
@@ -0,0 +1,133 @@
+package tool
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// NamespaceSeparator separates tool and executable in a namespaced
+// executable name, e.g. "httpie:http"
+const NamespaceSeparator = ":"
+
+// providersOf returns the installed tools that provide an executable, sorted
+func (i *Installer) providersOf(executable string) []string {
+	var names []string
+	for name, t := range i.manifest.Tools {
+		if slices.Contains(t.Executables, executable) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// claimExecutables records who runs by the bare name for the executables a
+// newly installed tool shares with other tools. Tools that already provide
+// a name keep it unless prefer is set.
+func (i *Installer) claimExecutables(tool *Tool, prefer bool) {
+	if i.manifest.ExecutableOwners == nil {
+		i.manifest.ExecutableOwners = make(map[string]string)
+	}
+
+	for _, exe := range tool.Executables {
+		providers := i.providersOf(exe)
+		others := slices.DeleteFunc(slices.Clone(providers), func(name string) bool { return name == tool.Name })
+		if len(others) == 0 {
+			continue
+		}
+
+		previous, recorded := i.manifest.ExecutableOwners[exe]
+		owner := previous
+		switch {
+		case prefer:
+			owner = tool.Name
+		case !recorded || !slices.Contains(providers, previous):
+			owner = others[0]
+		}
+		i.manifest.ExecutableOwners[exe] = owner
+		if recorded && owner == previous {
+			continue
+		}
+
+		if owner == tool.Name {
+			ui.Warn("%s is also provided by %s; %s now runs this one (run the others as <tool>%s%s)",
+				exe, strings.Join(others, ", "), exe, NamespaceSeparator, exe)
+		} else {
+			ui.Warn("%s is also provided by %s, which keeps it; run this one as %s%s%s (or reinstall with --prefer)",
+				exe, owner, tool.Name, NamespaceSeparator, exe)
+		}
+	}
+
+	i.resolveOwners()
+}
+
+// resolveOwners drops owners of executables no longer contested and hands
+// names whose owner is gone to the first remaining provider
+func (i *Installer) resolveOwners() {
+	for exe, owner := range i.manifest.ExecutableOwners {
+		providers := i.providersOf(exe)
+		switch {
+		case len(providers) < 2:
+			delete(i.manifest.ExecutableOwners, exe)
+		case !slices.Contains(providers, owner):
+			i.manifest.ExecutableOwners[exe] = providers[0]
+		}
+	}
+}
+
+// SetExecutableOwner makes a tool's copy of a shared executable run by the
+// bare name
+func (i *Installer) SetExecutableOwner(executable, toolName string) error {
+	providers := i.providersOf(executable)
+	if !slices.Contains(providers, toolName) {
+		return errcode.Errorf(errcode.NotFound, "tool %s doesn't provide %s", toolName, executable)
+	}
+	if len(providers) < 2 {
+		return nil // Nothing to resolve
+	}
+
+	if i.manifest.ExecutableOwners == nil {
+		i.manifest.ExecutableOwners = make(map[string]string)
+	}
+	i.manifest.ExecutableOwners[executable] = toolName
+	i.manifest.UpdatedAt = time.Now()
+	if err := i.saveManifest(); err != nil {
+		return err
+	}
+	i.syncShims()
+	return nil
+}
+
+// Resolve finds the tool and executable for a name given to `ophid run`:
+// a namespaced <tool>:<executable>, a shared executable's recorded owner, a
+// tool name, or an executable of an installed tool
+func (i *Installer) Resolve(name string) (*Tool, string, error) {
+	if toolName, exe, ok := strings.Cut(name, NamespaceSeparator); ok {
+		t, exists := i.manifest.Tools[toolName]
+		if !exists {
+			return nil, "", errcode.Errorf(errcode.NotFound, "tool %s is not installed", toolName)
+		}
+		if !slices.Contains(t.Executables, exe) {
+			return nil, "", errcode.Errorf(errcode.NotFound, "tool %s doesn't provide %s", toolName, exe)
+		}
+		return t, exe, nil
+	}
+
+	if owner, ok := i.manifest.ExecutableOwners[name]; ok {
+		if t, exists := i.manifest.Tools[owner]; exists {
+			return t, name, nil
+		}
+	}
+	if t, exists := i.manifest.Tools[name]; exists {
+		return t, name, nil
+	}
+	if providers := i.providersOf(name); len(providers) > 0 {
+		return i.manifest.Tools[providers[0]], name, nil // Shared without a recorded owner: the first one
+	}
+	return nil, "", errcode.Errorf(errcode.NotFound, "tool %s is not installed", name)
+}
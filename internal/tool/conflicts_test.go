@@ -0,0 +1,79 @@
+package tool
+
+import "testing"
+
+func TestExecutableConflicts(t *testing.T) {
+	tmpDir := t.TempDir()
+	installer, err := NewInstaller(tmpDir, NewVenvManager(tmpDir, "/usr/bin/python3"))
+	if err != nil {
+		t.Fatalf("NewInstaller() error = %v", err)
+	}
+
+	resolve := func(name string) string {
+		t.Helper()
+		tool, exe, err := installer.Resolve(name)
+		if err != nil {
+			return "error"
+		}
+		return tool.Name + ":" + exe
+	}
+
+	installer.putTool(&Tool{Name: "httpie", Executables: []string{"http", "https"}}, false)
+	installer.putTool(&Tool{Name: "jmespath", Executables: []string{"jp"}}, false)
+	if len(installer.manifest.ExecutableOwners) != 0 {
+		t.Errorf("owners = %v, want none without conflicts", installer.manifest.ExecutableOwners)
+	}
+	if got := resolve("http"); got != "httpie:http" {
+		t.Errorf("Resolve(http) = %s", got)
+	}
+
+	// The first tool keeps a shared name; the new one is namespaced
+	installer.putTool(&Tool{Name: "xh", Executables: []string{"http", "xh"}}, false)
+	if owner := installer.manifest.ExecutableOwners["http"]; owner != "httpie" {
+		t.Errorf("http owner = %q, want httpie", owner)
+	}
+	if got := resolve("http"); got != "httpie:http" {
+		t.Errorf("Resolve(http) = %s", got)
+	}
+	if got := resolve("xh:http"); got != "xh:http" {
+		t.Errorf("Resolve(xh:http) = %s", got)
+	}
+	if got := resolve("xh:jp"); got != "error" {
+		t.Errorf("Resolve(xh:jp) = %s, want an error", got)
+	}
+
+	// --prefer takes it, and a reinstall without it keeps the choice
+	installer.putTool(&Tool{Name: "xh", Executables: []string{"http", "xh"}}, true)
+	installer.putTool(&Tool{Name: "xh", Executables: []string{"http", "xh"}}, false)
+	if got := resolve("http"); got != "xh:http" {
+		t.Errorf("after --prefer: Resolve(http) = %s", got)
+	}
+
+	for _, p := range installer.Which("http", "") {
+		want := map[string]string{"httpie": "httpie:http", "xh": "http"}[p.Tool]
+		if p.RunAs != want {
+			t.Errorf("%s runs as %q, want %q", p.Tool, p.RunAs, want)
+		}
+	}
+
+	if err := installer.SetExecutableOwner("http", "jmespath"); err == nil {
+		t.Error("SetExecutableOwner should fail for a tool without the executable")
+	}
+	if err := installer.SetExecutableOwner("http", "httpie"); err != nil {
+		t.Fatalf("SetExecutableOwner() error = %v", err)
+	}
+	if got := resolve("http"); got != "httpie:http" {
+		t.Errorf("after SetExecutableOwner: Resolve(http) = %s", got)
+	}
+
+	// Uninstalling one side resolves the conflict
+	if err := installer.Uninstall("httpie"); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if len(installer.manifest.ExecutableOwners) != 0 {
+		t.Errorf("owners = %v, want none after uninstall", installer.manifest.ExecutableOwners)
+	}
+	if got := resolve("http"); got != "xh:http" {
+		t.Errorf("after uninstall: Resolve(http) = %s", got)
+	}
+}
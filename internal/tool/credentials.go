@@ -0,0 +1,291 @@
+package tool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gleicon/ophid/internal/sandbox"
+)
+
+// Credentials is the identity a cloud CLI would use, found without calling
+// the cloud
+type Credentials struct {
+	Provider string   // ProviderAWS, ProviderGCP or ProviderAzure
+	Identity string   // Who: a masked access key, role, account or user
+	Source   string   // Where from, e.g. "environment" or "profile default in ~/.aws/credentials"
+	Files    []string // Files it reads credentials from
+	TokenDir string   // Directory it writes refreshed tokens to, if any
+}
+
+// DetectCredentials finds what a provider's CLI would authenticate with,
+// reading the environment through getenv and config files under home. It
+// returns nil when nothing is configured and an error for broken setups.
+func DetectCredentials(provider string, getenv func(string) string, home string) (*Credentials, error) {
+	switch provider {
+	case ProviderAWS:
+		return awsCredentials(getenv, home)
+	case ProviderGCP:
+		return gcpCredentials(getenv, home)
+	case ProviderAzure:
+		return azureCredentials(getenv, home)
+	}
+	return nil, fmt.Errorf("unknown provider %s", provider)
+}
+
+// awsCredentials follows the AWS CLI's order: environment keys, web
+// identity, then the profile in the shared credentials and config files
+func awsCredentials(getenv func(string) string, home string) (*Credentials, error) {
+	keyID, secret := getenv("AWS_ACCESS_KEY_ID"), getenv("AWS_SECRET_ACCESS_KEY")
+	switch {
+	case keyID != "" && secret != "":
+		return &Credentials{Provider: ProviderAWS, Identity: maskKey(keyID), Source: "environment (AWS_ACCESS_KEY_ID)"}, nil
+	case keyID != "" || secret != "":
+		return nil, fmt.Errorf("only one of AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY is set")
+	}
+
+	if tokenFile, role := getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), getenv("AWS_ROLE_ARN"); tokenFile != "" && role != "" {
+		if _, err := os.Stat(tokenFile); err != nil {
+			return nil, fmt.Errorf("AWS_WEB_IDENTITY_TOKEN_FILE: %w", err)
+		}
+		return &Credentials{Provider: ProviderAWS, Identity: role, Source: "web identity (AWS_ROLE_ARN)", Files: []string{tokenFile}}, nil
+	}
+
+	profile := firstNonEmpty(getenv("AWS_PROFILE"), getenv("AWS_DEFAULT_PROFILE"), "default")
+	credsFile := firstNonEmpty(getenv("AWS_SHARED_CREDENTIALS_FILE"), filepath.Join(home, ".aws", "credentials"))
+	configFile := firstNonEmpty(getenv("AWS_CONFIG_FILE"), filepath.Join(home, ".aws", "config"))
+	creds := &Credentials{Provider: ProviderAWS, Files: existing(credsFile, configFile)}
+
+	if section, ok := readINI(credsFile)[profile]; ok && section["aws_access_key_id"] != "" {
+		creds.Identity = maskKey(section["aws_access_key_id"])
+		creds.Source = fmt.Sprintf("profile %s in %s", profile, credsFile)
+		return creds, nil
+	}
+
+	configSection := "profile " + profile
+	if profile == "default" {
+		configSection = "default"
+	}
+	section, ok := readINI(configFile)[configSection]
+	switch {
+	case ok && section["aws_access_key_id"] != "":
+		creds.Identity = maskKey(section["aws_access_key_id"])
+	case ok && section["role_arn"] != "":
+		creds.Identity = section["role_arn"]
+	case ok && (section["sso_session"] != "" || section["sso_start_url"] != ""):
+		creds.Identity = fmt.Sprintf("SSO %s/%s", section["sso_account_id"], section["sso_role_name"])
+		creds.TokenDir = filepath.Join(filepath.Dir(configFile), "sso", "cache")
+	case ok && section["credential_process"] != "":
+		creds.Identity = "credential_process " + strings.Fields(section["credential_process"])[0]
+	case getenv("AWS_PROFILE") != "":
+		return nil, fmt.Errorf("AWS_PROFILE=%s, but no such profile in %s or %s", profile, credsFile, configFile)
+	default:
+		return nil, nil // Instance or container credentials aren't checked
+	}
+	creds.Source = fmt.Sprintf("profile %s in %s", profile, configFile)
+	return creds, nil
+}
+
+// gcpCredentials reads gcloud's active configuration. gcloud ignores
+// GOOGLE_APPLICATION_CREDENTIALS, which only client libraries use.
+func gcpCredentials(getenv func(string) string, home string) (*Credentials, error) {
+	configDir := firstNonEmpty(getenv("CLOUDSDK_CONFIG"), filepath.Join(home, ".config", "gcloud"))
+	creds := &Credentials{Provider: ProviderGCP, TokenDir: configDir}
+
+	if keyFile := getenv("CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE"); keyFile != "" {
+		email, err := serviceAccountEmail(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE: %w", err)
+		}
+		creds.Identity, creds.Source, creds.Files = email, "environment (CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE)", []string{keyFile}
+		return creds, nil
+	}
+
+	active := getenv("CLOUDSDK_ACTIVE_CONFIG_NAME")
+	if active == "" {
+		data, _ := os.ReadFile(filepath.Join(configDir, "active_config"))
+		active = firstNonEmpty(strings.TrimSpace(string(data)), "default")
+	}
+	configFile := filepath.Join(configDir, "configurations", "config_"+active)
+	core := readINI(configFile)["core"]
+	creds.Files = existing(configFile, filepath.Join(configDir, "credentials.db"))
+
+	if account := getenv("CLOUDSDK_CORE_ACCOUNT"); account != "" {
+		creds.Identity, creds.Source = account, "environment (CLOUDSDK_CORE_ACCOUNT)"
+	} else if core["account"] != "" {
+		creds.Identity, creds.Source = core["account"], fmt.Sprintf("configuration %s in %s", active, configDir)
+	} else {
+		return nil, nil
+	}
+	if project := firstNonEmpty(getenv("CLOUDSDK_CORE_PROJECT"), core["project"]); project != "" {
+		creds.Identity += " (project " + project + ")"
+	}
+	return creds, nil
+}
+
+// azureCredentials reads the default subscription az logged in to
+func azureCredentials(getenv func(string) string, home string) (*Credentials, error) {
+	configDir := firstNonEmpty(getenv("AZURE_CONFIG_DIR"), filepath.Join(home, ".azure"))
+	profileFile := filepath.Join(configDir, "azureProfile.json")
+
+	data, err := os.ReadFile(profileFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", profileFile, err)
+	}
+
+	var profile struct {
+		Subscriptions []struct {
+			Name      string `json:"name"`
+			IsDefault bool   `json:"isDefault"`
+			User      struct {
+				Name string `json:"name"`
+				Type string `json:"type"`
+			} `json:"user"`
+		} `json:"subscriptions"`
+	}
+	// az writes the file with a UTF-8 byte order mark
+	if err := json.Unmarshal(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", profileFile, err)
+	}
+
+	for _, sub := range profile.Subscriptions {
+		if sub.IsDefault {
+			return &Credentials{
+				Provider: ProviderAzure,
+				Identity: fmt.Sprintf("%s %s (subscription %s)", sub.User.Type, sub.User.Name, sub.Name),
+				Source:   "az login in " + configDir,
+				Files:    []string{configDir}, // Tokens live next to the profile
+				TokenDir: configDir,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// SandboxProblems reports how a tool's sandbox profile keeps it from its
+// credentials or its cloud
+func SandboxProblems(p *sandbox.Profile, creds *Credentials, home string) []string {
+	if p == nil || !p.Enabled() {
+		return nil
+	}
+
+	var problems []string
+	if p.NoNetwork {
+		problems = append(problems, "the sandbox blocks the network")
+	}
+	if creds == nil {
+		return problems
+	}
+
+	writable := func(path string) bool {
+		for _, w := range p.Writable {
+			if within(w, path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch p.Home {
+	case sandbox.HomeHidden:
+		for _, f := range creds.Files {
+			if within(home, f) && !writable(f) {
+				problems = append(problems, fmt.Sprintf("the sandbox hides %s (home hidden)", f))
+			}
+		}
+	case sandbox.HomeReadOnly:
+		if creds.TokenDir != "" && within(home, creds.TokenDir) && !writable(creds.TokenDir) {
+			problems = append(problems, fmt.Sprintf("the sandbox keeps it from refreshing tokens in %s (home read-only)", creds.TokenDir))
+		}
+	}
+	return problems
+}
+
+// within reports whether path is dir or inside it
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// serviceAccountEmail reads the client_email of a service account key
+func serviceAccountEmail(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if key.ClientEmail == "" {
+		return "", fmt.Errorf("%s has no client_email", path)
+	}
+	return key.ClientEmail, nil
+}
+
+// readINI parses an INI file into sections of keys, or returns nothing
+// if it can't be read
+func readINI(path string) map[string]map[string]string {
+	sections := make(map[string]map[string]string)
+	f, err := os.Open(path)
+	if err != nil {
+		return sections
+	}
+	defer f.Close()
+
+	var current map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[' && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			current = make(map[string]string)
+			sections[name] = current
+		case current != nil:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				current[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return sections
+}
+
+// maskKey shows only the ends of an access key
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + "..." + key[len(key)-4:]
+}
+
+// existing returns the paths that exist
+func existing(paths ...string) []string {
+	var found []string
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+	return found
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// venvCheckTimeout bounds starting a venv's python to check it
+const venvCheckTimeout = 10 * time.Second
+
+// CheckInstall returns what is wrong with the files of an installed tool:
+// a missing install directory, a venv whose python doesn't start or whose
+// pip is gone, or executables the manifest lists that aren't there
+func (i *Installer) CheckInstall(t *Tool) []string {
+	if _, err := os.Stat(t.InstallPath); err != nil {
+		return []string{fmt.Sprintf("install directory %s is missing", t.InstallPath)}
+	}
+
+	var problems []string
+	if i.hasVenv(t) {
+		python := i.venvManager.GetPythonPath(t.InstallPath)
+		ctx, cancel := context.WithTimeout(context.Background(), venvCheckTimeout)
+		defer cancel()
+		if out, err := exec.CommandContext(ctx, python, "-c", "import sys").CombinedOutput(); err != nil {
+			// Typically the runtime the venv was built with was removed
+			problems = append(problems, fmt.Sprintf("venv python doesn't start: %v %s", err, strings.TrimSpace(string(out))))
+		}
+		if _, err := os.Stat(i.venvManager.GetPipPath(t.InstallPath)); err != nil {
+			problems = append(problems, "pip is missing from the venv")
+		}
+	}
+
+	binDir := i.venvManager.GetBinDir(t.InstallPath)
+	var missing []string
+	for _, exe := range t.Executables {
+		found := false
+		for _, name := range executableNames(exe) {
+			if isExecutable(filepath.Join(binDir, name)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, exe)
+		}
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("%d executable(s) missing: %s", len(missing), strings.Join(missing, ", ")))
+	}
+	return problems
+}
+
+// hasVenv reports whether a tool lives in a Python venv of its own
+func (i *Installer) hasVenv(t *Tool) bool {
+	if p, ok := ProfileOf(t); ok && p.Archive {
+		return false
+	}
+	return t.Ecosystem == "python"
+}
+
+// Rebuildable reports whether RebuildVenv can repair a tool: PyPI tools in
+// a venv ophid built
+func (i *Installer) Rebuildable(t *Tool) bool {
+	return i.hasVenv(t) && (t.Source.Type == SourcePyPI || t.Source.Type == "") &&
+		t.InstallPath == filepath.Join(i.homeDir, "tools", t.Name, "venv")
+}
+
+// RebuildVenv replaces a tool's venv with a fresh one holding the same
+// version, with the build policy it was installed with
+func (i *Installer) RebuildVenv(name string) error {
+	t, err := i.Get(name)
+	if err != nil {
+		return err
+	}
+	if !i.Rebuildable(t) {
+		return fmt.Errorf("%s can't be rebuilt; reinstall it with ophid install --force", name)
+	}
+	// A fresh upgrade sets the old venv aside first, so there must be one
+	if err := os.MkdirAll(t.InstallPath, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", t.InstallPath, err)
+	}
+	_, err = i.Upgrade(name, UpgradeOptions{Version: t.Version, Fresh: true, Force: true, SkipScan: true})
+	return err
+}
+
+// ManifestProblems returns where the manifest and ~/.ophid/tools disagree:
+// owners recorded for executables that are no longer shared or whose owner
+// is gone, and tool directories the manifest doesn't list, such as those
+// of interrupted installs
+func (i *Installer) ManifestProblems() []string {
+	var problems []string
+	for _, exe := range slices.Sorted(maps.Keys(i.manifest.ExecutableOwners)) {
+		owner := i.manifest.ExecutableOwners[exe]
+		providers := i.providersOf(exe)
+		switch {
+		case len(providers) < 2:
+			problems = append(problems, fmt.Sprintf("%s has an owner (%s) but isn't shared", exe, owner))
+		case !slices.Contains(providers, owner):
+			problems = append(problems, fmt.Sprintf("%s is owned by %s, which doesn't provide it", exe, owner))
+		}
+	}
+	for _, dir := range i.strayDirs() {
+		problems = append(problems, fmt.Sprintf("%s isn't part of an installed tool", dir))
+	}
+	return problems
+}
+
+// RepairManifest resolves stale executable owners and removes the tool
+// directories the manifest doesn't list
+func (i *Installer) RepairManifest() error {
+	for _, dir := range i.strayDirs() {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+	}
+	i.resolveOwners()
+	i.manifest.UpdatedAt = time.Now()
+	if err := i.saveManifest(); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	i.syncShims()
+	return nil
+}
+
+// strayDirs returns the non-empty directories under ~/.ophid/tools no
+// installed tool uses: those of tools the manifest doesn't list, and old
+// venvs a fresh upgrade left behind
+func (i *Installer) strayDirs() []string {
+	toolsDir := filepath.Join(i.homeDir, "tools")
+	entries, err := os.ReadDir(toolsDir)
+	if err != nil {
+		return nil
+	}
+	var stray []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(toolsDir, entry.Name())
+		t, installed := i.manifest.Tools[entry.Name()]
+		if !installed {
+			if contents, _ := os.ReadDir(dir); len(contents) > 0 {
+				stray = append(stray, dir)
+			}
+			continue
+		}
+		if previous := t.InstallPath + ".previous"; filepath.Dir(previous) == dir {
+			if _, err := os.Stat(previous); err == nil {
+				stray = append(stray, previous)
+			}
+		}
+	}
+	return stray
+}
@@ -0,0 +1,101 @@
+//go:build unix
+
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckInstall(t *testing.T) {
+	tmpDir := t.TempDir()
+	venvMgr := NewVenvManager(tmpDir, "/usr/bin/python3")
+	installer, err := NewInstaller(tmpDir, venvMgr)
+	if err != nil {
+		t.Fatalf("NewInstaller() error = %v", err)
+	}
+
+	venv := filepath.Join(tmpDir, "tools", "ansible", "venv")
+	binDir := venvMgr.GetBinDir(venv)
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, script string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("python", "#!/bin/sh\nexit 0\n")
+	write("pip", "#!/bin/sh\n")
+	write("ansible", "#!/bin/sh\n")
+
+	ansible := &Tool{
+		Name:        "ansible",
+		Ecosystem:   "python",
+		Source:      InstallSource{Type: SourcePyPI},
+		InstallPath: venv,
+		Executables: []string{"ansible", "ansible-playbook"},
+	}
+	problems := installer.CheckInstall(ansible)
+	if len(problems) != 1 || !strings.Contains(problems[0], "ansible-playbook") {
+		t.Errorf("CheckInstall() = %v, want the missing executable", problems)
+	}
+	if !installer.Rebuildable(ansible) {
+		t.Error("a PyPI tool in its venv should be rebuildable")
+	}
+
+	// The runtime the venv was built with is gone
+	write("python", "#!/bin/sh\necho 'No such file or directory' >&2\nexit 127\n")
+	os.Remove(filepath.Join(binDir, "pip"))
+	ansible.Executables = []string{"ansible"}
+	problems = installer.CheckInstall(ansible)
+	if len(problems) != 2 || !strings.Contains(problems[0], "python doesn't start") || !strings.Contains(problems[1], "pip") {
+		t.Errorf("CheckInstall() = %v, want python and pip problems", problems)
+	}
+
+	missing := &Tool{Name: "gone", Ecosystem: "rust", InstallPath: filepath.Join(tmpDir, "tools", "gone", "cargo")}
+	if problems := installer.CheckInstall(missing); len(problems) != 1 || !strings.Contains(problems[0], "missing") {
+		t.Errorf("CheckInstall() = %v, want the missing install directory", problems)
+	}
+	if installer.Rebuildable(missing) {
+		t.Error("a Rust tool isn't rebuildable")
+	}
+}
+
+func TestManifestProblems(t *testing.T) {
+	tmpDir := t.TempDir()
+	installer, err := NewInstaller(tmpDir, NewVenvManager(tmpDir, "/usr/bin/python3"))
+	if err != nil {
+		t.Fatalf("NewInstaller() error = %v", err)
+	}
+
+	venv := filepath.Join(tmpDir, "tools", "httpie", "venv")
+	installer.manifest.Tools["httpie"] = &Tool{Name: "httpie", InstallPath: venv, Executables: []string{"http"}}
+	installer.manifest.ExecutableOwners = map[string]string{"http": "httpie"}
+	for _, dir := range []string{venv, venv + ".previous", filepath.Join(tmpDir, "tools", "orphan", "venv"), filepath.Join(tmpDir, "tools", "uninstalled")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems := installer.ManifestProblems()
+	if len(problems) != 3 {
+		t.Fatalf("ManifestProblems() = %v, want the stale owner, the old venv and the orphan", problems)
+	}
+
+	if err := installer.RepairManifest(); err != nil {
+		t.Fatal(err)
+	}
+	if problems := installer.ManifestProblems(); len(problems) > 0 {
+		t.Errorf("after RepairManifest: %v", problems)
+	}
+	if _, err := os.Stat(venv); err != nil {
+		t.Errorf("RepairManifest removed the venv of an installed tool: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "tools", "orphan")); !os.IsNotExist(err) {
+		t.Error("RepairManifest kept the orphan directory")
+	}
+}
@@ -0,0 +1,130 @@
+package tool
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// staleAge is how long a temp dir or clone is left alone after it was last
+// written, in case an install or extraction running now is using it
+const staleAge = 24 * time.Hour
+
+// GCResult is what garbage collection removed, or would remove
+type GCResult struct {
+	Clones   []string // Clones in ~/.ophid/cache/git no installed tool uses
+	TempDirs []string // Temp dirs and partial downloads interrupted installs left behind
+	Bytes    int64
+}
+
+// GC removes the git clones no installed tool uses any more, and the temp
+// dirs and partial downloads interrupted installs and runtime extractions
+// left behind. With dryRun it only reports them.
+func (i *Installer) GC(dryRun bool) (*GCResult, error) {
+	result := &GCResult{}
+	remove := func(e cacheEntry) error {
+		result.Bytes += e.bytes
+		if dryRun {
+			return nil
+		}
+		if err := os.RemoveAll(e.path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", e.path, err)
+		}
+		return nil
+	}
+
+	referenced := referencedClones(i.homeDir, i.manifest)
+	clones, err := os.ReadDir(gitCacheDir(i.homeDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read git cache: %w", err)
+	}
+	for _, c := range clones {
+		path := filepath.Join(gitCacheDir(i.homeDir), c.Name())
+		if referenced[path] {
+			continue
+		}
+		e := measureCacheEntry(path)
+		if time.Since(e.modified) < staleAge {
+			continue
+		}
+		if err := remove(e); err != nil {
+			return result, err
+		}
+		result.Clones = append(result.Clones, path)
+	}
+
+	for _, path := range tempLeftovers(i.homeDir) {
+		e := measureCacheEntry(path)
+		if info, err := os.Lstat(path); err == nil && info.ModTime().After(e.modified) {
+			e.modified = info.ModTime()
+		}
+		if time.Since(e.modified) < staleAge {
+			continue
+		}
+		if err := remove(e); err != nil {
+			return result, err
+		}
+		result.TempDirs = append(result.TempDirs, path)
+	}
+	return result, nil
+}
+
+// gitCacheDir returns the directory git clones are kept in
+func gitCacheDir(homeDir string) string {
+	return filepath.Join(CacheDir(homeDir), "git")
+}
+
+// referencedClones returns the clones installed tools use: Python tools
+// are installed from theirs in editable mode, and other tools run from
+// theirs. Tools installed before clones were recorded in the manifest
+// used the one named after the repository.
+func referencedClones(homeDir string, manifest *ToolManifest) map[string]bool {
+	referenced := make(map[string]bool)
+	if manifest == nil {
+		return referenced
+	}
+	gitDir := gitCacheDir(homeDir)
+	for _, t := range manifest.Tools {
+		if t.Source.Type != SourceGit && t.Source.Type != SourceGitHub {
+			continue
+		}
+		if clone := t.Source.Metadata["clone"]; clone != "" {
+			referenced[clone] = true
+			continue
+		}
+		name := strings.TrimSuffix(t.Source.URL, ".git")
+		referenced[filepath.Join(gitDir, name[strings.LastIndex(name, "/")+1:])] = true
+	}
+	return referenced
+}
+
+// tempLeftovers lists the temp dirs ophid creates that may outlive an
+// interrupted run: ophid-* in the system temp dir, .extract-* in runtime
+// dirs and partial downloads in the cache
+func tempLeftovers(homeDir string) []string {
+	var paths []string
+	if matches, err := filepath.Glob(filepath.Join(os.TempDir(), "ophid-*")); err == nil {
+		paths = append(paths, matches...)
+	}
+	if matches, err := filepath.Glob(filepath.Join(homeDir, "runtimes", "*", ".extract-*")); err == nil {
+		paths = append(paths, matches...)
+	}
+	filepath.WalkDir(CacheDir(homeDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && path == gitCacheDir(homeDir) {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".part") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths
+}
@@ -2,6 +2,8 @@ package tool
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"os"
@@ -10,7 +12,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gleicon/ophid/internal/errcode"
 	"github.com/gleicon/ophid/internal/security"
+	"github.com/gleicon/ophid/internal/ui"
 )
 
 // GitInstaller handles installation from Git repositories
@@ -18,10 +22,11 @@ type GitInstaller struct {
 	homeDir     string
 	cacheDir    string
 	scanner     *security.Scanner
+	auth        *Auth
 }
 
 // NewGitInstaller creates a new Git installer
-func NewGitInstaller(homeDir string, scanner *security.Scanner) *GitInstaller {
+func NewGitInstaller(homeDir string, scanner *security.Scanner, auth *Auth) *GitInstaller {
 	cacheDir := filepath.Join(homeDir, "cache", "git")
 	os.MkdirAll(cacheDir, 0755)
 
@@ -29,25 +34,40 @@ func NewGitInstaller(homeDir string, scanner *security.Scanner) *GitInstaller {
 		homeDir:  homeDir,
 		cacheDir: cacheDir,
 		scanner:  scanner,
+		auth:     auth,
 	}
 }
 
-// CloneRepository clones a Git repository
+// CloneRepository clones a Git repository, or brings the clone an earlier
+// install of the same repository and ref left up to date with a fetch
 func (gi *GitInstaller) CloneRepository(ctx context.Context, source InstallSource) (string, error) {
-	// Generate a unique directory name for the clone
-	repoName := gi.extractRepoName(source.URL)
-	clonePath := filepath.Join(gi.cacheDir, repoName)
+	clonePath := gi.ClonePath(source)
+
+	// Credentials stored with `ophid auth login`; git asks its own helpers
+	// for the rest
+	var gitArgs, gitEnv []string
+	if gi.auth != nil && strings.HasPrefix(source.URL, "https://") {
+		gitArgs, gitEnv = gitCredentialArgs(gi.auth.stored(hostOf(source.URL)))
+	}
+
+	if gi.isCloneOf(ctx, clonePath, source.URL) {
+		err := gi.fetch(ctx, clonePath, source, gitArgs, gitEnv)
+		if err == nil {
+			return gi.subdirectory(clonePath, source)
+		}
+		slog.Warn("failed to update clone, cloning again", "path", clonePath, "error", err)
+	}
 
 	// Remove existing clone if present
 	if _, err := os.Stat(clonePath); err == nil {
-		fmt.Printf("Removing existing clone at %s\n", clonePath)
+		ui.Printf("Removing existing clone at %s\n", clonePath)
 		if err := os.RemoveAll(clonePath); err != nil {
 			return "", fmt.Errorf("failed to remove existing clone: %w", err)
 		}
 	}
 
 	// Build git clone command
-	args := []string{"clone"}
+	args := append(gitArgs, "clone")
 
 	// Add depth for faster cloning (shallow clone)
 	args = append(args, "--depth", "1")
@@ -62,8 +82,11 @@ func (gi *GitInstaller) CloneRepository(ctx context.Context, source InstallSourc
 	args = append(args, source.URL, clonePath)
 
 	// Execute git clone
-	fmt.Printf("Cloning %s...\n", source.URL)
+	ui.Printf("Cloning %s...\n", RedactURL(source.URL))
 	cmd := exec.CommandContext(ctx, "git", args...)
+	if gitEnv != nil {
+		cmd.Env = append(os.Environ(), gitEnv...)
+	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -73,7 +96,7 @@ func (gi *GitInstaller) CloneRepository(ctx context.Context, source InstallSourc
 
 	// Checkout specific commit if specified
 	if source.Commit != "" {
-		fmt.Printf("Checking out commit %s...\n", source.Commit)
+		ui.Printf("Checking out commit %s...\n", source.Commit)
 		checkoutCmd := exec.CommandContext(ctx, "git", "-C", clonePath, "checkout", source.Commit)
 		checkoutCmd.Stdout = os.Stdout
 		checkoutCmd.Stderr = os.Stderr
@@ -83,15 +106,77 @@ func (gi *GitInstaller) CloneRepository(ctx context.Context, source InstallSourc
 		}
 	}
 
-	// Return subdirectory path if specified
-	installPath := clonePath
-	if source.Subdirectory != "" {
-		installPath = filepath.Join(clonePath, source.Subdirectory)
-		if _, err := os.Stat(installPath); err != nil {
-			return "", fmt.Errorf("subdirectory %s not found in repository", source.Subdirectory)
+	return gi.subdirectory(clonePath, source)
+}
+
+// ClonePath returns where a repository is cloned for a source: one clone
+// per repository and ref, so that tools installed from other refs of the
+// same repository keep theirs
+func (gi *GitInstaller) ClonePath(source InstallSource) string {
+	sum := sha256.Sum256([]byte(RedactURL(source.URL) + "#" + gitRef(source)))
+	return filepath.Join(gi.cacheDir, gi.extractRepoName(source.URL)+"-"+hex.EncodeToString(sum[:4]))
+}
+
+// isCloneOf reports whether dir is a clone of url
+func (gi *GitInstaller) isCloneOf(ctx context.Context, dir, url string) bool {
+	if !gi.fileExists(dir, ".git") {
+		return false
+	}
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "remote", "get-url", "origin").Output()
+	return err == nil && RedactURL(strings.TrimSpace(string(out))) == RedactURL(url)
+}
+
+// fetch updates a clone to the latest commit of the source's ref, dropping
+// what builds left in it
+func (gi *GitInstaller) fetch(ctx context.Context, dir string, source InstallSource, gitArgs, gitEnv []string) error {
+	ref := gitRef(source)
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	ui.Printf("Updating clone of %s...\n", RedactURL(source.URL))
+	steps := []struct {
+		name string
+		args []string
+	}{
+		{"fetch", append(append([]string{}, gitArgs...), "-C", dir, "fetch", "--depth", "1", "origin", ref)},
+		{"checkout", []string{"-C", dir, "checkout", "--force", "--detach", "FETCH_HEAD"}},
+		{"clean", []string{"-C", dir, "clean", "-ffdx"}},
+	}
+	for _, step := range steps {
+		cmd := exec.CommandContext(ctx, "git", step.args...)
+		if gitEnv != nil {
+			cmd.Env = append(os.Environ(), gitEnv...)
 		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s failed: %w: %s", step.name, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// gitRef returns the commit, tag or branch a source asks for, or "" for
+// the default branch
+func gitRef(source InstallSource) string {
+	switch {
+	case source.Commit != "":
+		return source.Commit
+	case source.Tag != "":
+		return source.Tag
 	}
+	return source.Branch
+}
 
+// subdirectory returns the path of the source's subdirectory in a clone,
+// or the clone itself
+func (gi *GitInstaller) subdirectory(clonePath string, source InstallSource) (string, error) {
+	if source.Subdirectory == "" {
+		return clonePath, nil
+	}
+	installPath := filepath.Join(clonePath, source.Subdirectory)
+	if _, err := os.Stat(installPath); err != nil {
+		return "", errcode.Errorf(errcode.NotFound, "subdirectory %s not found in repository", source.Subdirectory)
+	}
 	return installPath, nil
 }
 
@@ -111,24 +196,24 @@ func (gi *GitInstaller) ScanRepository(ctx context.Context, repoPath string) (*S
 		secInfo.SecretsScanDate = time.Now()
 
 		if secretsReport.HasSecrets() {
-			fmt.Printf("[WARN] ALERT: Found %d secret(s)", secretsReport.TotalSecrets)
+			alert := fmt.Sprintf("ALERT: Found %d secret(s)", secretsReport.TotalSecrets)
 			if secretsReport.CriticalSecrets > 0 {
-				fmt.Printf(" (%d critical)", secretsReport.CriticalSecrets)
+				alert += fmt.Sprintf(" (%d critical)", secretsReport.CriticalSecrets)
 			}
-			fmt.Println()
+			ui.Warn("%s", alert)
 
 			// Display first few findings
 			for i, finding := range secretsReport.Findings {
 				if i >= 3 {
-					fmt.Printf("  ... and %d more\n", len(secretsReport.Findings)-3)
+					ui.Printf("  ... and %d more\n", len(secretsReport.Findings)-3)
 					break
 				}
-				fmt.Printf("  - %s in %s:%d\n", finding.Type,
+				ui.Printf("  - %s in %s:%d\n", finding.Type,
 					filepath.Base(finding.File), finding.Line)
 			}
-			fmt.Println()
+			ui.Println()
 		} else {
-			fmt.Println("[OK] No secrets found")
+			ui.OK("No secrets found")
 		}
 	}
 
@@ -150,7 +235,7 @@ func (gi *GitInstaller) ScanRepository(ctx context.Context, repoPath string) (*S
 			foundFile = depFile
 			parsedPackages, err := gi.parseDependencyFile(depFile)
 			if err != nil {
-				fmt.Printf("Warning: failed to parse %s: %v\n", depFile, err)
+				ui.Warn("failed to parse %s: %v", depFile, err)
 				continue
 			}
 			packages = append(packages, parsedPackages...)
@@ -159,11 +244,11 @@ func (gi *GitInstaller) ScanRepository(ctx context.Context, repoPath string) (*S
 	}
 
 	if len(packages) == 0 {
-		fmt.Println("No dependency files found - skipping vulnerability scan")
+		ui.Println("No dependency files found - skipping vulnerability scan")
 		return secInfo, nil
 	}
 
-	fmt.Printf("Scanning %d dependencies from %s...\n", len(packages), filepath.Base(foundFile))
+	ui.Printf("Scanning %d dependencies from %s...\n", len(packages), filepath.Base(foundFile))
 
 	// Scan for vulnerabilities
 	results, err := gi.scanner.ScanPackages(ctx, packages)
@@ -175,16 +260,19 @@ func (gi *GitInstaller) ScanRepository(ctx context.Context, repoPath string) (*S
 	for _, result := range results {
 		secInfo.VulnCount += len(result.Vulnerabilities)
 		secInfo.CriticalVulnCount += result.CriticalCount()
+		secInfo.MaxSeverity = max(secInfo.MaxSeverity, result.MaxSeverity())
 	}
 
 	// Generate SBOM
-	sbom, err := security.GenerateSBOM(packages, "ophid-git")
+	version, _ := gi.GetVersion(ctx, repoPath)
+	ResolveLicenses(ctx, gi.homeDir, packages)
+	sbom, err := security.GenerateSBOM(packages, security.Package{Name: filepath.Base(repoPath), Version: version})
 	if err != nil {
-		fmt.Printf("Warning: SBOM generation failed: %v\n", err)
+		ui.Warn("SBOM generation failed: %v", err)
 	} else {
 		sbomPath := filepath.Join(repoPath, "ophid-sbom.json")
 		if err := security.WriteSBOM(sbom, sbomPath); err != nil {
-			fmt.Printf("Warning: failed to write SBOM: %v\n", err)
+			ui.Warn("failed to write SBOM: %v", err)
 		} else {
 			secInfo.SBOMPath = sbomPath
 		}
@@ -217,6 +305,11 @@ func (gi *GitInstaller) DetectEcosystem(repoPath string) string {
 		return "ruby"
 	}
 
+	// Check for Rust
+	if gi.fileExists(repoPath, "Cargo.toml") {
+		return "rust"
+	}
+
 	return "unknown"
 }
 
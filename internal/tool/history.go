@@ -0,0 +1,165 @@
+package tool
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// History size limits: once the file grows past maxHistoryBytes, only the
+// newest maxHistoryRecords runs are kept
+const (
+	maxHistoryBytes   = 4 << 20
+	maxHistoryRecords = 5000
+)
+
+// RunRecord describes one `ophid run` invocation
+type RunRecord struct {
+	Tool       string        `json:"tool"`
+	ArgsHash   string        `json:"args_hash"` // Hash of the arguments, which may contain secrets
+	NumArgs    int           `json:"num_args"`
+	User       string        `json:"user,omitempty"`
+	StartedAt  time.Time     `json:"started_at"`
+	Duration   time.Duration `json:"duration"`
+	ExitCode   int           `json:"exit_code"`            // -1 when killed by a signal or not started
+	Error      string        `json:"error,omitempty"`      // Why the run failed, if it did not exit normally
+	Background bool          `json:"background,omitempty"` // Started under the supervisor; no duration or exit code
+}
+
+// Failed reports whether the run failed
+func (r RunRecord) Failed() bool {
+	return r.ExitCode != 0 || r.Error != ""
+}
+
+// History is a local append-only log of tool runs
+type History struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewHistory creates a run history stored under homeDir
+func NewHistory(homeDir string) *History {
+	return &History{path: filepath.Join(homeDir, "history", "runs.jsonl")}
+}
+
+// HashArgs returns a short, stable hash of a tool's arguments, so runs with
+// the same arguments can be told apart from others without storing them
+func HashArgs(args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Record appends a run to the history
+func (h *History) Record(record RunRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run record: %w", err)
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	var size int64
+	if info, statErr := f.Stat(); statErr == nil {
+		size = info.Size()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	if size > maxHistoryBytes {
+		return h.trim()
+	}
+	return nil
+}
+
+// List returns the most recent runs, newest first, optionally only those of
+// one tool. limit <= 0 returns all runs.
+func (h *History) List(toolName string, limit int) ([]RunRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	records, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []RunRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		if toolName != "" && records[i].Tool != toolName {
+			continue
+		}
+		result = append(result, records[i])
+		if limit > 0 && len(result) == limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// read loads every record, skipping lines that don't parse (e.g., a line
+// cut short by a crash)
+func (h *History) read() ([]RunRecord, error) {
+	data, err := os.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var records []RunRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var record RunRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// trim drops all but the newest maxHistoryRecords runs
+func (h *History) trim() error {
+	records, err := h.read()
+	if err != nil || len(records) <= maxHistoryRecords {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, record := range records[len(records)-maxHistoryRecords:] {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal run record: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return os.Rename(tmp, h.path)
+}
@@ -0,0 +1,67 @@
+package tool
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistory_RecordAndList(t *testing.T) {
+	history := NewHistory(t.TempDir())
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	runs := []RunRecord{
+		{Tool: "ansible", ArgsHash: HashArgs([]string{"site.yml"}), StartedAt: start, Duration: time.Minute},
+		{Tool: "httpie", ArgsHash: HashArgs(nil), StartedAt: start.Add(time.Hour), ExitCode: 1},
+		{Tool: "ansible", ArgsHash: HashArgs([]string{"site.yml", "--check"}), StartedAt: start.Add(2 * time.Hour), ExitCode: -1, Error: "signal: killed"},
+	}
+	for _, run := range runs {
+		if err := history.Record(run); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	all, err := history.List("", 0)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(all) != 3 || !all[0].StartedAt.Equal(runs[2].StartedAt) {
+		t.Fatalf("List() = %+v, want 3 runs, newest first", all)
+	}
+
+	ansible, err := history.List("ansible", 1)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(ansible) != 1 || ansible[0].Error != "signal: killed" || !ansible[0].Failed() {
+		t.Errorf("List(ansible, 1) = %+v", ansible)
+	}
+	if all[2].Failed() {
+		t.Error("successful run reported as failed")
+	}
+
+	// A truncated line (e.g., from a crash mid-write) is skipped
+	f, err := os.OpenFile(history.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"tool":"ansi`)
+	f.Close()
+	if all, err := history.List("", 0); err != nil || len(all) != 3 {
+		t.Errorf("List() with a truncated line = %d runs, %v", len(all), err)
+	}
+}
+
+func TestHashArgs(t *testing.T) {
+	a := HashArgs([]string{"-u", "admin", "--password", "hunter2"})
+	if a != HashArgs([]string{"-u", "admin", "--password", "hunter2"}) {
+		t.Error("HashArgs() is not stable")
+	}
+	if a == HashArgs([]string{"-u", "admin --password", "hunter2"}) {
+		t.Error("HashArgs() should distinguish argument boundaries")
+	}
+	if strings.Contains(a, "hunter2") || len(a) != 12 {
+		t.Errorf("HashArgs() = %q", a)
+	}
+}
@@ -0,0 +1,163 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// PackageMetadata is what a package registry says about a tool
+type PackageMetadata struct {
+	Registry      string    `json:"registry"` // "pypi", "crates.io" or "rubygems"
+	LatestVersion string    `json:"latest_version,omitempty"`
+	Released      time.Time `json:"released,omitempty"` // When the latest version was published
+	Summary       string    `json:"summary,omitempty"`
+	Homepage      string    `json:"homepage,omitempty"`
+	License       string    `json:"license,omitempty"`
+}
+
+// ToolInfo describes a tool: its manifest entry when it is installed,
+// and what its registry knows about it
+type ToolInfo struct {
+	Name             string           `json:"name"`
+	Installed        *Tool            `json:"installed,omitempty"`
+	Remote           *PackageMetadata `json:"remote,omitempty"`
+	RemoteError      string           `json:"remote_error,omitempty"` // Why Remote is missing
+	UpgradeAvailable bool             `json:"upgrade_available"`
+}
+
+// Info returns what is known about a tool, installed or not. Tools that
+// aren't installed are looked up on PyPI. A registry that can't be
+// reached only leaves Remote empty.
+func (i *Installer) Info(ctx context.Context, name string) (*ToolInfo, error) {
+	info := &ToolInfo{Name: name}
+	source := InstallSource{Type: SourcePyPI}
+	if t, err := i.Get(name); err == nil {
+		info.Installed = t
+		source = t.Source
+	}
+
+	remote, err := registryMetadata(ctx, i.homeDir, name, source)
+	if err != nil {
+		if info.Installed == nil {
+			if errcode.Of(err) == errcode.NotFound {
+				return nil, errcode.Errorf(errcode.NotFound, "%s is neither installed nor on PyPI", name)
+			}
+			return nil, err
+		}
+		info.RemoteError = err.Error()
+		return info, nil
+	}
+	info.Remote = remote
+	if info.Installed != nil && remote.LatestVersion != "" {
+		info.UpgradeAvailable = remote.LatestVersion != info.Installed.Version
+	}
+	return info, nil
+}
+
+// registryMetadata asks the registry a tool was installed from about it
+func registryMetadata(ctx context.Context, homeDir, name string, source InstallSource) (*PackageMetadata, error) {
+	if p, err := LookupProfile(source.Metadata[ProfileMetadataKey]); err == nil && p.Archive {
+		return nil, fmt.Errorf("installed from the vendor's archive, not a registry")
+	}
+	switch source.Type {
+	case SourcePyPI, "":
+		// Only pypi.org has the JSON API; private indexes may not
+		if source.URL != "" {
+			return nil, fmt.Errorf("installed from %s, which ophid doesn't query", source.URL)
+		}
+		return fetchPyPIMetadata(ctx, homeDir, name)
+	case SourceCargo:
+		crate, err := lookupCrate(ctx, source.URL)
+		if err != nil {
+			return nil, err
+		}
+		return &PackageMetadata{Registry: "crates.io", LatestVersion: crate.Version, Homepage: crate.Repository}, nil
+	case SourceGem:
+		version, err := latestGemVersion(ctx, source.URL)
+		if err != nil {
+			return nil, err
+		}
+		return &PackageMetadata{Registry: "rubygems", LatestVersion: version}, nil
+	case SourceNPM:
+		version, err := latestNpmVersion(ctx, source.URL)
+		if err != nil {
+			return nil, err
+		}
+		return &PackageMetadata{Registry: "npm", LatestVersion: version}, nil
+	}
+	return nil, fmt.Errorf("installed from %s, which has no registry to query", source.Type)
+}
+
+// fetchPyPIMetadata reads a project's metadata from the PyPI JSON API,
+// cached under homeDir
+func fetchPyPIMetadata(ctx context.Context, homeDir, name string) (*PackageMetadata, error) {
+	data, err := fetchPyPIJSON(ctx, homeDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Info struct {
+			Version           string            `json:"version"`
+			Summary           string            `json:"summary"`
+			HomePage          string            `json:"home_page"`
+			ProjectURLs       map[string]string `json:"project_urls"`
+			License           string            `json:"license"`
+			LicenseExpression string            `json:"license_expression"`
+			Classifiers       []string          `json:"classifiers"`
+		} `json:"info"`
+		// The files of the latest version
+		URLs []struct {
+			UploadTime time.Time `json:"upload_time_iso_8601"`
+		} `json:"urls"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse PyPI response: %w", err)
+	}
+
+	meta := &PackageMetadata{
+		Registry:      "pypi",
+		LatestVersion: result.Info.Version,
+		Summary:       result.Info.Summary,
+		Homepage:      result.Info.HomePage,
+		License:       pypiLicense(result.Info.LicenseExpression, result.Info.License, result.Info.Classifiers),
+	}
+	if meta.Homepage == "" {
+		for _, key := range []string{"Homepage", "homepage", "Home", "Source", "Repository"} {
+			if url := result.Info.ProjectURLs[key]; url != "" {
+				meta.Homepage = url
+				break
+			}
+		}
+	}
+	for _, file := range result.URLs {
+		if meta.Released.IsZero() || file.UploadTime.Before(meta.Released) {
+			meta.Released = file.UploadTime
+		}
+	}
+	return meta, nil
+}
+
+// pypiLicense picks a project's license from the SPDX expression newer
+// metadata has, the license field when it is a name rather than the full
+// text, or the license classifier
+func pypiLicense(expression, license string, classifiers []string) string {
+	if expression != "" {
+		return expression
+	}
+	if license != "" && len(license) <= 64 && !strings.Contains(license, "\n") {
+		return license
+	}
+	for _, c := range classifiers {
+		if strings.HasPrefix(c, "License :: ") {
+			parts := strings.Split(c, " :: ")
+			return parts[len(parts)-1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package tool
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func TestInfo(t *testing.T) {
+	fakePyPI(t)
+	home := t.TempDir()
+	installer, err := NewInstaller(home, NewVenvManager(home, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installer.manifest.Tools["ansible"] = &Tool{Name: "ansible", Version: "1.0.0", Source: InstallSource{Type: SourcePyPI}}
+	installer.manifest.Tools["internal-cli"] = &Tool{Name: "internal-cli", Version: "2.0", Source: InstallSource{Type: SourcePyPI, URL: "https://pypi.corp.example/simple"}}
+
+	info, err := installer.Info(context.Background(), "ansible")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Installed == nil || info.Remote == nil || info.Remote.LatestVersion != "1.0.7" || !info.UpgradeAvailable {
+		t.Errorf("ansible info = %+v, want it installed with 1.0.7 available", info)
+	}
+
+	// Tools from other indexes aren't looked up on PyPI
+	info, err = installer.Info(context.Background(), "internal-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Remote != nil || info.RemoteError == "" || info.UpgradeAvailable {
+		t.Errorf("internal-cli info = %+v, want no remote metadata", info)
+	}
+
+	info, err = installer.Info(context.Background(), "requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Installed != nil || info.Remote.Summary != "About requests" {
+		t.Errorf("requests info = %+v, want PyPI's metadata only", info)
+	}
+
+	if _, err := installer.Info(context.Background(), "missing"); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("err = %v, want not found", err)
+	}
+}
+
+func TestPyPILicense(t *testing.T) {
+	tests := []struct {
+		expression, license string
+		classifiers         []string
+		want                string
+	}{
+		{"MIT", "ignored", nil, "MIT"},
+		{"", "BSD-3-Clause", nil, "BSD-3-Clause"},
+		{"", "Copyright (c) 2024\nPermission is hereby granted...", []string{"Programming Language :: Python", "License :: OSI Approved :: MIT License"}, "MIT License"},
+		{"", "", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := pypiLicense(tt.expression, tt.license, tt.classifiers); got != tt.want {
+			t.Errorf("pypiLicense(%q, %q) = %q, want %q", tt.expression, tt.license, got, tt.want)
+		}
+	}
+}
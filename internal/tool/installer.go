@@ -2,17 +2,24 @@ package tool
 
 import (
 	"context"
+	"errors"
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"net/http"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/events"
+	"github.com/gleicon/ophid/internal/sandbox"
+	"github.com/gleicon/ophid/internal/secrets"
 	"github.com/gleicon/ophid/internal/security"
+	"github.com/gleicon/ophid/internal/ui"
 )
 
 // Installer handles tool installation
@@ -24,22 +31,31 @@ type Installer struct {
 	sourceDetector *SourceDetector
 	gitInstaller  *GitInstaller
 	localInstaller *LocalInstaller
+	rubyInstaller *RubyInstaller
+	condaInstaller *CondaInstaller
+	npmInstaller  *NpmInstaller
 	scanner       *security.Scanner
+	auth          *Auth
 }
 
 // NewInstaller creates a new tool installer
 func NewInstaller(homeDir string, venvManager *VenvManager) (*Installer, error) {
 	manifestPath := filepath.Join(homeDir, "tools", "manifest.json")
 	scanner := security.NewScanner()
+	auth := NewAuth(secrets.SystemKeychain())
 
 	installer := &Installer{
 		homeDir:       homeDir,
 		venvManager:   venvManager,
 		manifestPath:  manifestPath,
 		sourceDetector: NewSourceDetector(),
-		gitInstaller:  NewGitInstaller(homeDir, scanner),
+		gitInstaller:  NewGitInstaller(homeDir, scanner, auth),
 		localInstaller: NewLocalInstaller(homeDir, scanner),
+		rubyInstaller: NewRubyInstaller(homeDir),
+		condaInstaller: NewCondaInstaller(homeDir),
+		npmInstaller:  NewNpmInstaller(homeDir),
 		scanner:       scanner,
+		auth:          auth,
 	}
 
 	// Load existing manifest
@@ -50,12 +66,60 @@ func NewInstaller(homeDir string, venvManager *VenvManager) (*Installer, error)
 	return installer, nil
 }
 
-// Install installs a tool from any supported source
+// Install installs a tool from any supported source and records how long
+// it took
 func (i *Installer) Install(name string, opts InstallOptions) (*Tool, error) {
-	ctx := context.Background()
+	started := time.Now()
+	events.Emit(events.InstallStarted, name, "installing "+name, nil)
+	tool, err := i.install(context.Background(), name, opts)
+	if err != nil {
+		events.Emit(events.InstallFailed, name, err.Error(), nil)
+		return nil, err
+	}
 
+	tool.InstallDuration = time.Since(started)
+	// Record what was installed, for ophid verify
+	if integrity, err := RecordIntegrity(tool.InstallPath); err != nil {
+		slog.Warn("failed to record integrity", "tool", name, "error", err)
+	} else {
+		tool.Integrity = integrity
+	}
+	// Freeze the venv, for reinstalls with --from-lock and doctor's drift check
+	if err := i.writeLock(tool); err != nil {
+		slog.Warn("failed to write lockfile", "tool", tool.Name, "error", err)
+	}
+	i.shareFiles(tool)
+	// A failed smoke test is recorded, and fails the install
+	smokeErr := i.smokeTest(context.Background(), tool, opts)
+	if err := i.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+	i.syncShims()
+	if smokeErr != nil {
+		events.Emit(events.InstallFailed, tool.Name, smokeErr.Error(), map[string]string{"version": tool.Version})
+		return nil, smokeErr
+	}
+	events.Emit(events.InstallFinished, tool.Name, fmt.Sprintf("installed %s@%s", tool.Name, tool.Version), map[string]string{
+		"version":   tool.Version,
+		"ecosystem": tool.Ecosystem,
+		"source":    string(tool.Source.Type),
+		"duration":  tool.InstallDuration.Round(time.Millisecond).String(),
+	})
+	return tool, nil
+}
+
+// install routes a tool to the installer of its source
+func (i *Installer) install(ctx context.Context, name string, opts InstallOptions) (*Tool, error) {
 	slog.Info("installing tool", "name", name)
 
+	if opts.Profile != "" {
+		profile, err := LookupProfile(opts.Profile)
+		if err != nil {
+			return nil, err
+		}
+		return i.installProfile(ctx, profile, opts)
+	}
+
 	// Detect installation source
 	source, err := i.sourceDetector.DetectSource(name, opts)
 	if err != nil {
@@ -63,6 +127,9 @@ func (i *Installer) Install(name string, opts InstallOptions) (*Tool, error) {
 	}
 
 	slog.Info("detected installation source", "name", name, "source", source.Type)
+	if err := checkSourcePolicy(name, source, opts); err != nil {
+		return nil, err
+	}
 
 	// Route to appropriate installer
 	switch source.Type {
@@ -72,6 +139,14 @@ func (i *Installer) Install(name string, opts InstallOptions) (*Tool, error) {
 		return i.installFromGit(ctx, name, source, opts)
 	case SourceLocal:
 		return i.installFromLocal(ctx, name, source, opts)
+	case SourceCargo:
+		return i.installFromCargo(ctx, source, opts)
+	case SourceGem:
+		return i.installFromGem(ctx, source, opts)
+	case SourceConda:
+		return i.installFromConda(ctx, source, opts)
+	case SourceNPM:
+		return i.installFromNPM(ctx, source, opts)
 	default:
 		return nil, fmt.Errorf("unsupported source type: %s", source.Type)
 	}
@@ -99,25 +174,33 @@ func (i *Installer) installFromPyPI(ctx context.Context, name string, source Ins
 
 		// Scan for vulnerabilities BEFORE installing
 		slog.Info("running pre-installation security scan", "package", name, "version", version)
-		secInfo = i.scanPyPIPackage(ctx, name, version)
+		var scanErr error
+		secInfo, scanErr = i.scanPackage(ctx, "pypi", name, version)
 
-		// Check if we should block installation
-		if opts.RequireScan && secInfo.CriticalVulnCount > 0 {
-			return nil, fmt.Errorf("critical vulnerabilities found (%d) - installation blocked\nRun 'ophid scan vuln %s' for details",
-				secInfo.CriticalVulnCount, name)
+		// Check if the policy blocks installation
+		if err := i.checkPyPIRelease(ctx, opts.Policy, name, version, source, &secInfo, scanErr, "installation"); err != nil {
+			return nil, fmt.Errorf("%w\nRun 'ophid scan vuln %s' for details", err, name)
 		}
 
 		if secInfo.VulnCount > 0 {
-			fmt.Printf("[WARN] %d vulnerabilities found (%d critical)\n",
+			ui.Warn("%d vulnerabilities found (%d critical)",
 				secInfo.VulnCount, secInfo.CriticalVulnCount)
-			if !opts.RequireScan {
-				fmt.Println("Proceeding with installation (use --require-scan to block)")
+			if opts.Policy == nil || !opts.Policy.Blocks() {
+				ui.Println("Proceeding with installation (use --require-scan to block)")
 			}
-		} else {
-			fmt.Println("[OK] No vulnerabilities found")
+		} else if scanErr == nil {
+			ui.OK("No vulnerabilities found")
 		}
 	}
 
+	pipEnv, err := i.pipEnv(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.IndexURL != "" {
+		source.URL = RedactURL(opts.IndexURL)
+	}
+
 	// PHASE 2: CREATE VENV (only if pre-flight passed)
 	venvPath, err := i.venvManager.Create(name)
 	if err != nil {
@@ -127,8 +210,32 @@ func (i *Installer) installFromPyPI(ctx context.Context, name string, source Ins
 	// Get pip path
 	pipPath := i.venvManager.GetPipPath(venvPath)
 
+	var profile Profile
+	if opts.Profile != "" {
+		profile, _ = LookupProfile(opts.Profile)
+	}
+	if profile.UpgradePip {
+		upgradeCmd := exec.Command(pipPath, "install", "--upgrade", "pip")
+		upgradeCmd.Stdout = os.Stdout
+		upgradeCmd.Stderr = os.Stderr
+		if err := upgradeCmd.Run(); err != nil {
+			return nil, fmt.Errorf("pip upgrade failed: %w", err)
+		}
+	}
+
+	policy, err := ParseBuildPolicy(string(opts.BuildPolicy))
+	if err != nil {
+		return nil, err
+	}
+
 	// Build pip install command
 	args := []string{"install"}
+	args = append(args, profile.PipArgs...)
+	for _, arg := range policy.PipArgs() {
+		if !slices.Contains(args, arg) {
+			args = append(args, arg)
+		}
+	}
 
 	if opts.Force {
 		args = append(args, "--force-reinstall")
@@ -152,16 +259,19 @@ func (i *Installer) installFromPyPI(ctx context.Context, name string, source Ins
 		pkgSpec = fmt.Sprintf("%s[%s]", pkgSpec, strings.Join(opts.Extras, ","))
 	}
 
-	args = append(args, pkgSpec)
+	if opts.Requirements != "" {
+		// Every package is pinned and hashed there, the tool included
+		args = append(args, "--no-deps", "-r", opts.Requirements)
+	} else {
+		args = append(args, pkgSpec)
+	}
 
 	// Run pip install
-	fmt.Printf("Running: %s %s\n", pipPath, strings.Join(args, " "))
+	ui.Printf("Running: %s %s\n", pipPath, strings.Join(args, " "))
 	cmd := exec.Command(pipPath, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("pip install failed: %w", err)
+	cmd.Env = pipEnv
+	if err := runPip(cmd); err != nil {
+		return nil, err
 	}
 
 	// Get installed version
@@ -178,6 +288,10 @@ func (i *Installer) installFromPyPI(ctx context.Context, name string, source Ins
 	if err != nil {
 		executables = []string{}
 	}
+	if len(profile.Executables) > 0 {
+		// Dependencies' scripts (rst2html.py, jp.py...) stay out of the way
+		executables = slices.DeleteFunc(executables, func(exe string) bool { return !slices.Contains(profile.Executables, exe) })
+	}
 
 	// Note: Security scan already performed in pre-flight phase
 
@@ -186,16 +300,17 @@ func (i *Installer) installFromPyPI(ctx context.Context, name string, source Ins
 		Name:        name,
 		Version:     installedVersion,
 		Ecosystem:   "python",
-		Runtime:     "python3",
+		Runtime:     pythonRuntimeOf(opts),
 		InstallPath: venvPath,
 		Executables: executables,
 		Source:      source,
 		Security:    secInfo,
+		Metadata:    map[string]string{BuildPolicyKey: string(policy)},
 		InstalledAt: time.Now(),
 	}
 
 	// Add to manifest
-	i.manifest.Tools[name] = tool
+	i.putTool(tool, opts.Prefer)
 	i.manifest.UpdatedAt = time.Now()
 
 	// Save manifest
@@ -203,12 +318,13 @@ func (i *Installer) installFromPyPI(ctx context.Context, name string, source Ins
 		return nil, fmt.Errorf("failed to save manifest: %w", err)
 	}
 
-	fmt.Printf("\n[SUCCESS] %s@%s installed successfully\n", name, installedVersion)
+	ui.Println()
+	ui.Success("%s@%s installed successfully", name, installedVersion)
 	if len(executables) > 0 {
-		fmt.Printf("  Executables: %s\n", strings.Join(executables, ", "))
+		ui.Printf("  Executables: %s\n", strings.Join(executables, ", "))
 	}
 	if secInfo.VulnCount > 0 {
-		fmt.Printf("  [WARN] Vulnerabilities: %d total, %d critical\n", secInfo.VulnCount, secInfo.CriticalVulnCount)
+		ui.Printf("  %s Vulnerabilities: %d total, %d critical\n", ui.Stderr.Tag(ui.LevelWarn), secInfo.VulnCount, secInfo.CriticalVulnCount)
 	}
 
 	return tool, nil
@@ -216,11 +332,26 @@ func (i *Installer) installFromPyPI(ctx context.Context, name string, source Ins
 
 // installFromGit installs a package from a Git repository
 func (i *Installer) installFromGit(ctx context.Context, name string, source InstallSource, opts InstallOptions) (*Tool, error) {
+	pipEnv, err := i.pipEnv(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	// Clone repository
 	repoPath, err := i.gitInstaller.CloneRepository(ctx, source)
 	if err != nil {
 		return nil, fmt.Errorf("failed to clone repository: %w", err)
 	}
+	// Recorded so that ophid cache gc keeps the clone the tool uses
+	source.Metadata = maps.Clone(source.Metadata)
+	if source.Metadata == nil {
+		source.Metadata = make(map[string]string)
+	}
+	source.Metadata["clone"] = i.gitInstaller.ClonePath(source)
+	if redacted := RedactURL(source.URL); redacted != source.URL {
+		ui.Warn("The repository URL holds credentials, which aren't kept in the manifest. Store them with: ophid auth login %s", hostOf(source.URL))
+		source.URL = redacted
+	}
 
 	slog.Info("repository cloned", "path", repoPath)
 
@@ -238,16 +369,16 @@ func (i *Installer) installFromGit(ctx context.Context, name string, source Inst
 		slog.Info("running security scan", "path", repoPath)
 		secInfo, err = i.gitInstaller.ScanRepository(ctx, repoPath)
 		if err != nil {
-			if opts.RequireScan {
-				return nil, fmt.Errorf("security scan failed: %w", err)
-			}
 			slog.Warn("security scan failed", "path", repoPath, "error", err)
 			secInfo = &SecurityInfo{}
 		}
 
-		// Check if critical vulnerabilities found
-		if opts.RequireScan && secInfo.CriticalVulnCount > 0 {
-			return nil, fmt.Errorf("critical vulnerabilities found (%d) - installation blocked", secInfo.CriticalVulnCount)
+		// Check if the policy blocks installation
+		if opts.Policy != nil {
+			in := releaseInput(name, "", source, *secInfo, err)
+			if err := enforcePolicy(opts.Policy, opts.Policy.EvaluateRelease(in), "installation"); err != nil {
+				return nil, err
+			}
 		}
 	} else {
 		secInfo = &SecurityInfo{}
@@ -264,18 +395,32 @@ func (i *Installer) installFromGit(ctx context.Context, name string, source Inst
 			return nil, fmt.Errorf("failed to create venv: %w", err)
 		}
 
-		// Install from local path
+		// Install from local path; the policy applies to its dependencies
+		policy, err := ParseBuildPolicy(string(opts.BuildPolicy))
+		if err != nil {
+			return nil, err
+		}
 		pipPath := i.venvManager.GetPipPath(venvPath)
-		installCmd := exec.CommandContext(ctx, pipPath, "install", "-e", repoPath)
-		installCmd.Stdout = os.Stdout
-		installCmd.Stderr = os.Stderr
-
-		if err := installCmd.Run(); err != nil {
-			return nil, fmt.Errorf("pip install failed: %w", err)
+		installCmd := exec.CommandContext(ctx, pipPath, append(append([]string{"install"}, policy.PipArgs()...), "-e", repoPath)...)
+		installCmd.Env = pipEnv
+		if err := runPip(installCmd); err != nil {
+			return nil, err
 		}
 
 		// List executables
 		executables, _ = i.venvManager.ListExecutables(venvPath)
+	} else if ecosystem == "rust" {
+		venvPath, executables, err = i.cargoInstallPath(ctx, name, repoPath)
+		if err != nil {
+			return nil, err
+		}
+	} else if ecosystem == "ruby" {
+		venvPath, _, executables, err = i.installRuby(name, func(ruby, gemHome string) error {
+			return i.rubyInstaller.InstallProject(ctx, ruby, gemHome, repoPath)
+		})
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		venvPath = repoPath
 	}
@@ -287,11 +432,15 @@ func (i *Installer) installFromGit(ctx context.Context, name string, source Inst
 	}
 
 	// Create tool record
+	runtime := ecosystem
+	if ecosystem == "python" && opts.Python != "" {
+		runtime = pythonRuntimeOf(opts)
+	}
 	tool := &Tool{
 		Name:        name,
 		Version:     version,
 		Ecosystem:   ecosystem,
-		Runtime:     ecosystem,
+		Runtime:     runtime,
 		InstallPath: venvPath,
 		Executables: executables,
 		Source:      source,
@@ -300,7 +449,7 @@ func (i *Installer) installFromGit(ctx context.Context, name string, source Inst
 	}
 
 	// Add to manifest
-	i.manifest.Tools[name] = tool
+	i.putTool(tool, opts.Prefer)
 	i.manifest.UpdatedAt = time.Now()
 
 	// Save manifest
@@ -308,17 +457,44 @@ func (i *Installer) installFromGit(ctx context.Context, name string, source Inst
 		return nil, fmt.Errorf("failed to save manifest: %w", err)
 	}
 
-	fmt.Printf("\n[SUCCESS] %s@%s installed successfully from Git\n", name, version)
+	ui.Println()
+	ui.Success("%s@%s installed successfully from Git", name, version)
 	if len(executables) > 0 {
-		fmt.Printf("  Executables: %s\n", strings.Join(executables, ", "))
+		ui.Printf("  Executables: %s\n", strings.Join(executables, ", "))
 	}
 	if secInfo.VulnCount > 0 {
-		fmt.Printf("  [WARN] Vulnerabilities: %d total, %d critical\n", secInfo.VulnCount, secInfo.CriticalVulnCount)
+		ui.Printf("  %s Vulnerabilities: %d total, %d critical\n", ui.Stderr.Tag(ui.LevelWarn), secInfo.VulnCount, secInfo.CriticalVulnCount)
 	}
 
 	return tool, nil
 }
 
+// pipEnv returns the environment pip runs with to install from
+// opts.IndexURL, with the index's credentials, or nil to inherit ours. The
+// credentials never reach pip's command line or the manifest.
+func (i *Installer) pipEnv(ctx context.Context, opts InstallOptions) ([]string, error) {
+	if opts.IndexURL == "" {
+		return nil, nil
+	}
+
+	indexURL := opts.IndexURL
+	if RedactURL(indexURL) != indexURL {
+		ui.Warn("The index URL holds credentials, which aren't kept in the manifest. Store them with: ophid auth login %s", hostOf(indexURL))
+	} else if host := hostOf(indexURL); host != "" {
+		creds, err := i.auth.Lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if creds != nil {
+			if indexURL, err = URLWithCredentials(indexURL, creds); err != nil {
+				return nil, fmt.Errorf("invalid index URL: %w", err)
+			}
+			ui.Printf("Using index %s with credentials from the %s\n", RedactURL(indexURL), creds.Source)
+		}
+	}
+	return append(os.Environ(), "PIP_INDEX_URL="+indexURL), nil
+}
+
 // installFromLocal installs a package from a local directory
 func (i *Installer) installFromLocal(ctx context.Context, name string, source InstallSource, opts InstallOptions) (*Tool, error) {
 	// Validate local path
@@ -326,6 +502,11 @@ func (i *Installer) installFromLocal(ctx context.Context, name string, source In
 		return nil, fmt.Errorf("invalid local path: %w", err)
 	}
 
+	pipEnv, err := i.pipEnv(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	slog.Info("installing from local path", "path", source.Path)
 
 	// Detect ecosystem
@@ -340,18 +521,18 @@ func (i *Installer) installFromLocal(ctx context.Context, name string, source In
 	var secInfo *SecurityInfo
 	if !opts.SkipScan {
 		slog.Info("running security scan", "path", source.Path)
-		secInfo, err := i.localInstaller.ScanLocalPath(ctx, source.Path)
+		secInfo, err = i.localInstaller.ScanLocalPath(ctx, source.Path)
 		if err != nil {
-			if opts.RequireScan {
-				return nil, fmt.Errorf("security scan failed: %w", err)
-			}
 			slog.Warn("security scan failed", "path", source.Path, "error", err)
 			secInfo = &SecurityInfo{}
 		}
 
-		// Check if critical vulnerabilities found
-		if opts.RequireScan && secInfo.CriticalVulnCount > 0 {
-			return nil, fmt.Errorf("critical vulnerabilities found (%d) - installation blocked", secInfo.CriticalVulnCount)
+		// Check if the policy blocks installation
+		if opts.Policy != nil {
+			in := releaseInput(name, "", source, *secInfo, err)
+			if err := enforcePolicy(opts.Policy, opts.Policy.EvaluateRelease(in), "installation"); err != nil {
+				return nil, err
+			}
 		}
 	} else {
 		secInfo = &SecurityInfo{}
@@ -368,18 +549,33 @@ func (i *Installer) installFromLocal(ctx context.Context, name string, source In
 			return nil, fmt.Errorf("failed to create venv: %w", err)
 		}
 
-		// Install from local path (editable mode)
+		// Install from local path (editable mode); the policy applies to
+		// its dependencies
+		policy, err := ParseBuildPolicy(string(opts.BuildPolicy))
+		if err != nil {
+			return nil, err
+		}
 		pipPath := i.venvManager.GetPipPath(venvPath)
-		installCmd := exec.CommandContext(ctx, pipPath, "install", "-e", source.Path)
-		installCmd.Stdout = os.Stdout
-		installCmd.Stderr = os.Stderr
-
-		if err := installCmd.Run(); err != nil {
-			return nil, fmt.Errorf("pip install failed: %w", err)
+		installCmd := exec.CommandContext(ctx, pipPath, append(append([]string{"install"}, policy.PipArgs()...), "-e", source.Path)...)
+		installCmd.Env = pipEnv
+		if err := runPip(installCmd); err != nil {
+			return nil, err
 		}
 
 		// List executables
 		executables, _ = i.venvManager.ListExecutables(venvPath)
+	} else if ecosystem == "rust" {
+		venvPath, executables, err = i.cargoInstallPath(ctx, name, source.Path)
+		if err != nil {
+			return nil, err
+		}
+	} else if ecosystem == "ruby" {
+		venvPath, _, executables, err = i.installRuby(name, func(ruby, gemHome string) error {
+			return i.rubyInstaller.InstallProject(ctx, ruby, gemHome, source.Path)
+		})
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		venvPath = source.Path
 	}
@@ -388,11 +584,15 @@ func (i *Installer) installFromLocal(ctx context.Context, name string, source In
 	metadata := i.localInstaller.ExtractMetadata(source.Path)
 
 	// Create tool record
+	runtime := ecosystem
+	if ecosystem == "python" && opts.Python != "" {
+		runtime = pythonRuntimeOf(opts)
+	}
 	tool := &Tool{
 		Name:        name,
 		Version:     "local",
 		Ecosystem:   ecosystem,
-		Runtime:     ecosystem,
+		Runtime:     runtime,
 		InstallPath: venvPath,
 		Executables: executables,
 		Source:      source,
@@ -402,7 +602,7 @@ func (i *Installer) installFromLocal(ctx context.Context, name string, source In
 	}
 
 	// Add to manifest
-	i.manifest.Tools[name] = tool
+	i.putTool(tool, opts.Prefer)
 	i.manifest.UpdatedAt = time.Now()
 
 	// Save manifest
@@ -410,19 +610,22 @@ func (i *Installer) installFromLocal(ctx context.Context, name string, source In
 		return nil, fmt.Errorf("failed to save manifest: %w", err)
 	}
 
-	fmt.Printf("\n[SUCCESS] %s installed successfully from local directory\n", name)
+	ui.Println()
+	ui.Success("%s installed successfully from local directory", name)
 	if len(executables) > 0 {
-		fmt.Printf("  Executables: %s\n", strings.Join(executables, ", "))
+		ui.Printf("  Executables: %s\n", strings.Join(executables, ", "))
 	}
 	if secInfo.VulnCount > 0 {
-		fmt.Printf("  [WARN] Vulnerabilities: %d total, %d critical\n", secInfo.VulnCount, secInfo.CriticalVulnCount)
+		ui.Printf("  %s Vulnerabilities: %d total, %d critical\n", ui.Stderr.Tag(ui.LevelWarn), secInfo.VulnCount, secInfo.CriticalVulnCount)
 	}
 
 	return tool, nil
 }
 
-// scanPyPIPackage scans a PyPI package for vulnerabilities
-func (i *Installer) scanPyPIPackage(ctx context.Context, name, version string) SecurityInfo {
+// scanPackage scans a package of an OSV ecosystem, like "pypi" or
+// "crates.io", for vulnerabilities. A scan that fails returns why, with
+// nothing found.
+func (i *Installer) scanPackage(ctx context.Context, ecosystem, name, version string) (SecurityInfo, error) {
 	secInfo := SecurityInfo{
 		LicenseCompliant: true,
 	}
@@ -431,47 +634,67 @@ func (i *Installer) scanPyPIPackage(ctx context.Context, name, version string) S
 	pkg := security.Package{
 		Name:      name,
 		Version:   version,
-		Ecosystem: "pypi",
+		Ecosystem: ecosystem,
 	}
 
 	// Scan for vulnerabilities
 	results, err := i.scanner.ScanPackages(ctx, []security.Package{pkg})
 	if err != nil {
 		slog.Warn("vulnerability scan failed", "package", name, "error", err)
-		return secInfo
+		return secInfo, err
+	}
+	if len(results) > 0 && results[0].Error != "" {
+		slog.Warn("vulnerability scan failed", "package", name, "error", results[0].Error)
+		return secInfo, errors.New(results[0].Error)
 	}
 
 	// Count vulnerabilities
 	if len(results) > 0 {
 		secInfo.VulnCount = len(results[0].Vulnerabilities)
 		secInfo.CriticalVulnCount = results[0].CriticalCount()
+		secInfo.MaxSeverity = results[0].MaxSeverity()
 
 		if secInfo.VulnCount > 0 {
-			fmt.Printf("[WARN] Found %d vulnerabilities", secInfo.VulnCount)
+			found := fmt.Sprintf("Found %d vulnerabilities", secInfo.VulnCount)
 			if secInfo.CriticalVulnCount > 0 {
-				fmt.Printf(" (%d critical)", secInfo.CriticalVulnCount)
+				found += fmt.Sprintf(" (%d critical)", secInfo.CriticalVulnCount)
 			}
-			fmt.Println()
+			ui.Warn("%s", found)
 		}
 	}
 
-	return secInfo
+	return secInfo, nil
 }
 
 // Uninstall removes a tool
 func (i *Installer) Uninstall(name string) error {
 	tool, exists := i.manifest.Tools[name]
 	if !exists {
-		return fmt.Errorf("tool %s is not installed", name)
+		return errcode.Errorf(errcode.NotFound, "tool %s is not installed", name)
 	}
 
 	// Remove venv
 	if err := i.venvManager.Remove(name); err != nil {
 		return fmt.Errorf("failed to remove venv: %w", err)
 	}
+	// Rust, Ruby, conda and Node.js tools are installed into a cargo root,
+	// GEM_HOME, conda environment or npm prefix instead
+	for _, dir := range []string{filepath.Join(i.homeDir, "tools", name, "cargo"), i.rubyInstaller.GemHome(name), i.condaInstaller.Root(name), i.npmInstaller.Root(name)} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+	}
+
+	if err := os.Remove(i.LockPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove lockfile: %w", err)
+	}
+	if err := os.Remove(i.SBOMPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove SBOM: %w", err)
+	}
 
 	// Remove from manifest
 	delete(i.manifest.Tools, name)
+	i.resolveOwners()
 	i.manifest.UpdatedAt = time.Now()
 
 	// Save manifest
@@ -479,7 +702,9 @@ func (i *Installer) Uninstall(name string) error {
 		return fmt.Errorf("failed to save manifest: %w", err)
 	}
 
-	fmt.Printf("[SUCCESS] %s@%s uninstalled\n", name, tool.Version)
+	i.syncShims()
+	i.pruneStore()
+	ui.Success("%s@%s uninstalled", name, tool.Version)
 
 	return nil
 }
@@ -497,36 +722,94 @@ func (i *Installer) List() []*Tool {
 func (i *Installer) Get(name string) (*Tool, error) {
 	tool, exists := i.manifest.Tools[name]
 	if !exists {
-		return nil, fmt.Errorf("tool %s is not installed", name)
+		return nil, errcode.Errorf(errcode.NotFound, "tool %s is not installed", name)
 	}
 	return tool, nil
 }
 
+// SetSandbox sets (or, with nil, removes) the sandbox profile of a tool
+func (i *Installer) SetSandbox(name string, profile *sandbox.Profile) error {
+	tool, exists := i.manifest.Tools[name]
+	if !exists {
+		return errcode.Errorf(errcode.NotFound, "tool %s is not installed", name)
+	}
+
+	if profile != nil {
+		if err := profile.Validate(); err != nil {
+			return err
+		}
+		if !profile.Enabled() {
+			profile = nil
+		}
+	}
+
+	tool.Sandbox = profile
+	tool.UpdatedAt = time.Now()
+	i.manifest.UpdatedAt = tool.UpdatedAt
+
+	if err := i.saveManifest(); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	// Shims of sandboxed tools go through ophid run
+	i.syncShims()
+	return nil
+}
+
+// putTool adds a freshly installed tool to the manifest, keeping the
+// sandbox profile and smoke test of the version it replaces, and resolves
+// executable name collisions with other tools
+func (i *Installer) putTool(tool *Tool, prefer bool) {
+	if old, exists := i.manifest.Tools[tool.Name]; exists {
+		if tool.Sandbox == nil {
+			tool.Sandbox = old.Sandbox
+		}
+		if tool.SmokeTest == nil {
+			tool.SmokeTest = old.SmokeTest
+		}
+	}
+	i.manifest.Tools[tool.Name] = tool
+	i.claimExecutables(tool, prefer)
+}
+
 // loadManifest loads the tool manifest
 func (i *Installer) loadManifest() error {
+	manifest, err := readManifest(i.manifestPath)
+	if err != nil {
+		return err
+	}
+	i.manifest = manifest
+	return nil
+}
+
+// LoadManifest reads the manifest of the tools installed under homeDir,
+// for readers that don't install anything
+func LoadManifest(homeDir string) (*ToolManifest, error) {
+	return readManifest(filepath.Join(homeDir, "tools", "manifest.json"))
+}
+
+// readManifest reads a manifest file, or returns an empty manifest if it
+// doesn't exist
+func readManifest(path string) (*ToolManifest, error) {
 	// Create default manifest if file doesn't exist
-	if _, err := os.Stat(i.manifestPath); os.IsNotExist(err) {
-		i.manifest = &ToolManifest{
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &ToolManifest{
 			Tools:     make(map[string]*Tool),
 			UpdatedAt: time.Now(),
-		}
-		return nil
+		}, nil
 	}
 
 	// Read manifest file
-	data, err := os.ReadFile(i.manifestPath)
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to read manifest: %w", err)
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
 	}
 
 	// Parse JSON
 	var manifest ToolManifest
 	if err := json.Unmarshal(data, &manifest); err != nil {
-		return fmt.Errorf("failed to parse manifest: %w", err)
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
 	}
-
-	i.manifest = &manifest
-	return nil
+	return &manifest, nil
 }
 
 // saveManifest saves the tool manifest
@@ -574,33 +857,9 @@ func (i *Installer) getInstalledVersion(pipPath, name string) (string, error) {
 
 // getLatestPyPIVersion queries PyPI JSON API for latest version
 func (i *Installer) getLatestPyPIVersion(ctx context.Context, name string) (string, error) {
-	url := fmt.Sprintf("https://pypi.org/pypi/%s/json", name)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	meta, err := fetchPyPIMetadata(ctx, i.homeDir, name)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to query PyPI: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("PyPI returned status %d", resp.StatusCode)
-	}
-
-	var result struct {
-		Info struct {
-			Version string `json:"version"`
-		} `json:"info"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to parse PyPI response: %w", err)
+		return "", err
 	}
-
-	return result.Info.Version, nil
+	return meta.LatestVersion, nil
 }
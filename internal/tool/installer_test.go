@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/gleicon/ophid/internal/sandbox"
 )
 
 func TestManifest_LoadAndSave(t *testing.T) {
@@ -179,3 +181,45 @@ func TestInstaller_Get(t *testing.T) {
 		t.Error("Get() should return error for non-existent tool")
 	}
 }
+
+func TestInstaller_SetSandbox(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	venvMgr := NewVenvManager(tmpDir, "/usr/bin/python3")
+	installer, err := NewInstaller(tmpDir, venvMgr)
+	if err != nil {
+		t.Fatalf("NewInstaller() error = %v", err)
+	}
+	installer.manifest.Tools["ansible"] = &Tool{Name: "ansible", Version: "2.10.0"}
+
+	if err := installer.SetSandbox("ansible", &sandbox.Profile{Home: "nowhere"}); err == nil {
+		t.Error("SetSandbox() should reject an invalid profile")
+	}
+	if err := installer.SetSandbox("missing", &sandbox.Profile{NoNetwork: true}); err == nil {
+		t.Error("SetSandbox() should fail for a tool that is not installed")
+	}
+
+	profile := &sandbox.Profile{NoNetwork: true, Home: sandbox.HomeReadOnly}
+	if err := installer.SetSandbox("ansible", profile); err != nil {
+		t.Fatalf("SetSandbox() error = %v", err)
+	}
+
+	// Persisted, and kept across a reinstall
+	installer2, err := NewInstaller(tmpDir, venvMgr)
+	if err != nil {
+		t.Fatalf("NewInstaller() error = %v", err)
+	}
+	installer2.putTool(&Tool{Name: "ansible", Version: "2.11.0"}, false)
+	tool, _ := installer2.Get("ansible")
+	if tool.Sandbox == nil || !tool.Sandbox.NoNetwork || tool.Sandbox.Home != sandbox.HomeReadOnly {
+		t.Errorf("Sandbox = %+v, want the saved profile", tool.Sandbox)
+	}
+
+	// An empty profile clears it
+	if err := installer2.SetSandbox("ansible", &sandbox.Profile{}); err != nil {
+		t.Fatalf("SetSandbox() error = %v", err)
+	}
+	if tool.Sandbox != nil {
+		t.Errorf("Sandbox = %+v, want nil", tool.Sandbox)
+	}
+}
@@ -0,0 +1,340 @@
+package tool
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// Integrity records the pip RECORD files of a tool's venv when it was
+// installed. Each RECORD lists the hashes of its package's files, so
+// trusting the RECORDs is enough to check every installed file. Tools
+// without a venv, like Rust binaries, have their executables hashed instead.
+type Integrity struct {
+	Records    map[string]string `json:"records"`         // RECORD path, relative to the venv -> SHA-256
+	Files      map[string]string `json:"files,omitempty"` // Executable path, relative to the install -> SHA-256
+	RecordedAt time.Time         `json:"recorded_at"`
+}
+
+// Integrity issues
+const (
+	IssueModified   = "modified"
+	IssueMissing    = "missing"
+	IssueUnrecorded = "not recorded" // Added after the install, e.g. another package or a .pth file
+)
+
+// IntegrityProblem is a file of a tool's venv that isn't as installed
+type IntegrityProblem struct {
+	Path  string `json:"path"` // Relative to the venv
+	Issue string `json:"issue"`
+}
+
+func (p IntegrityProblem) String() string {
+	return p.Path + ": " + p.Issue
+}
+
+// startupFiles are run by Python at startup from site-packages without
+// being imported, which makes an unrecorded one worth reporting
+var startupFiles = []string{"sitecustomize.py", "usercustomize.py"}
+
+// RecordIntegrity hashes the RECORD files of a venv
+func RecordIntegrity(venvPath string) (*Integrity, error) {
+	records, err := recordFiles(venvPath)
+	if err != nil {
+		return nil, err
+	}
+	integrity := &Integrity{Records: make(map[string]string), RecordedAt: time.Now()}
+	for _, rel := range records {
+		sum, err := hashFile(filepath.Join(venvPath, rel))
+		if err != nil {
+			return nil, err
+		}
+		integrity.Records[rel] = sum
+	}
+	if len(sitePackagesDirs(venvPath)) == 0 {
+		if integrity.Files, err = hashExecutables(venvPath); err != nil {
+			return nil, err
+		}
+	}
+	return integrity, nil
+}
+
+// hashExecutables hashes the files of an install's bin directory
+func hashExecutables(installPath string) (map[string]string, error) {
+	binDir := new(VenvManager).GetBinDir(installPath)
+	entries, err := os.ReadDir(binDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", binDir, err)
+	}
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		sum, err := hashFile(filepath.Join(binDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		rel, _ := filepath.Rel(installPath, filepath.Join(binDir, entry.Name()))
+		files[filepath.ToSlash(rel)] = sum
+	}
+	return files, nil
+}
+
+// VerifyIntegrity compares a venv with its integrity record: the RECORD
+// files themselves, the files the unchanged ones list, startup files
+// (.pth, sitecustomize.py) no RECORD lists, and hashed executables
+func VerifyIntegrity(venvPath string, integrity *Integrity) ([]IntegrityProblem, error) {
+	records, err := recordFiles(venvPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []IntegrityProblem
+	listed := make(map[string]bool) // Files listed by any RECORD, relative to the venv
+	current := make(map[string]bool)
+	for _, rel := range records {
+		current[rel] = true
+		want, known := integrity.Records[rel]
+		if !known {
+			problems = append(problems, IntegrityProblem{Path: rel, Issue: IssueUnrecorded})
+		}
+
+		entries, err := readRecord(venvPath, rel)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			listed[e.path] = true
+		}
+
+		sum, err := hashFile(filepath.Join(venvPath, rel))
+		if err != nil {
+			return nil, err
+		}
+		if known && sum != want {
+			problems = append(problems, IntegrityProblem{Path: rel, Issue: IssueModified})
+			continue
+		}
+		if !known {
+			continue
+		}
+
+		// The RECORD is as installed, so its hashes can be trusted
+		for _, e := range entries {
+			if e.hash == "" {
+				continue // RECORD itself and compiled .pyc files have no hash
+			}
+			got, err := recordHash(filepath.Join(venvPath, e.path))
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				problems = append(problems, IntegrityProblem{Path: e.path, Issue: IssueMissing})
+			case err != nil:
+				return nil, err
+			case got != e.hash:
+				problems = append(problems, IntegrityProblem{Path: e.path, Issue: IssueModified})
+			}
+		}
+	}
+	for rel := range integrity.Records {
+		if !current[rel] {
+			problems = append(problems, IntegrityProblem{Path: rel, Issue: IssueMissing})
+		}
+	}
+
+	if integrity.Files != nil {
+		files, err := hashExecutables(venvPath)
+		if err != nil {
+			return nil, err
+		}
+		for rel, want := range integrity.Files {
+			got, ok := files[rel]
+			switch {
+			case !ok:
+				problems = append(problems, IntegrityProblem{Path: rel, Issue: IssueMissing})
+			case got != want:
+				problems = append(problems, IntegrityProblem{Path: rel, Issue: IssueModified})
+			}
+		}
+		for rel := range files {
+			if _, ok := integrity.Files[rel]; !ok {
+				problems = append(problems, IntegrityProblem{Path: rel, Issue: IssueUnrecorded})
+			}
+		}
+	}
+
+	for _, dir := range sitePackagesDirs(venvPath) {
+		entries, err := os.ReadDir(filepath.Join(venvPath, dir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			rel := filepath.ToSlash(filepath.Join(dir, name))
+			if (strings.HasSuffix(name, ".pth") || slices.Contains(startupFiles, name)) && !listed[rel] {
+				problems = append(problems, IntegrityProblem{Path: rel, Issue: IssueUnrecorded})
+			}
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems, nil
+}
+
+// Verify checks an installed tool against the integrity record of its
+// install
+func (i *Installer) Verify(name string) ([]IntegrityProblem, error) {
+	tool, err := i.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if tool.Integrity == nil {
+		return nil, errcode.Errorf(errcode.NotFound, "%s has no integrity record (installed by an older ophid); record its current files with: ophid verify --update %s", name, name)
+	}
+	return VerifyIntegrity(tool.InstallPath, tool.Integrity)
+}
+
+// UpdateIntegrity records the current files of a tool as its trusted state
+func (i *Installer) UpdateIntegrity(name string) error {
+	tool, err := i.Get(name)
+	if err != nil {
+		return err
+	}
+	integrity, err := RecordIntegrity(tool.InstallPath)
+	if err != nil {
+		return err
+	}
+	tool.Integrity = integrity
+	i.manifest.UpdatedAt = time.Now()
+	if err := i.saveManifest(); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return nil
+}
+
+// sitePackagesDirs returns the site-packages directories of a venv,
+// relative to it
+func sitePackagesDirs(venvPath string) []string {
+	pattern := "lib/python*/site-packages"
+	if runtime.GOOS == "windows" {
+		pattern = "Lib/site-packages"
+	}
+	var dirs []string
+	matches, _ := filepath.Glob(filepath.Join(venvPath, filepath.FromSlash(pattern)))
+	for _, m := range matches {
+		if rel, err := filepath.Rel(venvPath, m); err == nil {
+			dirs = append(dirs, filepath.ToSlash(rel))
+		}
+	}
+	return dirs
+}
+
+// recordFiles returns the RECORD files of a venv, relative to it and sorted
+func recordFiles(venvPath string) ([]string, error) {
+	var records []string
+	for _, dir := range sitePackagesDirs(venvPath) {
+		matches, err := filepath.Glob(filepath.Join(venvPath, filepath.FromSlash(dir), "*.dist-info", "RECORD"))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			rel, err := filepath.Rel(venvPath, m)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, filepath.ToSlash(rel))
+		}
+	}
+	sort.Strings(records)
+	return records, nil
+}
+
+// recordEntry is a line of a RECORD file
+type recordEntry struct {
+	path string // Relative to the venv
+	hash string // "sha256=<urlsafe base64>", or "" when not recorded
+}
+
+// readRecord parses a RECORD file. Its paths are relative to the
+// site-packages directory; entries outside the venv are dropped.
+func readRecord(venvPath, rel string) ([]recordEntry, error) {
+	f, err := os.Open(filepath.Join(venvPath, rel))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rel, err)
+	}
+	defer f.Close()
+
+	sitePackages := filepath.Dir(filepath.Dir(filepath.FromSlash(rel)))
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	var entries []recordEntry
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", rel, err)
+		}
+		if len(fields) == 0 || fields[0] == "" {
+			continue
+		}
+		path := filepath.Clean(filepath.Join(sitePackages, filepath.FromSlash(fields[0])))
+		if filepath.IsAbs(fields[0]) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+			continue
+		}
+		entry := recordEntry{path: filepath.ToSlash(path)}
+		if len(fields) > 1 && strings.HasPrefix(fields[1], "sha256=") {
+			entry.hash = fields[1]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// recordHash hashes a file the way RECORD files do
+func recordHash(path string) (string, error) {
+	sum, err := sumFile(path)
+	if err != nil {
+		return "", err
+	}
+	return "sha256=" + base64.RawURLEncoding.EncodeToString(sum), nil
+}
+
+// hashFile returns the hex SHA-256 of a file
+func hashFile(path string) (string, error) {
+	sum, err := sumFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+func sumFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
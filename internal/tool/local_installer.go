@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gleicon/ophid/internal/security"
+	"github.com/gleicon/ophid/internal/ui"
 )
 
 // LocalInstaller handles installation from local directories
@@ -80,24 +81,25 @@ func (li *LocalInstaller) ScanLocalPath(ctx context.Context, path string) (*Secu
 		secInfo.SecretsScanDate = time.Now()
 
 		if secretsReport.HasSecrets() {
-			fmt.Printf("[WARN] ALERT: Found %d secret(s)", secretsReport.TotalSecrets)
+			alert := fmt.Sprintf("ALERT: Found %d secret(s)", secretsReport.TotalSecrets)
 			if secretsReport.CriticalSecrets > 0 {
-				fmt.Printf(" (%d critical)", secretsReport.CriticalSecrets)
+				alert += fmt.Sprintf(" (%d critical)", secretsReport.CriticalSecrets)
 			}
-			fmt.Println()
+			ui.Warn("%s", alert)
 
 			for i, finding := range secretsReport.Findings {
 				if i >= 5 {
-					fmt.Printf("  ... and %d more\n", len(secretsReport.Findings)-5)
+					ui.Printf("  ... and %d more\n", len(secretsReport.Findings)-5)
 					break
 				}
-				fmt.Printf("  - [%s] %s\n", finding.Severity, finding.Type)
-				fmt.Printf("    File: %s:%d\n", finding.File, finding.Line)
-				fmt.Printf("    Secret: %s\n", security.RedactSecret(finding.Secret))
+				ui.Printf("  - [%s] %s\n", finding.Severity, finding.Type)
+				ui.Printf("    File: %s:%d\n", finding.File, finding.Line)
+				ui.Printf("    Secret: %s\n", security.RedactSecret(finding.Secret))
 			}
-			fmt.Println("\n[WARN] CRITICAL: Review and rotate any exposed secrets immediately")
+			ui.Println()
+			ui.Warn("CRITICAL: Review and rotate any exposed secrets immediately")
 		} else {
-			fmt.Println("[OK] No secrets found")
+			ui.OK("No secrets found")
 		}
 	}
 
@@ -119,7 +121,7 @@ func (li *LocalInstaller) ScanLocalPath(ctx context.Context, path string) (*Secu
 			foundFile = depFile
 			parsedPackages, err := li.parseDependencyFile(depFile)
 			if err != nil {
-				fmt.Printf("Warning: failed to parse %s: %v\n", depFile, err)
+				ui.Warn("failed to parse %s: %v", depFile, err)
 				continue
 			}
 			packages = append(packages, parsedPackages...)
@@ -128,11 +130,11 @@ func (li *LocalInstaller) ScanLocalPath(ctx context.Context, path string) (*Secu
 	}
 
 	if len(packages) == 0 {
-		fmt.Println("No dependency files found - skipping vulnerability scan")
+		ui.Println("No dependency files found - skipping vulnerability scan")
 		return secInfo, nil
 	}
 
-	fmt.Printf("Scanning %d dependencies from %s...\n", len(packages), filepath.Base(foundFile))
+	ui.Printf("Scanning %d dependencies from %s...\n", len(packages), filepath.Base(foundFile))
 
 	// Scan for vulnerabilities
 	results, err := li.scanner.ScanPackages(ctx, packages)
@@ -144,20 +146,22 @@ func (li *LocalInstaller) ScanLocalPath(ctx context.Context, path string) (*Secu
 	for _, result := range results {
 		secInfo.VulnCount += len(result.Vulnerabilities)
 		secInfo.CriticalVulnCount += result.CriticalCount()
+		secInfo.MaxSeverity = max(secInfo.MaxSeverity, result.MaxSeverity())
 	}
 
 	// Display scan results
 	if secInfo.VulnCount > 0 {
-		fmt.Printf("\n[WARN] Found %d vulnerabilities", secInfo.VulnCount)
+		found := fmt.Sprintf("Found %d vulnerabilities", secInfo.VulnCount)
 		if secInfo.CriticalVulnCount > 0 {
-			fmt.Printf(" (%d critical)", secInfo.CriticalVulnCount)
+			found += fmt.Sprintf(" (%d critical)", secInfo.CriticalVulnCount)
 		}
-		fmt.Println()
+		ui.Println()
+		ui.Warn("%s", found)
 
 		for _, result := range results {
 			if len(result.Vulnerabilities) > 0 {
 				for _, vuln := range result.Vulnerabilities {
-					fmt.Printf("  - %s in %s@%s: %s\n",
+					ui.Printf("  - %s in %s@%s: %s\n",
 						vuln.ID,
 						result.Package.Name,
 						result.Package.Version,
@@ -165,22 +169,23 @@ func (li *LocalInstaller) ScanLocalPath(ctx context.Context, path string) (*Secu
 				}
 			}
 		}
-		fmt.Println()
+		ui.Println()
 	} else {
-		fmt.Println("[OK] No vulnerabilities found")
+		ui.OK("No vulnerabilities found")
 	}
 
 	// Generate SBOM
-	sbom, err := security.GenerateSBOM(packages, "ophid-local")
+	ResolveLicenses(ctx, li.homeDir, packages)
+	sbom, err := security.GenerateSBOM(packages, security.Package{Name: filepath.Base(path)})
 	if err != nil {
-		fmt.Printf("Warning: SBOM generation failed: %v\n", err)
+		ui.Warn("SBOM generation failed: %v", err)
 	} else {
 		sbomPath := filepath.Join(path, "ophid-sbom.json")
 		if err := security.WriteSBOM(sbom, sbomPath); err != nil {
-			fmt.Printf("Warning: failed to write SBOM: %v\n", err)
+			ui.Warn("failed to write SBOM: %v", err)
 		} else {
 			secInfo.SBOMPath = sbomPath
-			fmt.Printf("[SUCCESS] SBOM generated: %s\n", sbomPath)
+			ui.Success("SBOM generated: %s", sbomPath)
 		}
 	}
 
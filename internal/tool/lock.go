@@ -0,0 +1,216 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// lockHeader starts the first line of a tool lockfile
+const lockHeader = "# ophid lock for "
+
+// ToolLock is a tool's lockfile: what pip freeze lists in its venv, in
+// requirements.txt format under a header naming the tool
+type ToolLock struct {
+	Tool     string
+	Version  string
+	Python   string   // Python version of the venv, "" if unknown
+	Packages []string // pip freeze lines: name==version, or name @ url
+}
+
+// LockPath returns the lockfile of a tool, kept next to the manifest
+func (i *Installer) LockPath(name string) string {
+	return filepath.Join(i.homeDir, "tools", name+".lock")
+}
+
+// ReadToolLock reads a tool lockfile
+func ReadToolLock(path string) (*ToolLock, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errcode.Wrap(errcode.NotFound, fmt.Errorf("no lockfile at %s", path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+
+	lock := &ToolLock{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if header, ok := strings.CutPrefix(line, lockHeader); ok {
+			// "<tool> <version> (python <version>)"
+			fields := strings.Fields(strings.NewReplacer("(", "", ")", "").Replace(header))
+			if len(fields) >= 2 {
+				lock.Tool, lock.Version = fields[0], fields[1]
+			}
+			if len(fields) >= 4 && fields[2] == "python" {
+				lock.Python = fields[3]
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lock.Packages = append(lock.Packages, line)
+	}
+	if lock.Tool == "" {
+		return nil, fmt.Errorf("%s isn't an ophid lockfile: its first line must be %q<tool> <version>", path, lockHeader)
+	}
+	return lock, nil
+}
+
+// Write writes the lockfile to path
+func (l *ToolLock) Write(path string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s %s", lockHeader, l.Tool, l.Version)
+	if l.Python != "" {
+		fmt.Fprintf(&b, " (python %s)", l.Python)
+	}
+	fmt.Fprintf(&b, "\n# Reinstall with: ophid install --from-lock %s\n", path)
+	for _, pkg := range l.Packages {
+		b.WriteString(pkg + "\n")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+	return nil
+}
+
+// Freeze captures what is installed in a tool's venv
+func (i *Installer) Freeze(t *Tool) (*ToolLock, error) {
+	out, err := exec.Command(i.venvManager.GetPipPath(t.InstallPath), "freeze").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pip freeze failed: %w", err)
+	}
+	lock := &ToolLock{Tool: t.Name, Version: t.Version, Python: venvConfig(t.InstallPath, "version")}
+	for _, line := range strings.Split(string(out), "\n") {
+		// pip comments on editable installs without version control
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lock.Packages = append(lock.Packages, line)
+		}
+	}
+	slices.Sort(lock.Packages)
+	return lock, nil
+}
+
+// writeLock freezes a Python tool's venv into its lockfile
+func (i *Installer) writeLock(t *Tool) error {
+	if !i.hasVenv(t) {
+		return nil
+	}
+	lock, err := i.Freeze(t)
+	if err != nil {
+		return err
+	}
+	return lock.Write(i.LockPath(t.Name))
+}
+
+// LockDrift compares what is installed in a Python tool's venv with its
+// lockfile and describes each difference, like "requests 2.32.3 (locked
+// 2.31.0)". Tools without a lockfile have no drift.
+func (i *Installer) LockDrift(t *Tool) ([]string, error) {
+	if !i.hasVenv(t) {
+		return nil, nil
+	}
+	locked, err := ReadToolLock(i.LockPath(t.Name))
+	if errcode.Of(err) == errcode.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	current, err := i.Freeze(t)
+	if err != nil {
+		return nil, err
+	}
+
+	want, have := lockedPackages(locked.Packages), lockedPackages(current.Packages)
+	var drift []string
+	for _, name := range slices.Sorted(maps.Keys(want)) {
+		switch got, ok := have[name]; {
+		case !ok:
+			drift = append(drift, fmt.Sprintf("%s is missing (locked %s)", name, want[name]))
+		case got != want[name]:
+			drift = append(drift, fmt.Sprintf("%s %s (locked %s)", name, got, want[name]))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(have)) {
+		if _, ok := want[name]; !ok {
+			drift = append(drift, fmt.Sprintf("%s %s isn't locked", name, have[name]))
+		}
+	}
+	return drift, nil
+}
+
+// SyncLock puts a Python tool's venv back to its lockfile: the locked
+// packages are installed at their locked versions and the others removed
+func (i *Installer) SyncLock(name string) error {
+	t, err := i.Get(name)
+	if err != nil {
+		return err
+	}
+	lockPath := i.LockPath(name)
+	locked, err := ReadToolLock(lockPath)
+	if err != nil {
+		return err
+	}
+	current, err := i.Freeze(t)
+	if err != nil {
+		return err
+	}
+
+	pipEnv, err := i.pipEnv(context.Background(), InstallOptions{IndexURL: t.Source.URL})
+	if err != nil {
+		return err
+	}
+	want := lockedPackages(locked.Packages)
+	var extra []string
+	for pkg := range lockedPackages(current.Packages) {
+		if _, ok := want[pkg]; !ok {
+			extra = append(extra, pkg)
+		}
+	}
+	if len(extra) > 0 {
+		slices.Sort(extra)
+		if err := i.pip(t.InstallPath, pipEnv, append([]string{"uninstall", "--yes"}, extra...)...); err != nil {
+			return err
+		}
+	}
+	if err := i.pip(t.InstallPath, pipEnv, "install", "--no-deps", "-r", lockPath); err != nil {
+		return err
+	}
+
+	if integrity, err := RecordIntegrity(t.InstallPath); err == nil {
+		t.Integrity = integrity
+	}
+	t.UpdatedAt = time.Now()
+	i.manifest.UpdatedAt = t.UpdatedAt
+	if err := i.saveManifest(); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return nil
+}
+
+// lockedPackages maps the normalized name of each pip freeze line to its
+// version, or to its URL for direct references
+func lockedPackages(lines []string) map[string]string {
+	packages := make(map[string]string, len(lines))
+	for _, line := range lines {
+		name, version, ok := strings.Cut(line, "==")
+		if !ok {
+			name, version, _ = strings.Cut(line, " @ ")
+		}
+		packages[normalizeProjectName(strings.TrimSpace(name))] = strings.TrimSpace(version)
+	}
+	return packages
+}
@@ -0,0 +1,91 @@
+//go:build unix
+
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeFreezePip lists the frozen file of its venv with freeze, replaces it
+// with the packages of a requirements file on install -r, and removes
+// packages from it on uninstall
+const fakeFreezePip = `#!/bin/sh
+frozen="$(dirname "$0")/../frozen"
+case "$1" in
+freeze) cat "$frozen" ;;
+install) grep -v '^#' "$4" > "$frozen" ;;
+uninstall)
+	shift 2
+	for pkg; do grep -v "^$pkg==" "$frozen" > "$frozen.new"; mv "$frozen.new" "$frozen"; done ;;
+esac
+`
+
+func TestToolLock(t *testing.T) {
+	home := t.TempDir()
+	installer, err := NewInstaller(home, NewVenvManager(home, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	venv := filepath.Join(home, "tools", "demo", "venv")
+	os.MkdirAll(filepath.Join(venv, "bin"), 0755)
+	os.WriteFile(filepath.Join(venv, "bin", "pip"), []byte(fakeFreezePip), 0755)
+	os.WriteFile(filepath.Join(venv, "pyvenv.cfg"), []byte("home = /usr/bin\nversion = 3.12.1\n"), 0644)
+	frozen := filepath.Join(venv, "frozen")
+	os.WriteFile(frozen, []byte("requests==2.31.0\ndemo==1.0\n# Editable install with no version control (tool==0.1)\nPyYAML==6.0.1\n"), 0644)
+	tool := &Tool{Name: "demo", Version: "1.0", Ecosystem: "python", InstallPath: venv, Source: InstallSource{Type: SourcePyPI}}
+	installer.manifest.Tools["demo"] = tool
+
+	if err := installer.writeLock(tool); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := ReadToolLock(installer.LockPath("demo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ToolLock{Tool: "demo", Version: "1.0", Python: "3.12.1", Packages: []string{"PyYAML==6.0.1", "demo==1.0", "requests==2.31.0"}}
+	if !reflect.DeepEqual(lock, want) {
+		t.Errorf("lock = %+v, want %+v", lock, want)
+	}
+	if drift, err := installer.LockDrift(tool); err != nil || len(drift) != 0 {
+		t.Errorf("LockDrift() right after locking = %v, %v", drift, err)
+	}
+
+	os.WriteFile(frozen, []byte("requests==2.32.3\ndemo==1.0\nidna==3.7\n"), 0644)
+	drift, err := installer.LockDrift(tool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDrift := []string{"pyyaml is missing (locked 6.0.1)", "requests 2.32.3 (locked 2.31.0)", "idna 3.7 isn't locked"}
+	if !reflect.DeepEqual(drift, wantDrift) {
+		t.Errorf("LockDrift() = %q, want %q", drift, wantDrift)
+	}
+
+	if err := installer.SyncLock("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if drift, err := installer.LockDrift(tool); err != nil || len(drift) != 0 {
+		t.Errorf("LockDrift() after SyncLock = %v, %v", drift, err)
+	}
+
+	if err := installer.Uninstall("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(installer.LockPath("demo")); !os.IsNotExist(err) {
+		t.Error("uninstall left the lockfile behind")
+	}
+}
+
+func TestReadToolLockErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ReadToolLock(filepath.Join(dir, "missing.lock")); err == nil {
+		t.Error("read a missing lockfile")
+	}
+	plain := filepath.Join(dir, "requirements.txt")
+	os.WriteFile(plain, []byte("requests==2.31.0\n"), 0644)
+	if _, err := ReadToolLock(plain); err == nil {
+		t.Error("read a requirements.txt without the lock header")
+	}
+}
@@ -0,0 +1,315 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/httpclient"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// npmRegistry is the npm registry; tests point it elsewhere
+var npmRegistry = "https://registry.npmjs.org/"
+
+// NpmInstaller installs Node.js tools, each into an npm prefix of its own
+// so their node_modules never meet. The tool's bin directory holds wrappers
+// that run its executables with the node it was installed with.
+type NpmInstaller struct {
+	homeDir string
+}
+
+// NewNpmInstaller creates a new npm installer
+func NewNpmInstaller(homeDir string) *NpmInstaller {
+	return &NpmInstaller{homeDir: homeDir}
+}
+
+// Root returns the directory of a Node.js tool: its npm prefix and the bin
+// directory of its wrappers
+func (ni *NpmInstaller) Root(name string) string {
+	return filepath.Join(ni.homeDir, "tools", name, "node")
+}
+
+// Prefix returns the npm prefix a tool is installed into
+func (ni *NpmInstaller) Prefix(name string) string {
+	return filepath.Join(ni.Root(name), "npm")
+}
+
+// FindNode returns the node to install with: the newest one in
+// ~/.ophid/runtimes/node-<version> (from ophid runtime install node@<version>),
+// or else node from PATH
+func (ni *NpmInstaller) FindNode() (string, error) {
+	pattern := filepath.Join(ni.homeDir, "runtimes", "node-*", "bin", "node")
+	if runtime.GOOS == "windows" {
+		pattern = filepath.Join(ni.homeDir, "runtimes", "node-*", "node.exe")
+	}
+	managed, _ := filepath.Glob(pattern)
+	if len(managed) > 0 {
+		version := func(node string) string {
+			dir := filepath.Dir(node)
+			if runtime.GOOS != "windows" {
+				dir = filepath.Dir(dir)
+			}
+			return strings.TrimPrefix(filepath.Base(dir), "node-")
+		}
+		sort.Slice(managed, func(a, b int) bool { return gemVersionLess(version(managed[a]), version(managed[b])) })
+		return managed[len(managed)-1], nil
+	}
+	if node, err := exec.LookPath("node"); err == nil {
+		return node, nil
+	}
+	return "", errcode.Errorf(errcode.NotFound, "no Node.js found; install one with ophid runtime install node@<version> or in PATH")
+}
+
+// InstallPackage installs a package and its dependencies into prefix, at
+// version or the latest if version is "", with the npm next to node
+func (ni *NpmInstaller) InstallPackage(ctx context.Context, node, prefix, name, version string) error {
+	spec := name
+	if version != "" {
+		spec += "@" + version
+	}
+	// ophid scans with OSV itself; npm's audit and funding notices only add
+	// requests and noise
+	args := []string{"install", "--global", "--prefix", prefix, "--no-audit", "--no-fund", spec}
+	ui.Printf("Running: npm %s\n", strings.Join(args, " "))
+
+	npm := filepath.Join(filepath.Dir(node), "npm")
+	if runtime.GOOS == "windows" {
+		npm += ".cmd"
+	}
+	if _, err := os.Stat(npm); err != nil {
+		if npm, err = exec.LookPath("npm"); err != nil {
+			return errcode.Errorf(errcode.NotFound, "no npm found next to %s or in PATH", node)
+		}
+	}
+	cmd := exec.CommandContext(ctx, npm, args...)
+	cmd.Env = nodeEnv(node)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("npm install failed: %w", err)
+	}
+	return nil
+}
+
+// WriteWrappers writes a wrapper into binDir for each executable npm linked
+// into prefix, running it with node's directory first in PATH so that its
+// "#!/usr/bin/env node" finds the tool's node, and returns their names
+func (ni *NpmInstaller) WriteWrappers(node, prefix, binDir string) ([]string, error) {
+	entries, err := os.ReadDir(npmBinDir(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read installed executables: %w", err)
+	}
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", binDir, err)
+	}
+
+	nodeDir := filepath.Dir(node)
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			continue
+		}
+		path, content := filepath.Join(binDir, name), ""
+		if runtime.GOOS == "windows" {
+			// npm writes .cmd, .ps1 and sh shims for each executable on
+			// Windows; the .cmd ones are wrapped
+			if !strings.HasSuffix(name, ".cmd") {
+				continue
+			}
+			content = fmt.Sprintf("@echo off\r\nset \"PATH=%s;%%PATH%%\"\r\ncall \"%s\" %%*\r\n", nodeDir, filepath.Join(npmBinDir(prefix), name))
+		} else {
+			content = fmt.Sprintf("#!/bin/sh\nPATH=%s:\"$PATH\"\nexport PATH\nexec %s \"$@\"\n",
+				shellQuote(nodeDir), shellQuote(filepath.Join(npmBinDir(prefix), name)))
+		}
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			return nil, fmt.Errorf("failed to write %s wrapper: %w", name, err)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no executables installed")
+	}
+	return names, nil
+}
+
+// InstalledVersion returns the version of a package installed in prefix
+func (ni *NpmInstaller) InstalledVersion(prefix, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(npmModulesDir(prefix), filepath.FromSlash(name), "package.json"))
+	if err != nil {
+		return "", errcode.Wrap(errcode.NotFound, fmt.Errorf("%s isn't installed in %s: %w", name, prefix, err))
+	}
+	var pkg struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil || pkg.Version == "" {
+		return "", fmt.Errorf("failed to read the version of %s", name)
+	}
+	return pkg.Version, nil
+}
+
+// latestNpmVersion asks the npm registry for the latest version of a
+// package, its "latest" dist-tag
+func latestNpmVersion(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", npmRegistry+url.PathEscape(name), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	// The abbreviated metadata npm itself installs with
+	req.Header.Set("Accept", "application/vnd.npm.install-v1+json")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errcode.Wrap(errcode.Network, fmt.Errorf("failed to query the npm registry: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errcode.Errorf(errcode.NotFound, "package %s not found on npm", name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("npm registry returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		DistTags struct {
+			Latest string `json:"latest"`
+		} `json:"dist-tags"`
+	}
+	if err := json.NewDecoder(httpclient.Throttle(ctx, resp.Body)).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse npm registry response: %w", err)
+	}
+	if result.DistTags.Latest == "" {
+		return "", errcode.Errorf(errcode.NotFound, "package %s has no latest version on npm", name)
+	}
+	return result.DistTags.Latest, nil
+}
+
+// installFromNPM installs a package from the npm registry into its own
+// prefix
+func (i *Installer) installFromNPM(ctx context.Context, source InstallSource, opts InstallOptions) (*Tool, error) {
+	pkg := source.URL
+	name := npmToolName(pkg)
+	version := opts.Version
+	if version == "latest" {
+		version = ""
+	}
+	if version == "" {
+		latest, err := latestNpmVersion(ctx, pkg)
+		if errcode.Of(err) == errcode.NotFound {
+			return nil, err
+		}
+		if err != nil {
+			// npm install still finds the latest; only the scan needs a version
+			slog.Warn("failed to get version from the npm registry", "package", pkg, "error", err)
+		}
+		version = latest
+	}
+
+	var secInfo SecurityInfo
+	if !opts.SkipScan && version != "" {
+		slog.Info("running pre-installation security scan", "package", pkg, "version", version)
+		var scanErr error
+		secInfo, scanErr = i.scanPackage(ctx, "npm", pkg, version)
+		secInfo.VulnScanDate = time.Now()
+		if opts.Policy != nil {
+			in := releaseInput(pkg, version, source, secInfo, scanErr)
+			if err := enforcePolicy(opts.Policy, opts.Policy.EvaluateRelease(in), "installation"); err != nil {
+				return nil, err
+			}
+		}
+		if secInfo.VulnCount == 0 && scanErr == nil {
+			ui.OK("No vulnerabilities found")
+		}
+	}
+
+	node, err := i.npmInstaller.FindNode()
+	if err != nil {
+		return nil, err
+	}
+	root, prefix := i.npmInstaller.Root(name), i.npmInstaller.Prefix(name)
+	if err := os.RemoveAll(root); err != nil {
+		return nil, fmt.Errorf("failed to remove old install: %w", err)
+	}
+	if err := i.npmInstaller.InstallPackage(ctx, node, prefix, pkg, version); err != nil {
+		os.RemoveAll(root)
+		return nil, err
+	}
+	executables, err := i.npmInstaller.WriteWrappers(node, prefix, i.venvManager.GetBinDir(root))
+	if err != nil {
+		os.RemoveAll(root)
+		return nil, fmt.Errorf("%s: %w", pkg, err)
+	}
+	if installed, err := i.npmInstaller.InstalledVersion(prefix, pkg); err == nil {
+		version = installed
+	}
+
+	tool := &Tool{
+		Name:        name,
+		Version:     version,
+		Ecosystem:   "node",
+		Runtime:     "node",
+		InstallPath: root,
+		Executables: executables,
+		Source:      source,
+		Security:    secInfo,
+		Metadata:    map[string]string{"node": node},
+		InstalledAt: time.Now(),
+	}
+	i.putTool(tool, opts.Prefer)
+	i.manifest.UpdatedAt = time.Now()
+	if err := i.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	ui.Println()
+	ui.Success("%s@%s installed successfully from npm", pkg, version)
+	ui.Printf("  Executables: %s\n", strings.Join(executables, ", "))
+	if secInfo.VulnCount > 0 {
+		ui.Printf("  %s Vulnerabilities: %d total, %d critical\n", ui.Stderr.Tag(ui.LevelWarn), secInfo.VulnCount, secInfo.CriticalVulnCount)
+	}
+	return tool, nil
+}
+
+// npmToolName names the tool of an npm package: the package name, with a
+// scope folded in, so @angular/cli is angular-cli
+func npmToolName(pkg string) string {
+	if scope, name, ok := strings.Cut(strings.TrimPrefix(pkg, "@"), "/"); ok {
+		return scope + "-" + name
+	}
+	return pkg
+}
+
+// npmBinDir is where npm links the executables of packages installed
+// globally into prefix
+func npmBinDir(prefix string) string {
+	if runtime.GOOS == "windows" {
+		return prefix
+	}
+	return filepath.Join(prefix, "bin")
+}
+
+// npmModulesDir is where npm installs packages globally into prefix
+func npmModulesDir(prefix string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(prefix, "node_modules")
+	}
+	return filepath.Join(prefix, "lib", "node_modules")
+}
+
+// nodeEnv returns the environment that runs npm, and the scripts of the
+// packages it installs, with node
+func nodeEnv(node string) []string {
+	return append(os.Environ(), "PATH="+filepath.Dir(node)+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
@@ -0,0 +1,126 @@
+//go:build unix
+
+package tool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeNpm stands in for npm: "install --global --prefix <prefix> <spec>"
+// installs a package with one executable, which runs node
+const fakeNpm = `#!/bin/sh
+while [ $# -gt 1 ]; do
+	[ "$1" = --prefix ] && { prefix=$2; shift; }
+	shift
+done
+name=${1%@*}
+version=${1##*@}
+[ "$version" = "$1" ] && version=2.0.0
+mkdir -p "$prefix/bin" "$prefix/lib/node_modules/$name"
+echo "{\"name\": \"$name\", \"version\": \"$version\"}" > "$prefix/lib/node_modules/$name/package.json"
+printf '#!/bin/sh\nexec node "$@"\n' > "$prefix/bin/demo-cli"
+chmod +x "$prefix/bin/demo-cli"
+`
+
+func TestInstallFromNPM(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/demo", "/@acme%2Fdemo":
+			fmt.Fprint(w, `{"name": "demo", "dist-tags": {"latest": "1.10.0"}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	old := npmRegistry
+	npmRegistry = srv.URL + "/"
+	defer func() { npmRegistry = old }()
+
+	home := t.TempDir()
+	nodeBin := filepath.Join(home, "runtimes", "node-20.11.0", "bin")
+	os.MkdirAll(nodeBin, 0755)
+	os.WriteFile(filepath.Join(nodeBin, "node"), []byte("#!/bin/sh\necho \"node $*\"\n"), 0755)
+	os.WriteFile(filepath.Join(nodeBin, "npm"), []byte(fakeNpm), 0755)
+	installer, err := NewInstaller(home, NewVenvManager(home, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tool, err := installer.Install("demo", InstallOptions{SkipScan: true, Ecosystem: "node"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(home, "tools", "demo", "node")
+	if tool.Version != "1.10.0" || tool.Ecosystem != "node" || tool.InstallPath != root {
+		t.Errorf("tool = %s@%s (%s) in %s", tool.Name, tool.Version, tool.Ecosystem, tool.InstallPath)
+	}
+	if len(tool.Executables) != 1 || tool.Executables[0] != "demo-cli" {
+		t.Fatalf("executables = %v, want demo-cli", tool.Executables)
+	}
+
+	// The wrapper runs the executable with the tool's node
+	out, err := exec.Command(filepath.Join(root, "bin", "demo-cli"), "--help").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "node --help" {
+		t.Errorf("wrapper ran %q, want node --help", got)
+	}
+
+	// Scoped packages are named after scope and package
+	tool, err = installer.Install("npm:@acme/demo", InstallOptions{SkipScan: true, Version: "1.2.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tool.Name != "acme-demo" || tool.Version != "1.2.0" || tool.Source.URL != "@acme/demo" {
+		t.Errorf("tool = %s@%s from %s", tool.Name, tool.Version, tool.Source.URL)
+	}
+
+	if _, err := installer.Install("npm:missing", InstallOptions{SkipScan: true}); err == nil {
+		t.Error("installed a package npm doesn't have")
+	}
+
+	if err := installer.Uninstall("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Error("uninstall left the npm prefix behind")
+	}
+}
+
+func TestDetectNpmSource(t *testing.T) {
+	sd := NewSourceDetector()
+	for spec, want := range map[string]string{
+		"npm:prettier":                            "prettier",
+		"https://www.npmjs.com/package/prettier":  "prettier",
+		"npmjs.com/package/@angular/cli/v/17.0.0": "@angular/cli",
+		"npm:@mermaid-js/mermaid-cli":             "@mermaid-js/mermaid-cli",
+	} {
+		source, err := sd.DetectSource(spec, InstallOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if source.Type != SourceNPM || source.URL != want {
+			t.Errorf("%s: got %s %q, want npm %s", spec, source.Type, source.URL, want)
+		}
+	}
+
+	if source, err := sd.DetectSource("prettier", InstallOptions{Ecosystem: "node"}); err != nil || source.Type != SourceNPM {
+		t.Errorf("--ecosystem node: got %s, %v", source.Type, err)
+	}
+	for _, spec := range []string{"npm:", "npm:@scope", "npm:.hidden", "npm:a b"} {
+		if source, err := sd.DetectSource(spec, InstallOptions{Ecosystem: "node"}); err == nil {
+			t.Errorf("%s: detected %s %q", spec, source.Type, source.URL)
+		}
+	}
+	if _, err := sd.DetectSource("prettier", InstallOptions{Ecosystem: "perl"}); err == nil {
+		t.Error("accepted an unsupported ecosystem")
+	}
+}
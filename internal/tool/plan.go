@@ -0,0 +1,203 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/security"
+)
+
+// PlannedPackage is a package installing a tool would download
+type PlannedPackage struct {
+	Name            string            `json:"name"`
+	Version         string            `json:"version"`
+	File            string            `json:"file"`                      // Wheel or source archive
+	Size            int64             `json:"size,omitempty"`            // Download size in bytes; 0 when the index doesn't say
+	Build           bool              `json:"build,omitempty"`           // A source archive pip would build
+	Vulnerabilities []string          `json:"vulnerabilities,omitempty"` // OSV IDs
+	Critical        int               `json:"critical,omitempty"`
+	Severity        security.Severity `json:"severity,omitempty"` // Worst vulnerability
+	ScanError       string            `json:"scan_error,omitempty"`
+}
+
+// InstallPlan is what installing a Python tool would download, found
+// without installing anything
+type InstallPlan struct {
+	Tool         string           `json:"tool"`
+	Version      string           `json:"version"`
+	Packages     []PlannedPackage `json:"packages"`
+	DownloadSize int64            `json:"download_size"`
+	UnknownSizes int              `json:"unknown_sizes,omitempty"` // Packages whose size is missing from DownloadSize
+	Scanned      bool             `json:"scanned"`
+}
+
+// Vulnerable returns the packages with known vulnerabilities
+func (p *InstallPlan) Vulnerable() []PlannedPackage {
+	var vulnerable []PlannedPackage
+	for _, pkg := range p.Packages {
+		if len(pkg.Vulnerabilities) > 0 {
+			vulnerable = append(vulnerable, pkg)
+		}
+	}
+	return vulnerable
+}
+
+// Plan resolves the packages installing a Python tool with opts would
+// download, with pip install --dry-run --report, and unless opts.SkipScan
+// scans them for vulnerabilities. Nothing is written to disk.
+func (i *Installer) Plan(ctx context.Context, name string, opts InstallOptions) (*InstallPlan, error) {
+	var pipArgs []string
+	if opts.Profile != "" {
+		profile, err := LookupProfile(opts.Profile)
+		if err != nil {
+			return nil, err
+		}
+		if profile.Archive {
+			return nil, fmt.Errorf("profile %s installs from the vendor's archive, which can't be previewed", profile.Name)
+		}
+		name, pipArgs = profile.Tool, profile.PipArgs
+	} else {
+		source, err := i.sourceDetector.DetectSource(name, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect source: %w", err)
+		}
+		if source.Type != SourcePyPI {
+			return nil, fmt.Errorf("only Python tools from a package index can be previewed; %s installs from %s", name, source.Type)
+		}
+	}
+
+	pipEnv, err := i.pipEnv(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ParseBuildPolicy(string(opts.BuildPolicy))
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-m", "pip", "install", "--dry-run", "--quiet", "--ignore-installed", "--report", "-"}
+	args = append(args, pipArgs...)
+	for _, arg := range policy.PipArgs() {
+		if !slices.Contains(args, arg) {
+			args = append(args, arg)
+		}
+	}
+	requirement := name
+	if opts.Version != "" && opts.Version != "latest" {
+		requirement = name + "==" + opts.Version
+	}
+	if len(opts.Extras) > 0 {
+		requirement = fmt.Sprintf("%s[%s]", requirement, strings.Join(opts.Extras, ","))
+	}
+	args = append(args, requirement)
+
+	var stderr tailBuffer
+	cmd := exec.CommandContext(ctx, i.venvManager.pythonPath, args...)
+	cmd.Env = pipEnv
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if m := noMatchingVersion.FindStringSubmatch(stderr.String()); m != nil {
+			return nil, errcode.Errorf(errcode.NotFound, "no version of %s matches %s", m[1], requirement)
+		}
+		return nil, fmt.Errorf("failed to resolve %s: %w\n%s", requirement, err, strings.TrimSpace(stderr.String()))
+	}
+	report, err := readPipReport(out)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &InstallPlan{Tool: name, Version: opts.Version}
+	urls := make([]string, len(report))
+	for n, pkg := range report {
+		file := pkg.DownloadInfo.URL
+		if u, err := url.Parse(file); err == nil {
+			file = path.Base(u.Path)
+		}
+		plan.Packages = append(plan.Packages, PlannedPackage{
+			Name:    normalizeProjectName(pkg.Metadata.Name),
+			Version: pkg.Metadata.Version,
+			File:    file,
+			Build:   !strings.HasSuffix(file, ".whl"),
+		})
+		urls[n] = pkg.DownloadInfo.URL
+		if normalizeProjectName(pkg.Metadata.Name) == normalizeProjectName(name) {
+			plan.Version = pkg.Metadata.Version
+		}
+	}
+
+	downloadSizes(ctx, plan.Packages, urls)
+	for _, pkg := range plan.Packages {
+		if pkg.Size == 0 {
+			plan.UnknownSizes++
+		}
+		plan.DownloadSize += pkg.Size
+	}
+
+	if !opts.SkipScan {
+		i.scanPlan(ctx, plan)
+	}
+	sort.Slice(plan.Packages, func(a, b int) bool { return plan.Packages[a].Name < plan.Packages[b].Name })
+	return plan, nil
+}
+
+// downloadSizes fills in the sizes of packages from the Content-Length of
+// their download URLs, a few at a time
+func downloadSizes(ctx context.Context, packages []PlannedPackage, urls []string) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for n := range packages {
+		wg.Add(1)
+		go func(pkg *PlannedPackage, rawURL string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			req, err := http.NewRequestWithContext(ctx, "HEAD", rawURL, nil)
+			if err != nil {
+				return
+			}
+			resp, err := pypiClient().Do(req)
+			if err != nil {
+				slog.Debug("failed to get download size", "package", pkg.Name, "error", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK && resp.ContentLength > 0 {
+				pkg.Size = resp.ContentLength
+			}
+		}(&packages[n], urls[n])
+	}
+	wg.Wait()
+}
+
+// scanPlan looks up the vulnerabilities of the packages of a plan on OSV
+func (i *Installer) scanPlan(ctx context.Context, plan *InstallPlan) {
+	packages := make([]security.Package, len(plan.Packages))
+	for n, pkg := range plan.Packages {
+		packages[n] = security.Package{Name: pkg.Name, Version: pkg.Version, Ecosystem: "PyPI"}
+	}
+	results, err := i.scanner.ScanPackages(ctx, packages)
+	if err != nil {
+		slog.Warn("vulnerability scan failed", "tool", plan.Tool, "error", err)
+		return
+	}
+	plan.Scanned = true
+	for n := range results {
+		pkg := &plan.Packages[n]
+		pkg.ScanError = results[n].Error
+		pkg.Critical = results[n].CriticalCount()
+		pkg.Severity = results[n].MaxSeverity()
+		for _, vuln := range results[n].Vulnerabilities {
+			pkg.Vulnerabilities = append(pkg.Vulnerabilities, vuln.ID)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+//go:build unix
+
+package tool
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakePlanPython reports ansible, a wheel, and a dependency only
+// available as a source archive, downloadable from %s
+const fakePlanPython = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args.log"
+cat <<'REPORT'
+{"version": "1", "install": [
+ {"metadata": {"name": "ansible", "version": "9.1.0"}, "download_info": {"url": "%[1]s/ansible-9.1.0-py3-none-any.whl", "archive_info": {"hashes": {"sha256": "aaa"}}}},
+ {"metadata": {"name": "Jinja2", "version": "3.1.2"}, "download_info": {"url": "%[1]s/jinja2-3.1.2.tar.gz", "archive_info": {"hashes": {"sha256": "bbb"}}}}
+]}
+REPORT
+`
+
+func TestPlan(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".whl") {
+			w.Header().Set("Content-Length", "1000")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	home := t.TempDir()
+	python := filepath.Join(home, "python3")
+	os.WriteFile(python, []byte(fmt.Sprintf(fakePlanPython, srv.URL)), 0755)
+	installer, err := NewInstaller(home, NewVenvManager(home, python))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := installer.Plan(context.Background(), "ansible", InstallOptions{Version: "9.1.0", SkipScan: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Version != "9.1.0" || len(plan.Packages) != 2 || plan.Scanned {
+		t.Fatalf("plan = %+v", plan)
+	}
+	ansible, jinja := plan.Packages[0], plan.Packages[1]
+	if ansible.Name != "ansible" || ansible.Size != 1000 || ansible.Build || ansible.File != "ansible-9.1.0-py3-none-any.whl" {
+		t.Errorf("ansible = %+v", ansible)
+	}
+	if jinja.Name != "jinja2" || jinja.Size != 0 || !jinja.Build {
+		t.Errorf("jinja2 = %+v, want a build of unknown size", jinja)
+	}
+	if plan.DownloadSize != 1000 || plan.UnknownSizes != 1 {
+		t.Errorf("download size = %d with %d unknown", plan.DownloadSize, plan.UnknownSizes)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(home, "args.log"))
+	if !strings.Contains(string(args), "--dry-run") || !strings.HasSuffix(strings.TrimSpace(string(args)), "ansible==9.1.0") {
+		t.Errorf("pip ran with %s", args)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(home, "tools")); len(entries) > 0 {
+		t.Errorf("planning wrote %v", entries)
+	}
+
+	if _, err := installer.Plan(context.Background(), "cargo:ripgrep", InstallOptions{SkipScan: true}); err == nil {
+		t.Error("planned a Rust tool")
+	}
+}
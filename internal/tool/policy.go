@@ -0,0 +1,157 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/security/policy"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// enforcePolicy reports the violations of a security policy: with a
+// blocking policy as a PolicyBlocked error, otherwise as warnings
+func enforcePolicy(p *policy.Policy, violations []policy.Violation, action string) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	if p.Blocks() {
+		messages := make([]string, len(violations))
+		for n, v := range violations {
+			messages[n] = fmt.Sprintf("  - %s (%s)", v.Message, v.Rule)
+		}
+		return errcode.Errorf(errcode.PolicyBlocked, "%s blocked by policy:\n%s", action, strings.Join(messages, "\n"))
+	}
+	for _, v := range violations {
+		ui.Warn("Policy: %s", v.Message)
+	}
+	return nil
+}
+
+// checkSourcePolicy applies the source rules of opts.Policy, before
+// anything is downloaded
+func checkSourcePolicy(name string, source InstallSource, opts InstallOptions) error {
+	if opts.Policy == nil {
+		return nil
+	}
+	in := policy.Input{Name: name, SourceType: string(source.Type), Location: policyLocation(source)}
+	if source.Type != SourceGit && source.Type != SourceGitHub && source.Type != SourceLocal && source.URL != "" {
+		in.Name = source.URL
+	}
+	return enforcePolicy(opts.Policy, opts.Policy.EvaluateSource(in), "installation")
+}
+
+// policyLocation returns what the source rules of a policy match: the
+// package of registries, the repository of git sources without scheme or
+// credentials, like github.com/org/tool, and the path of local ones
+func policyLocation(source InstallSource) string {
+	switch source.Type {
+	case SourceLocal:
+		return source.Path
+	case SourceGit, SourceGitHub:
+		location := RedactURL(source.URL)
+		if _, rest, ok := strings.Cut(location, "://"); ok {
+			location = rest
+		}
+		if _, rest, ok := strings.Cut(location, "@"); ok {
+			location = strings.Replace(rest, ":", "/", 1) // git@github.com:org/tool
+		}
+		return strings.TrimSuffix(location, ".git")
+	}
+	return source.URL
+}
+
+// releaseInput is the policy input of a scanned release
+func releaseInput(name, version string, source InstallSource, secInfo SecurityInfo, scanErr error) policy.Input {
+	return policy.Input{
+		Name:       name,
+		Version:    version,
+		SourceType: string(source.Type),
+		Location:   policyLocation(source),
+		Licenses:   secInfo.Licenses,
+		ScanFailed: scanErr != nil,
+		Severity:   secInfo.MaxSeverity,
+		Vulns:      secInfo.VulnCount,
+	}
+}
+
+// pypiRelease returns the licenses of a PyPI project and when a version
+// of it was published, for the policy rules needing them
+func pypiRelease(ctx context.Context, homeDir, name, version string) ([]string, time.Time, error) {
+	data, err := fetchPyPIJSON(ctx, homeDir, name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var result struct {
+		Info struct {
+			License           string   `json:"license"`
+			LicenseExpression string   `json:"license_expression"`
+			Classifiers       []string `json:"classifiers"`
+		} `json:"info"`
+		Releases map[string][]struct {
+			UploadTime time.Time `json:"upload_time_iso_8601"`
+		} `json:"releases"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse PyPI response: %w", err)
+	}
+
+	var licenses []string
+	if license := pypiLicense(result.Info.LicenseExpression, result.Info.License, result.Info.Classifiers); license != "" {
+		licenses = []string{license}
+	}
+	// A version's first file is when it was released
+	var released time.Time
+	for _, file := range result.Releases[version] {
+		if released.IsZero() || file.UploadTime.Before(released) {
+			released = file.UploadTime
+		}
+	}
+	return licenses, released, nil
+}
+
+// checkPyPIRelease applies the release rules of a policy to a PyPI
+// version, with its licenses and release time when the policy needs them
+func (i *Installer) checkPyPIRelease(ctx context.Context, p *policy.Policy, name, version string, source InstallSource, secInfo *SecurityInfo, scanErr error, action string) error {
+	if p == nil {
+		return nil
+	}
+	if source.Type == "" {
+		source = InstallSource{Type: SourcePyPI, URL: name}
+	}
+	in := releaseInput(name, version, source, *secInfo, scanErr)
+	if p.NeedsMetadata() && version != "" && version != "latest" {
+		licenses, released, err := pypiRelease(ctx, i.homeDir, name, version)
+		if err != nil {
+			ui.Warn("Failed to look up the license and release date of %s@%s: %v", name, version, err)
+		} else {
+			in.Licenses, in.Released = licenses, released
+			secInfo.Licenses = licenses
+		}
+	}
+	return enforcePolicy(p, p.EvaluateRelease(in), action)
+}
+
+// Violations returns the rules of a policy the packages of a plan break.
+// Banned packages and the vulnerability rules apply to every package; the
+// source rules only to the tool, not to what it depends on.
+func (p *InstallPlan) Violations(pol *policy.Policy) []policy.Violation {
+	violations := pol.EvaluateSource(policy.Input{SourceType: string(SourcePyPI), Location: p.Tool})
+	for _, pkg := range p.Packages {
+		in := policy.Input{
+			Name:       pkg.Name,
+			Version:    pkg.Version,
+			SourceType: string(SourcePyPI),
+			Location:   pkg.Name,
+			ScanFailed: pkg.ScanError != "",
+			Severity:   pkg.Severity,
+			Vulns:      len(pkg.Vulnerabilities),
+		}
+		violations = append(violations, pol.EvaluateSource(policy.Input{Name: pkg.Name})...)
+		violations = append(violations, pol.EvaluateRelease(in)...)
+	}
+	return violations
+}
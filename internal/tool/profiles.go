@@ -0,0 +1,303 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/httpclient"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// Cloud providers whose credentials `ophid doctor` checks
+const (
+	ProviderAWS   = "aws"
+	ProviderGCP   = "gcp"
+	ProviderAzure = "azure"
+)
+
+// ProfileMetadataKey is the InstallSource metadata key that records the
+// profile a tool was installed with
+const ProfileMetadataKey = "profile"
+
+// gcloudArchiveURL is Google's Cloud CLI archive: version ("" for the
+// latest), os and arch
+const gcloudArchiveURL = "https://dl.google.com/dl/cloudsdk/channels/rapid/downloads/google-cloud-cli-%s%s-%s.tar.gz"
+
+// Profile is a curated install of a tool that needs more than `pip install`
+type Profile struct {
+	Name        string // What `ophid install --profile` takes
+	Tool        string // Name the tool is installed as
+	Provider    string // Cloud whose credentials it uses
+	Description string
+	Login       string   // Command that sets up credentials, e.g. "aws configure"
+	PipArgs     []string // Extra pip install arguments
+	UpgradePip  bool     // Upgrade pip in the venv first
+	Executables []string // Executables to expose (default: all in the venv)
+	Archive     bool     // Installed from the vendor's archive instead of PyPI
+	SmokeTest   []string // Command checking the install works
+}
+
+var profiles = []Profile{
+	{
+		Name:        "aws",
+		Tool:        "awscli",
+		Provider:    ProviderAWS,
+		Description: "AWS CLI v1 from PyPI (v2 isn't published there)",
+		Login:       "aws configure",
+		PipArgs:     []string{"--prefer-binary"}, // PyYAML and awscrt otherwise build from source on new Pythons
+		Executables: []string{"aws", "aws_completer"},
+		SmokeTest:   []string{"aws", "--version"},
+	},
+	{
+		Name:        "azure",
+		Tool:        "azure-cli",
+		Provider:    ProviderAzure,
+		Description: "Azure CLI (az)",
+		Login:       "az login",
+		PipArgs:     []string{"--prefer-binary"},
+		UpgradePip:  true, // Older pips backtrack for ages over azure-cli's pinned dependencies
+		Executables: []string{"az"},
+		SmokeTest:   []string{"az", "version"},
+	},
+	{
+		Name:        "gcloud",
+		Tool:        "gcloud",
+		Provider:    ProviderGCP,
+		Description: "Google Cloud CLI (gcloud, gsutil, bq) from Google's archive; add components with --component",
+		Login:       "gcloud auth login",
+		Archive:     true,
+		SmokeTest:   []string{"gcloud", "--version"},
+	},
+}
+
+// Profiles returns the curated install profiles
+func Profiles() []Profile {
+	return slices.Clone(profiles)
+}
+
+// LookupProfile returns the profile with a name
+func LookupProfile(name string) (Profile, error) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+
+	var names []string
+	for _, p := range profiles {
+		names = append(names, p.Name)
+	}
+	return Profile{}, errcode.Errorf(errcode.NotFound, "unknown profile %s (available: %s)", name, strings.Join(names, ", "))
+}
+
+// ProfileOf returns the profile an installed tool came from, recognizing
+// tools installed by hand under a profile's tool name too
+func ProfileOf(t *Tool) (Profile, bool) {
+	if name := t.Source.Metadata[ProfileMetadataKey]; name != "" {
+		p, err := LookupProfile(name)
+		return p, err == nil
+	}
+	for _, p := range profiles {
+		if p.Tool == t.Name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// installProfile installs a tool the way its profile says
+func (i *Installer) installProfile(ctx context.Context, p Profile, opts InstallOptions) (*Tool, error) {
+	source := InstallSource{Type: SourcePyPI, Metadata: map[string]string{ProfileMetadataKey: p.Name}}
+	if p.Archive {
+		return i.installGcloud(ctx, p, source, opts)
+	}
+	if len(opts.Components) > 0 {
+		return nil, fmt.Errorf("profile %s has no components", p.Name)
+	}
+	return i.installFromPyPI(ctx, p.Tool, source, opts)
+}
+
+// installGcloud installs the Google Cloud CLI from Google's archive into
+// the tool's venv, whose Python it runs on, plus any components
+func (i *Installer) installGcloud(ctx context.Context, p Profile, source InstallSource, opts InstallOptions) (*Tool, error) {
+	url, err := gcloudURL(opts.Version, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return nil, err
+	}
+	source.Type = SourceArchive
+	source.URL = url
+
+	venvPath, err := i.venvManager.Create(p.Tool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create venv: %w", err)
+	}
+
+	// The SDK lives inside the venv so uninstalling removes both
+	sdkDir := filepath.Join(venvPath, "google-cloud-sdk")
+	if opts.Force {
+		if err := os.RemoveAll(sdkDir); err != nil {
+			return nil, fmt.Errorf("failed to remove old SDK: %w", err)
+		}
+	}
+	if _, err := os.Stat(sdkDir); os.IsNotExist(err) {
+		archive := filepath.Join(i.homeDir, "cache", filepath.Base(url))
+		if err := downloadFile(ctx, url, archive); err != nil {
+			return nil, err
+		}
+		ui.Printf("Unpacking %s\n", filepath.Base(archive))
+		cmd := exec.CommandContext(ctx, "tar", "-xzf", archive, "-C", venvPath)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("failed to unpack %s: %w\n%s", archive, err, out)
+		}
+	}
+
+	python := i.venvManager.GetPythonPath(venvPath)
+	if len(opts.Components) > 0 {
+		args := append([]string{"components", "install", "--quiet"}, opts.Components...)
+		ui.Printf("Running: gcloud %s\n", strings.Join(args, " "))
+		cmd := exec.CommandContext(ctx, filepath.Join(sdkDir, "bin", "gcloud"), args...)
+		cmd.Env = append(os.Environ(), "CLOUDSDK_PYTHON="+python)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("failed to install components: %w", err)
+		}
+	}
+
+	executables, err := writeSDKWrappers(filepath.Join(sdkDir, "bin"), i.venvManager.GetBinDir(venvPath), python)
+	if err != nil {
+		return nil, err
+	}
+
+	version := "unknown"
+	if data, err := os.ReadFile(filepath.Join(sdkDir, "VERSION")); err == nil {
+		version = strings.TrimSpace(string(data))
+	}
+
+	tool := &Tool{
+		Name:        p.Tool,
+		Version:     version,
+		Ecosystem:   "python",
+		Runtime:     pythonRuntimeOf(opts),
+		InstallPath: venvPath,
+		Executables: executables,
+		Source:      source,
+		InstalledAt: time.Now(),
+	}
+	if len(opts.Components) > 0 {
+		tool.Metadata = map[string]string{"components": strings.Join(opts.Components, ",")}
+	}
+
+	i.putTool(tool, opts.Prefer)
+	i.manifest.UpdatedAt = time.Now()
+	if err := i.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	ui.Println()
+	ui.Success("%s@%s installed successfully from %s", p.Tool, version, url)
+	ui.Printf("  Executables: %s\n", strings.Join(executables, ", "))
+	ui.Printf("  %s The archive isn't security scanned or checksum verified\n", ui.Stderr.Tag(ui.LevelWarn))
+	return tool, nil
+}
+
+// gcloudURL returns the archive for a Cloud CLI version ("" or "latest"
+// for the latest) and platform
+func gcloudURL(version, goos, goarch string) (string, error) {
+	if goos != "linux" && goos != "darwin" {
+		return "", fmt.Errorf("the gcloud profile supports Linux and macOS; on %s use Google's installer", goos)
+	}
+
+	arches := map[string]string{"amd64": "x86_64", "arm64": "arm", "386": "x86"}
+	arch, ok := arches[goarch]
+	if !ok || (goos == "darwin" && goarch == "386") {
+		return "", fmt.Errorf("no Google Cloud CLI archive for %s/%s", goos, goarch)
+	}
+
+	if version != "" && version != "latest" {
+		version += "-"
+	} else {
+		version = ""
+	}
+	return fmt.Sprintf(gcloudArchiveURL, version, goos, arch), nil
+}
+
+// writeSDKWrappers writes a script into binDir for each executable in
+// sdkBin that runs it on python, and returns their names
+func writeSDKWrappers(sdkBin, binDir, python string) ([]string, error) {
+	entries, err := os.ReadDir(sdkBin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SDK bin directory: %w", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() || !isExecutable(filepath.Join(sdkBin, e.Name())) {
+			continue
+		}
+
+		// CLOUDSDK_PYTHON stays overridable; the SDK otherwise picks any python3 in PATH
+		script := fmt.Sprintf("#!/bin/sh\n: \"${CLOUDSDK_PYTHON:=%s}\"\nexport CLOUDSDK_PYTHON\nexec %q \"$@\"\n",
+			python, filepath.Join(sdkBin, e.Name()))
+		if err := os.WriteFile(filepath.Join(binDir, e.Name()), []byte(script), 0755); err != nil {
+			return nil, fmt.Errorf("failed to write %s wrapper: %w", e.Name(), err)
+		}
+		names = append(names, e.Name())
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no executables in %s", sdkBin)
+	}
+	return names, nil
+}
+
+// downloadFile downloads url to path, reusing an earlier download
+func downloadFile(ctx context.Context, url, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		ui.Printf("Using cached %s\n", filepath.Base(path))
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	ui.Printf("Downloading %s\n", url)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errcode.Wrap(errcode.Network, fmt.Errorf("failed to download: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errcode.Errorf(errcode.Network, "download of %s failed with status: %d", url, resp.StatusCode)
+	}
+
+	// Download next to the target so a partial file is never reused
+	tmp := path + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if _, err := io.Copy(out, httpclient.Throttle(ctx, resp.Body)); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return errcode.Wrap(errcode.Network, fmt.Errorf("failed to download: %w", err))
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, path)
+}
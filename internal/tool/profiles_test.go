@@ -0,0 +1,87 @@
+package tool
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func TestLookupProfile(t *testing.T) {
+	p, err := LookupProfile("aws")
+	if err != nil || p.Tool != "awscli" || p.Provider != ProviderAWS {
+		t.Errorf("LookupProfile(aws) = %+v, %v", p, err)
+	}
+	if _, err := LookupProfile("ibmcloud"); errcode.Of(err) != errcode.NotFound || !strings.Contains(err.Error(), "gcloud") {
+		t.Errorf("LookupProfile(ibmcloud) error = %v, want not found listing the profiles", err)
+	}
+
+	byMetadata := &Tool{Name: "az-tools", Source: InstallSource{Metadata: map[string]string{ProfileMetadataKey: "azure"}}}
+	if p, ok := ProfileOf(byMetadata); !ok || p.Name != "azure" {
+		t.Errorf("ProfileOf(metadata) = %+v, %v", p, ok)
+	}
+	if p, ok := ProfileOf(&Tool{Name: "awscli"}); !ok || p.Name != "aws" {
+		t.Errorf("ProfileOf(awscli) = %+v, %v", p, ok)
+	}
+	if _, ok := ProfileOf(&Tool{Name: "ansible"}); ok {
+		t.Error("ProfileOf(ansible) should find nothing")
+	}
+}
+
+func TestGcloudURL(t *testing.T) {
+	tests := []struct {
+		version, goos, goarch string
+		want                  string
+	}{
+		{"", "linux", "amd64", "google-cloud-cli-linux-x86_64.tar.gz"},
+		{"latest", "darwin", "arm64", "google-cloud-cli-darwin-arm.tar.gz"},
+		{"494.0.0", "linux", "arm64", "google-cloud-cli-494.0.0-linux-arm.tar.gz"},
+		{"", "windows", "amd64", ""},
+		{"", "darwin", "386", ""},
+	}
+	for _, tt := range tests {
+		url, err := gcloudURL(tt.version, tt.goos, tt.goarch)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("gcloudURL(%s/%s) = %s, want an error", tt.goos, tt.goarch, url)
+			}
+			continue
+		}
+		if err != nil || !strings.HasSuffix(url, "/"+tt.want) {
+			t.Errorf("gcloudURL(%q, %s/%s) = %s, %v, want .../%s", tt.version, tt.goos, tt.goarch, url, err, tt.want)
+		}
+	}
+}
+
+func TestWriteSDKWrappers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("wrappers are shell scripts")
+	}
+
+	dir := t.TempDir()
+	sdkBin, binDir := filepath.Join(dir, "sdk", "bin"), filepath.Join(dir, "venv", "bin")
+	os.MkdirAll(filepath.Join(sdkBin, "dev_appserver.d"), 0755)
+	os.MkdirAll(binDir, 0755)
+	os.WriteFile(filepath.Join(sdkBin, "gcloud"), []byte("#!/bin/sh\necho \"$CLOUDSDK_PYTHON $*\"\n"), 0755)
+	os.WriteFile(filepath.Join(sdkBin, "README"), []byte("docs"), 0644)
+
+	names, err := writeSDKWrappers(sdkBin, binDir, "/venv/bin/python")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "gcloud" {
+		t.Errorf("wrapped %v, want just gcloud", names)
+	}
+
+	out, err := exec.Command(filepath.Join(binDir, "gcloud"), "config", "list").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "/venv/bin/python config list" {
+		t.Errorf("wrapper ran %q", got)
+	}
+}
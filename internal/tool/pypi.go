@@ -0,0 +1,150 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/httpclient"
+)
+
+// pypiMetadataTTL is how long a cached PyPI JSON API answer is used before
+// PyPI is asked whether it changed
+const pypiMetadataTTL = 10 * time.Minute
+
+// pypiTransport is shared by PyPI lookups, so the connections of one
+// command are reused; search describes up to 8 projects at a time. It is
+// made on first use, once httpclient has its CA bundle.
+var pypiTransport = sync.OnceValue(func() *http.Transport {
+	t := httpclient.Transport()
+	t.MaxIdleConnsPerHost = 8
+	return t
+})
+
+// pypiClient makes PyPI JSON API requests
+var pypiClient = sync.OnceValue(func() *http.Client {
+	return &http.Client{Timeout: 10 * time.Second, Transport: pypiTransport()}
+})
+
+// pypiCacheEntry is a cached PyPI JSON API answer
+type pypiCacheEntry struct {
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"last_modified,omitempty"`
+	CheckedAt    time.Time       `json:"checked_at"` // When PyPI last confirmed it
+	Body         json.RawMessage `json:"body"`
+}
+
+// pypiCachePath returns where the answer for a project is cached
+func pypiCachePath(homeDir, name string) string {
+	return filepath.Join(homeDir, "cache", "pypi", "json", normalizeProjectName(name)+".json")
+}
+
+// fetchPyPIJSON returns the PyPI JSON API document of a project. Answers
+// are cached under homeDir for pypiMetadataTTL, then revalidated with
+// their ETag and Last-Modified; a stale answer is used when PyPI can't be
+// reached. An empty homeDir disables the cache.
+func fetchPyPIJSON(ctx context.Context, homeDir, name string) ([]byte, error) {
+	var cached *pypiCacheEntry
+	path := pypiCachePath(homeDir, name)
+	if homeDir != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			var entry pypiCacheEntry
+			if err := json.Unmarshal(data, &entry); err == nil && len(entry.Body) > 0 {
+				cached = &entry
+			}
+		}
+	}
+	if cached != nil && time.Since(cached.CheckedAt) < pypiMetadataTTL {
+		return cached.Body, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", pypiJSONURL+name+"/json", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := pypiClient().Do(req)
+	if err != nil {
+		if cached != nil && ctx.Err() == nil {
+			slog.Debug("using cached PyPI metadata", "project", name, "checked_at", cached.CheckedAt, "error", err)
+			return cached.Body, nil
+		}
+		return nil, errcode.Wrap(errcode.Network, fmt.Errorf("failed to query PyPI: %w", err))
+	}
+	defer resp.Body.Close()
+
+	var entry pypiCacheEntry
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		io.Copy(io.Discard, resp.Body)
+		entry = *cached
+	case resp.StatusCode == http.StatusNotFound:
+		if homeDir != "" {
+			os.Remove(path)
+		}
+		return nil, errcode.Errorf(errcode.NotFound, "%s not found on PyPI", name)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("PyPI returned status %d", resp.StatusCode)
+	default:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, errcode.Wrap(errcode.Network, fmt.Errorf("failed to read PyPI response: %w", err))
+		}
+		if !json.Valid(body) {
+			return nil, fmt.Errorf("failed to parse PyPI response: invalid JSON")
+		}
+		entry = pypiCacheEntry{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), Body: body}
+	}
+	entry.CheckedAt = time.Now()
+
+	if homeDir != "" {
+		if err := writePyPICache(path, &entry); err != nil {
+			slog.Debug("failed to cache PyPI metadata", "project", name, "error", err)
+		}
+	}
+	return entry.Body, nil
+}
+
+// writePyPICache writes a cache entry through a temporary file, as
+// lookups run concurrently
+func writePyPICache(path string, entry *pypiCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pypi-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
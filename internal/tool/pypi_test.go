@@ -0,0 +1,78 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFetchPyPIJSON(t *testing.T) {
+	var requests, revalidated int
+	version := "1.0"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		etag := `"` + version + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode(map[string]any{"info": map[string]string{"version": version}})
+	}))
+	oldJSON := pypiJSONURL
+	pypiJSONURL = srv.URL + "/pypi/"
+	t.Cleanup(func() { pypiJSONURL = oldJSON })
+
+	home := t.TempDir()
+	latest := func() string {
+		t.Helper()
+		meta, err := fetchPyPIMetadata(context.Background(), home, "Ansible_Core")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return meta.LatestVersion
+	}
+	// expire makes the cached answer older than the TTL
+	expire := func() {
+		path := pypiCachePath(home, "ansible-core")
+		var entry pypiCacheEntry
+		data, _ := os.ReadFile(path)
+		json.Unmarshal(data, &entry)
+		entry.CheckedAt = time.Now().Add(-pypiMetadataTTL)
+		data, _ = json.Marshal(entry)
+		os.WriteFile(path, data, 0644)
+	}
+
+	if v := latest(); v != "1.0" || requests != 1 {
+		t.Fatalf("first lookup = %s after %d requests", v, requests)
+	}
+	if v := latest(); v != "1.0" || requests != 1 {
+		t.Errorf("cached lookup = %s after %d requests, want no request", v, requests)
+	}
+
+	expire()
+	if v := latest(); v != "1.0" || requests != 2 || revalidated != 1 {
+		t.Errorf("expired lookup = %s after %d requests, %d revalidated", v, requests, revalidated)
+	}
+
+	version = "2.0"
+	expire()
+	if v := latest(); v != "2.0" || requests != 3 {
+		t.Errorf("changed lookup = %s after %d requests", v, requests)
+	}
+
+	// Offline, the stale answer is used
+	srv.Close()
+	expire()
+	if v := latest(); v != "2.0" {
+		t.Errorf("offline lookup = %s", v)
+	}
+	if _, err := fetchPyPIMetadata(context.Background(), home, "uncached"); err == nil {
+		t.Error("offline lookup of an uncached project succeeded")
+	}
+}
@@ -0,0 +1,312 @@
+package tool
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/httpclient"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// githubAPI is GitHub's REST API; tests point it elsewhere
+var githubAPI = "https://api.github.com/repos/"
+
+// releaseAssetInfo is a file attached to a GitHub release
+type releaseAssetInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// githubRepo returns "owner/repo" of a GitHub repository URL, or ""
+func githubRepo(repoURL string) string {
+	rest, ok := strings.CutPrefix(repoURL, "https://github.com/")
+	if !ok {
+		return ""
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(rest, "/"), ".git"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return ""
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// releaseAssets lists the assets of the release of a crate version. Crates
+// tag releases in several ways, so the usual tags are tried in turn.
+func releaseAssets(ctx context.Context, repo, crate, version string) ([]releaseAssetInfo, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, tag := range []string{"v" + version, version, crate + "-v" + version, crate + "-" + version} {
+		req, err := http.NewRequestWithContext(ctx, "GET", githubAPI+repo+"/releases/tags/"+tag, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, errcode.Wrap(errcode.Network, fmt.Errorf("failed to query GitHub releases: %w", err))
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("GitHub returned status %d", resp.StatusCode)
+		}
+		var release struct {
+			Assets []releaseAssetInfo `json:"assets"`
+		}
+		err = json.NewDecoder(httpclient.Throttle(ctx, resp.Body)).Decode(&release)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse GitHub release: %w", err)
+		}
+		return release.Assets, nil
+	}
+	return nil, errcode.Errorf(errcode.NotFound, "no release of %s %s on GitHub", repo, version)
+}
+
+// Words in asset names for each platform
+var (
+	releaseOS = map[string][]string{
+		"linux":   {"linux"},
+		"darwin":  {"darwin", "apple", "macos", "osx"},
+		"windows": {"windows", "win64", "msvc"},
+	}
+	releaseArch = map[string][]string{
+		"amd64": {"x86_64", "amd64", "x64"},
+		"arm64": {"aarch64", "arm64"},
+	}
+)
+
+// releaseAsset picks the archive for a platform among a release's asset
+// names, or "" if there is none. On Linux, static musl builds are
+// preferred as they run on any distribution.
+func releaseAsset(names []string, goos, goarch string) string {
+	best, bestScore := "", 0
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		if !strings.HasSuffix(lower, ".tar.gz") && !strings.HasSuffix(lower, ".tgz") && !strings.HasSuffix(lower, ".zip") {
+			continue
+		}
+		if !containsAny(lower, releaseOS[goos]) || !containsAny(lower, releaseArch[goarch]) {
+			continue
+		}
+		score := 1
+		if goos == "linux" && strings.Contains(lower, "musl") {
+			score = 2
+		}
+		if score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+	return best
+}
+
+// containsAny reports whether s contains any of words
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// installReleaseBinaries downloads the release archive of a crate version
+// for this platform, checks it against the checksums published with it,
+// and copies its executables into binDir
+func installReleaseBinaries(ctx context.Context, repo, crate, version, binDir, cacheDir string) error {
+	assets, err := releaseAssets(ctx, repo, crate, version)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(assets))
+	urls := make(map[string]string, len(assets))
+	for i, a := range assets {
+		names[i] = a.Name
+		urls[a.Name] = a.URL
+	}
+	name := releaseAsset(names, runtime.GOOS, runtime.GOARCH)
+	if name == "" {
+		return errcode.Errorf(errcode.NotFound, "no release archive for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+
+	archive := filepath.Join(cacheDir, repo, version, name)
+	if err := downloadFile(ctx, urls[name], archive); err != nil {
+		return err
+	}
+	if err := verifyReleaseAsset(ctx, archive, name, urls); err != nil {
+		// Don't reuse a bad download
+		os.Remove(archive)
+		return err
+	}
+
+	ui.Printf("Unpacking %s\n", name)
+	copied, err := extractExecutables(archive, binDir)
+	if err != nil {
+		return err
+	}
+	if copied == 0 {
+		return fmt.Errorf("no executables in %s", name)
+	}
+	return nil
+}
+
+// verifyReleaseAsset checks an asset against the checksum file of the
+// release: one for the asset, or a list of checksums for all of them. A
+// release without checksums is installed with a warning.
+func verifyReleaseAsset(ctx context.Context, archive, name string, urls map[string]string) error {
+	var sumsURL string
+	for _, candidate := range []string{name + ".sha256", name + ".sha256sum", "sha256sums.txt", "SHA256SUMS", "checksums.txt"} {
+		if url, ok := urls[candidate]; ok {
+			sumsURL = url
+			break
+		}
+	}
+	if sumsURL == "" {
+		ui.Warn("%s has no published checksum; it wasn't verified", name)
+		return nil
+	}
+
+	sums := filepath.Join(filepath.Dir(archive), path.Base(sumsURL))
+	os.Remove(sums) // Checksums are small; always fetch them fresh
+	if err := downloadFile(ctx, sumsURL, sums); err != nil {
+		return err
+	}
+	expected, err := checksumFor(sums, name)
+	if err != nil {
+		return err
+	}
+	actual, err := hashFile(archive)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(expected, actual) {
+		return errcode.Errorf(errcode.Verification, "checksum mismatch for %s: expected %s, got %s", name, expected, actual)
+	}
+	ui.OK("Checksum verified")
+	return nil
+}
+
+// checksumFor reads the checksum of name from a sha256sum style file,
+// "<hash>  <name>" per line, or a file holding just the hash
+func checksumFor(sumsPath, name string) (string, error) {
+	f, err := os.Open(sumsPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksums: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 1:
+			return fields[0], nil
+		case len(fields) >= 2 && path.Base(strings.TrimPrefix(fields[1], "*")) == name:
+			return fields[0], nil
+		}
+	}
+	return "", errcode.Errorf(errcode.Verification, "no checksum for %s in %s", name, filepath.Base(sumsPath))
+}
+
+// extractExecutables copies the executables of a .tar.gz or .zip archive
+// into binDir, dropping the directories they are in, and returns how many
+// it copied. Archives carry docs and completions too, which are skipped.
+func extractExecutables(archive, binDir string) (int, error) {
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", binDir, err)
+	}
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		return extractZipExecutables(archive, binDir)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", archive, err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", archive, err)
+	}
+	defer gz.Close()
+
+	copied := 0
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return copied, fmt.Errorf("failed to read %s: %w", archive, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Mode&0111 == 0 {
+			continue
+		}
+		if err := writeExecutable(filepath.Join(binDir, path.Base(hdr.Name)), tr); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+// extractZipExecutables copies the .exe files of a zip archive, as zips
+// of Windows builds carry no file modes
+func extractZipExecutables(archive, binDir string) (int, error) {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", archive, err)
+	}
+	defer zr.Close()
+
+	copied := 0
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() || (!strings.HasSuffix(strings.ToLower(zf.Name), ".exe") && zf.Mode()&0111 == 0) {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return copied, fmt.Errorf("failed to read %s: %w", zf.Name, err)
+		}
+		err = writeExecutable(filepath.Join(binDir, path.Base(zf.Name)), rc)
+		rc.Close()
+		if err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+// writeExecutable writes r to an executable file
+func writeExecutable(dest string, r io.Reader) error {
+	if name := filepath.Base(dest); name == ".." || name == "." {
+		return fmt.Errorf("invalid file name in archive: %q", name)
+	}
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write %s: %w", dest, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,181 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	goruntime "runtime"
+	"sort"
+	"strings"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// wheelPlatforms are the platforms, as os/arch, tools can be resolved for,
+// and the wheel platform tags pip looks for on each. pip widens each tag
+// to the older manylinux and macOS versions it covers.
+var wheelPlatforms = map[string][]string{
+	"linux/amd64":   {"manylinux_2_28_x86_64", "manylinux2014_x86_64"},
+	"linux/arm64":   {"manylinux_2_28_aarch64", "manylinux2014_aarch64"},
+	"darwin/amd64":  {"macosx_11_0_x86_64"},
+	"darwin/arm64":  {"macosx_11_0_arm64"},
+	"windows/amd64": {"win_amd64"},
+	"windows/arm64": {"win_arm64"},
+}
+
+// HostPlatform returns the os/arch ophid runs on
+func HostPlatform() string {
+	return goruntime.GOOS + "/" + goruntime.GOARCH
+}
+
+// Platforms returns the os/arch platforms tools can be resolved for
+func Platforms() []string {
+	platforms := make([]string, 0, len(wheelPlatforms))
+	for p := range wheelPlatforms {
+		platforms = append(platforms, p)
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+// CheckPlatform checks that tools can be resolved for an os/arch
+func CheckPlatform(platform string) error {
+	if _, ok := wheelPlatforms[platform]; !ok {
+		return fmt.Errorf("unknown platform %s (available: %s)", platform, strings.Join(Platforms(), ", "))
+	}
+	return nil
+}
+
+// Resolution is the exact packages a Python tool installs on one platform
+type Resolution struct {
+	Platform     string   // os/arch
+	Python       string   // Python version, like 3.12
+	Requirements []string // name==version --hash=sha256:..., for pip's hash-checking mode
+}
+
+// Version returns the resolved version of a package, or ""
+func (r *Resolution) Version(name string) string {
+	prefix := normalizeProjectName(name) + "=="
+	for _, req := range r.Requirements {
+		if spec, ok := strings.CutPrefix(req, prefix); ok {
+			version, _, _ := strings.Cut(spec, " ")
+			return version
+		}
+	}
+	return ""
+}
+
+// ResolvePlatform works out the packages pip would install for a
+// requirement (ansible, ansible==9.1.0) on a platform and Python version,
+// without installing anything, with python's pip. Only this platform, with
+// python's own version, may build from source; the others are resolved
+// from wheels alone.
+func (i *Installer) ResolvePlatform(ctx context.Context, python, requirement, platform, pythonVersion string, opts InstallOptions) (*Resolution, error) {
+	if err := CheckPlatform(platform); err != nil {
+		return nil, err
+	}
+	pipEnv, err := i.pipEnv(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"-m", "pip", "install", "--dry-run", "--quiet", "--ignore-installed", "--report", "-"}
+	restricted := platform != HostPlatform() || pythonVersion != pythonMinorVersion(python)
+	if restricted {
+		for _, tag := range wheelPlatforms[platform] {
+			args = append(args, "--platform", tag)
+		}
+		args = append(args, "--python-version", pythonVersion, "--only-binary", ":all:")
+	} else {
+		policy, err := ParseBuildPolicy(string(opts.BuildPolicy))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, policy.PipArgs()...)
+	}
+	args = append(args, requirement)
+
+	var stderr tailBuffer
+	cmd := exec.CommandContext(ctx, python, args...)
+	cmd.Env = pipEnv
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if m := noMatchingVersion.FindStringSubmatch(stderr.String()); m != nil && restricted {
+			return nil, errcode.Errorf(errcode.NotFound, "no wheel of %s for Python %s on %s; other platforms than this one are resolved from wheels only", m[1], pythonVersion, platform)
+		}
+		return nil, fmt.Errorf("failed to resolve %s for %s: %w\n%s", requirement, platform, err, strings.TrimSpace(stderr.String()))
+	}
+
+	requirements, err := parsePipReport(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s for %s: %w", requirement, platform, err)
+	}
+	return &Resolution{Platform: platform, Python: pythonVersion, Requirements: requirements}, nil
+}
+
+// pipReportPackage is a package in the report of pip install --report
+type pipReportPackage struct {
+	Metadata struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"metadata"`
+	DownloadInfo struct {
+		URL         string `json:"url"`
+		ArchiveInfo struct {
+			Hashes map[string]string `json:"hashes"`
+			Hash   string            `json:"hash"` // Older pips: "sha256=..."
+		} `json:"archive_info"`
+	} `json:"download_info"`
+}
+
+// sha256 returns the package's sha256, or ""
+func (p *pipReportPackage) sha256() string {
+	if sha := p.DownloadInfo.ArchiveInfo.Hashes["sha256"]; sha != "" {
+		return sha
+	}
+	sha, _ := strings.CutPrefix(p.DownloadInfo.ArchiveInfo.Hash, "sha256=")
+	return sha
+}
+
+// readPipReport reads the packages of a pip install --report
+func readPipReport(data []byte) ([]pipReportPackage, error) {
+	var report struct {
+		Install []pipReportPackage `json:"install"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse pip's report: %w", err)
+	}
+	return report.Install, nil
+}
+
+// parsePipReport turns the report of pip install --report into pinned,
+// hashed requirements, sorted
+func parsePipReport(data []byte) ([]string, error) {
+	packages, err := readPipReport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var requirements []string
+	for _, pkg := range packages {
+		sha := pkg.sha256()
+		if sha == "" {
+			return nil, fmt.Errorf("%s has no sha256 to pin (from %s)", pkg.Metadata.Name, RedactURL(pkg.DownloadInfo.URL))
+		}
+		requirements = append(requirements, fmt.Sprintf("%s==%s --hash=sha256:%s", normalizeProjectName(pkg.Metadata.Name), pkg.Metadata.Version, sha))
+	}
+	sort.Strings(requirements)
+	return requirements, nil
+}
+
+// pythonMinorVersion returns the major.minor version of a python
+// executable, or "" when it can't be run
+func pythonMinorVersion(python string) string {
+	out, err := exec.Command(python, "-c", "import sys; print('%d.%d' % sys.version_info[:2])").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
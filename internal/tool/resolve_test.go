@@ -0,0 +1,116 @@
+//go:build unix
+
+package tool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+// fakeResolvePython stands in for a Python 3.12 with pip: it logs pip's
+// arguments and reports ansible and a dependency, or fails like pip when
+// asked for a platform without wheels
+const fakeResolvePython = `#!/bin/sh
+if [ "$1" = -c ]; then
+	echo 3.12
+	exit 0
+fi
+echo "$@" >> "$(dirname "$0")/args.log"
+case "$*" in
+*win_amd64*)
+	echo "ERROR: Could not find a version that satisfies the requirement pywin32 (from versions: none)" >&2
+	exit 1 ;;
+esac
+cat <<'REPORT'
+{"version": "1", "install": [
+ {"metadata": {"name": "PyYAML", "version": "6.0.1"}, "download_info": {"url": "https://files.example/PyYAML.whl", "archive_info": {"hash": "sha256=bbb"}}},
+ {"metadata": {"name": "ansible", "version": "9.1.0"}, "download_info": {"url": "https://files.example/ansible.whl", "archive_info": {"hashes": {"sha256": "aaa"}}}}
+]}
+REPORT
+`
+
+func TestResolvePlatform(t *testing.T) {
+	home := t.TempDir()
+	python := filepath.Join(home, "python3")
+	os.WriteFile(python, []byte(fakeResolvePython), 0755)
+	installer, err := NewInstaller(home, NewVenvManager(home, python))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := installer.ResolvePlatform(context.Background(), python, "ansible", HostPlatform(), "3.12", InstallOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ansible==9.1.0 --hash=sha256:aaa,pyyaml==6.0.1 --hash=sha256:bbb"
+	if got := strings.Join(r.Requirements, ","); got != want {
+		t.Errorf("requirements = %s, want %s", got, want)
+	}
+	if r.Version("Ansible") != "9.1.0" || r.Version("missing") != "" {
+		t.Errorf("Version(ansible) = %q", r.Version("ansible"))
+	}
+
+	other := "linux/arm64"
+	if HostPlatform() == other {
+		other = "linux/amd64"
+	}
+	if _, err := installer.ResolvePlatform(context.Background(), python, "ansible==9.1.0", other, "3.11", InstallOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	log, _ := os.ReadFile(filepath.Join(home, "args.log"))
+	lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+	if strings.Contains(lines[0], "--platform") || !strings.Contains(lines[0], "--prefer-binary") {
+		t.Errorf("this platform was resolved with %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "--platform manylinux") || !strings.Contains(lines[1], "--python-version 3.11 --only-binary :all:") {
+		t.Errorf("another platform was resolved with %s", lines[1])
+	}
+
+	if _, err := installer.ResolvePlatform(context.Background(), python, "pywinrm", "windows/amd64", "3.12", InstallOptions{}); errcode.Of(err) != errcode.NotFound || !strings.Contains(err.Error(), "no wheel of pywin32") {
+		t.Errorf("err = %v, want no wheel of pywin32", err)
+	}
+	if _, err := installer.ResolvePlatform(context.Background(), python, "ansible", "plan9/amd64", "3.12", InstallOptions{}); err == nil {
+		t.Error("resolved for an unknown platform")
+	}
+}
+
+// fakeLockedPython creates venvs whose pip logs its arguments
+const fakeLockedPython = `#!/bin/sh
+venv="$3"
+mkdir -p "$venv/bin"
+cat > "$venv/bin/pip" <<'PIP'
+#!/bin/sh
+dir=$(dirname "$0")
+case "$1" in
+install) echo "$@" > "$dir/../args" ;;
+show) echo "Version: 9.1.0" ;;
+esac
+PIP
+chmod +x "$venv/bin/pip"
+`
+
+func TestInstallLockedRequirements(t *testing.T) {
+	home := t.TempDir()
+	python := filepath.Join(home, "python3")
+	os.WriteFile(python, []byte(fakeLockedPython), 0755)
+	installer, err := NewInstaller(home, NewVenvManager(home, python))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requirements := filepath.Join(home, "requirements.txt")
+	os.WriteFile(requirements, []byte("ansible==9.1.0 --hash=sha256:aaa\n"), 0644)
+
+	tool, err := installer.Install("ansible", InstallOptions{Version: "9.1.0", Requirements: requirements, SkipScan: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _ := os.ReadFile(filepath.Join(tool.InstallPath, "args"))
+	if got := strings.TrimSpace(string(args)); !strings.HasSuffix(got, "--no-deps -r "+requirements) || strings.Contains(got, "ansible==") {
+		t.Errorf("pip ran with %q, want only the locked requirements", got)
+	}
+}
@@ -0,0 +1,366 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/httpclient"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// rubygemsAPI is the RubyGems API; tests point it elsewhere
+var rubygemsAPI = "https://rubygems.org/api/v1/"
+
+// RubyInstaller installs Ruby tools, each into a GEM_HOME of its own so
+// their gems never meet. The tool's bin directory holds wrappers that run
+// its executables with that GEM_HOME.
+type RubyInstaller struct {
+	homeDir string
+}
+
+// NewRubyInstaller creates a new Ruby installer
+func NewRubyInstaller(homeDir string) *RubyInstaller {
+	return &RubyInstaller{homeDir: homeDir}
+}
+
+// GemHome returns the GEM_HOME of a tool
+func (ri *RubyInstaller) GemHome(name string) string {
+	return filepath.Join(ri.homeDir, "tools", name, "gems")
+}
+
+// FindRuby returns the ruby to install with: the newest one in
+// ~/.ophid/runtimes/ruby-<version> (e.g. built there with ruby-build), or
+// else ruby from PATH
+func (ri *RubyInstaller) FindRuby() (string, error) {
+	exe := "ruby"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	managed, _ := filepath.Glob(filepath.Join(ri.homeDir, "runtimes", "ruby-*", "bin", exe))
+	if len(managed) > 0 {
+		sort.Strings(managed)
+		return managed[len(managed)-1], nil
+	}
+	if ruby, err := exec.LookPath("ruby"); err == nil {
+		return ruby, nil
+	}
+	return "", errcode.Errorf(errcode.NotFound, "no Ruby found; install one in PATH or in %s",
+		filepath.Join(ri.homeDir, "runtimes", "ruby-<version>"))
+}
+
+// InstallGem installs a gem and its dependencies into gemHome, at version
+// or the latest if version is ""
+func (ri *RubyInstaller) InstallGem(ctx context.Context, ruby, gemHome, name, version string) error {
+	args := []string{"install", "--no-document", "--install-dir", gemHome, "--bindir", gemBinDir(gemHome)}
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+	return ri.gem(ctx, ruby, gemHome, "", append(args, name)...)
+}
+
+// InstallProject installs a Ruby project checked out in dir: a gem, built
+// from its gemspec, or else an application whose Gemfile bundler installs
+// and whose exe/ or bin/ scripts become the tool's executables
+func (ri *RubyInstaller) InstallProject(ctx context.Context, ruby, gemHome, dir string) error {
+	specs, _ := filepath.Glob(filepath.Join(dir, "*.gemspec"))
+	if len(specs) == 0 {
+		return ri.bundle(ctx, ruby, gemHome, dir)
+	}
+
+	build, err := os.MkdirTemp("", "ophid-gem-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(build)
+	gemFile := filepath.Join(build, "tool.gem")
+	if err := ri.gem(ctx, ruby, gemHome, dir, "build", filepath.Base(specs[0]), "--output", gemFile); err != nil {
+		return err
+	}
+	return ri.gem(ctx, ruby, gemHome, dir, "install", "--no-document", "--install-dir", gemHome, "--bindir", gemBinDir(gemHome), gemFile)
+}
+
+// bundle installs the Gemfile of an application into gemHome and puts
+// loaders of its scripts, which set up the bundle first, into gemBinDir
+func (ri *RubyInstaller) bundle(ctx context.Context, ruby, gemHome, dir string) error {
+	env := append(rubyEnv(gemHome), "BUNDLE_GEMFILE="+filepath.Join(dir, "Gemfile"), "BUNDLE_PATH="+gemHome)
+	ui.Printf("Running: bundle install (%s)\n", dir)
+	cmd := exec.CommandContext(ctx, ruby, "-S", "bundle", "install")
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("bundle install failed: %w", err)
+	}
+
+	binDir := gemBinDir(gemHome)
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", binDir, err)
+	}
+	for _, scripts := range []string{"exe", "bin"} {
+		entries, err := os.ReadDir(filepath.Join(dir, scripts))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			script := filepath.Join(dir, scripts, e.Name())
+			// bin/ of Rails-style apps holds setup helpers too; skip them
+			if e.IsDir() || !isExecutable(script) || strings.HasPrefix(e.Name(), "setup") || e.Name() == "bundle" {
+				continue
+			}
+			content := fmt.Sprintf("# Runs %s with the application's bundle\nENV['BUNDLE_GEMFILE'] ||= %q\nENV['BUNDLE_PATH'] ||= %q\nrequire 'bundler/setup'\nload %q\n",
+				e.Name(), filepath.Join(dir, "Gemfile"), gemHome, script)
+			if err := os.WriteFile(filepath.Join(binDir, e.Name()), []byte(content), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", e.Name(), err)
+			}
+		}
+		return nil // exe/ wins over bin/ when both exist
+	}
+	return nil
+}
+
+// gem runs RubyGems with ruby, for gemHome
+func (ri *RubyInstaller) gem(ctx context.Context, ruby, gemHome, dir string, args ...string) error {
+	ui.Printf("Running: gem %s\n", strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, ruby, append([]string{"-S", "gem"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = rubyEnv(gemHome)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("gem %s failed: %w", args[0], err)
+	}
+	return nil
+}
+
+// WriteWrappers writes a wrapper into binDir for each script gem installed
+// into gemHome, running it on ruby with the tool's gems, and returns their
+// names
+func (ri *RubyInstaller) WriteWrappers(ruby, gemHome, binDir string) ([]string, error) {
+	entries, err := os.ReadDir(gemBinDir(gemHome))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read installed scripts: %w", err)
+	}
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", binDir, err)
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		// RubyGems adds .bat stubs next to the scripts on Windows
+		name := strings.TrimSuffix(e.Name(), ".bat")
+		if e.IsDir() || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		script := filepath.Join(gemBinDir(gemHome), name)
+		path, content := filepath.Join(binDir, name), ""
+		if runtime.GOOS == "windows" {
+			path += ".cmd"
+			content = fmt.Sprintf("@echo off\r\nset \"GEM_HOME=%s\"\r\nset \"GEM_PATH=%s\"\r\n\"%s\" \"%s\" %%*\r\n", gemHome, gemHome, ruby, script)
+		} else {
+			content = fmt.Sprintf("#!/bin/sh\nGEM_HOME=%s GEM_PATH=%s\nexport GEM_HOME GEM_PATH\nexec %s %s \"$@\"\n",
+				shellQuote(gemHome), shellQuote(gemHome), shellQuote(ruby), shellQuote(script))
+		}
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			return nil, fmt.Errorf("failed to write %s wrapper: %w", name, err)
+		}
+		names = append(names, filepath.Base(path))
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no executables installed")
+	}
+	return names, nil
+}
+
+// InstalledVersion returns the version of a gem installed in gemHome, the
+// newest if there are several
+func (ri *RubyInstaller) InstalledVersion(gemHome, name string) (string, error) {
+	specs, _ := filepath.Glob(filepath.Join(gemHome, "specifications", name+"-*.gemspec"))
+	var versions []string
+	for _, spec := range specs {
+		version := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(spec), name+"-"), ".gemspec")
+		// Skip gems whose name only starts with name, like rubocop-ast
+		if version != "" && version[0] >= '0' && version[0] <= '9' {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return "", errcode.Errorf(errcode.NotFound, "%s isn't installed in %s", name, gemHome)
+	}
+	sort.Slice(versions, func(a, b int) bool { return gemVersionLess(versions[a], versions[b]) })
+	return versions[len(versions)-1], nil
+}
+
+// gemVersionLess orders gem versions by their numeric segments, so that
+// 1.10.0 comes after 1.9.2
+func gemVersionLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for n := 0; n < len(as) && n < len(bs); n++ {
+		an, aErr := strconv.Atoi(as[n])
+		bn, bErr := strconv.Atoi(bs[n])
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			return an < bn
+		case (aErr != nil || bErr != nil) && as[n] != bs[n]:
+			return as[n] < bs[n]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// latestGemVersion asks RubyGems for the latest version of a gem
+func latestGemVersion(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rubygemsAPI+"versions/"+name+"/latest.json", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errcode.Wrap(errcode.Network, fmt.Errorf("failed to query RubyGems: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("RubyGems returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(httpclient.Throttle(ctx, resp.Body)).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse RubyGems response: %w", err)
+	}
+	// RubyGems answers "unknown" for gems it doesn't have
+	if result.Version == "" || result.Version == "unknown" {
+		return "", errcode.Errorf(errcode.NotFound, "gem %s not found on RubyGems", name)
+	}
+	return result.Version, nil
+}
+
+// installFromGem installs a gem from RubyGems with its own GEM_HOME
+func (i *Installer) installFromGem(ctx context.Context, source InstallSource, opts InstallOptions) (*Tool, error) {
+	name := source.URL
+	version := opts.Version
+	if version == "latest" {
+		version = ""
+	}
+	if version == "" {
+		latest, err := latestGemVersion(ctx, name)
+		if errcode.Of(err) == errcode.NotFound {
+			return nil, err
+		}
+		if err != nil {
+			// gem install still finds the latest; only the scan needs a version
+			slog.Warn("failed to get version from RubyGems", "gem", name, "error", err)
+		}
+		version = latest
+	}
+
+	var secInfo SecurityInfo
+	if !opts.SkipScan && version != "" {
+		slog.Info("running pre-installation security scan", "gem", name, "version", version)
+		var scanErr error
+		secInfo, scanErr = i.scanPackage(ctx, "RubyGems", name, version)
+		secInfo.VulnScanDate = time.Now()
+		if opts.Policy != nil {
+			in := releaseInput(name, version, source, secInfo, scanErr)
+			if err := enforcePolicy(opts.Policy, opts.Policy.EvaluateRelease(in), "installation"); err != nil {
+				return nil, err
+			}
+		}
+		if secInfo.VulnCount == 0 && scanErr == nil {
+			ui.OK("No vulnerabilities found")
+		}
+	}
+
+	gemHome, ruby, executables, err := i.installRuby(name, func(ruby, gemHome string) error {
+		return i.rubyInstaller.InstallGem(ctx, ruby, gemHome, name, version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if installed, err := i.rubyInstaller.InstalledVersion(gemHome, name); err == nil {
+		version = installed
+	}
+
+	tool := &Tool{
+		Name:        name,
+		Version:     version,
+		Ecosystem:   "ruby",
+		Runtime:     "ruby",
+		InstallPath: gemHome,
+		Executables: executables,
+		Source:      source,
+		Security:    secInfo,
+		Metadata:    map[string]string{"ruby": ruby},
+		InstalledAt: time.Now(),
+	}
+	i.putTool(tool, opts.Prefer)
+	i.manifest.UpdatedAt = time.Now()
+	if err := i.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	ui.Println()
+	ui.Success("%s@%s installed successfully from RubyGems", name, version)
+	ui.Printf("  Executables: %s\n", strings.Join(executables, ", "))
+	if secInfo.VulnCount > 0 {
+		ui.Printf("  %s Vulnerabilities: %d total, %d critical\n", ui.Stderr.Tag(ui.LevelWarn), secInfo.VulnCount, secInfo.CriticalVulnCount)
+	}
+	return tool, nil
+}
+
+// installRuby installs a Ruby tool into a fresh GEM_HOME with install and
+// writes the wrappers of its executables. It returns the GEM_HOME, the
+// ruby used and the executables.
+func (i *Installer) installRuby(name string, install func(ruby, gemHome string) error) (string, string, []string, error) {
+	ruby, err := i.rubyInstaller.FindRuby()
+	if err != nil {
+		return "", "", nil, err
+	}
+	gemHome := i.rubyInstaller.GemHome(name)
+	if err := os.RemoveAll(gemHome); err != nil {
+		return "", "", nil, fmt.Errorf("failed to remove old install: %w", err)
+	}
+	if err := install(ruby, gemHome); err != nil {
+		os.RemoveAll(gemHome)
+		return "", "", nil, err
+	}
+	executables, err := i.rubyInstaller.WriteWrappers(ruby, gemHome, i.venvManager.GetBinDir(gemHome))
+	if err != nil {
+		os.RemoveAll(gemHome)
+		return "", "", nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return gemHome, ruby, executables, nil
+}
+
+// gemBinDir is where RubyGems puts a tool's own scripts, which need the
+// tool's GEM_HOME to run; the wrappers setting it go in the bin directory
+func gemBinDir(gemHome string) string {
+	return filepath.Join(gemHome, "gem-bin")
+}
+
+// rubyEnv returns the environment that confines RubyGems to gemHome
+func rubyEnv(gemHome string) []string {
+	return append(os.Environ(), "GEM_HOME="+gemHome, "GEM_PATH="+gemHome)
+}
+
+// shellQuote quotes s for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
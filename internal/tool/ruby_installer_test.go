@@ -0,0 +1,157 @@
+//go:build unix
+
+package tool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeRuby stands in for ruby: "gem install" installs a gem with one
+// script and a dependency, "bundle install" does nothing, and running a
+// script prints the GEM_HOME it ran with
+const fakeRuby = `#!/bin/sh
+if [ "$1" = -S ]; then
+	[ "$2" = gem ] && [ "$3" = install ] || exit 0
+	shift 3
+	while [ $# -gt 1 ]; do
+		case "$1" in
+		--install-dir) dir=$2; shift ;;
+		--bindir) bin=$2; shift ;;
+		--version) version=$2; shift ;;
+		esac
+		shift
+	done
+	mkdir -p "$bin" "$dir/specifications"
+	echo "puts 1" > "$bin/$1-cli"
+	touch "$dir/specifications/$1-${version:-2.0.0}.gemspec" "$dir/specifications/$1-ast-9.9.gemspec"
+	exit 0
+fi
+echo "GEM_HOME=$GEM_HOME $*"
+`
+
+func newRubyTestInstaller(t *testing.T) (*Installer, string) {
+	t.Helper()
+	home := t.TempDir()
+	rubyBin := filepath.Join(home, "runtimes", "ruby-3.3.0", "bin")
+	os.MkdirAll(rubyBin, 0755)
+	os.WriteFile(filepath.Join(rubyBin, "ruby"), []byte(fakeRuby), 0755)
+	installer, err := NewInstaller(home, NewVenvManager(home, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return installer, home
+}
+
+func TestInstallFromGem(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/versions/demo/latest.json":
+			fmt.Fprint(w, `{"version": "1.10.0"}`)
+		default:
+			fmt.Fprint(w, `{"version": "unknown"}`)
+		}
+	}))
+	defer srv.Close()
+	old := rubygemsAPI
+	rubygemsAPI = srv.URL + "/"
+	defer func() { rubygemsAPI = old }()
+
+	installer, home := newRubyTestInstaller(t)
+	tool, err := installer.Install("gem:demo", InstallOptions{SkipScan: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gemHome := filepath.Join(home, "tools", "demo", "gems")
+	if tool.Version != "1.10.0" || tool.Ecosystem != "ruby" || tool.InstallPath != gemHome {
+		t.Errorf("tool = %s@%s (%s) in %s", tool.Name, tool.Version, tool.Ecosystem, tool.InstallPath)
+	}
+	if len(tool.Executables) != 1 || tool.Executables[0] != "demo-cli" {
+		t.Fatalf("executables = %v, want demo-cli", tool.Executables)
+	}
+
+	// The wrapper runs the gem's script with the tool's GEM_HOME
+	out, err := exec.Command(filepath.Join(gemHome, "bin", "demo-cli"), "--help").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("GEM_HOME=%s %s --help", gemHome, filepath.Join(gemHome, "gem-bin", "demo-cli"))
+	if got := strings.TrimSpace(string(out)); got != want {
+		t.Errorf("wrapper ran %q, want %q", got, want)
+	}
+
+	if _, err := installer.Install("gem:missing", InstallOptions{SkipScan: true}); err == nil {
+		t.Error("installed a gem RubyGems doesn't have")
+	}
+
+	if err := installer.Uninstall("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(gemHome); !os.IsNotExist(err) {
+		t.Error("uninstall left the GEM_HOME behind")
+	}
+}
+
+func TestInstallRubyApplication(t *testing.T) {
+	installer, home := newRubyTestInstaller(t)
+	app := t.TempDir()
+	os.WriteFile(filepath.Join(app, "Gemfile"), []byte("source 'https://rubygems.org'\n"), 0644)
+	os.MkdirAll(filepath.Join(app, "exe"), 0755)
+	os.WriteFile(filepath.Join(app, "exe", "report"), []byte("puts 'report'\n"), 0755)
+
+	tool, err := installer.Install(app, InstallOptions{SkipScan: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tool.Executables) != 1 || tool.Executables[0] != "report" {
+		t.Fatalf("executables = %v, want report", tool.Executables)
+	}
+
+	// The loader sets the bundle up before loading the script
+	gemHome := filepath.Join(home, "tools", tool.Name, "gems")
+	loader, err := os.ReadFile(filepath.Join(gemHome, "gem-bin", "report"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{filepath.Join(app, "Gemfile"), "require 'bundler/setup'", filepath.Join(app, "exe", "report")} {
+		if !strings.Contains(string(loader), want) {
+			t.Errorf("loader lacks %q:\n%s", want, loader)
+		}
+	}
+}
+
+func TestDetectGemSource(t *testing.T) {
+	sd := NewSourceDetector()
+	for _, spec := range []string{"gem:rubocop", "https://rubygems.org/gems/rubocop", "rubygems.org/gems/rubocop/versions"} {
+		source, err := sd.DetectSource(spec, InstallOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if source.Type != SourceGem || source.URL != "rubocop" {
+			t.Errorf("%s: got %s %q, want gem rubocop", spec, source.Type, source.URL)
+		}
+	}
+}
+
+func TestGemVersionLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1.9.2", "1.10.0", true},
+		{"1.10.0", "1.9.2", false},
+		{"2.0", "2.0.1", true},
+		{"2.0.0.rc1", "2.0.0.rc2", true},
+	}
+	for _, tt := range tests {
+		if got := gemVersionLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("gemVersionLess(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
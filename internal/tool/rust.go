@@ -0,0 +1,253 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/httpclient"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// Rust install methods, kept in the source metadata
+const (
+	RustMethodKey     = "method"
+	RustMethodRelease = "release" // Prebuilt binaries from the crate's GitHub release
+	RustMethodCargo   = "cargo"   // Built with cargo install
+)
+
+// cratesAPI is the crates.io API; tests point it elsewhere
+var cratesAPI = "https://crates.io/api/v1/crates/"
+
+// crateInfo is what crates.io knows about a crate
+type crateInfo struct {
+	Version    string // Newest stable version
+	Repository string // Source repository URL, often on GitHub
+}
+
+// lookupCrate asks crates.io about a crate
+func lookupCrate(ctx context.Context, crate string) (*crateInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", cratesAPI+crate, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	// crates.io refuses requests without a user agent
+	req.Header.Set("User-Agent", "ophid (https://github.com/gleicon/ophid)")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errcode.Wrap(errcode.Network, fmt.Errorf("failed to query crates.io: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errcode.Errorf(errcode.NotFound, "crate %s not found on crates.io", crate)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crates.io returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Crate struct {
+			MaxStableVersion string `json:"max_stable_version"`
+			MaxVersion       string `json:"max_version"`
+			Repository       string `json:"repository"`
+		} `json:"crate"`
+	}
+	if err := json.NewDecoder(httpclient.Throttle(ctx, resp.Body)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse crates.io response: %w", err)
+	}
+	info := &crateInfo{Version: result.Crate.MaxStableVersion, Repository: result.Crate.Repository}
+	if info.Version == "" {
+		info.Version = result.Crate.MaxVersion
+	}
+	return info, nil
+}
+
+// installFromCargo installs a Rust tool from crates.io, from the binaries
+// of its GitHub release when there are some for this platform and
+// otherwise by building it with cargo
+func (i *Installer) installFromCargo(ctx context.Context, source InstallSource, opts InstallOptions) (*Tool, error) {
+	crate := source.URL
+	version := opts.Version
+	info, err := lookupCrate(ctx, crate)
+	if err != nil {
+		if version == "" || version == "latest" {
+			return nil, err
+		}
+		// cargo can still build a known version
+		slog.Warn("failed to look up crate", "crate", crate, "error", err)
+		info = &crateInfo{}
+	}
+	if version == "" || version == "latest" {
+		version = info.Version
+	}
+
+	var secInfo SecurityInfo
+	if !opts.SkipScan {
+		slog.Info("running pre-installation security scan", "crate", crate, "version", version)
+		var scanErr error
+		secInfo, scanErr = i.scanPackage(ctx, "crates.io", crate, version)
+		secInfo.VulnScanDate = time.Now()
+		if opts.Policy != nil {
+			in := releaseInput(crate, version, source, secInfo, scanErr)
+			if err := enforcePolicy(opts.Policy, opts.Policy.EvaluateRelease(in), "installation"); err != nil {
+				return nil, err
+			}
+		}
+		if secInfo.VulnCount == 0 && scanErr == nil {
+			ui.OK("No vulnerabilities found")
+		}
+	}
+
+	// Rust tools have no venv; cargo's install root takes its place
+	root := filepath.Join(i.homeDir, "tools", crate, "cargo")
+	if err := os.RemoveAll(root); err != nil {
+		return nil, fmt.Errorf("failed to remove old install: %w", err)
+	}
+	binDir := i.venvManager.GetBinDir(root)
+
+	method := ""
+	if repo := githubRepo(info.Repository); repo != "" && !opts.FromSource {
+		cacheDir := filepath.Join(i.homeDir, "cache", "releases")
+		if err := installReleaseBinaries(ctx, repo, crate, version, binDir, cacheDir); err != nil {
+			if errcode.Of(err) == errcode.Verification {
+				os.RemoveAll(root)
+				return nil, err
+			}
+			ui.Printf("No usable release binaries (%v); building with cargo\n", err)
+			os.RemoveAll(root)
+		} else {
+			method = RustMethodRelease
+		}
+	}
+	if method == "" {
+		if err := i.cargoInstall(ctx, root, "--locked", "--version", version, crate); err != nil {
+			os.RemoveAll(root)
+			return nil, err
+		}
+		method = RustMethodCargo
+	}
+
+	executables, err := i.venvManager.ListExecutables(root)
+	if err != nil || len(executables) == 0 {
+		os.RemoveAll(root)
+		return nil, fmt.Errorf("%s installed no executables", crate)
+	}
+
+	source.Metadata = map[string]string{RustMethodKey: method}
+	if info.Repository != "" {
+		source.Metadata["repository"] = info.Repository
+	}
+	tool := &Tool{
+		Name:        crate,
+		Version:     version,
+		Ecosystem:   "rust",
+		Runtime:     "rust",
+		InstallPath: root,
+		Executables: executables,
+		Source:      source,
+		Security:    secInfo,
+		InstalledAt: time.Now(),
+	}
+	i.putTool(tool, opts.Prefer)
+	i.manifest.UpdatedAt = time.Now()
+	if err := i.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	ui.Println()
+	how := "built with cargo"
+	if method == RustMethodRelease {
+		how = "from release binaries"
+	}
+	ui.Success("%s@%s installed successfully (%s)", crate, version, how)
+	ui.Printf("  Executables: %s\n", strings.Join(executables, ", "))
+	if secInfo.VulnCount > 0 {
+		ui.Printf("  %s Vulnerabilities: %d total, %d critical\n", ui.Stderr.Tag(ui.LevelWarn), secInfo.VulnCount, secInfo.CriticalVulnCount)
+	}
+	return tool, nil
+}
+
+// cargoInstall runs cargo install into root
+func (i *Installer) cargoInstall(ctx context.Context, root string, args ...string) error {
+	cargo, env, err := findCargo(i.homeDir)
+	if err != nil {
+		return err
+	}
+	args = append([]string{"install", "--root", root}, args...)
+	ui.Printf("Running: %s %s\n", cargo, strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, cargo, args...)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cargo install failed: %w", err)
+	}
+
+	// cargo installs into bin even on Windows, where tools are looked up
+	// in Scripts like a venv's
+	if binDir := i.venvManager.GetBinDir(root); binDir != filepath.Join(root, "bin") {
+		if err := os.Rename(filepath.Join(root, "bin"), binDir); err != nil {
+			return fmt.Errorf("failed to move executables: %w", err)
+		}
+	}
+	return nil
+}
+
+// cargoInstallPath builds the crate in dir with cargo into the tool's
+// install root and returns the root and the executables installed
+func (i *Installer) cargoInstallPath(ctx context.Context, name, dir string) (string, []string, error) {
+	root := filepath.Join(i.homeDir, "tools", name, "cargo")
+	if err := os.RemoveAll(root); err != nil {
+		return "", nil, fmt.Errorf("failed to remove old install: %w", err)
+	}
+	args := []string{"--path", dir}
+	// --locked fails without a lock file to keep to
+	if _, err := os.Stat(filepath.Join(dir, "Cargo.lock")); err == nil {
+		args = append(args, "--locked")
+	}
+	if err := i.cargoInstall(ctx, root, args...); err != nil {
+		os.RemoveAll(root)
+		return "", nil, err
+	}
+	executables, err := i.venvManager.ListExecutables(root)
+	if err != nil {
+		return "", nil, err
+	}
+	return root, executables, nil
+}
+
+// findCargo returns the cargo to build with and its environment: the
+// newest Rust toolchain ophid manages, or else cargo from PATH
+func findCargo(homeDir string) (string, []string, error) {
+	exe := "cargo"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	managed, _ := filepath.Glob(filepath.Join(homeDir, "runtimes", "rust-*", "cargo", "bin", exe))
+	if len(managed) > 0 {
+		sort.Strings(managed)
+		cargo := managed[len(managed)-1]
+		cargoHome := filepath.Dir(filepath.Dir(cargo))
+		env := append(os.Environ(),
+			"CARGO_HOME="+cargoHome,
+			"RUSTUP_HOME="+filepath.Join(filepath.Dir(cargoHome), "rustup"),
+			"PATH="+filepath.Dir(cargo)+string(os.PathListSeparator)+os.Getenv("PATH"))
+		return cargo, env, nil
+	}
+	if cargo, err := exec.LookPath("cargo"); err == nil {
+		return cargo, nil, nil
+	}
+	return "", nil, errcode.Errorf(errcode.NotFound, "no Rust toolchain to build with. Run: ophid runtime install rust@stable")
+}
@@ -0,0 +1,184 @@
+package tool
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func TestDetectCargoSource(t *testing.T) {
+	sd := NewSourceDetector()
+	for _, spec := range []string{"cargo:ripgrep", "https://crates.io/crates/ripgrep", "crates.io/crates/ripgrep/versions"} {
+		source, err := sd.DetectSource(spec, InstallOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if source.Type != SourceCargo || source.URL != "ripgrep" {
+			t.Errorf("%s: got %s %q, want cargo ripgrep", spec, source.Type, source.URL)
+		}
+	}
+	if source, _ := sd.DetectSource("cargo:../evil", InstallOptions{}); source.Type == SourceCargo {
+		t.Error("accepted a crate name with a path in it")
+	}
+}
+
+func TestReleaseAsset(t *testing.T) {
+	names := []string{
+		"ripgrep-14.1.0-x86_64-unknown-linux-gnu.tar.gz",
+		"ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz",
+		"ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz.sha256",
+		"ripgrep-14.1.0-aarch64-apple-darwin.tar.gz",
+		"ripgrep-14.1.0-x86_64-pc-windows-msvc.zip",
+		"ripgrep_14.1.0-1_amd64.deb",
+	}
+	tests := []struct {
+		goos, goarch, want string
+	}{
+		{"linux", "amd64", "ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz"},
+		{"darwin", "arm64", "ripgrep-14.1.0-aarch64-apple-darwin.tar.gz"},
+		{"windows", "amd64", "ripgrep-14.1.0-x86_64-pc-windows-msvc.zip"},
+		{"linux", "arm64", ""},
+	}
+	for _, tt := range tests {
+		if got := releaseAsset(names, tt.goos, tt.goarch); got != tt.want {
+			t.Errorf("%s/%s: got %q, want %q", tt.goos, tt.goarch, got, tt.want)
+		}
+	}
+}
+
+func TestGithubRepo(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/BurntSushi/ripgrep":          "BurntSushi/ripgrep",
+		"https://github.com/sharkdp/fd.git":              "sharkdp/fd",
+		"https://github.com/rust-lang/cargo/tree/master": "rust-lang/cargo",
+		"https://gitlab.com/owner/repo":                  "",
+		"https://github.com/owner":                       "",
+	}
+	for url, want := range tests {
+		if got := githubRepo(url); got != want {
+			t.Errorf("githubRepo(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+// fakeCrates serves crates.io and GitHub answers for a demo crate whose
+// release has a build of a "demo" executable for this platform, with the
+// checksum file giving checksum(the archive's checksum)
+func fakeCrates(t *testing.T, checksum func(sum string) string) {
+	t.Helper()
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for name, mode := range map[string]int64{"demo-1.2.0/demo": 0755, "demo-1.2.0/README.md": 0644} {
+		body := []byte("#!/bin/sh\necho demo\n")
+		tw.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(body)), Typeflag: tar.TypeReg})
+		tw.Write(body)
+	}
+	tw.Close()
+	gz.Close()
+	sum := sha256.Sum256(archive.Bytes())
+
+	asset := fmt.Sprintf("demo-1.2.0-%s-%s.tar.gz", runtime.GOARCH, runtime.GOOS)
+
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/crates/demo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") == "" {
+			http.Error(w, "no user agent", http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"crate": {"max_stable_version": "1.2.0", "repository": "https://github.com/example/demo"}}`)
+	})
+	mux.HandleFunc("/repos/example/demo/releases/tags/v1.2.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"assets": [{"name": %q, "browser_download_url": "%s/dl/archive"}, {"name": %q, "browser_download_url": "%s/dl/sum"}]}`,
+			asset, srv.URL, asset+".sha256", srv.URL)
+	})
+	mux.HandleFunc("/dl/archive", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive.Bytes())
+	})
+	mux.HandleFunc("/dl/sum", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  %s\n", checksum(hex.EncodeToString(sum[:])), asset)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	oldCrates, oldGitHub := cratesAPI, githubAPI
+	cratesAPI, githubAPI = srv.URL+"/crates/", srv.URL+"/repos/"
+	t.Cleanup(func() { cratesAPI, githubAPI = oldCrates, oldGitHub })
+}
+
+func TestInstallFromCargoRelease(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake release has no Windows build")
+	}
+	fakeCrates(t, func(sum string) string { return sum })
+	home := t.TempDir()
+	installer, err := NewInstaller(home, NewVenvManager(home, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tool, err := installer.Install("cargo:demo", InstallOptions{SkipScan: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tool.Name != "demo" || tool.Version != "1.2.0" || tool.Ecosystem != "rust" {
+		t.Errorf("tool = %s@%s (%s)", tool.Name, tool.Version, tool.Ecosystem)
+	}
+	if tool.Source.Metadata[RustMethodKey] != RustMethodRelease {
+		t.Errorf("method = %q, want release", tool.Source.Metadata[RustMethodKey])
+	}
+	if len(tool.Executables) != 1 || tool.Executables[0] != "demo" {
+		t.Errorf("executables = %v, want only demo", tool.Executables)
+	}
+	if !isExecutable(filepath.Join(home, "tools", "demo", "cargo", "bin", "demo")) {
+		t.Error("demo wasn't installed as an executable")
+	}
+
+	// The binary is covered by ophid verify
+	if problems, err := installer.Verify("demo"); err != nil || len(problems) != 0 {
+		t.Errorf("Verify = %v, %v", problems, err)
+	}
+	os.WriteFile(filepath.Join(home, "tools", "demo", "cargo", "bin", "demo"), []byte("tampered"), 0755)
+	if problems, _ := installer.Verify("demo"); len(problems) != 1 || problems[0].Issue != IssueModified {
+		t.Errorf("Verify after tampering = %v", problems)
+	}
+
+	if err := installer.Uninstall("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "tools", "demo", "cargo")); !os.IsNotExist(err) {
+		t.Error("uninstall left the cargo root behind")
+	}
+}
+
+func TestInstallFromCargoChecksumMismatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake release has no Windows build")
+	}
+	fakeCrates(t, func(string) string { return "0000" })
+	home := t.TempDir()
+	installer, err := NewInstaller(home, NewVenvManager(home, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = installer.Install("cargo:demo", InstallOptions{SkipScan: true})
+	if errcode.Of(err) != errcode.Verification {
+		t.Fatalf("err = %v, want a verification error", err)
+	}
+	if _, err := installer.Get("demo"); err == nil {
+		t.Error("a release that failed verification was installed")
+	}
+}
@@ -0,0 +1,254 @@
+package tool
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gleicon/ophid/internal/security"
+)
+
+// pipTooling are the packages every venv has for pip itself, which pip
+// freeze leaves out too unless something requires them
+var pipTooling = map[string]bool{"pip": true, "setuptools": true, "wheel": true, "distribute": true}
+
+// ResolveLicenses fills in the licenses of the PyPI packages that have
+// none from PyPI, a few at a time. Packages PyPI doesn't answer for are
+// left without; an SBOM lists them with no license rather than failing.
+func ResolveLicenses(ctx context.Context, homeDir string, packages []security.Package) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for n := range packages {
+		if packages[n].Ecosystem != "PyPI" || len(packages[n].Licenses) > 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(pkg *security.Package) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			licenses, _, err := pypiRelease(ctx, homeDir, pkg.Name, pkg.Version)
+			if err != nil {
+				slog.Debug("failed to resolve license", "package", pkg.Name, "error", err)
+				return
+			}
+			pkg.Licenses = licenses
+		}(&packages[n])
+	}
+	wg.Wait()
+}
+
+// SBOMPath returns where the SBOM of a tool's venv is kept, next to its
+// lockfile
+func (i *Installer) SBOMPath(name string) string {
+	return filepath.Join(i.homeDir, "tools", name+".sbom.json")
+}
+
+// GenerateSBOM writes the SBOM of what is installed in a Python tool's
+// venv to SBOMPath and records it in the tool's security info, where
+// upgrades keep it up to date
+func (i *Installer) GenerateSBOM(name string) (*security.SBOM, error) {
+	tool, err := i.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	sbom, err := i.writeSBOM(tool)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return sbom, nil
+}
+
+// writeSBOM generates and writes the SBOM of a tool's venv, and records
+// its path in the tool
+func (i *Installer) writeSBOM(t *Tool) (*security.SBOM, error) {
+	if !i.hasVenv(t) {
+		return nil, fmt.Errorf("%s isn't installed in a Python venv; ophid scan sbom reads the dependency files of other tools", t.Name)
+	}
+	packages, err := VenvPackages(t.InstallPath)
+	if err != nil {
+		return nil, err
+	}
+	project, packages := venvProject(t, packages)
+	sbom, err := security.GenerateSBOM(packages, project)
+	if err != nil {
+		return nil, err
+	}
+	path := i.SBOMPath(t.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := security.WriteSBOM(sbom, path); err != nil {
+		return nil, err
+	}
+	t.Security.SBOMPath = path
+	return sbom, nil
+}
+
+// venvProject splits the packages of a tool's venv into the tool's own,
+// the subject of its SBOM, and the rest. The packages the tool requires
+// are direct, those they pull in indirect; pip's own are dropped unless
+// something requires them. Packages nothing requires, like extras
+// installed next to the tool, are direct too.
+func venvProject(t *Tool, packages []security.Package) (security.Package, []security.Package) {
+	project := security.Package{Name: t.Name, Version: t.Version, Ecosystem: "PyPI"}
+	own := normalizeProjectName(t.Name)
+	byName := make(map[string]*security.Package, len(packages))
+	for n := range packages {
+		byName[normalizeProjectName(packages[n].Name)] = &packages[n]
+	}
+	if pkg, ok := byName[own]; ok {
+		project = *pkg
+	} else if t.Source.Type != SourcePyPI && t.Source.Type != "" {
+		// A git or local tool may be named unlike its package
+		project.Ecosystem = ""
+	}
+
+	direct := make(map[string]bool)
+	for _, dep := range project.Dependencies {
+		direct[normalizeProjectName(dep)] = true
+	}
+	requiredByOthers := make(map[string]bool)
+	for _, pkg := range packages {
+		for _, dep := range pkg.Dependencies {
+			requiredByOthers[normalizeProjectName(dep)] = true
+		}
+	}
+
+	var rest []security.Package
+	for _, pkg := range packages {
+		key := normalizeProjectName(pkg.Name)
+		switch {
+		case key == own:
+			continue
+		case pipTooling[key] && !requiredByOthers[key]:
+			continue
+		}
+		pkg.Indirect = !direct[key] && requiredByOthers[key]
+		rest = append(rest, pkg)
+	}
+	return project, rest
+}
+
+// VenvPackages returns the packages installed in a venv, from the METADATA
+// of their dist-info as pip show reads it: name, version, license and the
+// packages each requires among those installed. Requirements of extras
+// are left out, as the venv doesn't say which extras were asked for.
+func VenvPackages(venv string) ([]security.Package, error) {
+	var packages []security.Package
+	for _, dir := range sitePackagesDirs(venv) {
+		matches, _ := filepath.Glob(filepath.Join(venv, filepath.FromSlash(dir), "*.dist-info", "METADATA"))
+		for _, m := range matches {
+			pkg, err := readDistMetadata(m)
+			if err != nil {
+				slog.Warn("skipping unreadable package metadata", "path", m, "error", err)
+				continue
+			}
+			packages = append(packages, pkg)
+		}
+	}
+	if len(packages) == 0 {
+		return nil, fmt.Errorf("no packages installed in %s", venv)
+	}
+
+	installed := make(map[string]string, len(packages))
+	for _, pkg := range packages {
+		installed[normalizeProjectName(pkg.Name)] = pkg.Name
+	}
+	for n := range packages {
+		var deps []string
+		for _, dep := range packages[n].Dependencies {
+			if name, ok := installed[normalizeProjectName(dep)]; ok && !strings.EqualFold(name, packages[n].Name) {
+				deps = append(deps, name)
+			}
+		}
+		sort.Strings(deps)
+		packages[n].Dependencies = slices.Compact(deps)
+	}
+	sort.Slice(packages, func(a, b int) bool {
+		return normalizeProjectName(packages[a].Name) < normalizeProjectName(packages[b].Name)
+	})
+	return packages, nil
+}
+
+// readDistMetadata reads the core metadata of an installed package: the
+// headers of its METADATA file, up to the description
+func readDistMetadata(path string) (security.Package, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return security.Package{}, err
+	}
+	defer f.Close()
+
+	pkg := security.Package{Ecosystem: "PyPI"}
+	var license, expression, last string
+	var classifiers []string
+	licenseText := false // License holds the whole text, not a name
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break // The description follows
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			licenseText = licenseText || last == "license"
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		last = strings.ToLower(key)
+		switch last {
+		case "name":
+			pkg.Name = value
+		case "version":
+			pkg.Version = value
+		case "license":
+			license = value
+		case "license-expression":
+			expression = value
+		case "classifier":
+			classifiers = append(classifiers, value)
+		case "requires-dist":
+			if requirement, marker, _ := strings.Cut(value, ";"); !strings.Contains(marker, "extra") {
+				pkg.Dependencies = append(pkg.Dependencies, requirementName(requirement))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return security.Package{}, err
+	}
+	if pkg.Name == "" || pkg.Version == "" {
+		return security.Package{}, fmt.Errorf("no name or version")
+	}
+	if licenseText {
+		license = ""
+	}
+	if l := pypiLicense(expression, license, classifiers); l != "" {
+		pkg.Licenses = []string{l}
+	}
+	return pkg, nil
+}
+
+// requirementName returns the project a PEP 508 requirement names:
+// requests of "requests[socks] (>=2.0)"
+func requirementName(requirement string) string {
+	requirement = strings.TrimSpace(requirement)
+	if end := strings.IndexAny(requirement, " [(<>=!~@"); end != -1 {
+		requirement = requirement[:end]
+	}
+	return requirement
+}
@@ -0,0 +1,120 @@
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// metadataVenv writes a venv whose dist-infos have these METADATA files,
+// by package-version
+func metadataVenv(t *testing.T, metadata map[string]string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("venv layout differs on Windows")
+	}
+	venv := t.TempDir()
+	for dist, content := range metadata {
+		dir := filepath.Join(venv, "lib", "python3.12", "site-packages", dist+".dist-info")
+		os.MkdirAll(dir, 0755)
+		if err := os.WriteFile(filepath.Join(dir, "METADATA"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return venv
+}
+
+// httpieVenv is httpie and some of its dependency tree
+func httpieVenv(t *testing.T) string {
+	return metadataVenv(t, map[string]string{
+		"httpie-3.2.2": "Metadata-Version: 2.1\nName: httpie\nVersion: 3.2.2\nLicense: BSD\n" +
+			"Requires-Dist: requests[socks] (>=2.22.0)\nRequires-Dist: Pygments>=2.5.2\n" +
+			"Requires-Dist: pytest ; extra == 'test'\n\nThe description: not a header\n",
+		"requests-2.31.0": "Metadata-Version: 2.1\nName: requests\nVersion: 2.31.0\nLicense: Apache 2.0\n" +
+			"Classifier: License :: OSI Approved :: Apache Software License\n" +
+			"Requires-Dist: charset_normalizer (<4,>=2)\nRequires-Dist: certifi>=2017.4.17\n" +
+			"Requires-Dist: PySocks!=1.5.7,>=1.5.6 ; extra == 'socks'\n",
+		"certifi-2024.2.2": "Metadata-Version: 2.1\nName: certifi\nVersion: 2024.2.2\nLicense: MPL-2.0\n",
+		"charset_normalizer-3.3.2": "Metadata-Version: 2.1\nName: charset-normalizer\nVersion: 3.3.2\n" +
+			"License: MIT License\n        \n        Copyright (c) 2019 TAHRI Ahmed R.\n" +
+			"Classifier: License :: OSI Approved :: MIT License\n",
+		"pygments-2.17.2": "Metadata-Version: 2.3\nName: Pygments\nVersion: 2.17.2\nLicense-Expression: BSD-2-Clause\n",
+		"pip-24.0":        "Metadata-Version: 2.1\nName: pip\nVersion: 24.0\n",
+	})
+}
+
+func TestVenvPackages(t *testing.T) {
+	packages, err := VenvPackages(httpieVenv(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(packages))
+	for n, pkg := range packages {
+		names[n] = pkg.Name
+	}
+	if !slices.Equal(names, []string{"certifi", "charset-normalizer", "httpie", "pip", "Pygments", "requests"}) {
+		t.Fatalf("VenvPackages() = %v", names)
+	}
+
+	httpie, requests, charset := packages[2], packages[5], packages[1]
+	if !slices.Equal(httpie.Dependencies, []string{"Pygments", "requests"}) {
+		t.Errorf("httpie requires %v, want its installed requirements without extras", httpie.Dependencies)
+	}
+	if !slices.Equal(requests.Dependencies, []string{"certifi", "charset-normalizer"}) {
+		t.Errorf("requests requires %v", requests.Dependencies)
+	}
+	if !slices.Equal(requests.Licenses, []string{"Apache 2.0"}) || !slices.Equal(packages[4].Licenses, []string{"BSD-2-Clause"}) {
+		t.Errorf("licenses = %v and %v", requests.Licenses, packages[4].Licenses)
+	}
+	// A license field holding the whole text falls back to the classifier
+	if !slices.Equal(charset.Licenses, []string{"MIT License"}) {
+		t.Errorf("charset-normalizer licenses = %v", charset.Licenses)
+	}
+
+	if _, err := VenvPackages(t.TempDir()); err == nil {
+		t.Error("VenvPackages() of an empty venv succeeded")
+	}
+}
+
+func TestGenerateToolSBOM(t *testing.T) {
+	home := t.TempDir()
+	installer, err := NewInstaller(home, NewVenvManager(home, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installer.manifest.Tools["httpie"] = &Tool{Name: "httpie", Version: "3.2.2", Ecosystem: "python",
+		InstallPath: httpieVenv(t), Source: InstallSource{Type: SourcePyPI, URL: "httpie"}}
+
+	sbom, err := installer.GenerateSBOM("httpie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root := sbom.Metadata.Component; root.Name != "httpie" || root.PackageURL != "pkg:pypi/httpie@3.2.2" {
+		t.Errorf("metadata component = %+v", root)
+	}
+	if len(sbom.Components) != 4 {
+		t.Errorf("components = %+v, want the dependencies without httpie and pip", sbom.Components)
+	}
+	direct := sbom.Dependencies[0]
+	if want := []string{"pkg:pypi/Pygments@2.17.2", "pkg:pypi/requests@2.31.0"}; !reflect.DeepEqual(direct.DependsOn, want) {
+		t.Errorf("httpie depends on %v, want %v", direct.DependsOn, want)
+	}
+
+	tool, _ := installer.Get("httpie")
+	if tool.Security.SBOMPath != installer.SBOMPath("httpie") {
+		t.Errorf("SBOMPath = %q", tool.Security.SBOMPath)
+	}
+	if _, err := os.Stat(installer.SBOMPath("httpie")); err != nil {
+		t.Errorf("SBOM not written: %v", err)
+	}
+
+	if err := installer.Uninstall("httpie"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(installer.SBOMPath("httpie")); !os.IsNotExist(err) {
+		t.Errorf("uninstall left the SBOM behind: %v", err)
+	}
+}
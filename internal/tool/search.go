@@ -0,0 +1,339 @@
+package tool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// PyPI endpoints search reads; tests point them elsewhere
+var (
+	pypiSimpleURL = "https://pypi.org/simple/"
+	pypiJSONURL   = "https://pypi.org/pypi/"
+)
+
+// pypiIndexMaxAge is how long the cached list of PyPI projects is used
+// before it is downloaded again
+const pypiIndexMaxAge = 24 * time.Hour
+
+// CatalogEntry is an ops tool in the curated index shipped with ophid
+type CatalogEntry struct {
+	Name      string
+	Ecosystem string // "pypi", "cargo", "gem" or "conda"
+	Install   string // What to pass to ophid install
+	Summary   string
+	Tags      []string
+}
+
+var catalog = []CatalogEntry{
+	{Name: "ansible", Ecosystem: "pypi", Install: "ansible", Summary: "Agentless configuration management and orchestration", Tags: []string{"config", "automation", "ssh"}},
+	{Name: "ansible-lint", Ecosystem: "pypi", Install: "ansible-lint", Summary: "Checks Ansible playbooks for practices and behavior to improve", Tags: []string{"ansible", "lint"}},
+	{Name: "molecule", Ecosystem: "pypi", Install: "molecule", Summary: "Tests Ansible roles against real instances", Tags: []string{"ansible", "testing"}},
+	{Name: "awscli", Ecosystem: "pypi", Install: "--profile aws", Summary: "AWS command line interface", Tags: []string{"aws", "cloud"}},
+	{Name: "aws-sam-cli", Ecosystem: "pypi", Install: "aws-sam-cli", Summary: "Builds and tests AWS serverless applications", Tags: []string{"aws", "cloud", "serverless"}},
+	{Name: "azure-cli", Ecosystem: "pypi", Install: "--profile azure", Summary: "Azure command line interface (az)", Tags: []string{"azure", "cloud"}},
+	{Name: "gcloud", Ecosystem: "pypi", Install: "--profile gcloud", Summary: "Google Cloud command line interface", Tags: []string{"gcp", "google", "cloud"}},
+	{Name: "cfn-lint", Ecosystem: "pypi", Install: "cfn-lint", Summary: "Validates AWS CloudFormation templates", Tags: []string{"aws", "lint", "iac"}},
+	{Name: "checkov", Ecosystem: "pypi", Install: "checkov", Summary: "Scans infrastructure as code for misconfigurations", Tags: []string{"security", "iac", "terraform"}},
+	{Name: "yamllint", Ecosystem: "pypi", Install: "yamllint", Summary: "Linter for YAML files", Tags: []string{"yaml", "lint"}},
+	{Name: "pre-commit", Ecosystem: "pypi", Install: "pre-commit", Summary: "Manages and runs git pre-commit hooks", Tags: []string{"git", "lint"}},
+	{Name: "httpie", Ecosystem: "pypi", Install: "httpie", Summary: "Human friendly HTTP client (http)", Tags: []string{"http", "api"}},
+	{Name: "mitmproxy", Ecosystem: "pypi", Install: "mitmproxy", Summary: "Interactive HTTPS proxy", Tags: []string{"http", "proxy", "debug"}},
+	{Name: "glances", Ecosystem: "pypi", Install: "glances", Summary: "System monitoring in the terminal", Tags: []string{"monitoring"}},
+	{Name: "s3cmd", Ecosystem: "pypi", Install: "s3cmd", Summary: "Command line client for S3 compatible storage", Tags: []string{"aws", "s3", "storage"}},
+	{Name: "fabric", Ecosystem: "pypi", Install: "fabric", Summary: "Runs shell commands remotely over SSH", Tags: []string{"ssh", "automation"}},
+	{Name: "sshuttle", Ecosystem: "pypi", Install: "sshuttle", Summary: "VPN over SSH", Tags: []string{"ssh", "network", "vpn"}},
+	{Name: "borgbackup", Ecosystem: "pypi", Install: "borgbackup", Summary: "Deduplicating, encrypted backups", Tags: []string{"backup"}},
+	{Name: "certbot", Ecosystem: "pypi", Install: "certbot", Summary: "Gets and renews Let's Encrypt certificates", Tags: []string{"tls", "certificates"}},
+	{Name: "pgcli", Ecosystem: "pypi", Install: "pgcli", Summary: "PostgreSQL client with completion and highlighting", Tags: []string{"database", "postgres"}},
+	{Name: "mycli", Ecosystem: "pypi", Install: "mycli", Summary: "MySQL client with completion and highlighting", Tags: []string{"database", "mysql"}},
+	{Name: "locust", Ecosystem: "pypi", Install: "locust", Summary: "Load testing with scenarios written in Python", Tags: []string{"http", "testing", "load"}},
+	{Name: "yq", Ecosystem: "pypi", Install: "yq", Summary: "jq wrapper for YAML, XML and TOML", Tags: []string{"yaml", "json"}},
+	{Name: "ripgrep", Ecosystem: "cargo", Install: "cargo:ripgrep", Summary: "Recursive regex search (rg)", Tags: []string{"search", "grep"}},
+	{Name: "fd-find", Ecosystem: "cargo", Install: "cargo:fd-find", Summary: "Fast, friendly alternative to find (fd)", Tags: []string{"search", "files"}},
+	{Name: "bat", Ecosystem: "cargo", Install: "cargo:bat", Summary: "cat with syntax highlighting", Tags: []string{"files"}},
+	{Name: "rubocop", Ecosystem: "gem", Install: "gem:rubocop", Summary: "Ruby linter and formatter", Tags: []string{"ruby", "lint"}},
+	{Name: "gdal", Ecosystem: "conda", Install: "conda:gdal", Summary: "Geospatial raster and vector tools (gdalinfo, ogr2ogr)", Tags: []string{"geo", "scientific"}},
+	{Name: "libnetcdf", Ecosystem: "conda", Install: "conda:libnetcdf", Summary: "netCDF tools (ncdump, nccopy)", Tags: []string{"netcdf", "scientific"}},
+}
+
+// Catalog returns the curated index of ops tools
+func Catalog() []CatalogEntry {
+	return slices.Clone(catalog)
+}
+
+// SearchEcosystems are the ecosystems ophid search looks in. PyPI is
+// queried; the others have curated entries only.
+var SearchEcosystems = []string{"pypi", "cargo", "gem", "conda"}
+
+// SearchResult is a tool found by Search
+type SearchResult struct {
+	Name      string `json:"name"`
+	Ecosystem string `json:"ecosystem"`
+	Install   string `json:"install"` // What to pass to ophid install
+	Version   string `json:"version,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+	Curated   bool   `json:"curated"`
+	Installed bool   `json:"installed"`
+
+	score int
+}
+
+// SearchOptions configures Search
+type SearchOptions struct {
+	Ecosystems []string // Ecosystems to search (default: all of SearchEcosystems)
+	Limit      int      // Most results to return (default 20)
+}
+
+// Searcher finds tools in the curated index and on PyPI
+type Searcher struct {
+	homeDir string
+}
+
+// NewSearcher creates a new searcher
+func NewSearcher(homeDir string) *Searcher {
+	return &Searcher{homeDir: homeDir}
+}
+
+// Search returns the tools matching every word of query, best first:
+// exact names, then names starting with the query, then names and curated
+// summaries containing it. Curated tools rank above PyPI projects that
+// match as well. When PyPI can't be reached the curated results are
+// returned with a warning.
+func (s *Searcher) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	terms := strings.Fields(normalizeProjectName(query))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty search query")
+	}
+	ecosystems := opts.Ecosystems
+	if len(ecosystems) == 0 {
+		ecosystems = SearchEcosystems
+	}
+	for _, e := range ecosystems {
+		if e == "npm" {
+			return nil, fmt.Errorf("npm can't be searched until ophid installs Node tools")
+		}
+		if !slices.Contains(SearchEcosystems, e) {
+			return nil, fmt.Errorf("unknown ecosystem %s (available: %s)", e, strings.Join(SearchEcosystems, ", "))
+		}
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	var results []SearchResult
+	curated := make(map[string]bool)
+	for _, entry := range catalog {
+		if !slices.Contains(ecosystems, entry.Ecosystem) {
+			continue
+		}
+		score := matchScore(terms, normalizeProjectName(entry.Name), strings.ToLower(entry.Summary+" "+strings.Join(entry.Tags, " ")))
+		if score == 0 {
+			continue
+		}
+		results = append(results, SearchResult{
+			Name:      entry.Name,
+			Ecosystem: entry.Ecosystem,
+			Install:   entry.Install,
+			Summary:   entry.Summary,
+			Curated:   true,
+			score:     score + 5,
+		})
+		if entry.Ecosystem == "pypi" {
+			curated[normalizeProjectName(entry.Name)] = true
+		}
+	}
+
+	if slices.Contains(ecosystems, "pypi") {
+		projects, err := s.pypiProjects(ctx)
+		if err != nil {
+			ui.Warn("Searching only the curated index: %v", err)
+		}
+		for _, name := range projects {
+			normalized := normalizeProjectName(name)
+			if curated[normalized] {
+				continue
+			}
+			if score := matchScore(terms, normalized, ""); score > 0 {
+				results = append(results, SearchResult{Name: name, Ecosystem: "pypi", Install: name, score: score})
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		if results[a].score != results[b].score {
+			return results[a].score > results[b].score
+		}
+		if len(results[a].Name) != len(results[b].Name) {
+			return len(results[a].Name) < len(results[b].Name)
+		}
+		return results[a].Name < results[b].Name
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	s.describe(ctx, results)
+	if manifest, err := LoadManifest(s.homeDir); err == nil {
+		for n := range results {
+			_, results[n].Installed = manifest.Tools[results[n].Name]
+		}
+	}
+	return results, nil
+}
+
+// matchScore scores how well a name and its description match every
+// term, or returns 0 if a term matches neither
+func matchScore(terms []string, name, description string) int {
+	total := 0
+	for _, term := range terms {
+		switch {
+		case name == term:
+			total += 100
+		case strings.HasPrefix(name, term):
+			total += 60
+		case strings.Contains(name, term):
+			total += 40
+		case strings.Contains(description, term):
+			total += 10
+		default:
+			return 0
+		}
+	}
+	return total
+}
+
+// describe fills in the version of the PyPI results, and the summary of
+// those not in the curated index, from the PyPI JSON API. Projects PyPI
+// doesn't answer for are left as they are.
+func (s *Searcher) describe(ctx context.Context, results []SearchResult) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for n := range results {
+		if results[n].Ecosystem != "pypi" {
+			continue
+		}
+		// Profiles installed from the vendor's archive aren't on PyPI
+		if name, ok := strings.CutPrefix(results[n].Install, "--profile "); ok {
+			if p, err := LookupProfile(name); err == nil && p.Archive {
+				continue
+			}
+		}
+		wg.Add(1)
+		go func(r *SearchResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			meta, err := fetchPyPIMetadata(ctx, s.homeDir, r.Name)
+			if err != nil {
+				slog.Debug("failed to describe project", "project", r.Name, "error", err)
+				return
+			}
+			r.Version = meta.LatestVersion
+			if r.Summary == "" {
+				r.Summary = meta.Summary
+			}
+		}(&results[n])
+	}
+	wg.Wait()
+}
+
+// pypiProjects returns the names of all PyPI projects, from a cache
+// refreshed daily. A stale cache is used when PyPI can't be reached.
+func (s *Searcher) pypiProjects(ctx context.Context) ([]string, error) {
+	path := filepath.Join(s.homeDir, "cache", "pypi", "projects.txt")
+	info, statErr := os.Stat(path)
+	if statErr == nil && time.Since(info.ModTime()) < pypiIndexMaxAge {
+		return readLines(path)
+	}
+
+	names, err := fetchPyPIProjects(ctx)
+	if err != nil {
+		if statErr == nil {
+			ui.Warn("Using the PyPI project list from %s: %v", info.ModTime().Format("2006-01-02"), err)
+			return readLines(path)
+		}
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		if err := os.WriteFile(path, []byte(strings.Join(names, "\n")+"\n"), 0644); err != nil {
+			slog.Warn("failed to cache the PyPI project list", "error", err)
+		}
+	}
+	return names, nil
+}
+
+// fetchPyPIProjects downloads the list of PyPI projects from the JSON form
+// of the simple index (PEP 691)
+func fetchPyPIProjects(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pypiSimpleURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.pypi.simple.v1+json")
+	ui.Printf("Downloading the PyPI project list\n")
+
+	client := &http.Client{Timeout: 2 * time.Minute, Transport: pypiTransport()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errcode.Wrap(errcode.Network, fmt.Errorf("failed to query PyPI: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errcode.Errorf(errcode.Network, "PyPI returned status %d", resp.StatusCode)
+	}
+
+	var index struct {
+		Projects []struct {
+			Name string `json:"name"`
+		} `json:"projects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to parse PyPI project list: %w", err)
+	}
+	names := make([]string, len(index.Projects))
+	for n, p := range index.Projects {
+		names[n] = p.Name
+	}
+	return names, nil
+}
+
+var projectNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizeProjectName normalizes a project name the way PyPI compares
+// them (PEP 503): lower case, with runs of -, _ and . as one -
+func normalizeProjectName(name string) string {
+	return projectNameSeparators.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// readLines reads the non-empty lines of a file
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,112 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakePyPI serves a simple index of a few projects and the JSON API for
+// them, counting the requests for the index
+func fakePyPI(t *testing.T) *int {
+	t.Helper()
+	indexRequests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/simple/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/vnd.pypi.simple.v1+json" {
+			http.Error(w, "HTML only", http.StatusNotAcceptable)
+			return
+		}
+		indexRequests++
+		fmt.Fprint(w, `{"projects": [{"name": "ansible"}, {"name": "ansible-core"}, {"name": "Ansible_Runner"}, {"name": "pytest-ansible"}, {"name": "requests"}]}`)
+	})
+	mux.HandleFunc("/pypi/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/pypi/"), "/json")
+		if name == "missing" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"info": map[string]string{"version": "1.0." + fmt.Sprint(len(name)), "summary": "About " + name}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	oldSimple, oldJSON := pypiSimpleURL, pypiJSONURL
+	pypiSimpleURL, pypiJSONURL = srv.URL+"/simple/", srv.URL+"/pypi/"
+	t.Cleanup(func() { pypiSimpleURL, pypiJSONURL = oldSimple, oldJSON })
+	return &indexRequests
+}
+
+func TestSearch(t *testing.T) {
+	indexRequests := fakePyPI(t)
+	home := t.TempDir()
+	os.MkdirAll(filepath.Join(home, "tools"), 0755)
+	os.WriteFile(filepath.Join(home, "tools", "manifest.json"), []byte(`{"tools": {"ansible-core": {"name": "ansible-core"}}}`), 0644)
+
+	results, err := NewSearcher(home).Search(context.Background(), "ansible", SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+	// Exact name, then prefixes (curated first, shorter first), then the rest
+	want := "ansible,ansible-lint,ansible-core,Ansible_Runner,pytest-ansible,molecule"
+	if got := strings.Join(names, ","); got != want {
+		t.Fatalf("results = %s, want %s", got, want)
+	}
+
+	byName := make(map[string]SearchResult)
+	for _, r := range results {
+		byName[r.Name] = r
+	}
+	if r := byName["ansible"]; !r.Curated || r.Version != "1.0.7" || r.Summary != "Agentless configuration management and orchestration" {
+		t.Errorf("ansible = %+v, want the curated entry with PyPI's version", r)
+	}
+	if r := byName["ansible-core"]; r.Curated || r.Summary != "About ansible-core" || !r.Installed {
+		t.Errorf("ansible-core = %+v, want PyPI's summary, installed", r)
+	}
+
+	// The project list is cached
+	if _, err := NewSearcher(home).Search(context.Background(), "requests", SearchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if *indexRequests != 1 {
+		t.Errorf("the PyPI index was downloaded %d times, want once", *indexRequests)
+	}
+}
+
+func TestSearchOptions(t *testing.T) {
+	fakePyPI(t)
+	s := NewSearcher(t.TempDir())
+
+	results, err := s.Search(context.Background(), "lint", SearchOptions{Ecosystems: []string{"gem"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "rubocop" || results[0].Install != "gem:rubocop" {
+		t.Errorf("gem results = %+v, want rubocop only", results)
+	}
+
+	results, err = s.Search(context.Background(), "ansible", SearchOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Errorf("got %d results, want the limit of 2", len(results))
+	}
+
+	if _, err := s.Search(context.Background(), "express", SearchOptions{Ecosystems: []string{"npm"}}); err == nil {
+		t.Error("searched npm, which ophid can't install from")
+	}
+	if _, err := s.Search(context.Background(), "x", SearchOptions{Ecosystems: []string{"maven"}}); err == nil {
+		t.Error("accepted an unknown ecosystem")
+	}
+}
@@ -0,0 +1,165 @@
+package tool
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gleicon/ophid/internal/config"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// ShimMarker identifies shims ophid wrote, which it may replace or remove
+const ShimMarker = "Installed by ophid as a shim"
+
+// ShimDir returns the directory of the shims of installed executables,
+// meant to be in PATH
+func (i *Installer) ShimDir() string {
+	return filepath.Join(i.homeDir, "bin")
+}
+
+// shimFile returns the file name of an executable's shim
+func shimFile(executable string) string {
+	if runtime.GOOS == "windows" {
+		return strings.TrimSuffix(executable, filepath.Ext(executable)) + ".cmd"
+	}
+	return executable
+}
+
+// shimScript returns a shim running command with the shim's arguments
+func shimScript(owner string, command []string) string {
+	quoted := make([]string, len(command))
+	if runtime.GOOS == "windows" {
+		for n, arg := range command {
+			quoted[n] = `"` + arg + `"`
+		}
+		return fmt.Sprintf("@echo off\r\nrem %s for %s\r\n%s %%*\r\n", ShimMarker, owner, strings.Join(quoted, " "))
+	}
+	for n, arg := range command {
+		quoted[n] = shellQuote(arg)
+	}
+	return fmt.Sprintf("#!/bin/sh\n# %s for %s\nexec %s \"$@\"\n", ShimMarker, owner, strings.Join(quoted, " "))
+}
+
+// ownerOf returns the tool that runs an executable by its bare name
+func (i *Installer) ownerOf(executable string) string {
+	if owner, ok := i.manifest.ExecutableOwners[executable]; ok {
+		return owner
+	}
+	if providers := i.providersOf(executable); len(providers) > 0 {
+		return providers[0]
+	}
+	return ""
+}
+
+// shims returns the shims the installed tools need, file name -> script.
+// A shared executable's shim runs the tool that owns the name. Sandboxed
+// tools are run through ophid run so the shim doesn't escape the sandbox,
+// in the profile the shims belong to.
+func (i *Installer) shims() map[string]string {
+	ophid, err := os.Executable()
+	if err != nil {
+		ophid = "ophid"
+	}
+	run := []string{ophid, "run"}
+	if profile := os.Getenv(config.ProfileEnv); profile != "" {
+		run = []string{ophid, "--profile", profile, "run"}
+	}
+	shims := make(map[string]string)
+	for _, t := range i.manifest.Tools {
+		for _, exe := range t.Executables {
+			if exe == "ophid" || i.ownerOf(exe) != t.Name {
+				continue
+			}
+			command := []string{filepath.Join(i.venvManager.GetBinDir(t.InstallPath), exe)}
+			if t.Sandbox != nil {
+				command = append(slices.Clone(run), "--", t.Name+NamespaceSeparator+exe)
+			}
+			shims[shimFile(exe)] = shimScript(t.Name, command)
+		}
+	}
+	return shims
+}
+
+// SyncShims writes a shim into ShimDir for every installed executable and
+// removes the shims of executables no longer installed. Files ophid didn't
+// write are left alone.
+func (i *Installer) SyncShims() error {
+	dir := i.ShimDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	want := i.shims()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if _, ok := want[entry.Name()]; ok || !isShim(path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove shim %s: %w", entry.Name(), err)
+		}
+	}
+
+	for name, script := range want {
+		path := filepath.Join(dir, name)
+		current, err := os.ReadFile(path)
+		if err == nil {
+			if string(current) == script {
+				continue
+			}
+			if !bytes.Contains(current, []byte(ShimMarker)) {
+				ui.Warn("%s isn't an ophid shim; leaving it in place", path)
+				continue
+			}
+		}
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			return fmt.Errorf("failed to write shim %s: %w", name, err)
+		}
+		// WriteFile keeps the mode of a file it replaces
+		if err := os.Chmod(path, 0755); err != nil {
+			return fmt.Errorf("failed to make shim %s executable: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// StaleShims returns the executables whose shim is missing or out of date
+func (i *Installer) StaleShims() []string {
+	var stale []string
+	for name, script := range i.shims() {
+		current, err := os.ReadFile(filepath.Join(i.ShimDir(), name))
+		if err != nil || string(current) != script {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// syncShims updates the shims after the manifest changed. A failure only
+// warns, as the tools still run with ophid run.
+func (i *Installer) syncShims() {
+	if err := i.SyncShims(); err != nil {
+		ui.Warn("Failed to update shims: %v", err)
+	}
+}
+
+// isShim reports whether path is a shim ophid wrote
+func isShim(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > 4096 {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && bytes.Contains(data, []byte(ShimMarker))
+}
@@ -0,0 +1,104 @@
+//go:build unix
+
+package tool
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/sandbox"
+)
+
+func TestSyncShims(t *testing.T) {
+	home := t.TempDir()
+	venvMgr := NewVenvManager(home, "/usr/bin/python3")
+	installer, err := NewInstaller(home, venvMgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two tools provide http; each executable prints its tool's name
+	addTool := func(name string, executables ...string) {
+		t.Helper()
+		venv := filepath.Join(home, "tools", name, "venv")
+		os.MkdirAll(venvMgr.GetBinDir(venv), 0755)
+		for _, exe := range executables {
+			os.WriteFile(filepath.Join(venvMgr.GetBinDir(venv), exe), []byte("#!/bin/sh\necho "+name+" \"$@\"\n"), 0755)
+		}
+		tool := &Tool{Name: name, InstallPath: venv, Executables: executables}
+		installer.manifest.Tools[name] = tool
+		installer.claimExecutables(tool, false)
+	}
+	addTool("httpie", "http", "https")
+	addTool("xh", "http", "xh")
+
+	shimDir := installer.ShimDir()
+	os.MkdirAll(shimDir, 0755)
+	os.WriteFile(filepath.Join(shimDir, "xh"), []byte("#!/bin/sh\necho mine\n"), 0755)
+	os.WriteFile(filepath.Join(shimDir, "gone"), []byte("#!/bin/sh\n# "+ShimMarker+" for old\n"), 0755)
+
+	if err := installer.SyncShims(); err != nil {
+		t.Fatal(err)
+	}
+	run := func(name string) string {
+		t.Helper()
+		out, err := exec.Command(filepath.Join(shimDir, name), "-v").Output()
+		if err != nil {
+			t.Fatalf("running the %s shim: %v", name, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if got := run("http"); got != "httpie -v" {
+		t.Errorf("http shim ran %q, want the owner httpie", got)
+	}
+	if got := run("https"); got != "httpie -v" {
+		t.Errorf("https shim ran %q", got)
+	}
+	if got := run("xh"); got != "mine" {
+		t.Errorf("a file ophid didn't write was replaced; it ran %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(shimDir, "gone")); !os.IsNotExist(err) {
+		t.Error("the shim of an executable no longer installed was kept")
+	}
+	if stale := installer.StaleShims(); len(stale) != 1 || stale[0] != "xh" {
+		t.Errorf("StaleShims = %v, want only xh", stale)
+	}
+
+	// The shim follows the owner of a shared name
+	if err := installer.SetExecutableOwner("http", "xh"); err != nil {
+		t.Fatal(err)
+	}
+	if got := run("http"); got != "xh -v" {
+		t.Errorf("after --prefer xh, http shim ran %q", got)
+	}
+
+	// Which sees a tool as on PATH through its shim
+	providers := installer.Which("http", shimDir)
+	for _, p := range providers {
+		if onPath := p.Tool == "xh"; p.OnPath != onPath {
+			t.Errorf("%s: on_path = %v, want %v", p.Tool, p.OnPath, onPath)
+		}
+	}
+
+	// Sandboxed tools run through ophid run
+	if err := installer.SetSandbox("httpie", &sandbox.Profile{NoNetwork: true}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(shimDir, "https"))
+	if !strings.Contains(string(data), "'run' '--' 'httpie:https'") {
+		t.Errorf("sandboxed shim = %q, want it to use ophid run", data)
+	}
+
+	if err := installer.Uninstall("httpie"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(shimDir, "https")); !os.IsNotExist(err) {
+		t.Error("uninstall kept the shim of https")
+	}
+	if got := run("http"); got != "xh -v" {
+		t.Errorf("after uninstalling httpie, http shim ran %q", got)
+	}
+}
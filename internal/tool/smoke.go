@@ -0,0 +1,126 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/errcode"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// smokeTestTimeout bounds a smoke test; a version check that hangs fails
+const smokeTestTimeout = time.Minute
+
+// smokeTestOutputMax is how much of a failed smoke test's output the
+// manifest keeps
+const smokeTestOutputMax = 2 << 10
+
+// SmokeTest is a command run after a tool installs to check that it works,
+// e.g. ansible --version, and its last result
+type SmokeTest struct {
+	Command   []string  `json:"command"` // Executable of the tool and its arguments
+	Passed    bool      `json:"passed"`
+	Output    string    `json:"output,omitempty"` // End of the output of a failed run
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// String returns the smoke test command as typed
+func (s *SmokeTest) String() string {
+	return strings.Join(s.Command, " ")
+}
+
+// smokeTestCommand returns the smoke test a freshly installed tool gets:
+// the one given to install, else the one of the version it replaced, else
+// its profile's
+func smokeTestCommand(t *Tool, opts InstallOptions) []string {
+	if len(opts.SmokeTest) > 0 {
+		return opts.SmokeTest
+	}
+	if t.SmokeTest != nil {
+		return t.SmokeTest.Command
+	}
+	if p, ok := ProfileOf(t); ok {
+		return p.SmokeTest
+	}
+	return nil
+}
+
+// runSmokeTest runs a tool's smoke test command and records the result in
+// t.SmokeTest. The command's executable must be one of the tool's.
+func (i *Installer) runSmokeTest(ctx context.Context, t *Tool, command []string) error {
+	result := &SmokeTest{Command: command, CheckedAt: time.Now()}
+	t.SmokeTest = result
+
+	binDir := i.venvManager.GetBinDir(t.InstallPath)
+	var path string
+	if !strings.ContainsAny(command[0], `/\`) {
+		for _, name := range executableNames(command[0]) {
+			if candidate := filepath.Join(binDir, name); isExecutable(candidate) {
+				path = candidate
+				break
+			}
+		}
+	}
+	if path == "" {
+		result.Output = fmt.Sprintf("%s is not an executable of %s", command[0], t.Name)
+		return errcode.Errorf(errcode.Verification, "smoke test %q failed: %s", result.String(), result.Output)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smokeTestTimeout)
+	defer cancel()
+	var output tailBuffer
+	cmd := exec.CommandContext(ctx, path, command[1:]...)
+	cmd.Env = append(os.Environ(), "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", smokeTestTimeout)
+	}
+	if err != nil {
+		out := strings.TrimSpace(output.String())
+		if len(out) > smokeTestOutputMax {
+			out = out[len(out)-smokeTestOutputMax:]
+		}
+		result.Output = out
+		return errcode.Errorf(errcode.Verification, "smoke test %q failed: %v\n%s", result.String(), err, out)
+	}
+	result.Passed = true
+	return nil
+}
+
+// smokeTest runs the smoke test of a freshly installed tool, if it has one
+func (i *Installer) smokeTest(ctx context.Context, t *Tool, opts InstallOptions) error {
+	command := smokeTestCommand(t, opts)
+	if len(command) == 0 {
+		return nil
+	}
+	ui.Printf("Smoke test: %s\n", strings.Join(command, " "))
+	if err := i.runSmokeTest(ctx, t, command); err != nil {
+		return err
+	}
+	ui.OK("Smoke test passed")
+	return nil
+}
+
+// SmokeTest runs an installed tool's smoke test again and records the
+// result in the manifest. It returns nil when the tool has none.
+func (i *Installer) SmokeTest(ctx context.Context, name string) (*SmokeTest, error) {
+	t, exists := i.manifest.Tools[name]
+	if !exists {
+		return nil, errcode.Errorf(errcode.NotFound, "tool %s is not installed", name)
+	}
+	command := smokeTestCommand(t, InstallOptions{})
+	if len(command) == 0 {
+		return nil, nil
+	}
+	testErr := i.runSmokeTest(ctx, t, command)
+	if err := i.saveManifest(); err != nil {
+		return t.SmokeTest, fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return t.SmokeTest, testErr
+}
@@ -0,0 +1,80 @@
+//go:build unix
+
+package tool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gleicon/ophid/internal/errcode"
+)
+
+func TestSmokeTest(t *testing.T) {
+	tmpDir := t.TempDir()
+	venvMgr := NewVenvManager(tmpDir, "/usr/bin/python3")
+	installer, err := NewInstaller(tmpDir, venvMgr)
+	if err != nil {
+		t.Fatalf("NewInstaller() error = %v", err)
+	}
+
+	venv := filepath.Join(tmpDir, "tools", "ansible", "venv")
+	binDir := venvMgr.GetBinDir(venv)
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\nif [ \"$1\" = --version ]; then echo ansible 9.0.0; exit 0; fi\necho \"unknown option $1\" >&2\nexit 2\n"
+	if err := os.WriteFile(filepath.Join(binDir, "ansible"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ansible := &Tool{Name: "ansible", Version: "9.0.0", InstallPath: venv, Executables: []string{"ansible"}}
+	installer.manifest.Tools["ansible"] = ansible
+
+	// Tools without a smoke test pass silently
+	if result, err := installer.SmokeTest(context.Background(), "ansible"); result != nil || err != nil {
+		t.Fatalf("SmokeTest() = %v, %v; want nothing to run", result, err)
+	}
+
+	if err := installer.smokeTest(context.Background(), ansible, InstallOptions{SmokeTest: []string{"ansible", "--version"}}); err != nil {
+		t.Fatalf("smokeTest() error = %v", err)
+	}
+	if !ansible.SmokeTest.Passed || ansible.SmokeTest.String() != "ansible --version" {
+		t.Errorf("recorded %+v", ansible.SmokeTest)
+	}
+
+	err = installer.smokeTest(context.Background(), ansible, InstallOptions{SmokeTest: []string{"ansible", "--bogus"}})
+	if errcode.Of(err) != errcode.Verification {
+		t.Fatalf("failing smoke test: error = %v, want a verification error", err)
+	}
+	if ansible.SmokeTest.Passed || !strings.Contains(ansible.SmokeTest.Output, "unknown option --bogus") {
+		t.Errorf("recorded %+v", ansible.SmokeTest)
+	}
+
+	// Only the tool's own executables run
+	for _, command := range [][]string{{"sh", "-c", "true"}, {"/bin/true"}} {
+		if err := installer.smokeTest(context.Background(), ansible, InstallOptions{SmokeTest: command}); err == nil {
+			t.Errorf("%v: expected an error", command)
+		}
+	}
+
+	// A reinstall keeps the smoke test, and SmokeTest runs it again
+	ansible.SmokeTest = &SmokeTest{Command: []string{"ansible", "--version"}}
+	installer.putTool(&Tool{Name: "ansible", Version: "9.1.0", InstallPath: venv, Executables: []string{"ansible"}}, false)
+	result, err := installer.SmokeTest(context.Background(), "ansible")
+	if err != nil || result == nil || !result.Passed {
+		t.Fatalf("SmokeTest() = %+v, %v", result, err)
+	}
+	manifest, err := LoadManifest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := manifest.Tools["ansible"].SmokeTest; st == nil || !st.Passed {
+		t.Errorf("manifest smoke test = %+v", st)
+	}
+
+	if _, err := installer.SmokeTest(context.Background(), "missing"); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("SmokeTest(missing) error = %v, want not found", err)
+	}
+}
@@ -24,12 +24,28 @@ func NewSourceDetector() *SourceDetector {
 //   - "git+https://example.com/repo.git" -> Git
 //   - "./mypackage" or "/absolute/path" -> Local
 //   - "file:///path/to/package" -> Local
+//   - "cargo:ripgrep" or "https://crates.io/crates/ripgrep" -> Cargo
+//   - "gem:rubocop" or "https://rubygems.org/gems/rubocop" -> Gem
+//   - "conda:gdal", "conda:bioconda::samtools" or "https://anaconda.org/conda-forge/gdal" -> Conda
+//   - "npm:prettier", "https://www.npmjs.com/package/prettier", or
+//     "prettier" with the node ecosystem -> NPM
 func (sd *SourceDetector) DetectSource(spec string, opts InstallOptions) (InstallSource, error) {
 	// If source is explicitly provided, use it
 	if opts.Source.Type != "" {
 		return opts.Source, nil
 	}
 
+	switch opts.Ecosystem {
+	case "", "python":
+	case "node":
+		if pkg, ok := parseNpmName(strings.TrimPrefix(spec, "npm:")); ok {
+			return InstallSource{Type: SourceNPM, URL: pkg}, nil
+		}
+		return InstallSource{}, fmt.Errorf("invalid npm package name: %s", spec)
+	default:
+		return InstallSource{}, fmt.Errorf("unsupported ecosystem %q: must be python or node", opts.Ecosystem)
+	}
+
 	// Local path detection
 	if sd.isLocalPath(spec) {
 		absPath, err := filepath.Abs(spec)
@@ -47,6 +63,35 @@ func (sd *SourceDetector) DetectSource(spec string, opts InstallOptions) (Instal
 		}, nil
 	}
 
+	// Rust crates: cargo:<crate> or a crates.io URL
+	if crate, ok := sd.parseRegistrySpec(spec, "cargo", "crates.io/crates/"); ok {
+		return InstallSource{
+			Type: SourceCargo,
+			URL:  crate,
+		}, nil
+	}
+
+	// Ruby gems: gem:<name> or a rubygems.org URL
+	if gem, ok := sd.parseRegistrySpec(spec, "gem", "rubygems.org/gems/"); ok {
+		return InstallSource{
+			Type: SourceGem,
+			URL:  gem,
+		}, nil
+	}
+
+	// Conda packages: conda:[<channel>::]<name> or an anaconda.org URL
+	if source, ok := sd.parseCondaSpec(spec); ok {
+		return source, nil
+	}
+
+	// Node.js packages: npm:<name> or an npmjs.com URL
+	if pkg, ok := sd.parseNpmSpec(spec); ok {
+		return InstallSource{
+			Type: SourceNPM,
+			URL:  pkg,
+		}, nil
+	}
+
 	// Git URL detection (git+https://, git+ssh://, git://)
 	if strings.HasPrefix(spec, "git+") || strings.HasPrefix(spec, "git://") {
 		return sd.parseGitURL(spec)
@@ -108,6 +153,111 @@ func (sd *SourceDetector) isLocalPath(spec string) bool {
 	return false
 }
 
+// parseRegistrySpec returns the package of a <scheme>:<name> spec or of a
+// registry page URL, like https://crates.io/crates/<name> for the page
+// "crates.io/crates/"
+func (sd *SourceDetector) parseRegistrySpec(spec, scheme, page string) (string, bool) {
+	name, ok := strings.CutPrefix(spec, scheme+":")
+	if !ok {
+		for _, prefix := range []string{"https://" + page, page} {
+			if name, ok = strings.CutPrefix(spec, prefix); ok {
+				name, _, _ = strings.Cut(name, "/")
+				break
+			}
+		}
+	}
+	if !ok || name == "" {
+		return "", false
+	}
+	for _, c := range name {
+		if !isAlphanumericOrDash(c) || c == '.' {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// parseCondaSpec parses conda:<name>, conda:<channel>::<name> (conda's own
+// channel syntax) and https://anaconda.org/<channel>/<name>
+func (sd *SourceDetector) parseCondaSpec(spec string) (InstallSource, bool) {
+	channel, name := CondaDefaultChannel, ""
+	if rest, ok := strings.CutPrefix(spec, "conda:"); ok {
+		name = rest
+		if c, n, found := strings.Cut(rest, "::"); found {
+			channel, name = c, n
+		}
+	} else {
+		for _, prefix := range []string{"https://anaconda.org/", "anaconda.org/"} {
+			if rest, ok := strings.CutPrefix(spec, prefix); ok {
+				parts := strings.Split(rest, "/")
+				if len(parts) < 2 {
+					return InstallSource{}, false
+				}
+				channel, name = parts[0], parts[1]
+				break
+			}
+		}
+	}
+	for _, part := range []string{channel, name} {
+		if part == "" {
+			return InstallSource{}, false
+		}
+		for _, c := range part {
+			if !isAlphanumericOrDash(c) || c == '.' {
+				return InstallSource{}, false
+			}
+		}
+	}
+	return InstallSource{
+		Type:     SourceConda,
+		URL:      name,
+		Metadata: map[string]string{"channel": channel},
+	}, true
+}
+
+// parseNpmSpec parses npm:<name> and npmjs.com package URLs, like
+// https://www.npmjs.com/package/@scope/name
+func (sd *SourceDetector) parseNpmSpec(spec string) (string, bool) {
+	if name, ok := strings.CutPrefix(spec, "npm:"); ok {
+		return parseNpmName(name)
+	}
+	for _, prefix := range []string{"https://www.npmjs.com/package/", "https://npmjs.com/package/", "www.npmjs.com/package/", "npmjs.com/package/"} {
+		if rest, ok := strings.CutPrefix(spec, prefix); ok {
+			// Keep the scope of @scope/name, drop paths like /v/1.0.0
+			parts := strings.SplitN(rest, "/", 3)
+			name := parts[0]
+			if strings.HasPrefix(name, "@") && len(parts) > 1 {
+				name += "/" + parts[1]
+			}
+			return parseNpmName(name)
+		}
+	}
+	return "", false
+}
+
+// parseNpmName checks an npm package name, <name> or @<scope>/<name>
+func parseNpmName(name string) (string, bool) {
+	parts := []string{name}
+	if scoped, ok := strings.CutPrefix(name, "@"); ok {
+		scope, rest, found := strings.Cut(scoped, "/")
+		if !found {
+			return "", false
+		}
+		parts = []string{scope, rest}
+	}
+	for _, part := range parts {
+		if part == "" || part[0] == '.' || part[0] == '_' {
+			return "", false
+		}
+		for _, c := range part {
+			if !isAlphanumericOrDash(c) {
+				return "", false
+			}
+		}
+	}
+	return name, true
+}
+
 // isGitHubURL checks if the spec is a GitHub URL
 func (sd *SourceDetector) isGitHubURL(spec string) bool {
 	return strings.Contains(spec, "github.com")
@@ -1,20 +1,27 @@
 package tool
 
 import (
+	"strings"
 	"time"
 
+	"github.com/gleicon/ophid/internal/sandbox"
 	"github.com/gleicon/ophid/internal/security"
+	"github.com/gleicon/ophid/internal/security/policy"
 )
 
 // SourceType represents the installation source type
 type SourceType string
 
 const (
-	SourcePyPI   SourceType = "pypi"   // PyPI package registry
-	SourceGitHub SourceType = "github" // GitHub repository
-	SourceGit    SourceType = "git"    // Generic Git repository
-	SourceLocal  SourceType = "local"  // Local directory
-	SourceNPM    SourceType = "npm"    // NPM package registry
+	SourcePyPI    SourceType = "pypi"    // PyPI package registry
+	SourceGitHub  SourceType = "github"  // GitHub repository
+	SourceGit     SourceType = "git"     // Generic Git repository
+	SourceLocal   SourceType = "local"   // Local directory
+	SourceNPM     SourceType = "npm"     // NPM package registry, installed into an npm prefix of its own
+	SourceArchive SourceType = "archive" // Vendor archive (install profiles of tools not on PyPI)
+	SourceCargo   SourceType = "cargo"   // crates.io crate: release binaries or cargo install
+	SourceGem     SourceType = "gem"     // RubyGems gem, installed into a GEM_HOME of its own
+	SourceConda   SourceType = "conda"   // conda package (conda-forge by default), installed with micromamba
 )
 
 // InstallSource describes where a package comes from
@@ -31,12 +38,13 @@ type InstallSource struct {
 
 // SecurityInfo tracks security scan results
 type SecurityInfo struct {
-	SBOMPath          string    `json:"sbom_path,omitempty"`
-	VulnScanDate      time.Time `json:"vuln_scan_date,omitempty"`
-	VulnCount         int       `json:"vuln_count"`
-	CriticalVulnCount int       `json:"critical_vuln_count"`
-	LicenseCompliant  bool      `json:"license_compliant"`
-	Licenses          []string  `json:"licenses,omitempty"`
+	SBOMPath          string            `json:"sbom_path,omitempty"`
+	VulnScanDate      time.Time         `json:"vuln_scan_date,omitempty"`
+	VulnCount         int               `json:"vuln_count"`
+	CriticalVulnCount int               `json:"critical_vuln_count"`
+	MaxSeverity       security.Severity `json:"max_severity,omitempty"` // Worst vulnerability, from its CVSS score
+	LicenseCompliant  bool              `json:"license_compliant"`
+	Licenses          []string          `json:"licenses,omitempty"`
 
 	// Secret scanning results
 	SecretsReport   *security.SecretsReport `json:"secrets,omitempty"`
@@ -53,27 +61,63 @@ type Tool struct {
 	Executables []string          `json:"executables"` // List of executable names
 	Source      InstallSource     `json:"source"`      // Installation source
 	Security    SecurityInfo      `json:"security"`    // Security scan information
+	Sandbox     *sandbox.Profile  `json:"sandbox,omitempty"` // Run-time restrictions
+	Integrity   *Integrity        `json:"integrity,omitempty"` // Hashes of the venv's RECORD files at install
+	Upgrades    []UpgradeRecord   `json:"upgrades,omitempty"` // Versions the tool was upgraded from and to
+	SmokeTest   *SmokeTest        `json:"smoke_test,omitempty"` // Command checking the tool works, and its last result
 	Metadata    map[string]string `json:"metadata,omitempty"`
 	InstalledAt time.Time         `json:"installed_at"`
+	InstallDuration time.Duration `json:"install_duration,omitempty"` // How long the last install took
 	UpdatedAt   time.Time         `json:"updated_at,omitempty"`
 }
 
+// pythonRuntime is the runtime of Python tools, followed by "@" and the
+// version their venv was built with
+const pythonRuntime = "python"
+
+// pythonRuntimeOf returns the runtime recorded for a Python tool installed
+// with opts: "python3" without a pinned version, as before pinning existed
+func pythonRuntimeOf(opts InstallOptions) string {
+	if opts.Python == "" {
+		return "python3"
+	}
+	return pythonRuntime + "@" + opts.Python
+}
+
+// PythonVersion returns the Python version a tool's venv was built with,
+// or "" for tools installed without one recorded
+func (t *Tool) PythonVersion() string {
+	version, ok := strings.CutPrefix(t.Runtime, pythonRuntime+"@")
+	if !ok {
+		return ""
+	}
+	return version
+}
+
 // InstallOptions configures tool installation
 type InstallOptions struct {
 	// Common options
 	Version      string   // Specific version or "latest"
 	Force        bool     // Force reinstall
 	SkipScan     bool     // Skip security scanning (not recommended)
-	RequireScan  bool     // Require security scan to pass (default: warn only)
+	Policy       *policy.Policy // Security policy installs are checked against (nil: none)
+	Prefer       bool     // Take executable names other tools also provide (default: they keep them)
+	Profile      string   // Curated install profile, e.g. "aws" (see Profiles)
+	Components   []string // Extra components for profiles that have them (gcloud)
+	SmokeTest    []string // Command run after install to check the tool works, e.g. ["ansible", "--version"]
+	Ecosystem    string   // Registry of a bare package name: "python" (PyPI, the default) or "node" (npm)
 
 	// Source specification
 	Source       InstallSource // Installation source (auto-detected if empty)
 
 	// Python-specific
+	Python       string   // Python version the venv is built with, recorded as the tool's runtime (e.g. "3.11.7")
 	Extras       []string // Python extras (e.g., "security" for requests[security])
 	Editable     bool     // Install in editable mode (-e for pip)
 	NoDeps       bool     // Don't install dependencies
-	Requirements string   // Path to requirements.txt
+	Requirements string   // Path to a requirements.txt pinning the tool and all its dependencies, installed instead of resolving them
+	IndexURL     string   // Package index to install from instead of PyPI; credentials come from Auth
+	BuildPolicy  BuildPolicy // Whether pip may build packages from source (default: prefer wheels)
 
 	// Git/GitHub-specific
 	GitRef       string   // Git reference (branch, tag, or commit)
@@ -81,10 +125,18 @@ type InstallOptions struct {
 
 	// Local-specific
 	LocalPath    string   // Local directory path
+
+	// Rust-specific
+	FromSource   bool     // Build with cargo even when the release has binaries
 }
 
 // ToolManifest tracks all installed tools
 type ToolManifest struct {
 	Tools      map[string]*Tool `json:"tools"` // tool name -> Tool
 	UpdatedAt  time.Time        `json:"updated_at"`
+
+	// ExecutableOwners records which tool's copy runs by the bare name for
+	// executables several tools provide (executable -> tool name). The
+	// others run as <tool>:<executable>.
+	ExecutableOwners map[string]string `json:"executable_owners,omitempty"`
 }
@@ -0,0 +1,217 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gleicon/ophid/internal/security/policy"
+	"github.com/gleicon/ophid/internal/ui"
+)
+
+// Upgrade methods
+const (
+	UpgradeInPlace = "in-place" // pip install --upgrade in the tool's venv
+	UpgradeFresh   = "fresh"    // A new venv, replacing the old one once it works
+)
+
+// UpgradeOptions configures an upgrade
+type UpgradeOptions struct {
+	Version     string         // Version to upgrade to (default: latest)
+	Fresh       bool           // Build a fresh venv instead of upgrading in place
+	Force       bool           // Reinstall even if the tool is at the version already
+	SkipScan    bool           // Skip the security scan of the new version
+	Policy      *policy.Policy // Security policy the new version is checked against (nil: none)
+	BuildPolicy BuildPolicy    // Whether pip may build from source (default: the one the tool was installed with)
+}
+
+// UpgradeRecord is one upgrade of a tool, kept in the manifest for audits
+type UpgradeRecord struct {
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	Method     string    `json:"method"`
+	UpgradedAt time.Time `json:"upgraded_at"`
+}
+
+// ErrUpToDate is returned when a tool is at the version asked for already
+var ErrUpToDate = errors.New("already up to date")
+
+// Upgrade upgrades a PyPI tool to the latest or a given version. The new
+// version is scanned before installing, and the manifest records the old
+// and new versions. With opts.Fresh, the old venv is set aside while a new
+// one is built, and restored if the upgrade fails.
+func (i *Installer) Upgrade(name string, opts UpgradeOptions) (*UpgradeRecord, error) {
+	ctx := context.Background()
+	tool, err := i.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if tool.Source.Type != SourcePyPI && tool.Source.Type != "" {
+		return nil, fmt.Errorf("%s was installed from %s; reinstall it with ophid install --force", name, tool.Source.Type)
+	}
+
+	// Only pypi.org answers version queries; pip resolves for other indexes
+	target := opts.Version
+	if (target == "" || target == "latest") && tool.Source.URL == "" {
+		if target, err = i.getLatestPyPIVersion(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to resolve the latest version of %s: %w", name, err)
+		}
+	}
+	if target == tool.Version && !opts.Force {
+		return nil, ErrUpToDate
+	}
+
+	secInfo := tool.Security
+	if !opts.SkipScan && target != "" && target != "latest" {
+		ui.Printf("Scanning %s@%s for vulnerabilities...\n", name, target)
+		var scanErr error
+		secInfo, scanErr = i.scanPackage(ctx, "pypi", name, target)
+		secInfo.VulnScanDate = time.Now()
+		if err := i.checkPyPIRelease(ctx, opts.Policy, name, target, tool.Source, &secInfo, scanErr, "upgrade"); err != nil {
+			return nil, err
+		}
+		if secInfo.VulnCount == 0 {
+			ui.OK("No vulnerabilities found")
+		}
+	}
+
+	pipEnv, err := i.pipEnv(ctx, InstallOptions{IndexURL: tool.Source.URL})
+	if err != nil {
+		return nil, err
+	}
+	spec := name
+	if target != "" && target != "latest" {
+		spec = name + "==" + target
+	}
+	policy := opts.BuildPolicy
+	if policy == "" {
+		policy = BuildPolicy(tool.Metadata[BuildPolicyKey])
+	}
+	if policy, err = ParseBuildPolicy(string(policy)); err != nil {
+		return nil, err
+	}
+
+	method := UpgradeInPlace
+	var venvPath string
+	if opts.Fresh {
+		method = UpgradeFresh
+		venvPath, err = i.freshVenv(tool, func(venv string) error {
+			return i.pip(venv, pipEnv, append(append([]string{"install"}, policy.PipArgs()...), spec)...)
+		})
+	} else {
+		venvPath = tool.InstallPath
+		args := append([]string{"install", "--upgrade"}, policy.PipArgs()...)
+		if opts.Force {
+			args = append(args, "--force-reinstall")
+		}
+		err = i.pip(venvPath, pipEnv, append(args, spec)...)
+		if err != nil {
+			err = fmt.Errorf("%w; the venv may be half upgraded, retry with --fresh", err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := i.getInstalledVersion(i.venvManager.GetPipPath(venvPath), name)
+	if err != nil {
+		version = target
+	}
+	if version == tool.Version && !opts.Force && !opts.Fresh {
+		// pip found nothing newer on an index we couldn't ask first
+		return nil, ErrUpToDate
+	}
+	executables, err := i.venvManager.ListExecutables(venvPath)
+	if err != nil {
+		executables = []string{}
+	}
+
+	record := UpgradeRecord{From: tool.Version, To: version, Method: method, UpgradedAt: time.Now()}
+	hadSBOM := tool.Security.SBOMPath != ""
+	tool.Version = version
+	tool.InstallPath = venvPath
+	tool.Executables = executables
+	tool.Security = secInfo
+	tool.Upgrades = append(tool.Upgrades, record)
+	if tool.Metadata == nil {
+		tool.Metadata = make(map[string]string)
+	}
+	tool.Metadata[BuildPolicyKey] = string(policy)
+	tool.UpdatedAt = record.UpgradedAt
+	if integrity, err := RecordIntegrity(venvPath); err != nil {
+		slog.Warn("failed to record integrity", "tool", name, "error", err)
+	} else {
+		tool.Integrity = integrity
+	}
+	i.claimExecutables(tool, false)
+	if err := i.writeLock(tool); err != nil {
+		slog.Warn("failed to write lockfile", "tool", name, "error", err)
+	}
+	if hadSBOM {
+		// Keep the SBOM ophid sbom wrote describing what is installed
+		if _, err := i.writeSBOM(tool); err != nil {
+			ui.Warn("failed to update the SBOM of %s: %v", name, err)
+		}
+	}
+	i.shareFiles(tool)
+	smokeErr := i.smokeTest(ctx, tool, InstallOptions{})
+	i.manifest.UpdatedAt = record.UpgradedAt
+	if err := i.saveManifest(); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+	i.syncShims()
+	if smokeErr != nil {
+		return nil, smokeErr
+	}
+	return &record, nil
+}
+
+// freshVenv replaces a tool's venv with a new one that install fills. The
+// old venv is moved aside rather than deleted until the new one works:
+// venvs can't be built elsewhere and moved in, as they hold their path.
+func (i *Installer) freshVenv(tool *Tool, install func(venv string) error) (string, error) {
+	if tool.InstallPath != filepath.Join(i.homeDir, "tools", tool.Name, "venv") {
+		return "", fmt.Errorf("%s isn't in a venv ophid can rebuild", tool.Name)
+	}
+	previous := tool.InstallPath + ".previous"
+	if err := os.RemoveAll(previous); err != nil {
+		return "", fmt.Errorf("failed to clear %s: %w", previous, err)
+	}
+	if err := os.Rename(tool.InstallPath, previous); err != nil {
+		return "", fmt.Errorf("failed to set the old venv aside: %w", err)
+	}
+	restore := func(cause error) error {
+		os.RemoveAll(tool.InstallPath)
+		if err := os.Rename(previous, tool.InstallPath); err != nil {
+			return fmt.Errorf("%w; restoring the old venv failed too, it is in %s: %v", cause, previous, err)
+		}
+		return fmt.Errorf("%w; the old venv was restored", cause)
+	}
+
+	venvPath, err := i.venvManager.CreateFor(tool.Name, tool.PythonVersion())
+	if err != nil {
+		return "", restore(fmt.Errorf("failed to create venv: %w", err))
+	}
+	if err := install(venvPath); err != nil {
+		return "", restore(err)
+	}
+	if err := os.RemoveAll(previous); err != nil {
+		slog.Warn("failed to remove the old venv", "path", previous, "error", err)
+	}
+	return venvPath, nil
+}
+
+// pip runs pip of a venv, showing its output
+func (i *Installer) pip(venvPath string, env []string, args ...string) error {
+	pipPath := i.venvManager.GetPipPath(venvPath)
+	ui.Printf("Running: %s %s\n", pipPath, strings.Join(args, " "))
+	cmd := exec.Command(pipPath, args...)
+	cmd.Env = env
+	return runPip(cmd)
+}
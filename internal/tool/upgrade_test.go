@@ -0,0 +1,155 @@
+package tool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakePython creates venvs whose pip records the version it installs, in
+// a file and the package's METADATA, and fails installs while
+// FAKE_PIP_FAIL is set
+const fakePython = `#!/bin/sh
+venv="$3"
+mkdir -p "$venv/bin"
+cat > "$venv/bin/pip" <<'PIP'
+#!/bin/sh
+dir=$(dirname "$0")
+case "$1" in
+install)
+	[ -n "$FAKE_PIP_FAIL" ] && exit 1
+	for arg; do
+		case "$arg" in *==*)
+			echo "${arg#*==}" > "$dir/../version"
+			mkdir -p "$dir/../lib/python3.12/site-packages/demo.dist-info"
+			printf 'Name: demo\nVersion: %s\n' "${arg#*==}" > "$dir/../lib/python3.12/site-packages/demo.dist-info/METADATA" ;;
+		esac
+	done
+	printf '#!/bin/sh\n' > "$dir/demo" && chmod +x "$dir/demo" ;;
+show)
+	echo "Name: demo"
+	echo "Version: $(cat "$dir/../version")" ;;
+esac
+PIP
+chmod +x "$venv/bin/pip"
+`
+
+func TestUpgrade(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake pip is a shell script")
+	}
+	home := t.TempDir()
+	python := filepath.Join(home, "python3")
+	os.WriteFile(python, []byte(fakePython), 0755)
+	venvMgr := NewVenvManager(home, python)
+	installer, err := NewInstaller(home, venvMgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	venv, err := venvMgr.Create("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := installer.pip(venv, nil, "install", "demo==1.0"); err != nil {
+		t.Fatal(err)
+	}
+	installer.manifest.Tools["demo"] = &Tool{Name: "demo", Version: "1.0", InstallPath: venv, Source: InstallSource{Type: SourcePyPI}}
+
+	if _, err := installer.Upgrade("demo", UpgradeOptions{Version: "1.0", SkipScan: true}); !errors.Is(err, ErrUpToDate) {
+		t.Errorf("upgrade to the installed version: %v, want ErrUpToDate", err)
+	}
+
+	record, err := installer.Upgrade("demo", UpgradeOptions{Version: "2.0", SkipScan: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.From != "1.0" || record.To != "2.0" || record.Method != UpgradeInPlace {
+		t.Errorf("in-place upgrade = %+v", record)
+	}
+	manifest, _ := LoadManifest(home)
+	if tool := manifest.Tools["demo"]; tool.Version != "2.0" || len(tool.Upgrades) != 1 || tool.Integrity == nil || len(tool.Executables) != 1 {
+		t.Errorf("manifest after upgrade = %+v", tool)
+	}
+	if policy := manifest.Tools["demo"].Metadata[BuildPolicyKey]; policy != string(BuildPreferBinary) {
+		t.Errorf("build policy after upgrade = %q, want the default", policy)
+	}
+
+	// A fresh venv leaves nothing of the old one
+	marker := filepath.Join(venv, "marker")
+	os.WriteFile(marker, nil, 0644)
+	if record, err = installer.Upgrade("demo", UpgradeOptions{Version: "3.0", Fresh: true, SkipScan: true}); err != nil {
+		t.Fatal(err)
+	}
+	if record.From != "2.0" || record.To != "3.0" || record.Method != UpgradeFresh {
+		t.Errorf("fresh upgrade = %+v", record)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("fresh upgrade kept the old venv's files")
+	}
+	if _, err := os.Stat(venv + ".previous"); !os.IsNotExist(err) {
+		t.Error("fresh upgrade left the old venv behind")
+	}
+
+	// A failed fresh upgrade brings the old venv back
+	os.WriteFile(marker, nil, 0644)
+	t.Setenv("FAKE_PIP_FAIL", "1")
+	if _, err := installer.Upgrade("demo", UpgradeOptions{Version: "4.0", Fresh: true, SkipScan: true}); err == nil {
+		t.Fatal("failing pip upgraded")
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("failed upgrade didn't restore the old venv")
+	}
+	if tool, _ := installer.Get("demo"); tool.Version != "3.0" || len(tool.Upgrades) != 2 {
+		t.Errorf("failed upgrade changed the manifest: %+v", tool)
+	}
+
+	installer.manifest.Tools["cli"] = &Tool{Name: "cli", Version: "0.1", Source: InstallSource{Type: SourceGitHub}}
+	if _, err := installer.Upgrade("cli", UpgradeOptions{}); err == nil {
+		t.Error("upgraded a tool installed from git")
+	}
+}
+
+func TestUpgradeSBOM(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake pip is a shell script")
+	}
+	home := t.TempDir()
+	python := filepath.Join(home, "python3")
+	os.WriteFile(python, []byte(fakePython), 0755)
+	venvMgr := NewVenvManager(home, python)
+	installer, err := NewInstaller(home, venvMgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	venv, err := venvMgr.Create("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := installer.pip(venv, nil, "install", "demo==1.0"); err != nil {
+		t.Fatal(err)
+	}
+	installer.manifest.Tools["demo"] = &Tool{Name: "demo", Version: "1.0", Ecosystem: "python", InstallPath: venv, Source: InstallSource{Type: SourcePyPI}}
+	if _, err := installer.GenerateSBOM("demo"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The SBOM follows the upgrade
+	if _, err := installer.Upgrade("demo", UpgradeOptions{Version: "2.0", SkipScan: true}); err != nil {
+		t.Fatal(err)
+	}
+	tool, _ := installer.Get("demo")
+	if tool.Security.SBOMPath != installer.SBOMPath("demo") {
+		t.Errorf("upgrade dropped the SBOM: %q", tool.Security.SBOMPath)
+	}
+	data, err := os.ReadFile(installer.SBOMPath("demo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"purl": "pkg:pypi/demo@2.0"`) {
+		t.Errorf("SBOM after upgrade:\n%s", data)
+	}
+}
@@ -6,14 +6,19 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 // VenvManager manages Python virtual environments
 type VenvManager struct {
 	homeDir     string
 	pythonPath  string
+	lookup      PythonLookup
 }
 
+// PythonLookup returns the interpreter of an installed Python version
+type PythonLookup func(version string) (string, error)
+
 // NewVenvManager creates a new virtual environment manager
 func NewVenvManager(homeDir, pythonPath string) *VenvManager {
 	return &VenvManager{
@@ -22,13 +27,43 @@ func NewVenvManager(homeDir, pythonPath string) *VenvManager {
 	}
 }
 
+// SetPythonLookup sets how CreateFor finds the interpreter of a Python version
+func (v *VenvManager) SetPythonLookup(lookup PythonLookup) {
+	v.lookup = lookup
+}
+
 // Create creates a new virtual environment for a tool
 func (v *VenvManager) Create(toolName string) (string, error) {
+	return v.create(toolName, v.pythonPath)
+}
+
+// CreateFor creates a tool's virtual environment with the interpreter of a
+// Python version, or the default one if version is empty
+func (v *VenvManager) CreateFor(toolName, version string) (string, error) {
+	if version == "" || v.lookup == nil {
+		return v.Create(toolName)
+	}
+	pythonPath, err := v.lookup(version)
+	if err != nil {
+		return "", err
+	}
+	return v.create(toolName, pythonPath)
+}
+
+// create creates a tool's virtual environment with an interpreter
+func (v *VenvManager) create(toolName, pythonPath string) (string, error) {
 	venvPath := filepath.Join(v.homeDir, "tools", toolName, "venv")
 
-	// Check if venv already exists
+	// Check if venv already exists; one built with another interpreter
+	// is rebuilt, so reinstalling with a new Python version takes effect
 	if _, err := os.Stat(venvPath); err == nil {
-		return venvPath, nil // Already exists
+		home := venvHome(venvPath)
+		if home == "" || pythonPath == "" || home == filepath.Dir(pythonPath) {
+			return venvPath, nil // Already exists
+		}
+		if err := os.RemoveAll(venvPath); err != nil {
+			return "", fmt.Errorf("failed to remove venv: %w", err)
+		}
 	}
 
 	// Create parent directory
@@ -37,7 +72,7 @@ func (v *VenvManager) Create(toolName string) (string, error) {
 	}
 
 	// Create venv using python -m venv
-	cmd := exec.Command(v.pythonPath, "-m", "venv", venvPath)
+	cmd := exec.Command(pythonPath, "-m", "venv", venvPath)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return "", fmt.Errorf("failed to create venv: %w\n%s", err, string(output))
 	}
@@ -45,6 +80,28 @@ func (v *VenvManager) Create(toolName string) (string, error) {
 	return venvPath, nil
 }
 
+// venvHome returns the directory of the interpreter a venv was built
+// with, from the home key of its pyvenv.cfg, or "" if it can't be read
+func venvHome(venvPath string) string {
+	return venvConfig(venvPath, "home")
+}
+
+// venvConfig returns a key of a venv's pyvenv.cfg, or "" if it can't be
+// read
+func venvConfig(venvPath, name string) string {
+	data, err := os.ReadFile(filepath.Join(venvPath, "pyvenv.cfg"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(key) == name {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
 // GetPipPath returns the path to pip in the venv
 func (v *VenvManager) GetPipPath(venvPath string) string {
 	if runtime.GOOS == "windows" {
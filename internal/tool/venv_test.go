@@ -1,6 +1,7 @@
 package tool
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -118,3 +119,75 @@ func TestVenvManager_ListExecutables(t *testing.T) {
 		}
 	}
 }
+
+func TestVenvManager_CreateFor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake interpreters are shell scripts")
+	}
+	tmpDir := t.TempDir()
+	// Interpreters that write the pyvenv.cfg python -m venv would
+	fakePython := func(dir string) string {
+		path := filepath.Join(tmpDir, dir, "bin", "python3")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		script := "#!/bin/sh\nmkdir -p \"$3\" && echo \"home = $(dirname \"$0\")\" > \"$3/pyvenv.cfg\"\n"
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	defaultPython, pinnedPython := fakePython("3.12.1"), fakePython("3.11.7")
+
+	venvMgr := NewVenvManager(tmpDir, defaultPython)
+	venvMgr.SetPythonLookup(func(version string) (string, error) {
+		if version != "3.11.7" {
+			return "", fmt.Errorf("Python %s is not installed", version)
+		}
+		return pinnedPython, nil
+	})
+
+	venvPath, err := venvMgr.Create("tool")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if home := venvHome(venvPath); home != filepath.Dir(defaultPython) {
+		t.Errorf("Create() built the venv with %s", home)
+	}
+	marker := filepath.Join(venvPath, "marker")
+	os.WriteFile(marker, nil, 0644)
+	if _, err := venvMgr.CreateFor("tool", ""); err != nil {
+		t.Fatalf("CreateFor() error = %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("CreateFor() rebuilt a venv of the same interpreter")
+	}
+
+	if _, err := venvMgr.CreateFor("tool", "3.11.7"); err != nil {
+		t.Fatalf("CreateFor(3.11.7) error = %v", err)
+	}
+	if home := venvHome(venvPath); home != filepath.Dir(pinnedPython) {
+		t.Errorf("CreateFor(3.11.7) built the venv with %s", home)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("CreateFor(3.11.7) kept the venv of another interpreter")
+	}
+	if _, err := venvMgr.CreateFor("tool", "3.9"); err == nil {
+		t.Error("CreateFor() accepted a Python version that isn't installed")
+	}
+}
+
+func TestTool_PythonVersion(t *testing.T) {
+	tests := []struct {
+		runtime string
+		want    string
+	}{
+		{pythonRuntimeOf(InstallOptions{Python: "3.11.7"}), "3.11.7"},
+		{pythonRuntimeOf(InstallOptions{}), ""},
+		{"python", ""},
+		{"rust", ""},
+	}
+	for _, tt := range tests {
+		if got := (&Tool{Runtime: tt.runtime}).PythonVersion(); got != tt.want {
+			t.Errorf("PythonVersion() of %q = %q, want %q", tt.runtime, got, tt.want)
+		}
+	}
+}
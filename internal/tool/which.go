@@ -0,0 +1,142 @@
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// Provider is an installed tool's executable and how the shell's PATH
+// resolves its name
+type Provider struct {
+	Tool       string   `json:"tool"`
+	Version    string   `json:"version"`
+	Executable string   `json:"executable"`
+	Path       string   `json:"path"`                  // The executable in the tool's venv
+	RunAs      string   `json:"run_as"`                // Name for `ophid run`, namespaced if another tool owns the bare name
+	Shim       string   `json:"shim,omitempty"`        // The shim running it by the bare name, if written
+	OnPath     bool     `json:"on_path"`               // The venv's bin directory or the shim is in PATH
+	Resolved   string   `json:"resolved,omitempty"`    // What the shell runs for the name
+	ShadowedBy []string `json:"shadowed_by,omitempty"` // Same-name executables earlier in PATH
+}
+
+// Shadowed reports whether the shell runs something else for the name,
+// though the tool's bin directory is in PATH
+func (p Provider) Shadowed() bool {
+	return len(p.ShadowedBy) > 0
+}
+
+// Which returns the installed tools that provide an executable, resolved
+// against pathEnv (a PATH value)
+func (i *Installer) Which(executable, pathEnv string) []Provider {
+	var providers []Provider
+	for _, p := range i.Providers(pathEnv) {
+		if p.Executable == executable {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// Providers returns every executable of every installed tool, sorted by
+// tool and executable, resolved against pathEnv
+func (i *Installer) Providers(pathEnv string) []Provider {
+	var providers []Provider
+	for _, t := range i.List() {
+		binDir := i.venvManager.GetBinDir(t.InstallPath)
+		for _, name := range t.Executables {
+			runAs := name
+			if owner, ok := i.manifest.ExecutableOwners[name]; ok && owner != t.Name {
+				runAs = t.Name + NamespaceSeparator + name
+			}
+			p := Provider{
+				Tool:       t.Name,
+				Version:    t.Version,
+				Executable: name,
+				Path:       filepath.Join(binDir, name),
+				RunAs:      runAs,
+			}
+			if shim := filepath.Join(i.ShimDir(), shimFile(name)); runAs == name && isShim(shim) {
+				p.Shim = shim
+			}
+			providers = append(providers, resolveProvider(p, pathEnv))
+		}
+	}
+
+	sort.Slice(providers, func(a, b int) bool {
+		if providers[a].Tool != providers[b].Tool {
+			return providers[a].Tool < providers[b].Tool
+		}
+		return providers[a].Executable < providers[b].Executable
+	})
+	return providers
+}
+
+// resolveProvider fills in how pathEnv resolves a provider's executable
+func resolveProvider(p Provider, pathEnv string) Provider {
+	matches := LookPathAll(p.Executable, pathEnv)
+	if len(matches) > 0 {
+		p.Resolved = matches[0]
+	}
+	for n, match := range matches {
+		if sameFile(match, p.Path) || (p.Shim != "" && sameFile(match, p.Shim)) {
+			p.OnPath = true
+			p.ShadowedBy = matches[:n]
+			break
+		}
+	}
+	return p
+}
+
+// LookPathAll returns every executable named name in the directories of
+// pathEnv, in PATH order. The first one is what the shell runs.
+func LookPathAll(name, pathEnv string) []string {
+	var matches []string
+	seen := make(map[string]bool)
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			dir = "." // An empty PATH entry is the working directory
+		}
+		for _, candidate := range executableNames(name) {
+			path := filepath.Join(dir, candidate)
+			if seen[path] || !isExecutable(path) {
+				continue
+			}
+			seen[path] = true
+			matches = append(matches, path)
+			break
+		}
+	}
+	return matches
+}
+
+// executableNames returns the file names the shell tries for name
+func executableNames(name string) []string {
+	if runtime.GOOS == "windows" && filepath.Ext(name) == "" {
+		return []string{name + ".exe", name + ".cmd", name + ".bat"}
+	}
+	return []string{name}
+}
+
+// isExecutable reports whether path is a file the shell can run
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode()&0111 != 0
+}
+
+// sameFile reports whether two paths name the same file, following symlinks
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
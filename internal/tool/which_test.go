@@ -0,0 +1,79 @@
+//go:build unix
+
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWhich(t *testing.T) {
+	tmpDir := t.TempDir()
+	venvMgr := NewVenvManager(tmpDir, "/usr/bin/python3")
+	installer, err := NewInstaller(tmpDir, venvMgr)
+	if err != nil {
+		t.Fatalf("NewInstaller() error = %v", err)
+	}
+
+	writeExecutable := func(dir, name string) string {
+		t.Helper()
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	venv := filepath.Join(tmpDir, "tools", "ansible", "venv")
+	binDir := venvMgr.GetBinDir(venv)
+	toolPath := writeExecutable(binDir, "ansible-playbook")
+	installer.manifest.Tools["ansible"] = &Tool{
+		Name:        "ansible",
+		Version:     "9.0.0",
+		InstallPath: venv,
+		Executables: []string{"ansible-playbook"},
+	}
+
+	system := filepath.Join(tmpDir, "usr-bin")
+	systemPath := writeExecutable(system, "ansible-playbook")
+	writeExecutable(filepath.Join(tmpDir, "not-executable"), "ansible-playbook")
+	os.Chmod(filepath.Join(tmpDir, "not-executable", "ansible-playbook"), 0644)
+
+	tests := []struct {
+		name     string
+		path     []string
+		onPath   bool
+		resolved string
+		shadowed []string
+	}{
+		{"not on PATH", []string{system}, false, systemPath, nil},
+		{"first", []string{binDir, system}, true, toolPath, nil},
+		{"shadowed", []string{filepath.Join(tmpDir, "not-executable"), system, binDir}, true, systemPath, []string{systemPath}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providers := installer.Which("ansible-playbook", strings.Join(tt.path, string(os.PathListSeparator)))
+			if len(providers) != 1 {
+				t.Fatalf("got %d providers, want 1", len(providers))
+			}
+
+			p := providers[0]
+			if p.Tool != "ansible" || p.Path != toolPath {
+				t.Errorf("provider = %+v", p)
+			}
+			if p.OnPath != tt.onPath || p.Resolved != tt.resolved || strings.Join(p.ShadowedBy, ",") != strings.Join(tt.shadowed, ",") {
+				t.Errorf("on_path=%v resolved=%q shadowed_by=%v, want %v %q %v", p.OnPath, p.Resolved, p.ShadowedBy, tt.onPath, tt.resolved, tt.shadowed)
+			}
+		})
+	}
+
+	if providers := installer.Which("terraform", binDir); len(providers) != 0 {
+		t.Errorf("Which(terraform) = %+v, want none", providers)
+	}
+}
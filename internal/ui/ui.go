@@ -0,0 +1,154 @@
+// Package ui formats the CLI's human-readable output: status lines such as
+// "[OK] ..." or "✓ ...", colored on a terminal.
+//
+// Status and progress messages go to stderr through the package-level
+// functions, so a command's data (tables, JSON, reports) can be written to
+// stdout and redirected cleanly. Reports that consist of status lines use
+// Stdout.
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Level is the kind of a status line
+type Level int
+
+const (
+	LevelOK Level = iota
+	LevelSuccess
+	LevelWarn
+	LevelError
+)
+
+// String returns the plain tag name, e.g. "WARN"
+func (l Level) String() string {
+	switch l {
+	case LevelOK:
+		return "OK"
+	case LevelSuccess:
+		return "SUCCESS"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Plain returns a level's tag without color or emoji, e.g. "[WARN]", for
+// files and logs
+func (l Level) Plain() string {
+	return "[" + l.String() + "]"
+}
+
+var (
+	emojis = map[Level]string{LevelOK: "✓", LevelSuccess: "✓", LevelWarn: "⚠", LevelError: "✗"}
+	colors = map[Level]string{LevelOK: "32", LevelSuccess: "32", LevelWarn: "33", LevelError: "31"}
+)
+
+// Options turns off decorations. Both are off anyway when the output is
+// not a terminal; NO_COLOR in the environment also turns off color.
+type Options struct {
+	NoColor bool
+	NoEmoji bool
+}
+
+// Printer writes status lines to one stream
+type Printer struct {
+	w     io.Writer
+	color bool
+	emoji bool
+}
+
+// NewPrinter creates a printer for w. Colors and emoji are used only when w
+// is a terminal.
+func NewPrinter(w io.Writer, opts Options) *Printer {
+	tty := isTerminal(w)
+	return &Printer{
+		w:     w,
+		color: tty && !opts.NoColor && os.Getenv("NO_COLOR") == "",
+		emoji: tty && !opts.NoEmoji,
+	}
+}
+
+// Stdout and Stderr print to the process's standard streams
+var (
+	Stdout = NewPrinter(os.Stdout, Options{})
+	Stderr = NewPrinter(os.Stderr, Options{})
+)
+
+// Configure applies options to Stdout and Stderr
+func Configure(opts Options) {
+	Stdout = NewPrinter(os.Stdout, opts)
+	Stderr = NewPrinter(os.Stderr, opts)
+}
+
+// Tag renders a level's tag for this printer
+func (p *Printer) Tag(level Level) string {
+	tag := level.Plain()
+	if p.emoji {
+		tag = emojis[level]
+	}
+	if p.color {
+		tag = "\x1b[" + colors[level] + "m" + tag + "\x1b[0m"
+	}
+	return tag
+}
+
+// Status prints one status line
+func (p *Printer) Status(level Level, format string, args ...any) {
+	fmt.Fprintf(p.w, "%s %s\n", p.Tag(level), fmt.Sprintf(format, args...))
+}
+
+// OK prints a passed check
+func (p *Printer) OK(format string, args ...any) { p.Status(LevelOK, format, args...) }
+
+// Success prints a completed action
+func (p *Printer) Success(format string, args ...any) { p.Status(LevelSuccess, format, args...) }
+
+// Warn prints a warning
+func (p *Printer) Warn(format string, args ...any) { p.Status(LevelWarn, format, args...) }
+
+// Error prints a failure
+func (p *Printer) Error(format string, args ...any) { p.Status(LevelError, format, args...) }
+
+// Printf prints an undecorated line or fragment
+func (p *Printer) Printf(format string, args ...any) {
+	fmt.Fprintf(p.w, format, args...)
+}
+
+// Println prints an undecorated line
+func (p *Printer) Println(args ...any) {
+	fmt.Fprintln(p.w, args...)
+}
+
+// OK prints a passed check to stderr
+func OK(format string, args ...any) { Stderr.OK(format, args...) }
+
+// Success prints a completed action to stderr
+func Success(format string, args ...any) { Stderr.Success(format, args...) }
+
+// Warn prints a warning to stderr
+func Warn(format string, args ...any) { Stderr.Warn(format, args...) }
+
+// Error prints a failure to stderr
+func Error(format string, args ...any) { Stderr.Error(format, args...) }
+
+// Printf prints a progress message to stderr
+func Printf(format string, args ...any) { Stderr.Printf(format, args...) }
+
+// Println prints a progress message to stderr
+func Println(args ...any) { Stderr.Println(args...) }
+
+// isTerminal reports whether w is a character device such as a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
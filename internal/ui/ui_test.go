@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrinterPlain(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPrinter(&buf, Options{}) // Not a terminal: no color, no emoji
+
+	p.OK("valid for %d days", 30)
+	p.Warn("expiring")
+	p.Error("expired")
+	p.Success("installed")
+
+	want := "[OK] valid for 30 days\n[WARN] expiring\n[ERROR] expired\n[SUCCESS] installed\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPrinterDecorations(t *testing.T) {
+	tests := []struct {
+		name         string
+		color, emoji bool
+		want         string
+	}{
+		{"plain", false, false, "[WARN]"},
+		{"emoji", false, true, "⚠"},
+		{"color", true, false, "\x1b[33m[WARN]\x1b[0m"},
+		{"both", true, true, "\x1b[33m⚠\x1b[0m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Printer{color: tt.color, emoji: tt.emoji}
+			if got := p.Tag(LevelWarn); got != tt.want {
+				t.Errorf("Tag = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevelPlain(t *testing.T) {
+	if got := LevelError.Plain(); got != "[ERROR]" {
+		t.Errorf("Plain = %q", got)
+	}
+}